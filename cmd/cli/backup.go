@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+)
+
+// runBackup downloads GET /admin/backup to a file (default: the server's file name)
+func runBackup(c *client, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	tables := fs.String("tables", "", "comma-separated tables to include (default: all)")
+	noData := fs.Bool("no-data", false, "back up table definitions without rows")
+	out := fs.String("out", "", "archive path (- for stdout; default: godataflow-backup-<time>.tar.gz)")
+	_ = fs.Parse(args)
+
+	query := url.Values{}
+	if *tables != "" {
+		query.Set("tables", *tables)
+	}
+	if *noData {
+		query.Set("data", "false")
+	}
+
+	resp, err := c.raw("GET", "/admin/backup", query, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("godataflow-backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	}
+	w, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, resp.Body)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if path != "-" {
+		fmt.Fprintf(os.Stderr, "wrote %s (%d bytes)\n", path, n)
+	}
+	return nil
+}
+
+// runRestore uploads an archive to POST /admin/restore
+func runRestore(c *client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	resp, err := c.raw("POST", "/admin/restore", nil, "application/gzip", f)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Tables   map[string]int64 `json:"tables"`
+		Metadata map[string]int64 `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(res.Tables))
+	for t := range res.Tables {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	for _, t := range names {
+		fmt.Printf("%s: %d rows\n", t, res.Tables[t])
+	}
+	fmt.Printf("restored %d tables\n", len(names))
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var errUsage = errors.New("usage")
+
+// client is a thin JSON client for the /v1 REST API
+type client struct {
+	base   string
+	apiKey string
+	http   *http.Client
+}
+
+func newClient(server, apiKey string) *client {
+	return &client{
+		base:   strings.TrimRight(server, "/") + "/v1",
+		apiKey: apiKey,
+		http:   &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// do sends a request and decodes a 2xx JSON response into out (if non-nil).
+// Error responses are reported with the API's "error" and "details" fields.
+func (c *client) do(method, path string, query url.Values, body, out interface{}) error {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(method, path, resp); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// raw sends body as-is and returns the response for the caller to stream;
+// the caller closes its body. Error responses are reported like do.
+func (c *client) raw(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(method, path, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkResponse turns a non-2xx response into an error with the API's
+// "error" and "details" fields
+func checkResponse(method, path string, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var apiErr struct {
+		Error   string `json:"error"`
+		Details string `json:"details"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error != "" {
+		if apiErr.Details != "" {
+			return fmt.Errorf("%s %s: %s (%s): %s", method, path, resp.Status, apiErr.Error, apiErr.Details)
+		}
+		return fmt.Errorf("%s %s: %s (%s)", method, path, resp.Status, apiErr.Error)
+	}
+	return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+}
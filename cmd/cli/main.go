@@ -0,0 +1,81 @@
+// Command cli is a command-line client for the GoDataFlow REST API, meant for
+// scripting and operations. Build it with `go build -o godataflow-cli ./cmd/cli`.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: godataflow-cli [flags] <command> [args]
+
+commands:
+  tables list                        list registered tables
+  tables create -f spec.yaml         create tables from a YAML spec
+  tables delete <name>               drop a table
+  refresh <table>                    run a refresh now
+  logs <table> [-n N] [-f]           show recent refresh logs; -f keeps polling for new ones
+  queries list                       list saved queries
+  queries run <id> [-o format]       run a saved query (format: table, json, csv, ndjson)
+  export <table> [-o format]         export rows via /query (format: csv, json, ndjson)
+  backup [-tables a,b] [-out file]   download a backup archive of metadata and tables
+  restore <file>                     restore a backup archive into this instance
+
+flags:
+`
+
+func main() {
+	flags := flag.NewFlagSet("godataflow-cli", flag.ExitOnError)
+	server := flags.String("server", envOr("GODATAFLOW_URL", "http://localhost:8080"), "API base URL (GODATAFLOW_URL)")
+	apiKey := flags.String("api-key", os.Getenv("GODATAFLOW_API_KEY"), "API key (GODATAFLOW_API_KEY)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c := newClient(*server, *apiKey)
+	var err error
+	switch args[0] {
+	case "tables":
+		err = runTables(c, args[1:])
+	case "refresh":
+		err = runRefresh(c, args[1:])
+	case "logs":
+		err = runLogs(c, args[1:])
+	case "queries":
+		err = runQueries(c, args[1:])
+	case "export":
+		err = runExport(c, args[1:])
+	case "backup":
+		err = runBackup(c, args[1:])
+	case "restore":
+		err = runRestore(c, args[1:])
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		if err == errUsage {
+			flags.Usage()
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
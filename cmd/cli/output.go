@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// writeRows prints rows in format, using columns for ordering (falls back
+// to the sorted keys of the first row)
+func writeRows(w io.Writer, format string, columns []string, rows []map[string]interface{}) error {
+	if len(columns) == 0 && len(rows) > 0 {
+		for k := range rows[0] {
+			columns = append(columns, k)
+		}
+		sort.Strings(columns)
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			rec := make([]string, len(columns))
+			for i, col := range columns {
+				rec[i] = cell(r[col])
+			}
+			if err := cw.Write(rec); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, r := range rows {
+			vals := make([]string, len(columns))
+			for i, col := range columns {
+				vals[i] = cell(r[col])
+			}
+			fmt.Fprintln(tw, strings.Join(vals, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// cell renders a JSON value for csv/table output; null becomes empty
+func cell(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(t)
+		return string(b)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// openOutput returns stdout, or a created file when path is set
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+func runQueries(c *client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		var queries []struct {
+			ID          int    `json:"id"`
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		if err := c.do("GET", "/queries", nil, nil, &queries); err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tDESCRIPTION")
+		for _, q := range queries {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", q.ID, q.Name, q.Description)
+		}
+		return tw.Flush()
+
+	case "run":
+		fs := flag.NewFlagSet("queries run", flag.ExitOnError)
+		format := fs.String("o", "table", "output format: table, json, csv, ndjson")
+		out := fs.String("out", "", "write to file instead of stdout")
+		if len(args) < 2 {
+			return errUsage
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("query id must be a number, got %q", args[1])
+		}
+		_ = fs.Parse(args[2:])
+
+		var resp struct {
+			Result []map[string]interface{} `json:"result"`
+		}
+		if err := c.do("GET", "/queries/run/"+strconv.Itoa(id), nil, nil, &resp); err != nil {
+			return err
+		}
+		return writeTo(*out, *format, nil, resp.Result)
+
+	default:
+		return errUsage
+	}
+}
+
+// runExport pages through /query and writes every row
+func runExport(c *client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("o", "csv", "output format: csv, json, ndjson")
+	out := fs.String("out", "", "write to file instead of stdout")
+	filter := fs.String("filter", "", "SQL filter, e.g. region='Asia'")
+	limit := fs.Int("limit", 0, "maximum rows (0 = all)")
+	pageSize := fs.Int("page-size", 1000, "rows per request")
+	if len(args) == 0 {
+		return errUsage
+	}
+	table := args[0]
+	_ = fs.Parse(args[1:])
+
+	var columns []struct {
+		ColumnName string `json:"column_name"`
+	}
+	if err := c.do("GET", "/tables/"+table+"/columns", nil, nil, &columns); err != nil {
+		return err
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.ColumnName
+	}
+
+	rows := []map[string]interface{}{}
+	for offset := 0; ; offset += *pageSize {
+		size := *pageSize
+		if *limit > 0 && *limit-len(rows) < size {
+			size = *limit - len(rows)
+		}
+		if size <= 0 {
+			break
+		}
+		query := url.Values{
+			"table":  {table},
+			"limit":  {strconv.Itoa(size)},
+			"offset": {strconv.Itoa(offset)},
+		}
+		if *filter != "" {
+			query.Set("filter", *filter)
+		}
+		var page struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		if err := c.do("GET", "/query", query, nil, &page); err != nil {
+			return err
+		}
+		rows = append(rows, page.Data...)
+		if len(page.Data) < size {
+			break
+		}
+	}
+	return writeTo(*out, *format, names, rows)
+}
+
+func writeTo(path, format string, columns []string, rows []map[string]interface{}) error {
+	w, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	if err := writeRows(w, format, columns, rows); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
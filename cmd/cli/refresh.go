@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func runRefresh(c *client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	var resp struct {
+		Status       string `json:"status"`
+		InsertedRows int    `json:"inserted_rows"`
+		Message      string `json:"message"`
+	}
+	if err := c.do("POST", "/refresh/"+args[0], nil, nil, &resp); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s (%d rows)\n", args[0], resp.Message, resp.InsertedRows)
+	return nil
+}
+
+type logEntry struct {
+	ID           int     `json:"id"`
+	Status       string  `json:"status"`
+	Message      *string `json:"message"`
+	ErrorCode    *string `json:"error_code"`
+	RowsInserted *int    `json:"rows_inserted"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// runLogs prints the last N refresh logs oldest first; -f polls for new ones
+func runLogs(c *client, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	n := fs.Int("n", 20, "number of recent logs to show")
+	follow := fs.Bool("f", false, "keep polling for new logs")
+	interval := fs.Duration("interval", 2*time.Second, "poll interval with -f")
+	status := fs.String("status", "", "only OK or ERROR logs")
+	if len(args) == 0 {
+		return errUsage
+	}
+	table := args[0]
+	_ = fs.Parse(args[1:])
+
+	query := url.Values{"limit": {strconv.Itoa(*n)}}
+	if *status != "" {
+		query.Set("status", *status)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	lastID := 0
+	for {
+		var logs []logEntry // newest first
+		if err := c.do("GET", "/refresh_logs/"+table, query, nil, &logs); err != nil {
+			return err
+		}
+		for i := len(logs) - 1; i >= 0; i-- {
+			l := logs[i]
+			if l.ID <= lastID {
+				continue
+			}
+			lastID = l.ID
+			msg, code, rows := "", "", ""
+			if l.Message != nil {
+				msg = *l.Message
+			}
+			if l.ErrorCode != nil {
+				code = *l.ErrorCode
+			}
+			if l.RowsInserted != nil {
+				rows = strconv.Itoa(*l.RowsInserted)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", l.CreatedAt, l.Status, rows, code, msg)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		if !*follow {
+			return nil
+		}
+		time.Sleep(*interval)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+)
+
+// tableSpec is one table in a `tables create` spec file
+type tableSpec struct {
+	TableName       string            `yaml:"table_name" json:"table_name"`
+	TableType       string            `yaml:"table_type" json:"table_type"`
+	RefreshInterval *int              `yaml:"refresh_interval" json:"refresh_interval,omitempty"`
+	Columns         map[string]string `yaml:"columns" json:"columns"`
+
+	// Optional refresh settings, applied with PUT /tables/:name/config
+	Config *struct {
+		DataSourceURL   *string                `yaml:"data_source_url"`
+		MappingJSON     map[string]interface{} `yaml:"mapping_json"`
+		WatermarkColumn *string                `yaml:"watermark_column"`
+	} `yaml:"config" json:"-"`
+}
+
+// specFile accepts a single table or a list under "tables:"
+type specFile struct {
+	tableSpec `yaml:",inline"`
+	Tables    []tableSpec `yaml:"tables"`
+}
+
+func runTables(c *client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		return listTables(c)
+	case "create":
+		return createTables(c, args[1:])
+	case "delete":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := c.do("DELETE", "/tables/"+args[1], nil, nil, nil); err != nil {
+			return err
+		}
+		fmt.Println("deleted", args[1])
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func listTables(c *client) error {
+	var tables []struct {
+		TableName       string  `json:"table_name"`
+		TableType       string  `json:"table_type"`
+		Status          string  `json:"status"`
+		RefreshInterval *int    `json:"refresh_interval"`
+		LastSuccess     *string `json:"last_refresh_success"`
+	}
+	if err := c.do("GET", "/tables", nil, nil, &tables); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tSTATUS\tINTERVAL\tLAST SUCCESS")
+	for _, t := range tables {
+		interval, last := "-", "-"
+		if t.RefreshInterval != nil {
+			interval = fmt.Sprintf("%ds", *t.RefreshInterval)
+		}
+		if t.LastSuccess != nil {
+			last = *t.LastSuccess
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.TableName, t.TableType, t.Status, interval, last)
+	}
+	return tw.Flush()
+}
+
+func createTables(c *client, args []string) error {
+	fs := flag.NewFlagSet("tables create", flag.ExitOnError)
+	file := fs.String("f", "", "YAML spec file")
+	_ = fs.Parse(args)
+	if *file == "" {
+		return errUsage
+	}
+
+	raw, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var spec specFile
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return fmt.Errorf("parse %s: %w", *file, err)
+	}
+	tables := spec.Tables
+	if spec.TableName != "" {
+		tables = append([]tableSpec{spec.tableSpec}, tables...)
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("%s defines no tables", *file)
+	}
+
+	for _, t := range tables {
+		if err := c.do("POST", "/tables", nil, t, nil); err != nil {
+			return err
+		}
+		fmt.Println("created", t.TableName)
+
+		if t.Config == nil {
+			continue
+		}
+		// the config endpoint always writes refresh_interval, so resend it
+		body := map[string]interface{}{
+			"refresh_interval": t.RefreshInterval,
+			"data_source_url":  t.Config.DataSourceURL,
+		}
+		if t.Config.MappingJSON != nil {
+			mapping, err := json.Marshal(t.Config.MappingJSON)
+			if err != nil {
+				return fmt.Errorf("%s mapping_json: %w", t.TableName, err)
+			}
+			body["mapping_json"] = json.RawMessage(mapping)
+		}
+		if t.Config.WatermarkColumn != nil {
+			body["watermark_column"] = *t.Config.WatermarkColumn
+		}
+		if err := c.do("PUT", "/tables/"+t.TableName+"/config", nil, body, nil); err != nil {
+			return err
+		}
+		fmt.Println("configured", t.TableName)
+	}
+	return nil
+}
@@ -3,31 +3,91 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
+	"github.com/alkha0306/godataflow/internal/cdc"
 	"github.com/alkha0306/godataflow/internal/config"
 	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/graphqlapi"
+	"github.com/alkha0306/godataflow/internal/grpcapi"
 	"github.com/alkha0306/godataflow/internal/handlers"
+	"github.com/alkha0306/godataflow/internal/httpclient"
+	"github.com/alkha0306/godataflow/internal/importer"
+	"github.com/alkha0306/godataflow/internal/ingeststats"
+	"github.com/alkha0306/godataflow/internal/logging"
+	"github.com/alkha0306/godataflow/internal/metrics"
+	"github.com/alkha0306/godataflow/internal/notify"
+	"github.com/alkha0306/godataflow/internal/quality"
+	"github.com/alkha0306/godataflow/internal/querylog"
+	"github.com/alkha0306/godataflow/internal/quota"
+	"github.com/alkha0306/godataflow/internal/replica"
+	"github.com/alkha0306/godataflow/internal/rollup"
 	"github.com/alkha0306/godataflow/internal/scheduler"
+	"github.com/alkha0306/godataflow/internal/share"
+	"github.com/alkha0306/godataflow/internal/sheets"
+	"github.com/alkha0306/godataflow/internal/sink"
+	"github.com/alkha0306/godataflow/internal/workspace"
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	// `godataflow migrate ...` manages the schema without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	// 1. Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("config load error: %v", err)
 	}
+	logging.Setup(cfg.Log.Level, cfg.Log.Format)
+	log.Printf("Using %s profile", cfg.Env)
 
 	// 2. Connect to DB
-	database, err := db.Connect(cfg.DatabaseURL)
+	pool := db.PoolConfig{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime.Duration,
+		ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime.Duration,
+	}
+	database, err := db.Connect(cfg.Database.URL, cfg.Database.Driver, pool)
 	if err != nil {
 		log.Fatalf("db connect error: %v", err)
 	}
 	defer database.Close()
+	metrics.Default.Register(metrics.DBStatsCollector("primary", database.DB))
+
+	// Watches the primary and reconnects with backoff after an outage
+	dbMonitor := db.NewMonitor(database)
+	metrics.Default.Register(metrics.CollectorFunc(func() []metrics.Sample {
+		up := 0.0
+		if dbMonitor.Healthy() {
+			up = 1
+		}
+		return []metrics.Sample{{Name: "godataflow_db_up", Help: "Whether the primary database answers pings.", Type: metrics.TypeGauge, Value: up}}
+	}))
+
+	// Optional read replica for query endpoints; reads fall back to the primary while it's down
+	var readReplica *sqlx.DB
+	if cfg.Database.ReadURL != "" {
+		readReplica, err = db.ConnectReplica(cfg.Database.ReadURL, cfg.Database.Driver, pool)
+		if err != nil {
+			log.Fatalf("replica connect error: %v", err)
+		}
+		metrics.Default.Register(metrics.DBStatsCollector("replica", readReplica.DB))
+	}
+	reads := db.NewReadRouter(database, readReplica)
+	defer reads.Close()
 
 	// Run DB migrations
 	if err := db.RunMigrations(database); err != nil {
@@ -35,60 +95,442 @@ func main() {
 	}
 	log.Println("All migrations applied")
 
+	// Event broker shared by scheduler and handlers (SSE /events)
+	broker := events.NewBroker()
+
+	// Outbound HTTP client shared by ETL fetches and previews (keep-alive pool, proxy)
+	httpClient, err := httpclient.New(httpclient.Options{
+		ConnectTimeout:        cfg.HTTPClient.ConnectTimeout.Duration,
+		ResponseHeaderTimeout: cfg.HTTPClient.ResponseHeaderTimeout.Duration,
+		IdleConnTimeout:       cfg.HTTPClient.IdleConnTimeout.Duration,
+		MaxIdleConns:          cfg.HTTPClient.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.HTTPClient.MaxIdleConnsPerHost,
+		ProxyURL:              cfg.HTTPClient.Proxy,
+	})
+	if err != nil {
+		log.Fatalf("http client error: %v", err)
+	}
+
+	// Shared ETL processor (scheduler + manual refresh)
+	etlProc := etl.NewETLProcessor(database, etl.FetchConfig{
+		Client:           httpClient,
+		Timeout:          cfg.HTTPClient.FetchTimeout.Duration,
+		MaxResponseBytes: cfg.HTTPClient.MaxResponseBytes,
+	}, etl.InsertConfig{
+		BatchSize:     cfg.ETL.InsertBatchSize,
+		CopyThreshold: cfg.ETL.CopyThreshold,
+		ChunkSize:     cfg.ETL.StreamChunkSize,
+		PipelineDepth: cfg.ETL.PipelineDepth,
+	}, etl.AnomalyConfig{
+		Factor:     cfg.ETL.AnomalyFactor,
+		MinHistory: cfg.ETL.AnomalyMinHistory,
+	})
+
+	// Change data capture to Kafka for ingested, refreshed and imported rows
+	cdcOutbox := cdc.New(database, cdc.Config{
+		Brokers:  cfg.CDC.KafkaBrokers,
+		Topic:    cfg.CDC.Topic,
+		Mode:     cfg.CDC.Mode,
+		Tables:   cfg.CDC.Tables,
+		ClientID: cfg.CDC.ClientID,
+		TLS:      cfg.CDC.KafkaTLS,
+		Timeout:  cfg.CDC.Timeout.Duration,
+
+		MaxAttempts: cfg.CDC.MaxAttempts,
+	})
+	etlProc.CDC = cdcOutbox
+
+	// Table, row, ingest rate and storage limits per workspace
+	quotas := quota.NewEnforcer(database, quota.Limits{
+		MaxTables:       cfg.Quotas.MaxTables,
+		MaxRowsPerTable: cfg.Quotas.MaxRowsPerTable,
+		IngestPerMinute: cfg.Quotas.IngestPerMinute,
+		MaxStorageBytes: cfg.Quotas.MaxStorageBytes,
+	}, cfg.Quotas.UsageInterval.Duration)
+	etlProc.Quotas = quotas
+
+	// Hourly rows and bytes per table written through the ingest API
+	ingestStats := ingeststats.NewRecorder(database, cfg.Ingest.StatsFlushInterval.Duration)
+
+	// Google Sheets export of saved queries and tables
+	var sheetsClient *sheets.Client
+	if cfg.Sheets.CredentialsFile != "" {
+		account, err := sheets.LoadServiceAccount(cfg.Sheets.CredentialsFile)
+		if err != nil {
+			log.Fatalf("sheets credentials error: %v", err)
+		}
+		sheetsClient = sheets.NewClient(account, httpClient, cfg.Sheets.Endpoint, cfg.Sheets.MaxRows)
+	}
+
+	// Data quality checks, run after scheduled and manual refreshes
+	qualityRunner := quality.NewRunner(database, broker)
+
+	// Export sinks, run after scheduled and manual refreshes
+	sinkExporter := sink.NewExporter(database, broker, sink.Config{
+		Client: httpClient,
+		S3: sink.Credentials{
+			Region:          cfg.Sinks.S3Region,
+			Endpoint:        cfg.Sinks.S3Endpoint,
+			AccessKeyID:     cfg.Sinks.S3AccessKeyID,
+			SecretAccessKey: cfg.Sinks.S3SecretAccessKey,
+			SessionToken:    cfg.Sinks.S3SessionToken,
+		},
+		GCS: sink.Credentials{
+			Endpoint:        cfg.Sinks.GCSEndpoint,
+			AccessKeyID:     cfg.Sinks.GCSAccessKeyID,
+			SecretAccessKey: cfg.Sinks.GCSSecret,
+		},
+		Timeout: cfg.Sinks.UploadTimeout.Duration,
+	})
+
+	// Per-table notification routes for pipeline events
+	notifier := notify.NewRouter(database, broker, httpClient, cfg.Notify.Timeout.Duration)
+
+	// Continuous aggregates, brought up to date after scheduled and manual refreshes
+	rollups := rollup.NewMaintainer(database, broker)
+
 	// Start scheduler
-	sched := scheduler.NewJobManager(database)
+	sched := scheduler.NewJobManager(database, etlProc, broker, scheduler.Options{
+		PollInterval: cfg.Scheduler.PollInterval.Duration,
+		Concurrency:  cfg.Scheduler.Concurrency,
+		Health:       dbMonitor,
+		Quality:      qualityRunner,
+		Sinks:        sinkExporter,
+		Rollups:      rollups,
+	})
+	// Source reconciliation; also run on demand via POST /tables/:name/reconcile
+	reconciler := scheduler.NewReconciler(database, etlProc, broker, cfg.Scheduler.ReconcileInterval.Duration, cfg.ETL.ReconcileTolerancePct)
+
+	// Replicas of tables on other instances; synced on demand via POST /replicas/:name/sync
+	syncer := replica.NewSyncer(database, etlProc, broker, httpClient, cfg.Scheduler.ReplicaSyncTimeout.Duration)
+	replicator := scheduler.NewReplicator(syncer, dbMonitor, cfg.Scheduler.PollInterval.Duration)
+
 	schedCtx, schedCancel := context.WithCancel(context.Background())
-	go sched.Start(schedCtx)
+	go reads.Start(schedCtx)
+	go dbMonitor.Start(schedCtx)
+	go cdcOutbox.Start(schedCtx)
+	go quotas.Start(schedCtx)
+	go ingestStats.Start(schedCtx)
+	if cfg.Metrics.StatsDAddress != "" {
+		go metrics.NewStatsDPusher(metrics.Default, metrics.StatsDConfig{
+			Address:  cfg.Metrics.StatsDAddress,
+			Prefix:   cfg.Metrics.StatsDPrefix,
+			Flavor:   cfg.Metrics.StatsDFlavor,
+			Tags:     cfg.Metrics.StatsDTags,
+			Interval: cfg.Metrics.StatsDInterval.Duration,
+		}).Start(schedCtx)
+	}
+	go notifier.Start(schedCtx)
+
+	// Expired ingest Idempotency-Key records are pruned even with the scheduler off
+	go scheduler.NewIdempotencyCleanup(database, cfg.Ingest.IdempotencyTTL.Duration).Start(schedCtx)
+	// and so are soft-deleted rows past their table's grace period
+	go scheduler.NewSoftDeletePurge(database).Start(schedCtx)
+	// and query audit log entries past their retention
+	queryLog := querylog.NewRecorder(database)
+	go scheduler.NewQueryLogCleanup(queryLog, cfg.Log.QueryLogRetention.Duration).Start(schedCtx)
+	// /query, /transform and saved query runs are only recorded when enabled
+	var queryAudit *querylog.Recorder
+	if cfg.Log.QueryLog {
+		queryAudit = queryLog
+	}
+	if cfg.Scheduler.Enabled {
+		// Refresh log retention/rollup runs alongside the scheduler
+		retention := scheduler.NewLogRetention(database, cfg.Scheduler.RefreshLogRetentionDays, cfg.Scheduler.RefreshLogRollup)
+
+		// Only the elected leader among instances sharing the database schedules
+		elector := scheduler.NewElector(database, cfg.Scheduler.LeaderLease.Duration)
+		go elector.Run(schedCtx, func(ctx context.Context) {
+			var wg sync.WaitGroup
+			for _, start := range []func(context.Context){sched.Start, retention.Start, reconciler.Start, replicator.Start} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					start(ctx)
+				}()
+			}
+			wg.Wait()
+		})
+	} else {
+		log.Println("Scheduler disabled by configuration")
+	}
 
 	// 3. Setup Gin router
-	router := gin.Default()
+	gin.SetMode(cfg.Server.GinMode)
+	router := gin.New()
+	// X-Forwarded-For (ClientIP) is only believed from the configured proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("trusted proxies error: %v", err)
+	}
+	if accessLog := handlers.AccessLogger(cfg.Log.AccessFormat); accessLog != nil {
+		router.Use(accessLog)
+	}
+	router.Use(gin.Recovery())
+	if cfg.Server.Compression {
+		router.Use(handlers.Gzip(cfg.Server.CompressionMinBytes))
+	}
 
 	// Health check
-	router.GET("/health", handlers.HealthHandler)
+	healthHandler := handlers.NewHealthHandler(dbMonitor, reads)
+	router.GET("/health", healthHandler.Health)
+	router.GET("/metrics", handlers.MetricsHandler)
+
+	// API reference (OpenAPI spec + Swagger UI)
+	docsHandler := handlers.NewDocsHandler()
+	router.GET("/docs", docsHandler.SwaggerUI)
+	router.GET("/docs/openapi.yaml", docsHandler.SpecYAML)
+	router.GET("/docs/openapi.json", docsHandler.SpecJSON)
+
+	// Admin UI; its pages call the API below with the key entered in the UI
+	uiHandler := handlers.NewUIHandler()
+	router.GET("/ui", uiHandler.Redirect)
+	router.GET("/ui/*path", uiHandler.Serve)
+
+	// Shared query links authenticate with their signed token, not an API key
+	workspaces := workspace.NewRegistry(database)
+	queryTemplateHandler := handlers.NewQueryTemplateHandler(database, reads, queryAudit)
+	signer, err := share.NewSigner(cfg.Sharing.Secret, cfg.Sharing.RatePerMinute)
+	if err != nil {
+		log.Fatalf("share signer error: %v", err)
+	}
+	if cfg.Sharing.Secret == "" {
+		log.Println("sharing.secret is not set: shared query links stop working on restart")
+	}
+	shareHandler := handlers.NewShareHandler(queryTemplateHandler, workspaces, signer, cfg.Sharing.TTL.Duration, cfg.Sharing.MaxTTL.Duration,
+		cfg.Sharing.MaxRows, cfg.Server.TrustedProxies)
+	router.GET("/shared/:token", shareHandler.OpenShared)
+
+	// Everything below requires an API key when auth.api_keys is configured.
+	// Workspace keys confine requests to their workspace's schema.
+	router.Use(handlers.APIKeyAuth(cfg.Auth.APIKeys, workspaces), handlers.WorkspaceScope())
+
+	// API routes are served under /v1 and, for integrations that predate
+	// versioning, unprefixed (pinned to v1 and marked deprecated)
+	api := apiRoutes{
+		router.Group("/v1", handlers.APIVersion("1")),
+		router.Group("", handlers.APIVersion("1"), handlers.LegacyRoute("/v1")),
+	}
+
+	// Runs can only be queued while the scheduler works the queue
+	var queue *scheduler.Queue
+	if cfg.Scheduler.Enabled {
+		queue = sched.Queue()
+	}
 
 	// Table management APIs
-	tableHandler := handlers.NewTableHandler(database)
-	router.GET("/tables", tableHandler.ListTables)
-	router.POST("/tables", tableHandler.CreateTable)
-	router.DELETE("/tables/:name", tableHandler.DeleteTable)
-	router.GET("/tables/:name/columns", tableHandler.GetTableColumns)
+	tableHandler := handlers.NewTableHandler(database, broker, quotas, queue)
+	api.GET("/tables", tableHandler.ListTables)
+	api.POST("/tables", tableHandler.CreateTable)
+	api.POST("/tables/bulk", tableHandler.CreateTablesBulk)
+	api.GET("/tables/:name", tableHandler.GetTable)
+	api.DELETE("/tables/:name", tableHandler.DeleteTable)
+	api.GET("/tables/:name/columns", tableHandler.GetTableColumns)
 
 	// Data ingestion API
-	dataIngestHandler := handlers.NewDataIngestHandler(database)
-	router.POST("/ingest/:table_name", dataIngestHandler.IngestData)
+	dataIngestHandler := handlers.NewDataIngestHandler(database, broker, cdcOutbox, quotas, ingestStats, handlers.IngestLimits{
+		MaxBodyBytes: cfg.Ingest.MaxBodyBytes,
+		MaxRows:      cfg.Ingest.MaxRows,
+	}, cfg.Ingest.IdempotencyTTL.Duration)
+	api.POST("/ingest/:table_name", dataIngestHandler.IngestData)
+	api.POST("/upsert/:name", dataIngestHandler.Upsert)
+	api.PATCH("/tables/:name/rows", dataIngestHandler.UpdateRows)
+	api.DELETE("/tables/:name/rows", dataIngestHandler.DeleteRows)
+
+	// Dry runs of ingest payloads for producers
+	ingestValidateHandler := handlers.NewIngestValidateHandler(dataIngestHandler, etlProc, qualityRunner)
+	api.POST("/ingest/:table_name/validate", ingestValidateHandler.Validate)
+
+	// Large ingest payloads loaded in the background
+	ingestJobs := handlers.NewIngestJobs(dataIngestHandler, cfg.Ingest.AsyncWorkers, cfg.Ingest.AsyncMaxBytes)
+	go ingestJobs.Start(schedCtx)
+	api.POST("/ingest/:table_name/jobs", ingestJobs.Submit)
+	api.GET("/ingest/jobs", ingestJobs.ListJobs)
+	api.GET("/ingest/jobs/:id", ingestJobs.GetJob)
+	api.GET("/tables/:name/ingest_stats", handlers.NewIngestStatsHandler(ingestStats).GetIngestStats)
 
 	// Query and Transform data API
-	queryHandler := handlers.NewQueryHandler(database)
-	router.GET("/query", queryHandler.QueryData)
-	router.GET("/transform", queryHandler.TransformData)
+	queryHandler := handlers.NewQueryHandler(reads, queryAudit)
+	api.GET("/query", queryHandler.QueryData)
+	api.POST("/query/compile", queryHandler.CompileQuery)
+	api.GET("/transform", queryHandler.TransformData)
+	api.GET("/tables/:name/sample", queryHandler.SampleTable)
+	api.GET("/tables/:name/fields", queryHandler.TableFields)
+	api.GET("/tables/:name/rows/:pk", queryHandler.GetRow)
+	api.GET("/tables/:name/export", queryHandler.ExportTable)
+
+	// Column statistics for query builders, cached until the table changes
+	columnStatsHandler := handlers.NewColumnStatsHandler(reads, broker)
+	go columnStatsHandler.Watch(schedCtx)
+	api.GET("/tables/:name/columns/:col/stats", columnStatsHandler.GetColumnStats)
+
+	// Point-in-time table snapshots
+	snapshotHandler := handlers.NewSnapshotHandler(database, broker, quotas)
+	api.POST("/tables/:name/snapshot", snapshotHandler.CreateSnapshot)
+	api.GET("/tables/:name/snapshots", snapshotHandler.ListSnapshots)
+	api.POST("/tables/:name/snapshots/:snapshot/restore", snapshotHandler.RestoreSnapshot)
+	api.DELETE("/tables/:name/snapshots/:snapshot", snapshotHandler.DropSnapshot)
+
+	// Bulk loads from export files and backup archives
+	importHandler := handlers.NewImportHandler(database, importer.NewImporter(database, etlProc, broker, httpClient, cfg.Ingest.ImportDir), cfg.Ingest.ImportMaxBytes)
+	api.POST("/tables/:name/import", importHandler.Import)
+	api.GET("/tables/:name/imports", importHandler.ListImports)
+	api.GET("/tables/:name/imports/:id", importHandler.GetImport)
+
+	// GraphQL over registered tables (schema generated from the catalog)
+	graphqlHandler := graphqlapi.NewHandler(reads, broker)
+	go graphqlHandler.Watch(schedCtx)
+	api.GET("/graphql", graphqlHandler.Serve)
+	api.POST("/graphql", graphqlHandler.Serve)
 
 	// saved queries mgmt API
-	queryTemplateHandler := handlers.NewQueryTemplateHandler(database)
-	router.GET("/queries", queryTemplateHandler.ListQueries)
-	router.POST("/queries", queryTemplateHandler.CreateQuery)
-	router.GET("/queries/run/:id", queryTemplateHandler.RunSavedQuery)
+	api.GET("/queries", queryTemplateHandler.ListQueries)
+	api.POST("/queries", queryTemplateHandler.CreateQuery)
+	api.GET("/queries/run/:id", queryTemplateHandler.RunSavedQuery)
+	api.POST("/queries/:id/share", shareHandler.ShareQuery)
+
+	// Results into Google Sheets for business users
+	sheetsHandler := handlers.NewSheetsHandler(reads, sheetsClient)
+	api.POST("/queries/:id/sheets", sheetsHandler.ExportSavedQuery)
+	api.POST("/tables/:name/export/sheets", sheetsHandler.ExportTable)
 
 	// Manual Refresh API
-	refreshHandler := handlers.NewRefreshHandler(database)
-	router.POST("/refresh/:table", refreshHandler.ManualRefresh)
+	refreshHandler := handlers.NewRefreshHandler(database, etlProc, broker, qualityRunner, sinkExporter, rollups, queue)
+	api.POST("/refresh/:table", refreshHandler.ManualRefresh)
+	api.POST("/runs/:id/retry", refreshHandler.RetryRun)
 
 	refreshLogsHandler := handlers.NewRefreshLogsHandler(database)
-	router.GET("/refresh_logs/:table", refreshLogsHandler.GetLogs)
+	api.GET("/refresh_logs", refreshLogsHandler.ListAllLogs)
+	api.GET("/refresh_logs/:table", refreshLogsHandler.GetLogs)
+	api.GET("/refresh_logs/:table/daily", refreshLogsHandler.GetDailyRollups)
+	api.GET("/runs/:id", refreshLogsHandler.GetRun)
+	api.GET("/query_logs", handlers.NewQueryLogHandler(queryLog).ListQueryLogs)
+
+	api.PUT("/tables/:name/config", tableHandler.UpdateTableConfig)
+
+	qualityHandler := handlers.NewQualityHandler(qualityRunner)
+	api.GET("/tables/:name/quality", qualityHandler.Report)
+
+	schemaDriftHandler := handlers.NewSchemaDriftHandler(etlProc)
+	api.GET("/tables/:name/schema-changes", schemaDriftHandler.Changes)
 
-	router.PUT("/tables/:name/config", tableHandler.UpdateTableConfig)
+	reconcileHandler := handlers.NewReconcileHandler(etlProc, reconciler)
+	api.GET("/tables/:name/reconciliation", reconcileHandler.History)
+	api.POST("/tables/:name/reconcile", reconcileHandler.Run)
+
+	// Read-only copies of tables on other godataflow instances
+	replicaHandler := handlers.NewReplicaHandler(syncer, replicator)
+	api.GET("/replicas", replicaHandler.ListReplicas)
+	api.POST("/replicas", replicaHandler.Subscribe)
+	api.GET("/replicas/:name", replicaHandler.GetReplica)
+	api.POST("/replicas/:name/sync", replicaHandler.SyncReplica)
+	api.DELETE("/replicas/:name", replicaHandler.Unsubscribe)
+
+	// Scheduled exports to object storage
+	sinkHandler := handlers.NewSinkHandler(sinkExporter)
+	api.GET("/tables/:name/sinks", sinkHandler.ListSinks)
+	api.POST("/tables/:name/sinks", sinkHandler.CreateSink)
+	api.DELETE("/tables/:name/sinks/:id", sinkHandler.DeleteSink)
+	api.POST("/tables/:name/sinks/:id/run", sinkHandler.RunSink)
+
+	// Continuous aggregates of time-series tables
+	rollupHandler := handlers.NewRollupHandler(rollups)
+	api.GET("/tables/:name/rollups", rollupHandler.ListRollups)
+	api.POST("/tables/:name/rollups", rollupHandler.CreateRollup)
+	api.DELETE("/tables/:name/rollups/:id", rollupHandler.DeleteRollup)
+	api.POST("/tables/:name/rollups/:id/run", rollupHandler.RunRollup)
+
+	// Notification routes (webhook or log) per table
+	notifyHandler := handlers.NewNotifyHandler(notifier)
+	api.GET("/tables/:name/notifications", notifyHandler.ListNotifications)
+	api.POST("/tables/:name/notifications", notifyHandler.CreateNotification)
+	api.DELETE("/tables/:name/notifications/:id", notifyHandler.DeleteNotification)
+	api.POST("/tables/:name/notifications/:id/test", notifyHandler.TestNotification)
 
 	// Preview endpoint for ETL mapping wizard
-	router.GET("/preview_source", handlers.PreviewSourceHandler)
+	previewHandler := handlers.NewPreviewHandler(httpClient, cfg.HTTPClient.PreviewTimeout.Duration, etlProc)
+	api.GET("/preview_source", previewHandler.PreviewSource)
+	api.POST("/transform/preview", previewHandler.TransformPreview)
+
+	// System summary for status pages
+	statsHandler := handlers.NewStatsHandler(database, sched, ingestStats)
+	api.GET("/stats/summary", statsHandler.Summary)
+
+	// Live pipeline activity (server-sent events)
+	eventsHandler := handlers.NewEventsHandler(broker)
+	api.GET("/events", eventsHandler.Stream)
+
+	// Live table changes over WebSocket (for dashboards)
+	tableSocketHandler := handlers.NewTableSocketHandler(broker, dataIngestHandler)
+	api.GET("/ws/tables/:name", tableSocketHandler.Subscribe)
+
+	// Operational endpoints
+	adminHandler := handlers.NewAdminHandler(database, broker)
+	api.GET("/admin/migrations", adminHandler.Migrations)
+	api.GET("/admin/backup", adminHandler.Backup)
+	api.POST("/admin/restore", adminHandler.Restore)
+
+	cdcHandler := handlers.NewCDCHandler(cdcOutbox)
+	api.GET("/admin/cdc", cdcHandler.Status)
+	api.POST("/admin/cdc/retry", cdcHandler.Retry)
+
+	// Maintenance mode: hold scheduled refreshes during database work
+	schedulerHandler := handlers.NewSchedulerHandler(sched)
+	api.GET("/scheduler", schedulerHandler.Status)
+	api.GET("/scheduler/queue", schedulerHandler.Queue)
+	api.POST("/scheduler/pause", schedulerHandler.Pause)
+	api.POST("/scheduler/resume", schedulerHandler.Resume)
+
+	// Tenants with their own schema, saved queries and API keys
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaces, len(cfg.Auth.APIKeys) > 0)
+	api.GET("/workspaces", workspaceHandler.ListWorkspaces)
+	api.POST("/workspaces", workspaceHandler.CreateWorkspace)
+	api.GET("/workspaces/:name", workspaceHandler.GetWorkspace)
+	api.DELETE("/workspaces/:name", workspaceHandler.DeleteWorkspace)
+	api.GET("/workspaces/:name/keys", workspaceHandler.ListKeys)
+	api.POST("/workspaces/:name/keys", workspaceHandler.IssueKey)
+	api.DELETE("/workspaces/:name/keys/:id", workspaceHandler.RevokeKey)
+
+	// Self-service key management for workspace keys
+	api.GET("/keys", workspaceHandler.ListOwnKeys)
+	api.POST("/keys", workspaceHandler.IssueOwnKey)
+	api.DELETE("/keys/:id", workspaceHandler.RevokeOwnKey)
+
+	// Quota usage and overrides
+	quotaHandler := handlers.NewQuotaHandler(quotas, workspaces)
+	api.GET("/usage", quotaHandler.GetUsage)
+	api.GET("/workspaces/:name/usage", quotaHandler.GetWorkspaceUsage)
+	api.PUT("/workspaces/:name/quota", quotaHandler.SetWorkspaceQuota)
+	api.PUT("/tables/:name/quota", quotaHandler.SetTableQuota)
+
+	// gRPC API over the same table, ingest and query handlers
+	var grpcServer *grpc.Server
+	if cfg.Server.GRPCPort != "" {
+		grpcServer = grpcapi.NewGRPCServer(
+			grpcapi.NewServer(tableHandler, dataIngestHandler, queryHandler),
+			cfg.Auth.APIKeys, workspaces,
+		)
+		lis, err := net.Listen("tcp", ":"+cfg.Server.GRPCPort)
+		if err != nil {
+			log.Fatalf("grpc listen error: %v", err)
+		}
+		go func() {
+			log.Printf("gRPC server running on port %s", cfg.Server.GRPCPort)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("grpc server error: %v", err)
+			}
+		}()
+	}
 
 	// 4. Start server with graceful shutdown
 	srv := &http.Server{
-		Addr:    ":" + cfg.Port,
+		Addr:    ":" + cfg.Server.Port,
 		Handler: router,
 	}
+	srv.RegisterOnShutdown(broker.Close)
 
 	// Run server in goroutine (non-blocking)
 	go func() {
-		log.Printf("Server running on port %s", cfg.Port)
+		log.Printf("Server running on port %s", cfg.Server.Port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("server start error: %v", err)
 		}
@@ -108,6 +550,19 @@ func main() {
 	schedCancel()
 	sched.Stop()
 
+	if grpcServer != nil {
+		// let in-flight RPCs finish, but not past the shutdown deadline
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
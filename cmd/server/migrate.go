@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/alkha0306/godataflow/internal/config"
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/logging"
+)
+
+const migrateUsage = `usage: godataflow migrate <command>
+
+commands:
+  up             apply all pending migrations
+  down [N]       roll back the last N migrations (default 1)
+  status         list migrations and whether they are applied
+  create <name>  add an empty up/down pair for every dialect (run from the repo root)
+`
+
+// runMigrate implements the migrate subcommands and returns the exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if args[0] == "create" {
+		fs := flag.NewFlagSet("migrate create", flag.ExitOnError)
+		dir := fs.String("dir", "internal/db/migrations", "migrations source folder")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		created, err := db.CreateMigration(*dir, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create failed: %v\n", err)
+			return 1
+		}
+		for _, p := range created {
+			fmt.Println("created", p)
+		}
+		return 0
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config load error: %v\n", err)
+		return 1
+	}
+	logging.Setup(cfg.Log.Level, cfg.Log.Format)
+
+	database, err := db.Connect(cfg.Database.URL, cfg.Database.Driver, db.PoolConfig{MaxOpenConns: 1, MaxIdleConns: 1})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db connect error: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "up":
+		if err := db.RunMigrations(database); err != nil {
+			fmt.Fprintf(os.Stderr, "migrations error: %v\n", err)
+			return 1
+		}
+		fmt.Println("All migrations applied")
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+				fmt.Fprintln(os.Stderr, "down expects a positive number of migrations")
+				return 2
+			}
+		}
+		reverted, err := db.RollbackMigrations(database, n)
+		for _, v := range reverted {
+			fmt.Println("rolled back", v)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rollback error: %v\n", err)
+			return 1
+		}
+
+	case "status":
+		states, err := db.MigrationStatus(database)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "status error: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tDOWN")
+		for _, st := range states {
+			state := "pending"
+			switch {
+			case st.Modified:
+				state = "MODIFIED"
+			case st.Applied:
+				state = "applied"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%v\n", st.Version, state, st.AppliedAt, st.HasDown)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
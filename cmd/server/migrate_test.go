@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestMigrateUpPostgres runs `migrate up` and `migrate down` the way the
+// CLI does, on the one-connection pool it opens. Set TEST_POSTGRES_URL to a
+// scratch database to run it.
+func TestMigrateUpPostgres(t *testing.T) {
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+	t.Setenv("DATABASE_URL", url)
+	t.Setenv("CONFIG_FILE", "")
+
+	for _, args := range [][]string{{"up"}, {"down", "1"}, {"up"}} {
+		done := make(chan int, 1)
+		go func() { done <- runMigrate(args) }()
+		select {
+		case code := <-done:
+			if code != 0 {
+				t.Fatalf("migrate %v exited with %d", args, code)
+			}
+		case <-time.After(2 * time.Minute):
+			t.Fatalf("migrate %v did not finish", args)
+		}
+	}
+}
+
+// TestMigrateUpSQLite runs every SQLite migration up, all the way down and
+// up again on a scratch database file
+func TestMigrateUpSQLite(t *testing.T) {
+	t.Setenv("DATABASE_URL", "sqlite://"+filepath.Join(t.TempDir(), "migrate.db"))
+	t.Setenv("CONFIG_FILE", "")
+
+	ups, err := filepath.Glob("../../internal/db/migrations/sqlite/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downs, err := filepath.Glob("../../internal/db/migrations/sqlite/*.down.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := strconv.Itoa(len(ups) - len(downs))
+
+	for _, args := range [][]string{{"up"}, {"down", all}, {"up"}} {
+		if code := runMigrate(args); code != 0 {
+			t.Fatalf("migrate %v exited with %d", args, code)
+		}
+	}
+}
+
+// TestMigrationVersionsMatch checks both dialects have the same migrations,
+// so a version names the same change on either
+func TestMigrationVersionsMatch(t *testing.T) {
+	list := func(d string) []string {
+		names, err := filepath.Glob(filepath.Join("../../internal/db/migrations", d, "*.sql"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, n := range names {
+			names[i] = filepath.Base(n)
+		}
+		return names
+	}
+	pg, lite := list("postgres"), list("sqlite")
+	if !slices.Equal(pg, lite) {
+		t.Errorf("postgres and sqlite migrations differ:\npostgres: %v\nsqlite:   %v", pg, lite)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// apiRoutes registers each route on several groups at once, so the
+// versioned and legacy paths can't drift apart
+type apiRoutes []*gin.RouterGroup
+
+func (r apiRoutes) GET(path string, h ...gin.HandlerFunc) {
+	for _, g := range r {
+		g.GET(path, h...)
+	}
+}
+
+func (r apiRoutes) POST(path string, h ...gin.HandlerFunc) {
+	for _, g := range r {
+		g.POST(path, h...)
+	}
+}
+
+func (r apiRoutes) PUT(path string, h ...gin.HandlerFunc) {
+	for _, g := range r {
+		g.PUT(path, h...)
+	}
+}
+
+func (r apiRoutes) DELETE(path string, h ...gin.HandlerFunc) {
+	for _, g := range r {
+		g.DELETE(path, h...)
+	}
+}
+
+func (r apiRoutes) PATCH(path string, h ...gin.HandlerFunc) {
+	for _, g := range r {
+		g.PATCH(path, h...)
+	}
+}
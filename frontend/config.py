@@ -1,3 +1,3 @@
 # frontend/config.py
 
-API_BASE = "http://localhost:8080"
+API_BASE = "http://localhost:8080/v1"
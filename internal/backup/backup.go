@@ -0,0 +1,329 @@
+// Package backup writes and restores portable archives of an instance: the
+// metadata tables plus the data of selected user tables. Archives are
+// gzipped tarballs of NDJSON files, so they restore across Postgres and
+// SQLite and can be inspected with standard tools.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/export"
+	"github.com/jmoiron/sqlx"
+)
+
+// FormatVersion is bumped when the archive layout changes incompatibly
+const FormatVersion = 1
+
+// ManifestName is the first entry of every archive
+const ManifestName = "manifest.json"
+
+// MetadataTables are the bookkeeping tables included in a backup, in
+// restore order. All but saved_queries are scoped to the backed-up tables
+// by their table_name column; saved queries of workspaces stay behind with
+// the workspaces themselves. Idempotency keys and queued jobs are
+// short-lived and schema_migrations belongs to the target instance, so
+// none of them is copied.
+var MetadataTables = []string{
+	"table_metadata",
+	"refresh_logs",
+	"refresh_log_rollups",
+	"ingest_stats",
+	"quality_results",
+	"schema_changes",
+	"reconciliation_results",
+	"table_sinks",
+	"table_notifications",
+	"saved_queries",
+}
+
+// ErrUnknownTable is returned when a requested table is not registered
+var ErrUnknownTable = errors.New("table is not registered")
+
+// Manifest describes an archive's contents
+type Manifest struct {
+	FormatVersion int             `json:"format_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Dialect       db.Dialect      `json:"dialect"`
+	SchemaVersion string          `json:"schema_version"` // latest migration applied on the source
+	Tables        []TableEntry    `json:"tables"`
+	Metadata      []MetadataEntry `json:"metadata"`
+}
+
+// TableEntry is a backed-up user table; Rows is nil when data was skipped
+type TableEntry struct {
+	Name    string      `json:"name"`
+	Columns []db.Column `json:"columns"`
+	Rows    *int64      `json:"rows,omitempty"`
+}
+
+// MetadataEntry is a backed-up metadata table
+type MetadataEntry struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// Options selects what goes into a backup
+type Options struct {
+	Tables []string // registered tables to include; empty = all
+	Data   bool     // include table rows, not just their definitions
+}
+
+// Archive is a prepared backup. Every entry is spooled to a temporary file
+// first, so failures surface before any byte is written to the caller.
+// Close removes the temporary files.
+type Archive struct {
+	Manifest Manifest
+	files    map[string]*os.File
+	order    []string
+}
+
+// TableEntryName and MetadataEntryName are the archive paths of the NDJSON entries
+func TableEntryName(table string) string    { return "tables/" + table + ".ndjson" }
+func MetadataEntryName(table string) string { return "metadata/" + table + ".ndjson" }
+
+// Prepare reads the selected tables and their metadata into an Archive
+func Prepare(database *sqlx.DB, opts Options) (*Archive, error) {
+	tables, err := selectTables(database, opts.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{
+		Manifest: Manifest{
+			FormatVersion: FormatVersion,
+			CreatedAt:     time.Now().UTC(),
+			Dialect:       db.DialectOf(database),
+			Tables:        []TableEntry{},
+			Metadata:      []MetadataEntry{},
+		},
+		files: map[string]*os.File{},
+	}
+	if a.Manifest.SchemaVersion, err = schemaVersion(database); err != nil {
+		return nil, err
+	}
+
+	ok := false
+	defer func() {
+		if !ok {
+			a.Close()
+		}
+	}()
+
+	for _, table := range tables {
+		cols, err := db.TableColumns(database, table)
+		if err != nil {
+			return nil, fmt.Errorf("read columns of %s: %w", table, err)
+		}
+		entry := TableEntry{Name: table, Columns: cols}
+		if opts.Data {
+			t, _ := db.ParseTableName(table)
+			n, err := a.spool(TableEntryName(table), database, fmt.Sprintf("SELECT * FROM %s", t.Quoted()), cols)
+			if err != nil {
+				return nil, fmt.Errorf("back up %s: %w", table, err)
+			}
+			entry.Rows = &n
+		}
+		a.Manifest.Tables = append(a.Manifest.Tables, entry)
+	}
+
+	for _, name := range MetadataTables {
+		cols, err := db.TableColumns(database, name)
+		if err != nil {
+			return nil, fmt.Errorf("read columns of %s: %w", name, err)
+		}
+		query, args := metadataQuery(name, cols, tables)
+		query, args, err = sqlx.In(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		n, err := a.spool(MetadataEntryName(name), database, database.Rebind(query), cols, args...)
+		if err != nil {
+			return nil, fmt.Errorf("back up %s: %w", name, err)
+		}
+		a.Manifest.Metadata = append(a.Manifest.Metadata, MetadataEntry{Name: name, Rows: n})
+	}
+
+	ok = true
+	return a, nil
+}
+
+// WriteTo writes the archive as a gzipped tarball: the manifest, then the
+// table entries, then the metadata entries
+func (a *Archive) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	gz := gzip.NewWriter(cw)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(a.Manifest, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0o644, Size: int64(len(manifest)), ModTime: a.Manifest.CreatedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return cw.n, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return cw.n, err
+	}
+
+	for _, name := range a.order {
+		f := a.files[name]
+		info, err := f.Stat()
+		if err != nil {
+			return cw.n, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return cw.n, err
+		}
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: info.Size(), ModTime: a.Manifest.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return cw.n, err
+		}
+		if _, err := io.Copy(tw, f); err != nil {
+			return cw.n, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return cw.n, err
+	}
+	err = gz.Close()
+	return cw.n, err
+}
+
+// Close removes the spooled entries
+func (a *Archive) Close() {
+	for _, f := range a.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	a.files = map[string]*os.File{}
+}
+
+// spool writes the rows of query to a temporary NDJSON file registered as entry name
+func (a *Archive) spool(name string, database *sqlx.DB, query string, cols []db.Column, args ...interface{}) (int64, error) {
+	f, err := os.CreateTemp("", "godataflow-backup-*.ndjson")
+	if err != nil {
+		return 0, err
+	}
+	a.files[name] = f
+	a.order = append(a.order, name)
+
+	rows, err := database.Queryx(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	w, _ := export.NewWriter(export.NDJSON, f, cols)
+	var n int64
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return n, err
+		}
+		if err := w.Write(row); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// selectTables validates the requested tables, defaulting to every registered one
+func selectTables(database *sqlx.DB, requested []string) ([]string, error) {
+	var registered []string
+	if err := database.Select(&registered, `SELECT table_name FROM table_metadata ORDER BY table_name`); err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+	if len(requested) == 0 {
+		return registered, nil
+	}
+
+	known := map[string]bool{}
+	for _, t := range registered {
+		known[t] = true
+	}
+	seen := map[string]bool{}
+	tables := []string{}
+	for _, t := range requested {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if !known[t] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTable, t)
+		}
+		seen[t] = true
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// metadataQuery selects a metadata table's rows for tables, oldest first
+func metadataQuery(name string, cols []db.Column, tables []string) (string, []interface{}) {
+	scoped, hasID, workspaced := false, false, false
+	for _, c := range cols {
+		scoped = scoped || c.ColumnName == "table_name"
+		hasID = hasID || c.ColumnName == "id"
+		workspaced = workspaced || c.ColumnName == "workspace_id"
+	}
+
+	query := "SELECT * FROM " + name
+	var args []interface{}
+	if scoped {
+		if len(tables) == 0 {
+			query += " WHERE 1 = 0"
+		} else {
+			query += " WHERE table_name IN (?)"
+			args = append(args, tables)
+		}
+	}
+	if workspaced {
+		query += " WHERE workspace_id IS NULL"
+	}
+	if hasID {
+		query += " ORDER BY id"
+	}
+	return query, args
+}
+
+// schemaVersion is the latest migration applied to database
+func schemaVersion(database *sqlx.DB) (string, error) {
+	applied, err := db.AppliedMigrations(database)
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for v := range applied {
+		if v > latest {
+			latest = v
+		}
+	}
+	return latest, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,337 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidArchive wraps every problem with the archive itself
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// ConflictError lists archived tables that already exist on the target
+type ConflictError struct {
+	Tables []string
+}
+
+func (e *ConflictError) Error() string {
+	return "tables already exist: " + strings.Join(e.Tables, ", ")
+}
+
+// Result summarizes a restore
+type Result struct {
+	Tables   map[string]int64 `json:"tables"`   // rows restored per user table
+	Metadata map[string]int64 `json:"metadata"` // rows restored per metadata table
+}
+
+// Restore loads an archive written by Archive.WriteTo, in one transaction.
+// Archived tables must not exist yet; saved queries whose name is taken
+// are skipped. Row ids are reassigned by the target, and metadata columns
+// the target does not have are dropped, so archives from older or newer
+// releases restore as far as the schemas overlap.
+func Restore(database *sqlx.DB, r io.Reader) (Result, error) {
+	res := Result{Tables: map[string]int64{}, Metadata: map[string]int64{}}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return res, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != ManifestName {
+		return res, fmt.Errorf("%w: first entry must be %s", ErrInvalidArchive, ManifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return res, fmt.Errorf("%w: manifest: %v", ErrInvalidArchive, err)
+	}
+	if m.FormatVersion != FormatVersion {
+		return res, fmt.Errorf("%w: format version %d is not supported (want %d)", ErrInvalidArchive, m.FormatVersion, FormatVersion)
+	}
+
+	// Everything that needs its own query runs before the transaction
+	// starts: SQLite has a single connection.
+	tables := map[string]TableEntry{}
+	var conflicts []string
+	for _, t := range m.Tables {
+		name, err := db.ParseTableName(t.Name)
+		if err == nil {
+			err = db.CheckSchemaSupport(database, name)
+		}
+		if err != nil || len(t.Columns) == 0 {
+			return res, fmt.Errorf("%w: table %q: %v", ErrInvalidArchive, t.Name, err)
+		}
+		existing, err := db.TableColumns(database, t.Name)
+		if err != nil {
+			return res, err
+		}
+		var registered int
+		if err := database.Get(&registered, `SELECT COUNT(*) FROM table_metadata WHERE table_name = $1`, t.Name); err != nil {
+			return res, err
+		}
+		if len(existing) > 0 || registered > 0 {
+			conflicts = append(conflicts, t.Name)
+		}
+		tables[TableEntryName(t.Name)] = t
+	}
+	if len(conflicts) > 0 {
+		return res, &ConflictError{Tables: conflicts}
+	}
+
+	metadata := map[string]map[string]string{}
+	for _, name := range MetadataTables {
+		cols, err := db.TableColumns(database, name)
+		if err != nil {
+			return res, err
+		}
+		metadata[MetadataEntryName(name)] = columnTypes(cols)
+	}
+
+	tx, err := database.Beginx()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	for _, t := range m.Tables {
+		if err := CreateTable(tx, t); err != nil {
+			return res, err
+		}
+		res.Tables[t.Name] = 0
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		if t, ok := tables[hdr.Name]; ok {
+			n, err := insertRows(tx, t.Name, columnTypes(t.Columns), false, tr)
+			if err != nil {
+				return res, fmt.Errorf("restore %s: %w", t.Name, err)
+			}
+			res.Tables[t.Name] = n
+			continue
+		}
+		if types, ok := metadata[hdr.Name]; ok {
+			table := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "metadata/"), ".ndjson")
+			n, err := insertRows(tx, table, types, true, tr)
+			if err != nil {
+				return res, fmt.Errorf("restore %s: %w", table, err)
+			}
+			res.Metadata[table] = n
+		}
+		// unknown entries (metadata tables this release lacks) are skipped
+	}
+
+	return res, tx.Commit()
+}
+
+// OpenTable reads an archive's manifest and positions it at the data of
+// table, or of its only table when table is not in the archive. Reads from
+// the returned reader yield that table's NDJSON rows.
+func OpenTable(r io.Reader, table string) (TableEntry, io.Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return TableEntry{}, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != ManifestName {
+		return TableEntry{}, nil, fmt.Errorf("%w: first entry must be %s", ErrInvalidArchive, ManifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return TableEntry{}, nil, fmt.Errorf("%w: manifest: %v", ErrInvalidArchive, err)
+	}
+	if m.FormatVersion != FormatVersion {
+		return TableEntry{}, nil, fmt.Errorf("%w: format version %d is not supported (want %d)", ErrInvalidArchive, m.FormatVersion, FormatVersion)
+	}
+
+	var entry *TableEntry
+	for i := range m.Tables {
+		if m.Tables[i].Name == table {
+			entry = &m.Tables[i]
+		}
+	}
+	if entry == nil && len(m.Tables) == 1 {
+		entry = &m.Tables[0]
+	}
+	if entry == nil {
+		return TableEntry{}, nil, fmt.Errorf("%w: %s is not in the archive and it holds %d tables", ErrUnknownTable, table, len(m.Tables))
+	}
+	if entry.Rows == nil {
+		return TableEntry{}, nil, fmt.Errorf("%w: %s was backed up without data", ErrInvalidArchive, entry.Name)
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return TableEntry{}, nil, fmt.Errorf("%w: no data entry for %s", ErrInvalidArchive, entry.Name)
+		}
+		if err != nil {
+			return TableEntry{}, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if hdr.Name == TableEntryName(entry.Name) {
+			return *entry, tr, nil
+		}
+	}
+}
+
+// typeRE limits archived column types to plain type names, e.g.
+// "timestamp without time zone" or "numeric(10,2)"
+var typeRE = regexp.MustCompile(`^[A-Za-z0-9_ (),]+$`)
+
+// CreateTable recreates an archived table with its recorded column types
+func CreateTable(tx *sqlx.Tx, t TableEntry) error {
+	name, _ := db.ParseTableName(t.Name)
+	if name.Schema != "" {
+		if _, err := tx.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, name.Schema)); err != nil {
+			return fmt.Errorf("create schema for %s: %w", t.Name, err)
+		}
+	}
+	defs := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		if strings.ContainsRune(c.ColumnName, '"') || !typeRE.MatchString(c.DataType) {
+			return fmt.Errorf("%w: column %q %q of %s", ErrInvalidArchive, c.ColumnName, c.DataType, t.Name)
+		}
+		defs[i] = fmt.Sprintf(`"%s" %s`, c.ColumnName, c.DataType)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s (%s)`, name.Quoted(), strings.Join(defs, ", "))); err != nil {
+		return fmt.Errorf("create %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// insertRows inserts every NDJSON row of r into table, keeping only the
+// columns in types. Metadata rows drop their id and skip rows that clash
+// with existing ones. Statements are prepared once per column set.
+func insertRows(tx *sqlx.Tx, table string, types map[string]string, metadata bool, r io.Reader) (int64, error) {
+	suffix := ""
+	if metadata {
+		suffix = " ON CONFLICT DO NOTHING"
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	stmts := map[string]*sqlx.Stmt{}
+	defer func() {
+		for _, s := range stmts {
+			s.Close()
+		}
+	}()
+
+	names := make([]string, 0, len(types))
+	for col := range types {
+		names = append(names, col)
+	}
+	sort.Strings(names)
+
+	var n int64
+	for {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("%w: row %d: %v", ErrInvalidArchive, n+1, err)
+		}
+
+		var cols []string
+		var args []interface{}
+		for _, col := range names {
+			v, ok := row[col]
+			if !ok || (metadata && col == "id") {
+				continue
+			}
+			cols = append(cols, col)
+			args = append(args, convert(v, types[col]))
+		}
+		if len(cols) == 0 {
+			continue
+		}
+
+		key := strings.Join(cols, ",")
+		stmt, ok := stmts[key]
+		if !ok {
+			quoted := make([]string, len(cols))
+			params := make([]string, len(cols))
+			for i, c := range cols {
+				quoted[i] = `"` + c + `"`
+				params[i] = fmt.Sprintf("$%d", i+1)
+			}
+			var err error
+			stmt, err = tx.Preparex(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)%s",
+				db.QuoteTable(table), strings.Join(quoted, ", "), strings.Join(params, ", "), suffix))
+			if err != nil {
+				return n, err
+			}
+			stmts[key] = stmt
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return n, fmt.Errorf("row %d: %w", n+1, err)
+		}
+		n++
+	}
+}
+
+// columnTypes maps column names to their lower-cased declared types
+func columnTypes(cols []db.Column) map[string]string {
+	types := make(map[string]string, len(cols))
+	for _, c := range cols {
+		types[c.ColumnName] = strings.ToLower(c.DataType)
+	}
+	return types
+}
+
+// convert turns a decoded NDJSON value back into what the column expects.
+// Timestamps were written as RFC3339 and JSON columns as their text; SQLite
+// needs the latter as bytes to scan them back into json.RawMessage. Other
+// numbers than int64s keep their text, so decimals restore every digit.
+func convert(v interface{}, typ string) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		return t.String() // exact; the database parses it for the column's type
+	case string:
+		switch {
+		case strings.Contains(typ, "timestamp") || strings.Contains(typ, "datetime"):
+			if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return ts
+			}
+		case typ == "date":
+			if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return ts.Format("2006-01-02")
+			}
+		case strings.Contains(typ, "json") || typ == "blob":
+			return []byte(t)
+		}
+		return t
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(t)
+		if strings.Contains(typ, "json") || typ == "blob" {
+			return b
+		}
+		return string(b)
+	}
+	return v
+}
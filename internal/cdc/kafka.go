@@ -0,0 +1,524 @@
+package cdc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kafka API keys and the versions spoken here. Produce v3 (record batch v2)
+// and Metadata v4 are supported by brokers from 0.11 through 4.x.
+const (
+	apiProduce  = 0
+	apiMetadata = 3
+
+	produceVersion  = 3
+	metadataVersion = 4
+)
+
+// Largest record batch sent in one Produce request, under the broker's
+// default message.max.bytes (1 MiB)
+const maxBatchBytes = 900 << 10
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Broker error codes the relay treats specially
+const (
+	errCorruptMessage       = 2
+	errUnknownTopic         = 3
+	errLeaderNotAvailable   = 5
+	errMessageTooLarge      = 10
+	errInvalidTopic         = 17
+	errTopicAuthorization   = 29
+	errClusterAuthorization = 31
+)
+
+// kafkaErrors names the broker error codes a producer commonly sees
+var kafkaErrors = map[int16]string{
+	errCorruptMessage:       "CORRUPT_MESSAGE",
+	errUnknownTopic:         "UNKNOWN_TOPIC_OR_PARTITION",
+	errLeaderNotAvailable:   "LEADER_NOT_AVAILABLE",
+	6:                       "NOT_LEADER_OR_FOLLOWER",
+	7:                       "REQUEST_TIMED_OUT",
+	errMessageTooLarge:      "MESSAGE_TOO_LARGE",
+	errInvalidTopic:         "INVALID_TOPIC_EXCEPTION",
+	19:                      "NOT_ENOUGH_REPLICAS",
+	20:                      "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	errTopicAuthorization:   "TOPIC_AUTHORIZATION_FAILED",
+	errClusterAuthorization: "CLUSTER_AUTHORIZATION_FAILED",
+}
+
+// brokerError is an error code returned by a broker
+type brokerError struct {
+	code int16
+}
+
+func (e *brokerError) Error() string {
+	if name, ok := kafkaErrors[e.code]; ok {
+		return fmt.Sprintf("kafka error %d (%s)", e.code, name)
+	}
+	return fmt.Sprintf("kafka error %d", e.code)
+}
+
+func kafkaError(code int16) error {
+	return &brokerError{code: code}
+}
+
+// Producer is a minimal Kafka producer: it finds partition leaders with
+// Metadata requests and writes uncompressed record batches with acks=all.
+// It is safe for concurrent use.
+type Producer struct {
+	Brokers  []string // bootstrap host:port list
+	ClientID string
+	TLS      *tls.Config // nil = plaintext
+	Timeout  time.Duration
+
+	mu     sync.Mutex
+	conns  map[string]*kafkaConn    // by broker address
+	topics map[string][]partitionOf // cached leaders by topic
+}
+
+type partitionOf struct {
+	id     int32
+	leader string // broker address
+}
+
+func NewProducer(brokers []string, clientID string, tlsConfig *tls.Config, timeout time.Duration) *Producer {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Producer{
+		Brokers:  brokers,
+		ClientID: clientID,
+		TLS:      tlsConfig,
+		Timeout:  timeout,
+		conns:    map[string]*kafkaConn{},
+		topics:   map[string][]partitionOf{},
+	}
+}
+
+// Produce writes values to topic in order. All values share key and so
+// land on the same partition. Values above the batch limit are split over
+// several requests; if a later one fails the earlier ones stay written.
+func (p *Producer) Produce(ctx context.Context, topic string, key []byte, values [][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.produce(ctx, topic, key, values)
+	if err != nil {
+		// leaders may have moved or the connection broken: start over next time
+		delete(p.topics, topic)
+		p.closeAll()
+	}
+	return err
+}
+
+// Close drops every broker connection
+func (p *Producer) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeAll()
+}
+
+func (p *Producer) closeAll() {
+	for addr, c := range p.conns {
+		c.Close()
+		delete(p.conns, addr)
+	}
+}
+
+func (p *Producer) produce(ctx context.Context, topic string, key []byte, values [][]byte) error {
+	partitions, err := p.partitions(ctx, topic)
+	if err != nil {
+		return err
+	}
+	part := partitions[partition(key, len(partitions))]
+	conn, err := p.conn(ctx, part.leader)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(values); {
+		end, size := start, 0
+		for end < len(values) && (end == start || size+len(values[end]) <= maxBatchBytes) {
+			size += len(values[end])
+			end++
+		}
+		if err := p.produceBatch(ctx, conn, topic, part.id, key, values[start:end]); err != nil {
+			return fmt.Errorf("produce to %s[%d] on %s: %w", topic, part.id, part.leader, err)
+		}
+		start = end
+	}
+	return nil
+}
+
+func (p *Producer) produceBatch(ctx context.Context, conn *kafkaConn, topic string, partition int32, key []byte, values [][]byte) error {
+	var e encoder
+	e.int16(-1) // transactional_id: null
+	e.int16(-1) // acks: all in-sync replicas
+	e.int32(int32(p.Timeout / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(1)
+	e.int32(partition)
+	e.bytes(recordBatch(key, values, time.Now()))
+
+	resp, err := conn.request(ctx, p.Timeout, apiProduce, produceVersion, p.ClientID, e.b)
+	if err != nil {
+		return err
+	}
+	d := decoder{b: resp}
+	for t := d.arrayLen(); t > 0 && d.err == nil; t-- {
+		d.string()
+		for n := d.arrayLen(); n > 0 && d.err == nil; n-- {
+			d.int32()
+			code := d.int16()
+			d.int64() // base_offset
+			d.int64() // log_append_time
+			if d.err == nil && code != 0 {
+				return kafkaError(code)
+			}
+		}
+	}
+	return d.err
+}
+
+// partitions returns topic's partitions and their leaders, from the cache
+// or a Metadata request to the first reachable bootstrap broker
+func (p *Producer) partitions(ctx context.Context, topic string) ([]partitionOf, error) {
+	if parts, ok := p.topics[topic]; ok {
+		return parts, nil
+	}
+
+	var errs []error
+	for _, addr := range p.Brokers {
+		conn, err := p.conn(ctx, addr)
+		if err == nil {
+			var parts []partitionOf
+			if parts, err = p.metadata(ctx, conn, topic); err == nil {
+				p.topics[topic] = parts
+				return parts, nil
+			}
+			conn.Close()
+			delete(p.conns, addr)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+	}
+	return nil, fmt.Errorf("kafka metadata for %s: %w", topic, errors.Join(errs...))
+}
+
+func (p *Producer) metadata(ctx context.Context, conn *kafkaConn, topic string) ([]partitionOf, error) {
+	var e encoder
+	e.int32(1)
+	e.string(topic)
+	e.bool(true) // allow_auto_topic_creation, if the broker allows it
+
+	resp, err := conn.request(ctx, p.Timeout, apiMetadata, metadataVersion, p.ClientID, e.b)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder{b: resp}
+	d.int32() // throttle_time_ms
+	brokers := map[int32]string{}
+	for n := d.arrayLen(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.nullableString() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.nullableString() // cluster_id
+	d.int32()          // controller_id
+
+	var parts []partitionOf
+	var topicErr int16
+	for t := d.arrayLen(); t > 0 && d.err == nil; t-- {
+		code := d.int16()
+		name := d.string()
+		d.bool() // is_internal
+		for n := d.arrayLen(); n > 0 && d.err == nil; n-- {
+			d.int16() // partition error; a missing leader is caught below
+			id := d.int32()
+			leader := d.int32()
+			d.int32Array() // replicas
+			d.int32Array() // isr
+			if name == topic {
+				parts = append(parts, partitionOf{id: id, leader: brokers[leader]})
+			}
+		}
+		if name == topic {
+			topicErr = code
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if topicErr != 0 {
+		return nil, kafkaError(topicErr)
+	}
+	if len(parts) == 0 {
+		return nil, kafkaError(errUnknownTopic)
+	}
+	for _, part := range parts {
+		if part.leader == "" {
+			return nil, fmt.Errorf("partition %d: %w", part.id, kafkaError(errLeaderNotAvailable))
+		}
+	}
+	// hash to a stable partition whatever order the broker lists them in
+	sort.Slice(parts, func(i, j int) bool { return parts[i].id < parts[j].id })
+	return parts, nil
+}
+
+func (p *Producer) conn(ctx context.Context, addr string) (*kafkaConn, error) {
+	if c, ok := p.conns[addr]; ok {
+		return c, nil
+	}
+	dialer := &net.Dialer{Timeout: p.Timeout}
+	var nc net.Conn
+	var err error
+	if p.TLS != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: p.TLS}).DialContext(ctx, "tcp", addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &kafkaConn{Conn: nc, r: bufio.NewReader(nc)}
+	p.conns[addr] = c
+	return c, nil
+}
+
+// partition picks key's partition the way Kafka's default partitioner
+// does, so other producers writing the same key agree with this one
+func partition(key []byte, n int) int {
+	return int(murmur2(key)&0x7fffffff) % n
+}
+
+// murmur2 is the 32-bit MurmurHash2 variant of Kafka's Utils.murmur2
+func murmur2(data []byte) uint32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	h := seed ^ uint32(len(data))
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	switch rest := data[n:]; len(rest) {
+	case 3:
+		h ^= uint32(rest[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(rest[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(rest[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// recordBatch encodes values as an uncompressed v2 record batch
+func recordBatch(key []byte, values [][]byte, now time.Time) []byte {
+	ts := now.UnixMilli()
+
+	var records []byte
+	for i, v := range values {
+		var rec []byte
+		rec = append(rec, 0)                     // attributes
+		rec = binary.AppendVarint(rec, 0)        // timestamp delta
+		rec = binary.AppendVarint(rec, int64(i)) // offset delta
+		rec = appendVarBytes(rec, key)
+		rec = appendVarBytes(rec, v)
+		rec = binary.AppendVarint(rec, 0) // headers
+		records = binary.AppendVarint(records, int64(len(rec)))
+		records = append(records, rec...)
+	}
+
+	// the CRC covers everything from the attributes on
+	var body encoder
+	body.int16(0) // attributes: no compression, CreateTime
+	body.int32(int32(len(values) - 1))
+	body.int64(ts)
+	body.int64(ts)
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(values)))
+	body.b = append(body.b, records...)
+
+	var batch encoder
+	batch.int64(0) // base offset, assigned by the broker
+	batch.int32(int32(4 + 1 + 4 + len(body.b)))
+	batch.int32(-1)              // partition leader epoch
+	batch.b = append(batch.b, 2) // magic
+	batch.b = binary.BigEndian.AppendUint32(batch.b, crc32.Checksum(body.b, castagnoli))
+	batch.b = append(batch.b, body.b...)
+	return batch.b
+}
+
+func appendVarBytes(b, v []byte) []byte {
+	if v == nil {
+		return binary.AppendVarint(b, -1)
+	}
+	b = binary.AppendVarint(b, int64(len(v)))
+	return append(b, v...)
+}
+
+// kafkaConn is one broker connection; requests are sent one at a time
+type kafkaConn struct {
+	net.Conn
+	r           *bufio.Reader
+	correlation int32
+}
+
+func (c *kafkaConn) request(ctx context.Context, timeout time.Duration, apiKey, version int16, clientID string, body []byte) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+
+	c.correlation++
+	var e encoder
+	e.int32(0) // size, filled in below
+	e.int16(apiKey)
+	e.int16(version)
+	e.int32(c.correlation)
+	e.string(clientID)
+	e.b = append(e.b, body...)
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	if _, err := c.Write(e.b); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 || int32(binary.BigEndian.Uint32(resp)) != c.correlation {
+		return nil, errors.New("kafka: response does not match request")
+	}
+	return resp[4:], nil
+}
+
+// encoder appends Kafka's big-endian primitive types
+type encoder struct{ b []byte }
+
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.b = append(e.b, 1)
+	} else {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+// decoder reads Kafka's primitive types; the first short read sticks in err
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errors.New("kafka: truncated response")
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int16() int16 {
+	if v := d.take(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if v := d.take(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if v := d.take(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+func (d *decoder) bool() bool {
+	v := d.take(1)
+	return v != nil && v[0] != 0
+}
+
+func (d *decoder) string() string {
+	return string(d.take(int(d.int16())))
+}
+
+func (d *decoder) nullableString() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) int32Array() {
+	for n := d.arrayLen(); n > 0 && d.err == nil; n-- {
+		d.int32()
+	}
+}
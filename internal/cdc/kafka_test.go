@@ -0,0 +1,68 @@
+package cdc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vectors from Kafka's UtilsTest.testMurmur2
+func TestMurmur2(t *testing.T) {
+	cases := []struct {
+		in   []byte
+		want int32
+	}{
+		{[]byte("21"), -973932308},
+		{[]byte("foobar"), -790332482},
+		{[]byte("a-little-bit-long-string"), -985981536},
+		{[]byte("a-little-bit-longer-string"), -1486304829},
+		{[]byte("lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8"), -58897971},
+		{[]byte{'a', 'b', 'c'}, 479470107},
+	}
+	for _, tc := range cases {
+		if got := int32(murmur2(tc.in)); got != tc.want {
+			t.Errorf("murmur2(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	// toPositive(murmur2("foobar")) % 16, as Kafka's partitioner computes it
+	want := int((int32(-790332482) & 0x7fffffff) % 16)
+	if got := partition([]byte("foobar"), 16); got != want {
+		t.Errorf("partition = %d, want %d", got, want)
+	}
+	for n := 1; n <= 8; n++ {
+		if got := partition([]byte("orders"), n); got < 0 || got >= n {
+			t.Errorf("partition(orders, %d) = %d, out of range", n, got)
+		}
+	}
+}
+
+func TestRecordBatch(t *testing.T) {
+	// assembled field by field from the v2 record batch layout; the CRC-32C
+	// was computed separately
+	want := strings.Join([]string{
+		"0000000000000000", // base offset
+		"0000004e",         // batch length
+		"ffffffff",         // partition leader epoch
+		"02",               // magic
+		"ad42a3e2",         // crc32c of everything below
+		"0000",             // attributes
+		"00000001",         // last offset delta
+		"0000018bcfe56800", // first timestamp
+		"0000018bcfe56800", // max timestamp
+		"ffffffffffffffff", // producer id
+		"ffff",             // producer epoch
+		"ffffffff",         // base sequence
+		"00000002",         // record count
+		"1a", "00", "00", "00", "0c", "6f7264657273", "02", "61", "00",
+		"1c", "00", "00", "02", "0c", "6f7264657273", "04", "6263", "00",
+	}, "")
+	got := recordBatch([]byte("orders"), [][]byte{[]byte("a"), []byte("bc")}, time.UnixMilli(1700000000000))
+	if w, _ := hex.DecodeString(want); !bytes.Equal(got, w) {
+		t.Errorf("recordBatch =\n%x\nwant\n%s", got, want)
+	}
+}
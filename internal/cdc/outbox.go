@@ -0,0 +1,484 @@
+// Package cdc publishes inserted rows to Kafka for downstream stream
+// processors. Each write queues its batch in the cdc_outbox table inside
+// the write's own transaction, and a relay delivers the batches in order,
+// so changes survive Kafka outages and restarts. Delivery is at least
+// once: a batch is only removed from the outbox after the broker
+// acknowledged it.
+package cdc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// Message modes
+const (
+	ModeRows    = "rows"    // one message per inserted row
+	ModeSummary = "summary" // one message per insert batch
+)
+
+// How often the relay checks the outbox when nothing wakes it, the longest
+// a failing table waits between retries, and the attempts a batch gets by
+// default before it is dead-lettered
+const (
+	relayInterval      = 5 * time.Second
+	maxBackoff         = time.Minute
+	defaultMaxAttempts = 10
+)
+
+// Config selects the topic and what is published
+type Config struct {
+	Brokers  []string // empty disables change capture
+	Topic    string   // "{table}" is replaced by the table name
+	Mode     string   // rows (default) or summary
+	Tables   []string // empty = every table
+	ClientID string
+	TLS      bool
+	Timeout  time.Duration // per Kafka request
+
+	MaxAttempts int // failed deliveries before a batch is dead-lettered; 0 = default
+}
+
+// Outbox records committed insert batches and relays them to Kafka. A nil
+// *Outbox is valid and records nothing.
+type Outbox struct {
+	DB       *sqlx.DB
+	Producer *Producer
+	Topic    string
+	Mode     string
+
+	MaxAttempts int // failed deliveries before a batch is dead-lettered
+
+	tables map[string]bool // empty = all
+	wake   chan struct{}
+
+	mu            sync.Mutex
+	retries       map[string]retry // tables whose oldest batch is failing
+	delivered     int64
+	lastDelivered *time.Time
+	lastError     string
+}
+
+// Status reports the relay's progress for GET /admin/cdc
+type Status struct {
+	Enabled         bool       `json:"enabled"`
+	Topic           string     `json:"topic,omitempty"`
+	Mode            string     `json:"mode,omitempty"`
+	PendingBatches  int        `json:"pending_batches"`
+	PendingRows     int        `json:"pending_rows"`
+	OldestPending   *time.Time `json:"oldest_pending,omitempty"`
+	DeadBatches     int        `json:"dead_batches"`      // given up on; POST /admin/cdc/retry requeues them
+	RetryingTables  []string   `json:"retrying_tables"`   // tables whose oldest batch is failing
+	Delivered       int64      `json:"delivered_batches"` // since the server started
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// message is the JSON value published to Kafka
+type message struct {
+	Table    string                 `json:"table"`
+	Op       string                 `json:"op"`
+	Source   string                 `json:"source"` // ingest, refresh, import, upsert or api
+	Row      map[string]interface{} `json:"row,omitempty"`
+	Where    map[string]interface{} `json:"where,omitempty"` // updates and deletes: the rows' filter
+	RowCount int                    `json:"row_count,omitempty"`
+	Columns  []string               `json:"columns,omitempty"`
+	BatchID  interface{}            `json:"batch_id,omitempty"`
+	Time     time.Time              `json:"time"`
+}
+
+// New returns nil when no brokers are configured
+func New(database *sqlx.DB, cfg Config) *Outbox {
+	if len(cfg.Brokers) == 0 {
+		return nil
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ModeRows
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	tables := map[string]bool{}
+	for _, t := range cfg.Tables {
+		tables[t] = true
+	}
+	return &Outbox{
+		DB:          database,
+		Producer:    NewProducer(cfg.Brokers, cfg.ClientID, tlsConfig, cfg.Timeout),
+		Topic:       cfg.Topic,
+		Mode:        mode,
+		MaxAttempts: maxAttempts,
+		tables:      tables,
+		wake:        make(chan struct{}, 1),
+		retries:     map[string]retry{},
+	}
+}
+
+// Record queues a batch of rows inserted into table. Call it on the
+// insert's transaction, before it commits, so the batch is queued if and
+// only if the rows are written; an error should fail the insert. Call
+// Notify after the commit.
+func (o *Outbox) Record(tx sqlx.Execer, table, source string, rows []map[string]interface{}) error {
+	return o.recordRows(tx, table, source, "insert", rows)
+}
+
+// RecordUpsert is Record for rows inserted or updated by an upsert; their
+// messages carry op "upsert"
+func (o *Outbox) RecordUpsert(tx sqlx.Execer, table, source string, rows []map[string]interface{}) error {
+	return o.recordRows(tx, table, source, "upsert", rows)
+}
+
+func (o *Outbox) recordRows(tx sqlx.Execer, table, source, op string, rows []map[string]interface{}) error {
+	if o == nil || len(rows) == 0 || (len(o.tables) > 0 && !o.tables[table]) {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	var msgs []message
+	if o.Mode == ModeSummary {
+		msgs = []message{{Table: table, Op: op, Source: source, RowCount: len(rows), Columns: columns(rows), BatchID: rows[0][db.BatchIDColumn], Time: now}}
+	} else {
+		msgs = make([]message, len(rows))
+		for i, row := range rows {
+			msgs[i] = message{Table: table, Op: op, Source: source, Row: row, Time: now}
+		}
+	}
+	return o.enqueue(tx, table, msgs, len(rows))
+}
+
+// RecordReload queues a single message with op "replace", "merge" or
+// "append" for a staged load swapping rowCount rows into table, on the
+// swap's transaction. The rows themselves are not published; consumers
+// should re-read the table.
+func (o *Outbox) RecordReload(tx sqlx.Execer, table, source, op string, rowCount int) error {
+	if o == nil || (len(o.tables) > 0 && !o.tables[table]) {
+		return nil
+	}
+	return o.enqueue(tx, table, []message{{Table: table, Op: op, Source: source, RowCount: rowCount, Time: time.Now().UTC()}}, rowCount)
+}
+
+// RecordUpdate queues a single message with op "update" for rowCount rows
+// of table set to the values in set, on the update's transaction; the
+// message carries set as its row and where, the filter that selected them.
+func (o *Outbox) RecordUpdate(tx sqlx.Execer, table, source string, set, where map[string]interface{}, rowCount int) error {
+	if o == nil || rowCount == 0 || (len(o.tables) > 0 && !o.tables[table]) {
+		return nil
+	}
+	return o.enqueue(tx, table, []message{{Table: table, Op: "update", Source: source, Row: set, Where: where, RowCount: rowCount, Time: time.Now().UTC()}}, rowCount)
+}
+
+// RecordDelete queues a single message with op "delete" for rowCount rows
+// of table matching where, on the delete's transaction
+func (o *Outbox) RecordDelete(tx sqlx.Execer, table, source string, where map[string]interface{}, rowCount int) error {
+	if o == nil || rowCount == 0 || (len(o.tables) > 0 && !o.tables[table]) {
+		return nil
+	}
+	return o.enqueue(tx, table, []message{{Table: table, Op: "delete", Source: source, Where: where, RowCount: rowCount, Time: time.Now().UTC()}}, rowCount)
+}
+
+// Notify wakes the relay after a transaction that queued batches commits
+func (o *Outbox) Notify() {
+	if o == nil {
+		return
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue stores msgs in the outbox through tx
+func (o *Outbox) enqueue(tx sqlx.Execer, table string, msgs []message, rowCount int) error {
+	payload, err := json.Marshal(msgs)
+	if err != nil {
+		return fmt.Errorf("encode %d rows of %s for change capture: %w", rowCount, table, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO cdc_outbox (table_name, messages, row_count) VALUES ($1, $2, $3)`,
+		table, string(payload), rowCount); err != nil {
+		return fmt.Errorf("queue %d rows of %s for change capture: %w", rowCount, table, err)
+	}
+	return nil
+}
+
+// Start delivers queued batches until ctx is done. Each table's batches go
+// out oldest first; a failing batch holds back the later ones of its table
+// only, which back off while the other tables keep flowing. A batch that
+// fails MaxAttempts times, or with an error retrying cannot fix, is
+// dead-lettered so its table moves on.
+func (o *Outbox) Start(ctx context.Context) {
+	if o == nil {
+		return
+	}
+	defer o.Producer.Close()
+
+	for {
+		if err := o.deliver(ctx); err != nil && ctx.Err() == nil {
+			o.mu.Lock()
+			o.lastError = err.Error()
+			o.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(o.nextWait()):
+		}
+	}
+}
+
+type outboxEntry struct {
+	ID       int64  `db:"id"`
+	Table    string `db:"table_name"`
+	Messages string `db:"messages"`
+	Attempts int    `db:"attempts"`
+}
+
+// retry is the backoff of a table whose oldest batch failed
+type retry struct {
+	delay time.Duration
+	at    time.Time
+}
+
+// deliver publishes each table's queued batches, oldest first, until every
+// table is done or backing off. It returns the last failure.
+func (o *Outbox) deliver(ctx context.Context) error {
+	var last error
+	for ctx.Err() == nil {
+		// the oldest live batch of every table
+		var heads []outboxEntry
+		err := o.DB.Select(&heads, `
+			SELECT id, table_name, messages, attempts FROM cdc_outbox
+			WHERE id IN (SELECT MIN(id) FROM cdc_outbox WHERE dead_at IS NULL GROUP BY table_name)
+			ORDER BY id`)
+		if err != nil {
+			return fmt.Errorf("read outbox: %w", err)
+		}
+
+		progress := false
+		for _, entry := range heads {
+			if ctx.Err() != nil {
+				break
+			}
+			if o.backingOff(entry.Table) {
+				continue
+			}
+			if err := o.publish(ctx, entry); err != nil {
+				last = err
+				if ctx.Err() == nil {
+					progress = o.failed(entry, err) || progress
+				}
+				continue
+			}
+			if _, err := o.DB.Exec(`DELETE FROM cdc_outbox WHERE id = $1`, entry.ID); err != nil {
+				return fmt.Errorf("remove delivered batch %d: %w", entry.ID, err)
+			}
+			progress = true
+
+			now := time.Now().UTC()
+			o.mu.Lock()
+			delete(o.retries, entry.Table)
+			o.delivered++
+			o.lastDelivered = &now
+			o.mu.Unlock()
+		}
+		if !progress {
+			return last
+		}
+	}
+	return ctx.Err()
+}
+
+// failed records a failed attempt at entry. It dead-letters the batch
+// after MaxAttempts attempts or a permanent error, and reports whether it
+// did; otherwise the batch's table backs off.
+func (o *Outbox) failed(entry outboxEntry, err error) bool {
+	dead := permanent(err) || entry.Attempts+1 >= o.MaxAttempts
+	query := `UPDATE cdc_outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2`
+	if dead {
+		query = `UPDATE cdc_outbox SET attempts = attempts + 1, last_error = $1, dead_at = CURRENT_TIMESTAMP WHERE id = $2`
+	}
+	if _, dbErr := o.DB.Exec(query, err.Error(), entry.ID); dbErr != nil {
+		log.Printf("[cdc] Error recording failure of outbox batch %d: %v", entry.ID, dbErr)
+		dead = false // still live; retry it later
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if dead {
+		log.Printf("[cdc] Gave up on outbox batch %d of %s after %d attempts, later batches of the table go on: %v",
+			entry.ID, entry.Table, entry.Attempts+1, err)
+		delete(o.retries, entry.Table)
+		return true
+	}
+	r := o.retries[entry.Table]
+	if r.delay = r.delay * 2; r.delay == 0 {
+		r.delay = time.Second
+	}
+	if r.delay > maxBackoff {
+		r.delay = maxBackoff
+	}
+	r.at = time.Now().Add(r.delay)
+	o.retries[entry.Table] = r
+	log.Printf("[cdc] Delivery of %s failed, retrying in %s: %v", entry.Table, r.delay, err)
+	return false
+}
+
+// backingOff reports whether table's oldest batch failed too recently to retry
+func (o *Outbox) backingOff(table string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r, ok := o.retries[table]
+	return ok && time.Now().Before(r.at)
+}
+
+// nextWait is how long the relay sleeps when nothing wakes it: until the
+// first table's backoff ends, at most relayInterval
+func (o *Outbox) nextWait() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	wait := relayInterval
+	for _, r := range o.retries {
+		wait = min(wait, max(time.Until(r.at), 0))
+	}
+	return wait
+}
+
+// permanent reports whether err fails a batch however often it is retried
+func permanent(err error) bool {
+	var undecodable *decodeError
+	if errors.As(err, &undecodable) {
+		return true
+	}
+	var be *brokerError
+	if errors.As(err, &be) {
+		switch be.code {
+		case errCorruptMessage, errMessageTooLarge, errInvalidTopic:
+			return true
+		}
+	}
+	return false
+}
+
+// decodeError is an outbox batch whose stored messages can't be read
+type decodeError struct {
+	id  int64
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("decode outbox batch %d: %v", e.id, e.err)
+}
+
+func (o *Outbox) publish(ctx context.Context, entry outboxEntry) error {
+	var msgs []json.RawMessage
+	if err := json.Unmarshal([]byte(entry.Messages), &msgs); err != nil {
+		return &decodeError{id: entry.ID, err: err}
+	}
+	values := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		values[i] = m
+	}
+	// keyed by table, so a table's changes share a partition and stay ordered
+	return o.Producer.Produce(ctx, o.topic(entry.Table), []byte(entry.Table), values)
+}
+
+func (o *Outbox) topic(table string) string {
+	return strings.ReplaceAll(o.Topic, "{table}", table)
+}
+
+// Retry puts dead-lettered batches back in the queue with their attempts
+// reset, and returns how many there were
+func (o *Outbox) Retry() (int64, error) {
+	if o == nil {
+		return 0, nil
+	}
+	res, err := o.DB.Exec(`UPDATE cdc_outbox SET dead_at = NULL, attempts = 0 WHERE dead_at IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	o.Notify()
+	return n, nil
+}
+
+// Status reports queued, dead-lettered and delivered batches; nil reports disabled
+func (o *Outbox) Status() (Status, error) {
+	if o == nil {
+		return Status{}, nil
+	}
+	var pending struct {
+		Batches int  `db:"batches"`
+		Rows    *int `db:"row_total"`
+	}
+	if err := o.DB.Get(&pending, `SELECT COUNT(*) AS batches, SUM(row_count) AS row_total FROM cdc_outbox WHERE dead_at IS NULL`); err != nil {
+		return Status{}, err
+	}
+	var dead int
+	if err := o.DB.Get(&dead, `SELECT COUNT(*) FROM cdc_outbox WHERE dead_at IS NOT NULL`); err != nil {
+		return Status{}, err
+	}
+	// a plain column keeps its TIMESTAMP type on SQLite, unlike MIN()
+	var oldest []time.Time
+	if err := o.DB.Select(&oldest, `SELECT created_at FROM cdc_outbox WHERE dead_at IS NULL ORDER BY id LIMIT 1`); err != nil {
+		return Status{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := Status{
+		Enabled:         true,
+		Topic:           o.Topic,
+		Mode:            o.Mode,
+		PendingBatches:  pending.Batches,
+		DeadBatches:     dead,
+		RetryingTables:  []string{},
+		Delivered:       o.delivered,
+		LastDeliveredAt: o.lastDelivered,
+		LastError:       o.lastError,
+	}
+	for table := range o.retries {
+		s.RetryingTables = append(s.RetryingTables, table)
+	}
+	sort.Strings(s.RetryingTables)
+	if pending.Rows != nil {
+		s.PendingRows = *pending.Rows
+	}
+	if len(oldest) > 0 {
+		s.OldestPending = &oldest[0]
+	}
+	return s, nil
+}
+
+// columns lists the keys of a batch's rows
+func columns(rows []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var cols []string
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
@@ -2,29 +2,603 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/goccy/go-yaml"
 	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
 )
 
+// Config is the full application configuration.
+// Values come from (lowest to highest precedence): defaults, config file, env vars.
 type Config struct {
-	Port        string
-	DatabaseURL string
+	Env string `yaml:"-" toml:"-"` // profile selected via APP_ENV
+
+	Server     ServerConfig     `yaml:"server" toml:"server"`
+	Database   DatabaseConfig   `yaml:"database" toml:"database"`
+	Scheduler  SchedulerConfig  `yaml:"scheduler" toml:"scheduler"`
+	ETL        ETLConfig        `yaml:"etl" toml:"etl"`
+	Ingest     IngestConfig     `yaml:"ingest" toml:"ingest"`
+	HTTPClient HTTPClientConfig `yaml:"http_client" toml:"http_client"`
+	Sinks      SinksConfig      `yaml:"sinks" toml:"sinks"`
+	CDC        CDCConfig        `yaml:"cdc" toml:"cdc"`
+	Sheets     SheetsConfig     `yaml:"sheets" toml:"sheets"`
+	Notify     NotifyConfig     `yaml:"notifications" toml:"notifications"`
+	Quotas     QuotasConfig     `yaml:"quotas" toml:"quotas"`
+	Auth       AuthConfig       `yaml:"auth" toml:"auth"`
+	Sharing    SharingConfig    `yaml:"sharing" toml:"sharing"`
+	Log        LogConfig        `yaml:"log" toml:"log"`
+	Metrics    MetricsConfig    `yaml:"metrics" toml:"metrics"`
+}
+
+type ServerConfig struct {
+	Port    string `yaml:"port" toml:"port"`
+	GinMode string `yaml:"gin_mode" toml:"gin_mode"` // debug, release or test
+
+	// gzip responses for clients that accept it
+	Compression         bool `yaml:"compression" toml:"compression"`
+	CompressionMinBytes int  `yaml:"compression_min_bytes" toml:"compression_min_bytes"` // smaller bodies are sent as-is
+
+	GRPCPort string `yaml:"grpc_port" toml:"grpc_port"` // empty disables the gRPC API
+
+	// Reverse proxies (IPs or CIDRs) whose X-Forwarded-For and
+	// X-Forwarded-Proto headers are believed; empty trusts none
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+type DatabaseConfig struct {
+	URL          string `yaml:"url" toml:"url"`
+	Driver       string `yaml:"driver" toml:"driver"`     // postgres client: pq or pgx
+	ReadURL      string `yaml:"read_url" toml:"read_url"` // optional read replica for query endpoints
+	MaxOpenConns int    `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns int    `yaml:"max_idle_conns" toml:"max_idle_conns"`
+
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`   // 0 = no limit
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"` // 0 = no limit
+}
+
+type SchedulerConfig struct {
+	Enabled      bool     `yaml:"enabled" toml:"enabled"`
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval"` // how often table_metadata is re-read
+	Concurrency  int      `yaml:"concurrency" toml:"concurrency"`     // max ETL runs in flight at once
+
+	// refresh_logs housekeeping
+	RefreshLogRetentionDays int  `yaml:"refresh_log_retention_days" toml:"refresh_log_retention_days"` // 0 keeps logs forever
+	RefreshLogRollup        bool `yaml:"refresh_log_rollup" toml:"refresh_log_rollup"`                 // write daily rollup rows before deleting
+
+	// How often tables with a reconcile_window compare source counts with loaded rows; 0 disables
+	ReconcileInterval Duration `yaml:"reconcile_interval" toml:"reconcile_interval"`
+
+	// Upper bound on one replica sync (remote export + local swap); 0 = no limit
+	ReplicaSyncTimeout Duration `yaml:"replica_sync_timeout" toml:"replica_sync_timeout"`
+
+	// With several instances on one Postgres database, only the leader runs
+	// scheduled jobs. It confirms its advisory lock every lease, and a
+	// follower takes over within about a lease of it dying. 0 = every
+	// instance schedules.
+	LeaderLease Duration `yaml:"leader_lease" toml:"leader_lease"`
+}
+
+type ETLConfig struct {
+	InsertBatchSize int `yaml:"insert_batch_size" toml:"insert_batch_size"` // rows per multi-row INSERT (capped by the driver's parameter limit)
+	CopyThreshold   int `yaml:"copy_threshold" toml:"copy_threshold"`       // batches this large use COPY on Postgres; 0 = never
+	StreamChunkSize int `yaml:"stream_chunk_size" toml:"stream_chunk_size"` // source rows decoded and loaded per chunk
+	PipelineDepth   int `yaml:"pipeline_depth" toml:"pipeline_depth"`       // chunks buffered between fetch, validate and insert stages
+
+	// Refreshes inserting 0 rows or more than AnomalyFactor x the recent median are logged as WARN
+	AnomalyFactor     float64 `yaml:"anomaly_factor" toml:"anomaly_factor"`           // 0 disables detection
+	AnomalyMinHistory int     `yaml:"anomaly_min_history" toml:"anomaly_min_history"` // refreshes needed before a baseline is used
+
+	// Reconciliation counts may differ by this percentage of the source count and still match
+	ReconcileTolerancePct float64 `yaml:"reconcile_tolerance_pct" toml:"reconcile_tolerance_pct"`
+}
+
+type IngestConfig struct {
+	MaxBodyBytes int64 `yaml:"max_body_bytes" toml:"max_body_bytes"` // POST /ingest payload limit; 0 = unlimited
+	MaxRows      int   `yaml:"max_rows" toml:"max_rows"`             // records per request; 0 = unlimited
+
+	IdempotencyTTL Duration `yaml:"idempotency_ttl" toml:"idempotency_ttl"` // how long Idempotency-Key responses are replayed; 0 = forever
+
+	// POST /tables/:name/import
+	ImportMaxBytes int64  `yaml:"import_max_bytes" toml:"import_max_bytes"` // uploaded file limit; 0 = unlimited
+	ImportDir      string `yaml:"import_dir" toml:"import_dir"`             // file:// references must be under it; empty = disabled
+
+	// POST /ingest/:table_name/jobs
+	AsyncWorkers  int   `yaml:"async_workers" toml:"async_workers"`     // jobs loaded at once
+	AsyncMaxBytes int64 `yaml:"async_max_bytes" toml:"async_max_bytes"` // payload limit; 0 = unlimited
+
+	// GET /tables/:name/ingest_stats counts are written to the database this often
+	StatsFlushInterval Duration `yaml:"stats_flush_interval" toml:"stats_flush_interval"`
+}
+
+type HTTPClientConfig struct {
+	PreviewTimeout   Duration `yaml:"preview_timeout" toml:"preview_timeout"`
+	FetchTimeout     Duration `yaml:"fetch_timeout" toml:"fetch_timeout"`           // ETL source fetches
+	MaxResponseBytes int64    `yaml:"max_response_bytes" toml:"max_response_bytes"` // ETL source body limit
+
+	// shared transport used by ETL fetches and previews
+	ConnectTimeout        Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+	ResponseHeaderTimeout Duration `yaml:"response_header_timeout" toml:"response_header_timeout"`
+	IdleConnTimeout       Duration `yaml:"idle_conn_timeout" toml:"idle_conn_timeout"`
+	MaxIdleConns          int      `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int      `yaml:"max_idle_conns_per_host" toml:"max_idle_conns_per_host"`
+	Proxy                 string   `yaml:"proxy" toml:"proxy"` // empty = HTTP_PROXY/HTTPS_PROXY env
+}
+
+// SinksConfig holds the object storage credentials used by table export
+// sinks. gs:// sinks use Cloud Storage HMAC keys over its S3-compatible API.
+type SinksConfig struct {
+	S3Region          string `yaml:"s3_region" toml:"s3_region"`
+	S3Endpoint        string `yaml:"s3_endpoint" toml:"s3_endpoint"` // empty = AWS; set for MinIO and other S3-compatible stores
+	S3AccessKeyID     string `yaml:"s3_access_key_id" toml:"s3_access_key_id"`
+	S3SecretAccessKey string `yaml:"s3_secret_access_key" toml:"s3_secret_access_key"`
+	S3SessionToken    string `yaml:"s3_session_token" toml:"s3_session_token"` // temporary credentials only
+
+	GCSAccessKeyID string `yaml:"gcs_access_key_id" toml:"gcs_access_key_id"`
+	GCSSecret      string `yaml:"gcs_secret" toml:"gcs_secret"`
+	GCSEndpoint    string `yaml:"gcs_endpoint" toml:"gcs_endpoint"` // empty = https://storage.googleapis.com
+
+	UploadTimeout Duration `yaml:"upload_timeout" toml:"upload_timeout"` // per exported file; 0 = no limit
+}
+
+// CDCConfig publishes inserted rows to Kafka through the cdc_outbox table.
+// Change capture is off while KafkaBrokers is empty.
+type CDCConfig struct {
+	KafkaBrokers []string `yaml:"kafka_brokers" toml:"kafka_brokers"` // host:port bootstrap list
+	KafkaTLS     bool     `yaml:"kafka_tls" toml:"kafka_tls"`
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	Topic        string   `yaml:"topic" toml:"topic"`   // "{table}" is replaced by the table name
+	Mode         string   `yaml:"mode" toml:"mode"`     // rows (one message per row) or summary (one per batch)
+	Tables       []string `yaml:"tables" toml:"tables"` // empty = every table
+	Timeout      Duration `yaml:"timeout" toml:"timeout"`
+	MaxAttempts  int      `yaml:"max_attempts" toml:"max_attempts"` // failed deliveries before a batch is dead-lettered
+}
+
+// SheetsConfig enables exporting query results to Google Sheets as a
+// service account. Export is off while CredentialsFile is empty.
+type SheetsConfig struct {
+	CredentialsFile string `yaml:"credentials_file" toml:"credentials_file"` // service account JSON key
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`                 // empty = https://sheets.googleapis.com
+	MaxRows         int    `yaml:"max_rows" toml:"max_rows"`                 // per export; 0 = unlimited
+}
+
+// MetricsConfig pushes the /metrics samples to a StatsD or DogStatsD
+// agent as well. Pushing is off while StatsDAddress is empty.
+type MetricsConfig struct {
+	StatsDAddress  string   `yaml:"statsd_address" toml:"statsd_address"`   // host:port, e.g. localhost:8125
+	StatsDFlavor   string   `yaml:"statsd_flavor" toml:"statsd_flavor"`     // dogstatsd (labels as tags) or statsd
+	StatsDPrefix   string   `yaml:"statsd_prefix" toml:"statsd_prefix"`     // prepended to metric names
+	StatsDTags     []string `yaml:"statsd_tags" toml:"statsd_tags"`         // extra tags, e.g. env:prod; dogstatsd only
+	StatsDInterval Duration `yaml:"statsd_interval" toml:"statsd_interval"` // how often metrics are pushed
+}
+
+// NotifyConfig tunes delivery to the per-table notification routes
+// (POST /tables/:name/notifications)
+type NotifyConfig struct {
+	Timeout Duration `yaml:"timeout" toml:"timeout"` // per webhook request
+}
+
+// QuotasConfig holds the limits every workspace, including the default
+// one, gets unless PUT /workspaces/:name/quota overrides them. 0 = unlimited.
+type QuotasConfig struct {
+	MaxTables       int      `yaml:"max_tables" toml:"max_tables"`
+	MaxRowsPerTable int64    `yaml:"max_rows_per_table" toml:"max_rows_per_table"`
+	IngestPerMinute int      `yaml:"ingest_per_minute" toml:"ingest_per_minute"` // ingest requests per workspace
+	MaxStorageBytes int64    `yaml:"max_storage_bytes" toml:"max_storage_bytes"` // tables and indexes; Postgres only
+	UsageInterval   Duration `yaml:"usage_interval" toml:"usage_interval"`       // how often row counts and sizes are re-read
+}
+
+type AuthConfig struct {
+	// APIKeys accepted via "Authorization: Bearer <key>" or X-API-Key. Empty disables auth.
+	APIKeys []string `yaml:"api_keys" toml:"api_keys"`
+}
+
+// SharingConfig signs the links POST /queries/:id/share hands out. Without
+// a secret one is generated at startup, so links die with the process.
+type SharingConfig struct {
+	Secret        string   `yaml:"secret" toml:"secret"`                   // HMAC key; changing it revokes every link
+	TTL           Duration `yaml:"ttl" toml:"ttl"`                         // lifetime of a link unless the request sets one
+	MaxTTL        Duration `yaml:"max_ttl" toml:"max_ttl"`                 // longest lifetime a request may ask for
+	RatePerMinute int      `yaml:"rate_per_minute" toml:"rate_per_minute"` // opens per link per minute on this instance
+	MaxRows       int      `yaml:"max_rows" toml:"max_rows"`               // rows a link returns at most
+}
+
+type LogConfig struct {
+	Level        string `yaml:"level" toml:"level"`                 // debug, info, warn, error
+	Format       string `yaml:"format" toml:"format"`               // application logs: text or json
+	AccessFormat string `yaml:"access_format" toml:"access_format"` // HTTP access logs: text, json or off
+
+	// query_logs audit of GET /query (and gRPC Query), /transform, saved query runs and shared links
+	QueryLog          bool     `yaml:"query_log" toml:"query_log"`
+	QueryLogRetention Duration `yaml:"query_log_retention" toml:"query_log_retention"` // 0 keeps entries forever
 }
 
-// Load reads .env file (if present) and returns config values
+// Duration wraps time.Duration so config files can use strings like "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// defaults returns a Config populated with built-in defaults
+func defaults() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:                "8080",
+			Compression:         true,
+			CompressionMinBytes: 1024,
+		},
+		Database: DatabaseConfig{
+			Driver:          "pq",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration{30 * time.Minute},
+			ConnMaxIdleTime: Duration{5 * time.Minute},
+		},
+		Scheduler: SchedulerConfig{
+			PollInterval:      Duration{30 * time.Second},
+			Concurrency:       4,
+			RefreshLogRollup:  true,
+			ReconcileInterval: Duration{time.Hour},
+
+			ReplicaSyncTimeout: Duration{30 * time.Minute},
+			LeaderLease:        Duration{10 * time.Second},
+		},
+		ETL: ETLConfig{
+			InsertBatchSize: 1000,
+			CopyThreshold:   5000,
+			StreamChunkSize: 5000,
+			PipelineDepth:   2,
+
+			AnomalyFactor:     10,
+			AnomalyMinHistory: 5,
+		},
+		Ingest: IngestConfig{
+			MaxBodyBytes: 10 << 20,
+			MaxRows:      10000,
+
+			IdempotencyTTL: Duration{24 * time.Hour},
+
+			ImportMaxBytes: 1 << 30,
+
+			AsyncWorkers:  2,
+			AsyncMaxBytes: 1 << 30,
+
+			StatsFlushInterval: Duration{time.Minute},
+		},
+		HTTPClient: HTTPClientConfig{
+			PreviewTimeout:   Duration{5 * time.Second},
+			FetchTimeout:     Duration{60 * time.Second},
+			MaxResponseBytes: 50 << 20,
+
+			ConnectTimeout:        Duration{5 * time.Second},
+			ResponseHeaderTimeout: Duration{30 * time.Second},
+			IdleConnTimeout:       Duration{90 * time.Second},
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+		},
+		Sinks: SinksConfig{
+			UploadTimeout: Duration{5 * time.Minute},
+		},
+		CDC: CDCConfig{
+			ClientID: "godataflow",
+			Topic:    "godataflow.changes",
+			Mode:     "rows",
+			Timeout:  Duration{10 * time.Second},
+
+			MaxAttempts: 10,
+		},
+		Sheets: SheetsConfig{
+			MaxRows: 100000,
+		},
+		Notify: NotifyConfig{
+			Timeout: Duration{10 * time.Second},
+		},
+		Metrics: MetricsConfig{
+			StatsDFlavor:   "dogstatsd",
+			StatsDInterval: Duration{10 * time.Second},
+		},
+		Quotas: QuotasConfig{
+			UsageInterval: Duration{time.Minute},
+		},
+		Sharing: SharingConfig{
+			TTL:           Duration{24 * time.Hour},
+			MaxTTL:        Duration{30 * 24 * time.Hour},
+			RatePerMinute: 30,
+			MaxRows:       10000,
+		},
+		Log: LogConfig{
+			Format:       "text",
+			AccessFormat: "text",
+
+			QueryLog:          true,
+			QueryLogRetention: Duration{30 * 24 * time.Hour},
+		},
+	}
+}
+
+// Environment profiles selectable via APP_ENV
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// applyProfile sets the per-profile defaults on top of the built-in ones
+func applyProfile(cfg *Config, env string) error {
+	switch env {
+	case EnvDev:
+		cfg.Server.GinMode = "debug"
+		cfg.Log.Level = "debug"
+		cfg.Scheduler.Enabled = true
+	case EnvStaging:
+		cfg.Server.GinMode = "release"
+		cfg.Log.Level = "info"
+		cfg.Scheduler.Enabled = true
+	case EnvProd:
+		cfg.Server.GinMode = "release"
+		cfg.Log.Level = "info"
+		cfg.Log.Format = "json"
+		cfg.Log.AccessFormat = "json"
+		cfg.Scheduler.Enabled = true
+	default:
+		return fmt.Errorf("unknown APP_ENV %q (expected dev, staging or prod)", env)
+	}
+	cfg.Env = env
+	return nil
+}
+
+// Load reads .env file (if present), the APP_ENV profile, the optional
+// CONFIG_FILE (YAML or TOML) and env overrides, and returns the merged config
 func Load() (*Config, error) {
 	_ = godotenv.Load() // ignore error if no .env found
 
-	port := os.Getenv("PORT")
-	dbURL := os.Getenv("DATABASE_URL")
+	cfg := defaults()
+
+	env := strings.ToLower(os.Getenv("APP_ENV"))
+	if env == "" {
+		env = EnvDev
+	}
+	if err := applyProfile(cfg, env); err != nil {
+		return nil, err
+	}
 
-	if port == "" || dbURL == "" {
-		return nil, errors.New("PORT or DATABASE_URL missing")
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	return &Config{
-		Port:        port,
-		DatabaseURL: dbURL,
-	}, nil
+	problems := applyEnv(cfg)
+	problems = append(problems, cfg.Validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// loadFile decodes a YAML (.yaml/.yml) or TOML (.toml) file into cfg
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file type %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with any env vars that are set.
+// Malformed values are collected rather than stopping at the first one.
+func applyEnv(cfg *Config) []string {
+	problems := []string{}
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	setString(&cfg.Server.Port, "PORT")
+	setString(&cfg.Server.GinMode, "GIN_MODE")
+	setString(&cfg.Server.GRPCPort, "GRPC_PORT")
+	setList(&cfg.Server.TrustedProxies, "TRUSTED_PROXIES")
+	setString(&cfg.Database.URL, "DATABASE_URL")
+	setString(&cfg.Database.ReadURL, "READ_DATABASE_URL")
+	setString(&cfg.Database.Driver, "DB_DRIVER")
+	setString(&cfg.Log.Level, "LOG_LEVEL")
+	setString(&cfg.Log.Format, "LOG_FORMAT")
+	setString(&cfg.Log.AccessFormat, "ACCESS_LOG_FORMAT")
+
+	check(setBool(&cfg.Log.QueryLog, "QUERY_LOG"))
+	check(setDuration(&cfg.Log.QueryLogRetention, "QUERY_LOG_RETENTION"))
+	check(setBool(&cfg.Server.Compression, "COMPRESSION_ENABLED"))
+	check(setInt(&cfg.Server.CompressionMinBytes, "COMPRESSION_MIN_BYTES"))
+	check(setInt(&cfg.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS"))
+	check(setInt(&cfg.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS"))
+	check(setDuration(&cfg.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME"))
+	check(setDuration(&cfg.Database.ConnMaxIdleTime, "DB_CONN_MAX_IDLE_TIME"))
+	check(setBool(&cfg.Scheduler.Enabled, "SCHEDULER_ENABLED"))
+	check(setDuration(&cfg.Scheduler.PollInterval, "SCHEDULER_POLL_INTERVAL"))
+	check(setInt(&cfg.Scheduler.Concurrency, "ETL_CONCURRENCY"))
+	check(setInt(&cfg.Scheduler.RefreshLogRetentionDays, "REFRESH_LOG_RETENTION_DAYS"))
+	check(setBool(&cfg.Scheduler.RefreshLogRollup, "REFRESH_LOG_ROLLUP"))
+	check(setDuration(&cfg.Scheduler.ReconcileInterval, "RECONCILE_INTERVAL"))
+	check(setDuration(&cfg.Scheduler.ReplicaSyncTimeout, "REPLICA_SYNC_TIMEOUT"))
+	check(setDuration(&cfg.Scheduler.LeaderLease, "SCHEDULER_LEADER_LEASE"))
+	check(setInt(&cfg.ETL.InsertBatchSize, "ETL_INSERT_BATCH_SIZE"))
+	check(setInt(&cfg.ETL.CopyThreshold, "ETL_COPY_THRESHOLD"))
+	check(setInt(&cfg.ETL.StreamChunkSize, "ETL_STREAM_CHUNK_SIZE"))
+	check(setInt(&cfg.ETL.PipelineDepth, "ETL_PIPELINE_DEPTH"))
+	check(setFloat(&cfg.ETL.AnomalyFactor, "ETL_ANOMALY_FACTOR"))
+	check(setInt(&cfg.ETL.AnomalyMinHistory, "ETL_ANOMALY_MIN_HISTORY"))
+	check(setFloat(&cfg.ETL.ReconcileTolerancePct, "ETL_RECONCILE_TOLERANCE_PCT"))
+	check(setInt64(&cfg.Ingest.MaxBodyBytes, "INGEST_MAX_BODY_BYTES"))
+	check(setInt(&cfg.Ingest.MaxRows, "INGEST_MAX_ROWS"))
+	check(setDuration(&cfg.Ingest.IdempotencyTTL, "INGEST_IDEMPOTENCY_TTL"))
+	check(setInt64(&cfg.Ingest.ImportMaxBytes, "IMPORT_MAX_BYTES"))
+	setString(&cfg.Ingest.ImportDir, "IMPORT_DIR")
+	check(setInt(&cfg.Ingest.AsyncWorkers, "INGEST_ASYNC_WORKERS"))
+	check(setInt64(&cfg.Ingest.AsyncMaxBytes, "INGEST_ASYNC_MAX_BYTES"))
+	check(setDuration(&cfg.Ingest.StatsFlushInterval, "INGEST_STATS_FLUSH_INTERVAL"))
+	check(setDuration(&cfg.HTTPClient.PreviewTimeout, "HTTP_PREVIEW_TIMEOUT"))
+	check(setDuration(&cfg.HTTPClient.FetchTimeout, "HTTP_FETCH_TIMEOUT"))
+	check(setInt64(&cfg.HTTPClient.MaxResponseBytes, "HTTP_MAX_RESPONSE_BYTES"))
+	check(setDuration(&cfg.HTTPClient.ConnectTimeout, "HTTP_CONNECT_TIMEOUT"))
+	check(setDuration(&cfg.HTTPClient.ResponseHeaderTimeout, "HTTP_RESPONSE_HEADER_TIMEOUT"))
+	check(setDuration(&cfg.HTTPClient.IdleConnTimeout, "HTTP_IDLE_CONN_TIMEOUT"))
+	check(setInt(&cfg.HTTPClient.MaxIdleConns, "HTTP_MAX_IDLE_CONNS"))
+	check(setInt(&cfg.HTTPClient.MaxIdleConnsPerHost, "HTTP_MAX_IDLE_CONNS_PER_HOST"))
+	setString(&cfg.HTTPClient.Proxy, "HTTP_CLIENT_PROXY")
+	setString(&cfg.Sinks.S3Region, "AWS_REGION")
+	setString(&cfg.Sinks.S3Endpoint, "S3_ENDPOINT")
+	setString(&cfg.Sinks.S3AccessKeyID, "AWS_ACCESS_KEY_ID")
+	setString(&cfg.Sinks.S3SecretAccessKey, "AWS_SECRET_ACCESS_KEY")
+	setString(&cfg.Sinks.S3SessionToken, "AWS_SESSION_TOKEN")
+	setString(&cfg.Sinks.GCSAccessKeyID, "GCS_HMAC_ACCESS_ID")
+	setString(&cfg.Sinks.GCSSecret, "GCS_HMAC_SECRET")
+	setString(&cfg.Sinks.GCSEndpoint, "GCS_ENDPOINT")
+	check(setDuration(&cfg.Sinks.UploadTimeout, "SINK_UPLOAD_TIMEOUT"))
+	setList(&cfg.CDC.KafkaBrokers, "CDC_KAFKA_BROKERS")
+	check(setBool(&cfg.CDC.KafkaTLS, "CDC_KAFKA_TLS"))
+	setString(&cfg.CDC.ClientID, "CDC_CLIENT_ID")
+	setString(&cfg.CDC.Topic, "CDC_TOPIC")
+	setString(&cfg.CDC.Mode, "CDC_MODE")
+	setList(&cfg.CDC.Tables, "CDC_TABLES")
+	check(setDuration(&cfg.CDC.Timeout, "CDC_TIMEOUT"))
+	check(setInt(&cfg.CDC.MaxAttempts, "CDC_MAX_ATTEMPTS"))
+	setString(&cfg.Sheets.CredentialsFile, "GOOGLE_APPLICATION_CREDENTIALS")
+	setString(&cfg.Sheets.Endpoint, "SHEETS_ENDPOINT")
+	check(setInt(&cfg.Sheets.MaxRows, "SHEETS_MAX_ROWS"))
+	check(setDuration(&cfg.Notify.Timeout, "NOTIFY_TIMEOUT"))
+	check(setInt(&cfg.Quotas.MaxTables, "QUOTA_MAX_TABLES"))
+	check(setInt64(&cfg.Quotas.MaxRowsPerTable, "QUOTA_MAX_ROWS_PER_TABLE"))
+	check(setInt(&cfg.Quotas.IngestPerMinute, "QUOTA_INGEST_PER_MINUTE"))
+	check(setInt64(&cfg.Quotas.MaxStorageBytes, "QUOTA_MAX_STORAGE_BYTES"))
+	check(setDuration(&cfg.Quotas.UsageInterval, "QUOTA_USAGE_INTERVAL"))
+	setList(&cfg.Auth.APIKeys, "API_KEYS")
+	setString(&cfg.Sharing.Secret, "SHARE_SECRET")
+	check(setDuration(&cfg.Sharing.TTL, "SHARE_TTL"))
+	check(setDuration(&cfg.Sharing.MaxTTL, "SHARE_MAX_TTL"))
+	check(setInt(&cfg.Sharing.RatePerMinute, "SHARE_RATE_PER_MINUTE"))
+	check(setInt(&cfg.Sharing.MaxRows, "SHARE_MAX_ROWS"))
+	setString(&cfg.Metrics.StatsDAddress, "STATSD_ADDRESS")
+	setString(&cfg.Metrics.StatsDFlavor, "STATSD_FLAVOR")
+	setString(&cfg.Metrics.StatsDPrefix, "STATSD_PREFIX")
+	setList(&cfg.Metrics.StatsDTags, "STATSD_TAGS")
+	check(setDuration(&cfg.Metrics.StatsDInterval, "STATSD_INTERVAL"))
+
+	return problems
+}
+
+func setString(dst *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*dst = v
+	}
+}
+
+func setInt(dst *int, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return errors.New(key + " must be an integer")
+	}
+	*dst = i
+	return nil
+}
+
+func setInt64(dst *int64, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return errors.New(key + " must be an integer")
+	}
+	*dst = i
+	return nil
+}
+
+func setFloat(dst *float64, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return errors.New(key + " must be a number")
+	}
+	*dst = f
+	return nil
+}
+
+func setBool(dst *bool, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return errors.New(key + " must be true or false")
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *Duration, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return errors.New(key + " must be a duration like 30s or 5m")
+	}
+	dst.Duration = d
+	return nil
+}
+
+// setList reads a comma-separated env var
+func setList(dst *[]string, key string) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+	out := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	*dst = out
 }
@@ -0,0 +1,329 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ValidationError lists every problem found in the loaded configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration (%d problems):", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// Validate checks every config value and returns a human-readable problem
+// per bad field. Each message names the file key and the env var that sets it.
+func (c *Config) Validate() []string {
+	problems := []string{}
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// server
+	if c.Server.Port == "" {
+		add("server.port (PORT) is required")
+	} else if p, err := strconv.Atoi(c.Server.Port); err != nil || p < 1 || p > 65535 {
+		add("server.port (PORT) must be a number between 1 and 65535, got %q", c.Server.Port)
+	}
+	switch c.Server.GinMode {
+	case "debug", "release", "test":
+	default:
+		add("server.gin_mode (GIN_MODE) must be one of debug, release, test, got %q", c.Server.GinMode)
+	}
+
+	if c.Server.GRPCPort != "" {
+		if p, err := strconv.Atoi(c.Server.GRPCPort); err != nil || p < 1 || p > 65535 {
+			add("server.grpc_port (GRPC_PORT) must be a number between 1 and 65535, got %q", c.Server.GRPCPort)
+		} else if c.Server.GRPCPort == c.Server.Port {
+			add("server.grpc_port (GRPC_PORT) must differ from server.port (PORT), both are %q", c.Server.Port)
+		}
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				add("server.trusted_proxies (TRUSTED_PROXIES) must list IPs or CIDRs, got %q", proxy)
+			}
+		}
+	}
+
+	if c.Server.CompressionMinBytes < 0 {
+		add("server.compression_min_bytes (COMPRESSION_MIN_BYTES) cannot be negative, got %d", c.Server.CompressionMinBytes)
+	}
+
+	// database
+	if c.Database.URL == "" {
+		add("database.url (DATABASE_URL) is not set (sqlite://godataflow.db works for local development)")
+	} else if u, err := url.Parse(c.Database.URL); err != nil {
+		add("database.url (DATABASE_URL) is not a valid URL: %v", err)
+	} else if u.Scheme != "postgres" && u.Scheme != "postgresql" && u.Scheme != "sqlite" {
+		add("database.url (DATABASE_URL) must use the postgres:// or sqlite:// scheme, got %q", u.Scheme)
+	}
+	if c.Database.ReadURL != "" {
+		if u, err := url.Parse(c.Database.ReadURL); err != nil {
+			add("database.read_url (READ_DATABASE_URL) is not a valid URL: %v", err)
+		} else if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			add("database.read_url (READ_DATABASE_URL) must use the postgres:// scheme, got %q", u.Scheme)
+		} else if strings.HasPrefix(c.Database.URL, "sqlite:") {
+			add("database.read_url (READ_DATABASE_URL) requires a postgres database.url")
+		}
+	}
+	switch c.Database.Driver {
+	case "pq", "pgx":
+	default:
+		add("database.driver (DB_DRIVER) must be pq or pgx, got %q", c.Database.Driver)
+	}
+	if c.Database.MaxOpenConns < 1 {
+		add("database.max_open_conns (DB_MAX_OPEN_CONNS) must be at least 1, got %d", c.Database.MaxOpenConns)
+	}
+	if c.Database.MaxIdleConns < 0 {
+		add("database.max_idle_conns (DB_MAX_IDLE_CONNS) cannot be negative, got %d", c.Database.MaxIdleConns)
+	} else if c.Database.MaxOpenConns >= 1 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		add("database.max_idle_conns (%d) cannot exceed database.max_open_conns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	}
+
+	if c.Database.ConnMaxLifetime.Duration < 0 {
+		add("database.conn_max_lifetime (DB_CONN_MAX_LIFETIME) cannot be negative, got %s", c.Database.ConnMaxLifetime)
+	}
+	if c.Database.ConnMaxIdleTime.Duration < 0 {
+		add("database.conn_max_idle_time (DB_CONN_MAX_IDLE_TIME) cannot be negative, got %s", c.Database.ConnMaxIdleTime)
+	}
+
+	// scheduler
+	if c.Scheduler.PollInterval.Duration <= 0 {
+		add("scheduler.poll_interval (SCHEDULER_POLL_INTERVAL) must be a positive duration, got %s", c.Scheduler.PollInterval)
+	}
+	if c.Scheduler.Concurrency < 1 {
+		add("scheduler.concurrency (ETL_CONCURRENCY) must be at least 1, got %d", c.Scheduler.Concurrency)
+	}
+	if c.Scheduler.RefreshLogRetentionDays < 0 {
+		add("scheduler.refresh_log_retention_days (REFRESH_LOG_RETENTION_DAYS) cannot be negative, got %d", c.Scheduler.RefreshLogRetentionDays)
+	}
+	if c.Scheduler.ReconcileInterval.Duration < 0 {
+		add("scheduler.reconcile_interval (RECONCILE_INTERVAL) cannot be negative (0 = off), got %s", c.Scheduler.ReconcileInterval)
+	}
+	if c.Scheduler.ReplicaSyncTimeout.Duration < 0 {
+		add("scheduler.replica_sync_timeout (REPLICA_SYNC_TIMEOUT) cannot be negative (0 = no limit), got %s", c.Scheduler.ReplicaSyncTimeout)
+	}
+	if c.Scheduler.LeaderLease.Duration < 0 {
+		add("scheduler.leader_lease (SCHEDULER_LEADER_LEASE) cannot be negative (0 = no leader election), got %s", c.Scheduler.LeaderLease)
+	}
+
+	// etl
+	if c.ETL.InsertBatchSize < 1 {
+		add("etl.insert_batch_size (ETL_INSERT_BATCH_SIZE) must be at least 1, got %d", c.ETL.InsertBatchSize)
+	}
+	if c.ETL.StreamChunkSize < 1 {
+		add("etl.stream_chunk_size (ETL_STREAM_CHUNK_SIZE) must be at least 1, got %d", c.ETL.StreamChunkSize)
+	}
+	if c.ETL.PipelineDepth < 1 {
+		add("etl.pipeline_depth (ETL_PIPELINE_DEPTH) must be at least 1, got %d", c.ETL.PipelineDepth)
+	}
+	if c.ETL.CopyThreshold < 0 {
+		add("etl.copy_threshold (ETL_COPY_THRESHOLD) cannot be negative (0 = never use COPY), got %d", c.ETL.CopyThreshold)
+	}
+	if c.ETL.AnomalyFactor != 0 && c.ETL.AnomalyFactor <= 1 {
+		add("etl.anomaly_factor (ETL_ANOMALY_FACTOR) must be greater than 1 (0 = off), got %g", c.ETL.AnomalyFactor)
+	}
+	if c.ETL.AnomalyMinHistory < 1 {
+		add("etl.anomaly_min_history (ETL_ANOMALY_MIN_HISTORY) must be at least 1, got %d", c.ETL.AnomalyMinHistory)
+	}
+	if c.ETL.ReconcileTolerancePct < 0 {
+		add("etl.reconcile_tolerance_pct (ETL_RECONCILE_TOLERANCE_PCT) cannot be negative, got %g", c.ETL.ReconcileTolerancePct)
+	}
+
+	// ingest
+	if c.Ingest.MaxBodyBytes < 0 {
+		add("ingest.max_body_bytes (INGEST_MAX_BODY_BYTES) cannot be negative (0 = unlimited), got %d", c.Ingest.MaxBodyBytes)
+	}
+	if c.Ingest.MaxRows < 0 {
+		add("ingest.max_rows (INGEST_MAX_ROWS) cannot be negative (0 = unlimited), got %d", c.Ingest.MaxRows)
+	}
+	if c.Ingest.IdempotencyTTL.Duration < 0 {
+		add("ingest.idempotency_ttl (INGEST_IDEMPOTENCY_TTL) cannot be negative (0 = keep keys forever), got %s", c.Ingest.IdempotencyTTL)
+	}
+	if c.Ingest.ImportMaxBytes < 0 {
+		add("ingest.import_max_bytes (IMPORT_MAX_BYTES) cannot be negative (0 = unlimited), got %d", c.Ingest.ImportMaxBytes)
+	}
+	if c.Ingest.AsyncWorkers < 1 {
+		add("ingest.async_workers (INGEST_ASYNC_WORKERS) must be at least 1, got %d", c.Ingest.AsyncWorkers)
+	}
+	if c.Ingest.AsyncMaxBytes < 0 {
+		add("ingest.async_max_bytes (INGEST_ASYNC_MAX_BYTES) cannot be negative (0 = unlimited), got %d", c.Ingest.AsyncMaxBytes)
+	}
+	if c.Ingest.StatsFlushInterval.Duration <= 0 {
+		add("ingest.stats_flush_interval (INGEST_STATS_FLUSH_INTERVAL) must be positive, got %s", c.Ingest.StatsFlushInterval)
+	}
+
+	// http client
+	if c.HTTPClient.PreviewTimeout.Duration <= 0 {
+		add("http_client.preview_timeout (HTTP_PREVIEW_TIMEOUT) must be a positive duration, got %s", c.HTTPClient.PreviewTimeout)
+	}
+	if c.HTTPClient.FetchTimeout.Duration <= 0 {
+		add("http_client.fetch_timeout (HTTP_FETCH_TIMEOUT) must be a positive duration, got %s", c.HTTPClient.FetchTimeout)
+	}
+	if c.HTTPClient.MaxResponseBytes < 0 {
+		add("http_client.max_response_bytes (HTTP_MAX_RESPONSE_BYTES) cannot be negative (0 = unlimited), got %d", c.HTTPClient.MaxResponseBytes)
+	}
+	if c.HTTPClient.ConnectTimeout.Duration <= 0 {
+		add("http_client.connect_timeout (HTTP_CONNECT_TIMEOUT) must be a positive duration, got %s", c.HTTPClient.ConnectTimeout)
+	}
+	if c.HTTPClient.ResponseHeaderTimeout.Duration < 0 {
+		add("http_client.response_header_timeout (HTTP_RESPONSE_HEADER_TIMEOUT) cannot be negative (0 = no limit), got %s", c.HTTPClient.ResponseHeaderTimeout)
+	}
+	if c.HTTPClient.IdleConnTimeout.Duration < 0 {
+		add("http_client.idle_conn_timeout (HTTP_IDLE_CONN_TIMEOUT) cannot be negative (0 = no limit), got %s", c.HTTPClient.IdleConnTimeout)
+	}
+	if c.HTTPClient.MaxIdleConns < 0 {
+		add("http_client.max_idle_conns (HTTP_MAX_IDLE_CONNS) cannot be negative, got %d", c.HTTPClient.MaxIdleConns)
+	}
+	if c.HTTPClient.MaxIdleConnsPerHost < 0 {
+		add("http_client.max_idle_conns_per_host (HTTP_MAX_IDLE_CONNS_PER_HOST) cannot be negative, got %d", c.HTTPClient.MaxIdleConnsPerHost)
+	}
+	if c.HTTPClient.Proxy != "" {
+		if u, err := url.Parse(c.HTTPClient.Proxy); err != nil || u.Host == "" {
+			add("http_client.proxy (HTTP_CLIENT_PROXY) must be a URL like http://proxy:3128, got %q", c.HTTPClient.Proxy)
+		}
+	}
+
+	// sinks
+	for _, e := range []struct{ key, url string }{
+		{"sinks.s3_endpoint (S3_ENDPOINT)", c.Sinks.S3Endpoint},
+		{"sinks.gcs_endpoint (GCS_ENDPOINT)", c.Sinks.GCSEndpoint},
+	} {
+		if e.url == "" {
+			continue
+		}
+		if u, err := url.Parse(e.url); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			add("%s must be an http(s) URL like http://minio:9000, got %q", e.key, e.url)
+		}
+	}
+	if (c.Sinks.S3AccessKeyID == "") != (c.Sinks.S3SecretAccessKey == "") {
+		add("sinks.s3_access_key_id (AWS_ACCESS_KEY_ID) and sinks.s3_secret_access_key (AWS_SECRET_ACCESS_KEY) must be set together")
+	}
+	if (c.Sinks.GCSAccessKeyID == "") != (c.Sinks.GCSSecret == "") {
+		add("sinks.gcs_access_key_id (GCS_HMAC_ACCESS_ID) and sinks.gcs_secret (GCS_HMAC_SECRET) must be set together")
+	}
+	if c.Sinks.UploadTimeout.Duration < 0 {
+		add("sinks.upload_timeout (SINK_UPLOAD_TIMEOUT) cannot be negative (0 = no limit), got %s", c.Sinks.UploadTimeout)
+	}
+
+	// cdc
+	for i, b := range c.CDC.KafkaBrokers {
+		if _, port, err := net.SplitHostPort(b); err != nil || port == "" {
+			add("cdc.kafka_brokers[%d] (CDC_KAFKA_BROKERS) must be host:port, got %q", i, b)
+		}
+	}
+	if c.CDC.Mode != "rows" && c.CDC.Mode != "summary" {
+		add("cdc.mode (CDC_MODE) must be rows or summary, got %q", c.CDC.Mode)
+	}
+	if len(c.CDC.KafkaBrokers) > 0 && strings.TrimSpace(c.CDC.Topic) == "" {
+		add("cdc.topic (CDC_TOPIC) is required when cdc.kafka_brokers is set")
+	}
+	if c.CDC.Timeout.Duration <= 0 {
+		add("cdc.timeout (CDC_TIMEOUT) must be positive, got %s", c.CDC.Timeout)
+	}
+	if c.CDC.MaxAttempts < 1 {
+		add("cdc.max_attempts (CDC_MAX_ATTEMPTS) must be at least 1, got %d", c.CDC.MaxAttempts)
+	}
+
+	// sheets
+	if c.Sheets.Endpoint != "" {
+		if u, err := url.Parse(c.Sheets.Endpoint); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			add("sheets.endpoint (SHEETS_ENDPOINT) must be an http(s) URL, got %q", c.Sheets.Endpoint)
+		}
+	}
+	if c.Sheets.MaxRows < 0 {
+		add("sheets.max_rows (SHEETS_MAX_ROWS) cannot be negative (0 = unlimited), got %d", c.Sheets.MaxRows)
+	}
+
+	// notifications
+	if c.Notify.Timeout.Duration <= 0 {
+		add("notifications.timeout (NOTIFY_TIMEOUT) must be positive, got %s", c.Notify.Timeout)
+	}
+
+	// quotas
+	if c.Quotas.MaxTables < 0 {
+		add("quotas.max_tables (QUOTA_MAX_TABLES) cannot be negative (0 = unlimited), got %d", c.Quotas.MaxTables)
+	}
+	if c.Quotas.MaxRowsPerTable < 0 {
+		add("quotas.max_rows_per_table (QUOTA_MAX_ROWS_PER_TABLE) cannot be negative (0 = unlimited), got %d", c.Quotas.MaxRowsPerTable)
+	}
+	if c.Quotas.IngestPerMinute < 0 {
+		add("quotas.ingest_per_minute (QUOTA_INGEST_PER_MINUTE) cannot be negative (0 = unlimited), got %d", c.Quotas.IngestPerMinute)
+	}
+	if c.Quotas.MaxStorageBytes < 0 {
+		add("quotas.max_storage_bytes (QUOTA_MAX_STORAGE_BYTES) cannot be negative (0 = unlimited), got %d", c.Quotas.MaxStorageBytes)
+	}
+	if c.Quotas.UsageInterval.Duration <= 0 {
+		add("quotas.usage_interval (QUOTA_USAGE_INTERVAL) must be positive, got %s", c.Quotas.UsageInterval)
+	}
+
+	// auth
+	for i, k := range c.Auth.APIKeys {
+		if strings.TrimSpace(k) == "" {
+			add("auth.api_keys[%d] is empty", i)
+		}
+	}
+
+	// log
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("log.level (LOG_LEVEL) must be one of debug, info, warn, error, got %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		add("log.format (LOG_FORMAT) must be text or json, got %q", c.Log.Format)
+	}
+	switch c.Log.AccessFormat {
+	case "text", "json", "off":
+	default:
+		add("log.access_format (ACCESS_LOG_FORMAT) must be text, json or off, got %q", c.Log.AccessFormat)
+	}
+	if c.Log.QueryLogRetention.Duration < 0 {
+		add("log.query_log_retention (QUERY_LOG_RETENTION) cannot be negative (0 = keep entries forever), got %s", c.Log.QueryLogRetention)
+	}
+
+	// sharing
+	if c.Sharing.TTL.Duration <= 0 {
+		add("sharing.ttl (SHARE_TTL) must be positive, got %s", c.Sharing.TTL)
+	}
+	if c.Sharing.MaxTTL.Duration < c.Sharing.TTL.Duration {
+		add("sharing.max_ttl (SHARE_MAX_TTL) must be at least sharing.ttl, got %s", c.Sharing.MaxTTL)
+	}
+	if c.Sharing.RatePerMinute < 1 {
+		add("sharing.rate_per_minute (SHARE_RATE_PER_MINUTE) must be at least 1, got %d", c.Sharing.RatePerMinute)
+	}
+	if c.Sharing.MaxRows < 1 {
+		add("sharing.max_rows (SHARE_MAX_ROWS) must be at least 1, got %d", c.Sharing.MaxRows)
+	}
+
+	// metrics
+	if c.Metrics.StatsDAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.StatsDAddress); err != nil {
+			add("metrics.statsd_address (STATSD_ADDRESS) must be host:port, got %q", c.Metrics.StatsDAddress)
+		}
+	}
+	if c.Metrics.StatsDFlavor != "statsd" && c.Metrics.StatsDFlavor != "dogstatsd" {
+		add("metrics.statsd_flavor (STATSD_FLAVOR) must be statsd or dogstatsd, got %q", c.Metrics.StatsDFlavor)
+	}
+	if c.Metrics.StatsDInterval.Duration <= 0 {
+		add("metrics.statsd_interval (STATSD_INTERVAL) must be positive, got %s", c.Metrics.StatsDInterval)
+	}
+
+	return problems
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrCopyUnsupported is returned by CopyFrom on backends without COPY (SQLite)
+var ErrCopyUnsupported = errors.New("bulk copy requires postgres")
+
+// SupportsCopy reports whether CopyFrom can be used on this connection
+func SupportsCopy(db *sqlx.DB) bool {
+	return DialectOf(db) == Postgres
+}
+
+// CopyFrom bulk-loads rows with COPY ... FROM STDIN, using pgx's binary
+// CopyFrom or lib/pq's CopyIn depending on the driver. Values in each row
+// line up with columns. The load is atomic: either every row lands or none do.
+// then, when not nil, runs in the load's transaction after the rows are
+// copied, so what it writes commits or rolls back with them.
+func CopyFrom(ctx context.Context, db *sqlx.DB, table TableName, columns []string, rows [][]interface{}, then func(tx sqlx.Execer) error) (int64, error) {
+	if !SupportsCopy(db) {
+		return 0, ErrCopyUnsupported
+	}
+
+	var (
+		copied int64
+		err    error
+	)
+	if db.DriverName() == "pgx" {
+		copied, err = copyPGX(ctx, db, table, columns, rows, then)
+	} else {
+		copied, err = copyPQ(ctx, db, table, columns, rows, then)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("copy into %s failed: %w", table, err)
+	}
+	return copied, nil
+}
+
+// copyPGX copies on the connection of an open transaction, so then can
+// write through the transaction afterwards
+func copyPGX(ctx context.Context, db *sqlx.DB, table TableName, columns []string, rows [][]interface{}, then func(tx sqlx.Execer) error) (int64, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("acquire conn failed: %w", err)
+	}
+	defer conn.Close()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer func() {
+		// if still active, rollback
+		_ = tx.Rollback()
+	}()
+
+	var copied int64
+	err = conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		ident := pgx.Identifier{table.Name}
+		if table.Schema != "" {
+			ident = pgx.Identifier{table.Schema, table.Name}
+		}
+		n, err := pgConn.CopyFrom(ctx, ident, columns, pgx.CopyFromRows(rows))
+		copied = n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if then != nil {
+		if err := then(tx); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("tx commit failed: %w", err)
+	}
+	return copied, nil
+}
+
+// copyPQ streams rows through a lib/pq CopyIn statement; COPY must run in a transaction
+func copyPQ(ctx context.Context, db *sqlx.DB, table TableName, columns []string, rows [][]interface{}, then func(tx sqlx.Execer) error) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer func() {
+		// if still active, rollback
+		_ = tx.Rollback()
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(table.SchemaOrDefault(), table.Name, columns...))
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			stmt.Close()
+			return 0, err
+		}
+	}
+	// the final empty Exec flushes buffered rows and reports errors
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+	if then != nil {
+		if err := then(tx); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("tx commit failed: %w", err)
+	}
+	return int64(len(rows)), nil
+}
@@ -1,55 +1,211 @@
 package db
 
 import (
+	"database/sql/driver"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-	"runtime"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-// Connect initializes a PostgreSQL connection
-func Connect(dbURL string) (*sqlx.DB, error) {
-	db, err := sqlx.Connect("postgres", dbURL)
+// Dialect identifies which SQL backend a connection talks to
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// DialectOf reports the backend of an open connection
+func DialectOf(db *sqlx.DB) Dialect {
+	if db.DriverName() == sqliteDriver {
+		return SQLite
+	}
+	return Postgres
+}
+
+// MaxBindParams is the most bind parameters one statement may carry
+func MaxBindParams(db *sqlx.DB) int {
+	if DialectOf(db) == SQLite {
+		return 32766 // SQLITE_MAX_VARIABLE_NUMBER since 3.32
+	}
+	return 65535 // Postgres wire protocol uses an int16 parameter count
+}
+
+// PoolConfig holds sql.DB connection pool settings
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration // 0 = connections are reused forever
+	ConnMaxIdleTime time.Duration // 0 = idle connections are kept forever
+}
+
+// apply sets the pool limits on an open handle
+func (p PoolConfig) apply(db *sqlx.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// Connect initializes a database connection.
+// postgres:// URLs use PostgreSQL through driver (DriverPQ or DriverPGX);
+// sqlite://path (or sqlite:path) opens a local SQLite file.
+func Connect(dbURL, driver string, pool PoolConfig) (*sqlx.DB, error) {
+	if path, ok := sqlitePath(dbURL); ok {
+		return connectSQLite(path)
+	}
+
+	driverName, err := sqlDriverName(driver)
+	if err != nil {
+		return nil, fmt.Errorf("db connect failed: %w", err)
+	}
+
+	db, err := sqlx.Connect(driverName, dbURL)
 	if err != nil {
 		return nil, fmt.Errorf("db connect failed: %w", err)
 	}
 
 	// connection pool settings
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(2)
+	pool.apply(db)
+
+	return db, nil
+}
+
+// sqlitePath extracts the file path from a sqlite URL
+func sqlitePath(dbURL string) (string, bool) {
+	for _, prefix := range []string{"sqlite://", "sqlite:"} {
+		if strings.HasPrefix(dbURL, prefix) {
+			return strings.TrimPrefix(dbURL, prefix), true
+		}
+	}
+	return "", false
+}
+
+func connectSQLite(path string) (*sqlx.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("db connect failed: empty sqlite path")
+	}
+	dsn := path
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_foreign_keys=on&_busy_timeout=5000"
+	}
+
+	db, err := sqlx.Connect(sqliteDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("db connect failed: %w", err)
+	}
+
+	// SQLite allows a single writer; one connection avoids "database is locked"
+	db.SetMaxOpenConns(1)
 
 	return db, nil
 }
 
-// RunMigrations reads all SQL files in migrations folder and executes them
-func RunMigrations(db *sqlx.DB) error {
-	_, b, _, _ := runtime.Caller(0)
-	basepath := filepath.Dir(b)
-	migrationsPath := filepath.Join(basepath, "migrations")
-	// migrationsPath := ".internal/db/migrations" made this dynamic in above 3 lines
-	files, err := os.ReadDir(migrationsPath)
+// Column describes a table column as reported by the database catalog
+type Column struct {
+	ColumnName string `db:"column_name" json:"column_name"`
+	DataType   string `db:"data_type" json:"data_type"`
+}
+
+// IsArrayType reports whether a column type, as listed by TableColumns or
+// written in CREATE TABLE, is a Postgres array ("text[]", "integer[]")
+func IsArrayType(dataType string) bool {
+	return strings.HasSuffix(strings.TrimSpace(dataType), "[]")
+}
+
+// ArrayElementType is the element type of an array column type
+func ArrayElementType(dataType string) string {
+	return strings.TrimSuffix(strings.TrimSpace(dataType), "[]")
+}
+
+// Array is the value of an array column. It binds as a Postgres array
+// (through pq.GenericArray) and encodes to JSON as a plain list, so rows
+// holding one can still be published as change events.
+type Array []interface{}
+
+// Value implements driver.Valuer
+func (a Array) Value() (driver.Value, error) {
+	return pq.GenericArray{A: []interface{}(a)}.Value()
+}
+
+// TableColumns lists a table's columns in declaration order.
+// tableName may be schema-qualified ("analytics.sales") on Postgres.
+// User-defined types (PostGIS geometry, enums) are listed by type name,
+// arrays by element type ("integer[]").
+func TableColumns(db *sqlx.DB, tableName string) ([]Column, error) {
+	t, err := ParseTableName(tableName)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations folder: %w", err)
+		return nil, err
+	}
+	if err := CheckSchemaSupport(db, t); err != nil {
+		return nil, err
 	}
 
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".sql" {
-			path := filepath.Join(migrationsPath, file.Name())
-			sqlBytes, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("failed to read migration %s: %w", file.Name(), err)
-			}
+	var query string
+	args := []interface{}{t.Name}
+	switch DialectOf(db) {
+	case SQLite:
+		query = `
+			SELECT name AS column_name, LOWER(type) AS data_type
+			FROM pragma_table_info($1)
+			ORDER BY cid;
+		`
+	default:
+		query = `
+			SELECT column_name,
+				CASE
+					WHEN data_type = 'USER-DEFINED' THEN udt_name
+					WHEN data_type = 'ARRAY' THEN to_regtype(quote_ident(udt_schema) || '.' || quote_ident(udt_name))::text
+					ELSE data_type
+				END AS data_type
+			FROM information_schema.columns
+			WHERE table_schema = $2 AND table_name = $1
+			ORDER BY ordinal_position;
+		`
+		args = append(args, t.SchemaOrDefault())
+	}
 
-			if _, err := db.Exec(string(sqlBytes)); err != nil {
-				return fmt.Errorf("failed to execute migration %s: %w", file.Name(), err)
-			}
+	cols := []Column{}
+	if err := db.Select(&cols, query, args...); err != nil {
+		return nil, err
+	}
+	return cols, nil
+}
 
-			log.Printf("Applied migration: %s", file.Name())
-		}
+// PrimaryKey lists the columns of a table's primary key in key order;
+// it is empty when the table has none
+func PrimaryKey(db *sqlx.DB, tableName string) ([]string, error) {
+	t, err := ParseTableName(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckSchemaSupport(db, t); err != nil {
+		return nil, err
+	}
+
+	var query string
+	args := []interface{}{t.Name}
+	switch DialectOf(db) {
+	case SQLite:
+		query = `SELECT name FROM pragma_table_info($1) WHERE pk > 0 ORDER BY pk;`
+	default:
+		query = `
+			SELECT kcu.column_name
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage kcu
+			  ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema
+			WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = $2 AND tc.table_name = $1
+			ORDER BY kcu.ordinal_position;
+		`
+		args = append(args, t.SchemaOrDefault())
+	}
+
+	key := []string{}
+	if err := db.Select(&key, query, args...); err != nil {
+		return nil, err
 	}
-	return nil
+	return key, nil
 }
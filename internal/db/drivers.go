@@ -0,0 +1,23 @@
+package db
+
+import (
+	"fmt"
+)
+
+// Postgres client libraries selectable via database.driver
+const (
+	DriverPQ  = "pq"  // github.com/lib/pq (default)
+	DriverPGX = "pgx" // github.com/jackc/pgx/v5 through its database/sql adapter
+)
+
+// sqlDriverName maps a database.driver value to the name registered with database/sql
+func sqlDriverName(driver string) (string, error) {
+	switch driver {
+	case "", DriverPQ:
+		return "postgres", nil
+	case DriverPGX:
+		return "pgx", nil
+	default:
+		return "", fmt.Errorf("unknown postgres driver %q", driver)
+	}
+}
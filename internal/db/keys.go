@@ -0,0 +1,122 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Managed primary key types: the server generates the key of every row
+// loaded without one
+const (
+	KeyUUID = "uuid" // random (version 4) UUID
+	KeyULID = "ulid" // time-ordered ULID, 26 characters of Crockford base32
+)
+
+// ManagedKey is a table's generated primary key, stored in
+// table_metadata.managed_key and managed_key_type
+type ManagedKey struct {
+	Column string `db:"managed_key" json:"column"`
+	Type   string `db:"managed_key_type" json:"type"`
+}
+
+// Check validates a managed key before its table is created
+func (k ManagedKey) Check() error {
+	if k.Type != KeyUUID && k.Type != KeyULID {
+		return fmt.Errorf("managed key type must be %s or %s, got %q", KeyUUID, KeyULID, k.Type)
+	}
+	if !identifierRE.MatchString(k.Column) {
+		return fmt.Errorf("invalid managed key column %q", k.Column)
+	}
+	if IsProvenanceColumn(k.Column) {
+		return fmt.Errorf("%s is a managed provenance column", k.Column)
+	}
+	return nil
+}
+
+// ColumnDef is the key's column definition for CREATE TABLE. Postgres UUID
+// keys also default to gen_random_uuid() for rows written by plain SQL.
+func (k ManagedKey) ColumnDef(d Dialect) string {
+	if d == Postgres && k.Type == KeyUUID {
+		return QuoteIdent(k.Column) + " UUID PRIMARY KEY DEFAULT gen_random_uuid()"
+	}
+	return QuoteIdent(k.Column) + " TEXT PRIMARY KEY"
+}
+
+// Fill sets a new key on row unless it already carries one. A nil key
+// (a table without a managed key) leaves row alone.
+func (k *ManagedKey) Fill(row map[string]interface{}) {
+	if k == nil || row[k.Column] != nil {
+		return
+	}
+	if k.Type == KeyULID {
+		row[k.Column] = NewULID()
+	} else {
+		row[k.Column] = NewUUID()
+	}
+}
+
+// LoadManagedKey reads the managed key of table; nil when it has none or
+// isn't registered
+func LoadManagedKey(q sqlx.Queryer, table string) (*ManagedKey, error) {
+	var k struct {
+		Column *string `db:"managed_key"`
+		Type   *string `db:"managed_key_type"`
+	}
+	err := sqlx.Get(q, &k, `SELECT managed_key, managed_key_type FROM table_metadata WHERE table_name = $1`, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("managed key lookup failed: %w", err)
+	}
+	if k.Column == nil || k.Type == nil {
+		return nil, nil
+	}
+	return &ManagedKey{Column: *k.Column, Type: *k.Type}, nil
+}
+
+// NewUUID returns a random version 4 UUID in its canonical form
+func NewUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// crockford is the Crockford base32 alphabet ULIDs are written in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID for the current time: 48 bits of milliseconds
+// since the epoch then 80 random bits, so keys sort by creation time
+func NewULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(b[6:])
+
+	// 128 bits as 26 base32 digits, the first carrying the top 3 bits
+	hi, lo := binary.BigEndian.Uint64(b[0:8]), binary.BigEndian.Uint64(b[8:16])
+	var out strings.Builder
+	out.Grow(26)
+	for i := 25; i >= 0; i-- {
+		shift := uint(i * 5)
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift > 59:
+			v = lo>>shift | hi<<(64-shift)
+		default:
+			v = lo >> shift
+		}
+		out.WriteByte(crockford[v&0x1f])
+	}
+	return out.String()
+}
@@ -0,0 +1,436 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migration is a single versioned schema change.
+// Files are either NNN_name.sql / NNN_name.up.sql, optionally paired with NNN_name.down.sql.
+type Migration struct {
+	Version  string // file name without extension, e.g. "003_create_refresh_logs_table"
+	Path     string
+	SQL      string
+	Checksum string // sha256 of the up file contents
+	DownSQL  string // empty when no .down.sql exists
+}
+
+// HasDown reports whether the migration can be rolled back
+func (m Migration) HasDown() bool {
+	return m.DownSQL != ""
+}
+
+// Migrations are compiled into the binary so `migrate` works from any
+// working directory (e.g. init containers without the source tree).
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// migrationsDir returns the embedded migrations folder for the connection's dialect
+func migrationsDir(db *sqlx.DB) string {
+	return path.Join("migrations", string(DialectOf(db)))
+}
+
+// LoadMigrations reads all migration files for the dialect, sorted by version
+func LoadMigrations(db *sqlx.DB) ([]Migration, error) {
+	dir := migrationsDir(db)
+	files, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations folder: %w", err)
+	}
+
+	ups := map[string]Migration{}
+	downs := map[string]string{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || filepath.Ext(name) != ".sql" {
+			continue
+		}
+		sqlBytes, err := fs.ReadFile(migrationsFS, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+
+		if strings.HasSuffix(name, ".down.sql") {
+			downs[strings.TrimSuffix(name, ".down.sql")] = string(sqlBytes)
+			continue
+		}
+
+		version := strings.TrimSuffix(strings.TrimSuffix(name, ".sql"), ".up")
+		if _, dup := ups[version]; dup {
+			return nil, fmt.Errorf("duplicate migration version %s", version)
+		}
+		sum := sha256.Sum256(sqlBytes)
+		ups[version] = Migration{
+			Version:  version,
+			Path:     path.Join(dir, name),
+			SQL:      string(sqlBytes),
+			Checksum: hex.EncodeToString(sum[:]),
+		}
+	}
+
+	migrations := make([]Migration, 0, len(ups))
+	for version, m := range ups {
+		m.DownSQL = downs[version]
+		migrations = append(migrations, m)
+		delete(downs, version)
+	}
+	for version := range downs {
+		return nil, fmt.Errorf("down migration %s has no matching up migration", version)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// AppliedMigration is a row of schema_migrations
+type AppliedMigration struct {
+	Version   string `db:"version" json:"version"`
+	Checksum  string `db:"checksum" json:"checksum"`
+	AppliedAt string `db:"applied_at" json:"applied_at"`
+}
+
+// migrationConn is what migrations run on: the pool, or on Postgres the
+// connection holding the migration lock (see withMigrationLock)
+type migrationConn interface {
+	sqlx.ExecerContext
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// ensureMigrationsTable creates the tracking table (portable across dialects)
+func ensureMigrationsTable(conn migrationConn) error {
+	_, err := conn.ExecContext(context.Background(), `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// AppliedMigrations returns recorded migrations keyed by version
+func AppliedMigrations(db *sqlx.DB) (map[string]AppliedMigration, error) {
+	return appliedMigrations(db)
+}
+
+func appliedMigrations(conn migrationConn) (map[string]AppliedMigration, error) {
+	if err := ensureMigrationsTable(conn); err != nil {
+		return nil, err
+	}
+
+	var rows []AppliedMigration
+	if err := conn.SelectContext(context.Background(), &rows, `SELECT version, checksum, CAST(applied_at AS TEXT) AS applied_at FROM schema_migrations`); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	applied := make(map[string]AppliedMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// RunMigrations applies every migration not yet recorded in schema_migrations,
+// in file-name order. Already-applied files whose contents changed are reported
+// as an error instead of being re-run.
+func RunMigrations(db *sqlx.DB) error {
+	return withMigrationLock(db, func(conn migrationConn) error {
+		return runMigrations(db, conn)
+	})
+}
+
+func runMigrations(db *sqlx.DB, conn migrationConn) error {
+	migrations, err := LoadMigrations(db)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return err
+	}
+
+	// refuse to continue if history was rewritten
+	edited := []string{}
+	for _, m := range migrations {
+		if a, ok := applied[m.Version]; ok && a.Checksum != m.Checksum {
+			edited = append(edited, m.Version)
+		}
+	}
+	if len(edited) > 0 {
+		return fmt.Errorf("applied migrations were modified (checksum mismatch): %s", strings.Join(edited, ", "))
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := inMigrationTx(conn, m.SQL, func(ctx context.Context, tx sqlx.ExecerContext) error {
+			if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+				return fmt.Errorf("failed to execute migration %s: %w", m.Version, err)
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, checksum) VALUES ($1, $2)`, m.Version, m.Checksum); err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", m.Version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Applied migration: %s", m.Version)
+	}
+	return nil
+}
+
+// RollbackMigrations reverts the last n applied migrations, newest first.
+// Every migration involved must have a down file and an unchanged checksum;
+// otherwise nothing is rolled back. Returns the versions that were reverted.
+func RollbackMigrations(db *sqlx.DB, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("rollback count must be positive")
+	}
+
+	var reverted []string
+	err := withMigrationLock(db, func(conn migrationConn) error {
+		var err error
+		reverted, err = rollbackMigrations(db, conn, n)
+		return err
+	})
+	return reverted, err
+}
+
+func rollbackMigrations(db *sqlx.DB, conn migrationConn, n int) ([]string, error) {
+	migrations, err := LoadMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// newest applied first
+	targets := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(targets) < n; i-- {
+		if _, ok := applied[migrations[i].Version]; ok {
+			targets = append(targets, migrations[i])
+		}
+	}
+	if len(targets) < n {
+		return nil, fmt.Errorf("only %d applied migrations available to roll back", len(targets))
+	}
+
+	// validate everything up front so a bad file doesn't leave us half-reverted
+	for _, m := range targets {
+		if !m.HasDown() {
+			return nil, fmt.Errorf("migration %s has no down file", m.Version)
+		}
+		if applied[m.Version].Checksum != m.Checksum {
+			return nil, fmt.Errorf("migration %s was modified after it was applied", m.Version)
+		}
+	}
+
+	reverted := []string{}
+	for _, m := range targets {
+		err := inMigrationTx(conn, m.DownSQL, func(ctx context.Context, tx sqlx.ExecerContext) error {
+			if _, err := tx.ExecContext(ctx, m.DownSQL); err != nil {
+				return fmt.Errorf("failed to roll back migration %s: %w", m.Version, err)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+				return fmt.Errorf("failed to unrecord migration %s: %w", m.Version, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return reverted, err
+		}
+		log.Printf("Rolled back migration: %s", m.Version)
+		reverted = append(reverted, m.Version)
+	}
+	return reverted, nil
+}
+
+// MigrationState describes one migration for status reporting
+type MigrationState struct {
+	Version   string `json:"version"`
+	Applied   bool   `json:"applied"`
+	AppliedAt string `json:"applied_at,omitempty"`
+	Checksum  string `json:"checksum"`
+	Modified  bool   `json:"modified"` // applied checksum differs from the file
+	HasDown   bool   `json:"has_down"`
+
+	AppliedChecksum string `json:"applied_checksum,omitempty"` // as recorded in schema_migrations
+	Missing         bool   `json:"missing,omitempty"`          // applied, but no file in this build
+}
+
+// MigrationStatus lists every known migration with its applied state.
+// Versions recorded in schema_migrations but missing from the binary are included too.
+func MigrationStatus(db *sqlx.DB) ([]MigrationState, error) {
+	migrations, err := LoadMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		st := MigrationState{Version: m.Version, Checksum: m.Checksum, HasDown: m.HasDown()}
+		if a, ok := applied[m.Version]; ok {
+			st.Applied = true
+			st.AppliedAt = a.AppliedAt
+			st.AppliedChecksum = a.Checksum
+			st.Modified = a.Checksum != m.Checksum
+			delete(applied, m.Version)
+		}
+		states = append(states, st)
+	}
+	for _, a := range applied {
+		states = append(states, MigrationState{
+			Version:         a.Version,
+			Applied:         true,
+			AppliedAt:       a.AppliedAt,
+			Checksum:        a.Checksum,
+			AppliedChecksum: a.Checksum,
+			Missing:         true,
+		})
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+var migrationNameRE = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// CreateMigration writes an empty up/down pair named NNN_<name> into every
+// dialect folder under dir (the source tree's internal/db/migrations).
+// Returns the created file paths.
+func CreateMigration(dir, name string) ([]string, error) {
+	if !migrationNameRE.MatchString(name) {
+		return nil, fmt.Errorf("migration name must be lowercase letters, digits and underscores")
+	}
+
+	dialects := []Dialect{Postgres, SQLite}
+
+	// next version number across all dialects keeps them aligned
+	next := 1
+	for _, d := range dialects {
+		files, err := os.ReadDir(filepath.Join(dir, string(d)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migrations folder: %w", err)
+		}
+		for _, f := range files {
+			prefix, _, ok := strings.Cut(f.Name(), "_")
+			if !ok {
+				continue
+			}
+			if n, err := strconv.Atoi(prefix); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+	}
+
+	version := fmt.Sprintf("%03d_%s", next, name)
+	created := []string{}
+	for _, d := range dialects {
+		for _, suffix := range []string{".sql", ".down.sql"} {
+			p := filepath.Join(dir, string(d), version+suffix)
+			header := fmt.Sprintf("-- %s (%s)\n", version, d)
+			if suffix == ".down.sql" {
+				header = fmt.Sprintf("-- rollback for %s (%s)\n", version, d)
+			}
+			if err := os.WriteFile(p, []byte(header), 0o644); err != nil {
+				return created, fmt.Errorf("failed to write %s: %w", p, err)
+			}
+			created = append(created, p)
+		}
+	}
+	return created, nil
+}
+
+// migrationLockKey identifies the Postgres advisory lock guarding migrations
+const migrationLockKey int64 = 0x67646621 // "gdf!"
+
+// noTxDirective lets a migration opt out of the wrapping transaction
+// (needed for statements such as CREATE INDEX CONCURRENTLY)
+const noTxDirective = "-- migrate:no-transaction"
+
+// withMigrationLock runs fn while holding a session-level advisory lock, so
+// replicas booting at the same time apply migrations one after another.
+// fn gets the connection holding the lock and must run its statements on
+// it: a pool of one connection (the migrate CLI's) has no other to give.
+// SQLite uses a single connection, so it needs no extra lock.
+func withMigrationLock(db *sqlx.DB, fn func(conn migrationConn) error) error {
+	if DialectOf(db) != Postgres {
+		return fn(db)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reserve lock connection: %w", err)
+	}
+	defer conn.Close()
+
+	log.Println("Waiting for migration lock...")
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			log.Printf("failed to release migration lock: %v", err)
+		}
+	}()
+
+	return fn(conn)
+}
+
+// inMigrationTx runs fn inside a transaction on conn unless the migration opts out
+func inMigrationTx(conn migrationConn, sqlText string, fn func(ctx context.Context, tx sqlx.ExecerContext) error) error {
+	ctx := context.Background()
+	if strings.HasPrefix(strings.TrimSpace(sqlText), noTxDirective) {
+		return fn(ctx, conn)
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer func() {
+		// if still active, rollback
+		_ = tx.Rollback()
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("tx commit failed: %w", err)
+	}
+	return nil
+}
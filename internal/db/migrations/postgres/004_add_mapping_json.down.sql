@@ -0,0 +1,2 @@
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS mapping_json;
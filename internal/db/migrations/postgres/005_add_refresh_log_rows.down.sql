@@ -0,0 +1,2 @@
+ALTER TABLE refresh_logs
+DROP COLUMN IF EXISTS rows_inserted;
@@ -0,0 +1,2 @@
+ALTER TABLE refresh_logs
+ADD COLUMN IF NOT EXISTS rows_inserted INT;
@@ -0,0 +1,10 @@
+-- Daily per-table rollup of refresh_logs, kept after raw logs expire
+CREATE TABLE IF NOT EXISTS refresh_log_rollups (
+    day DATE NOT NULL,
+    table_name TEXT NOT NULL,
+    runs INT NOT NULL DEFAULT 0,
+    successes INT NOT NULL DEFAULT 0,
+    failures INT NOT NULL DEFAULT 0,
+    total_rows BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, table_name)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_refresh_logs_error_code;
+
+ALTER TABLE refresh_logs
+DROP COLUMN IF EXISTS error_code;
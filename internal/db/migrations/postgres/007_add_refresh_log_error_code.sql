@@ -0,0 +1,5 @@
+-- Failure classification (UPSTREAM_HTTP, UPSTREAM_SCHEMA, VALIDATION, DB_INSERT, TIMEOUT)
+ALTER TABLE refresh_logs
+ADD COLUMN IF NOT EXISTS error_code TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_logs_error_code ON refresh_logs (error_code);
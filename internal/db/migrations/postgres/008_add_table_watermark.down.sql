@@ -0,0 +1,3 @@
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS watermark_value,
+DROP COLUMN IF EXISTS watermark_column;
@@ -0,0 +1,4 @@
+-- Incremental loads: column to track and the highest value loaded so far
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS watermark_column TEXT,
+ADD COLUMN IF NOT EXISTS watermark_value TEXT;
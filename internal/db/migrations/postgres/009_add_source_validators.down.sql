@@ -0,0 +1,3 @@
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS source_last_modified,
+DROP COLUMN IF EXISTS source_etag;
@@ -0,0 +1,4 @@
+-- HTTP cache validators from the last successful source fetch
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS source_etag TEXT,
+ADD COLUMN IF NOT EXISTS source_last_modified TEXT;
@@ -0,0 +1,3 @@
+-- SHA-256 of the last loaded payload, for sources without cache validators
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS source_checksum TEXT;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS quality_results;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS quality_checks;
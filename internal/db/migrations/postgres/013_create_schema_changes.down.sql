@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS schema_changes;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS source_schema;
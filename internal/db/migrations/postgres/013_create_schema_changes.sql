@@ -0,0 +1,16 @@
+-- Last observed source payload schema (field -> JSON type) and the drift seen between refreshes
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS source_schema JSONB;
+
+CREATE TABLE IF NOT EXISTS schema_changes (
+    id SERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    field TEXT NOT NULL,
+    change TEXT NOT NULL,              -- added, removed or retyped
+    old_type TEXT,
+    new_type TEXT,
+    loaded BOOLEAN NOT NULL,           -- false when the table has no column for the field
+    detected_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_schema_changes_table_detected ON schema_changes (table_name, detected_at);
@@ -0,0 +1,5 @@
+ALTER TABLE quality_results
+DROP COLUMN IF EXISTS expectation;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS expectations;
@@ -0,0 +1,6 @@
+-- Per-table expectation contracts (JSON list of checks that must pass for a refresh to count as OK)
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS expectations JSONB;
+
+ALTER TABLE quality_results
+ADD COLUMN IF NOT EXISTS expectation BOOLEAN NOT NULL DEFAULT FALSE;
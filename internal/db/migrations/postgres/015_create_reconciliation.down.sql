@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS reconciliation_results;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS reconcile_column,
+DROP COLUMN IF EXISTS reconcile_count_url,
+DROP COLUMN IF EXISTS reconcile_window;
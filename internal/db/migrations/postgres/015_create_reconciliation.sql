@@ -0,0 +1,19 @@
+-- Source reconciliation: per-table window/count settings and the result of each comparison
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS reconcile_window INTEGER,         -- seconds; NULL disables reconciliation
+ADD COLUMN IF NOT EXISTS reconcile_count_url TEXT,         -- source-provided total for {since}..{until}
+ADD COLUMN IF NOT EXISTS reconcile_column TEXT;            -- timestamp column counting loaded rows
+
+CREATE TABLE IF NOT EXISTS reconciliation_results (
+    id SERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    source_count BIGINT,
+    loaded_count BIGINT,
+    status TEXT NOT NULL,              -- MATCH, MISMATCH or ERROR
+    message TEXT,
+    checked_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_results_table_checked ON reconciliation_results (table_name, checked_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_table_metadata_snapshot_of;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS snapshot_at,
+DROP COLUMN IF EXISTS snapshot_of;
@@ -0,0 +1,6 @@
+-- Point-in-time snapshots are registered tables pointing back at their source
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS snapshot_of TEXT,                 -- source table; NULL for regular tables
+ADD COLUMN IF NOT EXISTS snapshot_at TIMESTAMP;            -- when the copy was taken
+
+CREATE INDEX IF NOT EXISTS idx_table_metadata_snapshot_of ON table_metadata (snapshot_of);
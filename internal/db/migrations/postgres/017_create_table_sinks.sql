@@ -0,0 +1,16 @@
+-- Export sinks: after each successful refresh, rows past the cursor are written to object storage
+CREATE TABLE IF NOT EXISTS table_sinks (
+    id SERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    url TEXT NOT NULL,                 -- s3://bucket/prefix, gs://bucket/prefix or file:///dir
+    format TEXT NOT NULL,              -- csv, ndjson or parquet
+    cursor_column TEXT NOT NULL,       -- only rows with a greater value are exported
+    cursor_value TEXT,                 -- highest value exported so far; NULL = nothing yet
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_export_at TIMESTAMP,
+    last_object TEXT,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_table_sinks_table_name ON table_sinks (table_name);
@@ -0,0 +1,10 @@
+-- Change data capture outbox: inserted batches waiting to be published to Kafka, oldest first
+CREATE TABLE IF NOT EXISTS cdc_outbox (
+    id SERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    messages TEXT NOT NULL,            -- JSON array of message values, published in order
+    row_count INTEGER NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
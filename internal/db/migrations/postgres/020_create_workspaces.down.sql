@@ -0,0 +1,7 @@
+DELETE FROM saved_queries WHERE workspace_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_saved_queries_workspace_name;
+DROP INDEX IF EXISTS idx_saved_queries_default_name;
+ALTER TABLE saved_queries DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE saved_queries ADD CONSTRAINT saved_queries_name_key UNIQUE (name);
+DROP TABLE IF EXISTS workspace_api_keys;
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,23 @@
+-- Workspaces: tenants whose tables live in their own schema, queried as their own role
+CREATE TABLE IF NOT EXISTS workspaces (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    schema_name TEXT NOT NULL UNIQUE,  -- holds the workspace's tables (ws_<name>)
+    role_name TEXT NOT NULL UNIQUE,    -- NOLOGIN role that workspace SQL runs as
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- API keys that act within one workspace; only a hash is kept
+CREATE TABLE IF NOT EXISTS workspace_api_keys (
+    id SERIAL PRIMARY KEY,
+    workspace_id INT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    key_hash TEXT NOT NULL UNIQUE,     -- hex sha256 of the key
+    key_prefix TEXT NOT NULL,          -- first characters of the key, to tell keys apart
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Saved query names are unique per workspace; NULL is the default workspace
+ALTER TABLE saved_queries ADD COLUMN IF NOT EXISTS workspace_id INT REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE saved_queries DROP CONSTRAINT IF EXISTS saved_queries_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_saved_queries_default_name ON saved_queries (name) WHERE workspace_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_saved_queries_workspace_name ON saved_queries (workspace_id, name) WHERE workspace_id IS NOT NULL;
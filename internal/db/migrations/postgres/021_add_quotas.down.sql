@@ -0,0 +1,9 @@
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS ingest_per_minute,
+DROP COLUMN IF EXISTS max_rows;
+
+ALTER TABLE workspaces
+DROP COLUMN IF EXISTS max_storage_bytes,
+DROP COLUMN IF EXISTS ingest_per_minute,
+DROP COLUMN IF EXISTS max_rows_per_table,
+DROP COLUMN IF EXISTS max_tables;
@@ -0,0 +1,10 @@
+-- Quota overrides; NULL falls back to the quotas config section, 0 = unlimited
+ALTER TABLE workspaces
+ADD COLUMN IF NOT EXISTS max_tables INT,
+ADD COLUMN IF NOT EXISTS max_rows_per_table BIGINT,
+ADD COLUMN IF NOT EXISTS ingest_per_minute INT,
+ADD COLUMN IF NOT EXISTS max_storage_bytes BIGINT;
+
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS max_rows BIGINT,
+ADD COLUMN IF NOT EXISTS ingest_per_minute INT;
@@ -0,0 +1,5 @@
+ALTER TABLE workspace_api_keys
+DROP COLUMN IF EXISTS last_used_at,
+DROP COLUMN IF EXISTS expires_at,
+DROP COLUMN IF EXISTS scope,
+DROP COLUMN IF EXISTS label;
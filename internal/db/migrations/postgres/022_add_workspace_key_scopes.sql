@@ -0,0 +1,6 @@
+-- Workspace keys can be narrowed to ingest or queries, expire, and record when they were last used
+ALTER TABLE workspace_api_keys
+ADD COLUMN IF NOT EXISTS label TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT 'full',  -- full, ingest or query
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP,                 -- NULL = never
+ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
@@ -0,0 +1,4 @@
+-- How refreshes load a table: append (default) adds the fetched rows,
+-- replace swaps the table's contents for them
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS load_mode TEXT NOT NULL DEFAULT 'append';
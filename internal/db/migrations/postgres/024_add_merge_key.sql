@@ -0,0 +1,4 @@
+-- Merge loads: comma-separated key columns; a loaded row replaces the
+-- table's rows with the same key
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS merge_key TEXT;
@@ -0,0 +1,4 @@
+-- Delete detection for merge loads: off (default), mark stamps _deleted_at
+-- on rows missing from the latest pull, delete removes them
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS merge_deletes TEXT NOT NULL DEFAULT 'off';
@@ -0,0 +1,5 @@
+ALTER TABLE refresh_logs
+DROP COLUMN IF EXISTS sources;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS data_sources;
@@ -0,0 +1,7 @@
+-- Tables fed by several sources (e.g. one per region): a JSON list of
+-- {name, url} fetched in one refresh, and each source's outcome per run
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS data_sources JSONB;
+
+ALTER TABLE refresh_logs
+ADD COLUMN IF NOT EXISTS sources JSONB;
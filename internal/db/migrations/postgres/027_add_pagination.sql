@@ -0,0 +1,4 @@
+-- How a table's source pages its records (JSON; see etl.Pagination);
+-- data_sources entries may carry their own
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS pagination JSONB;
@@ -0,0 +1,4 @@
+-- How a table's source is requested when not by plain GET: method, body
+-- template and content type (JSON; see etl.SourceRequest)
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS request JSONB;
@@ -0,0 +1,8 @@
+-- Rows and payload bytes written through the ingest API, per table and hour
+CREATE TABLE IF NOT EXISTS ingest_stats (
+    table_name TEXT NOT NULL,
+    hour TIMESTAMP NOT NULL,           -- start of the UTC hour
+    row_count BIGINT NOT NULL DEFAULT 0,
+    byte_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (table_name, hour)
+);
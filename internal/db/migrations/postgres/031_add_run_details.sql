@@ -0,0 +1,4 @@
+-- Stage timings, row counts, warnings and source requests of each
+-- refresh run (etl.RunDetail), served by GET /runs/:id
+ALTER TABLE refresh_logs
+ADD COLUMN IF NOT EXISTS details JSONB;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_refresh_logs_retry_of;
+
+ALTER TABLE refresh_logs
+DROP COLUMN IF EXISTS retry_of;
+
+ALTER TABLE refresh_logs
+DROP COLUMN IF EXISTS params;
@@ -0,0 +1,9 @@
+-- The sources a run fetched, with placeholders and watermark filled in,
+-- so POST /runs/:id/retry can replay them; and the run a retry retries
+ALTER TABLE refresh_logs
+ADD COLUMN IF NOT EXISTS params JSONB;
+
+ALTER TABLE refresh_logs
+ADD COLUMN IF NOT EXISTS retry_of INTEGER REFERENCES refresh_logs (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_logs_retry_of ON refresh_logs (retry_of);
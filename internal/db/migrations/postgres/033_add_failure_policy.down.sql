@@ -0,0 +1,14 @@
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS refresh_paused_at;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS consecutive_failures;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS failure_backoff;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS failure_action;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS failure_threshold;
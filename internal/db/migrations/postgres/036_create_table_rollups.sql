@@ -0,0 +1,18 @@
+-- Continuous aggregates: after each successful refresh, the time buckets at
+-- or past the watermark are recomputed into the rollup table
+CREATE TABLE IF NOT EXISTS table_rollups (
+    id SERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    rollup_table TEXT NOT NULL UNIQUE, -- created in the source table's schema
+    time_column TEXT NOT NULL,
+    bucket TEXT NOT NULL,              -- minute, hour or day
+    group_by JSONB,                    -- columns kept next to the bucket
+    aggregates JSONB NOT NULL,         -- [{func, column, as}]
+    watermark TEXT,                    -- start of the latest bucket computed; NULL = nothing yet
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_run_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_table_rollups_table_name ON table_rollups (table_name);
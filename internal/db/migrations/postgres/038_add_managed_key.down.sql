@@ -0,0 +1,5 @@
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS managed_key_type;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS managed_key;
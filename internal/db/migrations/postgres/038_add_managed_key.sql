@@ -0,0 +1,7 @@
+-- Managed primary keys: the column (and its type, uuid or ulid) whose
+-- value the server generates for rows loaded without one
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS managed_key TEXT;
+
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS managed_key_type TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS soft_delete_grace;
+
+ALTER TABLE table_metadata
+DROP COLUMN IF EXISTS soft_delete;
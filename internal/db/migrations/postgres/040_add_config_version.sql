@@ -0,0 +1,4 @@
+-- Optimistic concurrency: bumped by every configuration write (PUT
+-- /tables/{name}/config and /quota, not refreshes); served as the ETag
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS config_version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+-- What a refresh does with rows that fail: chunked (default) commits
+-- chunks as they load and stops at the first failure, atomic loads all or
+-- nothing, batch skips failing chunks and row skips failing rows
+ALTER TABLE table_metadata
+ADD COLUMN IF NOT EXISTS insert_mode TEXT NOT NULL DEFAULT 'chunked';
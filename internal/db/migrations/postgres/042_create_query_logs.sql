@@ -0,0 +1,19 @@
+-- Audit log of the queries run through the API: GET /query, /transform,
+-- saved query runs and shared links
+CREATE TABLE IF NOT EXISTS query_logs (
+    id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,                -- query, transform, saved_query or shared
+    caller TEXT NOT NULL,              -- API key fingerprint, workspace key prefix, or anonymous
+    workspace TEXT,                    -- NULL for the default workspace
+    client_ip TEXT,
+    table_name TEXT,                   -- query and transform only
+    query_id INT,                      -- saved_query and shared only
+    statement TEXT NOT NULL,           -- the SQL run
+    duration_ms BIGINT NOT NULL,
+    row_count INT,                     -- NULL when the query failed
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_logs_created_at ON query_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_query_logs_caller ON query_logs (caller, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE cdc_outbox
+DROP COLUMN IF EXISTS dead_at;
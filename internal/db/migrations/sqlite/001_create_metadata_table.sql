@@ -0,0 +1,17 @@
+-- SQLite variant of table_metadata (local development)
+CREATE TABLE IF NOT EXISTS table_metadata (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL UNIQUE,
+    table_type TEXT NOT NULL,          -- "normal" or "time_series"
+    refresh_interval INT,              -- seconds, null for normal tables
+    data_source_url TEXT,              -- API endpoint for auto-refresh
+    mapping_json BLOB,                 -- JSON stored as raw bytes
+
+    -- ETL tracking fields
+    last_refresh_success TIMESTAMP,
+    last_refresh_error TEXT,
+    status TEXT DEFAULT 'OK',          -- "OK" or "ERROR"
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS saved_queries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,          -- descriptive name for the query
+    sql_text TEXT NOT NULL,             -- the actual SQL query to run
+    description TEXT,                   -- optional description
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS refresh_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL,
+    status TEXT NOT NULL,        -- OK or ERROR
+    message TEXT,
+    rows_inserted INT,
+    error_code TEXT,             -- UPSTREAM_HTTP, UPSTREAM_SCHEMA, VALIDATION, DB_INSERT, TIMEOUT
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_logs_error_code ON refresh_logs (error_code);
@@ -0,0 +1,2 @@
+-- 004_add_mapping_json (sqlite)
+-- Nothing to undo (see 004_add_mapping_json.sql)
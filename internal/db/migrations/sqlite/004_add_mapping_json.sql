@@ -0,0 +1,2 @@
+-- 004_add_mapping_json (sqlite)
+-- Nothing to do: table_metadata.mapping_json is created by 001 on SQLite; kept so versions match postgres
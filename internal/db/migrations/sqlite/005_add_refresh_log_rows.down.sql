@@ -0,0 +1,2 @@
+-- 005_add_refresh_log_rows (sqlite)
+-- Nothing to undo (see 005_add_refresh_log_rows.sql)
@@ -0,0 +1,2 @@
+-- 005_add_refresh_log_rows (sqlite)
+-- Nothing to do: refresh_logs.rows_inserted is created by 003 on SQLite; kept so versions match postgres
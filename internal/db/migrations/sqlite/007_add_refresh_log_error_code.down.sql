@@ -0,0 +1,2 @@
+-- 007_add_refresh_log_error_code (sqlite)
+-- Nothing to undo (see 007_add_refresh_log_error_code.sql)
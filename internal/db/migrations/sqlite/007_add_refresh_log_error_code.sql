@@ -0,0 +1,2 @@
+-- 007_add_refresh_log_error_code (sqlite)
+-- Nothing to do: refresh_logs.error_code and its index are created by 003 on SQLite; kept so versions match postgres
@@ -0,0 +1,2 @@
+ALTER TABLE table_metadata DROP COLUMN watermark_value;
+ALTER TABLE table_metadata DROP COLUMN watermark_column;
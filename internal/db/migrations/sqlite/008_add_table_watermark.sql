@@ -0,0 +1,3 @@
+-- Incremental loads: column to track and the highest value loaded so far
+ALTER TABLE table_metadata ADD COLUMN watermark_column TEXT;
+ALTER TABLE table_metadata ADD COLUMN watermark_value TEXT;
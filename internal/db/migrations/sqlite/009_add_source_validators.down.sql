@@ -0,0 +1,2 @@
+ALTER TABLE table_metadata DROP COLUMN source_last_modified;
+ALTER TABLE table_metadata DROP COLUMN source_etag;
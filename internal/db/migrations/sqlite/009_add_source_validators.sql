@@ -0,0 +1,3 @@
+-- HTTP cache validators from the last successful source fetch
+ALTER TABLE table_metadata ADD COLUMN source_etag TEXT;
+ALTER TABLE table_metadata ADD COLUMN source_last_modified TEXT;
@@ -0,0 +1,2 @@
+-- SHA-256 of the last loaded payload, for sources without cache validators
+ALTER TABLE table_metadata ADD COLUMN source_checksum TEXT;
@@ -0,0 +1,12 @@
+-- Responses of POST /ingest calls made with an Idempotency-Key, replayed on retries
+CREATE TABLE IF NOT EXISTS ingest_idempotency_keys (
+    table_name TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,        -- sha256 of the request body
+    status_code INT NOT NULL,
+    response TEXT NOT NULL,            -- JSON body sent the first time
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (table_name, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingest_idempotency_keys_created_at ON ingest_idempotency_keys (created_at);
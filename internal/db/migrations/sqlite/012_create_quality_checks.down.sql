@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS quality_results;
+ALTER TABLE table_metadata DROP COLUMN quality_checks;
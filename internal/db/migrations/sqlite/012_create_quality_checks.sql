@@ -0,0 +1,16 @@
+-- Per-table data quality checks (JSON list) and the results of each run
+ALTER TABLE table_metadata ADD COLUMN quality_checks BLOB;
+
+CREATE TABLE IF NOT EXISTS quality_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL,
+    check_name TEXT NOT NULL,
+    check_type TEXT NOT NULL,          -- null_pct, unique, row_count_delta, freshness
+    column_name TEXT,
+    status TEXT NOT NULL,              -- PASS, FAIL or ERROR
+    observed REAL,                     -- measured value (null %, duplicates, row count, age in seconds)
+    message TEXT,
+    checked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quality_results_table_checked ON quality_results (table_name, checked_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS schema_changes;
+ALTER TABLE table_metadata DROP COLUMN source_schema;
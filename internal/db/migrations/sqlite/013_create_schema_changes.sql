@@ -0,0 +1,15 @@
+-- Last observed source payload schema (field -> JSON type) and the drift seen between refreshes
+ALTER TABLE table_metadata ADD COLUMN source_schema BLOB;
+
+CREATE TABLE IF NOT EXISTS schema_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL,
+    field TEXT NOT NULL,
+    change TEXT NOT NULL,              -- added, removed or retyped
+    old_type TEXT,
+    new_type TEXT,
+    loaded BOOLEAN NOT NULL,           -- false when the table has no column for the field
+    detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_schema_changes_table_detected ON schema_changes (table_name, detected_at);
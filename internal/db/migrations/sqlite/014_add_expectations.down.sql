@@ -0,0 +1,2 @@
+ALTER TABLE quality_results DROP COLUMN expectation;
+ALTER TABLE table_metadata DROP COLUMN expectations;
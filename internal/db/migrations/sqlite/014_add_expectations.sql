@@ -0,0 +1,4 @@
+-- Per-table expectation contracts (JSON list of checks that must pass for a refresh to count as OK)
+ALTER TABLE table_metadata ADD COLUMN expectations BLOB;
+
+ALTER TABLE quality_results ADD COLUMN expectation BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS reconciliation_results;
+ALTER TABLE table_metadata DROP COLUMN reconcile_column;
+ALTER TABLE table_metadata DROP COLUMN reconcile_count_url;
+ALTER TABLE table_metadata DROP COLUMN reconcile_window;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_table_metadata_snapshot_of;
+ALTER TABLE table_metadata DROP COLUMN snapshot_at;
+ALTER TABLE table_metadata DROP COLUMN snapshot_of;
@@ -0,0 +1,5 @@
+-- Point-in-time snapshots are registered tables pointing back at their source
+ALTER TABLE table_metadata ADD COLUMN snapshot_of TEXT;            -- source table; NULL for regular tables
+ALTER TABLE table_metadata ADD COLUMN snapshot_at TIMESTAMP;       -- when the copy was taken
+
+CREATE INDEX IF NOT EXISTS idx_table_metadata_snapshot_of ON table_metadata (snapshot_of);
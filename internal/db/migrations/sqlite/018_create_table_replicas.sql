@@ -0,0 +1,14 @@
+-- Replicas: local read-only copies of tables on another godataflow instance
+CREATE TABLE IF NOT EXISTS table_replicas (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL UNIQUE,   -- the local copy
+    source_url TEXT NOT NULL,          -- remote API base, e.g. https://eu.example.com/v1
+    source_table TEXT NOT NULL,
+    api_key TEXT,                      -- sent as X-API-Key to the remote
+    sync_interval INTEGER NOT NULL,    -- seconds between syncs
+    live BOOLEAN NOT NULL DEFAULT FALSE, -- also sync when the remote's event stream reports new rows
+    cursor_value TEXT,                 -- latest remote _ingested_at copied; NULL = full copy next time
+    last_sync_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
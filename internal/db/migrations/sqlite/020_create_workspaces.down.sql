@@ -0,0 +1,3 @@
+ALTER TABLE saved_queries DROP COLUMN workspace_id;
+DROP TABLE IF EXISTS workspace_api_keys;
+DROP TABLE IF EXISTS workspaces;
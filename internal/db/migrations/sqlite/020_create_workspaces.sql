@@ -0,0 +1,22 @@
+-- Workspaces: tenants whose tables live in their own schema, queried as their own role.
+-- They need Postgres; the tables exist here so both backends share one catalog.
+CREATE TABLE IF NOT EXISTS workspaces (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    schema_name TEXT NOT NULL UNIQUE,  -- holds the workspace's tables (ws_<name>)
+    role_name TEXT NOT NULL UNIQUE,    -- NOLOGIN role that workspace SQL runs as
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- API keys that act within one workspace; only a hash is kept
+CREATE TABLE IF NOT EXISTS workspace_api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    key_hash TEXT NOT NULL UNIQUE,     -- hex sha256 of the key
+    key_prefix TEXT NOT NULL,          -- first characters of the key, to tell keys apart
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- NULL is the default workspace. The column-level UNIQUE on name stays:
+-- without workspaces every saved query is in the default one.
+ALTER TABLE saved_queries ADD COLUMN workspace_id INTEGER;
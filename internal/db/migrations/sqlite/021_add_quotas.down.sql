@@ -0,0 +1,7 @@
+ALTER TABLE table_metadata DROP COLUMN ingest_per_minute;
+ALTER TABLE table_metadata DROP COLUMN max_rows;
+
+ALTER TABLE workspaces DROP COLUMN max_storage_bytes;
+ALTER TABLE workspaces DROP COLUMN ingest_per_minute;
+ALTER TABLE workspaces DROP COLUMN max_rows_per_table;
+ALTER TABLE workspaces DROP COLUMN max_tables;
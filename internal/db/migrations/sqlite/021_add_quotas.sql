@@ -0,0 +1,8 @@
+-- Quota overrides; NULL falls back to the quotas config section, 0 = unlimited
+ALTER TABLE workspaces ADD COLUMN max_tables INTEGER;
+ALTER TABLE workspaces ADD COLUMN max_rows_per_table INTEGER;
+ALTER TABLE workspaces ADD COLUMN ingest_per_minute INTEGER;
+ALTER TABLE workspaces ADD COLUMN max_storage_bytes INTEGER;
+
+ALTER TABLE table_metadata ADD COLUMN max_rows INTEGER;
+ALTER TABLE table_metadata ADD COLUMN ingest_per_minute INTEGER;
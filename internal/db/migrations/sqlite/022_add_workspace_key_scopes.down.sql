@@ -0,0 +1,4 @@
+ALTER TABLE workspace_api_keys DROP COLUMN last_used_at;
+ALTER TABLE workspace_api_keys DROP COLUMN expires_at;
+ALTER TABLE workspace_api_keys DROP COLUMN scope;
+ALTER TABLE workspace_api_keys DROP COLUMN label;
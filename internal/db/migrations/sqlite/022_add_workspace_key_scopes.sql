@@ -0,0 +1,5 @@
+-- Workspace keys can be narrowed to ingest or queries, expire, and record when they were last used
+ALTER TABLE workspace_api_keys ADD COLUMN label TEXT NOT NULL DEFAULT '';
+ALTER TABLE workspace_api_keys ADD COLUMN scope TEXT NOT NULL DEFAULT 'full';  -- full, ingest or query
+ALTER TABLE workspace_api_keys ADD COLUMN expires_at TIMESTAMP;                -- NULL = never
+ALTER TABLE workspace_api_keys ADD COLUMN last_used_at TIMESTAMP;
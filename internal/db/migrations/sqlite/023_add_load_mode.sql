@@ -0,0 +1,3 @@
+-- How refreshes load a table: append (default) adds the fetched rows,
+-- replace swaps the table's contents for them
+ALTER TABLE table_metadata ADD COLUMN load_mode TEXT NOT NULL DEFAULT 'append';
@@ -0,0 +1,2 @@
+ALTER TABLE refresh_logs DROP COLUMN sources;
+ALTER TABLE table_metadata DROP COLUMN data_sources;
@@ -0,0 +1,5 @@
+-- Tables fed by several sources (e.g. one per region): a JSON list of
+-- {name, url} fetched in one refresh, and each source's outcome per run
+ALTER TABLE table_metadata ADD COLUMN data_sources BLOB;
+
+ALTER TABLE refresh_logs ADD COLUMN sources BLOB;
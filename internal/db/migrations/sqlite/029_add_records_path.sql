@@ -0,0 +1,3 @@
+-- JSONPath to the records in wrapped source payloads, e.g. $.results
+-- (see etl.parsePath); NULL reads the top-level array or object
+ALTER TABLE table_metadata ADD COLUMN records_path TEXT;
@@ -0,0 +1 @@
+ALTER TABLE refresh_logs DROP COLUMN details;
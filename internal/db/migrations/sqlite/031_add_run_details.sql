@@ -0,0 +1,3 @@
+-- Stage timings, row counts, warnings and source requests of each
+-- refresh run (etl.RunDetail), served by GET /runs/:id
+ALTER TABLE refresh_logs ADD COLUMN details BLOB;
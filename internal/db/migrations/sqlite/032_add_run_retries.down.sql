@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_refresh_logs_retry_of;
+ALTER TABLE refresh_logs DROP COLUMN retry_of;
+ALTER TABLE refresh_logs DROP COLUMN params;
@@ -0,0 +1,6 @@
+-- The sources a run fetched, with placeholders and watermark filled in,
+-- so POST /runs/:id/retry can replay them; and the run a retry retries
+ALTER TABLE refresh_logs ADD COLUMN params BLOB;
+ALTER TABLE refresh_logs ADD COLUMN retry_of INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_logs_retry_of ON refresh_logs (retry_of);
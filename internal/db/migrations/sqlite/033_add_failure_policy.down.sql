@@ -0,0 +1,5 @@
+ALTER TABLE table_metadata DROP COLUMN refresh_paused_at;
+ALTER TABLE table_metadata DROP COLUMN consecutive_failures;
+ALTER TABLE table_metadata DROP COLUMN failure_backoff;
+ALTER TABLE table_metadata DROP COLUMN failure_action;
+ALTER TABLE table_metadata DROP COLUMN failure_threshold;
@@ -0,0 +1,8 @@
+-- Failure escalation: after failure_threshold refreshes fail in a row the
+-- scheduler applies failure_action (retry, backoff to failure_backoff
+-- seconds, pause, or page); refresh_paused_at is set while auto-paused
+ALTER TABLE table_metadata ADD COLUMN failure_threshold INTEGER;
+ALTER TABLE table_metadata ADD COLUMN failure_action TEXT NOT NULL DEFAULT 'retry';
+ALTER TABLE table_metadata ADD COLUMN failure_backoff INTEGER;
+ALTER TABLE table_metadata ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE table_metadata ADD COLUMN refresh_paused_at TIMESTAMP;
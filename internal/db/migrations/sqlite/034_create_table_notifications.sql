@@ -0,0 +1,14 @@
+-- Notification routes: a table's events of at least min_severity are
+-- POSTed to target (a webhook URL) or, for target 'log', logged
+CREATE TABLE IF NOT EXISTS table_notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL,
+    target TEXT NOT NULL,              -- http(s) webhook URL or 'log'
+    min_severity TEXT NOT NULL,        -- info, warning, error or critical
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_sent_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_table_notifications_table_name ON table_notifications (table_name);
@@ -0,0 +1,18 @@
+-- Refresh runs waiting for, or held by, a scheduler worker. Ticks, queued
+-- manual refreshes and queued retries are stored here so they survive a
+-- restart; a row is deleted once its run is logged in refresh_logs.
+CREATE TABLE IF NOT EXISTS job_queue (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT NOT NULL,
+    kind TEXT NOT NULL,                -- scheduled, manual or retry
+    params BLOB,                       -- retry: the sources to fetch
+    retry_of INTEGER,                  -- retry: the failed refresh_logs run
+    scheduled_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_by TEXT,                    -- instance running it; NULL = waiting
+    locked_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_scheduled_at ON job_queue (scheduled_at);
+CREATE INDEX IF NOT EXISTS idx_job_queue_table_name ON job_queue (table_name);
@@ -0,0 +1 @@
+ALTER TABLE table_metadata DROP COLUMN allowed_values;
@@ -0,0 +1,3 @@
+-- Enum-like columns: JSON object of column name to the list of values it
+-- may hold; ingest and refreshes reject rows with other values
+ALTER TABLE table_metadata ADD COLUMN allowed_values BLOB;
@@ -0,0 +1,2 @@
+ALTER TABLE table_metadata DROP COLUMN managed_key_type;
+ALTER TABLE table_metadata DROP COLUMN managed_key;
@@ -0,0 +1,2 @@
+ALTER TABLE table_metadata DROP COLUMN soft_delete_grace;
+ALTER TABLE table_metadata DROP COLUMN soft_delete;
@@ -0,0 +1,5 @@
+-- Soft delete: row deletes stamp _deleted_at instead of removing rows,
+-- queries skip stamped rows, and rows stamped more than soft_delete_grace
+-- seconds ago are purged (NULL = kept until deleted by hand)
+ALTER TABLE table_metadata ADD COLUMN soft_delete BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE table_metadata ADD COLUMN soft_delete_grace INTEGER;
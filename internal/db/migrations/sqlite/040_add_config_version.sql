@@ -0,0 +1,3 @@
+-- Optimistic concurrency: bumped by every configuration write (PUT
+-- /tables/{name}/config and /quota, not refreshes); served as the ETag
+ALTER TABLE table_metadata ADD COLUMN config_version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1 @@
+ALTER TABLE cdc_outbox DROP COLUMN dead_at;
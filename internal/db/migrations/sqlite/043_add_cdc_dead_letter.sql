@@ -0,0 +1,3 @@
+-- Outbox batches the relay gave up on (too many failed attempts or a
+-- permanent error) are kept with dead_at set and skipped until retried
+ALTER TABLE cdc_outbox ADD COLUMN dead_at TIMESTAMP;
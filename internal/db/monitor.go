@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Monitor watches the primary connection. While the database answers it
+// pings every interval; once a ping fails it marks the connection degraded
+// and retries with exponential backoff until the database is back.
+// database/sql drops broken connections on its own, so a successful ping
+// means the pool has reconnected.
+type Monitor struct {
+	db         *sqlx.DB
+	interval   time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu        sync.RWMutex
+	healthy   bool
+	downSince time.Time
+	lastErr   error
+	attempts  int
+}
+
+// HealthStatus is a snapshot of the monitor's view of the database
+type HealthStatus struct {
+	Healthy   bool       `json:"healthy"`
+	DownSince *time.Time `json:"down_since,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Attempts  int        `json:"reconnect_attempts,omitempty"`
+}
+
+// NewMonitor creates a monitor for db; it starts out healthy since Connect pinged already
+func NewMonitor(db *sqlx.DB) *Monitor {
+	return &Monitor{
+		db:         db,
+		interval:   5 * time.Second,
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		healthy:    true,
+	}
+}
+
+// Healthy reports whether the last ping succeeded
+func (m *Monitor) Healthy() bool {
+	if m == nil {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.healthy
+}
+
+// Status returns the current health snapshot
+func (m *Monitor) Status() HealthStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	st := HealthStatus{Healthy: m.healthy, Attempts: m.attempts}
+	if !m.healthy {
+		since := m.downSince
+		st.DownSince = &since
+		if m.lastErr != nil {
+			st.LastError = m.lastErr.Error()
+		}
+	}
+	return st
+}
+
+// Start runs the ping loop until ctx is cancelled
+func (m *Monitor) Start(ctx context.Context) {
+	backoff := m.minBackoff
+	wait := m.interval
+
+	for {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+
+		if m.ping(ctx) {
+			backoff = m.minBackoff
+			wait = m.interval
+			continue
+		}
+
+		wait = backoff
+		backoff *= 2
+		if backoff > m.maxBackoff {
+			backoff = m.maxBackoff
+		}
+	}
+}
+
+// ping checks the database once and records state transitions
+func (m *Monitor) ping(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	err := m.db.PingContext(pingCtx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		if !m.healthy {
+			log.Printf("[db] database connection restored after %s (%d attempts)",
+				time.Since(m.downSince).Round(time.Second), m.attempts)
+		}
+		m.healthy = true
+		m.lastErr = nil
+		m.attempts = 0
+		return true
+	}
+
+	if ctx.Err() != nil {
+		// shutting down, not an outage
+		return false
+	}
+	if m.healthy {
+		log.Printf("[db] database unreachable, entering degraded mode: %v", err)
+		m.healthy = false
+		m.downSince = time.Now()
+	}
+	m.lastErr = err
+	m.attempts++
+	return false
+}
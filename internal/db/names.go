@@ -0,0 +1,128 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultSchema is where unqualified table names live on Postgres
+const DefaultSchema = "public"
+
+var identifierRE = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// TableName is a user table reference, optionally schema-qualified
+// ("sales" or "analytics.sales"). The qualified string is what gets
+// stored in table_metadata.table_name.
+type TableName struct {
+	Schema string // empty = DefaultSchema
+	Name   string
+}
+
+// ParseTableName validates and splits a "table" or "schema.table" reference
+func ParseTableName(s string) (TableName, error) {
+	if s == "" {
+		return TableName{}, errors.New("empty identifier")
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 2 {
+		return TableName{}, fmt.Errorf("%q has too many parts (expected table or schema.table)", s)
+	}
+	for _, p := range parts {
+		if !identifierRE.MatchString(p) {
+			return TableName{}, errors.New("identifier contains invalid characters (allowed: A-Z a-z 0-9 _, one '.' for schema)")
+		}
+	}
+
+	if len(parts) == 2 {
+		return TableName{Schema: parts[0], Name: parts[1]}, nil
+	}
+	return TableName{Name: parts[0]}, nil
+}
+
+// SchemaOrDefault returns the schema to use in catalog lookups
+func (t TableName) SchemaOrDefault() string {
+	if t.Schema == "" {
+		return DefaultSchema
+	}
+	return t.Schema
+}
+
+// String returns the reference as the user wrote it (and as stored in metadata)
+func (t TableName) String() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// Quoted returns the reference with each part double-quoted for use in SQL
+func (t TableName) Quoted() string {
+	if t.Schema == "" {
+		return `"` + t.Name + `"`
+	}
+	return `"` + t.Schema + `"."` + t.Name + `"`
+}
+
+// ValidIdentifier reports whether s can name a column or schema: letters,
+// digits and underscores only
+func ValidIdentifier(s string) bool {
+	return identifierRE.MatchString(s)
+}
+
+// columnTypes are the column types tables may be created with
+var columnTypes = []string{
+	"smallint", "integer", "int", "int2", "int4", "int8", "bigint",
+	"smallserial", "serial", "bigserial",
+	"real", "float", "float4", "float8", "double precision", "numeric", "decimal",
+	"text", "varchar", "character varying", "char", "character",
+	"boolean", "bool",
+	"date", "time", "timetz", "timestamp", "timestamptz",
+	"timestamp with time zone", "timestamp without time zone", "interval",
+	"json", "jsonb", "uuid", "bytea", "blob",
+	"geometry", "geography",
+}
+
+// columnDefRE matches an allowed type with optional modifiers such as
+// (10,2) or (Point,4326), an optional [] and column constraints that take
+// no expressions
+var columnDefRE = regexp.MustCompile(`(?i)^(` + strings.Join(columnTypes, "|") + `)` +
+	`(\s*\(\s*[a-z0-9]+(\s*,\s*[0-9]+)?\s*\))?(\[\])?` +
+	`(\s+(primary key|not null|null|unique))*$`)
+
+// CheckColumnDef validates a column definition from a create request
+// ("TEXT", "NUMERIC(10,2)", "SERIAL PRIMARY KEY", "geometry(Point,4326)")
+// so it can be written into CREATE TABLE as is
+func CheckColumnDef(def string) error {
+	if !columnDefRE.MatchString(strings.Join(strings.Fields(def), " ")) {
+		return fmt.Errorf("unsupported column type %q", def)
+	}
+	return nil
+}
+
+// QuoteIdent double-quotes a column or other identifier for use in SQL
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteTable quotes each part of a "table" or "schema.table" reference
+// for use in SQL; unlike Quoted it needs no parsed TableName
+func QuoteTable(s string) string {
+	parts := strings.Split(s, ".")
+	for i, p := range parts {
+		parts[i] = QuoteIdent(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// CheckSchemaSupport rejects schema-qualified names on backends without schemas
+func CheckSchemaSupport(db *sqlx.DB, t TableName) error {
+	if t.Schema != "" && DialectOf(db) == SQLite {
+		return fmt.Errorf("schema-qualified table %q is not supported on SQLite", t.String())
+	}
+	return nil
+}
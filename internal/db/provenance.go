@@ -0,0 +1,62 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Managed provenance columns, added to tables created with provenance enabled
+const (
+	IngestedAtColumn = "_ingested_at"
+	SourceColumn     = "_source"
+	BatchIDColumn    = "_batch_id"
+)
+
+// ProvenanceColumnDefs are the column definitions appended to CREATE TABLE
+var ProvenanceColumnDefs = []string{
+	IngestedAtColumn + " TIMESTAMP",
+	SourceColumn + " TEXT",
+	BatchIDColumn + " TEXT",
+}
+
+// IsProvenanceColumn reports whether name is one of the managed columns
+func IsProvenanceColumn(name string) bool {
+	return name == IngestedAtColumn || name == SourceColumn || name == BatchIDColumn
+}
+
+// HasProvenance reports whether cols include the managed provenance columns.
+// A table opts in by having _batch_id; the other two are set alongside it.
+func HasProvenance(cols []Column) bool {
+	for _, c := range cols {
+		if c.ColumnName == BatchIDColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// Provenance identifies one load into a table: every row it writes is
+// stamped with the same source, batch id and ingest time.
+type Provenance struct {
+	Source     string
+	BatchID    string
+	IngestedAt time.Time
+}
+
+// NewProvenance starts a batch from source with a fresh random batch id
+func NewProvenance(source string) Provenance {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return Provenance{Source: source, BatchID: hex.EncodeToString(b), IngestedAt: time.Now().UTC()}
+}
+
+// Stamp sets the provenance columns on every row, replacing any values
+// the payload carried for them
+func (p Provenance) Stamp(rows []map[string]interface{}) {
+	for _, row := range rows {
+		row[IngestedAtColumn] = p.IngestedAt
+		row[SourceColumn] = p.Source
+		row[BatchIDColumn] = p.BatchID
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReadRouter hands out the connection read-only endpoints should use:
+// the replica while it answers pings, otherwise the primary.
+type ReadRouter struct {
+	primary  *sqlx.DB
+	replica  *sqlx.DB
+	healthy  atomic.Bool
+	interval time.Duration
+}
+
+// NewReadRouter wraps a primary and an optional replica (nil = primary only)
+func NewReadRouter(primary, replica *sqlx.DB) *ReadRouter {
+	r := &ReadRouter{
+		primary:  primary,
+		replica:  replica,
+		interval: 10 * time.Second,
+	}
+	if replica != nil {
+		r.healthy.Store(replica.Ping() == nil)
+	}
+	return r
+}
+
+// ConnectReplica opens a read replica without requiring it to be up yet;
+// the router's health checks decide when it is used.
+func ConnectReplica(dbURL, driver string, pool PoolConfig) (*sqlx.DB, error) {
+	driverName, err := sqlDriverName(driver)
+	if err != nil {
+		return nil, fmt.Errorf("replica open failed: %w", err)
+	}
+
+	replica, err := sqlx.Open(driverName, dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("replica open failed: %w", err)
+	}
+	pool.apply(replica)
+	return replica, nil
+}
+
+// Reader returns the connection to use for read-only queries
+func (r *ReadRouter) Reader() *sqlx.DB {
+	if r.replica != nil && r.healthy.Load() {
+		return r.replica
+	}
+	return r.primary
+}
+
+// Primary returns the writable connection
+func (r *ReadRouter) Primary() *sqlx.DB {
+	return r.primary
+}
+
+// ReplicaHealthy reports whether reads are currently served by the replica
+func (r *ReadRouter) ReplicaHealthy() bool {
+	return r.replica != nil && r.healthy.Load()
+}
+
+// HasReplica reports whether a replica is configured at all
+func (r *ReadRouter) HasReplica() bool {
+	return r.replica != nil
+}
+
+// Start pings the replica periodically and flips routing on state changes
+func (r *ReadRouter) Start(ctx context.Context) {
+	if r.replica == nil {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *ReadRouter) check(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.replica.PingContext(pingCtx)
+	was := r.healthy.Swap(err == nil)
+
+	switch {
+	case was && err != nil:
+		log.Printf("[db] read replica unavailable, falling back to primary: %v", err)
+	case !was && err == nil:
+		log.Println("[db] read replica back online, routing reads to replica")
+	}
+}
+
+// Close closes the replica connection (the primary is owned by the caller)
+func (r *ReadRouter) Close() error {
+	if r.replica == nil {
+		return nil
+	}
+	return r.replica.Close()
+}
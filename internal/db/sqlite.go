@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is registered as a thin wrapper around go-sqlite3 that accepts
+// Postgres-style $N placeholders, so the same query strings work on both backends.
+const sqliteDriver = "sqlite"
+
+func init() {
+	sql.Register(sqliteDriver, &pgCompatDriver{base: &sqlite3.SQLiteDriver{}})
+	sqlx.BindDriver(sqliteDriver, sqlx.DOLLAR)
+}
+
+type pgCompatDriver struct {
+	base *sqlite3.SQLiteDriver
+}
+
+func (d *pgCompatDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.base.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &pgCompatConn{SQLiteConn: conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// pgCompatConn rewrites placeholders before handing queries to SQLite.
+// Everything else (transactions, ping, close) is the embedded connection's.
+type pgCompatConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *pgCompatConn) Prepare(query string) (driver.Stmt, error) {
+	return c.SQLiteConn.Prepare(rewritePlaceholders(query))
+}
+
+func (c *pgCompatConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.SQLiteConn.PrepareContext(ctx, rewritePlaceholders(query))
+}
+
+func (c *pgCompatConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return c.SQLiteConn.Exec(rewritePlaceholders(query), args)
+}
+
+func (c *pgCompatConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.SQLiteConn.ExecContext(ctx, rewritePlaceholders(query), args)
+}
+
+func (c *pgCompatConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	return c.SQLiteConn.Query(rewritePlaceholders(query), args)
+}
+
+func (c *pgCompatConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.SQLiteConn.QueryContext(ctx, rewritePlaceholders(query), args)
+}
+
+// rewritePlaceholders turns $1, $2 ... into SQLite's numbered ?1, ?2 ...
+// SQLite treats "$1" as a named parameter bound in order of appearance,
+// which breaks queries that reference parameters out of order or twice.
+// Quoted strings, quoted identifiers and comments are left untouched.
+func rewritePlaceholders(query string) string {
+	if !strings.Contains(query, "$") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			// copy through to the matching quote (doubled quotes stay inside)
+			j := i + 1
+			for j < len(query) {
+				if query[j] == ch {
+					if j+1 < len(query) && query[j+1] == ch {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			end := j + 1
+			if end > len(query) {
+				end = len(query)
+			}
+			b.WriteString(query[i:end])
+			i = end - 1
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j])
+			i += j - 1
+		case ch == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			b.WriteByte('?')
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package etl
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AllowedValues makes columns enum-like: each listed column may only hold
+// one of its values (stored in table_metadata.allowed_values). Nulls are
+// left to the column's own constraints.
+type AllowedValues map[string][]interface{}
+
+// ParseAllowedValues decodes stored or submitted allowed values; an empty
+// document means none
+func ParseAllowedValues(raw []byte) (AllowedValues, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var a AllowedValues
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, fmt.Errorf("allowed_values must map columns to lists of values: %w", err)
+	}
+	return a, nil
+}
+
+// Check validates a against a table's column types: every column exists
+// and lists at least one single value
+func (a AllowedValues) Check(colTypes map[string]string) error {
+	for _, col := range a.Columns() {
+		if _, ok := colTypes[col]; !ok {
+			return fmt.Errorf("allowed_values: unknown column %s", col)
+		}
+		if len(a[col]) == 0 {
+			return fmt.Errorf("allowed_values: column %s needs at least one value", col)
+		}
+		for _, v := range a[col] {
+			switch v.(type) {
+			case nil, map[string]interface{}, []interface{}:
+				return fmt.Errorf("allowed_values: column %s lists %v; values must be strings, numbers or booleans", col, v)
+			}
+		}
+	}
+	return nil
+}
+
+// Columns lists the restricted columns, sorted
+func (a AllowedValues) Columns() []string {
+	cols := make([]string, 0, len(a))
+	for col := range a {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// Violation finds a value of row outside its column's allowed values and
+// returns the column with the reason (which doesn't name the column)
+func (a AllowedValues) Violation(row map[string]interface{}) (string, error) {
+	for _, col := range a.Columns() {
+		v, ok := row[col]
+		if !ok || v == nil {
+			continue
+		}
+		if !a.allows(col, v) {
+			return col, fmt.Errorf("%v is not one of the allowed values", v)
+		}
+	}
+	return "", nil
+}
+
+func (a AllowedValues) allows(col string, v interface{}) bool {
+	key := valueKey(v)
+	for _, allowed := range a[col] {
+		if valueKey(allowed) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// valueKey renders a raw or coerced value so that equal values compare
+// equal whatever their Go type (json.Number 1, float64 1, int64 1, "1")
+func valueKey(v interface{}) string {
+	switch t := v.(type) {
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return t.String()
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64)
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return t
+	}
+	return fmt.Sprint(v)
+}
+
+// LoadAllowedValues reads the allowed values of table; nil when it has
+// none or isn't registered
+func LoadAllowedValues(q sqlx.Queryer, table string) (AllowedValues, error) {
+	var raw []byte
+	err := sqlx.Get(q, &raw, `SELECT allowed_values FROM table_metadata WHERE table_name = $1`, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("allowed values lookup failed: %w", err)
+	}
+	return ParseAllowedValues(raw)
+}
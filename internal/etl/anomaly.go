@@ -0,0 +1,79 @@
+package etl
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// anomalyWindow is how many recent refreshes form the volume baseline
+const anomalyWindow = 20
+
+// AnomalyConfig tunes ingest volume anomaly detection.
+type AnomalyConfig struct {
+	Factor     float64 // flag refreshes inserting this many times the baseline; 0 = off
+	MinHistory int     // successful refreshes needed before a baseline is trusted
+}
+
+// CheckVolume compares the rows a refresh inserted with the median of the
+// table's recent successful refreshes (skipped unchanged-source runs don't
+// count). It returns a warning when the run loaded nothing against a
+// non-empty baseline, or more than Factor times the baseline, and ""
+// otherwise. Call it before logging the current run.
+func (e *ETLProcessor) CheckVolume(table string, inserted int) (string, error) {
+	if e.AnomalyFactor <= 0 {
+		return "", nil
+	}
+
+	var history []int
+	err := e.DB.Select(&history, `
+		SELECT rows_inserted FROM refresh_logs
+		WHERE table_name = $1 AND status IN ('OK', 'WARN') AND rows_inserted IS NOT NULL
+		AND message NOT LIKE $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3`, table, unchangedPrefix+"%", anomalyWindow)
+	if err != nil {
+		return "", fmt.Errorf("failed to load refresh history: %w", err)
+	}
+	if len(history) == 0 || len(history) < e.AnomalyMinHistory {
+		return "", nil
+	}
+
+	baseline := median(history)
+	switch {
+	case baseline == 0:
+		return "", nil
+	case inserted == 0:
+		return fmt.Sprintf("volume anomaly: 0 rows inserted, baseline is %.0f rows per refresh", baseline), nil
+	case float64(inserted) > e.AnomalyFactor*baseline:
+		return fmt.Sprintf("volume anomaly: %d rows inserted, %.1fx the baseline of %.0f", inserted, float64(inserted)/baseline, baseline), nil
+	}
+	return "", nil
+}
+
+func median(values []int) float64 {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return float64(sorted[mid])
+	}
+	return float64(sorted[mid-1]+sorted[mid]) / 2
+}
+
+// SuccessStatus returns the refresh_logs status and message for a
+// successful run: "OK", or "WARN" with the warning appended when the
+// inserted volume is anomalous. Unchanged-source runs are always OK.
+func (e *ETLProcessor) SuccessStatus(table string, r RefreshResult) (status, message, warning string) {
+	if r.Unchanged {
+		return "OK", r.Message(), ""
+	}
+	warning, err := e.CheckVolume(table, r.Inserted)
+	if err != nil {
+		log.Printf("[etl] %s volume check skipped: %v", table, err)
+	}
+	if warning == "" {
+		return "OK", r.Message(), ""
+	}
+	return "WARN", r.Message() + "; " + warning, warning
+}
@@ -0,0 +1,111 @@
+package etl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// SourceValidators identify the version of a table's source loaded by the
+// last successful refresh: HTTP cache validators when the source sends
+// them, otherwise a SHA-256 of the payload.
+type SourceValidators struct {
+	ETag         string
+	LastModified string
+	Checksum     string
+}
+
+// conditional carries validators into a fetch and the source's answer back out
+type conditional struct {
+	prev      SourceValidators // sent as If-None-Match / If-Modified-Since
+	next      SourceValidators // taken from a 2xx response
+	unchanged string           // non-empty when the source has nothing new, with the reason
+}
+
+func (c *conditional) apply(req *http.Request) {
+	if c.prev.ETag != "" {
+		req.Header.Set("If-None-Match", c.prev.ETag)
+	}
+	if c.prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", c.prev.LastModified)
+	}
+}
+
+func (c *conditional) record(resp *http.Response) {
+	c.next = SourceValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// needsChecksum reports whether the response lacks cache validators,
+// so the payload has to be hashed to detect an unchanged source
+func (c *conditional) needsChecksum() bool {
+	return c.next.ETag == "" && c.next.LastModified == ""
+}
+
+// spool copies body to a temp file while hashing it. The caller reads the
+// returned file (positioned at the start) and must call cleanup.
+func spool(body io.Reader) (f *os.File, sum string, cleanup func(), err error) {
+	f, err = os.CreateTemp("", "godataflow-source-*.json")
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("spool source failed: %w", err)
+	}
+	cleanup = func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), body); err != nil {
+		cleanup()
+		return nil, "", nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("spool source failed: %w", err)
+	}
+	return f, hex.EncodeToString(h.Sum(nil)), cleanup, nil
+}
+
+// LoadValidators reads the validators stored for a table
+func (e *ETLProcessor) LoadValidators(table string) (SourceValidators, error) {
+	var row struct {
+		ETag         *string `db:"source_etag"`
+		LastModified *string `db:"source_last_modified"`
+		Checksum     *string `db:"source_checksum"`
+	}
+	err := e.DB.Get(&row, `SELECT source_etag, source_last_modified, source_checksum FROM table_metadata WHERE table_name = $1`, table)
+	if err != nil {
+		return SourceValidators{}, fmt.Errorf("load source validators failed: %w", err)
+	}
+	v := SourceValidators{}
+	if row.ETag != nil {
+		v.ETag = *row.ETag
+	}
+	if row.LastModified != nil {
+		v.LastModified = *row.LastModified
+	}
+	if row.Checksum != nil {
+		v.Checksum = *row.Checksum
+	}
+	return v, nil
+}
+
+// SaveValidators stores the validators from the latest successful fetch
+// (empty values clear them, e.g. when a source stops sending ETags)
+func (e *ETLProcessor) SaveValidators(table string, v SourceValidators) error {
+	_, err := e.DB.Exec(`UPDATE table_metadata SET source_etag = $1, source_last_modified = $2, source_checksum = $3 WHERE table_name = $4`,
+		nullIfEmpty(v.ETag), nullIfEmpty(v.LastModified), nullIfEmpty(v.Checksum), table)
+	return err
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,232 @@
+package etl
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// Schema drift kinds
+const (
+	FieldAdded   = "added"
+	FieldRemoved = "removed"
+	FieldRetyped = "retyped"
+)
+
+// SchemaChange is one difference between the fields of the latest source
+// payload and the schema observed on the previous refresh
+type SchemaChange struct {
+	Field      string    `db:"field" json:"field"`
+	Change     string    `db:"change" json:"change"`
+	OldType    *string   `db:"old_type" json:"old_type,omitempty"`
+	NewType    *string   `db:"new_type" json:"new_type,omitempty"`
+	Loaded     bool      `db:"loaded" json:"loaded"` // false: the table has no column for the field, so its values are dropped
+	DetectedAt time.Time `db:"detected_at" json:"detected_at"`
+}
+
+func (c SchemaChange) String() string {
+	switch c.Change {
+	case FieldAdded:
+		s := "+" + c.Field
+		if !c.Loaded {
+			s += " (not loaded)"
+		}
+		return s
+	case FieldRemoved:
+		return "-" + c.Field
+	}
+	return fmt.Sprintf("%s %s→%s", c.Field, *c.OldType, *c.NewType)
+}
+
+// describeDrift summarizes changes for refresh_logs and events
+func describeDrift(changes []SchemaChange) string {
+	parts := make([]string, len(changes))
+	for i, c := range changes {
+		parts[i] = c.String()
+	}
+	return "schema drift: " + strings.Join(parts, ", ")
+}
+
+// SourceSchema maps payload field names (after TransformPayload flattening)
+// to their JSON type: string, number, boolean, array, object or null.
+// A field seen only with null values has type null.
+type SourceSchema map[string]string
+
+// observe adds the fields of rows to s. Conflicting non-null types are
+// recorded as "mixed".
+func (s SourceSchema) observe(rows []map[string]interface{}) {
+	for _, row := range rows {
+		for k, v := range row {
+			t := jsonType(v)
+			switch prev, seen := s[k]; {
+			case !seen || prev == "null":
+				s[k] = t
+			case t != "null" && t != prev:
+				s[k] = "mixed"
+			}
+		}
+	}
+}
+
+// missingFrom lists the fields of s that columns lack, sorted; a load
+// ignores them
+func (s SourceSchema) missingFrom(columns []db.Column) []string {
+	have := map[string]bool{}
+	for _, c := range columns {
+		have[c.ColumnName] = true
+	}
+	missing := []string{}
+	for field := range s {
+		if !have[field] {
+			missing = append(missing, field)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case json.Number, float64, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// diffSchema lists the changes from prev to next, sorted by field. A field
+// that only came through as null keeps its previous type and is not retyped.
+// Incremental loads see only new rows, so a missing field is not reported
+// as removed.
+func diffSchema(prev, next SourceSchema, columns map[string]bool, incremental bool) []SchemaChange {
+	changes := []SchemaChange{}
+	for field, t := range next {
+		old, ok := prev[field]
+		nt := t
+		switch {
+		case !ok:
+			changes = append(changes, SchemaChange{Field: field, Change: FieldAdded, NewType: &nt, Loaded: columns[field]})
+		case t != "null" && old != "null" && t != old:
+			ot := old
+			changes = append(changes, SchemaChange{Field: field, Change: FieldRetyped, OldType: &ot, NewType: &nt, Loaded: columns[field]})
+		}
+	}
+	for field, t := range prev {
+		if _, ok := next[field]; !ok && !incremental {
+			ot := t
+			changes = append(changes, SchemaChange{Field: field, Change: FieldRemoved, OldType: &ot, Loaded: columns[field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// merged is s with null-only fields keeping their type from prev. With
+// incremental set, fields missing from s are carried over from prev.
+func (s SourceSchema) merged(prev SourceSchema, incremental bool) SourceSchema {
+	out := SourceSchema{}
+	if incremental {
+		for field, t := range prev {
+			out[field] = t
+		}
+	}
+	for field, t := range s {
+		if old, ok := prev[field]; ok && t == "null" {
+			t = old
+		}
+		out[field] = t
+	}
+	return out
+}
+
+// LoadSourceSchema reads the schema observed on the last successful refresh;
+// nil when none was recorded yet
+func (e *ETLProcessor) LoadSourceSchema(table string) (SourceSchema, error) {
+	var raw []byte
+	if err := e.DB.Get(&raw, `SELECT source_schema FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return nil, fmt.Errorf("load source schema failed: %w", err)
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var s SourceSchema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("decode source schema failed: %w", err)
+	}
+	return s, nil
+}
+
+// recordSchema compares observed with the stored schema, records any drift
+// in schema_changes and stores observed as the new baseline. The first
+// observation is stored without reporting drift, as is a field that was
+// only seen as null before getting its first value.
+func (e *ETLProcessor) recordSchema(table string, observed SourceSchema, columns []db.Column, incremental bool) ([]SchemaChange, error) {
+	prev, err := e.LoadSourceSchema(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []SchemaChange
+	if prev != nil {
+		known := map[string]bool{}
+		for _, c := range columns {
+			known[c.ColumnName] = true
+		}
+		changes = diffSchema(prev, observed, known, incremental)
+		observed = observed.merged(prev, incremental)
+		if len(changes) == 0 && maps.Equal(observed, prev) {
+			return nil, nil
+		}
+	}
+
+	raw, err := json.Marshal(observed)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := e.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for i := range changes {
+		changes[i].DetectedAt = now
+		c := changes[i]
+		_, err := tx.Exec(`
+			INSERT INTO schema_changes (table_name, field, change, old_type, new_type, loaded, detected_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			table, c.Field, c.Change, c.OldType, c.NewType, c.Loaded, c.DetectedAt)
+		if err != nil {
+			return nil, fmt.Errorf("record schema change failed: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE table_metadata SET source_schema = $1 WHERE table_name = $2`, raw, table); err != nil {
+		return nil, fmt.Errorf("save source schema failed: %w", err)
+	}
+	return changes, tx.Commit()
+}
+
+// SchemaChanges lists the recorded drift for table, newest first
+func (e *ETLProcessor) SchemaChanges(table string, limit int) ([]SchemaChange, error) {
+	changes := []SchemaChange{}
+	err := e.DB.Select(&changes, `
+		SELECT field, change, old_type, new_type, loaded, detected_at
+		FROM schema_changes
+		WHERE table_name = $1
+		ORDER BY detected_at DESC, id DESC
+		LIMIT $2`, table, limit)
+	return changes, err
+}
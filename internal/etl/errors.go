@@ -0,0 +1,73 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Failure codes stored in refresh_logs.error_code so dashboards can group
+// failures without parsing messages.
+const (
+	CodeUpstreamHTTP   = "UPSTREAM_HTTP"
+	CodeUpstreamSchema = "UPSTREAM_SCHEMA"
+	CodeValidation     = "VALIDATION"
+	CodeDBInsert       = "DB_INSERT"
+	CodeTimeout        = "TIMEOUT"
+	CodeExpectation    = "EXPECTATION" // rows loaded, but the table's expectations failed
+	CodeQuota          = "QUOTA"       // the table or its workspace is out of quota
+	CodeUnknown        = "UNKNOWN"
+)
+
+// ETLError tags an ETL failure with a classification code.
+type ETLError struct {
+	Code string
+	Err  error
+}
+
+func (e *ETLError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ETLError) Unwrap() error {
+	return e.Err
+}
+
+// classify wraps err with code, upgrading network timeouts to TIMEOUT.
+func classify(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if isTimeout(err) {
+		code = CodeTimeout
+	}
+	return &ETLError{Code: code, Err: err}
+}
+
+// ExpectationError fails a refresh whose loaded data broke the table's
+// expectation contract
+func ExpectationError(inserted int, violations []string) error {
+	return &ETLError{Code: CodeExpectation, Err: fmt.Errorf("Expectations failed after inserting %d rows: %s", inserted, strings.Join(violations, "; "))}
+}
+
+// ErrorCode returns the classification code carried by err (UNKNOWN if none).
+func ErrorCode(err error) string {
+	var etlErr *ETLError
+	if errors.As(err, &etlErr) {
+		return etlErr.Code
+	}
+	if isTimeout(err) {
+		return CodeTimeout
+	}
+	return CodeUnknown
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
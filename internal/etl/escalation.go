@@ -0,0 +1,69 @@
+package etl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Failure actions stored in table_metadata.failure_action: what the
+// scheduler does once a table's refreshes have failed failure_threshold
+// times in a row
+const (
+	FailureRetry   = "retry"   // keep refreshing every refresh_interval (default)
+	FailureBackoff = "backoff" // refresh every failure_backoff seconds instead
+	FailurePause   = "pause"   // stop scheduled refreshes until one succeeds
+	FailurePage    = "page"    // keep refreshing and publish job.escalated
+)
+
+// ValidFailureAction reports whether a can be stored in table_metadata.failure_action
+func ValidFailureAction(a string) bool {
+	return a == FailureRetry || a == FailureBackoff || a == FailurePause || a == FailurePage
+}
+
+// FailurePolicy is a table's failure escalation policy with its current
+// streak of failed refreshes
+type FailurePolicy struct {
+	Threshold *int   `db:"failure_threshold"` // nil = never escalate
+	Action    string `db:"failure_action"`
+	Backoff   *int   `db:"failure_backoff"` // seconds; backoff only
+	Failures  int    `db:"consecutive_failures"`
+}
+
+// Check validates a policy before it is stored: backoff needs an interval
+func (p FailurePolicy) Check() error {
+	if p.Threshold != nil && *p.Threshold < 1 {
+		return errors.New("failure_threshold must be at least 1")
+	}
+	if !ValidFailureAction(p.Action) {
+		return errors.New("failure_action must be retry, backoff, pause or page")
+	}
+	if p.Backoff != nil && *p.Backoff < 1 {
+		return errors.New("failure_backoff must be at least 1 second")
+	}
+	if p.Action == FailureBackoff && p.Backoff == nil {
+		return errors.New("failure_action backoff needs failure_backoff")
+	}
+	return nil
+}
+
+// Escalated reports whether the failure streak has reached the threshold
+func (p FailurePolicy) Escalated() bool {
+	return p.Threshold != nil && p.Failures >= *p.Threshold
+}
+
+// LoadFailurePolicy reads table's failure escalation policy and streak
+func (e *ETLProcessor) LoadFailurePolicy(table string) (FailurePolicy, error) {
+	var p FailurePolicy
+	err := e.DB.Get(&p, `SELECT failure_threshold, failure_action, failure_backoff, consecutive_failures FROM table_metadata WHERE table_name = $1`, table)
+	if err != nil {
+		return p, fmt.Errorf("failure policy lookup failed: %w", err)
+	}
+	return p, nil
+}
+
+// PauseRefreshes stops scheduled refreshes of table until a refresh
+// succeeds or its failures are reset
+func (e *ETLProcessor) PauseRefreshes(table string) error {
+	_, err := e.DB.Exec(`UPDATE table_metadata SET refresh_paused_at = CURRENT_TIMESTAMP WHERE table_name = $1`, table)
+	return err
+}
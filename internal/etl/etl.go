@@ -1,151 +1,364 @@
 package etl
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
 	"reflect"
-	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/alkha0306/godataflow/internal/cdc"
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/geo"
+	"github.com/alkha0306/godataflow/internal/quota"
 	"github.com/jmoiron/sqlx"
 )
 
 // ETLProcessor contains DB and helper methods for ETL.
 type ETLProcessor struct {
-	DB *sqlx.DB
+	DB               *sqlx.DB
+	Client           *http.Client
+	FetchTimeout     time.Duration // per source fetch, including the body; 0 = none
+	MaxResponseBytes int64         // 0 = unlimited
+	InsertBatchSize  int           // rows per multi-row INSERT
+	CopyThreshold    int           // batches at least this large use COPY on Postgres; 0 = never
+	ChunkSize        int           // rows decoded per streaming chunk in Refresh
+	PipelineDepth    int           // chunks buffered between Refresh stages
+
+	AnomalyFactor     float64 // see AnomalyConfig
+	AnomalyMinHistory int
+
+	CDC    *cdc.Outbox     // refreshed rows are queued here; nil = change capture off
+	Quotas *quota.Enforcer // refreshes stop at the table's row quota; nil = no quotas
+
+	running atomic.Int64 // RefreshSources calls going on
+}
+
+// Running counts the refreshes going on in this process, scheduled or not
+func (e *ETLProcessor) Running() int {
+	return int(e.running.Load())
+}
+
+// FetchConfig tunes how source URLs are fetched.
+type FetchConfig struct {
+	Client           *http.Client // shared client; nil = http.DefaultClient
+	Timeout          time.Duration
+	MaxResponseBytes int64
+}
+
+// InsertConfig tunes how validated rows are written.
+type InsertConfig struct {
+	BatchSize     int
+	CopyThreshold int
+	ChunkSize     int
+	PipelineDepth int
 }
 
 // NewETLProcessor creates an instance.
-func NewETLProcessor(db *sqlx.DB) *ETLProcessor {
-	return &ETLProcessor{DB: db}
+func NewETLProcessor(db *sqlx.DB, fetch FetchConfig, insert InsertConfig, anomaly AnomalyConfig) *ETLProcessor {
+	client := fetch.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &ETLProcessor{
+		DB:               db,
+		Client:           client,
+		FetchTimeout:     fetch.Timeout,
+		MaxResponseBytes: fetch.MaxResponseBytes,
+		InsertBatchSize:  insert.BatchSize,
+		CopyThreshold:    insert.CopyThreshold,
+		ChunkSize:        insert.ChunkSize,
+		PipelineDepth:    insert.PipelineDepth,
+
+		AnomalyFactor:     anomaly.Factor,
+		AnomalyMinHistory: anomaly.MinHistory,
+	}
 }
 
 // -----------------------------
 // FetchData
 // Fetches URL and returns a slice of row maps.
 // Supports either object or array JSON responses.
+// Buffers the whole response; Refresh streams it through the pipeline instead.
 // -----------------------------
 func (e *ETLProcessor) FetchData(url string) ([]map[string]interface{}, error) {
-	if url == "" {
-		return nil, errors.New("empty data source url")
-	}
-
-	resp, err := http.Get(url)
+	out := []map[string]interface{}{}
+	_, err := e.FetchStream(url, 1000, func(chunk []map[string]interface{}) error {
+		out = append(out, chunk...)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("http get failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		return nil, fmt.Errorf("http status %d: %s", resp.StatusCode, string(body))
-	}
-
-	decoder := json.NewDecoder(resp.Body)
-	decoder.UseNumber()
-
-	// Try to decode into either array or object
-	var raw interface{}
-	if err := decoder.Decode(&raw); err != nil {
-		return nil, fmt.Errorf("json decode failed: %w", err)
-	}
-
-	switch v := raw.(type) {
-	case []interface{}:
-		out := make([]map[string]interface{}, 0, len(v))
-		for _, item := range v {
-			if m, ok := item.(map[string]interface{}); ok {
-				out = append(out, m)
-			} else {
-				// try to convert scalars -> wrap in map?
-				return nil, errors.New("array items are not objects")
-			}
-		}
-		return out, nil
-	case map[string]interface{}:
-		return []map[string]interface{}{v}, nil
-	default:
-		return nil, errors.New("unexpected JSON type: expected object or array of objects")
+		return nil, err
 	}
+	return out, nil
 }
 
 // -----------------------------
 // ValidatePayload
 // Ensures incoming keys exist in table and tries to normalize values to appropriate Go types.
+// Values outside a column's allowed values fail the whole batch; rows
+// without a value for the table's managed key get a generated one.
 // Returns validated/normalized rows (may convert strings->numbers, parse timestamps, etc.)
 // -----------------------------
 func (e *ETLProcessor) ValidatePayload(tableName string, rows []map[string]interface{}) ([]map[string]interface{}, error) {
-	if err := sanitizeIdentifier(tableName); err != nil {
-		return nil, fmt.Errorf("invalid table name: %w", err)
+	valid, _, err := e.validateRows(tableName, rows, nil)
+	return valid, err
+}
+
+// validateRows is ValidatePayload also returning the position in rows of
+// each valid row. With reject set, a row that fails is passed to it and
+// left out instead of failing the batch.
+func (e *ETLProcessor) validateRows(tableName string, rows []map[string]interface{}, reject func(RowIssue)) ([]map[string]interface{}, []int, error) {
+	if _, err := e.parseTable(tableName); err != nil {
+		return nil, nil, classify(CodeValidation, fmt.Errorf("invalid table name: %w", err))
 	}
 	if len(rows) == 0 {
-		return nil, errors.New("no rows to validate")
+		return nil, nil, classify(CodeValidation, errors.New("no rows to validate"))
 	}
 
 	// Load column metadata
-	colQuery := `
-		SELECT column_name, data_type
-		FROM information_schema.columns
-		WHERE table_schema = 'public' AND table_name = $1
-	`
-	type colInfo struct {
-		ColumnName string `db:"column_name"`
-		DataType   string `db:"data_type"`
-	}
-	var cols []colInfo
-	if err := e.DB.Select(&cols, colQuery, tableName); err != nil {
-		return nil, fmt.Errorf("failed to load table columns: %w", err)
+	cols, err := db.TableColumns(e.DB, tableName)
+	if err != nil {
+		return nil, nil, classify(CodeValidation, fmt.Errorf("failed to load table columns: %w", err))
 	}
 
 	colTypeMap := map[string]string{}
 	for _, c := range cols {
 		colTypeMap[c.ColumnName] = strings.ToLower(c.DataType)
 	}
+	allowed, err := LoadAllowedValues(e.DB, tableName)
+	if err != nil {
+		return nil, nil, classify(CodeValidation, err)
+	}
+	key, err := db.LoadManagedKey(e.DB, tableName)
+	if err != nil {
+		return nil, nil, classify(CodeValidation, err)
+	}
 
 	// Validate and coerce
 	validated := make([]map[string]interface{}, 0, len(rows))
-	for _, r := range rows {
-		out := map[string]interface{}{}
-		for k, v := range r {
-			// Skip unknown columns (optionally you may choose to error instead)
-			colType, ok := colTypeMap[k]
-			if !ok {
-				// drop unknown column
-				continue
+	indexes := make([]int, 0, len(rows))
+	for i, r := range rows {
+		out, col, err := validateRow(colTypeMap, r)
+		if err == nil {
+			if col, err = allowed.Violation(out); err != nil {
+				err = fmt.Errorf("column %s: %w", col, err)
 			}
-
-			normalized, err := coerceValue(colType, v)
-			if err != nil {
-				return nil, fmt.Errorf("column %s: %w", k, err)
+		}
+		if err != nil {
+			if reject == nil {
+				return nil, nil, classify(CodeValidation, err)
 			}
-			out[k] = normalized
+			reject(RowIssue{Index: i, Column: col, Reason: err.Error()})
+			continue
 		}
 		if len(out) == 0 {
 			// nothing matched known columns
 			continue
 		}
+		key.Fill(out)
 		validated = append(validated, out)
+		indexes = append(indexes, i)
 	}
 
-	return validated, nil
+	return validated, indexes, nil
+}
+
+// validateRow coerces the values of r for the columns in colTypeMap,
+// dropping unknown columns. On failure it returns the offending column.
+func validateRow(colTypeMap map[string]string, r map[string]interface{}) (map[string]interface{}, string, error) {
+	out := map[string]interface{}{}
+	nested := map[string]map[string]interface{}{}
+	for k, v := range r {
+		colType, ok := colTypeMap[k]
+		if !ok {
+			// TransformPayload flattened an object meant for a JSON column
+			if col, key, ok := jsonParent(colTypeMap, r, k); ok {
+				if nested[col] == nil {
+					nested[col] = map[string]interface{}{}
+				}
+				nested[col][key] = v
+			}
+			// drop unknown column
+			continue
+		}
+		normalized, err := coerceValue(colType, v)
+		if err != nil {
+			return nil, k, fmt.Errorf("column %s: %w", k, err)
+		}
+		out[k] = normalized
+	}
+	for col, obj := range nested {
+		normalized, err := coerceValue(colTypeMap[col], obj)
+		if err != nil {
+			return nil, col, fmt.Errorf("column %s: %w", col, err)
+		}
+		out[col] = normalized
+	}
+	return out, "", nil
+}
+
+// isJSONType reports whether a column type holds JSON documents
+func isJSONType(dataType string) bool {
+	return strings.Contains(strings.ToLower(dataType), "json")
+}
+
+// jsonParent splits a field TransformPayload flattened ("payload.status")
+// into the JSON column it belongs to and its key in the object, provided
+// r has no value of its own for that column
+func jsonParent(colTypeMap map[string]string, r map[string]interface{}, field string) (string, string, bool) {
+	col, key, ok := strings.Cut(field, ".")
+	if !ok || !isJSONType(colTypeMap[col]) {
+		return "", "", false
+	}
+	if _, own := r[col]; own {
+		return "", "", false
+	}
+	return col, key, true
+}
+
+// unfit finds a coerced value the database would still refuse: text
+// that is not a number for a numeric column or not a boolean for a
+// boolean column, or a fraction for an integer column
+func unfit(colTypeMap map[string]string, row map[string]interface{}) (string, error) {
+	for k, v := range row {
+		dataType := colTypeMap[k]
+		switch v := v.(type) {
+		case bool:
+			if isNumericType(dataType) {
+				return k, fmt.Errorf("column %s: expected a number, got %t", k, v)
+			}
+		case int64, int, int32:
+			if strings.Contains(dataType, "bool") {
+				return k, fmt.Errorf("column %s: expected true or false, got %v", k, v)
+			}
+		case float64:
+			if strings.Contains(dataType, "int") && !strings.Contains(dataType, "interval") && v != math.Trunc(v) {
+				return k, fmt.Errorf("column %s: expected an integer, got %v", k, v)
+			}
+			if strings.Contains(dataType, "bool") {
+				return k, fmt.Errorf("column %s: expected true or false, got %v", k, v)
+			}
+		case string:
+			// exact decimals and integers beyond int64 stay text
+			if _, ok := exactNumber(dataType, v); isNumericType(dataType) && !ok {
+				return k, fmt.Errorf("column %s: expected a number, got %q", k, v)
+			}
+			if strings.Contains(dataType, "bool") {
+				return k, fmt.Errorf("column %s: expected true or false, got %q", k, v)
+			}
+		}
+	}
+	return "", nil
+}
+
+// isNumericType reports whether a column type holds numbers
+func isNumericType(dataType string) bool {
+	if strings.Contains(dataType, "int") && !strings.Contains(dataType, "interval") {
+		return true
+	}
+	for _, t := range []string{"double", "numeric", "decimal", "real", "float", "serial"} {
+		if strings.Contains(dataType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// PayloadCheck is what a load would make of a payload, from CheckPayload
+type PayloadCheck struct {
+	Rows     []map[string]interface{} // transformed and coerced, as they would be inserted
+	Indexes  []int                    // position of each of Rows in the payload
+	Rejected []RowIssue
+	Dropped  []string // payload columns the table lacks, sorted
+}
+
+// RowIssue is why a payload row would not be loaded. Column is empty when
+// the row as a whole is at fault.
+type RowIssue struct {
+	Index  int    `json:"index"`
+	Column string `json:"column,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// CheckPayload runs TransformPayload and the checks of ValidatePayload on
+// rows one by one without loading anything, so one bad row doesn't hide
+// the verdict on the others
+func (e *ETLProcessor) CheckPayload(tableName string, rows []map[string]interface{}) (PayloadCheck, error) {
+	var check PayloadCheck
+	if _, err := e.parseTable(tableName); err != nil {
+		return check, classify(CodeValidation, fmt.Errorf("invalid table name: %w", err))
+	}
+	cols, err := db.TableColumns(e.DB, tableName)
+	if err != nil {
+		return check, classify(CodeValidation, fmt.Errorf("failed to load table columns: %w", err))
+	}
+	colTypeMap := map[string]string{}
+	for _, c := range cols {
+		colTypeMap[c.ColumnName] = strings.ToLower(c.DataType)
+	}
+	allowed, err := LoadAllowedValues(e.DB, tableName)
+	if err != nil {
+		return check, classify(CodeValidation, err)
+	}
+
+	dropped := map[string]bool{}
+	for i, r := range e.TransformPayload(rows) {
+		for k := range r {
+			if _, ok := colTypeMap[k]; !ok {
+				if _, _, nested := jsonParent(colTypeMap, r, k); !nested {
+					dropped[k] = true
+				}
+			}
+		}
+		out, col, err := validateRow(colTypeMap, r)
+		if err == nil {
+			col, err = unfit(colTypeMap, out)
+		}
+		if err == nil {
+			if col, err = allowed.Violation(out); err != nil {
+				err = fmt.Errorf("column %s: %w", col, err)
+			}
+		}
+		switch {
+		case err != nil:
+			check.Rejected = append(check.Rejected, RowIssue{Index: i, Column: col, Reason: err.Error()})
+		case len(out) == 0:
+			check.Rejected = append(check.Rejected, RowIssue{Index: i, Reason: "no column of the row is in the table"})
+		default:
+			check.Rows = append(check.Rows, out)
+			check.Indexes = append(check.Indexes, i)
+		}
+	}
+	for col := range dropped {
+		check.Dropped = append(check.Dropped, col)
+	}
+	sort.Strings(check.Dropped)
+	return check, nil
 }
 
 // coerceValue attempts to convert an arbitrary interface{} to a DB-friendly Go type based on dataType
 func coerceValue(dataType string, val interface{}) (interface{}, error) {
-	// handle json.Number -> decide numeric type
+	// PostGIS columns take GeoJSON, WKT or EWKT, written as EWKT
+	if geo.IsSpatialType(dataType) && val != nil {
+		return geo.ToEWKT(val)
+	}
+	if isJSONType(dataType) && val != nil {
+		return jsonDocument(val)
+	}
+	if db.IsArrayType(dataType) && val != nil {
+		return arrayValue(dataType, val)
+	}
+
+	// handle json.Number -> decide numeric type, keeping exact digits
 	if jn, ok := val.(json.Number); ok {
-		// try integer first
-		if i64, err := jn.Int64(); err == nil {
-			return i64, nil
-		}
-		if f64, err := jn.Float64(); err == nil {
-			return f64, nil
-		}
-		return jn.String(), nil
+		return coerceNumber(dataType, jn), nil
 	}
 
 	switch v := val.(type) {
@@ -165,11 +378,23 @@ func coerceValue(dataType string, val interface{}) (interface{}, error) {
 		if strings.Contains(dataType, "timestamp") || strings.Contains(dataType, "date") {
 			// attempt several common formats
 			if t, err := tryParseTime(v); err == nil {
+				// TIMESTAMP without time zone drops any offset, so bind the
+				// instant in UTC
+				if strings.Contains(dataType, "timestamp") {
+					return t.UTC().Format(time.RFC3339Nano), nil
+				}
 				return t.Format(time.RFC3339), nil
 			}
 			// let DB attempt parsing if we can't parse
 			return v, nil
 		}
+		// Exact decimals keep their text; the database parses it exactly
+		if isDecimalType(dataType) {
+			if n, ok := exactNumber(dataType, v); ok {
+				return n, nil
+			}
+			return v, nil
+		}
 		// For numeric DB types, attempt parse
 		if strings.Contains(dataType, "int") {
 			if i, err := parseStringToInt(v); err == nil {
@@ -217,6 +442,57 @@ func parseStringToInt(s string) (int64, error) {
 	return i, nil
 }
 
+// jsonDocument encodes val as the JSON text of a json or jsonb column.
+// Strings holding a JSON object or array (e.g. from CSV) are kept as they
+// are; other strings become JSON strings.
+func jsonDocument(val interface{}) (interface{}, error) {
+	if s, ok := val.(string); ok {
+		trimmed := strings.TrimSpace(s)
+		if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+			return trimmed, nil
+		}
+	}
+	enc, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode JSON value: %w", err)
+	}
+	return string(enc), nil
+}
+
+// arrayValue converts a JSON array (or JSON array text) to a Postgres
+// array, coercing each element to the element type. Strings already in
+// array literal form ("{a,b}", e.g. from CSV) are passed through.
+func arrayValue(dataType string, val interface{}) (interface{}, error) {
+	if s, ok := val.(string); ok {
+		trimmed := strings.TrimSpace(s)
+		if strings.HasPrefix(trimmed, "{") {
+			return trimmed, nil
+		}
+		var list []interface{}
+		if err := json.Unmarshal([]byte(trimmed), &list); err != nil {
+			return nil, fmt.Errorf("expected an array, got %q", s)
+		}
+		val = list
+	}
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array, got %T", val)
+	}
+	elemType := db.ArrayElementType(dataType)
+	elems := make([]interface{}, len(list))
+	for i, v := range list {
+		if _, ok := v.(map[string]interface{}); ok && !isJSONType(elemType) {
+			return nil, fmt.Errorf("array element %d: expected a single value, got an object", i)
+		}
+		elem, err := coerceValue(elemType, v)
+		if err != nil {
+			return nil, fmt.Errorf("array element %d: %w", i, err)
+		}
+		elems[i] = elem
+	}
+	return db.Array(elems), nil
+}
+
 func parseStringToFloat(s string) (float64, error) {
 	s = strings.TrimSpace(s)
 	var f float64
@@ -246,6 +522,7 @@ func tryParseTime(s string) (time.Time, error) {
 // -----------------------------
 // TransformPayload
 // - Flatten simple nested maps (one-level) using dot notation: {"a":{"b":1}} -> {"a.b":1}
+// - Keep GeoJSON geometries whole: they are values of geometry columns
 // - Convert any timestamp-like strings to RFC3339 strings
 // -----------------------------
 func (e *ETLProcessor) TransformPayload(rows []map[string]interface{}) []map[string]interface{} {
@@ -254,7 +531,7 @@ func (e *ETLProcessor) TransformPayload(rows []map[string]interface{}) []map[str
 		out := map[string]interface{}{}
 		for k, v := range r {
 			// if v is a map[string]interface{} flatten one level
-			if m, ok := v.(map[string]interface{}); ok {
+			if m, ok := v.(map[string]interface{}); ok && !geo.IsGeoJSON(m) {
 				for k2, v2 := range m {
 					out[fmt.Sprintf("%s.%s", k, k2)] = v2
 				}
@@ -270,20 +547,76 @@ func (e *ETLProcessor) TransformPayload(rows []map[string]interface{}) []map[str
 
 // -----------------------------
 // InsertRows
-// Insert rows into table (1-by-1 inside a transaction).
-// Uses parameterized queries to avoid SQL injection.
+// Insert rows into table: one COPY for large batches on Postgres,
+// otherwise multi-row INSERTs of InsertBatchSize rows in a single transaction.
+// Uses parameterized queries to avoid SQL injection. then, when not nil,
+// runs in that transaction after the rows are written (see Capture).
 // -----------------------------
-func (e *ETLProcessor) InsertRows(tableName string, rows []map[string]interface{}) (int, error) {
-	if err := sanitizeIdentifier(tableName); err != nil {
-		return 0, fmt.Errorf("invalid table name: %w", err)
+func (e *ETLProcessor) InsertRows(tableName string, rows []map[string]interface{}, then func(tx sqlx.Execer) error) (int, error) {
+	table, err := e.parseTable(tableName)
+	if err != nil {
+		return 0, classify(CodeValidation, fmt.Errorf("invalid table name: %w", err))
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	cols, values := rowMatrix(rows)
+
+	if e.CopyThreshold > 0 && len(rows) >= e.CopyThreshold && db.SupportsCopy(e.DB) {
+		n, err := db.CopyFrom(context.Background(), e.DB, table, cols, values, then)
+		if err != nil {
+			return 0, classify(CodeDBInsert, err)
+		}
+		return int(n), nil
+	}
+
+	return e.insertBatches(table, cols, values, then)
+}
+
+// BulkLoad writes rows like InsertRows but always uses COPY on Postgres,
+// whatever the batch size; SQLite falls back to multi-row INSERTs
+func (e *ETLProcessor) BulkLoad(tableName string, rows []map[string]interface{}, then func(tx sqlx.Execer) error) (int, error) {
+	table, err := e.parseTable(tableName)
+	if err != nil {
+		return 0, classify(CodeValidation, fmt.Errorf("invalid table name: %w", err))
 	}
 	if len(rows) == 0 {
 		return 0, nil
 	}
 
+	cols, values := rowMatrix(rows)
+	if db.SupportsCopy(e.DB) {
+		n, err := db.CopyFrom(context.Background(), e.DB, table, cols, values, then)
+		if err != nil {
+			return 0, classify(CodeDBInsert, err)
+		}
+		return int(n), nil
+	}
+	return e.insertBatches(table, cols, values, then)
+}
+
+// insertBatches writes rows as multi-row INSERT ... VALUES statements.
+// The batch size is capped so a statement never exceeds the driver's bind parameter limit.
+// The rows go in one transaction, so on error none are written and the count is 0.
+func (e *ETLProcessor) insertBatches(table db.TableName, cols []string, values [][]interface{}, then func(tx sqlx.Execer) error) (int, error) {
+	batchSize := e.InsertBatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	if maxRows := db.MaxBindParams(e.DB) / len(cols); batchSize > maxRows {
+		batchSize = maxRows
+	}
+
+	quotedCols := make([]string, len(cols))
+	for i, c := range cols {
+		quotedCols[i] = fmt.Sprintf("\"%s\"", c) // quote column names
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table.Quoted(), strings.Join(quotedCols, ", "))
+
 	tx, err := e.DB.Beginx()
 	if err != nil {
-		return 0, fmt.Errorf("begin tx failed: %w", err)
+		return 0, classify(CodeDBInsert, fmt.Errorf("begin tx failed: %w", err))
 	}
 	defer func() {
 		// if still active, rollback
@@ -291,34 +624,75 @@ func (e *ETLProcessor) InsertRows(tableName string, rows []map[string]interface{
 	}()
 
 	inserted := 0
-	for _, row := range rows {
-		cols := make([]string, 0, len(row))
-		placeholders := make([]string, 0, len(row))
-		values := make([]interface{}, 0, len(row))
-		i := 1
-		for k, v := range row {
-			cols = append(cols, fmt.Sprintf("\"%s\"", k)) // quote column names
-			placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-			values = append(values, v)
-			i++
+	for start := 0; start < len(values); start += batchSize {
+		end := start + batchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		batch := values[start:end]
+
+		tuples := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*len(cols))
+		for _, row := range batch {
+			placeholders := make([]string, len(row))
+			for j, v := range row {
+				args = append(args, v)
+				placeholders[j] = fmt.Sprintf("$%d", len(args))
+			}
+			tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
 		}
-		// keep column order stable by sorting? Not necessary but deterministic not guaranteed for map
-		// To make deterministic, build cols/values from slice rather than map iteration order
-		// For simplicity: we assume row map insertion order is acceptable for now.
 
-		query := fmt.Sprintf("INSERT INTO \"%s\" (%s) VALUES (%s)", tableName, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
-		if _, err := tx.Exec(query, values...); err != nil {
-			return inserted, fmt.Errorf("insert failed: %w", err)
+		if _, err := tx.Exec(prefix+strings.Join(tuples, ", "), args...); err != nil {
+			return 0, classify(CodeDBInsert, fmt.Errorf("insert failed (rows %d-%d): %w", start+1, end, err))
+		}
+		inserted += len(batch)
+	}
+	if then != nil {
+		if err := then(tx); err != nil {
+			return 0, classify(CodeDBInsert, err)
 		}
-		inserted++
 	}
 
 	if err := tx.Commit(); err != nil {
-		return inserted, fmt.Errorf("tx commit failed: %w", err)
+		return 0, classify(CodeDBInsert, fmt.Errorf("tx commit failed: %w", err))
 	}
 	return inserted, nil
 }
 
+// Capture returns the InsertRows / BulkLoad hook queueing rows of table
+// for change capture, so the outbox batch commits with the rows
+func (e *ETLProcessor) Capture(table, source string, rows []map[string]interface{}) func(tx sqlx.Execer) error {
+	return func(tx sqlx.Execer) error {
+		return e.CDC.Record(tx, table, source, rows)
+	}
+}
+
+// rowMatrix flattens row maps into a stable column list and value rows.
+// Columns are the union of all row keys (sorted); rows missing a key get NULL for it.
+func rowMatrix(rows []map[string]interface{}) ([]string, [][]interface{}) {
+	seen := map[string]bool{}
+	cols := []string{}
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	sort.Strings(cols)
+
+	values := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		vals := make([]interface{}, len(cols))
+		for i, c := range cols {
+			vals[i] = row[c]
+		}
+		values = append(values, vals)
+	}
+	return cols, values
+}
+
 // -----------------------------
 // WriteRefreshLog
 // -----------------------------
@@ -327,21 +701,42 @@ func (e *ETLProcessor) WriteRefreshLog(tableName, status, message string) error
 	return err
 }
 
+// -----------------------------
+// WriteRefreshLogRows
+// Same as WriteRefreshLog but also records how many rows the run inserted
+// -----------------------------
+func (e *ETLProcessor) WriteRefreshLogRows(tableName, status, message string, rows int) error {
+	_, err := e.DB.Exec(`INSERT INTO refresh_logs (table_name, status, message, rows_inserted) VALUES ($1, $2, $3, $4)`, tableName, status, message, rows)
+	return err
+}
+
+// -----------------------------
+// WriteRefreshLogError
+// Records a failed run together with its classification code
+// -----------------------------
+func (e *ETLProcessor) WriteRefreshLogError(tableName, message string, err error) error {
+	_, dbErr := e.DB.Exec(`INSERT INTO refresh_logs (table_name, status, message, error_code) VALUES ($1, 'ERROR', $2, $3)`, tableName, message, ErrorCode(err))
+	return dbErr
+}
+
 // -----------------------------
 // UpdateMetadataStatus
-// Updates last_refresh_success/_error and status column in table_metadata
+// Updates last_refresh_success/_error and status column in table_metadata,
+// and the consecutive failure count: a success resets it and lifts an
+// auto-pause
 // -----------------------------
 func (e *ETLProcessor) UpdateMetadataStatus(tableName, status string, errorMsg *string) error {
-	if err := sanitizeIdentifier(tableName); err != nil {
+	if _, err := db.ParseTableName(tableName); err != nil {
 		return fmt.Errorf("invalid table name: %w", err)
 	}
 
-	if status == "OK" {
-		_, err := e.DB.Exec(`UPDATE table_metadata SET last_refresh_success = NOW(), last_refresh_error = NULL, status = $1, updated_at = NOW() WHERE table_name = $2`, status, tableName)
+	// WARN runs succeeded too, with a volume anomaly
+	if status == "OK" || status == "WARN" {
+		_, err := e.DB.Exec(`UPDATE table_metadata SET last_refresh_success = CURRENT_TIMESTAMP, last_refresh_error = NULL, status = $1, consecutive_failures = 0, refresh_paused_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE table_name = $2`, status, tableName)
 		return err
 	}
 	// ERROR status
-	_, err := e.DB.Exec(`UPDATE table_metadata SET last_refresh_error = $1, status = $2, updated_at = NOW() WHERE table_name = $3`, errorMsg, status, tableName)
+	_, err := e.DB.Exec(`UPDATE table_metadata SET last_refresh_error = $1, status = $2, consecutive_failures = consecutive_failures + 1, updated_at = CURRENT_TIMESTAMP WHERE table_name = $3`, errorMsg, status, tableName)
 	return err
 }
 
@@ -349,15 +744,11 @@ func (e *ETLProcessor) UpdateMetadataStatus(tableName, status string, errorMsg *
 // Helpers
 // -----------------------------
 
-var identifierRE = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
-
-// sanitizeIdentifier ensures the table identifier only contains safe characters
-func sanitizeIdentifier(s string) error {
-	if s == "" {
-		return errors.New("empty identifier")
-	}
-	if !identifierRE.MatchString(s) {
-		return errors.New("identifier contains invalid characters (allowed: A-Z a-z 0-9 _)")
+// parseTable validates a (possibly schema-qualified) table identifier
+func (e *ETLProcessor) parseTable(s string) (db.TableName, error) {
+	t, err := db.ParseTableName(s)
+	if err != nil {
+		return t, err
 	}
-	return nil
+	return t, db.CheckSchemaSupport(e.DB, t)
 }
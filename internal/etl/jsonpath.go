@@ -0,0 +1,139 @@
+package etl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parsePath splits a records_path or cursor_path into object keys and
+// array indexes. Paths are dotted ("results", "data.items", "pages.0")
+// or the JSONPath subset "$.data.items[0]"; "" and "$" are the document
+// itself.
+func parsePath(path string) ([]string, error) {
+	bad := errors.New("use dotted keys and [n] indexes, e.g. $.data.items")
+	path = strings.TrimPrefix(path, "$")
+	var keys []string
+	for path != "" {
+		switch {
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, bad
+			}
+			if _, err := strconv.Atoi(path[1:end]); err != nil || strings.HasPrefix(path[1:end], "-") {
+				return nil, bad
+			}
+			keys = append(keys, path[1:end])
+			path = path[end+1:]
+		case path[0] == '.' && len(keys) == 0 && len(path) > 1:
+			path = path[1:]
+			fallthrough
+		default:
+			if len(keys) > 0 {
+				if path[0] != '.' {
+					return nil, bad
+				}
+				path = path[1:]
+			}
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key := path[:end]
+			if key == "" || strings.ContainsAny(key, "]*?@()") {
+				return nil, bad
+			}
+			keys = append(keys, key)
+			path = path[end:]
+		}
+	}
+	return keys, nil
+}
+
+// CheckRecordsPath validates a source's records_path
+func CheckRecordsPath(path string) error {
+	_, err := parsePath(path)
+	return err
+}
+
+// lookupPath follows path through decoded JSON
+func lookupPath(v interface{}, path string) (interface{}, bool) {
+	keys, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	for _, key := range keys {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// seekPath advances decoder to the value at keys without decoding what
+// it passes over wholesale; found is false when the document has no such
+// value
+func seekPath(decoder *json.Decoder, keys []string) (found bool, err error) {
+	for _, key := range keys {
+		tok, err := decoder.Token()
+		if err != nil {
+			return false, err
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok || (delim != '{' && delim != '[') {
+			return false, nil
+		}
+		index := -1
+		if delim == '[' {
+			if index, err = strconv.Atoi(key); err != nil {
+				return false, nil
+			}
+		}
+		matched := false
+		for i := 0; decoder.More(); i++ {
+			if delim == '{' {
+				name, err := decoder.Token()
+				if err != nil {
+					return false, err
+				}
+				matched = name == key
+			} else {
+				matched = i == index
+			}
+			if matched {
+				break
+			}
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return false, err
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// pathError describes a records_path that does not lead to records
+func pathError(path string, found bool) error {
+	if !found {
+		return fmt.Errorf("records_path %q not found in response", path)
+	}
+	return fmt.Errorf("records at %q are not an object or array of objects", path)
+}
@@ -0,0 +1,272 @@
+package etl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// Load modes stored in table_metadata.load_mode
+const (
+	LoadAppend  = "append"  // refreshes add the fetched rows (default)
+	LoadReplace = "replace" // refreshes swap the table's contents for the fetched rows
+	LoadMerge   = "merge"   // fetched rows replace the table's rows with the same merge key
+)
+
+// Delete detection settings stored in table_metadata.merge_deletes: what a
+// merge refresh does to rows whose key is missing from the pull
+const (
+	DeletesOff    = "off"    // leave them (default)
+	DeletesMark   = "mark"   // stamp DeletedAtColumn
+	DeletesDelete = "delete" // delete them
+)
+
+// Insert modes stored in table_metadata.insert_mode: what a refresh does
+// with rows that fail validation or the insert
+const (
+	InsertChunked = "chunked" // chunks commit as they load; the first failure stops the run (default)
+	InsertAtomic  = "atomic"  // all or nothing: append loads are staged too, any failure loads nothing
+	InsertBatch   = "batch"   // best effort: a failing chunk is skipped and reported, the others load
+	InsertRow     = "row"     // best effort: failing rows are skipped and reported, the others load
+)
+
+// DeletedAtColumn is the managed column merge_deletes=mark stamps; a row
+// loaded again comes back with it NULL
+const DeletedAtColumn = "_deleted_at"
+
+// stagingSuffix names the scratch table replace and merge refreshes load into
+const stagingSuffix = "__refresh_staging"
+
+// ValidLoadMode reports whether mode can be stored in table_metadata.load_mode
+func ValidLoadMode(mode string) bool {
+	return mode == LoadAppend || mode == LoadReplace || mode == LoadMerge
+}
+
+// ValidMergeDeletes reports whether v can be stored in table_metadata.merge_deletes
+func ValidMergeDeletes(v string) bool {
+	return v == DeletesOff || v == DeletesMark || v == DeletesDelete
+}
+
+// ValidInsertMode reports whether mode can be stored in table_metadata.insert_mode
+func ValidInsertMode(mode string) bool {
+	return mode == InsertChunked || mode == InsertAtomic || mode == InsertBatch || mode == InsertRow
+}
+
+// Strategy is how refreshes load a table
+type Strategy struct {
+	Mode    string
+	Key     []string // merge key columns; merge mode only
+	Deletes string   // merge mode only
+	Insert  string   // insert mode
+}
+
+// staged reports whether the strategy loads into a staging table first
+func (s Strategy) staged() bool {
+	return s.Mode == LoadReplace || s.Mode == LoadMerge || s.Insert == InsertAtomic
+}
+
+// bestEffort reports whether failing rows are skipped instead of failing the run
+func (s Strategy) bestEffort() bool {
+	return s.Insert == InsertBatch || s.Insert == InsertRow
+}
+
+// detectsDeletes reports whether a merge acts on rows missing from the pull
+func (s Strategy) detectsDeletes() bool {
+	return s.Mode == LoadMerge && s.Deletes != "" && s.Deletes != DeletesOff
+}
+
+// fullPull reports whether every refresh must fetch the whole source,
+// ignoring any watermark: replace keeps only what was pulled, and delete
+// detection treats whatever was not pulled as gone upstream
+func (s Strategy) fullPull() bool {
+	return s.Mode == LoadReplace || s.detectsDeletes()
+}
+
+// ParseMergeKey splits a stored merge_key ("id" or "region,code")
+func ParseMergeKey(s string) []string {
+	var key []string
+	for _, col := range strings.Split(s, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			key = append(key, col)
+		}
+	}
+	return key
+}
+
+// CheckMergeKey verifies every key column exists in columns. Loaded rows
+// need a non-null value in each; rows without one never match.
+func CheckMergeKey(key []string, columns []db.Column) error {
+	if len(key) == 0 {
+		return fmt.Errorf("merge load mode needs a merge_key")
+	}
+	known := map[string]bool{}
+	for _, c := range columns {
+		known[c.ColumnName] = true
+	}
+	for _, col := range key {
+		if !known[col] {
+			return fmt.Errorf("merge_key column %q is not in the table", col)
+		}
+	}
+	return nil
+}
+
+// LoadStrategy reads how refreshes load table
+func (e *ETLProcessor) LoadStrategy(table string) (Strategy, error) {
+	var row struct {
+		Mode    string  `db:"load_mode"`
+		Key     *string `db:"merge_key"`
+		Deletes string  `db:"merge_deletes"`
+		Insert  string  `db:"insert_mode"`
+	}
+	if err := e.DB.Get(&row, `SELECT load_mode, merge_key, merge_deletes, insert_mode FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return Strategy{}, fmt.Errorf("load mode lookup failed: %w", err)
+	}
+	s := Strategy{Mode: row.Mode, Deletes: row.Deletes, Insert: row.Insert}
+	if row.Key != nil {
+		s.Key = ParseMergeKey(*row.Key)
+	}
+	return s, nil
+}
+
+// stagingTable is where a staged refresh of table collects its rows
+func stagingTable(table string) (db.TableName, error) {
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return db.TableName{}, err
+	}
+	return db.TableName{Schema: t.Schema, Name: t.Name + stagingSuffix}, nil
+}
+
+// createStaging creates an empty staging table with live's columns and
+// none of its constraints or defaults, so rows can leave out the columns
+// the live table fills in itself. Postgres copies the exact column types;
+// SQLite declares them from columns.
+func (e *ETLProcessor) createStaging(live, staging db.TableName, columns []db.Column) error {
+	if _, err := e.DB.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, staging.Quoted())); err != nil {
+		return err
+	}
+	var stmt string
+	if db.DialectOf(e.DB) == db.SQLite {
+		defs := make([]string, len(columns))
+		for i, c := range columns {
+			defs[i] = fmt.Sprintf(`"%s" %s`, c.ColumnName, c.DataType)
+		}
+		stmt = fmt.Sprintf(`CREATE TABLE %s (%s)`, staging.Quoted(), strings.Join(defs, ", "))
+	} else {
+		stmt = fmt.Sprintf(`CREATE TABLE %s AS SELECT * FROM %s WITH NO DATA`, staging.Quoted(), live.Quoted())
+	}
+	if _, err := e.DB.Exec(stmt); err != nil {
+		return fmt.Errorf("create staging table: %w", err)
+	}
+	return nil
+}
+
+// swapCounts are the rows a swap touched in the live table
+type swapCounts struct {
+	Deleted  int // rows replaced: all of them for replace, matching keys for merge
+	Inserted int // staged rows moved in
+	Removed  int // merge delete detection: rows missing from the pull, deleted or marked
+}
+
+// swapIn moves the staged rows into live in one transaction, so readers
+// see the table before or after the load, never in between. Replace
+// empties live first; merge deletes the rows whose key was loaded and
+// keeps only the last loaded row per key. With delete detection, merge
+// first deletes or marks the live rows whose key is not in staging (rows
+// with a NULL key never match, so they count as missing). Only the
+// loaded columns are copied; the live table's defaults fill in the rest.
+// Append (insert_mode atomic) only copies the staged rows in.
+func (e *ETLProcessor) swapIn(s Strategy, live, staging db.TableName, loaded map[string]bool) (swapCounts, error) {
+	cols := make([]string, 0, len(loaded))
+	for c := range loaded {
+		cols = append(cols, `"`+c+`"`)
+	}
+	sort.Strings(cols)
+	list := strings.Join(cols, ", ")
+
+	var detect, del string
+	if s.Mode != LoadAppend {
+		del = fmt.Sprintf(`DELETE FROM %s`, live.Quoted())
+	}
+	ins := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, live.Quoted(), list, list, staging.Quoted())
+	if s.Mode == LoadMerge {
+		match := make([]string, len(s.Key))
+		key := make([]string, len(s.Key))
+		for i, col := range s.Key {
+			match[i] = fmt.Sprintf(`s."%s" = %s."%s"`, col, live.Quoted(), col)
+			key[i] = `"` + col + `"`
+		}
+		exists := fmt.Sprintf(`EXISTS (SELECT 1 FROM %s s WHERE %s)`, staging.Quoted(), strings.Join(match, " AND "))
+		switch s.Deletes {
+		case DeletesDelete:
+			detect = fmt.Sprintf(`DELETE FROM %s WHERE NOT %s`, live.Quoted(), exists)
+		case DeletesMark:
+			detect = fmt.Sprintf(`UPDATE %s SET "%s" = CURRENT_TIMESTAMP WHERE "%s" IS NULL AND NOT %s`,
+				live.Quoted(), DeletedAtColumn, DeletedAtColumn, exists)
+		}
+		del += ` WHERE ` + exists
+		// staging is append-only, so rowid/ctid order is load order
+		if db.DialectOf(e.DB) == db.SQLite {
+			ins += fmt.Sprintf(` WHERE rowid IN (SELECT MAX(rowid) FROM %s GROUP BY %s)`, staging.Quoted(), strings.Join(key, ", "))
+		} else {
+			ins += fmt.Sprintf(` WHERE ctid IN (SELECT DISTINCT ON (%s) ctid FROM %s ORDER BY %s, ctid DESC)`,
+				strings.Join(key, ", "), staging.Quoted(), strings.Join(key, ", "))
+		}
+	}
+
+	var counts swapCounts
+	tx, err := e.DB.Beginx()
+	if err != nil {
+		return counts, err
+	}
+	defer tx.Rollback()
+	for _, step := range []struct {
+		stmt string
+		n    *int
+	}{{detect, &counts.Removed}, {del, &counts.Deleted}, {ins, &counts.Inserted}} {
+		if step.stmt == "" {
+			continue
+		}
+		res, err := tx.Exec(step.stmt)
+		if err != nil {
+			return swapCounts{}, err
+		}
+		n, _ := res.RowsAffected()
+		*step.n = int(n)
+	}
+	if err := e.CDC.RecordReload(tx, live.String(), "refresh", s.Mode, counts.Inserted); err != nil {
+		return swapCounts{}, err
+	}
+	return counts, tx.Commit()
+}
+
+// swap runs swapIn for a staged refresh, then updates the quota usage and
+// wakes change capture
+func (e *ETLProcessor) swap(s Strategy, live, staging db.TableName, loaded map[string]bool) (swapCounts, error) {
+	if s.Mode == LoadMerge {
+		for _, col := range s.Key {
+			if !loaded[col] {
+				return swapCounts{}, classify(CodeValidation, fmt.Errorf("merge_key column %q is missing from the loaded rows", col))
+			}
+		}
+	}
+	counts, err := e.swapIn(s, live, staging, loaded)
+	if err != nil {
+		return swapCounts{}, classify(CodeDBInsert, fmt.Errorf("swap in staged rows: %w", err))
+	}
+
+	table := live.String()
+	switch {
+	case s.Mode == LoadReplace:
+		e.Quotas.Replaced(table, counts.Inserted)
+	case s.Deletes == DeletesDelete:
+		e.Quotas.Added(table, counts.Inserted-counts.Deleted-counts.Removed)
+	default:
+		e.Quotas.Added(table, counts.Inserted-counts.Deleted)
+	}
+	e.CDC.Notify()
+	return counts, nil
+}
@@ -0,0 +1,57 @@
+package etl
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	integerText = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	decimalText = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+)
+
+// isDecimalType reports whether a column type stores exact decimals
+// (numeric, decimal, money), which must not pass through float64
+func isDecimalType(dataType string) bool {
+	return strings.Contains(dataType, "numeric") || strings.Contains(dataType, "decimal") || strings.Contains(dataType, "money")
+}
+
+// isIntegerType reports whether a column type holds integers
+func isIntegerType(dataType string) bool {
+	return strings.Contains(dataType, "int") && !strings.Contains(dataType, "interval") || strings.Contains(dataType, "serial")
+}
+
+// coerceNumber converts a JSON number (decoded with UseNumber) without
+// losing precision. Decimal and text columns get its exact text, which
+// Postgres parses exactly; integers beyond int64 are passed through as
+// text for the database to range-check instead of being rounded through
+// float64.
+func coerceNumber(dataType string, jn json.Number) interface{} {
+	if isDecimalType(dataType) || strings.Contains(dataType, "char") || strings.Contains(dataType, "text") {
+		return jn.String()
+	}
+	i64, err := strconv.ParseInt(jn.String(), 10, 64)
+	if err == nil {
+		return i64
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return jn.String()
+	}
+	if f64, err := jn.Float64(); err == nil {
+		return f64
+	}
+	return jn.String()
+}
+
+// exactNumber normalizes numeric text for a decimal or integer column,
+// keeping every digit; ok is false when s is not a number of that kind
+func exactNumber(dataType, s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if isIntegerType(dataType) && !isDecimalType(dataType) {
+		return s, integerText.MatchString(s)
+	}
+	return s, decimalText.MatchString(s)
+}
@@ -0,0 +1,254 @@
+package etl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Pagination types
+const (
+	PageNumber = "page"   // page_param=first_page, first_page+1, …
+	PageOffset = "offset" // page_param=0, page_size, 2*page_size, …
+	PageCursor = "cursor" // cursor_param=<the value at cursor_path in the previous page>
+	PageLink   = "link"   // GET the URL at cursor_path in the previous page
+)
+
+// Stop conditions; cursor and link pagination also stop when the next
+// cursor or link is missing
+const (
+	StopEmpty = "empty" // a page without records (default)
+	StopShort = "short" // a page with fewer than page_size records
+)
+
+// defaultMaxPages bounds a paginated fetch when max_pages is not set
+const defaultMaxPages = 1000
+
+// Pagination describes how a source pages its records, stored as JSON in
+// table_metadata.pagination or on one of a table's data_sources
+type Pagination struct {
+	Type        string `json:"type"`
+	PageParam   string `json:"page_param,omitempty"`   // page and offset: the query parameter to step
+	FirstPage   *int   `json:"first_page,omitempty"`   // page: the first page number (default 1)
+	SizeParam   string `json:"size_param,omitempty"`   // query parameter sent with page_size; empty sends none
+	PageSize    int    `json:"page_size,omitempty"`    // records per page; offset and stop=short need it
+	CursorParam string `json:"cursor_param,omitempty"` // cursor: the query parameter carrying the cursor
+	CursorPath  string `json:"cursor_path,omitempty"`  // cursor and link: path to the next cursor or URL, e.g. meta.next
+	Stop        string `json:"stop,omitempty"`
+	MaxPages    int    `json:"max_pages,omitempty"` // fail rather than fetch more pages (default 1000)
+}
+
+// Check validates the settings a pagination type needs
+func (p *Pagination) Check() error {
+	switch p.Type {
+	case PageNumber:
+		if p.PageParam == "" {
+			return errors.New("page pagination needs page_param")
+		}
+	case PageOffset:
+		if p.PageParam == "" || p.PageSize <= 0 {
+			return errors.New("offset pagination needs page_param and page_size")
+		}
+	case PageCursor:
+		if p.CursorParam == "" || p.CursorPath == "" {
+			return errors.New("cursor pagination needs cursor_param and cursor_path")
+		}
+	case PageLink:
+		if p.CursorPath == "" {
+			return errors.New("link pagination needs cursor_path")
+		}
+	default:
+		return fmt.Errorf("unknown pagination type %q (page, offset, cursor or link)", p.Type)
+	}
+	if _, err := parsePath(p.CursorPath); err != nil {
+		return fmt.Errorf("invalid cursor_path: %w", err)
+	}
+	switch p.Stop {
+	case "", StopEmpty:
+	case StopShort:
+		if p.PageSize <= 0 {
+			return errors.New("stop=short needs page_size")
+		}
+	default:
+		return fmt.Errorf("unknown stop condition %q (empty or short)", p.Stop)
+	}
+	if p.PageSize < 0 || p.MaxPages < 0 {
+		return errors.New("page_size and max_pages cannot be negative")
+	}
+	return nil
+}
+
+// pageURL is the URL of page n (from 0). next is the cursor or link taken
+// from page n-1.
+func (p *Pagination) pageURL(rawURL, next string, n int) (string, error) {
+	if p.Type == PageLink && n > 0 {
+		base, err := url.Parse(rawURL)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(next)
+		if err != nil {
+			return "", fmt.Errorf("invalid next page link: %w", err)
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if p.SizeParam != "" && p.PageSize > 0 {
+		q.Set(p.SizeParam, strconv.Itoa(p.PageSize))
+	}
+	switch p.Type {
+	case PageNumber:
+		first := 1
+		if p.FirstPage != nil {
+			first = *p.FirstPage
+		}
+		q.Set(p.PageParam, strconv.Itoa(first+n))
+	case PageOffset:
+		q.Set(p.PageParam, strconv.Itoa(n*p.PageSize))
+	case PageCursor:
+		if n > 0 {
+			q.Set(p.CursorParam, next)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// fetchPages loads a source page by page as src.Pagination describes,
+// emitting the records at src.RecordsPath in each page to fn in chunks of
+// chunkSize. FetchTimeout covers all pages.
+func (e *ETLProcessor) fetchPages(ctx context.Context, src Source, chunkSize int, fn func(chunk []map[string]interface{}) error) (int, error) {
+	p, rawURL := src.Pagination, src.URL
+	if rawURL == "" {
+		return 0, classify(CodeUpstreamHTTP, errors.New("empty data source url"))
+	}
+	if chunkSize <= 0 {
+		chunkSize = 1
+	}
+	if e.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.FetchTimeout)
+		defer cancel()
+	}
+	maxPages := p.MaxPages
+	if maxPages == 0 {
+		maxPages = defaultMaxPages
+	}
+
+	total, next := 0, ""
+	for n := 0; n < maxPages; n++ {
+		pageURL, err := p.pageURL(rawURL, next, n)
+		if err != nil {
+			return total, classify(CodeUpstreamHTTP, fmt.Errorf("invalid request: %w", err))
+		}
+		body, err := e.getPage(ctx, pageURL, src.Request)
+		if err != nil {
+			return total, err
+		}
+		records, err := pageRecords(body, src.RecordsPath)
+		if err != nil {
+			return total, classify(CodeUpstreamSchema, fmt.Errorf("page %d: %w", n+1, err))
+		}
+		for start := 0; start < len(records); start += chunkSize {
+			end := min(start+chunkSize, len(records))
+			if err := fn(records[start:end:end]); err != nil {
+				return total, err
+			}
+			total += end - start
+		}
+
+		if len(records) == 0 || (p.Stop == StopShort && len(records) < p.PageSize) {
+			return total, nil
+		}
+		if p.Type == PageCursor || p.Type == PageLink {
+			v, ok := lookupPath(body, p.CursorPath)
+			cursor := ""
+			if ok && v != nil {
+				cursor = fmt.Sprint(v)
+			}
+			if cursor == "" || cursor == next {
+				return total, nil
+			}
+			next = cursor
+		}
+	}
+	return total, classify(CodeUpstreamSchema, fmt.Errorf("source still had pages after %d (max_pages)", maxPages))
+}
+
+// getPage requests and decodes one page
+func (e *ETLProcessor) getPage(ctx context.Context, pageURL string, sr *SourceRequest) (interface{}, error) {
+	req, err := sr.build(ctx, pageURL)
+	if err != nil {
+		return nil, classify(CodeUpstreamHTTP, fmt.Errorf("invalid request: %w", err))
+	}
+	start := time.Now()
+	resp, err := e.Client.Do(req)
+	traceRequest(ctx, req, sr.body(), start, resp, err)
+	if err != nil {
+		return nil, classify(CodeUpstreamHTTP, fmt.Errorf("http get failed: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return nil, classify(CodeUpstreamHTTP, fmt.Errorf("http status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	var r io.Reader = resp.Body
+	if e.MaxResponseBytes > 0 {
+		r = http.MaxBytesReader(nil, resp.Body, e.MaxResponseBytes)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fetchBodyError(err)
+		}
+		return nil, classify(CodeUpstreamHTTP, fmt.Errorf("read page failed: %w", err))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, classify(CodeUpstreamSchema, fmt.Errorf("json decode failed: %w", err))
+	}
+	return body, nil
+}
+
+// pageRecords finds the records of a page at path: an array of objects,
+// or a single object counting as one record
+func pageRecords(body interface{}, path string) ([]map[string]interface{}, error) {
+	v, ok := lookupPath(body, path)
+	if !ok {
+		return nil, fmt.Errorf("records_path %q not found", path)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, nil
+	case []interface{}:
+		records := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("array items are not objects")
+			}
+			records = append(records, m)
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("records at %q are not an object or array of objects", path)
+}
@@ -0,0 +1,571 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// -----------------------------
+// Refresh
+// Loads url into table; see RefreshSources
+// -----------------------------
+func (e *ETLProcessor) Refresh(table, url string) (RefreshResult, error) {
+	return e.RefreshSources(table, []Source{{URL: url}})
+}
+
+// -----------------------------
+// RefreshSources
+// Loads sources into table as a three-stage pipeline:
+//
+//	fetch (stream-decode chunks) → transform + validate → insert
+//
+// Stages run in their own goroutines connected by channels holding at
+// most PipelineDepth chunks, so decoding the next chunk overlaps with
+// inserting the previous one while memory stays bounded. The first
+// failing stage cancels the others. Chunks commit independently; on
+// failure the rows inserted so far are returned alongside the error.
+//
+// Date placeholders in source URLs and request bodies ({today},
+// {yesterday}, {now_iso}, {last_run_iso}) are expanded when the run
+// starts; see URLVars and SourceRequest.
+//
+// Tables with a watermark column load incrementally: the watermark is
+// substituted into the URL and request body, rows at or below it are dropped, and the
+// highest value inserted becomes the new watermark.
+//
+// Sources with pagination settings are fetched page by page; see Pagination.
+// A single unpaginated source is fetched conditionally (If-None-Match / If-Modified-Since)
+// with the validators saved by the last successful run; sources without
+// validators are compared by payload checksum instead. Either way an
+// unchanged source skips the pipeline and is reported as Unchanged.
+//
+// Several sources (a table's data_sources) are fetched one after another
+// into the same run, each in full and with the watermark substituted into
+// its URL. A failing source does not stop the others, but fails the run;
+// the outcome of each is returned in RefreshResult.Sources.
+//
+// Tables with provenance columns get every inserted row stamped with the
+// URL of the source it came from (without its query string), the refresh
+// time and a batch id shared by the whole run.
+//
+// The table's load mode decides what the rows do. append inserts each
+// chunk as it comes. replace and merge load into a staging table, then
+// swap the rows in with one transaction: replace empties the table first,
+// merge deletes the rows whose merge key was loaded and, with delete
+// detection on, deletes or marks the rows whose key was not. replace and
+// delete detection pull the whole source, ignoring any watermark. A
+// failed staged run leaves the table as it was.
+//
+// The table's insert mode decides what a failing row does. chunked stops
+// the run at the first failure, keeping the chunks committed before it.
+// atomic stages append loads too, so any failure leaves the table as it
+// was. batch skips a chunk failing validation or the insert; row skips
+// the failing rows alone, inserting the rest of their chunk one by one.
+// Either way the run goes on, and the skipped rows are counted in
+// RefreshResult.Rejected and listed in RunDetail.RejectedRows. A run whose
+// every row was skipped fails.
+//
+// Runs that get as far as the pipeline return a RunDetail in
+// RefreshResult.Detail: each stage's busy time and row counts, the
+// requests made to the sources, and warnings.
+// -----------------------------
+func (e *ETLProcessor) RefreshSources(table string, sources []Source) (RefreshResult, error) {
+	if len(sources) == 0 {
+		return RefreshResult{}, fmt.Errorf("Fetch failed: table has no sources")
+	}
+	e.running.Add(1)
+	defer e.running.Add(-1)
+	started := time.Now()
+	strategy, err := e.LoadStrategy(table)
+	if err != nil {
+		return RefreshResult{}, fmt.Errorf("Fetch failed: %w", err)
+	}
+	staged := strategy.staged()
+	mark, incremental, err := e.LoadWatermark(table)
+	if err != nil {
+		return RefreshResult{}, fmt.Errorf("Fetch failed: %w", err)
+	}
+	incremental = incremental && !strategy.fullPull()
+	vars, err := e.LoadURLVars(table)
+	if err != nil {
+		return RefreshResult{}, fmt.Errorf("Fetch failed: %w", err)
+	}
+	var markp *Watermark
+	if incremental {
+		markp = &mark
+	}
+	fetches := make([]Source, len(sources))
+	urls := make([]string, len(sources))
+	runs := make([]SourceResult, len(sources))
+	for i, src := range sources {
+		fetches[i] = src.expand(vars, markp)
+		urls[i] = fetches[i].URL
+		runs[i] = SourceResult{Name: src.Name, URL: sourceLabel(src.URL), Status: SourceSkipped}
+	}
+	var cond *conditional // single unpaginated sources only
+	var prev SourceValidators
+	if len(sources) == 1 && sources[0].Pagination == nil {
+		if prev, err = e.LoadValidators(table); err != nil {
+			return RefreshResult{}, fmt.Errorf("Fetch failed: %w", err)
+		}
+		cond = &conditional{prev: prev}
+	}
+	columns, err := db.TableColumns(e.DB, table)
+	if err != nil {
+		return RefreshResult{}, fmt.Errorf("Fetch failed: failed to load table columns: %w", err)
+	}
+	provs := provenance(columns, urls)
+	observed := SourceSchema{}
+
+	if strategy.Mode == LoadMerge {
+		if err := CheckMergeKey(strategy.Key, columns); err != nil {
+			return RefreshResult{}, fmt.Errorf("Validation failed: %w", classify(CodeValidation, err))
+		}
+	}
+
+	target := table
+	var live, staging db.TableName
+	loaded := map[string]bool{} // columns written to staging
+	if staged {
+		if live, err = db.ParseTableName(table); err == nil {
+			staging, err = stagingTable(table)
+		}
+		if err == nil {
+			err = e.createStaging(live, staging, columns)
+		}
+		if err != nil {
+			return RefreshResult{}, fmt.Errorf("Insert failed: %w", classify(CodeDBInsert, err))
+		}
+		defer e.DB.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, staging.Quoted()))
+		target = staging.String()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	depth := e.PipelineDepth
+	if depth < 1 {
+		depth = 1
+	}
+	fetched := make(chan sourceChunk, depth)
+	validated := make(chan sourceChunk, depth)
+
+	var (
+		wg          sync.WaitGroup
+		total       int
+		fetchErr    error
+		validateErr error
+		insertErr   error
+	)
+	trace := &requestTrace{}
+	rejects := &rejectLog{}
+	fetchClock := &stageClock{StageDetail: StageDetail{Name: StageFetch}}
+	transformClock := &stageClock{StageDetail: StageDetail{Name: StageTransform}}
+	validateClock := &stageClock{StageDetail: StageDetail{Name: StageValidate}}
+	filterClock := &stageClock{StageDetail: StageDetail{Name: StageFilter}}
+	insertClock := &stageClock{StageDetail: StageDetail{Name: StageInsert}}
+	swapClock := &stageClock{StageDetail: StageDetail{Name: StageSwap}}
+
+	// Stage 1: fetch + streaming decode
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(fetched)
+		start, blocked := time.Now(), time.Duration(0)
+		for i := range urls {
+			if ctx.Err() != nil {
+				break
+			}
+			emit := func(chunk []map[string]interface{}) error {
+				fetchClock.Chunks++
+				fetchClock.RowsOut += len(chunk)
+				waiting := time.Now()
+				defer func() { blocked += time.Since(waiting) }()
+				select {
+				case fetched <- sourceChunk{rows: chunk, source: i, offset: fetchClock.RowsOut - len(chunk)}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			n, err := e.fetchSource(withTrace(ctx, trace, sources[i].Name), fetches[i], e.ChunkSize, cond, emit)
+			total += n
+			runs[i].Fetched = n
+			switch {
+			case err == nil:
+				runs[i].Status = SourceOK
+			case ctx.Err() != nil:
+				// cut short by a later stage's failure
+			default:
+				runs[i].Status, runs[i].Error = SourceError, err.Error()
+				if len(urls) > 1 {
+					err = fmt.Errorf("source %s: %w", sources[i].Name, err)
+				}
+				fetchErr = errors.Join(fetchErr, err)
+			}
+		}
+		fetchClock.busy = time.Since(start) - blocked
+	}()
+
+	// Stage 2: transform + validate
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(validated)
+		for chunk := range fetched {
+			start := time.Now()
+			transformed := e.TransformPayload(chunk.rows)
+			observed.observe(transformed)
+			transformClock.add(start, len(chunk.rows), len(transformed))
+
+			start = time.Now()
+			var reject func(RowIssue)
+			if strategy.Insert == InsertRow {
+				reject = func(issue RowIssue) {
+					issue.Index += chunk.offset
+					rejects.add(1, issue)
+				}
+			}
+			validRows, index, err := e.validateRows(table, transformed, reject)
+			validateClock.add(start, len(transformed), len(validRows))
+			if err != nil && strategy.Insert == InsertBatch {
+				rejects.add(len(transformed), RowIssue{Index: chunk.offset, Reason: fmt.Sprintf("chunk of %d rows skipped: %v", len(transformed), err)})
+				continue
+			}
+			if err != nil {
+				validateErr = err
+				cancel()
+				return
+			}
+			if incremental {
+				start, in := time.Now(), len(validRows)
+				kept := 0
+				for i, row := range validRows {
+					if !mark.Covers(row) {
+						validRows[kept], index[kept] = row, index[i]
+						kept++
+					}
+				}
+				validRows, index = validRows[:kept], index[:kept]
+				filterClock.add(start, in, len(validRows))
+			}
+			for i := range index {
+				index[i] += chunk.offset
+			}
+			select {
+			case validated <- sourceChunk{rows: validRows, index: index, source: chunk.source}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Stage 3: insert (keeps draining after a failure so upstream can exit).
+	// Rows are queued for change capture with their insert; staged rows
+	// only once they are swapped in.
+	capture := func(rows []map[string]interface{}) func(tx sqlx.Execer) error {
+		if staged {
+			return nil
+		}
+		return e.Capture(table, "refresh", rows)
+	}
+	inserted := 0
+	high := mark.Value
+	for chunk := range validated {
+		rows := chunk.rows
+		if insertErr != nil {
+			continue
+		}
+		if provs != nil {
+			provs[chunk.source].Stamp(rows)
+		}
+		start := time.Now()
+		quotaErr := e.Quotas.CheckRows(table, len(rows))
+		switch {
+		case strategy.Mode == LoadReplace:
+			quotaErr = e.Quotas.CheckReplace(table, inserted+len(rows))
+		case strategy.Mode == LoadAppend && staged:
+			quotaErr = e.Quotas.CheckRows(table, inserted+len(rows))
+		}
+		if quotaErr != nil {
+			insertErr = classify(CodeQuota, quotaErr)
+			cancel()
+			continue
+		}
+		n, err := e.InsertRows(target, rows, capture(rows))
+		if err != nil {
+			switch strategy.Insert {
+			case InsertBatch:
+				rejects.add(len(rows), RowIssue{Index: chunk.index[0], Reason: fmt.Sprintf("chunk of %d rows skipped: %v", len(rows), err)})
+				rows, n, err = nil, 0, nil
+			case InsertRow:
+				rows, err = e.insertEach(target, chunk, rejects, capture), nil
+				n = len(rows)
+			}
+		}
+		insertClock.add(start, len(chunk.rows), n)
+		inserted += n
+		runs[chunk.source].Rows += n
+		if err != nil {
+			insertErr = err
+			cancel()
+			continue
+		}
+		if incremental {
+			high = mark.Max(rows, high)
+		}
+		if staged {
+			for _, row := range rows {
+				for col := range row {
+					loaded[col] = true
+				}
+			}
+			continue
+		}
+		e.Quotas.Added(table, n)
+		e.CDC.Notify()
+	}
+	wg.Wait()
+	unchanged := ""
+	if cond != nil {
+		unchanged = cond.unchanged
+	}
+
+	// staged rows only count once they are swapped in
+	var counts swapCounts
+	var warnings []string
+	if staged {
+		swapped := false
+		// a best-effort run that rejected every row must not empty a replaced table
+		if validateErr == nil && insertErr == nil && fetchErr == nil && unchanged == "" && total > 0 && (inserted > 0 || rejects.count == 0) {
+			start := time.Now()
+			counts, insertErr = e.swap(strategy, live, staging, loaded)
+			swapped = insertErr == nil
+			swapClock.add(start, inserted, counts.Inserted)
+			inserted = counts.Inserted
+		} else if inserted > 0 {
+			warnings = append(warnings, fmt.Sprintf("%d staged rows were discarded; the table was left as it was", inserted))
+		}
+		if !swapped {
+			inserted, high = 0, mark.Value
+			for i := range runs {
+				runs[i].Rows = 0
+			}
+		}
+	}
+
+	// committed chunks advance the watermark even if a later one failed
+	if incremental && high != nil && (mark.Value == nil || *high != *mark.Value) {
+		if err := e.SaveWatermark(table, *high); err != nil && insertErr == nil {
+			insertErr = fmt.Errorf("save watermark failed: %w", err)
+		}
+	}
+
+	result := RefreshResult{Inserted: inserted, Mode: strategy.Mode}
+	if strategy.Mode == LoadMerge {
+		result.Updated, result.Removed, result.Deletes = counts.Deleted, counts.Removed, strategy.Deletes
+	}
+	if provs != nil && inserted > 0 {
+		result.BatchID = provs[0].BatchID
+	}
+	if sources[0].Name != "" {
+		result.Sources = runs
+	}
+
+	stages := []*stageClock{fetchClock, transformClock, validateClock}
+	if incremental {
+		stages = append(stages, filterClock)
+		if skipped := filterClock.RowsIn - filterClock.RowsOut; skipped > 0 && mark.Value != nil {
+			warnings = append(warnings, fmt.Sprintf("%d rows at or below the watermark %s were skipped", skipped, *mark.Value))
+		}
+	}
+	stages = append(stages, insertClock)
+	if staged {
+		stages = append(stages, swapClock)
+	}
+	if ignored := observed.missingFrom(columns); len(ignored) > 0 {
+		warnings = append(warnings, "source fields the table has no column for were ignored: "+strings.Join(ignored, ", "))
+	}
+	result.Detail = trace.detail(started, stages, warnings)
+	result.Rejected = rejects.count
+	sort.Slice(rejects.issues, func(a, b int) bool { return rejects.issues[a].Index < rejects.issues[b].Index })
+	result.Detail.Rejected, result.Detail.RejectedRows = rejects.count, rejects.issues
+	result.Params = fetches
+
+	switch {
+	case validateErr != nil:
+		return result, fmt.Errorf("Validation failed: %w", validateErr)
+	case insertErr != nil:
+		return result, fmt.Errorf("Insert failed: %w", insertErr)
+	case fetchErr != nil:
+		return result, fmt.Errorf("Fetch failed: %w", fetchErr)
+	case unchanged != "":
+		return RefreshResult{Unchanged: true, Reason: unchanged, Detail: result.Detail, Params: fetches}, nil
+	case total == 0 && !incremental:
+		// an empty page is normal for incremental sources, not for full loads
+		return result, fmt.Errorf("Validation failed: %w", classify(CodeValidation, errors.New("no rows to validate")))
+	case result.Rejected > 0 && inserted == 0:
+		return result, fmt.Errorf("Validation failed: %w", classify(CodeValidation, fmt.Errorf("all %d rows were rejected", result.Rejected)))
+	}
+
+	// only remember validators once the data behind them is loaded
+	if cond != nil && cond.next != prev {
+		if err := e.SaveValidators(table, cond.next); err != nil {
+			log.Printf("[etl] %s: failed to save source validators: %v", table, err)
+		}
+	}
+	if total > 0 {
+		changes, err := e.recordSchema(table, observed, columns, incremental)
+		if err != nil {
+			log.Printf("[etl] %s: schema drift check failed: %v", table, err)
+		}
+		result.SchemaChanges = changes
+		if len(changes) > 0 {
+			result.Detail.Warnings = append(result.Detail.Warnings, describeDrift(changes))
+		}
+	}
+	return result, nil
+}
+
+// RefreshResult summarizes a successful Refresh
+type RefreshResult struct {
+	Inserted  int
+	Mode      string // the table's load mode
+	Updated   int    // merge mode: existing rows replaced by a loaded row with their key
+	Removed   int    // merge delete detection: rows missing from the pull
+	Deletes   string // merge delete detection: what happened to them (mark or delete)
+	Unchanged bool   // the source had nothing new; the pipeline was skipped
+	Reason    string // why the source counted as unchanged
+	BatchID   string // _batch_id of the inserted rows, for tables with provenance
+	Rejected  int    // insert modes batch and row: rows skipped; see RunDetail.RejectedRows
+
+	// Sources is how each of the table's data_sources fared; nil for
+	// tables loading from data_source_url alone
+	Sources []SourceResult
+
+	// SchemaChanges is the drift between this payload's fields and the last
+	// observed source schema
+	SchemaChanges []SchemaChange
+
+	// Detail is how the run went stage by stage; nil when it failed
+	// before fetching
+	Detail *RunDetail
+
+	// Params are the sources as fetched, with placeholders and watermark
+	// filled in; passing them to RefreshSources retries the run with the
+	// same date window. nil when the run failed before fetching.
+	Params []Source
+
+	// RetryOf is the refresh_logs id of the run this one retries; 0 for
+	// other runs
+	RetryOf int
+}
+
+// unchangedPrefix starts the refresh_logs message of a run that skipped an unchanged source
+const unchangedPrefix = "No change: "
+
+// Message is the refresh_logs/event text for a successful run
+func (r RefreshResult) Message() string {
+	if r.Unchanged {
+		return unchangedPrefix + r.Reason
+	}
+	msg := fmt.Sprintf("Inserted %d rows", r.Inserted)
+	switch r.Mode {
+	case LoadReplace:
+		msg = fmt.Sprintf("Replaced contents with %d rows", r.Inserted)
+	case LoadMerge:
+		msg = fmt.Sprintf("Merged %d rows (%d replaced existing rows)", r.Inserted, r.Updated)
+		switch r.Deletes {
+		case DeletesMark:
+			msg += fmt.Sprintf(", marked %d rows missing from the source as deleted", r.Removed)
+		case DeletesDelete:
+			msg += fmt.Sprintf(", deleted %d rows missing from the source", r.Removed)
+		}
+	}
+	if len(r.Sources) > 1 {
+		msg += fmt.Sprintf(" from %d sources", len(r.Sources))
+	}
+	if r.BatchID != "" {
+		msg += fmt.Sprintf(" (batch %s)", r.BatchID)
+	}
+	if r.Rejected > 0 {
+		msg += fmt.Sprintf("; rejected %d rows", r.Rejected)
+	}
+	if len(r.SchemaChanges) > 0 {
+		msg += "; " + describeDrift(r.SchemaChanges)
+	}
+	return msg
+}
+
+// DriftMessage describes the result's schema changes, or "" when there are none
+func (r RefreshResult) DriftMessage() string {
+	if len(r.SchemaChanges) == 0 {
+		return ""
+	}
+	return describeDrift(r.SchemaChanges)
+}
+
+// provenance starts a batch loading urls, one stamp per source sharing the
+// batch id and time, or returns nil when the table's columns have no
+// provenance columns
+func provenance(columns []db.Column, urls []string) []*db.Provenance {
+	if !db.HasProvenance(columns) {
+		return nil
+	}
+	batch := db.NewProvenance("")
+	provs := make([]*db.Provenance, len(urls))
+	for i, url := range urls {
+		p := batch
+		p.Source = sourceLabel(url)
+		provs[i] = &p
+	}
+	return provs
+}
+
+// sourceChunk is a chunk of rows and the index of the source it came from.
+// Fetched chunks start at offset among the run's fetched rows; validated
+// ones carry the position of each row there in index instead.
+type sourceChunk struct {
+	rows   []map[string]interface{}
+	index  []int
+	offset int
+	source int
+}
+
+// insertEach inserts the rows of a chunk the database refused as a whole
+// one at a time, logging the ones it refuses again in rejects, and returns
+// the inserted rows
+func (e *ETLProcessor) insertEach(target string, chunk sourceChunk, rejects *rejectLog, capture func([]map[string]interface{}) func(tx sqlx.Execer) error) []map[string]interface{} {
+	var inserted []map[string]interface{}
+	for i, row := range chunk.rows {
+		if _, err := e.InsertRows(target, chunk.rows[i:i+1], capture(chunk.rows[i:i+1])); err != nil {
+			rejects.add(1, RowIssue{Index: chunk.index[i], Reason: err.Error()})
+			continue
+		}
+		inserted = append(inserted, row)
+	}
+	return inserted
+}
+
+// sourceLabel is the _source value for url: credentials and the query
+// string (which may carry API keys) are left out
+func sourceLabel(raw string) string {
+	u, err := neturl.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
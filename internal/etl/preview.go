@@ -0,0 +1,96 @@
+package etl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+)
+
+// errPreviewFull stops a preview once it has read enough records
+var errPreviewFull = errors.New("preview has enough records")
+
+// Preview is what a refresh would make of a sample, from CheckPreview
+type Preview struct {
+	PayloadCheck
+	Watermark *string // incremental tables: the value the next refresh loads rows after
+	Filtered  []int   // positions of valid rows at or below the watermark, which a refresh skips
+}
+
+// PreviewPayload decodes up to limit records of a sample payload the way a
+// refresh decodes a source response: an array of objects or one object,
+// at path when the payload is wrapped
+func PreviewPayload(payload []byte, path string, limit int) ([]map[string]interface{}, bool, error) {
+	return readPreview(limit, func(fn func([]map[string]interface{}) error) error {
+		_, err := decodeRows(bufio.NewReader(bytes.NewReader(payload)), path, limit, fn)
+		return err
+	})
+}
+
+// PreviewSource fetches up to limit records of src as the next refresh of
+// table would: placeholders filled in, from the watermark of incremental
+// tables, and only as many pages as needed
+func (e *ETLProcessor) PreviewSource(ctx context.Context, table string, src Source, limit int) ([]map[string]interface{}, bool, error) {
+	vars, err := e.LoadURLVars(table)
+	if err != nil {
+		return nil, false, err
+	}
+	mark, incremental, err := e.LoadWatermark(table)
+	if err != nil {
+		return nil, false, err
+	}
+	var markp *Watermark
+	if incremental {
+		markp = &mark
+	}
+	src = src.expand(vars, markp)
+	return readPreview(limit, func(fn func([]map[string]interface{}) error) error {
+		_, err := e.fetchSource(ctx, src, limit, nil, fn)
+		return err
+	})
+}
+
+// readPreview collects the first limit records read emits
+func readPreview(limit int, read func(fn func([]map[string]interface{}) error) error) ([]map[string]interface{}, bool, error) {
+	records := []map[string]interface{}{}
+	more := false
+	err := read(func(chunk []map[string]interface{}) error {
+		if room := limit - len(records); len(chunk) > room {
+			records, more = append(records, chunk[:room]...), true
+			return errPreviewFull
+		}
+		records = append(records, chunk...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPreviewFull) {
+		return nil, false, err
+	}
+	return records, more, nil
+}
+
+// CheckPreview runs records through table's transform and coercion, as
+// CheckPayload does, and counts the valid rows an incremental refresh
+// would skip as at or below the watermark
+func (e *ETLProcessor) CheckPreview(table string, records []map[string]interface{}) (Preview, error) {
+	var preview Preview
+	check, err := e.CheckPayload(table, records)
+	if err != nil {
+		return preview, err
+	}
+	preview.PayloadCheck = check
+
+	mark, incremental, err := e.LoadWatermark(table)
+	if err != nil {
+		return preview, err
+	}
+	if incremental {
+		preview.Watermark = mark.Value
+		preview.Filtered = []int{}
+		for i, row := range check.Rows {
+			if mark.Covers(row) {
+				preview.Filtered = append(preview.Filtered, check.Indexes[i])
+			}
+		}
+	}
+	return preview, nil
+}
@@ -0,0 +1,282 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// Reconciliation statuses
+const (
+	ReconcileMatch    = "MATCH"
+	ReconcileMismatch = "MISMATCH"
+	ReconcileError    = "ERROR"
+)
+
+// Placeholders substituted into reconciliation URLs (RFC3339, query-escaped)
+const (
+	SincePlaceholder = "{since}"
+	UntilPlaceholder = "{until}"
+)
+
+// ReconcileSettings is a table's reconciliation setup from table_metadata
+type ReconcileSettings struct {
+	Window        time.Duration
+	CountURL      string // returns the source's total for the window; empty = count the source's records
+	Column        string // timestamp column counting loaded rows; empty = rows_inserted from refresh_logs
+	DataSourceURL string
+	Pagination    *Pagination    // how DataSourceURL pages its records, if it does
+	Request       *SourceRequest // how DataSourceURL is requested, if not by GET
+	RecordsPath   string         // where DataSourceURL's records are in its payload
+	LastSuccess   *time.Time
+}
+
+// Reconciliation compares what the source holds for a window with what
+// was loaded (a reconciliation_results row)
+type Reconciliation struct {
+	Table       string    `db:"table_name" json:"table"`
+	WindowStart time.Time `db:"window_start" json:"window_start"`
+	WindowEnd   time.Time `db:"window_end" json:"window_end"`
+	SourceCount *int64    `db:"source_count" json:"source_count,omitempty"`
+	LoadedCount *int64    `db:"loaded_count" json:"loaded_count,omitempty"`
+	Status      string    `db:"status" json:"status"`
+	Message     string    `db:"message" json:"message"`
+	CheckedAt   time.Time `db:"checked_at" json:"checked_at"`
+}
+
+// LoadReconcileSettings reads table's reconciliation setup; ok is false
+// when reconciliation is off for the table
+func (e *ETLProcessor) LoadReconcileSettings(table string) (ReconcileSettings, bool, error) {
+	var row struct {
+		Window        *int             `db:"reconcile_window"`
+		CountURL      *string          `db:"reconcile_count_url"`
+		Column        *string          `db:"reconcile_column"`
+		DataSourceURL *string          `db:"data_source_url"`
+		Pagination    *json.RawMessage `db:"pagination"`
+		Request       *json.RawMessage `db:"request"`
+		RecordsPath   *string          `db:"records_path"`
+		LastSuccess   *time.Time       `db:"last_refresh_success"`
+	}
+	err := e.DB.Get(&row, `
+		SELECT reconcile_window, reconcile_count_url, reconcile_column, data_source_url, pagination, request, records_path, last_refresh_success
+		FROM table_metadata WHERE table_name = $1`, table)
+	if err != nil {
+		return ReconcileSettings{}, false, err
+	}
+	if row.Window == nil || *row.Window <= 0 {
+		return ReconcileSettings{}, false, nil
+	}
+	s := ReconcileSettings{Window: time.Duration(*row.Window) * time.Second, LastSuccess: row.LastSuccess}
+	if row.CountURL != nil {
+		s.CountURL = *row.CountURL
+	}
+	if row.Column != nil {
+		s.Column = *row.Column
+	}
+	if row.DataSourceURL != nil {
+		s.DataSourceURL = *row.DataSourceURL
+	}
+	if s.Pagination, err = parsePagination(row.Pagination); err != nil {
+		return ReconcileSettings{}, false, err
+	}
+	if s.Request, err = parseRequest(row.Request); err != nil {
+		return ReconcileSettings{}, false, err
+	}
+	if row.RecordsPath != nil {
+		s.RecordsPath = *row.RecordsPath
+	}
+	return s, true, nil
+}
+
+// -----------------------------
+// Reconcile
+// Compares the source's record count for the window ending at the table's
+// last successful refresh with the rows loaded for that window, and stores
+// the outcome. Counts differing by more than tolerancePct percent of the
+// source count are a MISMATCH; failing to count either side is an ERROR.
+//
+// The source count comes from the table's count URL (a JSON number, or an
+// object with "count" or "total") or, without one, from counting the
+// records its data source URL returns. Either URL may use {since} and
+// {until}. Loaded rows are counted by the reconcile column when set,
+// otherwise summed from the window's successful refresh logs.
+// -----------------------------
+func (e *ETLProcessor) Reconcile(table string, tolerancePct float64) (Reconciliation, error) {
+	s, ok, err := e.LoadReconcileSettings(table)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	if !ok {
+		return Reconciliation{}, errors.New("reconciliation is not configured for this table")
+	}
+	if s.LastSuccess == nil {
+		return Reconciliation{}, errors.New("table has no successful refresh to reconcile")
+	}
+
+	r := Reconciliation{
+		Table:       table,
+		WindowEnd:   s.LastSuccess.UTC(),
+		WindowStart: s.LastSuccess.UTC().Add(-s.Window),
+		CheckedAt:   time.Now().UTC(),
+	}
+	source, err := e.sourceCount(s, r.WindowStart, r.WindowEnd)
+	if err == nil {
+		r.SourceCount = &source
+		var loaded int64
+		loaded, err = e.loadedCount(table, s.Column, r.WindowStart, r.WindowEnd)
+		r.LoadedCount = &loaded
+	}
+
+	switch {
+	case err != nil:
+		r.Status, r.Message = ReconcileError, err.Error()
+	default:
+		diff := *r.LoadedCount - *r.SourceCount
+		allowed := float64(*r.SourceCount) * tolerancePct / 100
+		if math.Abs(float64(diff)) <= allowed {
+			r.Status = ReconcileMatch
+			r.Message = fmt.Sprintf("source %d, loaded %d", *r.SourceCount, *r.LoadedCount)
+		} else {
+			r.Status = ReconcileMismatch
+			r.Message = fmt.Sprintf("source %d, loaded %d (%+d rows)", *r.SourceCount, *r.LoadedCount, diff)
+		}
+	}
+
+	_, err = e.DB.Exec(`
+		INSERT INTO reconciliation_results (table_name, window_start, window_end, source_count, loaded_count, status, message, checked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		r.Table, r.WindowStart, r.WindowEnd, r.SourceCount, r.LoadedCount, r.Status, r.Message, r.CheckedAt)
+	if err != nil {
+		return r, fmt.Errorf("failed to store reconciliation: %w", err)
+	}
+	return r, nil
+}
+
+// Reconciliations lists table's stored results, newest first
+func (e *ETLProcessor) Reconciliations(table string, limit int) ([]Reconciliation, error) {
+	results := []Reconciliation{}
+	err := e.DB.Select(&results, `
+		SELECT table_name, window_start, window_end, source_count, loaded_count, status, message, checked_at
+		FROM reconciliation_results
+		WHERE table_name = $1
+		ORDER BY checked_at DESC, id DESC
+		LIMIT $2`, table, limit)
+	return results, err
+}
+
+// sourceCount asks the source how many records it holds for the window
+func (e *ETLProcessor) sourceCount(s ReconcileSettings, since, until time.Time) (int64, error) {
+	if s.CountURL == "" {
+		if s.DataSourceURL == "" {
+			return 0, errors.New("table has no data_source_url or reconcile_count_url")
+		}
+		src := Source{
+			URL:         expandWindow(s.DataSourceURL, since, until),
+			Pagination:  s.Pagination,
+			Request:     s.Request.expand(URLVars{Now: until}, nil),
+			RecordsPath: s.RecordsPath,
+		}
+		n, err := e.fetchSource(context.Background(), src, e.ChunkSize, nil, func([]map[string]interface{}) error { return nil })
+		if err != nil {
+			return 0, fmt.Errorf("source count failed: %w", err)
+		}
+		return int64(n), nil
+	}
+
+	ctx := context.Background()
+	if e.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.FetchTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, expandWindow(s.CountURL, since, until), nil)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count url: %w", err)
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("count request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return 0, fmt.Errorf("count request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("count request returned http status %d", resp.StatusCode)
+	}
+	return parseCount(body)
+}
+
+// parseCount reads a total from a JSON number or an object's "count" or "total"
+func parseCount(body []byte) (int64, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return 0, fmt.Errorf("count response is not JSON: %w", err)
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		if c, found := obj["count"]; found {
+			v = c
+		} else {
+			v = obj["total"]
+		}
+	}
+	switch n := v.(type) {
+	case float64:
+		return int64(n), nil
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	}
+	return 0, errors.New(`count response must be a number or an object with "count" or "total"`)
+}
+
+// loadedCount counts the rows loaded for the window
+func (e *ETLProcessor) loadedCount(table, column string, since, until time.Time) (int64, error) {
+	var n int64
+	if column == "" {
+		err := e.DB.Get(&n, `
+			SELECT COALESCE(SUM(rows_inserted), 0) FROM refresh_logs
+			WHERE table_name = $1 AND status IN ('OK', 'WARN') AND created_at > $2 AND created_at <= $3`,
+			table, since, until)
+		return n, err
+	}
+
+	t, err := e.parseTable(table)
+	if err != nil {
+		return 0, err
+	}
+	cols, err := db.TableColumns(e.DB, table)
+	if err != nil {
+		return 0, err
+	}
+	found := false
+	for _, c := range cols {
+		found = found || c.ColumnName == column
+	}
+	if !found {
+		return 0, fmt.Errorf("reconcile column %s does not exist", column)
+	}
+	err = e.DB.Get(&n, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE "%s" >= $1 AND "%s" < $2`, t.Quoted(), column, column), since, until)
+	return n, err
+}
+
+// expandWindow substitutes the window bounds into a source URL, and the
+// date placeholders as of until
+func expandWindow(rawURL string, since, until time.Time) string {
+	rawURL = URLVars{Now: until}.Expand(rawURL)
+	return strings.NewReplacer(
+		SincePlaceholder, url.QueryEscape(since.Format(time.RFC3339)),
+		UntilPlaceholder, url.QueryEscape(until.Format(time.RFC3339)),
+	).Replace(rawURL)
+}
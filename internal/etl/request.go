@@ -0,0 +1,93 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SourceRequest is how a source is requested when a plain GET won't do,
+// e.g. search APIs taking a JSON filter by POST. It is stored as JSON in
+// table_metadata.request or on one of a table's data_sources.
+type SourceRequest struct {
+	Method      string `json:"method,omitempty"`       // GET (default), POST, PUT or PATCH
+	Body        string `json:"body,omitempty"`         // may use {watermark} and the date placeholders
+	ContentType string `json:"content_type,omitempty"` // default application/json when there is a body
+}
+
+// Check validates the method and that only methods with a body get one
+func (r *SourceRequest) Check() error {
+	switch r.method() {
+	case http.MethodGet:
+		if r.Body != "" {
+			return fmt.Errorf("a request body needs method POST, PUT or PATCH")
+		}
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("unsupported method %q (GET, POST, PUT or PATCH)", r.Method)
+	}
+	return nil
+}
+
+func (r *SourceRequest) method() string {
+	if r == nil || r.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(r.Method)
+}
+
+// body is the request body; "" for a nil r
+func (r *SourceRequest) body() string {
+	if r == nil {
+		return ""
+	}
+	return r.Body
+}
+
+func (r *SourceRequest) contentType() string {
+	if r.ContentType == "" {
+		return "application/json"
+	}
+	return r.ContentType
+}
+
+// expand returns a copy of r with the placeholders in its body filled in.
+// Values are escaped as JSON string contents when the body is JSON, so
+// templates quote them: {"updated_since": "{watermark}"}.
+func (r *SourceRequest) expand(vars URLVars, mark *Watermark) *SourceRequest {
+	if r == nil || r.Body == "" {
+		return r
+	}
+	escape := func(s string) string { return s }
+	if strings.Contains(r.contentType(), "json") {
+		escape = func(s string) string {
+			b, _ := json.Marshal(s)
+			return string(b[1 : len(b)-1])
+		}
+	}
+	out := *r
+	out.Body = vars.replace(out.Body, escape)
+	if mark != nil {
+		v := ""
+		if mark.Value != nil {
+			v = *mark.Value
+		}
+		out.Body = strings.ReplaceAll(out.Body, WatermarkPlaceholder, escape(v))
+	}
+	return &out
+}
+
+// build creates the HTTP request for url; a nil r is a plain GET
+func (r *SourceRequest) build(ctx context.Context, url string) (*http.Request, error) {
+	if r == nil || r.Body == "" {
+		return http.NewRequestWithContext(ctx, r.method(), url, nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method(), url, strings.NewReader(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", r.contentType())
+	return req, nil
+}
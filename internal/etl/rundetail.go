@@ -0,0 +1,214 @@
+package etl
+
+import (
+	"context"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTracedRequests bounds the source requests kept per run; paginated
+// sources can make a thousand
+const maxTracedRequests = 50
+
+// maxRejectedRows bounds the skipped rows listed per run
+const maxRejectedRows = 100
+
+// Pipeline stages in RunDetail.Stages, in order
+const (
+	StageFetch     = "fetch"     // request and decode the sources
+	StageTransform = "transform" // flatten nested records
+	StageValidate  = "validate"  // coerce to the table's column types
+	StageFilter    = "filter"    // incremental tables: drop rows at or below the watermark
+	StageInsert    = "insert"    // write chunks to the table, or its staging table
+	StageSwap      = "swap"      // replace and merge modes: move staged rows into the table
+)
+
+// RunDetail is the record of one refresh for post-mortem debugging,
+// stored with the run in refresh_logs.details
+type RunDetail struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	DurationMs int64         `json:"duration_ms"`
+	Stages     []StageDetail `json:"stages"`
+	Requests   []SourceCall  `json:"requests"`
+	// RequestsOmitted counts requests past maxTracedRequests
+	RequestsOmitted int      `json:"requests_omitted,omitempty"`
+	Warnings        []string `json:"warnings"`
+	// Rejected counts the rows insert modes batch and row skipped;
+	// RejectedRows lists why, up to maxRejectedRows entries. Index is the
+	// row's position among the rows fetched by the run; a skipped chunk is
+	// one entry at its first row.
+	Rejected     int        `json:"rejected,omitempty"`
+	RejectedRows []RowIssue `json:"rejected_rows,omitempty"`
+}
+
+// StageDetail is one pipeline stage's share of a run. Stages overlap, so
+// their busy times add up to more than the run's duration.
+type StageDetail struct {
+	Name    string `json:"name"`
+	BusyMs  int64  `json:"busy_ms"` // time spent working, not waiting on the next or previous stage
+	Chunks  int    `json:"chunks"`
+	RowsIn  int    `json:"rows_in"` // 0 for fetch
+	RowsOut int    `json:"rows_out"`
+}
+
+// SourceCall is a request made to a source
+type SourceCall struct {
+	Source      string    `json:"source,omitempty"` // data_sources name
+	Method      string    `json:"method"`
+	URL         string    `json:"url"` // with credentials and secret-looking query values redacted
+	ContentType string    `json:"content_type,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	Conditional bool      `json:"conditional,omitempty"` // sent with If-None-Match / If-Modified-Since
+	Status      int       `json:"status,omitempty"`      // 0 when no response came
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// rejectLog collects the rows a best-effort run skipped. The validate
+// and insert stages both add to it.
+type rejectLog struct {
+	mu     sync.Mutex
+	count  int
+	issues []RowIssue
+}
+
+// add counts n skipped rows, explained by issue
+func (r *rejectLog) add(n int, issue RowIssue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count += n
+	if len(r.issues) < maxRejectedRows {
+		r.issues = append(r.issues, issue)
+	}
+}
+
+// stageClock accumulates one stage's busy time and counts. Each stage is
+// only touched by its own goroutine.
+type stageClock struct {
+	StageDetail
+	busy time.Duration
+}
+
+// add counts a chunk the stage started on at start
+func (s *stageClock) add(start time.Time, in, out int) {
+	s.busy += time.Since(start)
+	s.Chunks++
+	s.RowsIn += in
+	s.RowsOut += out
+}
+
+func (s *stageClock) detail() StageDetail {
+	d := s.StageDetail
+	d.BusyMs = s.busy.Milliseconds()
+	return d
+}
+
+// detail assembles the RunDetail of a run started at started
+func (t *requestTrace) detail(started time.Time, stages []*stageClock, warnings []string) *RunDetail {
+	finished := time.Now()
+	d := &RunDetail{
+		StartedAt:  started.UTC(),
+		FinishedAt: finished.UTC(),
+		DurationMs: finished.Sub(started).Milliseconds(),
+		Stages:     make([]StageDetail, len(stages)),
+		Warnings:   warnings,
+	}
+	for i, s := range stages {
+		d.Stages[i] = s.detail()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d.Requests, d.RequestsOmitted = t.calls, t.omitted
+	if d.Requests == nil {
+		d.Requests = []SourceCall{}
+	}
+	if d.Warnings == nil {
+		d.Warnings = []string{}
+	}
+	return d
+}
+
+// requestTrace collects the source requests of a run; fetches find it
+// in their context
+type requestTrace struct {
+	mu      sync.Mutex
+	calls   []SourceCall
+	omitted int
+}
+
+// traceSource is the context value: the run's trace and the source being fetched
+type traceSource struct {
+	trace  *requestTrace
+	source string
+}
+
+type traceKey struct{}
+
+// withTrace returns ctx recording the requests made under it to t, as
+// made to the named source
+func withTrace(ctx context.Context, t *requestTrace, source string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceSource{t, source})
+}
+
+// traceRequest records req, sent at start, and how it went; a no-op
+// unless ctx came from withTrace
+func traceRequest(ctx context.Context, req *http.Request, body string, start time.Time, resp *http.Response, err error) {
+	ts, ok := ctx.Value(traceKey{}).(traceSource)
+	if !ok {
+		return
+	}
+	call := SourceCall{
+		Source:      ts.source,
+		Method:      req.Method,
+		URL:         redactURL(req.URL),
+		ContentType: req.Header.Get("Content-Type"),
+		Body:        body,
+		Conditional: req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "",
+		StartedAt:   start.UTC(),
+		DurationMs:  time.Since(start).Milliseconds(),
+	}
+	if resp != nil {
+		call.Status = resp.StatusCode
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	ts.trace.mu.Lock()
+	defer ts.trace.mu.Unlock()
+	if len(ts.trace.calls) >= maxTracedRequests {
+		ts.trace.omitted++
+		return
+	}
+	ts.trace.calls = append(ts.trace.calls, call)
+}
+
+// secretParams are query parameter name fragments whose values redactURL hides
+var secretParams = []string{"key", "token", "secret", "password", "signature", "auth", "credential"}
+
+// redactURL is u without credentials, and with the values of query
+// parameters that look like secrets (api_key, access_token, …) replaced
+func redactURL(u *neturl.URL) string {
+	out := *u
+	out.User = nil
+	q := out.Query()
+	redacted := false
+	for name := range q {
+		lower := strings.ToLower(name)
+		for _, s := range secretParams {
+			if strings.Contains(lower, s) {
+				q[name] = []string{"REDACTED"}
+				redacted = true
+				break
+			}
+		}
+	}
+	if redacted {
+		out.RawQuery = q.Encode()
+	}
+	return out.String()
+}
@@ -0,0 +1,29 @@
+package etl
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultSoftDeleteGrace is how long soft-deleted rows are kept before
+// the purge when soft delete is turned on without a grace period
+const DefaultSoftDeleteGrace = 30 * 24 * time.Hour
+
+// SoftDeletes reports whether table is in soft delete mode
+// (table_metadata.soft_delete): row deletes stamp DeletedAtColumn instead
+// of removing rows, and queries skip stamped rows unless asked for them
+func SoftDeletes(q sqlx.Queryer, table string) (bool, error) {
+	var on bool
+	err := sqlx.Get(q, &on, `SELECT soft_delete FROM table_metadata WHERE table_name = $1`, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("soft delete lookup failed: %w", err)
+	}
+	return on, nil
+}
@@ -0,0 +1,210 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Source is one of a table's data_sources, e.g. one region's API. Tables
+// without data_sources load from data_source_url alone.
+type Source struct {
+	Name       string         `json:"name"`
+	URL        string         `json:"url"`
+	Pagination *Pagination    `json:"pagination,omitempty"` // overrides the table's pagination
+	Request    *SourceRequest `json:"request,omitempty"`    // overrides the table's request
+
+	// RecordsPath locates the records in wrapped payloads such as
+	// {"status": "ok", "results": [...]}; see parsePath. Overrides the
+	// table's records_path.
+	RecordsPath string `json:"records_path,omitempty"`
+}
+
+// expand returns s with the placeholders in its URL and request body
+// filled in; mark is nil unless the refresh is incremental
+func (s Source) expand(vars URLVars, mark *Watermark) Source {
+	s.URL = vars.Expand(s.URL)
+	if mark != nil {
+		s.URL = mark.ExpandURL(s.URL)
+	}
+	s.Request = s.Request.expand(vars, mark)
+	return s
+}
+
+// fetchSource fetches src page by page when it has pagination settings,
+// otherwise in one streamed response (conditionally when cond is set)
+func (e *ETLProcessor) fetchSource(ctx context.Context, src Source, chunkSize int, cond *conditional, fn func(chunk []map[string]interface{}) error) (int, error) {
+	if src.Pagination != nil {
+		return e.fetchPages(ctx, src, chunkSize, fn)
+	}
+	return e.fetchStream(ctx, src, chunkSize, cond, fn)
+}
+
+// Per-source outcomes in SourceResult.Status
+const (
+	SourceOK      = "OK"
+	SourceError   = "ERROR"
+	SourceSkipped = "SKIPPED" // not fetched, or cut short, because the run had already failed
+)
+
+// SourceResult is how one source fared in a refresh, stored with the run
+// in refresh_logs.sources
+type SourceResult struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"` // without credentials or query string
+	Status  string `json:"status"`
+	Fetched int    `json:"fetched"` // records decoded from the source
+	Rows    int    `json:"rows"`    // rows it contributed to the load
+	Error   string `json:"error,omitempty"`
+}
+
+// CheckSources validates a data_sources list: every source needs a URL
+// and a name unique within the table
+func CheckSources(sources []Source) error {
+	seen := map[string]bool{}
+	for i, s := range sources {
+		if strings.TrimSpace(s.Name) == "" {
+			return fmt.Errorf("source %d has no name", i+1)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("duplicate source name %q", s.Name)
+		}
+		seen[s.Name] = true
+		if strings.TrimSpace(s.URL) == "" {
+			return fmt.Errorf("source %q has no url", s.Name)
+		}
+		if s.Pagination != nil {
+			if err := s.Pagination.Check(); err != nil {
+				return fmt.Errorf("source %q: %w", s.Name, err)
+			}
+		}
+		if s.Request != nil {
+			if err := s.Request.Check(); err != nil {
+				return fmt.Errorf("source %q: %w", s.Name, err)
+			}
+		}
+		if err := CheckRecordsPath(s.RecordsPath); err != nil {
+			return fmt.Errorf("source %q: invalid records_path: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadSources reads the sources a refresh of table fetches: its
+// data_sources, or data_source_url when it has none. The table's
+// pagination, request and records_path apply to every source without
+// their own.
+func (e *ETLProcessor) LoadSources(table string) ([]Source, error) {
+	var row struct {
+		URL        *string          `db:"data_source_url"`
+		Sources    *json.RawMessage `db:"data_sources"`
+		Pagination *json.RawMessage `db:"pagination"`
+		Request    *json.RawMessage `db:"request"`
+		Records    *string          `db:"records_path"`
+	}
+	if err := e.DB.Get(&row, `SELECT data_source_url, data_sources, pagination, request, records_path FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return nil, fmt.Errorf("load sources failed: %w", err)
+	}
+	paging, err := parsePagination(row.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	request, err := parseRequest(row.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []Source
+	if row.Sources != nil {
+		if err := json.Unmarshal(*row.Sources, &sources); err != nil {
+			return nil, fmt.Errorf("invalid data_sources: %w", err)
+		}
+	}
+	if len(sources) == 0 {
+		if row.URL == nil {
+			return nil, fmt.Errorf("table has no data_source_url")
+		}
+		sources = []Source{{URL: *row.URL}}
+	}
+	for i := range sources {
+		if sources[i].Pagination == nil {
+			sources[i].Pagination = paging
+		}
+		if sources[i].Request == nil {
+			sources[i].Request = request
+		}
+		if sources[i].RecordsPath == "" && row.Records != nil {
+			sources[i].RecordsPath = *row.Records
+		}
+	}
+	return sources, nil
+}
+
+// parseRequest decodes a stored table_metadata.request; nil when unset
+func parseRequest(raw *json.RawMessage) (*SourceRequest, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var r SourceRequest
+	if err := json.Unmarshal(*raw, &r); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	return &r, nil
+}
+
+// parsePagination decodes a stored table_metadata.pagination; nil when unset
+func parsePagination(raw *json.RawMessage) (*Pagination, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var p Pagination
+	if err := json.Unmarshal(*raw, &p); err != nil {
+		return nil, fmt.Errorf("invalid pagination: %w", err)
+	}
+	return &p, nil
+}
+
+// WriteRefreshLogRun records a refresh run like WriteRefreshLogRows (or
+// WriteRefreshLogError when err is set), plus the per-source results of
+// tables with data_sources, the run's RunDetail and the parameters to
+// retry it with. It returns the run's refresh_logs id.
+func (e *ETLProcessor) WriteRefreshLogRun(tableName, status, message string, r RefreshResult, err error) (int, error) {
+	var rows, code, sources, details, params, retryOf interface{}
+	if err != nil {
+		code = ErrorCode(err)
+	} else {
+		rows = r.Inserted
+	}
+	if len(r.Sources) > 0 {
+		b, jerr := json.Marshal(r.Sources)
+		if jerr != nil {
+			return 0, jerr
+		}
+		sources = b
+	}
+	if r.Detail != nil {
+		b, jerr := json.Marshal(r.Detail)
+		if jerr != nil {
+			return 0, jerr
+		}
+		details = b
+	}
+	if r.Params != nil {
+		b, jerr := json.Marshal(r.Params)
+		if jerr != nil {
+			return 0, jerr
+		}
+		params = b
+	}
+	if r.RetryOf > 0 {
+		retryOf = r.RetryOf
+	}
+	var id int
+	dbErr := e.DB.Get(&id, `
+		INSERT INTO refresh_logs (table_name, status, message, rows_inserted, error_code, sources, details, params, retry_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		tableName, status, message, rows, code, sources, details, params, retryOf)
+	return id, dbErr
+}
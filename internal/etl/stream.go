@@ -0,0 +1,257 @@
+package etl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// -----------------------------
+// FetchStream
+// Fetches URL and decodes the JSON body incrementally, calling fn with
+// chunks of at most chunkSize rows. Top-level arrays are decoded one
+// element at a time, so memory stays bounded by the chunk size rather
+// than the response size. A top-level object is delivered as one row.
+// Returns the number of rows decoded.
+// -----------------------------
+func (e *ETLProcessor) FetchStream(url string, chunkSize int, fn func(chunk []map[string]interface{}) error) (int, error) {
+	return e.fetchStream(context.Background(), Source{URL: url}, chunkSize, nil, fn)
+}
+
+// fetchStream is FetchStream for src (its URL, request and records path)
+// with cancellation and optional change detection:
+// a conditional GET when validators are known, or a payload checksum when the
+// source sends none (the body is spooled to a temp file so it can be hashed
+// before any row is emitted). If the source is unchanged, cond.unchanged is
+// set and fn is never called.
+func (e *ETLProcessor) fetchStream(ctx context.Context, src Source, chunkSize int, cond *conditional, fn func(chunk []map[string]interface{}) error) (int, error) {
+	if src.URL == "" {
+		return 0, classify(CodeUpstreamHTTP, errors.New("empty data source url"))
+	}
+	if chunkSize <= 0 {
+		chunkSize = 1
+	}
+	if e.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.FetchTimeout)
+		defer cancel()
+	}
+
+	req, err := src.Request.build(ctx, src.URL)
+	if err != nil {
+		return 0, classify(CodeUpstreamHTTP, fmt.Errorf("invalid request: %w", err))
+	}
+	if cond != nil {
+		cond.apply(req)
+	}
+	start := time.Now()
+	resp, err := e.Client.Do(req)
+	traceRequest(ctx, req, src.Request.body(), start, resp, err)
+	if err != nil {
+		return 0, classify(CodeUpstreamHTTP, fmt.Errorf("http get failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if cond != nil {
+		if resp.StatusCode == http.StatusNotModified {
+			cond.unchanged = "source not modified (HTTP 304)"
+			return 0, nil
+		}
+		cond.record(resp)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return 0, classify(CodeUpstreamHTTP, fmt.Errorf("http status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	var body io.Reader = resp.Body
+	if e.MaxResponseBytes > 0 {
+		body = http.MaxBytesReader(nil, resp.Body, e.MaxResponseBytes)
+	}
+
+	if cond != nil && cond.needsChecksum() {
+		f, sum, cleanup, err := spool(body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return 0, fetchBodyError(err)
+			}
+			return 0, classify(CodeUpstreamHTTP, err)
+		}
+		defer cleanup()
+
+		cond.next.Checksum = sum
+		if sum == cond.prev.Checksum {
+			cond.unchanged = "payload checksum matches the previous run"
+			return 0, nil
+		}
+		body = f
+	}
+
+	total, err := decodeRows(bufio.NewReader(body), src.RecordsPath, chunkSize, fn)
+	if err != nil {
+		return total, fetchBodyError(err)
+	}
+	return total, nil
+}
+
+// fetchBodyError reports an oversized body as an upstream failure
+func fetchBodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return classify(CodeUpstreamHTTP, fmt.Errorf("response exceeds max size of %d bytes", tooLarge.Limit))
+	}
+	return err
+}
+
+// decodeRows reads an object or array of objects from r, emitting chunks to fn.
+// With a records path the records are the value at that path instead of
+// the whole document. Decode problems are classified as UPSTREAM_SCHEMA;
+// errors from fn pass through.
+func decodeRows(r *bufio.Reader, path string, chunkSize int, fn func([]map[string]interface{}) error) (int, error) {
+	keys, err := parsePath(path)
+	if err != nil {
+		return 0, classify(CodeUpstreamSchema, fmt.Errorf("invalid records_path: %w", err))
+	}
+	if len(keys) > 0 {
+		return decodeAtPath(r, path, keys, chunkSize, fn)
+	}
+
+	first, err := peekNonSpace(r)
+	if err != nil {
+		return 0, schemaError(fmt.Errorf("json decode failed: %w", err))
+	}
+
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	switch first {
+	case '{':
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			return 0, schemaError(fmt.Errorf("json decode failed: %w", err))
+		}
+		if err := fn([]map[string]interface{}{obj}); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	case '[':
+		// consume the opening bracket, then decode one element at a time
+		if _, err := decoder.Token(); err != nil {
+			return 0, schemaError(fmt.Errorf("json decode failed: %w", err))
+		}
+	default:
+		return 0, classify(CodeUpstreamSchema, errors.New("unexpected JSON type: expected object or array of objects (set records_path for wrapped payloads)"))
+	}
+	return decodeArray(decoder, chunkSize, fn)
+}
+
+// decodeAtPath streams the records at keys: an array of objects, a single
+// object, or null for none
+func decodeAtPath(r *bufio.Reader, path string, keys []string, chunkSize int, fn func([]map[string]interface{}) error) (int, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	found, err := seekPath(decoder, keys)
+	if err != nil {
+		return 0, schemaError(fmt.Errorf("json decode failed: %w", err))
+	}
+	if !found {
+		return 0, classify(CodeUpstreamSchema, pathError(path, false))
+	}
+
+	tok, err := decoder.Token()
+	if err != nil {
+		return 0, schemaError(fmt.Errorf("json decode failed: %w", err))
+	}
+	switch tok {
+	case json.Delim('['):
+		return decodeArray(decoder, chunkSize, fn)
+	case json.Delim('{'):
+		obj := map[string]interface{}{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return 0, schemaError(fmt.Errorf("json decode failed: %w", err))
+			}
+			var v interface{}
+			if err := decoder.Decode(&v); err != nil {
+				return 0, schemaError(fmt.Errorf("json decode failed: %w", err))
+			}
+			obj[key.(string)] = v
+		}
+		if err := fn([]map[string]interface{}{obj}); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	case nil:
+		return 0, nil
+	}
+	return 0, classify(CodeUpstreamSchema, pathError(path, true))
+}
+
+// decodeArray emits the objects of an array whose opening bracket the
+// decoder has just consumed
+func decodeArray(decoder *json.Decoder, chunkSize int, fn func([]map[string]interface{}) error) (int, error) {
+	total := 0
+	chunk := make([]map[string]interface{}, 0, chunkSize)
+	for decoder.More() {
+		var item interface{}
+		if err := decoder.Decode(&item); err != nil {
+			return total, schemaError(fmt.Errorf("json decode failed: %w", err))
+		}
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return total, classify(CodeUpstreamSchema, errors.New("array items are not objects"))
+		}
+		chunk = append(chunk, m)
+
+		if len(chunk) == chunkSize {
+			if err := fn(chunk); err != nil {
+				return total, err
+			}
+			total += len(chunk)
+			chunk = make([]map[string]interface{}, 0, chunkSize)
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return total, schemaError(fmt.Errorf("json decode failed: %w", err))
+	}
+
+	if len(chunk) > 0 {
+		if err := fn(chunk); err != nil {
+			return total, err
+		}
+		total += len(chunk)
+	}
+	return total, nil
+}
+
+// schemaError classifies a decode failure, leaving size-limit errors for the caller to report
+func schemaError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return classify(CodeUpstreamSchema, err)
+}
+
+// peekNonSpace returns the first non-whitespace byte without consuming it
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, r.UnreadByte()
+	}
+}
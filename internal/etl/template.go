@@ -0,0 +1,72 @@
+package etl
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Date and time placeholders expanded in source URLs at fetch time, e.g.
+// https://partner.example.com/exports/{yesterday}.json. Each may carry a
+// Go time layout after a colon ({today:20060102}); the defaults are below.
+// Times are UTC and the values are query-escaped.
+const (
+	TodayPlaceholder     = "today"        // 2006-01-02
+	YesterdayPlaceholder = "yesterday"    // 2006-01-02
+	NowPlaceholder       = "now_iso"      // RFC3339
+	LastRunPlaceholder   = "last_run_iso" // RFC3339 of the last successful refresh; empty before the first
+)
+
+// placeholderPattern matches {name} and {name:layout}
+var placeholderPattern = regexp.MustCompile(`\{(today|yesterday|now_iso|last_run_iso)(?::([^{}]+))?\}`)
+
+// URLVars are the values date placeholders expand to
+type URLVars struct {
+	Now     time.Time
+	LastRun *time.Time // nil before the first successful refresh
+}
+
+// Expand substitutes the date placeholders in rawURL; other text,
+// including {watermark}, is left alone
+func (v URLVars) Expand(rawURL string) string {
+	return v.replace(rawURL, url.QueryEscape)
+}
+
+// replace substitutes the date placeholders in s, passing each value through escape
+func (v URLVars) replace(s string, escape func(string) string) string {
+	return placeholderPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := placeholderPattern.FindStringSubmatch(m)
+		name, layout := sub[1], sub[2]
+		var t time.Time
+		switch name {
+		case TodayPlaceholder:
+			t = v.Now
+		case YesterdayPlaceholder:
+			t = v.Now.AddDate(0, 0, -1)
+		case NowPlaceholder:
+			t = v.Now
+		case LastRunPlaceholder:
+			if v.LastRun == nil {
+				return ""
+			}
+			t = *v.LastRun
+		}
+		if layout == "" {
+			layout = time.RFC3339
+			if name == TodayPlaceholder || name == YesterdayPlaceholder {
+				layout = time.DateOnly
+			}
+		}
+		return escape(t.UTC().Format(layout))
+	})
+}
+
+// LoadURLVars reads the placeholder values for a refresh of table starting now
+func (e *ETLProcessor) LoadURLVars(table string) (URLVars, error) {
+	var last *time.Time
+	if err := e.DB.Get(&last, `SELECT last_refresh_success FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return URLVars{}, fmt.Errorf("load last run failed: %w", err)
+	}
+	return URLVars{Now: time.Now(), LastRun: last}, nil
+}
@@ -0,0 +1,142 @@
+package etl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WatermarkPlaceholder in a data_source_url is replaced with the current
+// watermark (URL-escaped, empty before the first load), e.g.
+// https://api.example.com/events?since={watermark}
+const WatermarkPlaceholder = "{watermark}"
+
+// Watermark tracks incremental progress for a table: rows whose Column
+// value is not greater than Value were loaded by an earlier refresh.
+type Watermark struct {
+	Column string
+	Value  *string // nil until the first successful load
+}
+
+// LoadWatermark reads a table's watermark settings; ok is false for full-refresh tables
+func (e *ETLProcessor) LoadWatermark(table string) (Watermark, bool, error) {
+	var row struct {
+		Column *string `db:"watermark_column"`
+		Value  *string `db:"watermark_value"`
+	}
+	err := e.DB.Get(&row, `SELECT watermark_column, watermark_value FROM table_metadata WHERE table_name = $1`, table)
+	if err != nil {
+		return Watermark{}, false, fmt.Errorf("load watermark failed: %w", err)
+	}
+	if row.Column == nil || *row.Column == "" {
+		return Watermark{}, false, nil
+	}
+	return Watermark{Column: *row.Column, Value: row.Value}, true, nil
+}
+
+// SaveWatermark stores the new high-water value for a table
+func (e *ETLProcessor) SaveWatermark(table, value string) error {
+	_, err := e.DB.Exec(`UPDATE table_metadata SET watermark_value = $1, updated_at = CURRENT_TIMESTAMP WHERE table_name = $2`, value, table)
+	return err
+}
+
+// ExpandURL substitutes the watermark into a source URL
+func (w Watermark) ExpandURL(rawURL string) string {
+	if !strings.Contains(rawURL, WatermarkPlaceholder) {
+		return rawURL
+	}
+	v := ""
+	if w.Value != nil {
+		v = *w.Value
+	}
+	return strings.ReplaceAll(rawURL, WatermarkPlaceholder, url.QueryEscape(v))
+}
+
+// Filter drops rows already covered by the watermark. Rows without the
+// watermark column are kept, since there is nothing to compare.
+func (w Watermark) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if w.Value == nil {
+		return rows
+	}
+	out := rows[:0]
+	for _, r := range rows {
+		if !w.Covers(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Covers reports whether a refresh has already loaded r: its watermark
+// column is at or below the watermark
+func (w Watermark) Covers(r map[string]interface{}) bool {
+	if w.Value == nil {
+		return false
+	}
+	v, ok := r[w.Column]
+	return ok && v != nil && compareWatermark(v, *w.Value) <= 0
+}
+
+// Max returns the highest watermark column value in rows, starting from current
+func (w Watermark) Max(rows []map[string]interface{}, current *string) *string {
+	best := current
+	for _, r := range rows {
+		v, ok := r[w.Column]
+		if !ok || v == nil {
+			continue
+		}
+		if best == nil || compareWatermark(v, *best) > 0 {
+			s := watermarkString(v)
+			best = &s
+		}
+	}
+	return best
+}
+
+// compareWatermark orders a row value against a stored watermark:
+// numerically when both are numbers, chronologically when both are
+// timestamps, otherwise as strings.
+func compareWatermark(v interface{}, mark string) int {
+	s := watermarkString(v)
+
+	if a, err := strconv.ParseFloat(s, 64); err == nil {
+		if b, err := strconv.ParseFloat(mark, 64); err == nil {
+			return cmp(a < b, a > b)
+		}
+	}
+	if a, err := tryParseTime(s); err == nil {
+		if b, err := tryParseTime(mark); err == nil {
+			return cmp(a.Before(b), a.After(b))
+		}
+	}
+	return strings.Compare(s, mark)
+}
+
+func cmp(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// watermarkString renders a value the way it is stored in watermark_value
+func watermarkString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprint(t)
+	}
+}
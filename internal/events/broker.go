@@ -0,0 +1,103 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published on the broker
+const (
+	JobStarted    = "job.started"
+	JobSucceeded  = "job.succeeded"
+	JobFailed     = "job.failed"
+	JobEscalated  = "job.escalated"
+	TableCreated  = "table.created"
+	TableDeleted  = "table.deleted"
+	RowsIngested  = "rows.ingested"
+	RowsUpdated   = "rows.updated"
+	RowsDeleted   = "rows.deleted"
+	QualityFailed = "quality.failed"
+	VolumeAnomaly = "volume.anomaly"
+	SchemaDrift   = "schema.drift"
+
+	ReconcileMismatch = "reconcile.mismatch"
+	SinkExported      = "sink.exported"
+	SinkFailed        = "sink.failed"
+	ImportProgress    = "import.progress"
+	RollupFailed      = "rollup.failed"
+)
+
+// Event is a single pipeline activity notification
+type Event struct {
+	Type    string                 `json:"type"`
+	Table   string                 `json:"table"`
+	Message string                 `json:"message,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Time    time.Time              `json:"time"`
+}
+
+// Broker fans events out to all current subscribers.
+// Slow subscribers drop events instead of blocking publishers.
+type Broker struct {
+	mu     sync.RWMutex
+	subs   map[chan Event]struct{}
+	buffer int
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{
+		subs:   make(map[chan Event]struct{}),
+		buffer: 64,
+	}
+}
+
+// Subscribe returns a channel receiving future events
+func (b *Broker) Subscribe() chan Event {
+	ch := make(chan Event, b.buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe removes and closes a subscriber channel
+func (b *Broker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+}
+
+// Publish sends an event to every subscriber. Safe to call on a nil broker.
+func (b *Broker) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			// subscriber is behind; drop rather than stall the pipeline
+		}
+	}
+}
+
+// Close disconnects all subscribers (used on server shutdown so
+// long-lived streams don't hold the HTTP server open)
+func (b *Broker) Close() {
+	b.mu.Lock()
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+}
@@ -0,0 +1,430 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// Rows buffered per Arrow record batch
+const arrowBatchSize = 10000
+
+// Arrow type ids and enums (Schema.fbs, Message.fbs)
+const (
+	arTypeInt       = 2
+	arTypeFloat     = 3
+	arTypeUtf8      = 5
+	arTypeBool      = 6
+	arTypeTimestamp = 10
+
+	arHeaderSchema      = 1
+	arHeaderRecordBatch = 3
+
+	arMetadataV5   = 4
+	arDouble       = 2
+	arMicrosecond  = 2
+	arContinuation = 0xFFFFFFFF
+)
+
+// arrowColumn buffers one column of the current record batch
+type arrowColumn struct {
+	name    string
+	typ     int
+	valid   []bool
+	nulls   int
+	values  bytes.Buffer // fixed-width values, or UTF-8 data
+	offsets []int32      // utf8 only
+	bools   []bool
+}
+
+// arrowWriter writes the Arrow IPC streaming format: a schema message,
+// one record batch per arrowBatchSize rows, then the end-of-stream marker.
+// Columns are flat and nullable, without dictionaries or compression.
+type arrowWriter struct {
+	w       io.Writer
+	columns []*arrowColumn
+	rows    int
+	started bool
+	err     error
+}
+
+func newArrowWriter(w io.Writer, columns []db.Column) *arrowWriter {
+	aw := &arrowWriter{w: w}
+	for _, c := range columns {
+		col := &arrowColumn{name: c.ColumnName, typ: arTypeUtf8, offsets: []int32{0}}
+		switch t := strings.ToLower(c.DataType); {
+		case strings.Contains(t, "timestamp"):
+			col.typ = arTypeTimestamp
+		case strings.Contains(t, "bool"):
+			col.typ = arTypeBool
+		case strings.Contains(t, "int"):
+			col.typ = arTypeInt
+		case strings.Contains(t, "double"), strings.Contains(t, "real"), strings.Contains(t, "float"),
+			strings.Contains(t, "numeric"), strings.Contains(t, "decimal"):
+			col.typ = arTypeFloat
+		}
+		aw.columns = append(aw.columns, col)
+	}
+	return aw
+}
+
+func (aw *arrowWriter) Write(row map[string]interface{}) error {
+	if aw.err != nil {
+		return aw.err
+	}
+	aw.start()
+	for _, col := range aw.columns {
+		if err := col.append(row[col.name]); err != nil {
+			// the batch is now ragged, so the stream cannot be finished
+			aw.err = err
+			return err
+		}
+	}
+	aw.rows++
+	if aw.rows == arrowBatchSize {
+		aw.flushBatch()
+	}
+	return aw.err
+}
+
+// Flush is a no-op: record batches are written whole once full
+func (aw *arrowWriter) Flush() error { return aw.err }
+
+func (aw *arrowWriter) Close() error {
+	aw.start()
+	if aw.rows > 0 {
+		aw.flushBatch()
+	}
+	var eos [8]byte
+	binary.LittleEndian.PutUint32(eos[:4], arContinuation)
+	aw.write(eos[:])
+	return aw.err
+}
+
+func (aw *arrowWriter) write(b []byte) {
+	if aw.err != nil {
+		return
+	}
+	_, aw.err = aw.w.Write(b)
+}
+
+// start writes the schema message before the first batch
+func (aw *arrowWriter) start() {
+	if aw.started {
+		return
+	}
+	aw.started = true
+
+	fields := make(fbVector, len(aw.columns))
+	for i, col := range aw.columns {
+		var typ fbTable
+		switch col.typ {
+		case arTypeInt:
+			typ = fbTable{{slot: 0, size: 4, scalar: 64}, {slot: 1, size: 1, scalar: 1}} // signed 64-bit
+		case arTypeFloat:
+			typ = fbTable{{slot: 0, size: 2, scalar: arDouble}}
+		case arTypeTimestamp:
+			typ = fbTable{{slot: 0, size: 2, scalar: arMicrosecond}, {slot: 1, child: fbString("UTC")}}
+		default:
+			typ = fbTable{}
+		}
+		fields[i] = fbTable{
+			{slot: 0, child: fbString(col.name)},
+			{slot: 1, size: 1, scalar: 1}, // nullable
+			{slot: 2, size: 1, scalar: uint64(col.typ)},
+			{slot: 3, child: typ},
+			{slot: 5, child: fbVector{}}, // children, required by readers even when empty
+		}
+	}
+	schema := fbTable{{slot: 0, size: 2, scalar: 0}, {slot: 1, child: fields}} // little-endian
+	aw.message(arHeaderSchema, schema, nil)
+}
+
+// flushBatch writes the buffered rows as one record batch
+func (aw *arrowWriter) flushBatch() {
+	var body bytes.Buffer
+	var nodes, buffers []byte
+	addBuffer := func(b []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(body.Len()))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(b)))
+		body.Write(b)
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	for _, col := range aw.columns {
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(aw.rows))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(col.nulls))
+		if col.nulls > 0 {
+			addBuffer(bitmap(col.valid))
+		} else {
+			addBuffer(nil)
+		}
+		switch col.typ {
+		case arTypeBool:
+			addBuffer(bitmap(col.bools))
+		case arTypeUtf8:
+			offsets := make([]byte, 0, 4*len(col.offsets))
+			for _, o := range col.offsets {
+				offsets = binary.LittleEndian.AppendUint32(offsets, uint32(o))
+			}
+			addBuffer(offsets)
+			addBuffer(col.values.Bytes())
+		default:
+			addBuffer(col.values.Bytes())
+		}
+
+		col.valid = col.valid[:0]
+		col.nulls = 0
+		col.values.Reset()
+		col.offsets = col.offsets[:1]
+		col.bools = col.bools[:0]
+	}
+
+	batch := fbTable{
+		{slot: 0, size: 8, scalar: uint64(aw.rows)},
+		{slot: 1, child: fbStructs(nodes)},
+		{slot: 2, child: fbStructs(buffers)},
+	}
+	aw.message(arHeaderRecordBatch, batch, body.Bytes())
+	aw.rows = 0
+}
+
+// message writes an encapsulated IPC message: continuation marker,
+// metadata length, the Message flatbuffer padded to 8 bytes, then the body
+func (aw *arrowWriter) message(headerType int, header fbTable, body []byte) {
+	meta := fbFinish(fbTable{
+		{slot: 0, size: 2, scalar: arMetadataV5},
+		{slot: 1, size: 1, scalar: uint64(headerType)},
+		{slot: 2, child: header},
+		{slot: 3, size: 8, scalar: uint64(len(body))},
+	})
+	for len(meta)%8 != 0 {
+		meta = append(meta, 0)
+	}
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], arContinuation)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	aw.write(prefix[:])
+	aw.write(meta)
+	aw.write(body)
+}
+
+// append adds v to the column, converting it to the column's Arrow type
+func (col *arrowColumn) append(v interface{}) error {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	var buf [8]byte
+	if v == nil {
+		col.valid = append(col.valid, false)
+		col.nulls++
+		switch col.typ {
+		case arTypeBool:
+			col.bools = append(col.bools, false)
+		case arTypeUtf8:
+			col.offsets = append(col.offsets, int32(col.values.Len()))
+		default:
+			col.values.Write(buf[:]) // null slots still take their width
+		}
+		return nil
+	}
+
+	switch col.typ {
+	case arTypeInt, arTypeTimestamp:
+		var n int64
+		var err error
+		if col.typ == arTypeTimestamp {
+			n, err = timestampMicros(v)
+		} else {
+			n, err = toInt64(v)
+		}
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		col.values.Write(buf[:])
+	case arTypeFloat:
+		f, err := toFloat64(v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+		col.values.Write(buf[:])
+	case arTypeBool:
+		b, err := toBool(v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		col.bools = append(col.bools, b)
+	default:
+		s := cell(v)
+		if t, ok := v.(time.Time); ok {
+			s = t.UTC().Format(time.RFC3339Nano)
+		}
+		col.values.WriteString(s)
+		col.offsets = append(col.offsets, int32(col.values.Len()))
+	}
+	col.valid = append(col.valid, true)
+	return nil
+}
+
+// bitmap packs bits LSB first, as Arrow validity and boolean buffers are
+func bitmap(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// -----------------------------------------------------
+// A minimal FlatBuffers encoder for the Arrow metadata.
+// Objects are laid out front to back: every table is
+// followed by the objects it points to, so all uoffsets
+// point forward as the format requires.
+// -----------------------------------------------------
+
+type fbObject interface {
+	emit(b *[]byte) int // appends the object, returning its position
+}
+
+// fbField is a scalar of size bytes, or an offset to child
+type fbField struct {
+	slot   int
+	size   int
+	scalar uint64
+	child  fbObject
+}
+
+type fbTable []fbField
+
+type fbString string
+
+// fbVector is a vector of tables
+type fbVector []fbObject
+
+// fbStructs is a vector of 16-byte structs of two int64s (FieldNode, Buffer)
+type fbStructs []byte
+
+// fbFinish encodes root as a complete buffer
+func fbFinish(root fbObject) []byte {
+	b := make([]byte, 8) // root uoffset, padded so tables stay 8-aligned
+	pos := root.emit(&b)
+	binary.LittleEndian.PutUint32(b, uint32(pos))
+	return b
+}
+
+func fbPad(b *[]byte, align int) {
+	for len(*b)%align != 0 {
+		*b = append(*b, 0)
+	}
+}
+
+func (t fbTable) emit(b *[]byte) int {
+	// inline layout: soffset, then fields widest first so each is aligned
+	slots := 0
+	for _, f := range t {
+		if f.slot+1 > slots {
+			slots = f.slot + 1
+		}
+	}
+	offsets := make([]int, len(t))
+	size := 4
+	for _, width := range []int{8, 4, 2, 1} {
+		for i, f := range t {
+			w := f.size
+			if f.child != nil {
+				w = 4
+			}
+			if w != width {
+				continue
+			}
+			for size%width != 0 {
+				size++
+			}
+			offsets[i] = size
+			size += width
+		}
+	}
+
+	vtable := make([]byte, 4+2*slots)
+	binary.LittleEndian.PutUint16(vtable, uint16(len(vtable)))
+	binary.LittleEndian.PutUint16(vtable[2:], uint16(size))
+	for i, f := range t {
+		binary.LittleEndian.PutUint16(vtable[4+2*f.slot:], uint16(offsets[i]))
+	}
+	fbPad(b, 2)
+	vtPos := len(*b)
+	*b = append(*b, vtable...)
+
+	fbPad(b, 8)
+	pos := len(*b)
+	*b = append(*b, make([]byte, size)...)
+	binary.LittleEndian.PutUint32((*b)[pos:], uint32(int32(pos-vtPos)))
+	for i, f := range t {
+		at := pos + offsets[i]
+		switch {
+		case f.child != nil:
+		case f.size == 8:
+			binary.LittleEndian.PutUint64((*b)[at:], f.scalar)
+		case f.size == 4:
+			binary.LittleEndian.PutUint32((*b)[at:], uint32(f.scalar))
+		case f.size == 2:
+			binary.LittleEndian.PutUint16((*b)[at:], uint16(f.scalar))
+		default:
+			(*b)[at] = byte(f.scalar)
+		}
+	}
+	for i, f := range t {
+		if f.child != nil {
+			at := pos + offsets[i]
+			child := f.child.emit(b)
+			binary.LittleEndian.PutUint32((*b)[at:], uint32(child-at))
+		}
+	}
+	return pos
+}
+
+func (s fbString) emit(b *[]byte) int {
+	fbPad(b, 4)
+	pos := len(*b)
+	*b = binary.LittleEndian.AppendUint32(*b, uint32(len(s)))
+	*b = append(*b, s...)
+	*b = append(*b, 0)
+	return pos
+}
+
+func (v fbVector) emit(b *[]byte) int {
+	fbPad(b, 4)
+	pos := len(*b)
+	*b = binary.LittleEndian.AppendUint32(*b, uint32(len(v)))
+	*b = append(*b, make([]byte, 4*len(v))...)
+	for i, elem := range v {
+		at := pos + 4 + 4*i
+		child := elem.emit(b)
+		binary.LittleEndian.PutUint32((*b)[at:], uint32(child-at))
+	}
+	return pos
+}
+
+func (s fbStructs) emit(b *[]byte) int {
+	// the elements hold int64s, so they start 8-aligned after the length
+	fbPad(b, 4)
+	if len(*b)%8 == 0 {
+		*b = append(*b, 0, 0, 0, 0)
+	}
+	pos := len(*b)
+	*b = binary.LittleEndian.AppendUint32(*b, uint32(len(s)/16))
+	*b = append(*b, s...)
+	return pos
+}
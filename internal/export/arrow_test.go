@@ -0,0 +1,368 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// The tests read streams back with the decoder below, written from the
+// Arrow columnar format spec (IPC streaming format, Schema.fbs and
+// Message.fbs) and the FlatBuffers binary layout rather than from the
+// writer, checking the alignment readers verify as well as the values.
+
+func TestArrowRoundTrip(t *testing.T) {
+	cols := []db.Column{
+		{ColumnName: "id", DataType: "bigint"},
+		{ColumnName: "name", DataType: "text"},
+		{ColumnName: "score", DataType: "double precision"},
+		{ColumnName: "ok", DataType: "boolean"},
+		{ColumnName: "at", DataType: "timestamp with time zone"},
+	}
+	at := time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC)
+	rows := []map[string]interface{}{
+		{"id": int64(1), "name": "alpha", "score": 1.5, "ok": true, "at": at},
+		{"id": int64(-2), "name": nil, "score": nil, "ok": false, "at": nil},
+		{"id": nil, "name": []byte("gamma"), "score": -0.25, "ok": nil, "at": "2024-03-01T12:30:00Z"},
+		{"id": int64(math.MaxInt64), "name": "", "score": 1e300, "ok": true, "at": at.Add(time.Hour)},
+	}
+	got := readArrow(t, writeArrow(t, cols, rows))
+
+	want := arrowStream{
+		fields: []arrowField{
+			{"id", "int64"}, {"name", "utf8"}, {"score", "double"}, {"ok", "bool"}, {"at", "timestamp[us, UTC]"},
+		},
+		batches: []int64{4},
+		values: map[string][]interface{}{
+			"id":    {int64(1), int64(-2), nil, int64(math.MaxInt64)},
+			"name":  {"alpha", nil, "gamma", ""},
+			"score": {1.5, nil, -0.25, 1e300},
+			"ok":    {true, false, nil, true},
+			"at": {at.UnixMicro(), nil, time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC).UnixMicro(),
+				at.Add(time.Hour).UnixMicro()},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read back\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestArrowBatches(t *testing.T) {
+	cols := []db.Column{{ColumnName: "n", DataType: "integer"}}
+	rows := make([]map[string]interface{}, arrowBatchSize+3)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"n": int64(i)}
+	}
+	got := readArrow(t, writeArrow(t, cols, rows))
+	if !reflect.DeepEqual(got.batches, []int64{arrowBatchSize, 3}) {
+		t.Fatalf("batches %v, want [%d 3]", got.batches, arrowBatchSize)
+	}
+	for i, v := range got.values["n"] {
+		if v != int64(i) {
+			t.Fatalf("row %d = %v", i, v)
+		}
+	}
+}
+
+func TestArrowEmpty(t *testing.T) {
+	got := readArrow(t, writeArrow(t, []db.Column{{ColumnName: "n", DataType: "integer"}}, nil))
+	if len(got.fields) != 1 || len(got.batches) != 0 {
+		t.Errorf("empty stream has %d fields and %d batches", len(got.fields), len(got.batches))
+	}
+}
+
+func writeArrow(t *testing.T, cols []db.Column, rows []map[string]interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(Arrow, &buf, cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type arrowField struct {
+	name string
+	typ  string
+}
+
+type arrowStream struct {
+	fields  []arrowField
+	batches []int64 // rows per record batch
+	values  map[string][]interface{}
+}
+
+// readArrow decodes a stream: a schema message, record batches, then the
+// end-of-stream marker
+func readArrow(t *testing.T, b []byte) arrowStream {
+	t.Helper()
+	s := arrowStream{values: map[string][]interface{}{}}
+	for pos, first := 0, true; ; first = false {
+		if pos+8 > len(b) || binary.LittleEndian.Uint32(b[pos:]) != 0xFFFFFFFF {
+			t.Fatalf("no continuation marker at %d", pos)
+		}
+		size := int(binary.LittleEndian.Uint32(b[pos+4:]))
+		pos += 8
+		if size == 0 {
+			if pos != len(b) {
+				t.Fatalf("%d bytes after end of stream", len(b)-pos)
+			}
+			return s
+		}
+		if size%8 != 0 || pos+size > len(b) {
+			t.Fatalf("metadata of %d bytes at %d", size, pos)
+		}
+		fb := &flatbuf{t: t, b: b[pos : pos+size]}
+		pos += size
+
+		msg := fb.root()
+		if v := fb.int16(msg, 0); v != 4 {
+			t.Fatalf("metadata version %d, want V5 (4)", v)
+		}
+		header := fb.table(msg, 2)
+		bodyLen := int(fb.int64(msg, 3))
+		if bodyLen%8 != 0 || pos+bodyLen > len(b) {
+			t.Fatalf("body of %d bytes at %d", bodyLen, pos)
+		}
+		body := b[pos : pos+bodyLen]
+		pos += bodyLen
+
+		switch typ := fb.uint8(msg, 1); {
+		case first && typ == 1:
+			s.fields = readSchema(fb, header)
+			for _, f := range s.fields {
+				s.values[f.name] = []interface{}{}
+			}
+		case !first && typ == 3:
+			n := readBatch(fb, header, body, s)
+			s.batches = append(s.batches, n)
+		default:
+			t.Fatalf("message type %d (first: %v)", typ, first)
+		}
+	}
+}
+
+func readSchema(fb *flatbuf, schema int) []arrowField {
+	if e := fb.int16(schema, 0); e != 0 {
+		fb.t.Fatalf("endianness %d, want little", e)
+	}
+	var fields []arrowField
+	for _, f := range fb.tables(schema, 1) {
+		if !fb.bool(f, 1) {
+			fb.t.Errorf("field %s is not nullable", fb.str(f, 0))
+		}
+		if fb.field(f, 5) == 0 {
+			fb.t.Errorf("field %s has no children vector", fb.str(f, 0))
+		}
+		typ := fb.table(f, 3)
+		var name string
+		switch id := fb.uint8(f, 2); id {
+		case 2:
+			name = "uint"
+			if fb.bool(typ, 1) {
+				name = "int"
+			}
+			name += map[int32]string{8: "8", 16: "16", 32: "32", 64: "64"}[fb.int32(typ, 0)]
+		case 3:
+			name = map[int16]string{0: "half", 1: "float", 2: "double"}[fb.int16(typ, 0)]
+		case 5:
+			name = "utf8"
+		case 6:
+			name = "bool"
+		case 10:
+			unit := map[int16]string{0: "s", 1: "ms", 2: "us", 3: "ns"}[fb.int16(typ, 0)]
+			name = "timestamp[" + unit + ", " + fb.str(typ, 1) + "]"
+		default:
+			fb.t.Fatalf("type id %d", id)
+		}
+		fields = append(fields, arrowField{name: fb.str(f, 0), typ: name})
+	}
+	return fields
+}
+
+// readBatch appends the batch's values to s, returning its row count
+func readBatch(fb *flatbuf, batch int, body []byte, s arrowStream) int64 {
+	n := fb.int64(batch, 0)
+	nodes := fb.structs(batch, 1)
+	buffers := fb.structs(batch, 2)
+	if len(nodes) != len(s.fields) {
+		fb.t.Fatalf("%d field nodes for %d fields", len(nodes), len(s.fields))
+	}
+	next := func() []byte {
+		if len(buffers) == 0 {
+			fb.t.Fatalf("out of buffers")
+		}
+		off, size := buffers[0][0], buffers[0][1]
+		buffers = buffers[1:]
+		if off%8 != 0 || off+size > int64(len(body)) {
+			fb.t.Fatalf("buffer at %d of %d bytes in a %d byte body", off, size, len(body))
+		}
+		return body[off : off+size]
+	}
+	bit := func(b []byte, i int) bool { return b[i/8]>>(i%8)&1 == 1 }
+
+	for i, f := range s.fields {
+		if nodes[i][0] != n {
+			fb.t.Fatalf("field %s has %d values in a batch of %d", f.name, nodes[i][0], n)
+		}
+		nulls := nodes[i][1]
+		validity := next()
+		if nulls > 0 && len(validity) < int(n+7)/8 {
+			fb.t.Fatalf("field %s: %d nulls but a %d byte validity bitmap", f.name, nulls, len(validity))
+		}
+		var data, offsets []byte
+		if f.typ == "utf8" {
+			offsets = next()
+		}
+		data = next()
+
+		counted := int64(0)
+		for row := 0; row < int(n); row++ {
+			if nulls > 0 && !bit(validity, row) {
+				counted++
+				s.values[f.name] = append(s.values[f.name], nil)
+				continue
+			}
+			var v interface{}
+			switch f.typ {
+			case "int64", "timestamp[us, UTC]":
+				v = int64(binary.LittleEndian.Uint64(data[8*row:]))
+			case "double":
+				v = math.Float64frombits(binary.LittleEndian.Uint64(data[8*row:]))
+			case "bool":
+				v = bit(data, row)
+			case "utf8":
+				from := binary.LittleEndian.Uint32(offsets[4*row:])
+				to := binary.LittleEndian.Uint32(offsets[4*row+4:])
+				v = string(data[from:to])
+			}
+			s.values[f.name] = append(s.values[f.name], v)
+		}
+		if counted != nulls {
+			fb.t.Fatalf("field %s: null_count %d, validity bitmap has %d", f.name, nulls, counted)
+		}
+	}
+	if len(buffers) != 0 {
+		fb.t.Fatalf("%d buffers left over", len(buffers))
+	}
+	return n
+}
+
+// flatbuf reads FlatBuffers tables, failing the test on reads out of
+// range or misaligned for their width
+type flatbuf struct {
+	t *testing.T
+	b []byte
+}
+
+func (fb *flatbuf) at(p, width int) []byte {
+	if p < 0 || p+width > len(fb.b) {
+		fb.t.Fatalf("read of %d bytes at %d overruns %d", width, p, len(fb.b))
+	}
+	if p%width != 0 {
+		fb.t.Fatalf("%d-byte value at %d is misaligned", width, p)
+	}
+	return fb.b[p:]
+}
+
+func (fb *flatbuf) u32(p int) int { return int(binary.LittleEndian.Uint32(fb.at(p, 4))) }
+
+func (fb *flatbuf) root() int { return fb.u32(0) }
+
+// field returns the position of slot in table tbl, or 0 when absent
+func (fb *flatbuf) field(tbl, slot int) int {
+	vt := tbl - int(int32(fb.u32(tbl)))
+	vtLen := int(binary.LittleEndian.Uint16(fb.at(vt, 2)))
+	if 4+2*slot+2 > vtLen {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(fb.at(vt+4+2*slot, 2)))
+	if off == 0 {
+		return 0
+	}
+	return tbl + off
+}
+
+// deref follows the uoffset in slot, which must be present
+func (fb *flatbuf) deref(tbl, slot int) int {
+	p := fb.field(tbl, slot)
+	if p == 0 {
+		fb.t.Fatalf("table at %d lacks field %d", tbl, slot)
+	}
+	return p + fb.u32(p)
+}
+
+func (fb *flatbuf) uint8(tbl, slot int) uint8 {
+	if p := fb.field(tbl, slot); p != 0 {
+		return fb.at(p, 1)[0]
+	}
+	return 0
+}
+
+func (fb *flatbuf) bool(tbl, slot int) bool { return fb.uint8(tbl, slot) != 0 }
+
+func (fb *flatbuf) int16(tbl, slot int) int16 {
+	if p := fb.field(tbl, slot); p != 0 {
+		return int16(binary.LittleEndian.Uint16(fb.at(p, 2)))
+	}
+	return 0
+}
+
+func (fb *flatbuf) int32(tbl, slot int) int32 {
+	if p := fb.field(tbl, slot); p != 0 {
+		return int32(binary.LittleEndian.Uint32(fb.at(p, 4)))
+	}
+	return 0
+}
+
+func (fb *flatbuf) int64(tbl, slot int) int64 {
+	if p := fb.field(tbl, slot); p != 0 {
+		return int64(binary.LittleEndian.Uint64(fb.at(p, 8)))
+	}
+	return 0
+}
+
+func (fb *flatbuf) table(tbl, slot int) int { return fb.deref(tbl, slot) }
+
+func (fb *flatbuf) str(tbl, slot int) string {
+	s := fb.deref(tbl, slot)
+	n := fb.u32(s)
+	if s+4+n >= len(fb.b) || fb.b[s+4+n] != 0 {
+		fb.t.Fatalf("string at %d is not null-terminated", s)
+	}
+	return string(fb.b[s+4 : s+4+n])
+}
+
+func (fb *flatbuf) tables(tbl, slot int) []int {
+	v := fb.deref(tbl, slot)
+	out := make([]int, fb.u32(v))
+	for i := range out {
+		p := v + 4 + 4*i
+		out[i] = p + fb.u32(p)
+	}
+	return out
+}
+
+// structs reads a vector of structs of two int64s (FieldNode, Buffer)
+func (fb *flatbuf) structs(tbl, slot int) [][2]int64 {
+	v := fb.deref(tbl, slot)
+	out := make([][2]int64, fb.u32(v))
+	for i := range out {
+		p := v + 4 + 16*i
+		out[i] = [2]int64{int64(binary.LittleEndian.Uint64(fb.at(p, 8))), int64(binary.LittleEndian.Uint64(fb.at(p+8, 8)))}
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// Export formats
+const (
+	CSV     = "csv"
+	NDJSON  = "ndjson"
+	Parquet = "parquet"
+	Arrow   = "arrow" // Arrow IPC streaming format
+)
+
+// Formats lists the supported export formats
+var Formats = []string{CSV, NDJSON, Parquet, Arrow}
+
+// Writer encodes table rows one at a time. Flush pushes buffered rows to
+// the underlying io.Writer where the format allows it (Parquet and Arrow
+// only write whole row groups and record batches). Close must be called to
+// finish the output (Parquet writes its footer there, Arrow its end-of-stream
+// marker); it does not close the underlying io.Writer.
+type Writer interface {
+	Write(row map[string]interface{}) error
+	Flush() error
+	Close() error
+}
+
+// Supported reports whether format is one of Formats
+func Supported(format string) bool {
+	return slices.Contains(Formats, format)
+}
+
+// NewWriter returns a Writer for format emitting columns in order
+func NewWriter(format string, w io.Writer, columns []db.Column) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w, columns)
+	case NDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case Parquet:
+		return newParquetWriter(w, columns), nil
+	case Arrow:
+		return newArrowWriter(w, columns), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q (want %s)", format, strings.Join(Formats, ", "))
+}
+
+// ContentType is the MIME type served for format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	case Arrow:
+		return "application/vnd.apache.arrow.stream"
+	}
+	return "application/octet-stream"
+}
+
+// Normalize converts driver values from MapScan into plain Go values:
+// text arrives as []byte from some drivers and timestamps are rendered
+// as RFC3339
+func Normalize(row map[string]interface{}) {
+	for k, v := range row {
+		switch t := v.(type) {
+		case []byte:
+			row[k] = string(t)
+		case time.Time:
+			row[k] = t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+}
+
+// jsonNumber matches the text of a JSON number
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// DecimalColumns names the exact numeric (NUMERIC, DECIMAL) columns of a
+// result set; drivers return their values as text
+func DecimalColumns(types []*sql.ColumnType) map[string]bool {
+	decimal := map[string]bool{}
+	for _, t := range types {
+		switch strings.ToUpper(t.DatabaseTypeName()) {
+		case "NUMERIC", "DECIMAL":
+			decimal[t.Name()] = true
+		}
+	}
+	return decimal
+}
+
+// Decimals turns the text of exact numeric values in row into json.Number,
+// so they encode as JSON numbers with every digit instead of as strings
+func Decimals(row map[string]interface{}, decimal map[string]bool) {
+	for col := range decimal {
+		var s string
+		switch t := row[col].(type) {
+		case []byte:
+			s = string(t)
+		case string:
+			s = t
+		default:
+			continue
+		}
+		if jsonNumber.MatchString(s) {
+			row[col] = json.Number(s)
+		}
+	}
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(row map[string]interface{}) error {
+	Normalize(row)
+	return w.enc.Encode(row)
+}
+
+func (w *ndjsonWriter) Flush() error { return nil }
+
+func (w *ndjsonWriter) Close() error { return nil }
+
+type csvWriter struct {
+	cw      *csv.Writer
+	columns []string
+	rec     []string
+}
+
+func newCSVWriter(w io.Writer, columns []db.Column) (*csvWriter, error) {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.ColumnName
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(names); err != nil {
+		return nil, err
+	}
+	return &csvWriter{cw: cw, columns: names, rec: make([]string, len(names))}, nil
+}
+
+func (w *csvWriter) Write(row map[string]interface{}) error {
+	Normalize(row)
+	for i, col := range w.columns {
+		w.rec[i] = cell(row[col])
+	}
+	return w.cw.Write(w.rec)
+}
+
+func (w *csvWriter) Flush() error {
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+func (w *csvWriter) Close() error { return w.Flush() }
+
+// cell renders a value for CSV; null becomes empty
+func cell(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
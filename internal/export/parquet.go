@@ -0,0 +1,470 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// Rows buffered per Parquet row group; each group is written as one
+// uncompressed PLAIN data page per column
+const parquetRowGroupSize = 10000
+
+// Parquet physical types, converted types and encodings (parquet.thrift)
+const (
+	pqBoolean   = 0
+	pqInt64     = 2
+	pqDouble    = 5
+	pqByteArray = 6
+
+	pqUTF8            = 0
+	pqTimestampMicros = 10
+
+	pqOptional = 1
+
+	pqPlain = 0
+	pqRLE   = 3
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetColumn buffers one column of the current row group
+type parquetColumn struct {
+	name      string
+	physical  int32
+	converted int32 // -1 when none
+	defined   []bool
+	values    bytes.Buffer
+	bools     []bool
+}
+
+// parquetChunk is what the footer needs to know about a written column chunk
+type parquetChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+	size   int64
+}
+
+// parquetWriter writes a minimal Parquet file: flat OPTIONAL columns,
+// uncompressed, one data page per column chunk. Rows are buffered until a
+// row group is full, so memory stays bounded for any table size.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []*parquetColumn
+	rows    int
+	groups  []parquetRowGroup
+	total   int64
+	err     error
+}
+
+func newParquetWriter(w io.Writer, columns []db.Column) *parquetWriter {
+	pw := &parquetWriter{w: w}
+	for _, c := range columns {
+		col := &parquetColumn{name: c.ColumnName, physical: pqByteArray, converted: pqUTF8}
+		switch t := strings.ToLower(c.DataType); {
+		case strings.Contains(t, "timestamp"):
+			col.physical, col.converted = pqInt64, pqTimestampMicros
+		case strings.Contains(t, "bool"):
+			col.physical, col.converted = pqBoolean, -1
+		case strings.Contains(t, "int"):
+			col.physical, col.converted = pqInt64, -1
+		case strings.Contains(t, "double"), strings.Contains(t, "real"), strings.Contains(t, "float"),
+			strings.Contains(t, "numeric"), strings.Contains(t, "decimal"):
+			col.physical, col.converted = pqDouble, -1
+		}
+		pw.columns = append(pw.columns, col)
+	}
+	return pw
+}
+
+func (pw *parquetWriter) Write(row map[string]interface{}) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if pw.offset == 0 {
+		pw.write(parquetMagic)
+	}
+	for _, col := range pw.columns {
+		if err := col.append(row[col.name]); err != nil {
+			// the row group is now ragged, so the file cannot be finished
+			pw.err = err
+			return err
+		}
+	}
+	pw.rows++
+	if pw.rows == parquetRowGroupSize {
+		pw.flushGroup()
+	}
+	return pw.err
+}
+
+// Flush is a no-op: row groups are written whole once full
+func (pw *parquetWriter) Flush() error { return pw.err }
+
+func (pw *parquetWriter) Close() error {
+	if pw.offset == 0 {
+		pw.write(parquetMagic)
+	}
+	if pw.rows > 0 {
+		pw.flushGroup()
+	}
+	footer := pw.footer()
+	pw.write(footer)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(footer)))
+	pw.write(n[:])
+	pw.write(parquetMagic)
+	return pw.err
+}
+
+func (pw *parquetWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	pw.err = err
+}
+
+// append adds v to the column, converting it to the column's physical type
+func (col *parquetColumn) append(v interface{}) error {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if v == nil {
+		col.defined = append(col.defined, false)
+		return nil
+	}
+
+	var buf [8]byte
+	switch col.physical {
+	case pqInt64:
+		var n int64
+		var err error
+		if col.converted == pqTimestampMicros {
+			n, err = timestampMicros(v)
+		} else {
+			n, err = toInt64(v)
+		}
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		col.values.Write(buf[:])
+	case pqDouble:
+		f, err := toFloat64(v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+		col.values.Write(buf[:])
+	case pqBoolean:
+		b, err := toBool(v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.name, err)
+		}
+		col.bools = append(col.bools, b)
+	default:
+		s := cell(v)
+		if t, ok := v.(time.Time); ok {
+			s = t.UTC().Format(time.RFC3339Nano)
+		}
+		binary.LittleEndian.PutUint32(buf[:4], uint32(len(s)))
+		col.values.Write(buf[:4])
+		col.values.WriteString(s)
+	}
+	col.defined = append(col.defined, true)
+	return nil
+}
+
+// flushGroup writes the buffered rows as one row group
+func (pw *parquetWriter) flushGroup() {
+	group := parquetRowGroup{rows: int64(pw.rows)}
+	for _, col := range pw.columns {
+		page := col.page()
+		header := thriftPageHeader(len(page), pw.rows)
+		chunk := parquetChunk{offset: pw.offset, size: int64(len(header) + len(page)), values: int64(pw.rows)}
+		pw.write(header)
+		pw.write(page)
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+
+		col.defined = col.defined[:0]
+		col.bools = col.bools[:0]
+		col.values.Reset()
+	}
+	pw.groups = append(pw.groups, group)
+	pw.total += group.rows
+	pw.rows = 0
+}
+
+// page encodes a v1 data page body: RLE definition levels then PLAIN values
+func (col *parquetColumn) page() []byte {
+	var levels bytes.Buffer
+	for i := 0; i < len(col.defined); {
+		j := i
+		for j < len(col.defined) && col.defined[j] == col.defined[i] {
+			j++
+		}
+		putUvarint(&levels, uint64(j-i)<<1)
+		if col.defined[i] {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i = j
+	}
+
+	var page bytes.Buffer
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(levels.Len()))
+	page.Write(n[:])
+	page.Write(levels.Bytes())
+	if col.physical == pqBoolean {
+		packed := make([]byte, (len(col.bools)+7)/8)
+		for i, b := range col.bools {
+			if b {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		page.Write(packed)
+	} else {
+		page.Write(col.values.Bytes())
+	}
+	return page.Bytes()
+}
+
+// footer encodes the FileMetaData struct
+func (pw *parquetWriter) footer() []byte {
+	t := &thriftWriter{}
+	t.i32(1, 1) // version
+	t.listBegin(2, thriftStruct, len(pw.columns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.structEnd()
+	for _, col := range pw.columns {
+		t.elemBegin()
+		t.i32(1, col.physical)
+		t.i32(3, pqOptional)
+		t.binary(4, col.name)
+		if col.converted >= 0 {
+			t.i32(6, col.converted)
+		}
+		t.structEnd()
+	}
+	t.i64(3, pw.total)
+	t.listBegin(4, thriftStruct, len(pw.groups))
+	for _, g := range pw.groups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(g.chunks))
+		for i, ch := range g.chunks {
+			col := pw.columns[i]
+			t.elemBegin()
+			t.i64(2, ch.offset)
+			t.structBegin(3)
+			t.i32(1, col.physical)
+			t.listBegin(2, thriftI32, 2)
+			t.elemI32(pqPlain)
+			t.elemI32(pqRLE)
+			t.listBegin(3, thriftBinary, 1)
+			t.elemBinary(col.name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, ch.values)
+			t.i64(6, ch.size)
+			t.i64(7, ch.size)
+			t.i64(9, ch.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, g.size)
+		t.i64(3, g.rows)
+		t.structEnd()
+	}
+	t.binary(6, "godataflow")
+	t.buf.WriteByte(0)
+	return t.buf.Bytes()
+}
+
+// thriftPageHeader encodes a PageHeader for an uncompressed DATA_PAGE
+func thriftPageHeader(size, values int) []byte {
+	t := &thriftWriter{}
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	t.structBegin(5)
+	t.i32(1, int32(values))
+	t.i32(2, pqPlain)
+	t.i32(3, pqRLE)
+	t.i32(4, pqRLE)
+	t.structEnd()
+	t.buf.WriteByte(0)
+	return t.buf.Bytes()
+}
+
+// Thrift compact protocol type ids
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter is just enough of the Thrift compact protocol to encode
+// Parquet metadata
+type thriftWriter struct {
+	buf   bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		putUvarint(&t.buf, zigzag(int64(id)))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	putUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	putUvarint(&t.buf, zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.elemBinary(s)
+}
+
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+// elemBegin starts a struct inside a list, which has no field header
+func (t *thriftWriter) elemBegin() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftWriter) listBegin(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		putUvarint(&t.buf, uint64(n))
+	}
+}
+
+func (t *thriftWriter) elemI32(v int32) {
+	putUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) elemBinary(s string) {
+	putUvarint(&t.buf, uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case int:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case float64:
+		return int64(t), nil
+	case json.Number:
+		return t.Int64()
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+	}
+	return 0, fmt.Errorf("cannot encode %T as int64", v)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case float32:
+		return float64(t), nil
+	case int64:
+		return float64(t), nil
+	case int:
+		return float64(t), nil
+	case json.Number:
+		return t.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(t), 64)
+	}
+	return 0, fmt.Errorf("cannot encode %T as double", v)
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case int64:
+		return t != 0, nil
+	case string:
+		return strconv.ParseBool(t)
+	}
+	return false, fmt.Errorf("cannot encode %T as boolean", v)
+}
+
+// timestampMicros converts a driver timestamp (or its text form on SQLite)
+// to microseconds since the Unix epoch
+func timestampMicros(v interface{}) (int64, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UnixMicro(), nil
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02"} {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts.UnixMicro(), nil
+			}
+		}
+		return 0, fmt.Errorf("cannot parse timestamp %q", t)
+	}
+	return 0, fmt.Errorf("cannot encode %T as timestamp", v)
+}
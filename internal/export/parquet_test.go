@@ -0,0 +1,331 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// The tests read files back with the decoder below, written from the
+// Parquet format spec (parquet.thrift and Encodings.md) rather than from
+// the writer, so a reader following the spec gets the same values.
+
+func TestParquetRoundTrip(t *testing.T) {
+	cols := []db.Column{
+		{ColumnName: "id", DataType: "bigint"},
+		{ColumnName: "name", DataType: "text"},
+		{ColumnName: "score", DataType: "double precision"},
+		{ColumnName: "ok", DataType: "boolean"},
+		{ColumnName: "at", DataType: "timestamp with time zone"},
+	}
+	at := time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC)
+	rows := []map[string]interface{}{
+		{"id": int64(1), "name": "alpha", "score": 1.5, "ok": true, "at": at},
+		{"id": int64(-2), "name": nil, "score": nil, "ok": false, "at": nil},
+		{"id": nil, "name": []byte("gamma"), "score": -0.25, "ok": nil, "at": "2024-03-01T12:30:00Z"},
+		{"id": int64(math.MaxInt64), "name": "", "score": 1e300, "ok": true, "at": at.Add(time.Hour)},
+	}
+	got := readParquet(t, writeParquet(t, cols, rows))
+
+	want := parquetFile{
+		rows: 4,
+		columns: []parquetSchemaColumn{
+			{"id", 2, -1}, {"name", 6, 0}, {"score", 5, -1}, {"ok", 0, -1}, {"at", 2, 10},
+		},
+		groups: []int64{4},
+		values: map[string][]interface{}{
+			"id":    {int64(1), int64(-2), nil, int64(math.MaxInt64)},
+			"name":  {"alpha", nil, "gamma", ""},
+			"score": {1.5, nil, -0.25, 1e300},
+			"ok":    {true, false, nil, true},
+			"at": {at.UnixMicro(), nil, time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC).UnixMicro(),
+				at.Add(time.Hour).UnixMicro()},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read back\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	cols := []db.Column{{ColumnName: "n", DataType: "integer"}}
+	rows := make([]map[string]interface{}, parquetRowGroupSize+3)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"n": int64(i)}
+	}
+	got := readParquet(t, writeParquet(t, cols, rows))
+	if got.rows != int64(len(rows)) || !reflect.DeepEqual(got.groups, []int64{parquetRowGroupSize, 3}) {
+		t.Fatalf("rows %d in groups %v, want %d in [%d 3]", got.rows, got.groups, len(rows), parquetRowGroupSize)
+	}
+	for i, v := range got.values["n"] {
+		if v != int64(i) {
+			t.Fatalf("row %d = %v", i, v)
+		}
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	got := readParquet(t, writeParquet(t, []db.Column{{ColumnName: "n", DataType: "integer"}}, nil))
+	if got.rows != 0 || len(got.groups) != 0 {
+		t.Errorf("empty file has %d rows in %d groups", got.rows, len(got.groups))
+	}
+}
+
+func writeParquet(t *testing.T, cols []db.Column, rows []map[string]interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(Parquet, &buf, cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type parquetSchemaColumn struct {
+	name      string
+	physical  int64
+	converted int64 // -1 when unset
+}
+
+type parquetFile struct {
+	rows    int64
+	columns []parquetSchemaColumn
+	groups  []int64 // rows per row group
+	values  map[string][]interface{}
+}
+
+// readParquet decodes a file of flat OPTIONAL columns with uncompressed
+// v1 data pages
+func readParquet(t *testing.T, b []byte) parquetFile {
+	t.Helper()
+	if len(b) < 12 || string(b[:4]) != "PAR1" || string(b[len(b)-4:]) != "PAR1" {
+		t.Fatalf("missing PAR1 magic")
+	}
+	n := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	footerAt := len(b) - 8 - n
+	if footerAt < 4 {
+		t.Fatalf("footer length %d out of range", n)
+	}
+	r := &compactReader{b: b[footerAt : len(b)-8]}
+	meta := r.structure()
+	if r.err != nil || r.pos != n {
+		t.Fatalf("footer: %v (read %d of %d bytes)", r.err, r.pos, n)
+	}
+
+	f := parquetFile{rows: meta[3].(int64), values: map[string][]interface{}{}}
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if root[5].(int64) != int64(len(schema)-1) {
+		t.Fatalf("root has %v children, schema %d columns", root[5], len(schema)-1)
+	}
+	for _, el := range schema[1:] {
+		el := el.(map[int16]interface{})
+		if el[3] != int64(1) {
+			t.Fatalf("column %s is not OPTIONAL", el[4])
+		}
+		col := parquetSchemaColumn{name: string(el[4].([]byte)), physical: el[1].(int64), converted: -1}
+		if c, ok := el[6]; ok {
+			col.converted = c.(int64)
+		}
+		f.columns = append(f.columns, col)
+		f.values[col.name] = []interface{}{}
+	}
+
+	var groups []interface{}
+	if g, ok := meta[4]; ok {
+		groups = g.([]interface{})
+	}
+	for _, g := range groups {
+		g := g.(map[int16]interface{})
+		rows := g[3].(int64)
+		f.groups = append(f.groups, rows)
+		for i, ch := range g[1].([]interface{}) {
+			cm := ch.(map[int16]interface{})[3].(map[int16]interface{})
+			col := f.columns[i]
+			if path := cm[3].([]interface{}); len(path) != 1 || string(path[0].([]byte)) != col.name {
+				t.Fatalf("chunk %d path %q, want %s", i, path, col.name)
+			}
+			if cm[4] != int64(0) || cm[5] != rows {
+				t.Fatalf("chunk %s: codec %v, %v values, want uncompressed with %d", col.name, cm[4], cm[5], rows)
+			}
+			at := int(cm[9].(int64))
+			pr := &compactReader{b: b[at:]}
+			header := pr.structure()
+			if pr.err != nil || header[1] != int64(0) {
+				t.Fatalf("chunk %s: page header %v, err %v", col.name, header, pr.err)
+			}
+			size := int(header[3].(int64))
+			if int64(pr.pos+size) != cm[7].(int64) {
+				t.Fatalf("chunk %s: header and page are %d bytes, metadata says %d", col.name, pr.pos+size, cm[7])
+			}
+			dp := header[5].(map[int16]interface{})
+			if dp[1] != rows || dp[2] != int64(0) || dp[3] != int64(3) {
+				t.Fatalf("chunk %s: data page header %v", col.name, dp)
+			}
+			vals, err := decodePage(b[at+pr.pos:at+pr.pos+size], col.physical, int(rows))
+			if err != nil {
+				t.Fatalf("chunk %s: %v", col.name, err)
+			}
+			f.values[col.name] = append(f.values[col.name], vals...)
+		}
+	}
+	return f
+}
+
+// decodePage reads definition levels (length-prefixed RLE/bit-packed
+// hybrid, bit width 1) and the PLAIN values of the defined ones
+func decodePage(page []byte, physical int64, n int) ([]interface{}, error) {
+	if len(page) < 4 {
+		return nil, fmt.Errorf("short page")
+	}
+	size := int(binary.LittleEndian.Uint32(page))
+	levels, data := page[4:4+size], page[4+size:]
+	var defined []bool
+	for len(levels) > 0 && len(defined) < n {
+		header, k := binary.Uvarint(levels)
+		if k <= 0 {
+			return nil, fmt.Errorf("bad run header")
+		}
+		levels = levels[k:]
+		if header&1 == 0 { // RLE run: count, then the value in one byte
+			for i := uint64(0); i < header>>1; i++ {
+				defined = append(defined, levels[0] == 1)
+			}
+			levels = levels[1:]
+		} else { // bit-packed groups of 8
+			groups := int(header >> 1)
+			for i := 0; i < groups*8; i++ {
+				defined = append(defined, levels[i/8]>>(i%8)&1 == 1)
+			}
+			levels = levels[groups:]
+		}
+	}
+	if len(defined) < n {
+		return nil, fmt.Errorf("%d definition levels, want %d", len(defined), n)
+	}
+
+	out := make([]interface{}, n)
+	bit := 0
+	for i := 0; i < n; i++ {
+		if !defined[i] {
+			continue
+		}
+		switch physical {
+		case 0: // BOOLEAN, bit-packed LSB first
+			out[i] = data[bit/8]>>(bit%8)&1 == 1
+			bit++
+		case 2: // INT64
+			out[i] = int64(binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		case 5: // DOUBLE
+			out[i] = math.Float64frombits(binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		case 6: // BYTE_ARRAY
+			l := int(binary.LittleEndian.Uint32(data))
+			out[i] = string(data[4 : 4+l])
+			data = data[4+l:]
+		default:
+			return nil, fmt.Errorf("physical type %d", physical)
+		}
+	}
+	return out, nil
+}
+
+// compactReader decodes Thrift compact protocol structs into maps of
+// field id to value: int64 for integers, []byte for binary, []interface{}
+// for lists and nested maps for structs
+type compactReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *compactReader) byte() byte {
+	if r.pos >= len(r.b) {
+		r.err = fmt.Errorf("unexpected end at %d", r.pos)
+		return 0
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+func (r *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[min(r.pos, len(r.b)):])
+	if n <= 0 {
+		r.err = fmt.Errorf("bad varint at %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *compactReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *compactReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for r.err == nil {
+		h := r.byte()
+		if h == 0 {
+			break
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(h & 0x0f)
+	}
+	return fields
+}
+
+func (r *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2: // boolean true / false, held in the field header
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 8:
+		n := int(r.uvarint())
+		if r.pos+n > len(r.b) {
+			r.err = fmt.Errorf("binary overruns at %d", r.pos)
+			return nil
+		}
+		r.pos += n
+		return r.b[r.pos-n : r.pos]
+	case 9:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(h & 0x0f)
+		}
+		return list
+	case 12:
+		return r.structure()
+	}
+	r.err = fmt.Errorf("unsupported type %d at %d", typ, r.pos)
+	return nil
+}
@@ -0,0 +1,199 @@
+// Package geo converts spatial values for PostGIS geometry and geography
+// columns. Values are written as EWKT text, which PostGIS parses on insert,
+// COPY and casts alike: WKT and EWKT strings pass through, GeoJSON
+// geometries (objects or JSON text) are converted with SRID 4326.
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GeoJSONSRID is the SRID of GeoJSON coordinates (WGS 84, RFC 7946)
+const GeoJSONSRID = 4326
+
+// wktTypes are the geometry types of WKT and GeoJSON, keyed by their GeoJSON name
+var wktTypes = map[string]string{
+	"Point":              "POINT",
+	"LineString":         "LINESTRING",
+	"Polygon":            "POLYGON",
+	"MultiPoint":         "MULTIPOINT",
+	"MultiLineString":    "MULTILINESTRING",
+	"MultiPolygon":       "MULTIPOLYGON",
+	"GeometryCollection": "GEOMETRYCOLLECTION",
+}
+
+// IsSpatialType reports whether a column type (as listed by
+// db.TableColumns, or as written in CREATE TABLE) is a PostGIS type
+func IsSpatialType(dataType string) bool {
+	t := strings.ToLower(strings.TrimSpace(dataType))
+	return strings.HasPrefix(t, "geometry") || strings.HasPrefix(t, "geography")
+}
+
+// IsGeoJSON reports whether m is a GeoJSON geometry object
+func IsGeoJSON(m map[string]interface{}) bool {
+	t, _ := m["type"].(string)
+	if _, ok := wktTypes[t]; !ok {
+		return false
+	}
+	if t == "GeometryCollection" {
+		_, ok := m["geometries"]
+		return ok
+	}
+	_, ok := m["coordinates"]
+	return ok
+}
+
+// ToEWKT converts a GeoJSON geometry (object or JSON text) or a WKT/EWKT
+// string to EWKT
+func ToEWKT(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if !IsGeoJSON(t) {
+			return "", errors.New("expected a GeoJSON geometry")
+		}
+		wkt, err := geometryWKT(t)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("SRID=%d;%s", GeoJSONSRID, wkt), nil
+	case string:
+		s := strings.TrimSpace(t)
+		if strings.HasPrefix(s, "{") {
+			var m map[string]interface{}
+			if err := json.Unmarshal([]byte(s), &m); err != nil {
+				return "", fmt.Errorf("invalid GeoJSON: %w", err)
+			}
+			return ToEWKT(m)
+		}
+		if !isWKT(s) {
+			return "", fmt.Errorf("expected WKT, EWKT or GeoJSON, got %q", truncate(s))
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("expected WKT, EWKT or GeoJSON, got %T", v)
+}
+
+// isWKT checks that s starts like (E)WKT: an optional SRID=n; and a geometry type
+func isWKT(s string) bool {
+	upper := strings.ToUpper(s)
+	if strings.HasPrefix(upper, "SRID=") {
+		i := strings.Index(upper, ";")
+		if i < 0 {
+			return false
+		}
+		if _, err := strconv.Atoi(upper[len("SRID="):i]); err != nil {
+			return false
+		}
+		upper = strings.TrimSpace(upper[i+1:])
+	}
+	for _, t := range wktTypes {
+		if strings.HasPrefix(upper, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func geometryWKT(m map[string]interface{}) (string, error) {
+	typ := m["type"].(string)
+	if typ == "GeometryCollection" {
+		geometries, ok := m["geometries"].([]interface{})
+		if !ok {
+			return "", errors.New("GeometryCollection needs a geometries list")
+		}
+		parts := make([]string, 0, len(geometries))
+		for _, g := range geometries {
+			gm, ok := g.(map[string]interface{})
+			if !ok || !IsGeoJSON(gm) {
+				return "", errors.New("GeometryCollection holds a non-geometry")
+			}
+			wkt, err := geometryWKT(gm)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, wkt)
+		}
+		return "GEOMETRYCOLLECTION(" + strings.Join(parts, ",") + ")", nil
+	}
+
+	// nesting depth of the coordinates of each type
+	depth := map[string]int{"Point": 0, "LineString": 1, "MultiPoint": 1, "Polygon": 2, "MultiLineString": 2, "MultiPolygon": 3}[typ]
+	coords, err := coordinates(m["coordinates"], depth)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", typ, err)
+	}
+	if typ == "Point" {
+		return "POINT" + coords, nil
+	}
+	return wktTypes[typ] + coords, nil
+}
+
+// coordinates renders a position (depth 0) or nested lists of positions
+// in WKT parentheses
+func coordinates(v interface{}, depth int) (string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return "", errors.New("coordinates must be arrays")
+	}
+	if depth == 0 {
+		pos, err := position(list)
+		if err != nil {
+			return "", err
+		}
+		return "(" + pos + ")", nil
+	}
+	parts := make([]string, 0, len(list))
+	for _, item := range list {
+		var s string
+		var err error
+		if depth == 1 {
+			inner, ok := item.([]interface{})
+			if !ok {
+				return "", errors.New("coordinates must be arrays")
+			}
+			s, err = position(inner)
+		} else {
+			s, err = coordinates(item, depth-1)
+		}
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	return "(" + strings.Join(parts, ",") + ")", nil
+}
+
+// position renders [x, y] or [x, y, z] as "x y" or "x y z"
+func position(p []interface{}) (string, error) {
+	if len(p) < 2 || len(p) > 3 {
+		return "", errors.New("a position has 2 or 3 numbers")
+	}
+	nums := make([]string, len(p))
+	for i, n := range p {
+		var f float64
+		switch t := n.(type) {
+		case float64:
+			f = t
+		case json.Number:
+			var err error
+			if f, err = t.Float64(); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("a position holds numbers, got %T", n)
+		}
+		nums[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strings.Join(nums, " "), nil
+}
+
+func truncate(s string) string {
+	if len(s) > 40 {
+		return s[:40] + "..."
+	}
+	return s
+}
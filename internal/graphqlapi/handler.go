@@ -0,0 +1,113 @@
+package graphqlapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+)
+
+// schemaTTL bounds how stale the schema gets when columns change outside
+// the API (ALTER TABLE); table create/delete events rebuild it right away.
+const schemaTTL = 30 * time.Second
+
+// Handler serves GET/POST /graphql against the read router
+type Handler struct {
+	Reads  *db.ReadRouter
+	Events *events.Broker
+
+	mu      sync.Mutex
+	schema  *graphql.Schema
+	builtAt time.Time
+}
+
+func NewHandler(reads *db.ReadRouter, broker *events.Broker) *Handler {
+	return &Handler{Reads: reads, Events: broker}
+}
+
+// request is the standard GraphQL-over-HTTP payload
+type request struct {
+	Query         string                 `json:"query" form:"query"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GET /graphql?query=... or POST /graphql {"query", "variables", "operationName"}
+func (h *Handler) Serve(c *gin.Context) {
+	var req request
+	var err error
+	if c.Request.Method == http.MethodGet {
+		err = c.ShouldBindQuery(&req)
+	} else {
+		err = c.ShouldBindJSON(&req)
+	}
+	if err != nil || req.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+
+	schema, err := h.currentSchema()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build GraphQL schema", "details": err.Error()})
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         *schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        c.Request.Context(),
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// currentSchema returns the cached schema, rebuilding it once it is stale
+func (h *Handler) currentSchema() (*graphql.Schema, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.schema != nil && time.Since(h.builtAt) < schemaTTL {
+		return h.schema, nil
+	}
+	tables, err := loadTables(h.Reads.Reader())
+	if err != nil {
+		return nil, err
+	}
+	schema, err := buildSchema(h.Reads.Reader, tables)
+	if err != nil {
+		return nil, err
+	}
+	h.schema, h.builtAt = &schema, time.Now()
+	return h.schema, nil
+}
+
+// Watch drops the cached schema whenever a table is created or deleted
+func (h *Handler) Watch(ctx context.Context) {
+	if h.Events == nil {
+		return
+	}
+	sub := h.Events.Subscribe()
+	defer h.Events.Unsubscribe(sub)
+
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			if ev.Type == events.TableCreated || ev.Type == events.TableDeleted {
+				h.mu.Lock()
+				h.schema = nil
+				h.mu.Unlock()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
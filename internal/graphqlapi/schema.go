@@ -0,0 +1,389 @@
+// Package graphqlapi exposes registered tables as a GraphQL schema. One query
+// field per table is generated from the database catalog, with where /
+// order_by / limit / offset arguments, next to a "tables" field listing the
+// table metadata. The schema is introspectable like any other.
+package graphqlapi
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/graphql-go/graphql"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+var nameRE = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// tableInfo is one registered table and its catalog columns
+type tableInfo struct {
+	Name            string  `db:"table_name"`
+	TableType       string  `db:"table_type"`
+	Status          string  `db:"status"`
+	RefreshInterval *int    `db:"refresh_interval"`
+	DataSourceURL   *string `db:"data_source_url"`
+	LastSuccess     *string `db:"last_refresh_success"`
+	Columns         []db.Column
+}
+
+// -----------------------------
+// Shared types
+// -----------------------------
+var columnType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Column",
+	Fields: graphql.Fields{
+		"name":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"data_type":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"graphql_type": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var tableType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Table",
+	Description: "A registered table (table_metadata)",
+	Fields: graphql.Fields{
+		"name":                 &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"field":                &graphql.Field{Type: graphql.String, Description: "Query field serving the table's rows; null if its name can't be used in GraphQL"},
+		"table_type":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"status":               &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"refresh_interval":     &graphql.Field{Type: graphql.Int},
+		"data_source_url":      &graphql.Field{Type: graphql.String},
+		"last_refresh_success": &graphql.Field{Type: graphql.String},
+		"columns":              &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(columnType)))},
+	},
+})
+
+// comparisons holds one filter input type per scalar, shared by all tables
+var comparisons = map[*graphql.Scalar]*graphql.InputObject{}
+
+func init() {
+	for _, s := range []*graphql.Scalar{graphql.Int, graphql.Float, graphql.String, graphql.Boolean} {
+		fields := graphql.InputObjectConfigFieldMap{
+			"eq":      {Type: s},
+			"neq":     {Type: s},
+			"in":      {Type: graphql.NewList(graphql.NewNonNull(s))},
+			"is_null": {Type: graphql.Boolean},
+		}
+		if s != graphql.Boolean {
+			for _, op := range []string{"gt", "gte", "lt", "lte"} {
+				fields[op] = &graphql.InputObjectFieldConfig{Type: s}
+			}
+		}
+		if s == graphql.String {
+			fields["like"] = &graphql.InputObjectFieldConfig{Type: s}
+		}
+		comparisons[s] = graphql.NewInputObject(graphql.InputObjectConfig{
+			Name:   s.Name() + "Comparison",
+			Fields: fields,
+		})
+	}
+}
+
+// reserved type names a table can't take over
+var reserved = map[string]bool{
+	"Query": true, "Table": true, "Column": true,
+	"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true,
+	"IntComparison": true, "FloatComparison": true, "StringComparison": true, "BooleanComparison": true,
+}
+
+// scalarFor maps a catalog type (Postgres information_schema or SQLite
+// declared type) to a GraphQL scalar. 64-bit integers become Float, since
+// GraphQL Int is 32-bit.
+func scalarFor(dataType string) *graphql.Scalar {
+	t := strings.ToLower(dataType)
+	switch {
+	case strings.Contains(t, "bool"):
+		return graphql.Boolean
+	case strings.Contains(t, "bigint"), strings.Contains(t, "int8"), strings.Contains(t, "bigserial"):
+		return graphql.Float
+	case strings.Contains(t, "int"), strings.Contains(t, "serial"):
+		return graphql.Int
+	case strings.Contains(t, "real"), strings.Contains(t, "float"), strings.Contains(t, "double"),
+		strings.Contains(t, "numeric"), strings.Contains(t, "decimal"):
+		return graphql.Float
+	default:
+		return graphql.String
+	}
+}
+
+// fieldName turns "schema.table" into "schema_table"; "" if unusable
+func fieldName(table string) string {
+	name := strings.ReplaceAll(table, ".", "_")
+	if !nameRE.MatchString(name) || strings.HasPrefix(name, "__") || reserved[name] || name == "tables" {
+		return ""
+	}
+	return name
+}
+
+// -----------------------------
+// Schema
+// -----------------------------
+
+// loadTables reads table_metadata and each table's columns
+func loadTables(reader *sqlx.DB) ([]tableInfo, error) {
+	tables := []tableInfo{}
+	err := reader.Select(&tables, `
+		SELECT table_name, table_type, status, refresh_interval, data_source_url,
+		       CAST(last_refresh_success AS TEXT) AS last_refresh_success
+		FROM table_metadata ORDER BY table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("load tables failed: %w", err)
+	}
+	for i := range tables {
+		cols, err := db.TableColumns(reader, tables[i].Name)
+		if err != nil {
+			return nil, fmt.Errorf("load columns of %s failed: %w", tables[i].Name, err)
+		}
+		tables[i].Columns = cols
+	}
+	return tables, nil
+}
+
+// buildSchema generates the schema for the given tables. Tables whose names
+// or columns can't be expressed in GraphQL are listed under "tables" but get no field.
+func buildSchema(reader func() *sqlx.DB, tables []tableInfo) (graphql.Schema, error) {
+	exposed := map[string]string{} // table -> query field
+	fields := graphql.Fields{
+		"tables": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tableType))),
+			Description: "Registered tables and their columns",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return tablesResult(tables, exposed), nil
+			},
+		},
+	}
+
+	typeNames := map[string]bool{}
+	for _, t := range tables {
+		name := fieldName(t.Name)
+		generated := []string{name, name + "_column", name + "_where", name + "_order_by"}
+		clash := false
+		for _, n := range generated {
+			clash = clash || typeNames[n]
+		}
+		if name == "" || len(t.Columns) == 0 || clash {
+			log.Printf("[graphql] table %q not exposed: name unusable or clashes", t.Name)
+			continue
+		}
+		field, err := tableField(reader, name, t)
+		if err != nil {
+			log.Printf("[graphql] table %q not exposed: %v", t.Name, err)
+			continue
+		}
+		fields[name] = field
+		exposed[t.Name] = name
+		for _, n := range generated {
+			typeNames[n] = true
+		}
+	}
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: fields}),
+	})
+}
+
+// tableField builds the row type, filter inputs and query field of one table
+func tableField(reader func() *sqlx.DB, name string, t tableInfo) (*graphql.Field, error) {
+	rowFields := graphql.Fields{}
+	whereFields := graphql.InputObjectConfigFieldMap{}
+	columnValues := graphql.EnumValueConfigMap{}
+	for _, c := range t.Columns {
+		if !nameRE.MatchString(c.ColumnName) || strings.HasPrefix(c.ColumnName, "__") {
+			return nil, fmt.Errorf("column %q is not a valid GraphQL name", c.ColumnName)
+		}
+		scalar := scalarFor(c.DataType)
+		rowFields[c.ColumnName] = &graphql.Field{Type: scalar, Description: c.DataType}
+		whereFields[c.ColumnName] = &graphql.InputObjectFieldConfig{Type: comparisons[scalar]}
+		columnValues[c.ColumnName] = &graphql.EnumValueConfig{Value: c.ColumnName}
+	}
+
+	rowType := graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: rowFields})
+	columnEnum := graphql.NewEnum(graphql.EnumConfig{Name: name + "_column", Values: columnValues})
+	whereType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        name + "_where",
+		Description: "Conditions on several columns are combined with AND",
+		Fields:      whereFields,
+	})
+	orderType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: name + "_order_by",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"column": {Type: graphql.NewNonNull(columnEnum)},
+			"desc":   {Type: graphql.Boolean, DefaultValue: false},
+		},
+	})
+
+	table := t.Name
+	return &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(rowType))),
+		Description: fmt.Sprintf("Rows of %s", table),
+		Args: graphql.FieldConfigArgument{
+			"where":    {Type: whereType},
+			"order_by": {Type: graphql.NewList(graphql.NewNonNull(orderType))},
+			"limit":    {Type: graphql.Int, DefaultValue: defaultLimit, Description: fmt.Sprintf("At most %d", maxLimit)},
+			"offset":   {Type: graphql.Int, DefaultValue: 0},
+			"include_deleted": {
+				Type: graphql.Boolean, DefaultValue: false,
+				Description: "Also return soft-deleted rows of a soft_delete table",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return queryRows(reader(), table, t.Columns, p.Args)
+		},
+	}, nil
+}
+
+func tablesResult(tables []tableInfo, exposed map[string]string) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(tables))
+	for _, t := range tables {
+		cols := make([]map[string]interface{}, 0, len(t.Columns))
+		for _, c := range t.Columns {
+			cols = append(cols, map[string]interface{}{
+				"name":         c.ColumnName,
+				"data_type":    c.DataType,
+				"graphql_type": scalarFor(c.DataType).Name(),
+			})
+		}
+		var field interface{}
+		if name, ok := exposed[t.Name]; ok {
+			field = name
+		}
+		out = append(out, map[string]interface{}{
+			"name":                 t.Name,
+			"field":                field,
+			"table_type":           t.TableType,
+			"status":               t.Status,
+			"refresh_interval":     t.RefreshInterval,
+			"data_source_url":      t.DataSourceURL,
+			"last_refresh_success": t.LastSuccess,
+			"columns":              cols,
+		})
+	}
+	return out
+}
+
+// -----------------------------
+// Resolver
+// Column names come from the catalog and are quoted, and values are bound
+// as parameters, so nothing from the request is spliced into the SQL.
+// -----------------------------
+var comparisonOps = map[string]string{
+	"eq": "=", "neq": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=", "like": "LIKE",
+}
+
+func queryRows(reader *sqlx.DB, table string, columns []db.Column, args map[string]interface{}) ([]map[string]interface{}, error) {
+	conds := []string{}
+	params := []interface{}{}
+	bind := func(v interface{}) string {
+		params = append(params, v)
+		return fmt.Sprintf("$%d", len(params))
+	}
+
+	if where, ok := args["where"].(map[string]interface{}); ok {
+		for col, raw := range where {
+			cmp, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			col := db.QuoteIdent(col)
+			for op, v := range cmp {
+				switch op {
+				case "is_null":
+					if v.(bool) {
+						conds = append(conds, col+" IS NULL")
+					} else {
+						conds = append(conds, col+" IS NOT NULL")
+					}
+				case "in":
+					vals, _ := v.([]interface{})
+					if len(vals) == 0 {
+						conds = append(conds, "1 = 0")
+						continue
+					}
+					holders := make([]string, len(vals))
+					for i, iv := range vals {
+						holders[i] = bind(iv)
+					}
+					conds = append(conds, fmt.Sprintf("%s IN (%s)", col, strings.Join(holders, ", ")))
+				default:
+					conds = append(conds, fmt.Sprintf("%s %s %s", col, comparisonOps[op], bind(v)))
+				}
+			}
+		}
+	}
+
+	// Skip soft-deleted rows
+	if include, _ := args["include_deleted"].(bool); !include {
+		soft, err := etl.SoftDeletes(reader, table)
+		if err != nil {
+			return nil, err
+		}
+		if soft {
+			conds = append(conds, fmt.Sprintf(`"%s" IS NULL`, etl.DeletedAtColumn))
+		}
+	}
+
+	cols := make([]string, len(columns))
+	for i, c := range columns {
+		cols[i] = db.QuoteIdent(c.ColumnName)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), db.QuoteTable(table))
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	if order, ok := args["order_by"].([]interface{}); ok && len(order) > 0 {
+		terms := make([]string, 0, len(order))
+		for _, o := range order {
+			ob := o.(map[string]interface{})
+			term := db.QuoteIdent(ob["column"].(string))
+			if desc, _ := ob["desc"].(bool); desc {
+				term += " DESC"
+			}
+			terms = append(terms, term)
+		}
+		query += " ORDER BY " + strings.Join(terms, ", ")
+	}
+
+	limit, _ := args["limit"].(int)
+	offset, _ := args["offset"].(int)
+	if limit < 0 || offset < 0 {
+		return nil, fmt.Errorf("limit and offset must be non-negative")
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+
+	rows, err := reader.Queryx(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("query %s failed: %w", table, err)
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return nil, fmt.Errorf("scan %s failed: %w", table, err)
+		}
+		for k, v := range row {
+			switch t := v.(type) {
+			case []byte:
+				row[k] = string(t)
+			case time.Time:
+				row[k] = t.Format(time.RFC3339Nano)
+			}
+		}
+		results = append(results, row)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,148 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/grpcapi/pb"
+	"github.com/alkha0306/godataflow/internal/handlers"
+	"github.com/alkha0306/godataflow/internal/workspace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// unaryAuth is the gRPC counterpart of handlers.APIKeyAuth and
+// handlers.WorkspaceScope. Keys come from "x-api-key" or
+// "authorization: Bearer <key>" metadata.
+func unaryAuth(keys []string, workspaces *workspace.Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, keys, workspaces, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func streamAuth(keys []string, workspaces *workspace.Registry) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), keys, workspaces, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return next(srv, authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorizedStream carries the context authorize returned into the handler
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authorizedStream) Context() context.Context { return s.ctx }
+
+// methodRoutes are the REST routes the methods mirror, which decide what
+// workspace keys of each scope may call
+var methodRoutes = map[string]string{
+	pb.GoDataFlowService_ListTables_FullMethodName:      "GET /tables",
+	pb.GoDataFlowService_CreateTable_FullMethodName:     "POST /tables",
+	pb.GoDataFlowService_DeleteTable_FullMethodName:     "DELETE /tables/:name",
+	pb.GoDataFlowService_GetTableColumns_FullMethodName: "GET /tables/:name/columns",
+	pb.GoDataFlowService_Ingest_FullMethodName:          "POST /ingest/:table_name",
+	pb.GoDataFlowService_Query_FullMethodName:           "GET /query",
+}
+
+// Context keys authorize stores the caller and a workspace key's workspace under
+type (
+	callerKey    struct{}
+	workspaceKey struct{}
+)
+
+// authorize accepts a configured key, acting in the default workspace, or
+// a workspace key whose scope allows method, confining the call to its
+// workspace. With no keys configured, calls without a workspace key are
+// let through. The returned context carries the caller for the query
+// audit log.
+func authorize(ctx context.Context, keys []string, workspaces *workspace.Registry, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	apiKey, authorization := first(md.Get("x-api-key")), first(md.Get("authorization"))
+	if handlers.ValidAPIKey(keys, apiKey, authorization) {
+		return context.WithValue(ctx, callerKey{}, handlers.KeyCaller(apiKey, authorization)), nil
+	}
+
+	provided := apiKey
+	if provided == "" && strings.HasPrefix(authorization, "Bearer ") {
+		provided = strings.TrimPrefix(authorization, "Bearer ")
+	}
+	if !strings.HasPrefix(provided, workspace.KeyPrefix) {
+		if len(keys) == 0 {
+			return ctx, nil
+		}
+		return ctx, status.Error(codes.Unauthenticated, "missing or invalid API key")
+	}
+
+	ws, key, err := workspaces.Authenticate(provided)
+	switch {
+	case errors.Is(err, workspace.ErrNotFound):
+		return ctx, status.Error(codes.Unauthenticated, "missing or invalid API key")
+	case errors.Is(err, workspace.ErrExpired):
+		return ctx, status.Error(codes.Unauthenticated, "API key expired")
+	case err != nil:
+		return ctx, status.Errorf(codes.Internal, "failed to check API key: %v", err)
+	}
+	if !handlers.ScopeAllows(key.Scope, methodRoutes[method]) {
+		return ctx, status.Errorf(codes.PermissionDenied, "%s is not available to %s workspace API keys", method, key.Scope)
+	}
+	ctx = context.WithValue(ctx, workspaceKey{}, ws)
+	return context.WithValue(ctx, callerKey{}, key.Prefix), nil
+}
+
+// workspaceOf is the workspace a workspace key confines the call to; nil
+// is the default workspace
+func workspaceOf(ctx context.Context) *workspace.Workspace {
+	ws, _ := ctx.Value(workspaceKey{}).(*workspace.Workspace)
+	return ws
+}
+
+// qualify resolves a table named in a request into the caller's workspace
+func qualify(ctx context.Context, table string) (string, error) {
+	qualified, err := handlers.QualifyTable(workspaceOf(ctx), table)
+	if err != nil {
+		return "", toStatus(err)
+	}
+	return qualified, nil
+}
+
+// callerOf is who made the call, as authorize identified them
+func callerOf(ctx context.Context) string {
+	if caller, _ := ctx.Value(callerKey{}).(string); caller != "" {
+		return caller
+	}
+	return "anonymous"
+}
+
+// clientIP is the peer address of the call without its port, or "" when unknown
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func first(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
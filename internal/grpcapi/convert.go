@@ -0,0 +1,97 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/grpcapi/pb"
+	"github.com/alkha0306/godataflow/internal/handlers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// httpCodes maps the REST statuses used by the handlers to gRPC codes
+var httpCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.AlreadyExists,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// toStatus converts a handler error into a gRPC status with the same message
+func toStatus(err error) error {
+	var re *handlers.RequestError
+	if !errors.As(err, &re) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code, ok := httpCodes[re.Status]
+	if !ok {
+		code = codes.Internal
+	}
+	return status.Error(code, re.Error())
+}
+
+func tableToProto(t handlers.TableMetadata) *pb.Table {
+	out := &pb.Table{
+		Id:               int64(t.ID),
+		TableName:        t.TableName,
+		TableType:        t.TableType,
+		DataSourceUrl:    t.DataSourceURL,
+		LastRefreshError: t.LastRefreshError,
+		Status:           t.Status,
+		WatermarkColumn:  t.WatermarkColumn,
+		WatermarkValue:   t.WatermarkValue,
+		CreatedAt:        timestamppb.New(t.CreatedAt),
+		UpdatedAt:        timestamppb.New(t.UpdatedAt),
+	}
+	if t.RefreshInterval != nil {
+		interval := int32(*t.RefreshInterval)
+		out.RefreshInterval = &interval
+	}
+	if t.LastRefreshSuccess != nil {
+		out.LastRefreshSuccess = timestamppb.New(*t.LastRefreshSuccess)
+	}
+	return out
+}
+
+// maxExactInt is the largest integer a protobuf Value's double holds exactly
+const maxExactInt = 1 << 53
+
+// rowToStruct converts a MapScan row, turning driver types structpb can't
+// hold (text as []byte, timestamps) into strings. Values a double would
+// round, decimals (json.Number, see export.Decimals) and integers beyond
+// ±2^53, are sent as their exact text too.
+func rowToStruct(row map[string]interface{}) (*structpb.Struct, error) {
+	fields := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		switch t := v.(type) {
+		case []byte:
+			fields[k] = string(t)
+		case time.Time:
+			fields[k] = t.Format(time.RFC3339Nano)
+		case json.Number:
+			fields[k] = t.String()
+		case int64:
+			if t > maxExactInt || t < -maxExactInt {
+				fields[k] = strconv.FormatInt(t, 10)
+			} else {
+				fields[k] = t
+			}
+		case nil, bool, string, int32, int, float64, float32:
+			fields[k] = t
+		default:
+			fields[k] = fmt.Sprint(t)
+		}
+	}
+	return structpb.NewStruct(fields)
+}
@@ -0,0 +1,962 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: godataflow/v1/godataflow.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Table struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Id                 int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TableName          string                 `protobuf:"bytes,2,opt,name=table_name,json=tableName,proto3" json:"table_name,omitempty"`
+	TableType          string                 `protobuf:"bytes,3,opt,name=table_type,json=tableType,proto3" json:"table_type,omitempty"`
+	RefreshInterval    *int32                 `protobuf:"varint,4,opt,name=refresh_interval,json=refreshInterval,proto3,oneof" json:"refresh_interval,omitempty"` // seconds
+	DataSourceUrl      *string                `protobuf:"bytes,5,opt,name=data_source_url,json=dataSourceUrl,proto3,oneof" json:"data_source_url,omitempty"`
+	LastRefreshSuccess *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=last_refresh_success,json=lastRefreshSuccess,proto3" json:"last_refresh_success,omitempty"`
+	LastRefreshError   *string                `protobuf:"bytes,7,opt,name=last_refresh_error,json=lastRefreshError,proto3,oneof" json:"last_refresh_error,omitempty"`
+	Status             string                 `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`
+	WatermarkColumn    *string                `protobuf:"bytes,9,opt,name=watermark_column,json=watermarkColumn,proto3,oneof" json:"watermark_column,omitempty"`
+	WatermarkValue     *string                `protobuf:"bytes,10,opt,name=watermark_value,json=watermarkValue,proto3,oneof" json:"watermark_value,omitempty"`
+	CreatedAt          *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt          *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Table) Reset() {
+	*x = Table{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Table) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Table) ProtoMessage() {}
+
+func (x *Table) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Table.ProtoReflect.Descriptor instead.
+func (*Table) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Table) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Table) GetTableName() string {
+	if x != nil {
+		return x.TableName
+	}
+	return ""
+}
+
+func (x *Table) GetTableType() string {
+	if x != nil {
+		return x.TableType
+	}
+	return ""
+}
+
+func (x *Table) GetRefreshInterval() int32 {
+	if x != nil && x.RefreshInterval != nil {
+		return *x.RefreshInterval
+	}
+	return 0
+}
+
+func (x *Table) GetDataSourceUrl() string {
+	if x != nil && x.DataSourceUrl != nil {
+		return *x.DataSourceUrl
+	}
+	return ""
+}
+
+func (x *Table) GetLastRefreshSuccess() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastRefreshSuccess
+	}
+	return nil
+}
+
+func (x *Table) GetLastRefreshError() string {
+	if x != nil && x.LastRefreshError != nil {
+		return *x.LastRefreshError
+	}
+	return ""
+}
+
+func (x *Table) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Table) GetWatermarkColumn() string {
+	if x != nil && x.WatermarkColumn != nil {
+		return *x.WatermarkColumn
+	}
+	return ""
+}
+
+func (x *Table) GetWatermarkValue() string {
+	if x != nil && x.WatermarkValue != nil {
+		return *x.WatermarkValue
+	}
+	return ""
+}
+
+func (x *Table) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Table) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type Column struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ColumnName    string                 `protobuf:"bytes,1,opt,name=column_name,json=columnName,proto3" json:"column_name,omitempty"`
+	DataType      string                 `protobuf:"bytes,2,opt,name=data_type,json=dataType,proto3" json:"data_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Column) Reset() {
+	*x = Column{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Column) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Column) ProtoMessage() {}
+
+func (x *Column) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Column.ProtoReflect.Descriptor instead.
+func (*Column) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Column) GetColumnName() string {
+	if x != nil {
+		return x.ColumnName
+	}
+	return ""
+}
+
+func (x *Column) GetDataType() string {
+	if x != nil {
+		return x.DataType
+	}
+	return ""
+}
+
+type ListTablesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTablesRequest) Reset() {
+	*x = ListTablesRequest{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTablesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTablesRequest) ProtoMessage() {}
+
+func (x *ListTablesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTablesRequest.ProtoReflect.Descriptor instead.
+func (*ListTablesRequest) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{2}
+}
+
+type ListTablesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tables        []*Table               `protobuf:"bytes,1,rep,name=tables,proto3" json:"tables,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTablesResponse) Reset() {
+	*x = ListTablesResponse{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTablesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTablesResponse) ProtoMessage() {}
+
+func (x *ListTablesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTablesResponse.ProtoReflect.Descriptor instead.
+func (*ListTablesResponse) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListTablesResponse) GetTables() []*Table {
+	if x != nil {
+		return x.Tables
+	}
+	return nil
+}
+
+type CreateTableRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	TableName       string                 `protobuf:"bytes,1,opt,name=table_name,json=tableName,proto3" json:"table_name,omitempty"` // "name", or "schema.name" on PostgreSQL
+	TableType       string                 `protobuf:"bytes,2,opt,name=table_type,json=tableType,proto3" json:"table_type,omitempty"`
+	RefreshInterval *int32                 `protobuf:"varint,3,opt,name=refresh_interval,json=refreshInterval,proto3,oneof" json:"refresh_interval,omitempty"`
+	Columns         map[string]string      `protobuf:"bytes,4,rep,name=columns,proto3" json:"columns,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // column name -> SQL type
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CreateTableRequest) Reset() {
+	*x = CreateTableRequest{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateTableRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTableRequest) ProtoMessage() {}
+
+func (x *CreateTableRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTableRequest.ProtoReflect.Descriptor instead.
+func (*CreateTableRequest) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateTableRequest) GetTableName() string {
+	if x != nil {
+		return x.TableName
+	}
+	return ""
+}
+
+func (x *CreateTableRequest) GetTableType() string {
+	if x != nil {
+		return x.TableType
+	}
+	return ""
+}
+
+func (x *CreateTableRequest) GetRefreshInterval() int32 {
+	if x != nil && x.RefreshInterval != nil {
+		return *x.RefreshInterval
+	}
+	return 0
+}
+
+func (x *CreateTableRequest) GetColumns() map[string]string {
+	if x != nil {
+		return x.Columns
+	}
+	return nil
+}
+
+type CreateTableResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Table         *Table                 `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateTableResponse) Reset() {
+	*x = CreateTableResponse{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateTableResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTableResponse) ProtoMessage() {}
+
+func (x *CreateTableResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTableResponse.ProtoReflect.Descriptor instead.
+func (*CreateTableResponse) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CreateTableResponse) GetTable() *Table {
+	if x != nil {
+		return x.Table
+	}
+	return nil
+}
+
+type DeleteTableRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TableName     string                 `protobuf:"bytes,1,opt,name=table_name,json=tableName,proto3" json:"table_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTableRequest) Reset() {
+	*x = DeleteTableRequest{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTableRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTableRequest) ProtoMessage() {}
+
+func (x *DeleteTableRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTableRequest.ProtoReflect.Descriptor instead.
+func (*DeleteTableRequest) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteTableRequest) GetTableName() string {
+	if x != nil {
+		return x.TableName
+	}
+	return ""
+}
+
+type DeleteTableResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTableResponse) Reset() {
+	*x = DeleteTableResponse{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTableResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTableResponse) ProtoMessage() {}
+
+func (x *DeleteTableResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTableResponse.ProtoReflect.Descriptor instead.
+func (*DeleteTableResponse) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{7}
+}
+
+type GetTableColumnsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TableName     string                 `protobuf:"bytes,1,opt,name=table_name,json=tableName,proto3" json:"table_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTableColumnsRequest) Reset() {
+	*x = GetTableColumnsRequest{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTableColumnsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTableColumnsRequest) ProtoMessage() {}
+
+func (x *GetTableColumnsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTableColumnsRequest.ProtoReflect.Descriptor instead.
+func (*GetTableColumnsRequest) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetTableColumnsRequest) GetTableName() string {
+	if x != nil {
+		return x.TableName
+	}
+	return ""
+}
+
+type GetTableColumnsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Columns       []*Column              `protobuf:"bytes,1,rep,name=columns,proto3" json:"columns,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTableColumnsResponse) Reset() {
+	*x = GetTableColumnsResponse{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTableColumnsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTableColumnsResponse) ProtoMessage() {}
+
+func (x *GetTableColumnsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTableColumnsResponse.ProtoReflect.Descriptor instead.
+func (*GetTableColumnsResponse) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetTableColumnsResponse) GetColumns() []*Column {
+	if x != nil {
+		return x.Columns
+	}
+	return nil
+}
+
+type IngestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TableName     string                 `protobuf:"bytes,1,opt,name=table_name,json=tableName,proto3" json:"table_name,omitempty"`
+	Records       []*structpb.Struct     `protobuf:"bytes,2,rep,name=records,proto3" json:"records,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestRequest) Reset() {
+	*x = IngestRequest{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestRequest) ProtoMessage() {}
+
+func (x *IngestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestRequest.ProtoReflect.Descriptor instead.
+func (*IngestRequest) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *IngestRequest) GetTableName() string {
+	if x != nil {
+		return x.TableName
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetRecords() []*structpb.Struct {
+	if x != nil {
+		return x.Records
+	}
+	return nil
+}
+
+type IngestResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TableName     string                 `protobuf:"bytes,1,opt,name=table_name,json=tableName,proto3" json:"table_name,omitempty"`
+	RowCount      int64                  `protobuf:"varint,2,opt,name=row_count,json=rowCount,proto3" json:"row_count,omitempty"`
+	Batches       int32                  `protobuf:"varint,3,opt,name=batches,proto3" json:"batches,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestResponse) Reset() {
+	*x = IngestResponse{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestResponse) ProtoMessage() {}
+
+func (x *IngestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestResponse.ProtoReflect.Descriptor instead.
+func (*IngestResponse) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *IngestResponse) GetTableName() string {
+	if x != nil {
+		return x.TableName
+	}
+	return ""
+}
+
+func (x *IngestResponse) GetRowCount() int64 {
+	if x != nil {
+		return x.RowCount
+	}
+	return 0
+}
+
+func (x *IngestResponse) GetBatches() int32 {
+	if x != nil {
+		return x.Batches
+	}
+	return 0
+}
+
+type QueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TableName     string                 `protobuf:"bytes,1,opt,name=table_name,json=tableName,proto3" json:"table_name,omitempty"`
+	Filter        string                 `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"` // SQL boolean expression, e.g. "region='Asia'"
+	Limit         int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`  // defaults to 10
+	Offset        int32                  `protobuf:"varint,4,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *QueryRequest) GetTableName() string {
+	if x != nil {
+		return x.TableName
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *QueryRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type QueryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rows          []*structpb.Struct     `protobuf:"bytes,1,rep,name=rows,proto3" json:"rows,omitempty"` // decimals and integers beyond ±2^53 are strings, exact
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryResponse) Reset() {
+	*x = QueryResponse{}
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryResponse) ProtoMessage() {}
+
+func (x *QueryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_godataflow_v1_godataflow_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryResponse.ProtoReflect.Descriptor instead.
+func (*QueryResponse) Descriptor() ([]byte, []int) {
+	return file_godataflow_v1_godataflow_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *QueryResponse) GetRows() []*structpb.Struct {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+var File_godataflow_v1_godataflow_proto protoreflect.FileDescriptor
+
+const file_godataflow_v1_godataflow_proto_rawDesc = "" +
+	"\n" +
+	"\x1egodataflow/v1/godataflow.proto\x12\rgodataflow.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x88\x05\n" +
+	"\x05Table\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1d\n" +
+	"\n" +
+	"table_name\x18\x02 \x01(\tR\ttableName\x12\x1d\n" +
+	"\n" +
+	"table_type\x18\x03 \x01(\tR\ttableType\x12.\n" +
+	"\x10refresh_interval\x18\x04 \x01(\x05H\x00R\x0frefreshInterval\x88\x01\x01\x12+\n" +
+	"\x0fdata_source_url\x18\x05 \x01(\tH\x01R\rdataSourceUrl\x88\x01\x01\x12L\n" +
+	"\x14last_refresh_success\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x12lastRefreshSuccess\x121\n" +
+	"\x12last_refresh_error\x18\a \x01(\tH\x02R\x10lastRefreshError\x88\x01\x01\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x12.\n" +
+	"\x10watermark_column\x18\t \x01(\tH\x03R\x0fwatermarkColumn\x88\x01\x01\x12,\n" +
+	"\x0fwatermark_value\x18\n" +
+	" \x01(\tH\x04R\x0ewatermarkValue\x88\x01\x01\x129\n" +
+	"\n" +
+	"created_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAtB\x13\n" +
+	"\x11_refresh_intervalB\x12\n" +
+	"\x10_data_source_urlB\x15\n" +
+	"\x13_last_refresh_errorB\x13\n" +
+	"\x11_watermark_columnB\x12\n" +
+	"\x10_watermark_value\"F\n" +
+	"\x06Column\x12\x1f\n" +
+	"\vcolumn_name\x18\x01 \x01(\tR\n" +
+	"columnName\x12\x1b\n" +
+	"\tdata_type\x18\x02 \x01(\tR\bdataType\"\x13\n" +
+	"\x11ListTablesRequest\"B\n" +
+	"\x12ListTablesResponse\x12,\n" +
+	"\x06tables\x18\x01 \x03(\v2\x14.godataflow.v1.TableR\x06tables\"\x9d\x02\n" +
+	"\x12CreateTableRequest\x12\x1d\n" +
+	"\n" +
+	"table_name\x18\x01 \x01(\tR\ttableName\x12\x1d\n" +
+	"\n" +
+	"table_type\x18\x02 \x01(\tR\ttableType\x12.\n" +
+	"\x10refresh_interval\x18\x03 \x01(\x05H\x00R\x0frefreshInterval\x88\x01\x01\x12H\n" +
+	"\acolumns\x18\x04 \x03(\v2..godataflow.v1.CreateTableRequest.ColumnsEntryR\acolumns\x1a:\n" +
+	"\fColumnsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x13\n" +
+	"\x11_refresh_interval\"A\n" +
+	"\x13CreateTableResponse\x12*\n" +
+	"\x05table\x18\x01 \x01(\v2\x14.godataflow.v1.TableR\x05table\"3\n" +
+	"\x12DeleteTableRequest\x12\x1d\n" +
+	"\n" +
+	"table_name\x18\x01 \x01(\tR\ttableName\"\x15\n" +
+	"\x13DeleteTableResponse\"7\n" +
+	"\x16GetTableColumnsRequest\x12\x1d\n" +
+	"\n" +
+	"table_name\x18\x01 \x01(\tR\ttableName\"J\n" +
+	"\x17GetTableColumnsResponse\x12/\n" +
+	"\acolumns\x18\x01 \x03(\v2\x15.godataflow.v1.ColumnR\acolumns\"a\n" +
+	"\rIngestRequest\x12\x1d\n" +
+	"\n" +
+	"table_name\x18\x01 \x01(\tR\ttableName\x121\n" +
+	"\arecords\x18\x02 \x03(\v2\x17.google.protobuf.StructR\arecords\"f\n" +
+	"\x0eIngestResponse\x12\x1d\n" +
+	"\n" +
+	"table_name\x18\x01 \x01(\tR\ttableName\x12\x1b\n" +
+	"\trow_count\x18\x02 \x01(\x03R\browCount\x12\x18\n" +
+	"\abatches\x18\x03 \x01(\x05R\abatches\"s\n" +
+	"\fQueryRequest\x12\x1d\n" +
+	"\n" +
+	"table_name\x18\x01 \x01(\tR\ttableName\x12\x16\n" +
+	"\x06filter\x18\x02 \x01(\tR\x06filter\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\x04 \x01(\x05R\x06offset\"<\n" +
+	"\rQueryResponse\x12+\n" +
+	"\x04rows\x18\x01 \x03(\v2\x17.google.protobuf.StructR\x04rows2\x81\x04\n" +
+	"\x11GoDataFlowService\x12Q\n" +
+	"\n" +
+	"ListTables\x12 .godataflow.v1.ListTablesRequest\x1a!.godataflow.v1.ListTablesResponse\x12T\n" +
+	"\vCreateTable\x12!.godataflow.v1.CreateTableRequest\x1a\".godataflow.v1.CreateTableResponse\x12T\n" +
+	"\vDeleteTable\x12!.godataflow.v1.DeleteTableRequest\x1a\".godataflow.v1.DeleteTableResponse\x12`\n" +
+	"\x0fGetTableColumns\x12%.godataflow.v1.GetTableColumnsRequest\x1a&.godataflow.v1.GetTableColumnsResponse\x12G\n" +
+	"\x06Ingest\x12\x1c.godataflow.v1.IngestRequest\x1a\x1d.godataflow.v1.IngestResponse(\x01\x12B\n" +
+	"\x05Query\x12\x1b.godataflow.v1.QueryRequest\x1a\x1c.godataflow.v1.QueryResponseB8Z6github.com/alkha0306/godataflow/internal/grpcapi/pb;pbb\x06proto3"
+
+var (
+	file_godataflow_v1_godataflow_proto_rawDescOnce sync.Once
+	file_godataflow_v1_godataflow_proto_rawDescData []byte
+)
+
+func file_godataflow_v1_godataflow_proto_rawDescGZIP() []byte {
+	file_godataflow_v1_godataflow_proto_rawDescOnce.Do(func() {
+		file_godataflow_v1_godataflow_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_godataflow_v1_godataflow_proto_rawDesc), len(file_godataflow_v1_godataflow_proto_rawDesc)))
+	})
+	return file_godataflow_v1_godataflow_proto_rawDescData
+}
+
+var file_godataflow_v1_godataflow_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_godataflow_v1_godataflow_proto_goTypes = []any{
+	(*Table)(nil),                   // 0: godataflow.v1.Table
+	(*Column)(nil),                  // 1: godataflow.v1.Column
+	(*ListTablesRequest)(nil),       // 2: godataflow.v1.ListTablesRequest
+	(*ListTablesResponse)(nil),      // 3: godataflow.v1.ListTablesResponse
+	(*CreateTableRequest)(nil),      // 4: godataflow.v1.CreateTableRequest
+	(*CreateTableResponse)(nil),     // 5: godataflow.v1.CreateTableResponse
+	(*DeleteTableRequest)(nil),      // 6: godataflow.v1.DeleteTableRequest
+	(*DeleteTableResponse)(nil),     // 7: godataflow.v1.DeleteTableResponse
+	(*GetTableColumnsRequest)(nil),  // 8: godataflow.v1.GetTableColumnsRequest
+	(*GetTableColumnsResponse)(nil), // 9: godataflow.v1.GetTableColumnsResponse
+	(*IngestRequest)(nil),           // 10: godataflow.v1.IngestRequest
+	(*IngestResponse)(nil),          // 11: godataflow.v1.IngestResponse
+	(*QueryRequest)(nil),            // 12: godataflow.v1.QueryRequest
+	(*QueryResponse)(nil),           // 13: godataflow.v1.QueryResponse
+	nil,                             // 14: godataflow.v1.CreateTableRequest.ColumnsEntry
+	(*timestamppb.Timestamp)(nil),   // 15: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),         // 16: google.protobuf.Struct
+}
+var file_godataflow_v1_godataflow_proto_depIdxs = []int32{
+	15, // 0: godataflow.v1.Table.last_refresh_success:type_name -> google.protobuf.Timestamp
+	15, // 1: godataflow.v1.Table.created_at:type_name -> google.protobuf.Timestamp
+	15, // 2: godataflow.v1.Table.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 3: godataflow.v1.ListTablesResponse.tables:type_name -> godataflow.v1.Table
+	14, // 4: godataflow.v1.CreateTableRequest.columns:type_name -> godataflow.v1.CreateTableRequest.ColumnsEntry
+	0,  // 5: godataflow.v1.CreateTableResponse.table:type_name -> godataflow.v1.Table
+	1,  // 6: godataflow.v1.GetTableColumnsResponse.columns:type_name -> godataflow.v1.Column
+	16, // 7: godataflow.v1.IngestRequest.records:type_name -> google.protobuf.Struct
+	16, // 8: godataflow.v1.QueryResponse.rows:type_name -> google.protobuf.Struct
+	2,  // 9: godataflow.v1.GoDataFlowService.ListTables:input_type -> godataflow.v1.ListTablesRequest
+	4,  // 10: godataflow.v1.GoDataFlowService.CreateTable:input_type -> godataflow.v1.CreateTableRequest
+	6,  // 11: godataflow.v1.GoDataFlowService.DeleteTable:input_type -> godataflow.v1.DeleteTableRequest
+	8,  // 12: godataflow.v1.GoDataFlowService.GetTableColumns:input_type -> godataflow.v1.GetTableColumnsRequest
+	10, // 13: godataflow.v1.GoDataFlowService.Ingest:input_type -> godataflow.v1.IngestRequest
+	12, // 14: godataflow.v1.GoDataFlowService.Query:input_type -> godataflow.v1.QueryRequest
+	3,  // 15: godataflow.v1.GoDataFlowService.ListTables:output_type -> godataflow.v1.ListTablesResponse
+	5,  // 16: godataflow.v1.GoDataFlowService.CreateTable:output_type -> godataflow.v1.CreateTableResponse
+	7,  // 17: godataflow.v1.GoDataFlowService.DeleteTable:output_type -> godataflow.v1.DeleteTableResponse
+	9,  // 18: godataflow.v1.GoDataFlowService.GetTableColumns:output_type -> godataflow.v1.GetTableColumnsResponse
+	11, // 19: godataflow.v1.GoDataFlowService.Ingest:output_type -> godataflow.v1.IngestResponse
+	13, // 20: godataflow.v1.GoDataFlowService.Query:output_type -> godataflow.v1.QueryResponse
+	15, // [15:21] is the sub-list for method output_type
+	9,  // [9:15] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_godataflow_v1_godataflow_proto_init() }
+func file_godataflow_v1_godataflow_proto_init() {
+	if File_godataflow_v1_godataflow_proto != nil {
+		return
+	}
+	file_godataflow_v1_godataflow_proto_msgTypes[0].OneofWrappers = []any{}
+	file_godataflow_v1_godataflow_proto_msgTypes[4].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_godataflow_v1_godataflow_proto_rawDesc), len(file_godataflow_v1_godataflow_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_godataflow_v1_godataflow_proto_goTypes,
+		DependencyIndexes: file_godataflow_v1_godataflow_proto_depIdxs,
+		MessageInfos:      file_godataflow_v1_godataflow_proto_msgTypes,
+	}.Build()
+	File_godataflow_v1_godataflow_proto = out.File
+	file_godataflow_v1_godataflow_proto_goTypes = nil
+	file_godataflow_v1_godataflow_proto_depIdxs = nil
+}
@@ -0,0 +1,325 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: godataflow/v1/godataflow.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GoDataFlowService_ListTables_FullMethodName      = "/godataflow.v1.GoDataFlowService/ListTables"
+	GoDataFlowService_CreateTable_FullMethodName     = "/godataflow.v1.GoDataFlowService/CreateTable"
+	GoDataFlowService_DeleteTable_FullMethodName     = "/godataflow.v1.GoDataFlowService/DeleteTable"
+	GoDataFlowService_GetTableColumns_FullMethodName = "/godataflow.v1.GoDataFlowService/GetTableColumns"
+	GoDataFlowService_Ingest_FullMethodName          = "/godataflow.v1.GoDataFlowService/Ingest"
+	GoDataFlowService_Query_FullMethodName           = "/godataflow.v1.GoDataFlowService/Query"
+)
+
+// GoDataFlowServiceClient is the client API for GoDataFlowService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GoDataFlowService mirrors the REST table, ingest and query endpoints.
+// Failures use the gRPC status matching the REST status code
+// (400 -> INVALID_ARGUMENT, 404 -> NOT_FOUND, 413 -> RESOURCE_EXHAUSTED, ...).
+// When API keys are configured, send one as "authorization: Bearer <key>"
+// or "x-api-key: <key>" metadata.
+type GoDataFlowServiceClient interface {
+	ListTables(ctx context.Context, in *ListTablesRequest, opts ...grpc.CallOption) (*ListTablesResponse, error)
+	CreateTable(ctx context.Context, in *CreateTableRequest, opts ...grpc.CallOption) (*CreateTableResponse, error)
+	DeleteTable(ctx context.Context, in *DeleteTableRequest, opts ...grpc.CallOption) (*DeleteTableResponse, error)
+	GetTableColumns(ctx context.Context, in *GetTableColumnsRequest, opts ...grpc.CallOption) (*GetTableColumnsResponse, error)
+	// Ingest inserts every message as its own batch (ingest.max_rows applies
+	// per message). The first message must name the table; later messages may
+	// leave it empty. The stream stops at the first failed batch; batches
+	// already inserted stay committed.
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestRequest, IngestResponse], error)
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+}
+
+type goDataFlowServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGoDataFlowServiceClient(cc grpc.ClientConnInterface) GoDataFlowServiceClient {
+	return &goDataFlowServiceClient{cc}
+}
+
+func (c *goDataFlowServiceClient) ListTables(ctx context.Context, in *ListTablesRequest, opts ...grpc.CallOption) (*ListTablesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTablesResponse)
+	err := c.cc.Invoke(ctx, GoDataFlowService_ListTables_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goDataFlowServiceClient) CreateTable(ctx context.Context, in *CreateTableRequest, opts ...grpc.CallOption) (*CreateTableResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateTableResponse)
+	err := c.cc.Invoke(ctx, GoDataFlowService_CreateTable_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goDataFlowServiceClient) DeleteTable(ctx context.Context, in *DeleteTableRequest, opts ...grpc.CallOption) (*DeleteTableResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteTableResponse)
+	err := c.cc.Invoke(ctx, GoDataFlowService_DeleteTable_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goDataFlowServiceClient) GetTableColumns(ctx context.Context, in *GetTableColumnsRequest, opts ...grpc.CallOption) (*GetTableColumnsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetTableColumnsResponse)
+	err := c.cc.Invoke(ctx, GoDataFlowService_GetTableColumns_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goDataFlowServiceClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestRequest, IngestResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GoDataFlowService_ServiceDesc.Streams[0], GoDataFlowService_Ingest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IngestRequest, IngestResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GoDataFlowService_IngestClient = grpc.ClientStreamingClient[IngestRequest, IngestResponse]
+
+func (c *goDataFlowServiceClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryResponse)
+	err := c.cc.Invoke(ctx, GoDataFlowService_Query_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GoDataFlowServiceServer is the server API for GoDataFlowService service.
+// All implementations must embed UnimplementedGoDataFlowServiceServer
+// for forward compatibility.
+//
+// GoDataFlowService mirrors the REST table, ingest and query endpoints.
+// Failures use the gRPC status matching the REST status code
+// (400 -> INVALID_ARGUMENT, 404 -> NOT_FOUND, 413 -> RESOURCE_EXHAUSTED, ...).
+// When API keys are configured, send one as "authorization: Bearer <key>"
+// or "x-api-key: <key>" metadata.
+type GoDataFlowServiceServer interface {
+	ListTables(context.Context, *ListTablesRequest) (*ListTablesResponse, error)
+	CreateTable(context.Context, *CreateTableRequest) (*CreateTableResponse, error)
+	DeleteTable(context.Context, *DeleteTableRequest) (*DeleteTableResponse, error)
+	GetTableColumns(context.Context, *GetTableColumnsRequest) (*GetTableColumnsResponse, error)
+	// Ingest inserts every message as its own batch (ingest.max_rows applies
+	// per message). The first message must name the table; later messages may
+	// leave it empty. The stream stops at the first failed batch; batches
+	// already inserted stay committed.
+	Ingest(grpc.ClientStreamingServer[IngestRequest, IngestResponse]) error
+	Query(context.Context, *QueryRequest) (*QueryResponse, error)
+	mustEmbedUnimplementedGoDataFlowServiceServer()
+}
+
+// UnimplementedGoDataFlowServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGoDataFlowServiceServer struct{}
+
+func (UnimplementedGoDataFlowServiceServer) ListTables(context.Context, *ListTablesRequest) (*ListTablesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTables not implemented")
+}
+func (UnimplementedGoDataFlowServiceServer) CreateTable(context.Context, *CreateTableRequest) (*CreateTableResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTable not implemented")
+}
+func (UnimplementedGoDataFlowServiceServer) DeleteTable(context.Context, *DeleteTableRequest) (*DeleteTableResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTable not implemented")
+}
+func (UnimplementedGoDataFlowServiceServer) GetTableColumns(context.Context, *GetTableColumnsRequest) (*GetTableColumnsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTableColumns not implemented")
+}
+func (UnimplementedGoDataFlowServiceServer) Ingest(grpc.ClientStreamingServer[IngestRequest, IngestResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedGoDataFlowServiceServer) Query(context.Context, *QueryRequest) (*QueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedGoDataFlowServiceServer) mustEmbedUnimplementedGoDataFlowServiceServer() {}
+func (UnimplementedGoDataFlowServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeGoDataFlowServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GoDataFlowServiceServer will
+// result in compilation errors.
+type UnsafeGoDataFlowServiceServer interface {
+	mustEmbedUnimplementedGoDataFlowServiceServer()
+}
+
+func RegisterGoDataFlowServiceServer(s grpc.ServiceRegistrar, srv GoDataFlowServiceServer) {
+	// If the following call pancis, it indicates UnimplementedGoDataFlowServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GoDataFlowService_ServiceDesc, srv)
+}
+
+func _GoDataFlowService_ListTables_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTablesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoDataFlowServiceServer).ListTables(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoDataFlowService_ListTables_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoDataFlowServiceServer).ListTables(ctx, req.(*ListTablesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoDataFlowService_CreateTable_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTableRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoDataFlowServiceServer).CreateTable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoDataFlowService_CreateTable_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoDataFlowServiceServer).CreateTable(ctx, req.(*CreateTableRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoDataFlowService_DeleteTable_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTableRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoDataFlowServiceServer).DeleteTable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoDataFlowService_DeleteTable_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoDataFlowServiceServer).DeleteTable(ctx, req.(*DeleteTableRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoDataFlowService_GetTableColumns_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTableColumnsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoDataFlowServiceServer).GetTableColumns(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoDataFlowService_GetTableColumns_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoDataFlowServiceServer).GetTableColumns(ctx, req.(*GetTableColumnsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoDataFlowService_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GoDataFlowServiceServer).Ingest(&grpc.GenericServerStream[IngestRequest, IngestResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GoDataFlowService_IngestServer = grpc.ClientStreamingServer[IngestRequest, IngestResponse]
+
+func _GoDataFlowService_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoDataFlowServiceServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoDataFlowService_Query_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoDataFlowServiceServer).Query(ctx, req.(*QueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GoDataFlowService_ServiceDesc is the grpc.ServiceDesc for GoDataFlowService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GoDataFlowService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "godataflow.v1.GoDataFlowService",
+	HandlerType: (*GoDataFlowServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTables",
+			Handler:    _GoDataFlowService_ListTables_Handler,
+		},
+		{
+			MethodName: "CreateTable",
+			Handler:    _GoDataFlowService_CreateTable_Handler,
+		},
+		{
+			MethodName: "DeleteTable",
+			Handler:    _GoDataFlowService_DeleteTable_Handler,
+		},
+		{
+			MethodName: "GetTableColumns",
+			Handler:    _GoDataFlowService_GetTableColumns_Handler,
+		},
+		{
+			MethodName: "Query",
+			Handler:    _GoDataFlowService_Query_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Ingest",
+			Handler:       _GoDataFlowService_Ingest_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "godataflow/v1/godataflow.proto",
+}
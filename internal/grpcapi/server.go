@@ -0,0 +1,207 @@
+// Package grpcapi serves the table, ingest and query operations over gRPC.
+// It calls the same handler methods as the REST API, so validation, limits
+// and error messages match. The contract lives in proto/godataflow/v1; run
+// `buf generate` from the repository root after changing it.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/alkha0306/godataflow/internal/grpcapi/pb"
+	"github.com/alkha0306/godataflow/internal/handlers"
+	"github.com/alkha0306/godataflow/internal/workspace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const defaultQueryLimit = 10
+
+// Server implements pb.GoDataFlowServiceServer on top of the REST handlers
+type Server struct {
+	pb.UnimplementedGoDataFlowServiceServer
+
+	Tables  *handlers.TableHandler
+	Ingests *handlers.DataIngestHandler
+	Queries *handlers.QueryHandler
+}
+
+func NewServer(tables *handlers.TableHandler, ingests *handlers.DataIngestHandler, queries *handlers.QueryHandler) *Server {
+	return &Server{Tables: tables, Ingests: ingests, Queries: queries}
+}
+
+// NewGRPCServer builds a grpc.Server with API key auth and the service
+// registered. Workspace keys from workspaces are accepted as over REST.
+func NewGRPCServer(srv *Server, apiKeys []string, workspaces *workspace.Registry) *grpc.Server {
+	gs := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryAuth(apiKeys, workspaces)),
+		grpc.ChainStreamInterceptor(streamAuth(apiKeys, workspaces)),
+	)
+	pb.RegisterGoDataFlowServiceServer(gs, srv)
+	return gs
+}
+
+// -----------------------------
+// Table management
+// -----------------------------
+func (s *Server) ListTables(ctx context.Context, _ *pb.ListTablesRequest) (*pb.ListTablesResponse, error) {
+	tables, err := s.Tables.List()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	ws := workspaceOf(ctx)
+	resp := &pb.ListTablesResponse{Tables: make([]*pb.Table, 0, len(tables))}
+	for _, t := range tables {
+		if !ws.Owns(t.TableName) {
+			continue
+		}
+		resp.Tables = append(resp.Tables, tableToProto(t))
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateTable(ctx context.Context, req *pb.CreateTableRequest) (*pb.CreateTableResponse, error) {
+	create := handlers.CreateTableRequest{
+		TableName: req.GetTableName(),
+		TableType: req.GetTableType(),
+		Columns:   req.GetColumns(),
+	}
+	if req.RefreshInterval != nil {
+		interval := int(req.GetRefreshInterval())
+		create.RefreshInterval = &interval
+	}
+	// binding:"required" is enforced by gin for REST; check the same fields here
+	if create.TableName == "" || create.TableType == "" || len(create.Columns) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "table_name, table_type and columns are required")
+	}
+	var err error
+	if create.TableName, err = qualify(ctx, create.TableName); err != nil {
+		return nil, err
+	}
+
+	meta, err := s.Tables.Create(create)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CreateTableResponse{Table: tableToProto(meta)}, nil
+}
+
+func (s *Server) DeleteTable(ctx context.Context, req *pb.DeleteTableRequest) (*pb.DeleteTableResponse, error) {
+	table, err := qualify(ctx, req.GetTableName())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Tables.Delete(table); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteTableResponse{}, nil
+}
+
+func (s *Server) GetTableColumns(ctx context.Context, req *pb.GetTableColumnsRequest) (*pb.GetTableColumnsResponse, error) {
+	table, err := qualify(ctx, req.GetTableName())
+	if err != nil {
+		return nil, err
+	}
+	cols, err := s.Tables.Columns(table)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.GetTableColumnsResponse{Columns: make([]*pb.Column, 0, len(cols))}
+	for _, c := range cols {
+		resp.Columns = append(resp.Columns, &pb.Column{ColumnName: c.ColumnName, DataType: c.DataType})
+	}
+	return resp, nil
+}
+
+// -----------------------------
+// Ingest
+// Each message is one INSERT, so a long stream never holds more than one
+// message's records in memory. Each message counts as one request against
+// the ingest rate quota.
+// -----------------------------
+func (s *Server) Ingest(stream pb.GoDataFlowService_IngestServer) error {
+	resp := &pb.IngestResponse{}
+	named := "" // table_name as the stream gives it, before qualifying
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		if name := msg.GetTableName(); named == "" || (name != "" && name != named) {
+			table, err := s.checkIngestTable(stream.Context(), name)
+			if err != nil {
+				return err
+			}
+			named, resp.TableName = name, table
+		}
+
+		records := make([]map[string]interface{}, 0, len(msg.GetRecords()))
+		for _, r := range msg.GetRecords() {
+			records = append(records, r.AsMap())
+		}
+		if err := s.Ingests.Quotas.AllowIngest(resp.TableName); err != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if _, err := s.Ingests.Insert(resp.TableName, records); err != nil {
+			return toStatus(err)
+		}
+		s.Ingests.Stats.Record(resp.TableName, len(records), int64(proto.Size(msg)))
+		resp.RowCount += int64(len(records))
+		resp.Batches++
+	}
+}
+
+// checkIngestTable validates a table named on the ingest stream, returning
+// it resolved into the caller's workspace
+func (s *Server) checkIngestTable(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "the first message must set table_name")
+	}
+	table, err := qualify(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Ingests.CheckTable(table); err != nil {
+		return "", toStatus(err)
+	}
+	return table, nil
+}
+
+// -----------------------------
+// Query
+// -----------------------------
+func (s *Server) Query(ctx context.Context, req *pb.QueryRequest) (*pb.QueryResponse, error) {
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultQueryLimit
+	}
+	if limit < 0 || req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must be non-negative")
+	}
+
+	table, err := qualify(ctx, req.GetTableName())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.Queries.QueryAs(workspaceOf(ctx), callerOf(ctx), clientIP(ctx), table, req.GetFilter(), limit, int(req.GetOffset()), false)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.QueryResponse{Rows: make([]*structpb.Struct, 0, len(rows))}
+	for _, row := range rows {
+		st, err := rowToStruct(row)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encode row: %v", err)
+		}
+		resp.Rows = append(resp.Rows, st)
+	}
+	return resp, nil
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogger returns the HTTP access log middleware for the given format
+// ("text", "json" or "off"). Returns nil for "off".
+func AccessLogger(format string) gin.HandlerFunc {
+	switch format {
+	case "off":
+		return nil
+	case "json":
+		return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+			entry := map[string]interface{}{
+				"time":        p.TimeStamp.Format(time.RFC3339),
+				"status":      p.StatusCode,
+				"method":      p.Method,
+				"path":        p.Path,
+				"latency_ms":  float64(p.Latency.Microseconds()) / 1000,
+				"client_ip":   p.ClientIP,
+				"body_size":   p.BodySize,
+				"error":       p.ErrorMessage,
+				"user_agent":  p.Request.UserAgent(),
+				"request_len": p.Request.ContentLength,
+			}
+			line, _ := json.Marshal(entry)
+			return string(line) + "\n"
+		})
+	default:
+		return gin.Logger()
+	}
+}
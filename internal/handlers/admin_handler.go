@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/backup"
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// AdminHandler serves operational endpoints for deployment tooling
+type AdminHandler struct {
+	DB     *sqlx.DB
+	Events *events.Broker
+}
+
+func NewAdminHandler(db *sqlx.DB, broker *events.Broker) *AdminHandler {
+	return &AdminHandler{DB: db, Events: broker}
+}
+
+// GET /admin/migrations
+// Reports applied and pending migrations with checksums. "up_to_date" is true
+// only when nothing is pending and no applied migration was modified, so a
+// deploy can gate traffic on it.
+func (h *AdminHandler) Migrations(c *gin.Context) {
+	states, err := db.MigrationStatus(h.DB)
+	if err != nil {
+		log.Printf("migration status error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read migration status", "details": err.Error()})
+		return
+	}
+
+	applied := []string{}
+	pending := []string{}
+	modified := []string{}
+	for _, st := range states {
+		if st.Applied {
+			applied = append(applied, st.Version)
+		} else {
+			pending = append(pending, st.Version)
+		}
+		if st.Modified {
+			modified = append(modified, st.Version)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dialect":    db.DialectOf(h.DB),
+		"up_to_date": len(pending) == 0 && len(modified) == 0,
+		"applied":    applied,
+		"pending":    pending,
+		"modified":   modified,
+		"migrations": states,
+	})
+}
+
+// GET /admin/backup?tables=a,b&data=true
+// Streams a .tar.gz of the metadata tables plus the selected tables (all by
+// default); data=false backs up table definitions without their rows.
+func (h *AdminHandler) Backup(c *gin.Context) {
+	opts := backup.Options{Data: c.DefaultQuery("data", "true") != "false"}
+	if raw := c.Query("tables"); raw != "" {
+		opts.Tables = strings.Split(raw, ",")
+	}
+
+	archive, err := backup.Prepare(h.DB, opts)
+	if errors.Is(err, backup.ErrUnknownTable) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("backup error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to back up", "details": err.Error()})
+		return
+	}
+	defer archive.Close()
+
+	name := fmt.Sprintf("godataflow-backup-%s.tar.gz", archive.Manifest.CreatedAt.Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	c.Status(http.StatusOK)
+	if _, err := archive.WriteTo(c.Writer); err != nil {
+		log.Printf("backup write error: %v", err)
+	}
+}
+
+// POST /admin/restore
+// Body: an archive from GET /admin/backup. Restores its tables and metadata
+// in one transaction; 409 when any of its tables already exists.
+func (h *AdminHandler) Restore(c *gin.Context) {
+	res, err := backup.Restore(h.DB, c.Request.Body)
+	var conflict *backup.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "tables already exist", "tables": conflict.Tables})
+		return
+	case errors.Is(err, backup.ErrInvalidArchive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid backup archive", "details": err.Error()})
+		return
+	case err != nil:
+		log.Printf("restore error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore", "details": err.Error()})
+		return
+	}
+
+	for table := range res.Tables {
+		h.Events.Publish(events.Event{Type: events.TableCreated, Table: table})
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/alkha0306/godataflow/internal/cdc"
+	"github.com/gin-gonic/gin"
+)
+
+type CDCHandler struct {
+	Outbox *cdc.Outbox
+}
+
+func NewCDCHandler(outbox *cdc.Outbox) *CDCHandler {
+	return &CDCHandler{Outbox: outbox}
+}
+
+// GET /admin/cdc
+// Change capture backlog and the last delivery to Kafka
+func (h *CDCHandler) Status(c *gin.Context) {
+	status, err := h.Outbox.Status()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to read the cdc outbox", err))
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// POST /admin/cdc/retry
+// Requeues the dead-lettered batches, e.g. after fixing topic permissions
+func (h *CDCHandler) Retry(c *gin.Context) {
+	n, err := h.Outbox.Retry()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to requeue cdc batches", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requeued": n})
+}
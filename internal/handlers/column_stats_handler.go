@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// columnStatsTTL bounds how stale cached statistics get when rows
+	// change without an event (another instance, direct SQL); writes
+	// through the API drop them right away
+	columnStatsTTL = 15 * time.Minute
+
+	defaultHistogramBuckets = 10
+	maxHistogramBuckets     = 100
+)
+
+// Histogram kinds
+const (
+	HistogramEqualWidth = "equal_width" // numeric columns: counts per value range
+	HistogramTopValues  = "top_values"  // other columns: the most frequent values
+)
+
+// ColumnStats summarises one column's values
+type ColumnStats struct {
+	Table         string      `json:"table"`
+	Column        string      `json:"column"`
+	DataType      string      `json:"data_type"`
+	RowCount      int64       `json:"row_count"`
+	NullCount     int64       `json:"null_count"`
+	NullRate      float64     `json:"null_rate"`
+	DistinctCount *int64      `json:"distinct_count,omitempty"` // omitted for JSON columns
+	Min           interface{} `json:"min,omitempty"`
+	Max           interface{} `json:"max,omitempty"`
+	Histogram     *Histogram  `json:"histogram,omitempty"`
+	ComputedAt    time.Time   `json:"computed_at"`
+	Cached        bool        `json:"cached"`
+}
+
+// Histogram is the distribution of a column's non-null values
+type Histogram struct {
+	Kind    string            `json:"kind"`
+	Buckets []HistogramBucket `json:"buckets,omitempty"` // equal_width
+	Values  []ValueCount      `json:"values,omitempty"`  // top_values
+}
+
+// HistogramBucket counts values with Lower <= v < Upper; the last bucket
+// includes Upper
+type HistogramBucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int64   `json:"count"`
+}
+
+// ValueCount is a value and how many rows hold it
+type ValueCount struct {
+	Value interface{} `db:"value" json:"value"`
+	Count int64       `db:"n" json:"count"`
+}
+
+// ColumnStatsHandler computes column statistics on demand and caches them
+// until the table changes
+type ColumnStatsHandler struct {
+	Reads  *db.ReadRouter
+	Events *events.Broker
+
+	mu    sync.Mutex
+	cache map[string]ColumnStats // by table, column and bucket count
+}
+
+func NewColumnStatsHandler(reads *db.ReadRouter, broker *events.Broker) *ColumnStatsHandler {
+	return &ColumnStatsHandler{Reads: reads, Events: broker, cache: map[string]ColumnStats{}}
+}
+
+// GET /tables/:name/columns/:col/stats?buckets=10&refresh=true
+// Cardinality, null rate, min/max and a histogram of one column, for
+// query builders suggesting filter values. Results are cached until rows
+// are written through the API or columnStatsTTL passes; refresh=true
+// recomputes them.
+func (h *ColumnStatsHandler) GetColumnStats(c *gin.Context) {
+	buckets, err := strconv.Atoi(c.DefaultQuery("buckets", strconv.Itoa(defaultHistogramBuckets)))
+	if err != nil || buckets <= 0 || buckets > maxHistogramBuckets {
+		writeError(c, requestError(http.StatusBadRequest, fmt.Sprintf("buckets must be between 1 and %d", maxHistogramBuckets), nil))
+		return
+	}
+	table, column := c.Param("name"), c.Param("col")
+	key := fmt.Sprintf("%s\x00%s\x00%d", table, column, buckets)
+
+	if c.Query("refresh") != "true" {
+		h.mu.Lock()
+		stats, ok := h.cache[key]
+		h.mu.Unlock()
+		if ok && time.Since(stats.ComputedAt) < columnStatsTTL {
+			stats.Cached = true
+			c.JSON(http.StatusOK, stats)
+			return
+		}
+	}
+
+	stats, err := h.Compute(table, column, buckets)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	h.mu.Lock()
+	h.cache[key] = stats
+	h.mu.Unlock()
+	c.JSON(http.StatusOK, stats)
+}
+
+// Compute scans table for column's statistics
+func (h *ColumnStatsHandler) Compute(table, column string, buckets int) (ColumnStats, error) {
+	stats := ColumnStats{Table: table, Column: column}
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return stats, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	reader := h.Reads.Reader()
+	cols, err := db.TableColumns(reader, table)
+	if err != nil {
+		return stats, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	if len(cols) == 0 {
+		return stats, requestError(http.StatusNotFound, "table not found", nil)
+	}
+	for _, col := range cols {
+		if col.ColumnName == column {
+			stats.DataType = col.DataType
+		}
+	}
+	if stats.DataType == "" {
+		return stats, requestError(http.StatusNotFound, "column not found", nil)
+	}
+	typ := strings.ToLower(stats.DataType)
+	numeric := isIntegerType(typ) || isNumericType(typ)
+	// Postgres can't group JSON values, nor take the min of a boolean
+	groupable := !strings.Contains(typ, "json")
+	ordered := groupable && !strings.Contains(typ, "bool")
+
+	fail := func(err error) (ColumnStats, error) {
+		log.Printf("column stats error: table=%s column=%s err=%v", table, column, err)
+		return stats, requestError(http.StatusInternalServerError, "failed to compute column stats", nil)
+	}
+
+	exprs := []string{"COUNT(*)", fmt.Sprintf("COUNT(%s)", column)}
+	if groupable {
+		exprs = append(exprs, fmt.Sprintf("COUNT(DISTINCT %s)", column))
+	}
+	if ordered {
+		exprs = append(exprs, fmt.Sprintf("MIN(%s)", column), fmt.Sprintf("MAX(%s)", column))
+	}
+	row := reader.QueryRowx(fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(exprs, ", "), t.Quoted()))
+	values, err := row.SliceScan()
+	if err != nil {
+		return fail(err)
+	}
+	stats.RowCount = toInt64(values[0])
+	stats.NullCount = stats.RowCount - toInt64(values[1])
+	if stats.RowCount > 0 {
+		stats.NullRate = float64(stats.NullCount) / float64(stats.RowCount)
+	}
+	if groupable {
+		distinct := toInt64(values[2])
+		stats.DistinctCount = &distinct
+	}
+	if ordered {
+		stats.Min, stats.Max = plainValue(values[3]), plainValue(values[4])
+	}
+
+	switch {
+	case !groupable || stats.RowCount == stats.NullCount:
+	case numeric:
+		lo, errLo := asFloat(stats.Min)
+		hi, errHi := asFloat(stats.Max)
+		if errLo != nil || errHi != nil {
+			break
+		}
+		hist, err := equalWidth(reader, t.String(), column, lo, hi, buckets)
+		if err != nil {
+			return fail(err)
+		}
+		stats.Histogram = hist
+	default:
+		values := []ValueCount{}
+		err := reader.Select(&values, fmt.Sprintf(`
+			SELECT %[1]s AS value, COUNT(*) AS n FROM %[2]s
+			WHERE %[1]s IS NOT NULL
+			GROUP BY %[1]s
+			ORDER BY n DESC, value
+			LIMIT %[3]d`, column, t.Quoted(), buckets))
+		if err != nil {
+			return fail(err)
+		}
+		for i := range values {
+			values[i].Value = plainValue(values[i].Value)
+		}
+		stats.Histogram = &Histogram{Kind: HistogramTopValues, Values: values}
+	}
+
+	stats.ComputedAt = time.Now().UTC()
+	return stats, nil
+}
+
+// equalWidth counts column's values in n equal ranges between lo and hi.
+// Bounds are written into the query as literals: bound parameters would
+// be typed as the column and refuse fractions on integer columns.
+func equalWidth(reader *sqlx.DB, table, column string, lo, hi float64, n int) (*Histogram, error) {
+	if lo == hi {
+		n = 1
+	}
+	width := (hi - lo) / float64(n)
+	hist := &Histogram{Kind: HistogramEqualWidth, Buckets: make([]HistogramBucket, n)}
+	sums := make([]string, n)
+	for i := range hist.Buckets {
+		lower, upper := lo+float64(i)*width, lo+float64(i+1)*width
+		if i == n-1 {
+			upper = hi
+		}
+		hist.Buckets[i] = HistogramBucket{Lower: lower, Upper: upper}
+		cond := fmt.Sprintf("%s >= %s AND %s < %s", column, sqlFloat(lower), column, sqlFloat(upper))
+		if i == n-1 {
+			cond = fmt.Sprintf("%s >= %s", column, sqlFloat(lower))
+		}
+		sums[i] = fmt.Sprintf("SUM(CASE WHEN %s THEN 1 ELSE 0 END)", cond)
+	}
+	values, err := reader.QueryRowx(fmt.Sprintf(`SELECT %s FROM %s WHERE %s IS NOT NULL`, strings.Join(sums, ", "), db.QuoteTable(table), column)).SliceScan()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		hist.Buckets[i].Count = toInt64(v)
+	}
+	return hist, nil
+}
+
+// Watch drops a table's cached statistics whenever its rows change
+func (h *ColumnStatsHandler) Watch(ctx context.Context) {
+	if h.Events == nil {
+		return
+	}
+	sub := h.Events.Subscribe()
+	defer h.Events.Unsubscribe(sub)
+
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			switch ev.Type {
+			case events.RowsIngested, events.RowsUpdated, events.RowsDeleted, events.JobSucceeded, events.ImportProgress, events.TableDeleted:
+				h.mu.Lock()
+				for key := range h.cache {
+					if strings.HasPrefix(key, ev.Table+"\x00") {
+						delete(h.cache, key)
+					}
+				}
+				h.mu.Unlock()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sqlFloat formats f as a SQL numeric literal
+func sqlFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// plainValue turns driver byte slices (Postgres numerics, SQLite text)
+// into strings so they encode as JSON text
+func plainValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// toInt64 reads a COUNT or SUM; NULL (SUM over no rows) is 0
+func toInt64(v interface{}) int64 {
+	switch n := plainValue(v).(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
+
+// asFloat reads a numeric MIN or MAX
+func asFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int16:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
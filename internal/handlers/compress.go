@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var gzipPool = sync.Pool{
+	New: func() interface{} {
+		gz, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return gz
+	},
+}
+
+// Gzip compresses responses for clients sending "Accept-Encoding: gzip".
+// Bodies are buffered up to minBytes first; smaller responses, streams that
+// flush early (SSE) and non-text content types are passed through untouched.
+func Gzip(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		orig := c.Writer
+		w := &gzipWriter{ResponseWriter: orig, minBytes: minBytes}
+		c.Writer = w
+		defer func() {
+			w.close()
+			c.Writer = orig
+		}()
+
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// compressible limits gzip to text-like payloads; event streams must stay unbuffered
+func compressible(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	switch {
+	case ct == "text/event-stream":
+		return false
+	case strings.HasPrefix(ct, "text/"),
+		ct == "application/json",
+		ct == "application/x-ndjson",
+		ct == "application/xml",
+		ct == "application/javascript":
+		return true
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response until it knows whether
+// compressing is worthwhile, then commits to gzip or passthrough.
+type gzipWriter struct {
+	gin.ResponseWriter
+	minBytes int
+	buf      []byte
+	gz       *gzip.Writer
+	decided  bool
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minBytes {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush commits to passthrough if nothing was decided yet, so streams stay live
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipWriter) decide(large bool) error {
+	w.decided = true
+	h := w.Header()
+
+	status := w.Status()
+	if large && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		h.Add("Vary", "Accept-Encoding")
+		w.gz = gzipPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close flushes whatever is buffered and finishes the gzip stream
+func (w *gzipWriter) close() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+		gzipPool.Put(w.gz)
+		w.gz = nil
+	}
+}
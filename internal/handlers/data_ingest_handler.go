@@ -1,59 +1,264 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/alkha0306/godataflow/internal/cdc"
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/ingeststats"
+	"github.com/alkha0306/godataflow/internal/quota"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
 type DataIngestHandler struct {
-	DB *sqlx.DB
+	DB     *sqlx.DB
+	Events *events.Broker
+	CDC    *cdc.Outbox           // nil = change capture off
+	Quotas *quota.Enforcer       // nil = no quotas
+	Stats  *ingeststats.Recorder // nil = volumes not counted
+	Limits IngestLimits
+
+	// IdempotencyTTL is how long an Idempotency-Key's response is replayed; 0 = forever
+	IdempotencyTTL time.Duration
+}
+
+// IngestLimits caps a single POST /ingest request; zero values disable a limit
+type IngestLimits struct {
+	MaxBodyBytes int64
+	MaxRows      int
 }
 
-func NewDataIngestHandler(db *sqlx.DB) *DataIngestHandler {
-	return &DataIngestHandler{DB: db}
+// maxEventRows is the largest batch whose rows are carried in the
+// rows.ingested event; bigger batches only report the row count
+const maxEventRows = 100
+
+func NewDataIngestHandler(db *sqlx.DB, broker *events.Broker, outbox *cdc.Outbox, quotas *quota.Enforcer, stats *ingeststats.Recorder, limits IngestLimits, idempotencyTTL time.Duration) *DataIngestHandler {
+	return &DataIngestHandler{DB: db, Events: broker, CDC: outbox, Quotas: quotas, Stats: stats, Limits: limits, IdempotencyTTL: idempotencyTTL}
 }
 
-// IngestData handles POST /ingest/:table_name
+// IngestData handles POST /ingest/:table_name. By default (mode=atomic)
+// the request loads in full or not at all. With ?mode=partial rows that
+// don't fit the table are reported instead of failing the request; with
+// ?mode=batch the records load in batches of batch_size, each committed
+// on its own, and failing batches are reported.
 func (h *DataIngestHandler) IngestData(c *gin.Context) {
 	tableName := c.Param("table_name")
-	if tableName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing table name"})
+	if err := h.CheckTable(tableName); err != nil {
+		writeError(c, err)
+		return
+	}
+	mode := c.DefaultQuery("mode", IngestAtomic)
+	if mode != IngestAtomic && mode != IngestPartial && mode != IngestBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode", "details": "mode must be atomic, partial or batch"})
+		return
+	}
+	if mode != IngestAtomic && c.GetHeader("Idempotency-Key") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is not supported with mode=" + mode})
+		return
+	}
+	if err := h.Quotas.AllowIngest(tableName); err != nil {
+		rateLimited(c, err)
+		return
+	}
+
+	body, ok := h.readBody(c)
+	if !ok {
+		return
+	}
+
+	switch mode {
+	case IngestPartial:
+		h.ingestPartial(c, tableName, body)
+		return
+	case IngestBatch:
+		h.ingestBatches(c, tableName, body)
+		return
+	}
+
+	// Parse JSON body (accepts array or single record); numbers keep
+	// their exact text so decimals and big IDs load without rounding
+	records, err := decodeRecords(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+		return
+	}
+
+	// Retries carrying an Idempotency-Key get the first response back
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		h.ingestOnce(c, tableName, key, body, records)
+		return
+	}
+
+	cols, err := h.Insert(tableName, records)
+	if err != nil {
+		if re, ok := err.(*RequestError); ok && re.Status == http.StatusRequestEntityTooLarge {
+			h.tooLarge(c, re.Details)
+			return
+		}
+		writeError(c, err)
 		return
 	}
+	h.Stats.Record(tableName, len(records), int64(len(body)))
+
+	c.JSON(http.StatusCreated, ingestResponse(tableName, records, cols))
+}
+
+func ingestResponse(tableName string, records []map[string]interface{}, cols []string) gin.H {
+	resp := gin.H{
+		"message":    "data inserted successfully",
+		"table_name": tableName,
+		"row_count":  len(records),
+		"columns":    cols,
+	}
+	if len(records) > 0 {
+		if id, ok := records[0][db.BatchIDColumn]; ok {
+			resp["batch_id"] = id
+		}
+	}
+	return resp
+}
+
+// CheckTable verifies tableName is valid and registered in table_metadata
+func (h *DataIngestHandler) CheckTable(tableName string) error {
+	if tableName == "" {
+		return requestError(http.StatusBadRequest, "missing table name", nil)
+	}
+	if _, err := db.ParseTableName(tableName); err != nil {
+		return requestError(http.StatusBadRequest, "invalid table name", err)
+	}
 
 	// Verify that the table exists in metadata
 	var exists bool
 	val_err := h.DB.Get(&exists, "SELECT EXISTS (SELECT 1 FROM table_metadata WHERE table_name=$1)", tableName)
 	if val_err != nil {
 		log.Printf("metadata check error: %v", val_err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check metadata"})
-		return
+		return requestError(http.StatusInternalServerError, "failed to check metadata", nil)
 	}
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("table '%s' is not registered", tableName)})
-		return
+		return requestError(http.StatusBadRequest, fmt.Sprintf("table '%s' is not registered", tableName), nil)
 	}
+	return checkWritable(h.DB, tableName)
+}
 
-	// Parse JSON body (accepts array or single record)
-	var records []map[string]interface{}
-	if err := c.ShouldBindJSON(&records); err != nil {
-		// If a single object was sent, wrap it in an array
-		var single map[string]interface{}
-		if err2 := c.ShouldBindJSON(&single); err2 != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
-			return
+// Insert writes one batch of records into a table already passed through
+// CheckTable. The keys of the first record name the columns; they are returned.
+func (h *DataIngestHandler) Insert(tableName string, records []map[string]interface{}) ([]string, error) {
+	if err := h.checkColumns(tableName, records); err != nil {
+		return nil, err
+	}
+	if err := h.checkAllowed(tableName, records); err != nil {
+		return nil, err
+	}
+	if err := h.fillKeys(tableName, records); err != nil {
+		return nil, err
+	}
+	if err := h.stampProvenance(tableName, records); err != nil {
+		return nil, err
+	}
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to start transaction", err)
+	}
+	defer tx.Rollback()
+	cols, err := h.insert(tx, tableName, records)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to commit insert", err)
+	}
+	h.publishIngest(tableName, records)
+	return cols, nil
+}
+
+// stampProvenance fills in the provenance columns of records when the table
+// has them. Call it before opening a transaction: on SQLite the column lookup
+// needs the only connection.
+func (h *DataIngestHandler) stampProvenance(tableName string, records []map[string]interface{}) error {
+	cols, err := db.TableColumns(h.DB, tableName)
+	if err != nil {
+		log.Printf("column lookup error: table=%s err=%v", tableName, err)
+		return requestError(http.StatusInternalServerError, "failed to load table columns", nil)
+	}
+	if db.HasProvenance(cols) {
+		db.NewProvenance("ingest").Stamp(records)
+	}
+	return nil
+}
+
+// checkColumns refuses records with a key that is not a column of the
+// table, so only known column names reach the INSERT. Like
+// stampProvenance, call it before opening a transaction.
+func (h *DataIngestHandler) checkColumns(tableName string, records []map[string]interface{}) error {
+	cols, err := db.TableColumns(h.DB, tableName)
+	if err != nil {
+		log.Printf("column lookup error: table=%s err=%v", tableName, err)
+		return requestError(http.StatusInternalServerError, "failed to load table columns", nil)
+	}
+	known := make(map[string]bool, len(cols))
+	for _, col := range cols {
+		known[col.ColumnName] = true
+	}
+	for i, record := range records {
+		for col := range record {
+			if !known[col] {
+				return requestError(http.StatusBadRequest, "invalid records", fmt.Errorf("record %d: unknown column %q", i, col))
+			}
 		}
-		records = append(records, single)
 	}
+	return nil
+}
 
+// checkAllowed refuses records holding a value outside its column's
+// allowed values. Like stampProvenance, call it before opening a transaction.
+func (h *DataIngestHandler) checkAllowed(tableName string, records []map[string]interface{}) error {
+	allowed, err := etl.LoadAllowedValues(h.DB, tableName)
+	if err != nil {
+		return requestError(http.StatusInternalServerError, "failed to load allowed values", err)
+	}
+	for i, record := range records {
+		if col, err := allowed.Violation(record); err != nil {
+			return requestError(http.StatusBadRequest, "value not allowed", fmt.Errorf("record %d, column %s: %w", i, col, err))
+		}
+	}
+	return nil
+}
+
+// fillKeys generates the managed key of records that lack one. Like
+// stampProvenance, call it before opening a transaction.
+func (h *DataIngestHandler) fillKeys(tableName string, records []map[string]interface{}) error {
+	key, err := db.LoadManagedKey(h.DB, tableName)
+	if err != nil {
+		return requestError(http.StatusInternalServerError, "failed to load managed key", err)
+	}
+	for _, record := range records {
+		key.Fill(record)
+	}
+	return nil
+}
+
+// insert runs the INSERT for Insert on tx and queues the rows for change
+// capture with it
+func (h *DataIngestHandler) insert(tx *sqlx.Tx, tableName string, records []map[string]interface{}) ([]string, error) {
 	if len(records) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no data provided"})
-		return
+		return nil, requestError(http.StatusBadRequest, "no data provided", nil)
+	}
+	if max := h.Limits.MaxRows; max > 0 && len(records) > max {
+		return nil, requestError(http.StatusRequestEntityTooLarge, "payload too large",
+			fmt.Errorf("payload has %d records, limit is %d", len(records), max))
+	}
+	if err := h.Quotas.CheckRows(tableName, len(records)); err != nil {
+		return nil, quotaError(err, "failed to check quota")
 	}
 
 	// Dynamically build INSERT query
@@ -68,7 +273,11 @@ func (h *DataIngestHandler) IngestData(c *gin.Context) {
 	for i, record := range records {
 		placeholders := []string{}
 		for j, col := range cols {
-			valArgs = append(valArgs, record[col])
+			v := record[col]
+			if n, ok := v.(json.Number); ok {
+				v = n.String() // exact; the database parses it for the column's type
+			}
+			valArgs = append(valArgs, v)
 			placeholders = append(placeholders, fmt.Sprintf("$%d", i*len(cols)+j+1))
 		}
 		valPlaceholders = append(valPlaceholders, fmt.Sprintf("(%s)", strings.Join(placeholders, ", ")))
@@ -76,23 +285,70 @@ func (h *DataIngestHandler) IngestData(c *gin.Context) {
 
 	query := fmt.Sprintf(
 		`INSERT INTO %s (%s) VALUES %s`,
-		tableName,
-		strings.Join(cols, ", "),
+		db.QuoteTable(tableName),
+		quoteColumns(cols),
 		strings.Join(valPlaceholders, ", "),
 	)
 
 	// Execute query safely using placeholders
-	_, err := h.DB.Exec(query, valArgs...)
-	if err != nil {
+	if _, err := tx.Exec(query, valArgs...); err != nil {
 		log.Printf("insert error: table=%s err=%v", tableName, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert data", "details": err.Error()})
-		return
+		return nil, requestError(http.StatusInternalServerError, "failed to insert data", err)
 	}
+	if err := h.CDC.Record(tx, tableName, "ingest", records); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to queue change capture", err)
+	}
+	return cols, nil
+}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":    "data inserted successfully",
-		"table_name": tableName,
-		"row_count":  len(records),
-		"columns":    cols,
+// publishIngest announces a committed batch on the event broker, wakes the
+// change capture relay for it and counts it against the table's row quota
+func (h *DataIngestHandler) publishIngest(tableName string, records []map[string]interface{}) {
+	h.publishCount(tableName, len(records), records)
+}
+
+// publishCount is publishIngest for n rows, of which the event carries
+// records when n is at most maxEventRows
+func (h *DataIngestHandler) publishCount(tableName string, n int, records []map[string]interface{}) {
+	h.CDC.Notify()
+	h.Quotas.Added(tableName, n)
+
+	data := map[string]interface{}{"row_count": n}
+	if n <= maxEventRows {
+		data["rows"] = records
+	}
+	h.Events.Publish(events.Event{Type: events.RowsIngested, Table: tableName, Data: data})
+}
+
+// readBody reads the request body, rejecting oversized payloads before
+// reading them; on failure it has already responded
+func (h *DataIngestHandler) readBody(c *gin.Context) ([]byte, bool) {
+	if max := h.Limits.MaxBodyBytes; max > 0 {
+		if c.Request.ContentLength > max {
+			h.tooLarge(c, fmt.Sprintf("payload exceeds %d bytes", max))
+			return nil, false
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.tooLarge(c, fmt.Sprintf("payload exceeds %d bytes", maxErr.Limit))
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body", "details": err.Error()})
+		return nil, false
+	}
+	return body, true
+}
+
+// tooLarge responds 413 with the configured limits so clients can split the batch
+func (h *DataIngestHandler) tooLarge(c *gin.Context, details string) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":          "payload too large",
+		"details":        details,
+		"max_body_bytes": h.Limits.MaxBodyBytes,
+		"max_rows":       h.Limits.MaxRows,
 	})
 }
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-yaml"
+)
+
+// openAPISpec documents every route registered in cmd/server; keep it in
+// step with the handlers when request or response shapes change.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// swaggerUIVersion pins the Swagger UI bundle loaded by /docs
+const swaggerUIVersion = "5.17.14"
+
+// DocsHandler serves the OpenAPI spec and a Swagger UI page for it
+type DocsHandler struct {
+	specJSON []byte
+}
+
+// NewDocsHandler converts the embedded spec to JSON once up front
+func NewDocsHandler() *DocsHandler {
+	specJSON, err := yaml.YAMLToJSON(openAPISpec)
+	if err != nil {
+		log.Printf("openapi: spec is not valid YAML: %v", err)
+	}
+	return &DocsHandler{specJSON: specJSON}
+}
+
+// GET /docs/openapi.yaml
+func (h *DocsHandler) SpecYAML(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", openAPISpec)
+}
+
+// GET /docs/openapi.json
+func (h *DocsHandler) SpecJSON(c *gin.Context) {
+	if h.specJSON == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "openapi spec unavailable"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.specJSON)
+}
+
+// GET /docs
+// Swagger UI is loaded from a CDN, so the page needs internet access in the
+// browser; the spec itself is always served locally.
+func (h *DocsHandler) SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>GoDataFlow API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: "/docs/openapi.json",
+      dom_id: "#swagger-ui",
+      deepLinking: true,
+    });
+  </script>
+</body>
+</html>
+`
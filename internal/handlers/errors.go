@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestError is a failure reported back to the caller. The table, ingest and
+// query operations return it so the REST handlers and the gRPC service answer
+// the same way; Status is the HTTP status the REST API uses.
+type RequestError struct {
+	Status  int
+	Message string
+	Details string
+
+	// cause is the error behind a failure whose details are kept from the
+	// caller; only logs see it
+	cause error
+}
+
+func (e *RequestError) Error() string {
+	if e.Details == "" {
+		return e.Message
+	}
+	return e.Message + ": " + e.Details
+}
+
+// requestError builds a RequestError; err, if any, becomes the details
+func requestError(status int, msg string, err error) *RequestError {
+	e := &RequestError{Status: status, Message: msg}
+	if err != nil {
+		e.Details = err.Error()
+	}
+	return e
+}
+
+// hiddenError builds a RequestError without details; err is only logged
+func hiddenError(status int, msg string, err error) *RequestError {
+	return &RequestError{Status: status, Message: msg, cause: err}
+}
+
+// writeError responds with {"error", "details"} and the error's status
+func writeError(c *gin.Context, err error) {
+	re, ok := err.(*RequestError)
+	if !ok {
+		re = requestError(http.StatusInternalServerError, "internal error", err)
+	}
+	body := gin.H{"error": re.Message}
+	if re.Details != "" {
+		body["details"] = re.Details
+	}
+	c.JSON(re.Status, body)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+)
+
+type EventsHandler struct {
+	Broker *events.Broker
+}
+
+func NewEventsHandler(broker *events.Broker) *EventsHandler {
+	return &EventsHandler{Broker: broker}
+}
+
+// GET /events
+// Streams pipeline activity as server-sent events. Optional ?table= filter.
+func (h *EventsHandler) Stream(c *gin.Context) {
+	if h.Broker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "event stream not available"})
+		return
+	}
+	table := c.Query("table")
+
+	sub := h.Broker.Subscribe()
+	defer h.Broker.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// keep idle connections alive through proxies
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				return false
+			}
+			if table != "" && ev.Table != table {
+				return true
+			}
+			c.SSEvent(ev.Type, ev)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"time": time.Now()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -3,10 +3,38 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/alkha0306/godataflow/internal/db"
 	"github.com/gin-gonic/gin"
 )
 
-// HealthHandler responds with basic status
-func HealthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+// HealthHandler reports liveness plus the database connection state
+type HealthHandler struct {
+	Monitor *db.Monitor
+	Reads   *db.ReadRouter
+}
+
+func NewHealthHandler(monitor *db.Monitor, reads *db.ReadRouter) *HealthHandler {
+	return &HealthHandler{Monitor: monitor, Reads: reads}
+}
+
+// Health responds 200 {"status":"ok"} while the primary database is reachable
+// and 503 {"status":"degraded"} while reconnecting, so load balancers can react.
+func (h *HealthHandler) Health(c *gin.Context) {
+	resp := gin.H{"status": "ok"}
+	code := http.StatusOK
+
+	if h.Monitor != nil {
+		st := h.Monitor.Status()
+		resp["database"] = st
+		if !st.Healthy {
+			resp["status"] = "degraded"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	if h.Reads != nil && h.Reads.HasReplica() {
+		// replica outages are absorbed by the primary, so they don't degrade status
+		resp["replica_healthy"] = h.Reads.ReplicaHealthy()
+	}
+
+	c.JSON(code, resp)
 }
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/importer"
+	"github.com/alkha0306/godataflow/internal/quota"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type ImportHandler struct {
+	DB       *sqlx.DB
+	Importer *importer.Importer
+	MaxBytes int64 // uploaded file limit; 0 = unlimited
+}
+
+func NewImportHandler(db *sqlx.DB, imp *importer.Importer, maxBytes int64) *ImportHandler {
+	return &ImportHandler{DB: db, Importer: imp, MaxBytes: maxBytes}
+}
+
+// ImportRequest is the JSON payload for POST /tables/:name/import when the
+// file is referenced instead of uploaded
+type ImportRequest struct {
+	URL    string `json:"url" binding:"required"` // http(s):// or file:// under ingest.import_dir
+	Format string `json:"format"`                 // csv, ndjson or archive; detected when empty
+}
+
+// POST /tables/:name/import?format=&table_type=
+// Loads a CSV or NDJSON export, or a backup archive, into the table. The
+// file is the request body, or a JSON {"url": ...} reference. Archives
+// recreate a missing table from their schema. Returns 202 with the import
+// job; follow it at GET /tables/:name/imports/:id or on /events
+func (h *ImportHandler) Import(c *gin.Context) {
+	table := c.Param("name")
+	if err := checkWritable(h.DB, table); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var src importer.Source
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		var req ImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+			return
+		}
+		// the import directory is shared by every workspace
+		if currentWorkspace(c) != nil && strings.HasPrefix(strings.ToLower(req.URL), "file:") {
+			writeError(c, requestError(http.StatusForbidden, "file:// imports are not available to workspace API keys", nil))
+			return
+		}
+		// the load outlives the request
+		s, err := h.Importer.Open(context.WithoutCancel(c.Request.Context()), req.URL)
+		if err != nil {
+			writeError(c, importError(err, "failed to open import file"))
+			return
+		}
+		src = s
+		src.Format = req.Format
+	} else {
+		s, err := h.spool(c)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		src = s
+	}
+	if f := c.Query("format"); f != "" {
+		src.Format = f
+	}
+
+	job, err := h.Importer.Start(table, c.DefaultQuery("table_type", "time_series"), src)
+	if err != nil {
+		writeError(c, importError(err, "failed to start import"))
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GET /tables/:name/imports
+// Recent imports since the server started, newest first
+func (h *ImportHandler) ListImports(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Importer.Jobs(c.Param("name")))
+}
+
+// GET /tables/:name/imports/:id
+func (h *ImportHandler) GetImport(c *gin.Context) {
+	job, err := h.Importer.Job(c.Param("name"), c.Param("id"))
+	if err != nil {
+		writeError(c, importError(err, "failed to load import"))
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// spool copies the uploaded body to a temp file, so the load can run after
+// the request returns; the file is removed when the import closes it
+func (h *ImportHandler) spool(c *gin.Context) (importer.Source, error) {
+	f, err := os.CreateTemp("", "godataflow-import-*")
+	if err != nil {
+		return importer.Source{}, requestError(http.StatusInternalServerError, "failed to buffer upload", err)
+	}
+	body := io.Reader(c.Request.Body)
+	if h.MaxBytes > 0 {
+		body = io.LimitReader(body, h.MaxBytes+1)
+	}
+	n, err := io.Copy(f, body)
+	var reqErr *RequestError
+	switch {
+	case err != nil:
+		reqErr = requestError(http.StatusBadRequest, "failed to read upload", err)
+	case h.MaxBytes > 0 && n > h.MaxBytes:
+		reqErr = requestError(http.StatusRequestEntityTooLarge, "upload too large",
+			fmt.Errorf("limit is %d bytes (ingest.import_max_bytes)", h.MaxBytes))
+	case n == 0:
+		reqErr = requestError(http.StatusBadRequest, "empty upload; send the file as the body or a JSON {\"url\": ...} reference", nil)
+	default:
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			reqErr = requestError(http.StatusInternalServerError, "failed to buffer upload", err)
+		}
+	}
+	if reqErr != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return importer.Source{}, reqErr
+	}
+
+	name := c.GetHeader("X-Filename")
+	if name == "" {
+		name = "upload"
+	}
+	return importer.Source{Body: &tempFile{f}, Size: n, Name: name}, nil
+}
+
+// tempFile deletes itself on Close
+type tempFile struct{ *os.File }
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
+
+// importError maps importer errors to responses
+func importError(err error, msg string) error {
+	switch {
+	case errors.Is(err, importer.ErrNotFound), errors.Is(err, importer.ErrNoTable):
+		return requestError(http.StatusNotFound, "not found", err)
+	case errors.Is(err, importer.ErrInvalid):
+		return requestError(http.StatusBadRequest, "invalid import", err)
+	case errors.Is(err, importer.ErrFetch):
+		return requestError(http.StatusBadGateway, "failed to download import file", err)
+	case errors.Is(err, quota.ErrExceeded):
+		return quotaError(err, msg)
+	}
+	return requestError(http.StatusInternalServerError, msg, err)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// defaultIngestBatch is the batch_size of a batch ingest that sets none
+const defaultIngestBatch = 500
+
+// ingestBatches inserts the records of body batch by batch, each in its
+// own transaction, and reports the batches that failed, answering 201
+// when every batch was committed and 207 when some were rejected
+func (h *DataIngestHandler) ingestBatches(c *gin.Context, tableName string, body []byte) {
+	size, ok := batchSize(c)
+	if !ok {
+		return
+	}
+	records, err := decodeRecords(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+		return
+	}
+	report, err := h.InsertBatches(tableName, records, size)
+	if err != nil {
+		if re, ok := err.(*RequestError); ok && re.Status == http.StatusRequestEntityTooLarge {
+			h.tooLarge(c, re.Details)
+			return
+		}
+		writeError(c, err)
+		return
+	}
+	if report.Accepted > 0 {
+		h.Stats.Record(tableName, report.Accepted, int64(len(body)))
+	}
+	status := http.StatusCreated
+	if report.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, report)
+}
+
+// batchSize reads the batch_size parameter of a batch ingest; on failure
+// it has already responded
+func batchSize(c *gin.Context) (int, bool) {
+	v := c.Query("batch_size")
+	if v == "" {
+		return defaultIngestBatch, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch_size", "details": "batch_size must be a positive integer"})
+		return 0, false
+	}
+	return n, true
+}
+
+// InsertBatches splits records into batches of size and commits each in
+// its own transaction. A batch holding a record that doesn't fit the
+// table, or refused by the database, is rolled back and rejected whole;
+// the records at fault are listed, or the batch's first record when the
+// database refused it. The batches before and after it still load.
+func (h *DataIngestHandler) InsertBatches(tableName string, records []map[string]interface{}, size int) (PartialIngestReport, error) {
+	report := PartialIngestReport{TableName: tableName, Errors: []RowError{}, BatchSize: size}
+	if len(records) == 0 {
+		return report, requestError(http.StatusBadRequest, "no data provided", nil)
+	}
+	if max := h.Limits.MaxRows; max > 0 && len(records) > max {
+		return report, requestError(http.StatusRequestEntityTooLarge, "payload too large",
+			fmt.Errorf("payload has %d records, limit is %d", len(records), max))
+	}
+	if err := h.Quotas.CheckRows(tableName, len(records)); err != nil {
+		return report, quotaError(err, "failed to check quota")
+	}
+	rc, err := h.loadRowChecker(tableName)
+	if err != nil {
+		return report, err
+	}
+	var prov *db.Provenance
+	if db.HasProvenance(rc.columns) {
+		p := db.NewProvenance("ingest")
+		prov = &p
+	}
+
+	columns := map[string]bool{}
+	for start := 0; start < len(records); start += size {
+		end := min(start+size, len(records))
+		rows := make([]map[string]interface{}, 0, end-start)
+		var bad []RowError
+		for i := start; i < end; i++ {
+			row, col, err := rc.check(records[i])
+			if err != nil {
+				bad = append(bad, RowError{Index: i, Column: col, Reason: err.Error()})
+				continue
+			}
+			rows = append(rows, row)
+		}
+		if len(bad) == 0 {
+			if prov != nil {
+				prov.Stamp(rows)
+			}
+			cols := map[string]interface{}{}
+			for _, row := range rows {
+				for col := range row {
+					cols[col] = true
+				}
+			}
+			if err := h.commitBatch(tableName, sortedKeys(cols), rows); err != nil {
+				bad = []RowError{{Index: start, Reason: fmt.Sprintf("batch refused: %v", err)}}
+			}
+		}
+		if len(bad) > 0 {
+			report.Rejected += end - start
+			report.FailedBatches = append(report.FailedBatches, start/size)
+			for _, e := range bad {
+				report.addError(e)
+			}
+			continue
+		}
+		report.Accepted += len(rows)
+		for _, row := range rows {
+			for col := range row {
+				columns[col] = true
+			}
+		}
+		h.publishIngest(tableName, rows)
+	}
+
+	for col := range columns {
+		report.Columns = append(report.Columns, col)
+	}
+	sort.Strings(report.Columns)
+	if prov != nil && report.Accepted > 0 {
+		report.BatchID = prov.BatchID
+	}
+	report.Message = fmt.Sprintf("%d rows inserted, %d rejected in %d of %d batches",
+		report.Accepted, report.Rejected, len(report.FailedBatches), (len(records)+size-1)/size)
+	return report, nil
+}
+
+// commitBatch inserts rows in one transaction and queues them for change
+// capture with it
+func (h *DataIngestHandler) commitBatch(tableName string, cols []string, rows []map[string]interface{}) error {
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := h.insertBatch(tx, tableName, cols, rows); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertBatch inserts rows on tx, as many per statement as the driver's
+// bind parameter limit allows, and queues them for change capture
+func (h *DataIngestHandler) insertBatch(tx *sqlx.Tx, tableName string, cols []string, rows []map[string]interface{}) error {
+	step := max(db.MaxBindParams(h.DB)/len(cols), 1)
+	for from := 0; from < len(rows); from += step {
+		query, args := insertStatement(tableName, cols, rows[from:min(from+step, len(rows))])
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return h.CDC.Record(tx, tableName, "ingest", rows)
+}
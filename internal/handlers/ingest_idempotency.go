@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIdempotencyKeyLen bounds the Idempotency-Key header
+const maxIdempotencyKeyLen = 255
+
+// storedIngest is a row of ingest_idempotency_keys
+type storedIngest struct {
+	RequestHash string `db:"request_hash"`
+	StatusCode  int    `db:"status_code"`
+	Response    string `db:"response"`
+}
+
+// ingestOnce inserts records unless key was already used for this table
+// within the TTL, in which case the stored response is replayed. The key is
+// recorded in the same transaction as the rows, so a failed insert leaves
+// nothing behind and the client may retry with the same key.
+func (h *DataIngestHandler) ingestOnce(c *gin.Context, tableName, key string, body []byte, records []map[string]interface{}) {
+	if len(key) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key too long", "details": "at most 255 characters"})
+		return
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	// Common case for a retry: the key is already there
+	if prev, err := h.lookupKey(tableName, key); err != nil {
+		writeError(c, err)
+		return
+	} else if prev != nil {
+		replayIngest(c, prev, hash)
+		return
+	}
+
+	if err := h.checkColumns(tableName, records); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := h.checkAllowed(tableName, records); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := h.fillKeys(tableName, records); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := h.stampProvenance(tableName, records); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to start transaction", err))
+		return
+	}
+	defer tx.Rollback()
+
+	// An expired key may be reused; live ones are left for the conflict check below
+	if h.IdempotencyTTL > 0 {
+		_, err := tx.Exec(`DELETE FROM ingest_idempotency_keys WHERE table_name = $1 AND idempotency_key = $2 AND created_at < $3`,
+			tableName, key, h.idempotencyCutoff())
+		if err != nil {
+			writeError(c, requestError(http.StatusInternalServerError, "failed to record idempotency key", err))
+			return
+		}
+	}
+
+	cols, err := h.insert(tx, tableName, records)
+	if err != nil {
+		if re, ok := err.(*RequestError); ok && re.Status == http.StatusRequestEntityTooLarge {
+			h.tooLarge(c, re.Details)
+			return
+		}
+		writeError(c, err)
+		return
+	}
+
+	resp, err := json.Marshal(ingestResponse(tableName, records, cols))
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to encode response", err))
+		return
+	}
+	res, err := tx.Exec(`
+		INSERT INTO ingest_idempotency_keys (table_name, idempotency_key, request_hash, status_code, response)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (table_name, idempotency_key) DO NOTHING`,
+		tableName, key, hash, http.StatusCreated, string(resp))
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to record idempotency key", err))
+		return
+	}
+
+	// A concurrent request with the same key committed first: drop our rows
+	// and answer with its result
+	if n, _ := res.RowsAffected(); n == 0 {
+		_ = tx.Rollback()
+		prev, err := h.lookupKey(tableName, key)
+		if err != nil || prev == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is in progress"})
+			return
+		}
+		replayIngest(c, prev, hash)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to commit insert", err))
+		return
+	}
+	h.publishIngest(tableName, records)
+	h.Stats.Record(tableName, len(records), int64(len(body)))
+	c.Data(http.StatusCreated, "application/json; charset=utf-8", resp)
+}
+
+// lookupKey returns the unexpired stored response for key, or nil
+func (h *DataIngestHandler) lookupKey(tableName, key string) (*storedIngest, error) {
+	query := `SELECT request_hash, status_code, response FROM ingest_idempotency_keys
+		WHERE table_name = $1 AND idempotency_key = $2`
+	args := []interface{}{tableName, key}
+	if h.IdempotencyTTL > 0 {
+		query += ` AND created_at >= $3`
+		args = append(args, h.idempotencyCutoff())
+	}
+
+	var prev storedIngest
+	if err := h.DB.Get(&prev, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		log.Printf("idempotency lookup error: table=%s err=%v", tableName, err)
+		return nil, requestError(http.StatusInternalServerError, "failed to check idempotency key", nil)
+	}
+	return &prev, nil
+}
+
+// idempotencyCutoff is the creation time before which keys have expired
+func (h *DataIngestHandler) idempotencyCutoff() time.Time {
+	return time.Now().UTC().Add(-h.IdempotencyTTL)
+}
+
+// replayIngest answers a retry with the stored response, or 422 when the key
+// was first used with a different body
+func replayIngest(c *gin.Context, prev *storedIngest, hash string) {
+	if prev.RequestHash != hash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Idempotency-Key reused with a different payload",
+			"details": "use a new key for a new batch",
+		})
+		return
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(prev.StatusCode, "application/json; charset=utf-8", []byte(prev.Response))
+}
@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/gin-gonic/gin"
+)
+
+// Ingest job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	maxIngestJobs    = 100  // finished jobs kept for GET /ingest/jobs
+	maxQueuedJobs    = 100  // submissions waiting for a worker before 503s
+	ingestJobRecords = 1000 // records loaded per batch
+)
+
+// IngestJob is a payload accepted by POST /ingest/:table_name/jobs and its
+// progress. Indexes in Errors are positions in the payload, from 0.
+type IngestJob struct {
+	ID              string     `json:"id"`
+	Table           string     `json:"table"`
+	Mode            string     `json:"mode"`
+	Status          string     `json:"status"`
+	Bytes           int64      `json:"bytes"`
+	Total           *int64     `json:"total_records,omitempty"` // known once an atomic job has checked the payload
+	Processed       int64      `json:"rows_processed"`
+	Accepted        int64      `json:"accepted"`
+	Rejected        int64      `json:"rejected"`
+	Errors          []RowError `json:"errors"`
+	ErrorsTruncated bool       `json:"errors_truncated,omitempty"`
+	BatchID         string     `json:"batch_id,omitempty"`
+	BatchSize       int        `json:"batch_size,omitempty"`     // batch jobs
+	FailedBatches   []int      `json:"failed_batches,omitempty"` // batch jobs: position of each rejected batch
+	Error           string     `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// IngestJobs queues large ingest payloads and loads them on a pool of
+// workers. Payloads are spooled to temp files; jobs are kept in memory, so
+// they don't survive a restart.
+type IngestJobs struct {
+	Ingests  *DataIngestHandler
+	Workers  int
+	MaxBytes int64 // payload limit; 0 = unlimited
+
+	queue chan ingestTask
+	mu    sync.Mutex
+	jobs  []*IngestJob
+}
+
+// ingestTask is a queued job and its spooled payload
+type ingestTask struct {
+	job  *IngestJob
+	path string
+}
+
+func NewIngestJobs(ingests *DataIngestHandler, workers int, maxBytes int64) *IngestJobs {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &IngestJobs{Ingests: ingests, Workers: workers, MaxBytes: maxBytes, queue: make(chan ingestTask, maxQueuedJobs)}
+}
+
+// Start runs the workers until ctx is cancelled
+func (q *IngestJobs) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case t := <-q.queue:
+					q.run(t)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// POST /ingest/:table_name/jobs?mode=
+// Accepts a JSON array, a single record or NDJSON, queues it and returns
+// 202 with the job; poll GET /ingest/jobs/:id for its progress. The modes
+// are those of POST /ingest: atomic jobs check every record and load them
+// in one transaction, so they load in full or not at all; partial jobs
+// load the records that fit and report the rest, committing every
+// ingestJobRecords records; batch jobs commit each batch_size records on
+// their own and report the batches that failed.
+func (q *IngestJobs) Submit(c *gin.Context) {
+	h := q.Ingests
+	tableName := c.Param("table_name")
+	if err := h.CheckTable(tableName); err != nil {
+		writeError(c, err)
+		return
+	}
+	mode := c.DefaultQuery("mode", IngestAtomic)
+	if mode != IngestAtomic && mode != IngestPartial && mode != IngestBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode", "details": "mode must be atomic, partial or batch"})
+		return
+	}
+	size := 0
+	if mode == IngestBatch {
+		var ok bool
+		if size, ok = batchSize(c); !ok {
+			return
+		}
+		if max := h.Limits.MaxRows; max > 0 && size > max {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch_size",
+				"details": fmt.Sprintf("batch_size is at most %d (ingest.max_rows)", max)})
+			return
+		}
+	}
+	if err := h.Quotas.AllowIngest(tableName); err != nil {
+		rateLimited(c, err)
+		return
+	}
+
+	path, n, err := q.spool(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	job := &IngestJob{ID: newJobID(), Table: tableName, Mode: mode, Status: JobQueued, Bytes: n,
+		BatchSize: size, Errors: []RowError{}, CreatedAt: time.Now().UTC()}
+
+	select {
+	case q.queue <- ingestTask{job: job, path: path}:
+	default:
+		os.Remove(path)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ingest queue is full", "details": "retry later"})
+		return
+	}
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.prune()
+	snapshot := *job
+	q.mu.Unlock()
+	c.JSON(http.StatusAccepted, snapshot)
+}
+
+// GET /ingest/jobs?table=
+// Recent ingest jobs since the server started, newest first
+func (q *IngestJobs) ListJobs(c *gin.Context) {
+	ws := currentWorkspace(c)
+	table := c.Query("table")
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := []IngestJob{}
+	for i := len(q.jobs) - 1; i >= 0; i-- {
+		if j := q.jobs[i]; ws.Owns(j.Table) && (table == "" || j.Table == table) {
+			jobs = append(jobs, *j)
+		}
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GET /ingest/jobs/:id
+func (q *IngestJobs) GetJob(c *gin.Context) {
+	ws := currentWorkspace(c)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		if j.ID == c.Param("id") && ws.Owns(j.Table) {
+			c.JSON(http.StatusOK, *j)
+			return
+		}
+	}
+	writeError(c, requestError(http.StatusNotFound, "ingest job not found", nil))
+}
+
+// prune drops the oldest finished jobs beyond maxIngestJobs; call with mu held
+func (q *IngestJobs) prune() {
+	for excess := len(q.jobs) - maxIngestJobs; excess > 0; excess-- {
+		i := 0
+		for i < len(q.jobs) && q.jobs[i].FinishedAt == nil {
+			i++
+		}
+		if i == len(q.jobs) {
+			return
+		}
+		q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+	}
+}
+
+// spool copies the body to a temp file so it can be loaded after the
+// request returns
+func (q *IngestJobs) spool(c *gin.Context) (string, int64, error) {
+	if q.MaxBytes > 0 && c.Request.ContentLength > q.MaxBytes {
+		return "", 0, requestError(http.StatusRequestEntityTooLarge, "payload too large",
+			fmt.Errorf("limit is %d bytes (ingest.async_max_bytes)", q.MaxBytes))
+	}
+	f, err := os.CreateTemp("", "godataflow-ingest-*")
+	if err != nil {
+		return "", 0, requestError(http.StatusInternalServerError, "failed to buffer payload", err)
+	}
+	defer f.Close()
+	body := io.Reader(c.Request.Body)
+	if q.MaxBytes > 0 {
+		body = io.LimitReader(body, q.MaxBytes+1)
+	}
+	n, err := io.Copy(f, body)
+	var reqErr *RequestError
+	switch {
+	case err != nil:
+		reqErr = requestError(http.StatusBadRequest, "failed to read body", err)
+	case q.MaxBytes > 0 && n > q.MaxBytes:
+		reqErr = requestError(http.StatusRequestEntityTooLarge, "payload too large",
+			fmt.Errorf("limit is %d bytes (ingest.async_max_bytes)", q.MaxBytes))
+	case n == 0:
+		reqErr = requestError(http.StatusBadRequest, "no data provided", nil)
+	}
+	if reqErr != nil {
+		os.Remove(f.Name())
+		return "", 0, reqErr
+	}
+	return f.Name(), n, nil
+}
+
+// run loads a queued job and records how it ended
+func (q *IngestJobs) run(t ingestTask) {
+	defer os.Remove(t.path)
+	q.update(t.job, func(j *IngestJob) {
+		now := time.Now().UTC()
+		j.Status, j.StartedAt = JobRunning, &now
+	})
+
+	err := q.load(t)
+	q.update(t.job, func(j *IngestJob) {
+		now := time.Now().UTC()
+		j.FinishedAt = &now
+		if err != nil {
+			j.Status, j.Error = JobFailed, err.Error()
+		} else {
+			j.Status = JobSucceeded
+		}
+	})
+	if err != nil {
+		log.Printf("ingest job failed: id=%s table=%s err=%v", t.job.ID, t.job.Table, err)
+	}
+
+	// Batches committed before a failure still count
+	q.mu.Lock()
+	accepted, bytes := t.job.Accepted, t.job.Bytes
+	q.mu.Unlock()
+	if accepted > 0 {
+		q.Ingests.Stats.Record(t.job.Table, int(accepted), bytes)
+	}
+}
+
+func (q *IngestJobs) update(job *IngestJob, fn func(*IngestJob)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fn(job)
+}
+
+// reject records a rejected record on job; call with mu held
+func (j *IngestJob) reject(e RowError) {
+	j.Rejected++
+	j.addError(e)
+}
+
+// addError lists e on job, up to maxRowErrors; call with mu held
+func (j *IngestJob) addError(e RowError) {
+	if len(j.Errors) < maxRowErrors {
+		j.Errors = append(j.Errors, e)
+	} else {
+		j.ErrorsTruncated = true
+	}
+}
+
+// load reads the spooled payload in batches, inserting each as it fills
+func (q *IngestJobs) load(t ingestTask) error {
+	h, job := q.Ingests, t.job
+	batchSize := ingestJobRecords
+	if h.Limits.MaxRows > 0 {
+		batchSize = min(batchSize, h.Limits.MaxRows)
+	}
+
+	var err error
+	switch job.Mode {
+	case IngestPartial:
+		err = eachBatch(t.path, batchSize, func(start int, batch []map[string]interface{}) error {
+			report, err := h.InsertPartial(job.Table, batch)
+			if err != nil {
+				return err
+			}
+			q.update(job, func(j *IngestJob) {
+				j.Processed += int64(len(batch))
+				j.Accepted += int64(report.Accepted)
+				for _, e := range report.Errors {
+					e.Index += start
+					j.reject(e)
+				}
+			})
+			return nil
+		})
+	case IngestBatch:
+		// one InsertBatches call per batch, so batches number as in POST /ingest
+		err = eachBatch(t.path, job.BatchSize, func(start int, batch []map[string]interface{}) error {
+			report, err := h.InsertBatches(job.Table, batch, job.BatchSize)
+			if err != nil {
+				return err
+			}
+			q.update(job, func(j *IngestJob) {
+				j.Processed += int64(len(batch))
+				j.Accepted += int64(report.Accepted)
+				j.Rejected += int64(report.Rejected)
+				j.ErrorsTruncated = j.ErrorsTruncated || report.Truncated
+				for _, e := range report.Errors {
+					e.Index += start
+					j.addError(e)
+				}
+				for _, b := range report.FailedBatches {
+					j.FailedBatches = append(j.FailedBatches, start/j.BatchSize+b)
+				}
+			})
+			return nil
+		})
+	default:
+		return q.loadAtomic(t, batchSize)
+	}
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job.Processed == 0 {
+		return errors.New("no data provided")
+	}
+	sort.SliceStable(job.Errors, func(a, b int) bool { return job.Errors[a].Index < job.Errors[b].Index })
+	return nil
+}
+
+// loadAtomic checks every record of an atomic job against the table and
+// its row quota, then inserts them in batches of batchSize in one
+// transaction. A record that doesn't fit fails the job before anything
+// is written, and a batch the database refuses rolls back the ones before it.
+func (q *IngestJobs) loadAtomic(t ingestTask, batchSize int) error {
+	h, job := q.Ingests, t.job
+	tableCols, err := db.TableColumns(h.DB, job.Table)
+	if err != nil {
+		return fmt.Errorf("failed to load table columns: %w", err)
+	}
+	types := make(map[string]string, len(tableCols))
+	for _, col := range tableCols {
+		types[col.ColumnName] = col.DataType
+	}
+	key, err := db.LoadManagedKey(h.DB, job.Table)
+	if err != nil {
+		return err
+	}
+	allowed, err := etl.LoadAllowedValues(h.DB, job.Table)
+	if err != nil {
+		return err
+	}
+	check := func(record map[string]interface{}) (map[string]interface{}, string, error) {
+		row, col, err := checkRecord(record, types)
+		if err != nil {
+			return nil, col, err
+		}
+		if col, err := allowed.Violation(row); err != nil {
+			return nil, col, err
+		}
+		return row, "", nil
+	}
+
+	var total int64
+	err = eachRecord(t.path, func(i int, record map[string]interface{}) error {
+		if _, col, err := check(record); err != nil {
+			q.update(job, func(j *IngestJob) { j.reject(RowError{Index: i, Column: col, Reason: err.Error()}) })
+			if col != "" {
+				return fmt.Errorf("record %d: %s: %v", i, col, err)
+			}
+			return fmt.Errorf("record %d: %v", i, err)
+		}
+		total++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return errors.New("no data provided")
+	}
+	q.update(job, func(j *IngestJob) { j.Total = &total })
+	if err := h.Quotas.CheckRows(job.Table, int(total)); err != nil {
+		return err
+	}
+
+	stamp := func([]map[string]interface{}) {}
+	if db.HasProvenance(tableCols) {
+		p := db.NewProvenance("ingest")
+		stamp = p.Stamp
+		q.update(job, func(j *IngestJob) { j.BatchID = p.BatchID })
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var event []map[string]interface{} // the rows, while few enough for the event
+	err = eachBatch(t.path, batchSize, func(start int, batch []map[string]interface{}) error {
+		rows := make([]map[string]interface{}, len(batch))
+		for i, record := range batch {
+			row, _, err := check(record)
+			if err != nil {
+				return fmt.Errorf("record %d: %v", start+i, err)
+			}
+			key.Fill(row)
+			rows[i] = row
+		}
+		stamp(rows)
+		columns := map[string]interface{}{}
+		for _, row := range rows {
+			for col := range row {
+				columns[col] = true
+			}
+		}
+		if err := h.insertBatch(tx, job.Table, sortedKeys(columns), rows); err != nil {
+			return fmt.Errorf("insert failed at record %d: %w", start, err)
+		}
+		if total <= maxEventRows {
+			event = append(event, rows...)
+		}
+		q.update(job, func(j *IngestJob) { j.Processed += int64(len(rows)) })
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	h.publishCount(job.Table, int(total), event)
+	q.update(job, func(j *IngestJob) { j.Accepted = total })
+	return nil
+}
+
+// eachBatch calls fn with the records of a spooled payload, size at a
+// time; start is the position of the batch's first record
+func eachBatch(path string, size int, fn func(start int, batch []map[string]interface{}) error) error {
+	batch := make([]map[string]interface{}, 0, size)
+	start := 0
+	err := eachRecord(path, func(i int, record map[string]interface{}) error {
+		if len(batch) == 0 {
+			start = i
+		}
+		if batch = append(batch, record); len(batch) < size {
+			return nil
+		}
+		err := fn(start, batch)
+		batch = batch[:0]
+		return err
+	})
+	if err == nil && len(batch) > 0 {
+		err = fn(start, batch)
+	}
+	return err
+}
+
+// eachRecord calls fn with every record of a spooled payload: a JSON
+// array of objects, a single object, or objects one after another (NDJSON)
+func eachRecord(path string, fn func(i int, record map[string]interface{}) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 64<<10)
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+
+	// An array is read element by element; anything else is a stream of objects
+	array := false
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			break
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			br.ReadByte()
+			continue
+		}
+		if array = b[0] == '['; array {
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("invalid JSON: %v", err)
+			}
+		}
+		break
+	}
+
+	for i := 0; ; i++ {
+		if array && !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("invalid JSON: %v", err)
+			}
+			if _, err := dec.Token(); err != io.EOF {
+				return errors.New("invalid JSON: data after the array")
+			}
+			return nil
+		}
+		var record map[string]interface{}
+		if err := dec.Decode(&record); err != nil {
+			if err == io.EOF && !array {
+				return nil
+			}
+			return fmt.Errorf("invalid JSON at record %d: %v", i, err)
+		}
+		if err := fn(i, record); err != nil {
+			return err
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/gin-gonic/gin"
+)
+
+// Ingest modes (the mode query parameter of POST /ingest)
+const (
+	IngestAtomic  = "atomic"  // any bad row fails the whole request (default)
+	IngestPartial = "partial" // bad rows are reported, the rest inserted
+	IngestBatch   = "batch"   // batches commit on their own; a batch with a bad row is reported whole
+)
+
+// maxRowErrors bounds the errors listed in a partial ingest report; the
+// rejected count still covers every row
+const maxRowErrors = 1000
+
+// RowError is why one record of a partial ingest was rejected. Column is
+// empty when the database refused the row as a whole (e.g. a constraint).
+type RowError struct {
+	Index  int    `json:"index"`
+	Column string `json:"column,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// PartialIngestReport is the response to a partial or batch ingest
+type PartialIngestReport struct {
+	Message   string     `json:"message"`
+	TableName string     `json:"table_name"`
+	Accepted  int        `json:"accepted"`
+	Rejected  int        `json:"rejected"`
+	Columns   []string   `json:"columns,omitempty"`
+	BatchID   string     `json:"batch_id,omitempty"`
+	Errors    []RowError `json:"errors"`
+	Truncated bool       `json:"errors_truncated,omitempty"`
+
+	// Batch ingests: records per batch and the position of each rejected
+	// batch (0 for records 0 to batch_size-1)
+	BatchSize     int   `json:"batch_size,omitempty"`
+	FailedBatches []int `json:"failed_batches,omitempty"`
+}
+
+// rowChecker converts records for a table, checking their allowed values,
+// and fills in its managed key
+type rowChecker struct {
+	columns []db.Column
+	types   map[string]string
+	allowed etl.AllowedValues
+	key     *db.ManagedKey
+}
+
+// loadRowChecker loads the column types, allowed values and managed key of tableName
+func (h *DataIngestHandler) loadRowChecker(tableName string) (*rowChecker, error) {
+	tableCols, err := db.TableColumns(h.DB, tableName)
+	if err != nil {
+		log.Printf("column lookup error: table=%s err=%v", tableName, err)
+		return nil, requestError(http.StatusInternalServerError, "failed to load table columns", nil)
+	}
+	rc := &rowChecker{columns: tableCols, types: make(map[string]string, len(tableCols))}
+	for _, col := range tableCols {
+		rc.types[col.ColumnName] = col.DataType
+	}
+	if rc.allowed, err = etl.LoadAllowedValues(h.DB, tableName); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to load allowed values", err)
+	}
+	if rc.key, err = db.LoadManagedKey(h.DB, tableName); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to load managed key", err)
+	}
+	return rc, nil
+}
+
+// check converts record, returning the offending column when a value
+// doesn't fit. The managed key is filled in on success.
+func (rc *rowChecker) check(record map[string]interface{}) (map[string]interface{}, string, error) {
+	row, col, err := checkRecord(record, rc.types)
+	if err == nil {
+		col, err = rc.allowed.Violation(row)
+	}
+	if err != nil {
+		return nil, col, err
+	}
+	rc.key.Fill(row)
+	return row, "", nil
+}
+
+// ingestPartial inserts the records of body that fit the table and reports
+// the others, answering 201 when every record was accepted and 207 when
+// some were rejected
+func (h *DataIngestHandler) ingestPartial(c *gin.Context, tableName string, body []byte) {
+	records, err := decodeRecords(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+		return
+	}
+	report, err := h.InsertPartial(tableName, records)
+	if err != nil {
+		if re, ok := err.(*RequestError); ok && re.Status == http.StatusRequestEntityTooLarge {
+			h.tooLarge(c, re.Details)
+			return
+		}
+		writeError(c, err)
+		return
+	}
+	if report.Accepted > 0 {
+		h.Stats.Record(tableName, report.Accepted, int64(len(body)))
+	}
+	status := http.StatusCreated
+	if report.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, report)
+}
+
+// decodeRecords parses an array of records or a single record, keeping
+// numbers exact so they can be checked against integer columns
+func decodeRecords(body []byte) ([]map[string]interface{}, error) {
+	decode := func(v interface{}) error {
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		return d.Decode(v)
+	}
+	var records []map[string]interface{}
+	if err := decode(&records); err != nil {
+		var single map[string]interface{}
+		if err := decode(&single); err != nil {
+			return nil, err
+		}
+		records = []map[string]interface{}{single}
+	}
+	return records, nil
+}
+
+// InsertPartial checks every record against the table's columns, inserts
+// the valid ones in one transaction and reports the rest. When the
+// database refuses the batch, rows are retried one by one under savepoints
+// so only the offending rows are rejected.
+func (h *DataIngestHandler) InsertPartial(tableName string, records []map[string]interface{}) (PartialIngestReport, error) {
+	report := PartialIngestReport{TableName: tableName, Errors: []RowError{}}
+	if len(records) == 0 {
+		return report, requestError(http.StatusBadRequest, "no data provided", nil)
+	}
+	if max := h.Limits.MaxRows; max > 0 && len(records) > max {
+		return report, requestError(http.StatusRequestEntityTooLarge, "payload too large",
+			fmt.Errorf("payload has %d records, limit is %d", len(records), max))
+	}
+	if err := h.Quotas.CheckRows(tableName, len(records)); err != nil {
+		return report, quotaError(err, "failed to check quota")
+	}
+
+	rc, err := h.loadRowChecker(tableName)
+	if err != nil {
+		return report, err
+	}
+
+	reject := func(i int, col, reason string) {
+		report.Rejected++
+		report.addError(RowError{Index: i, Column: col, Reason: reason})
+	}
+
+	// Check every value, converting the valid rows to driver values
+	valid := make([]map[string]interface{}, 0, len(records))
+	indexes := make([]int, 0, len(records))
+	columns := map[string]bool{}
+	for i, record := range records {
+		row, col, err := rc.check(record)
+		if err != nil {
+			reject(i, col, err.Error())
+			continue
+		}
+		valid = append(valid, row)
+		indexes = append(indexes, i)
+		for col := range row {
+			columns[col] = true
+		}
+	}
+
+	if len(valid) > 0 {
+		if db.HasProvenance(rc.columns) {
+			db.NewProvenance("ingest").Stamp(valid)
+			for _, col := range []string{db.IngestedAtColumn, db.SourceColumn, db.BatchIDColumn} {
+				columns[col] = true
+			}
+		}
+		for col := range columns {
+			report.Columns = append(report.Columns, col)
+		}
+		sort.Strings(report.Columns)
+
+		accepted, err := h.insertValid(tableName, report.Columns, valid, func(i int, reason string) {
+			reject(indexes[i], "", reason)
+		})
+		if err != nil {
+			return report, err
+		}
+		valid = accepted
+	}
+
+	report.Accepted = len(valid)
+	report.Message = fmt.Sprintf("%d rows inserted, %d rejected", report.Accepted, report.Rejected)
+	sort.Slice(report.Errors, func(a, b int) bool { return report.Errors[a].Index < report.Errors[b].Index })
+	if len(valid) > 0 {
+		if id, ok := valid[0][db.BatchIDColumn].(string); ok {
+			report.BatchID = id
+		}
+		h.publishIngest(tableName, valid)
+	}
+	return report, nil
+}
+
+// addError lists e unless maxRowErrors are listed already
+func (r *PartialIngestReport) addError(e RowError) {
+	if len(r.Errors) < maxRowErrors {
+		r.Errors = append(r.Errors, e)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// checkRecord converts a record's values for the table's columns. It
+// returns the offending column when a value doesn't fit.
+func checkRecord(record map[string]interface{}, types map[string]string) (map[string]interface{}, string, error) {
+	row := make(map[string]interface{}, len(record))
+	for _, col := range sortedKeys(record) {
+		typ, ok := types[col]
+		if !ok {
+			return nil, col, fmt.Errorf("unknown column")
+		}
+		v, err := convertValue(typ, record[col])
+		if err != nil {
+			return nil, col, err
+		}
+		row[col] = v
+	}
+	if len(row) == 0 {
+		return nil, "", fmt.Errorf("empty record")
+	}
+	return row, "", nil
+}
+
+// insertValid inserts rows in one transaction and returns the inserted
+// ones. If the database refuses a statement, its rows are retried one at
+// a time under savepoints and reject is called with the index of each row
+// that fails.
+func (h *DataIngestHandler) insertValid(tableName string, cols []string, rows []map[string]interface{}, reject func(i int, reason string)) ([]map[string]interface{}, error) {
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	exec := func(name string, batch []map[string]interface{}) error {
+		if _, err := tx.Exec("SAVEPOINT " + name); err != nil {
+			return err
+		}
+		query, args := insertStatement(tableName, cols, batch)
+		if _, err := tx.Exec(query, args...); err != nil {
+			if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT " + name); rbErr != nil {
+				return rbErr
+			}
+			if _, rbErr := tx.Exec("RELEASE SAVEPOINT " + name); rbErr != nil {
+				return rbErr
+			}
+			return &rowsRefused{err}
+		}
+		_, err := tx.Exec("RELEASE SAVEPOINT " + name)
+		return err
+	}
+
+	accepted := make([]map[string]interface{}, 0, len(rows))
+	size := max(db.MaxBindParams(h.DB)/len(cols), 1)
+	for start := 0; start < len(rows); start += size {
+		end := min(start+size, len(rows))
+		err := exec("ingest_batch", rows[start:end])
+		if err == nil {
+			accepted = append(accepted, rows[start:end]...)
+			continue
+		}
+		if _, refused := err.(*rowsRefused); !refused {
+			return nil, requestError(http.StatusInternalServerError, "failed to insert data", err)
+		}
+		for i := start; i < end; i++ {
+			err := exec("ingest_row", rows[i:i+1])
+			if refused, ok := err.(*rowsRefused); ok {
+				reject(i, refused.err.Error())
+				continue
+			}
+			if err != nil {
+				return nil, requestError(http.StatusInternalServerError, "failed to insert data", err)
+			}
+			accepted = append(accepted, rows[i])
+		}
+	}
+
+	if err := h.CDC.Record(tx, tableName, "ingest", accepted); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to queue change capture", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to commit data", err)
+	}
+	return accepted, nil
+}
+
+// rowsRefused wraps a database error for rows the database would not take
+type rowsRefused struct{ err error }
+
+func (e *rowsRefused) Error() string { return e.err.Error() }
+
+// quoteColumns returns cols quoted and comma-separated for a column list
+func quoteColumns(cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = db.QuoteIdent(col)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// insertStatement builds a multi-row INSERT of cols; missing values are NULL
+func insertStatement(tableName string, cols []string, rows []map[string]interface{}) (string, []interface{}) {
+	args := make([]interface{}, 0, len(rows)*len(cols))
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		holders := make([]string, len(cols))
+		for j, col := range cols {
+			args = append(args, row[col])
+			holders[j] = fmt.Sprintf("$%d", len(args))
+		}
+		values[i] = "(" + strings.Join(holders, ", ") + ")"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", db.QuoteTable(tableName), quoteColumns(cols), strings.Join(values, ", ")), args
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/ingeststats"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultIngestStatsRange = 7 * 24 * time.Hour
+	maxIngestStatsRange     = 366 * 24 * time.Hour
+)
+
+// IngestStatsHandler reports ingest volumes per table
+type IngestStatsHandler struct {
+	Stats *ingeststats.Recorder
+}
+
+func NewIngestStatsHandler(stats *ingeststats.Recorder) *IngestStatsHandler {
+	return &IngestStatsHandler{Stats: stats}
+}
+
+// GET /tables/:name/ingest_stats?since=&until=
+// Rows and payload bytes written through the ingest API per UTC hour,
+// oldest first; hours without ingests are left out. since and until are
+// RFC3339 and default to the last 7 days. Counts outlive the table, so
+// deleted tables can still be billed.
+func (h *IngestStatsHandler) GetIngestStats(c *gin.Context) {
+	table := c.Param("name")
+	if _, err := db.ParseTableName(table); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid table name", err))
+		return
+	}
+
+	until := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+	since := until.Add(-defaultIngestStatsRange)
+	for param, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeError(c, requestError(http.StatusBadRequest, fmt.Sprintf("%s must be an RFC3339 timestamp", param), nil))
+			return
+		}
+		*t = parsed.UTC()
+	}
+	if c.Query("since") == "" && c.Query("until") != "" {
+		since = until.Add(-defaultIngestStatsRange)
+	}
+	if !since.Before(until) {
+		writeError(c, requestError(http.StatusBadRequest, "since must be before until", nil))
+		return
+	}
+	if until.Sub(since) > maxIngestStatsRange {
+		writeError(c, requestError(http.StatusBadRequest, "range too long", fmt.Errorf("at most %d days", maxIngestStatsRange/(24*time.Hour))))
+		return
+	}
+
+	buckets, err := h.Stats.Hourly(table, since, until)
+	if err != nil {
+		log.Printf("ingest stats error: table=%s err=%v", table, err)
+		writeError(c, requestError(http.StatusInternalServerError, "failed to load ingest stats", nil))
+		return
+	}
+	var rows, bytes int64
+	for _, b := range buckets {
+		rows += b.Rows
+		bytes += b.Bytes
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"table_name":  table,
+		"since":       since,
+		"until":       until,
+		"total_rows":  rows,
+		"total_bytes": bytes,
+		"hours":       buckets,
+	})
+}
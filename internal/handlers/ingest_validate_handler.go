@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/quality"
+	"github.com/gin-gonic/gin"
+)
+
+// maxValidatedRows bounds the would-be-inserted rows echoed by a dry run;
+// the counts still cover every row
+const maxValidatedRows = 100
+
+// IngestValidateHandler dry-runs payloads for producers testing them
+type IngestValidateHandler struct {
+	Ingests *DataIngestHandler
+	ETL     *etl.ETLProcessor
+	Quality *quality.Runner // nil = no rule checks
+}
+
+func NewIngestValidateHandler(ingests *DataIngestHandler, etlProc *etl.ETLProcessor, runner *quality.Runner) *IngestValidateHandler {
+	return &IngestValidateHandler{Ingests: ingests, ETL: etlProc, Quality: runner}
+}
+
+// ValidatedRow is a payload row as it would be inserted
+type ValidatedRow struct {
+	Index int                    `json:"index"`
+	Row   map[string]interface{} `json:"row"`
+}
+
+// POST /ingest/:table_name/validate
+// Runs a payload through the transform, type coercion and the table's
+// row-level quality checks and expectations without writing anything, and
+// reports which rows would be inserted and which rejected. Rows breaking
+// an expectation are rejected; quality checks only warn.
+func (h *IngestValidateHandler) Validate(c *gin.Context) {
+	tableName := c.Param("table_name")
+	if err := h.Ingests.CheckTable(tableName); err != nil {
+		writeError(c, err)
+		return
+	}
+	body, ok := h.Ingests.readBody(c)
+	if !ok {
+		return
+	}
+	records, err := decodeRecords(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+		return
+	}
+	if len(records) == 0 {
+		writeError(c, requestError(http.StatusBadRequest, "no data provided", nil))
+		return
+	}
+	if max := h.Ingests.Limits.MaxRows; max > 0 && len(records) > max {
+		h.Ingests.tooLarge(c, fmt.Sprintf("payload has %d records, limit is %d", len(records), max))
+		return
+	}
+
+	check, err := h.ETL.CheckPayload(tableName, records)
+	if err != nil {
+		log.Printf("validate error: table=%s err=%v", tableName, err)
+		writeError(c, requestError(http.StatusInternalServerError, "failed to validate payload", err))
+		return
+	}
+	rejected := check.Rejected
+	if rejected == nil {
+		rejected = []etl.RowIssue{}
+	}
+
+	warnings := []quality.RowViolation{}
+	var skipped []string
+	if h.Quality != nil && len(check.Rows) > 0 {
+		violations, skip, err := h.Quality.CheckRows(tableName, check.Rows)
+		if err != nil {
+			log.Printf("validate rules error: table=%s err=%v", tableName, err)
+			writeError(c, requestError(http.StatusInternalServerError, "failed to check rules", err))
+			return
+		}
+		skipped = skip
+		broken := map[int]bool{}
+		for _, v := range violations {
+			v.Index = check.Indexes[v.Index]
+			if !v.Expectation {
+				warnings = append(warnings, v)
+				continue
+			}
+			broken[v.Index] = true
+			rejected = append(rejected, etl.RowIssue{Index: v.Index, Column: v.Column,
+				Reason: fmt.Sprintf("expectation %s: %s", v.Check, v.Message)})
+		}
+		if len(broken) > 0 {
+			rows, indexes := check.Rows[:0:0], check.Indexes[:0:0]
+			for i, row := range check.Rows {
+				if !broken[check.Indexes[i]] {
+					rows, indexes = append(rows, row), append(indexes, check.Indexes[i])
+				}
+			}
+			check.Rows, check.Indexes = rows, indexes
+		}
+	}
+	sort.SliceStable(rejected, func(a, b int) bool { return rejected[a].Index < rejected[b].Index })
+
+	accepted := make([]ValidatedRow, 0, min(len(check.Rows), maxValidatedRows))
+	for i, row := range check.Rows[:min(len(check.Rows), maxValidatedRows)] {
+		accepted = append(accepted, ValidatedRow{Index: check.Indexes[i], Row: row})
+	}
+	resp := gin.H{
+		"table_name": tableName,
+		"valid":      len(check.Rows) == len(records),
+		"accepted":   len(check.Rows),
+		"rejected":   len(records) - len(check.Rows),
+		"rows":       accepted,
+		"errors":     rejected,
+		"warnings":   warnings,
+	}
+	if len(check.Rows) > maxValidatedRows {
+		resp["rows_truncated"] = true
+	}
+	if len(check.Dropped) > 0 {
+		resp["dropped_columns"] = check.Dropped
+	}
+	if len(skipped) > 0 {
+		resp["skipped_checks"] = skipped
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/alkha0306/godataflow/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler serves GET /metrics in the Prometheus text format
+func MetricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Default.WritePrometheus(c.Writer); err != nil {
+		log.Printf("metrics write error: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alkha0306/godataflow/internal/notify"
+	"github.com/gin-gonic/gin"
+)
+
+type NotifyHandler struct {
+	Router *notify.Router
+}
+
+func NewNotifyHandler(router *notify.Router) *NotifyHandler {
+	return &NotifyHandler{Router: router}
+}
+
+// CreateNotificationRequest is the payload for POST /tables/:name/notifications
+type CreateNotificationRequest struct {
+	Target      string `json:"target" binding:"required"` // http(s) webhook URL, or log
+	MinSeverity string `json:"min_severity"`              // info, warning, error (default) or critical
+	Enabled     *bool  `json:"enabled"`                   // defaults to true
+}
+
+// GET /tables/:name/notifications
+func (h *NotifyHandler) ListNotifications(c *gin.Context) {
+	routes, err := h.Router.List(c.Param("name"))
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to list notification routes", err))
+		return
+	}
+	c.JSON(http.StatusOK, routes)
+}
+
+// POST /tables/:name/notifications
+// Adds a notification route; the table's events of at least its minimum
+// severity are delivered to the target from now on
+func (h *NotifyHandler) CreateNotification(c *gin.Context) {
+	var req CreateNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	rt, err := h.Router.Create(c.Param("name"), notify.Route{
+		Target:      req.Target,
+		MinSeverity: req.MinSeverity,
+		Enabled:     enabled,
+	})
+	if err != nil {
+		writeError(c, notifyError(err, "failed to create notification route"))
+		return
+	}
+	c.JSON(http.StatusCreated, rt)
+}
+
+// DELETE /tables/:name/notifications/:id
+func (h *NotifyHandler) DeleteNotification(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid route id", nil))
+		return
+	}
+	if err := h.Router.Delete(c.Param("name"), id); err != nil {
+		writeError(c, notifyError(err, "failed to delete notification route"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "notification route deleted"})
+}
+
+// POST /tables/:name/notifications/:id/test
+// Sends the route a sample notification, even if it is disabled
+func (h *NotifyHandler) TestNotification(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid route id", nil))
+		return
+	}
+	rt, err := h.Router.Get(c.Param("name"), id)
+	if err != nil {
+		writeError(c, notifyError(err, "failed to load notification route"))
+		return
+	}
+	if err := h.Router.Test(rt); err != nil {
+		writeError(c, requestError(http.StatusBadGateway, "delivery failed", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "test notification sent"})
+}
+
+// notifyError maps notify package errors to responses
+func notifyError(err error, msg string) error {
+	switch {
+	case errors.Is(err, notify.ErrNotFound):
+		return requestError(http.StatusNotFound, "not found", err)
+	case errors.Is(err, notify.ErrInvalid):
+		return requestError(http.StatusBadRequest, "invalid notification route", err)
+	}
+	return requestError(http.StatusInternalServerError, msg, err)
+}
@@ -3,23 +3,43 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/alkha0306/godataflow/internal/etl"
 	"github.com/gin-gonic/gin"
 )
 
-// PreviewSourceHandler GET /preview_source?url=...
+const (
+	defaultTransformPreviewRows = 20
+	maxTransformPreviewRows     = 1000
+)
+
+type PreviewHandler struct {
+	Client  *http.Client
+	Timeout time.Duration
+	ETL     *etl.ETLProcessor
+}
+
+func NewPreviewHandler(client *http.Client, timeout time.Duration, etlProc *etl.ETLProcessor) *PreviewHandler {
+	return &PreviewHandler{Client: client, Timeout: timeout, ETL: etlProc}
+}
+
+// PreviewSource GET /preview_source?url=...
 // Returns a small preview of the JSON at the provided URL.
 // Truncates arrays to max 10 elements and objects to max 20 keys.
-func PreviewSourceHandler(c *gin.Context) {
+func (h *PreviewHandler) PreviewSource(c *gin.Context) {
 	rawURL := c.Query("url")
 	if rawURL == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "url query param required"})
 		return
 	}
+	// date placeholders preview as of now, as on a first refresh
+	rawURL = etl.URLVars{Now: time.Now()}.Expand(rawURL)
 	// validate URL
 	parsed, err := url.ParseRequestURI(rawURL)
 	if err != nil || !(parsed.Scheme == "http" || parsed.Scheme == "https") {
@@ -28,7 +48,7 @@ func PreviewSourceHandler(c *gin.Context) {
 	}
 
 	// fetch with timeout
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.Timeout)
 	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
@@ -36,8 +56,7 @@ func PreviewSourceHandler(c *gin.Context) {
 		return
 	}
 
-	cli := &http.Client{}
-	resp, err := cli.Do(req)
+	resp, err := h.Client.Do(req)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to fetch url", "details": err.Error()})
 		return
@@ -107,3 +126,183 @@ func buildPreview(v interface{}) interface{} {
 		return v
 	}
 }
+
+// TransformPreviewRequest is the body of POST /transform/preview. With
+// neither rows nor url the table's own source is fetched (source picks
+// one of its data_sources); pagination, request and records_path override
+// the table's settings. Pasted rows are records unless records_path is
+// given.
+type TransformPreviewRequest struct {
+	TableName   string             `json:"table_name" binding:"required"`
+	Rows        json.RawMessage    `json:"rows"`
+	URL         string             `json:"url"`
+	Source      string             `json:"source"`
+	RecordsPath *string            `json:"records_path"`
+	Pagination  *etl.Pagination    `json:"pagination"`
+	Request     *etl.SourceRequest `json:"request"`
+	Limit       int                `json:"limit"`
+}
+
+// POST /transform/preview
+// Runs sample records, pasted or fetched, through what a refresh of the
+// table would do to them: records_path extraction, the transform, type
+// coercion and validation against the table's columns, and the watermark
+// of incremental tables. Nothing is written; the table's settings are
+// left as they are, so overrides can be tried before saving them.
+func (h *PreviewHandler) TransformPreview(c *gin.Context) {
+	var req TransformPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	table, err := currentWorkspace(c).Qualify(req.TableName)
+	if err != nil {
+		writeError(c, workspaceError(err, "invalid table name"))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultTransformPreviewRows
+	}
+	if req.Limit < 0 || req.Limit > maxTransformPreviewRows {
+		writeError(c, requestError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTransformPreviewRows), nil))
+		return
+	}
+	if len(req.Rows) > 0 && (req.URL != "" || req.Source != "") {
+		writeError(c, requestError(http.StatusBadRequest, "rows can't be combined with url or source", nil))
+		return
+	}
+	if req.RecordsPath != nil {
+		if err := etl.CheckRecordsPath(*req.RecordsPath); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid records_path", err))
+			return
+		}
+	}
+	if req.Pagination != nil {
+		if err := req.Pagination.Check(); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid pagination", err))
+			return
+		}
+	}
+	if req.Request != nil {
+		if err := req.Request.Check(); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid request", err))
+			return
+		}
+	}
+
+	var exists bool
+	if err := h.ETL.DB.Get(&exists, `SELECT EXISTS (SELECT 1 FROM table_metadata WHERE table_name = $1)`, table); err != nil {
+		log.Printf("transform preview error: table=%s err=%v", table, err)
+		writeError(c, requestError(http.StatusInternalServerError, "failed to check metadata", nil))
+		return
+	}
+	if !exists {
+		writeError(c, requestError(http.StatusNotFound, "table not found", nil))
+		return
+	}
+
+	var (
+		records []map[string]interface{}
+		more    bool
+	)
+	if len(req.Rows) > 0 {
+		path := ""
+		if req.RecordsPath != nil {
+			path = *req.RecordsPath
+		}
+		records, more, err = etl.PreviewPayload(req.Rows, path, req.Limit)
+		if err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid rows", err))
+			return
+		}
+	} else {
+		src, err := h.previewSource(table, req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), h.Timeout)
+		defer cancel()
+		records, more, err = h.ETL.PreviewSource(ctx, table, src, req.Limit)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "failed to fetch source", "details": err.Error()})
+			return
+		}
+	}
+
+	preview, err := h.ETL.CheckPreview(table, records)
+	if err != nil {
+		log.Printf("transform preview error: table=%s err=%v", table, err)
+		writeError(c, requestError(http.StatusInternalServerError, "failed to check rows", nil))
+		return
+	}
+	rows := make([]ValidatedRow, len(preview.Rows))
+	for i, row := range preview.Rows {
+		rows[i] = ValidatedRow{Index: preview.Indexes[i], Row: row}
+	}
+	rejected := preview.Rejected
+	if rejected == nil {
+		rejected = []etl.RowIssue{}
+	}
+	resp := gin.H{
+		"table_name": table,
+		"records":    len(records),
+		"truncated":  more,
+		"rows":       rows,
+		"errors":     rejected,
+	}
+	if len(preview.Dropped) > 0 {
+		resp["dropped_columns"] = preview.Dropped
+	}
+	if preview.Filtered != nil {
+		resp["watermark"] = preview.Watermark
+		resp["filtered"] = preview.Filtered
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// previewSource picks the source a transform preview fetches: the table's
+// source named req.source (its first by default) with req's overrides;
+// req.url replaces only its URL
+func (h *PreviewHandler) previewSource(table string, req TransformPreviewRequest) (etl.Source, error) {
+	if req.URL != "" {
+		parsed, err := url.ParseRequestURI(req.URL)
+		if err != nil || !(parsed.Scheme == "http" || parsed.Scheme == "https") {
+			return etl.Source{}, requestError(http.StatusBadRequest, "invalid url", nil)
+		}
+	}
+	var src etl.Source
+	sources, err := h.ETL.LoadSources(table)
+	switch {
+	case err != nil && req.URL == "":
+		return src, requestError(http.StatusBadRequest, "table has no source to preview; give rows or url", err)
+	case err != nil && req.Source != "":
+		return src, requestError(http.StatusNotFound, fmt.Sprintf("source %q not found", req.Source), nil)
+	case err == nil:
+		src = sources[0]
+		if req.Source != "" {
+			found := false
+			for _, s := range sources {
+				if s.Name == req.Source {
+					src, found = s, true
+				}
+			}
+			if !found {
+				return src, requestError(http.StatusNotFound, fmt.Sprintf("source %q not found", req.Source), nil)
+			}
+		}
+	}
+	if req.URL != "" {
+		src.URL = req.URL
+	}
+	if req.RecordsPath != nil {
+		src.RecordsPath = *req.RecordsPath
+	}
+	if req.Pagination != nil {
+		src.Pagination = req.Pagination
+	}
+	if req.Request != nil {
+		src.Request = req.Request
+	}
+	return src, nil
+}
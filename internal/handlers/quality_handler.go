@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/alkha0306/godataflow/internal/quality"
+	"github.com/gin-gonic/gin"
+)
+
+type QualityHandler struct {
+	Runner *quality.Runner
+}
+
+func NewQualityHandler(runner *quality.Runner) *QualityHandler {
+	return &QualityHandler{Runner: runner}
+}
+
+// GET /tables/:name/quality
+// Returns the configured checks and expectations and the results of the
+// latest run. Both are set with PUT /tables/:name/config and run after
+// each refresh; results of expectations carry "expectation": true.
+func (h *QualityHandler) Report(c *gin.Context) {
+	table := c.Param("name")
+
+	checks, err := h.Runner.LoadChecks(table)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load quality checks", "details": err.Error()})
+		return
+	}
+
+	expectations, err := h.Runner.LoadExpectations(table)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load expectations", "details": err.Error()})
+		return
+	}
+
+	results, err := h.Runner.Latest(table)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load quality results", "details": err.Error()})
+		return
+	}
+
+	resp := gin.H{
+		"table":        table,
+		"checks":       checks,
+		"expectations": expectations,
+		"status":       quality.Summary(results),
+		"results":      results,
+	}
+	if len(results) > 0 {
+		resp["checked_at"] = results[0].CheckedAt
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -1,55 +1,159 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/export"
+	"github.com/alkha0306/godataflow/internal/querybuilder"
+	"github.com/alkha0306/godataflow/internal/querylog"
+	"github.com/alkha0306/godataflow/internal/workspace"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
+// QueryHandler serves read-only endpoints, so it routes through the replica when available
 type QueryHandler struct {
-	DB *sqlx.DB
+	Reads *db.ReadRouter
+	Log   *querylog.Recorder // /query and /transform runs are audited here; nil = off
 }
 
-func NewQueryHandler(db *sqlx.DB) *QueryHandler {
-	return &QueryHandler{DB: db}
+func NewQueryHandler(reads *db.ReadRouter, queryLog *querylog.Recorder) *QueryHandler {
+	return &QueryHandler{Reads: reads, Log: queryLog}
 }
 
 // Query Endpoint
 // Example usage: "http://localhost:8080/query?table=sales&filter=region='Asia'&limit=10"
+// format=csv|ndjson|parquet|arrow (or Accept: application/vnd.apache.arrow.stream)
+// returns the rows as a file instead of JSON. Soft-deleted rows are left
+// out unless include_deleted=true.
 // =======================
 func (h *QueryHandler) QueryData(c *gin.Context) {
 	table := c.Query("table")
+	format := c.DefaultQuery("format", "json")
+	if c.Query("format") == "" && strings.Contains(c.GetHeader("Accept"), export.ContentType(export.Arrow)) {
+		format = export.Arrow
+	}
+	if format != "json" && !export.Supported(format) {
+		writeError(c, requestError(http.StatusBadRequest, "invalid format",
+			fmt.Errorf("format must be json or one of %s", strings.Join(export.Formats, ", "))))
+		return
+	}
 	filter := c.Query("filter") // e.g., "country='US'"
-	limit := c.DefaultQuery("limit", "10")
-	offset := c.DefaultQuery("offset", "0")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a non-negative integer"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
 
-	if table == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "table parameter is required"})
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
 		return
 	}
 
+	started := time.Now()
+	results, query, err := h.query(currentWorkspace(c), table, filter, limit, offset, includeDeleted)
+	if query != "" {
+		auditQuery(c, h.Log, querylog.Entry{Kind: querylog.KindQuery, TableName: &table, Statement: query}, started, len(results), err)
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if format != "json" {
+		h.writeRows(c, table, format, results)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(results),
+		"data":  results,
+	})
+}
+
+// QueryAs reads up to limit rows of table matching the optional SQL filter
+// for callers outside gin (the gRPC API). The filter is confined to ws as
+// for /query, or unconfined when ws is nil. Tables in soft delete mode
+// only return rows not deleted, unless includeDeleted. The query is
+// recorded in the audit log like /query, under caller and clientIP (left
+// out when empty).
+func (h *QueryHandler) QueryAs(ws *workspace.Workspace, caller, clientIP, table, filter string, limit, offset int, includeDeleted bool) ([]map[string]interface{}, error) {
+	started := time.Now()
+	results, query, err := h.query(ws, table, filter, limit, offset, includeDeleted)
+	if query != "" {
+		e := querylog.Entry{Kind: querylog.KindQuery, Caller: caller, TableName: &table, Statement: query}
+		if clientIP != "" {
+			e.ClientIP = &clientIP
+		}
+		if ws != nil {
+			e.Workspace = &ws.Name
+		}
+		h.Log.Record(e, started, len(results), auditError(err))
+	}
+	return results, err
+}
+
+// query reads rows as QueryAs does, with the filter confined to ws (or
+// unconfined when ws is nil), also returning the SQL it ran, or "" when it
+// failed before building it
+func (h *QueryHandler) query(ws *workspace.Workspace, table, filter string, limit, offset int, includeDeleted bool) ([]map[string]interface{}, string, error) {
+	if table == "" {
+		return nil, "", requestError(http.StatusBadRequest, "table parameter is required", nil)
+	}
+	if _, err := db.ParseTableName(table); err != nil {
+		return nil, "", requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+
 	// Build base query
-	query := fmt.Sprintf("SELECT * FROM %s", table)
+	query := fmt.Sprintf("SELECT * FROM %s", db.QuoteTable(table))
+
+	// Skip soft-deleted rows
+	if !includeDeleted {
+		live, err := liveRows(h.Reads.Reader(), table)
+		if err != nil {
+			return nil, "", err
+		}
+		if live != "" {
+			if filter != "" {
+				live = fmt.Sprintf("(%s) AND %s", filter, live)
+			}
+			filter = live
+		}
+	}
 
 	// Add filter if provided
 	if filter != "" {
 		query += fmt.Sprintf(" WHERE %s", filter)
 	}
 
-	query += fmt.Sprintf(" LIMIT %s OFFSET %s", limit, offset)
+	query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
 
 	// Run query safely — sqlx automatically maps rows to []map[string]interface{}
-	rows, err := h.DB.Queryx(query)
+	rows, err := ws.Query(context.Background(), h.Reads.Reader(), query)
 	if err != nil {
 		log.Printf("query error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to execute query"})
-		return
+		return nil, query, hiddenError(http.StatusInternalServerError, "failed to execute query", err)
 	}
 	defer rows.Close()
 
+	// exact decimals are returned as JSON numbers with every digit
+	var decimal map[string]bool
+	if types, err := rows.ColumnTypes(); err == nil {
+		decimal = export.DecimalColumns(types)
+	}
 	results := []map[string]interface{}{}
 	for rows.Next() {
 		row := make(map[string]interface{})
@@ -57,13 +161,61 @@ func (h *QueryHandler) QueryData(c *gin.Context) {
 			log.Printf("scan error: %v", err)
 			continue
 		}
+		export.Decimals(row, decimal)
 		results = append(results, row)
 	}
+	return results, query, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"count": len(results),
-		"data":  results,
-	})
+// includeDeletedParam reads the include_deleted parameter; on failure it
+// has already responded
+func includeDeletedParam(c *gin.Context) (bool, bool) {
+	include, err := strconv.ParseBool(c.DefaultQuery("include_deleted", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "include_deleted must be true or false"})
+		return false, false
+	}
+	return include, true
+}
+
+// liveRows returns the condition leaving out the soft-deleted rows of
+// table, or "" when it isn't in soft delete mode
+func liveRows(q sqlx.Queryer, table string) (string, error) {
+	soft, err := etl.SoftDeletes(q, table)
+	if err != nil {
+		return "", requestError(http.StatusInternalServerError, "failed to read soft delete mode", err)
+	}
+	if !soft {
+		return "", nil
+	}
+	return db.QuoteIdent(etl.DeletedAtColumn) + " IS NULL", nil
+}
+
+// writeRows sends query results in an export format, typed by the table's columns
+func (h *QueryHandler) writeRows(c *gin.Context, table, format string, results []map[string]interface{}) {
+	cols, err := db.TableColumns(h.Reads.Reader(), table)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to load table columns", err))
+		return
+	}
+
+	var buf bytes.Buffer
+	w, err := export.NewWriter(format, &buf, cols)
+	if err == nil {
+		for _, row := range results {
+			if err = w.Write(row); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to encode results", err))
+		return
+	}
+	c.Data(http.StatusOK, export.ContentType(format), buf.Bytes())
 }
 
 // Transform Endpoint
@@ -78,6 +230,10 @@ func (h *QueryHandler) TransformData(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "table, aggregate, and group_by are required"})
 		return
 	}
+	if _, err := db.ParseTableName(table); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid table name", "details": err.Error()})
+		return
+	}
 
 	// Construct query safely
 	query := fmt.Sprintf(`
@@ -85,11 +241,14 @@ func (h *QueryHandler) TransformData(c *gin.Context) {
 		FROM %s
 		GROUP BY %s
 		ORDER BY %s ASC
-	`, aggregate, groupBy, table, groupBy, groupBy)
+	`, aggregate, groupBy, db.QuoteTable(table), groupBy, groupBy)
 
-	rows, err := h.DB.Queryx(query)
+	started := time.Now()
+	entry := querylog.Entry{Kind: querylog.KindTransform, TableName: &table, Statement: query}
+	rows, err := currentWorkspace(c).Query(c.Request.Context(), h.Reads.Reader(), query)
 	if err != nil {
 		log.Printf("transform query error: %v", err)
+		auditQuery(c, h.Log, entry, started, 0, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to execute transformation"})
 		return
 	}
@@ -104,9 +263,59 @@ func (h *QueryHandler) TransformData(c *gin.Context) {
 		}
 		results = append(results, row)
 	}
+	auditQuery(c, h.Log, entry, started, len(results), nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"count": len(results),
 		"data":  results,
 	})
 }
+
+// Fields Endpoint
+// GET /tables/:name/fields describes the table's columns for building
+// query specs: the filter ops each supports and, for columns with allowed
+// values, the values to offer
+// =======================
+func (h *QueryHandler) TableFields(c *gin.Context) {
+	table := c.Param("name")
+	reader := h.Reads.Reader()
+	cols, err := db.TableColumns(reader, table)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to fetch columns", err))
+		return
+	}
+	allowed, err := etl.LoadAllowedValues(reader, table)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to load allowed values", err))
+		return
+	}
+
+	fields := make([]querybuilder.Field, 0, len(cols))
+	for _, col := range cols {
+		f := querybuilder.Field{Column: col.ColumnName, Type: col.DataType, Ops: querybuilder.Ops(col.DataType)}
+		if values, ok := allowed[col.ColumnName]; ok {
+			f.Values = values
+			f.Ops = []string{"=", "!=", "in", "is_null", "not_null"}
+		}
+		fields = append(fields, f)
+	}
+	c.JSON(http.StatusOK, fields)
+}
+
+// Compile Endpoint
+// POST /query/compile with a querybuilder.Spec returns the SQL it compiles
+// to and its bound parameters, without running it
+// =======================
+func (h *QueryHandler) CompileQuery(c *gin.Context) {
+	var spec querybuilder.Spec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	compiled, err := querybuilder.Compile(spec)
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid query spec", err))
+		return
+	}
+	c.JSON(http.StatusOK, compiled)
+}
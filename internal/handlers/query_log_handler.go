@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/querylog"
+	"github.com/gin-gonic/gin"
+)
+
+// QueryLogHandler serves the query audit log
+type QueryLogHandler struct {
+	Log *querylog.Recorder
+}
+
+func NewQueryLogHandler(queryLog *querylog.Recorder) *QueryLogHandler {
+	return &QueryLogHandler{Log: queryLog}
+}
+
+// GET /query_logs
+// Queries run through /query (or the gRPC Query call), /transform, saved
+// queries and shared links, newest first. Optional query params: kind, caller, workspace, table,
+// errors (true for failed queries only), since, until (RFC3339), limit,
+// offset. The total match count is sent in X-Total-Count.
+func (h *QueryLogHandler) ListQueryLogs(c *gin.Context) {
+	f := querylog.Filter{
+		Kind:      c.Query("kind"),
+		Caller:    c.Query("caller"),
+		Workspace: c.Query("workspace"),
+		Table:     c.Query("table"),
+	}
+	if raw := c.Query("errors"); raw != "" {
+		errorsOnly, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "errors must be true or false"})
+			return
+		}
+		f.ErrorsOnly = errorsOnly
+	}
+	for param, dst := range map[string]**time.Time{"since": &f.Since, "until": &f.Until} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param)})
+			return
+		}
+		t = t.UTC()
+		*dst = &t
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	f.Limit = min(limit, maxLogLimit)
+	if f.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || f.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	entries, total, err := h.Log.List(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch query logs", "details": err.Error()})
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, entries)
+}
+
+// auditQuery records a query the request ran in the query audit log, with
+// the caller, workspace and client address of the request unless e has
+// them. err is the query's failure, including details kept from the caller.
+func auditQuery(c *gin.Context, l *querylog.Recorder, e querylog.Entry, started time.Time, rows int, err error) {
+	if l == nil {
+		return
+	}
+	if e.Caller == "" {
+		e.Caller = callerOf(c)
+	}
+	if ws := currentWorkspace(c); ws != nil && e.Workspace == nil {
+		e.Workspace = &ws.Name
+	}
+	ip := c.ClientIP()
+	e.ClientIP = &ip
+	l.Record(e, started, rows, auditError(err))
+}
+
+// auditError is err as the audit log keeps it, with the details a
+// RequestError hides from the caller
+func auditError(err error) error {
+	if re, ok := err.(*RequestError); ok && re.cause != nil {
+		return fmt.Errorf("%s: %w", re.Message, re.cause)
+	}
+	return err
+}
@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/export"
+	"github.com/alkha0306/godataflow/internal/querylog"
+	"github.com/alkha0306/godataflow/internal/workspace"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
@@ -17,19 +24,23 @@ type SavedQuery struct {
 	Description string `db:"description" json:"description,omitempty"`
 }
 
-// Handler struct
+// Handler struct: writes go to DB, listing/running saved queries goes through Reads
 type QueryTemplateHandler struct {
-	DB *sqlx.DB
+	DB    *sqlx.DB
+	Reads *db.ReadRouter
+	Log   *querylog.Recorder // saved query runs are audited here; nil = off
 }
 
-func NewQueryTemplateHandler(db *sqlx.DB) *QueryTemplateHandler {
-	return &QueryTemplateHandler{DB: db}
+func NewQueryTemplateHandler(database *sqlx.DB, reads *db.ReadRouter, queryLog *querylog.Recorder) *QueryTemplateHandler {
+	return &QueryTemplateHandler{DB: database, Reads: reads, Log: queryLog}
 }
 
-// List Saved Queries
+// List Saved Queries of the caller's workspace
 func (h *QueryTemplateHandler) ListQueries(c *gin.Context) {
-	var queries []SavedQuery
-	err := h.DB.Select(&queries, "SELECT * FROM saved_queries ORDER BY id ASC")
+	queries := []SavedQuery{}
+	err := h.Reads.Reader().Select(&queries,
+		"SELECT id, name, sql_text, description FROM saved_queries WHERE "+workspaceCond(currentWorkspace(c), 1)+" ORDER BY id ASC",
+		workspaceArgs(currentWorkspace(c))...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list saved queries"})
 		return
@@ -52,13 +63,17 @@ func (h *QueryTemplateHandler) CreateQuery(c *gin.Context) {
 	}
 
 	query := `
-		INSERT INTO saved_queries (name, sql_text, description)
-		VALUES ($1, $2, $3)
+		INSERT INTO saved_queries (name, sql_text, description, workspace_id)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, name, sql_text, description
 	`
 
+	var workspaceID interface{}
+	if ws := currentWorkspace(c); ws != nil {
+		workspaceID = ws.ID
+	}
 	var saved SavedQuery
-	err := h.DB.QueryRowx(query, req.Name, req.SQLText, req.Description).StructScan(&saved)
+	err := h.DB.QueryRowx(query, req.Name, req.SQLText, req.Description, workspaceID).StructScan(&saved)
 	if err != nil {
 		log.Printf("insert error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save query"})
@@ -77,34 +92,72 @@ func (h *QueryTemplateHandler) RunSavedQuery(c *gin.Context) {
 		return
 	}
 
-	var sqlText string
-	err = h.DB.Get(&sqlText, "SELECT sql_text FROM saved_queries WHERE id = $1", id)
+	started := time.Now()
+	results, sqlText, err := h.run(c.Request.Context(), currentWorkspace(c), id, 0)
+	if sqlText != "" {
+		auditQuery(c, h.Log, querylog.Entry{Kind: querylog.KindSavedQuery, QueryID: &id, Statement: sqlText}, started, len(results), err)
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "query not found"})
+		writeError(c, err)
 		return
 	}
 
-	// Execute dynamically
-	rows, err := h.DB.Queryx(sqlText)
+	c.JSON(http.StatusOK, gin.H{
+		"id":     id,
+		"result": results,
+	})
+}
+
+// run executes ws's saved query id, confined to ws, and returns up to
+// limit of its rows (all of them when limit is 0) and its SQL; the SQL is
+// "" when no such query was found
+func (h *QueryTemplateHandler) run(ctx context.Context, ws *workspace.Workspace, id, limit int) ([]map[string]interface{}, string, error) {
+	var sqlText string
+	reader := h.Reads.Reader()
+	err := reader.Get(&sqlText, "SELECT sql_text FROM saved_queries WHERE id = $1 AND "+workspaceCond(ws, 2),
+		append([]interface{}{id}, workspaceArgs(ws)...)...)
+	if err != nil {
+		return nil, "", requestError(http.StatusNotFound, "query not found", nil)
+	}
+
+	// Execute dynamically, confined to the caller's workspace
+	rows, err := ws.Query(ctx, reader, sqlText)
 	if err != nil {
 		log.Printf("execution error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to run query"})
-		return
+		return nil, sqlText, hiddenError(http.StatusInternalServerError, "failed to run query", err)
 	}
 	defer rows.Close()
 
+	// exact decimals are returned as JSON numbers with every digit
+	var decimal map[string]bool
+	if types, err := rows.ColumnTypes(); err == nil {
+		decimal = export.DecimalColumns(types)
+	}
 	results := []map[string]interface{}{}
-	for rows.Next() {
+	for (limit == 0 || len(results) < limit) && rows.Next() {
 		row := make(map[string]interface{})
 		if err := rows.MapScan(row); err != nil {
 			log.Printf("scan error: %v", err)
 			continue
 		}
+		export.Decimals(row, decimal)
 		results = append(results, row)
 	}
+	return results, sqlText, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":     id,
-		"result": results,
-	})
+// workspaceCond selects saved_queries rows of ws, taking its id as bind
+// parameter $n (see workspaceArgs); the default workspace's rows have none
+func workspaceCond(ws *workspace.Workspace, n int) string {
+	if ws == nil {
+		return "workspace_id IS NULL"
+	}
+	return fmt.Sprintf("workspace_id = $%d", n)
+}
+
+func workspaceArgs(ws *workspace.Workspace) []interface{} {
+	if ws == nil {
+		return nil
+	}
+	return []interface{}{ws.ID}
 }
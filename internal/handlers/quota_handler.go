@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/alkha0306/godataflow/internal/quota"
+	"github.com/alkha0306/godataflow/internal/workspace"
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaHandler reports usage and manages quota overrides
+type QuotaHandler struct {
+	Quotas     *quota.Enforcer
+	Workspaces *workspace.Registry
+}
+
+func NewQuotaHandler(quotas *quota.Enforcer, workspaces *workspace.Registry) *QuotaHandler {
+	return &QuotaHandler{Quotas: quotas, Workspaces: workspaces}
+}
+
+// GET /usage
+// The caller's workspace: the default one, or the workspace key's
+func (h *QuotaHandler) GetUsage(c *gin.Context) {
+	scope := ""
+	if ws := currentWorkspace(c); ws != nil {
+		scope = ws.Schema
+	}
+	c.JSON(http.StatusOK, h.Quotas.Usage(scope))
+}
+
+// GET /workspaces/:name/usage
+func (h *QuotaHandler) GetWorkspaceUsage(c *gin.Context) {
+	ws, err := h.Workspaces.Get(c.Param("name"))
+	if err != nil {
+		writeError(c, workspaceError(err, "failed to load workspace"))
+		return
+	}
+	c.JSON(http.StatusOK, h.Quotas.Usage(ws.Schema))
+}
+
+// PUT /workspaces/:name/quota
+// Replaces the workspace's overrides; omitted or null limits use the
+// quotas config section
+func (h *QuotaHandler) SetWorkspaceQuota(c *gin.Context) {
+	var req quota.Override
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	ws, err := h.Workspaces.Get(c.Param("name"))
+	if err != nil {
+		writeError(c, workspaceError(err, "failed to load workspace"))
+		return
+	}
+	if err := h.Quotas.SetWorkspace(ws.ID, req); err != nil {
+		writeError(c, quotaError(err, "failed to set quota"))
+		return
+	}
+	c.JSON(http.StatusOK, h.Quotas.Usage(ws.Schema))
+}
+
+// PUT /tables/:name/quota
+// Replaces the table's overrides; omitted or null limits use its workspace's.
+// With If-Match the overrides only replace the table version the caller read.
+func (h *QuotaHandler) SetTableQuota(c *gin.Context) {
+	var req quota.TableOverride
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	table := c.Param("name")
+	version, err := checkTableVersion(h.Quotas.DB, table, tablePrecondition{IfMatch: c.GetHeader("If-Match")})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	next, err := h.Quotas.SetTable(table, req, version)
+	if err != nil {
+		writeError(c, quotaError(err, "failed to set quota"))
+		return
+	}
+	c.Header("ETag", tableETag(next))
+	c.JSON(http.StatusOK, gin.H{"table": table, "max_rows": req.MaxRows, "ingest_per_minute": req.IngestPerMinute})
+}
+
+// rateLimited responds 429 with Retry-After set to when the rate window resets
+func rateLimited(c *gin.Context, err error) {
+	var re *quota.RateError
+	if errors.As(err, &re) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(re.RetryAfter.Seconds()))))
+	}
+	writeError(c, quotaError(err, "failed to check quota"))
+}
+
+// quotaError maps quota errors to HTTP statuses
+func quotaError(err error, msg string) error {
+	switch {
+	case errors.Is(err, quota.ErrRateLimited):
+		return requestError(http.StatusTooManyRequests, "rate limit exceeded", err)
+	case errors.Is(err, quota.ErrExceeded):
+		return requestError(http.StatusForbidden, "quota exceeded", err)
+	case errors.Is(err, quota.ErrInvalid):
+		return requestError(http.StatusBadRequest, "invalid quota", err)
+	case errors.Is(err, quota.ErrStale):
+		return staleTable(errors.New("it was changed by another update"))
+	case errors.Is(err, quota.ErrNotFound):
+		return requestError(http.StatusNotFound, "not found", err)
+	}
+	return requestError(http.StatusInternalServerError, msg, err)
+}
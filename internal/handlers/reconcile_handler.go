@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+type ReconcileHandler struct {
+	ETL        *etl.ETLProcessor
+	Reconciler *scheduler.Reconciler
+}
+
+func NewReconcileHandler(etlProc *etl.ETLProcessor, reconciler *scheduler.Reconciler) *ReconcileHandler {
+	return &ReconcileHandler{ETL: etlProc, Reconciler: reconciler}
+}
+
+// GET /tables/:name/reconciliation
+// Returns the table's reconciliation results, newest first. Optional query param: limit
+func (h *ReconcileHandler) History(c *gin.Context) {
+	table := c.Param("name")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	_, enabled, err := h.ETL.LoadReconcileSettings(table)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reconciliation settings", "details": err.Error()})
+		return
+	}
+
+	results, err := h.ETL.Reconciliations(table, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reconciliation results", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"table": table, "enabled": enabled, "results": results})
+}
+
+// POST /tables/:name/reconcile
+// Reconciles the table now instead of waiting for the next scheduled pass
+func (h *ReconcileHandler) Run(c *gin.Context) {
+	table := c.Param("name")
+
+	_, enabled, err := h.ETL.LoadReconcileSettings(table)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reconciliation settings", "details": err.Error()})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reconciliation is not configured", "details": "set reconcile_window with PUT /tables/:name/config"})
+		return
+	}
+
+	result, err := h.Reconciler.Reconcile(table)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "reconciliation failed", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -1,27 +1,48 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/quality"
+	"github.com/alkha0306/godataflow/internal/rollup"
+	"github.com/alkha0306/godataflow/internal/scheduler"
+	"github.com/alkha0306/godataflow/internal/sink"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
 type RefreshHandler struct {
-	DB  *sqlx.DB
-	ETL *etl.ETLProcessor
+	DB      *sqlx.DB
+	ETL     *etl.ETLProcessor
+	Events  *events.Broker
+	Quality *quality.Runner
+	Sinks   *sink.Exporter
+	Rollups *rollup.Maintainer
+	Queue   *scheduler.Queue // nil = the scheduler is off, so nothing can be queued
 }
 
-func NewRefreshHandler(db *sqlx.DB) *RefreshHandler {
+func NewRefreshHandler(db *sqlx.DB, etlProc *etl.ETLProcessor, broker *events.Broker, checks *quality.Runner, sinks *sink.Exporter, rollups *rollup.Maintainer, queue *scheduler.Queue) *RefreshHandler {
 	return &RefreshHandler{
-		DB:  db,
-		ETL: etl.NewETLProcessor(db),
+		DB:      db,
+		ETL:     etlProc,
+		Events:  broker,
+		Quality: checks,
+		Sinks:   sinks,
+		Rollups: rollups,
+		Queue:   queue,
 	}
 }
 
 // POST /refresh/:table
+// ?queue=true adds the refresh to the scheduler's job queue and returns
+// 202 with the job instead of waiting for the run
 func (h *RefreshHandler) ManualRefresh(c *gin.Context) {
 	table := c.Param("table")
 	if table == "" {
@@ -29,66 +50,211 @@ func (h *RefreshHandler) ManualRefresh(c *gin.Context) {
 		return
 	}
 
-	// 1. Load table metadata (get data_source_url)
-	var meta struct {
-		DataSourceURL *string `db:"data_source_url"`
+	// Load table metadata (data_sources, or data_source_url)
+	var exists bool
+	if err := h.DB.Get(&exists, `SELECT COUNT(*) > 0 FROM table_metadata WHERE table_name = $1`, table); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+	sources, err := h.ETL.LoadSources(table)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "table missing data_source_url", "details": err.Error()})
+		return
+	}
+	if c.Query("queue") == "true" {
+		h.enqueue(c, table, scheduler.KindManual, nil, 0)
+		return
 	}
 
-	err := h.DB.Get(&meta,
-		`SELECT data_source_url FROM table_metadata WHERE table_name = $1`,
-		table,
-	)
+	h.Events.Publish(events.Event{Type: events.JobStarted, Table: table, Message: "manual refresh"})
+	h.run(c, table, sources, 0)
+}
 
+// POST /runs/:id/retry
+// Re-runs a failed refresh with the sources it fetched, placeholders and
+// watermark filled in as they were, so a retry loads the same date window
+// however late it comes. The new run is logged with retry_of pointing at
+// the failed one. ?queue=true queues the retry like POST /refresh/:table.
+func (h *RefreshHandler) RetryRun(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "table not found", "details": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
 		return
 	}
-	if meta.DataSourceURL == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "table missing data_source_url"})
+	var run struct {
+		Table  string           `db:"table_name"`
+		Status string           `db:"status"`
+		Params *json.RawMessage `db:"params"`
+	}
+	err = h.DB.Get(&run, `SELECT table_name, status, params FROM refresh_logs WHERE id = $1`, id)
+	if err == nil && !currentWorkspace(c).Owns(run.Table) {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
 		return
 	}
-
-	// 2. FETCH
-	rows, err := h.ETL.FetchData(*meta.DataSourceURL)
 	if err != nil {
-		h.ETL.WriteRefreshLog(table, "ERROR", err.Error())
-		msg := err.Error()
-		h.ETL.UpdateMetadataStatus(table, "ERROR", &msg)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch run", "details": err.Error()})
+		return
+	}
+	if run.Status != "ERROR" {
+		c.JSON(http.StatusConflict, gin.H{"error": "only failed runs can be retried", "status": run.Status})
+		return
+	}
+	if run.Params == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "run has no recorded sources to retry; it failed before fetching or predates retries"})
+		return
+	}
+	var sources []etl.Source
+	if err := json.Unmarshal(*run.Params, &sources); err != nil || len(sources) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid recorded sources"})
+		return
+	}
+	var exists bool
+	if err := h.DB.Get(&exists, `SELECT COUNT(*) > 0 FROM table_metadata WHERE table_name = $1`, run.Table); err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+
+	if c.Query("queue") == "true" {
+		h.enqueue(c, run.Table, scheduler.KindRetry, sources, id)
 		return
 	}
 
-	// 3. TRANSFORM
-	rows = h.ETL.TransformPayload(rows)
+	h.Events.Publish(events.Event{Type: events.JobStarted, Table: run.Table, Message: fmt.Sprintf("retry of run %d", id)})
+	h.run(c, run.Table, sources, id)
+}
 
-	// 4. VALIDATE
-	validRows, err := h.ETL.ValidatePayload(table, rows)
+// enqueue queues a run for the scheduler's workers and responds 202 with
+// the job; it survives restarts and is logged like a scheduled run
+func (h *RefreshHandler) enqueue(c *gin.Context, table, kind string, sources []etl.Source, retryOf int) {
+	if h.Queue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "the scheduler is disabled, so runs cannot be queued"})
+		return
+	}
+	job, err := h.Queue.Enqueue(table, kind, sources, retryOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue run", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// run refreshes table from sources and records the run, as a retry of
+// run retryOf unless it is 0, then responds with the outcome
+func (h *RefreshHandler) run(c *gin.Context, table string, sources []etl.Source, retryOf int) {
+	// FETCH → TRANSFORM → VALIDATE → INSERT (streamed in chunks)
+	result, err := h.ETL.RefreshSources(table, sources)
+	result.RetryOf = retryOf
 	if err != nil {
-		h.ETL.WriteRefreshLog(table, "ERROR", err.Error())
 		msg := err.Error()
+		runID, _ := h.ETL.WriteRefreshLogRun(table, "ERROR", msg, result, err)
 		h.ETL.UpdateMetadataStatus(table, "ERROR", &msg)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.publishFailure(table, msg, err)
+		resp := gin.H{"error": msg, "error_code": etl.ErrorCode(err), "inserted_rows": result.Inserted, "run_id": runID}
+		if result.Sources != nil {
+			resp["sources"] = result.Sources
+		}
+		c.JSON(http.StatusInternalServerError, resp)
 		return
 	}
 
-	// 5. INSERT
-	count, err := h.ETL.InsertRows(table, validRows)
-	if err != nil {
+	if drift := result.DriftMessage(); drift != "" {
+		h.Events.Publish(events.Event{Type: events.SchemaDrift, Table: table, Message: drift,
+			Data: map[string]interface{}{"changes": result.SchemaChanges}})
+	}
+
+	// Data quality checks and expectations (results under GET /tables/:name/quality);
+	// a broken expectation fails the run even though its rows are loaded
+	outcome := h.Quality.AfterRefresh(table)
+	if outcome.Blocked() {
+		err := etl.ExpectationError(result.Inserted, outcome.Violations)
 		msg := err.Error()
-		h.ETL.WriteRefreshLog(table, "ERROR", msg)
+		runID, _ := h.ETL.WriteRefreshLogRun(table, "ERROR", msg, result, err)
 		h.ETL.UpdateMetadataStatus(table, "ERROR", &msg)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		h.publishFailure(table, msg, err)
+		resp := gin.H{
+			"run_id":        runID,
+			"error":         msg,
+			"error_code":    etl.ErrorCode(err),
+			"inserted_rows": result.Inserted,
+			"violations":    outcome.Violations,
+		}
+		if result.Sources != nil {
+			resp["sources"] = result.Sources
+		}
+		c.JSON(http.StatusUnprocessableEntity, resp)
 		return
 	}
 
-	// 6. SUCCESS
-	h.ETL.WriteRefreshLog(table, "OK", fmt.Sprintf("Inserted %d rows", count))
-	h.ETL.UpdateMetadataStatus(table, "OK", nil)
+	// SUCCESS (or nothing new upstream); WARN when the volume is anomalous
+	status, logMsg, warning := h.ETL.SuccessStatus(table, result)
+	runID, _ := h.ETL.WriteRefreshLogRun(table, status, logMsg, result, nil)
+	h.ETL.UpdateMetadataStatus(table, status, nil)
+	h.Events.Publish(events.Event{
+		Type:    events.JobSucceeded,
+		Table:   table,
+		Message: logMsg,
+		Data:    map[string]interface{}{"inserted_rows": result.Inserted, "unchanged": result.Unchanged},
+	})
+	if warning != "" {
+		h.Events.Publish(events.Event{Type: events.VolumeAnomaly, Table: table, Message: warning,
+			Data: map[string]interface{}{"inserted_rows": result.Inserted}})
+	}
+
+	// Export sinks upload and rollups catch up in the background (see GET
+	// /tables/:name/sinks and /tables/:name/rollups)
+	if !result.Unchanged {
+		go func() {
+			h.Sinks.AfterRefresh(table)
+			h.Rollups.AfterRefresh(table)
+		}()
+	}
 
-	c.JSON(http.StatusOK, gin.H{
+	message := "Refresh completed successfully"
+	if result.Unchanged {
+		message = "Source unchanged, refresh skipped"
+	}
+	resp := gin.H{
+		"run_id":        runID,
 		"table":         table,
-		"status":        "OK",
-		"inserted_rows": count,
-		"message":       "Refresh completed successfully",
+		"status":        status,
+		"inserted_rows": result.Inserted,
+		"unchanged":     result.Unchanged,
+		"message":       message,
+	}
+	if warning != "" {
+		resp["warning"] = warning
+	}
+	if result.BatchID != "" {
+		resp["batch_id"] = result.BatchID
+	}
+	if result.Rejected > 0 {
+		resp["rejected"] = result.Rejected
+		resp["rejected_rows"] = result.Detail.RejectedRows
+	}
+	if len(result.SchemaChanges) > 0 {
+		resp["schema_changes"] = result.SchemaChanges
+	}
+	if result.Sources != nil {
+		resp["sources"] = result.Sources
+	}
+	if outcome.Status != "" {
+		resp["quality"] = outcome.Status
+	}
+	if retryOf > 0 {
+		resp["retry_of"] = retryOf
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// publishFailure emits a job.failed event for a manual refresh
+func (h *RefreshHandler) publishFailure(table, msg string, err error) {
+	h.Events.Publish(events.Event{
+		Type:    events.JobFailed,
+		Table:   table,
+		Message: msg,
+		Data:    map[string]interface{}{"error_code": etl.ErrorCode(err)},
 	})
 }
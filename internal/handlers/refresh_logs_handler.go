@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
@@ -15,36 +22,194 @@ func NewRefreshLogsHandler(db *sqlx.DB) *RefreshLogsHandler {
 	return &RefreshLogsHandler{DB: db}
 }
 
+// LogEntry is a single refresh_logs row
+type LogEntry struct {
+	ID           int              `db:"id" json:"id"`
+	TableName    string           `db:"table_name" json:"table_name"`
+	Status       string           `db:"status" json:"status"`
+	Message      *string          `db:"message" json:"message"`
+	ErrorCode    *string          `db:"error_code" json:"error_code,omitempty"`
+	RowsInserted *int             `db:"rows_inserted" json:"rows_inserted,omitempty"`
+	Sources      *json.RawMessage `db:"sources" json:"sources,omitempty"` // per-source results, for tables with data_sources
+	CreatedAt    string           `db:"created_at" json:"created_at"`
+}
+
+const (
+	defaultLogLimit = 100
+	maxLogLimit     = 1000
+)
+
 // GET /refresh_logs/:table
+// Optional query params: status, error_code, since, until (RFC3339), limit, offset
 func (h *RefreshLogsHandler) GetLogs(c *gin.Context) {
 	table := c.Param("table")
 	if table == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "table name required"})
 		return
 	}
+	h.listLogs(c, table)
+}
+
+// GET /refresh_logs
+// Cross-table view, e.g. /refresh_logs?status=ERROR&since=2024-01-01T00:00:00Z
+func (h *RefreshLogsHandler) ListAllLogs(c *gin.Context) {
+	h.listLogs(c, c.Query("table"))
+}
+
+// listLogs applies the shared filters and pagination.
+// The body stays a plain array; the total match count is sent in X-Total-Count.
+func (h *RefreshLogsHandler) listLogs(c *gin.Context, table string) {
+	conds := []string{}
+	args := []interface{}{}
+
+	addCond := func(expr string, val interface{}) {
+		args = append(args, val)
+		conds = append(conds, fmt.Sprintf(expr, len(args)))
+	}
+
+	if table != "" {
+		addCond("table_name = $%d", table)
+	}
+	if status := c.Query("status"); status != "" {
+		addCond("status = $%d", strings.ToUpper(status))
+	}
+	if code := c.Query("error_code"); code != "" {
+		addCond("error_code = $%d", strings.ToUpper(code))
+	}
+	for param, expr := range map[string]string{"since": "created_at >= $%d", "until": "created_at < $%d"} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 timestamp", param)})
+			return
+		}
+		addCond(expr, t.UTC())
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
 
-	type LogEntry struct {
-		ID        int    `db:"id" json:"id"`
-		TableName string `db:"table_name" json:"table_name"`
-		Status    string `db:"status" json:"status"`
-		Message   string `db:"message" json:"message"`
-		CreatedAt string `db:"created_at" json:"created_at"`
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
 	}
 
-	var logs []LogEntry
-	err := h.DB.Select(&logs,
-		`SELECT id, table_name, status, message, created_at 
-		 FROM refresh_logs 
+	var total int
+	if err := h.DB.Get(&total, fmt.Sprintf(`SELECT COUNT(*) FROM refresh_logs %s`, where), args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count logs", "details": err.Error()})
+		return
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, table_name, status, message, error_code, rows_inserted, sources, created_at
+		FROM refresh_logs
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT %d OFFSET %d`, where, limit, offset)
+
+	logs := []LogEntry{}
+	if err := h.DB.Select(&logs, query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch logs", "details": err.Error()})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, logs)
+}
+
+// GET /refresh_logs/:table/daily
+// Returns long-term daily rollups written by the retention job
+func (h *RefreshLogsHandler) GetDailyRollups(c *gin.Context) {
+	table := c.Param("table")
+	if table == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "table name required"})
+		return
+	}
+
+	type RollupEntry struct {
+		Day       time.Time `db:"day" json:"-"`
+		DayString string    `db:"-" json:"day"`
+		TableName string    `db:"table_name" json:"table_name"`
+		Runs      int       `db:"runs" json:"runs"`
+		Successes int       `db:"successes" json:"successes"`
+		Failures  int       `db:"failures" json:"failures"`
+		TotalRows int64     `db:"total_rows" json:"total_rows"`
+	}
+
+	rollups := []RollupEntry{}
+	err := h.DB.Select(&rollups,
+		`SELECT day, table_name, runs, successes, failures, total_rows
+		 FROM refresh_log_rollups
 		 WHERE table_name = $1
-		 ORDER BY created_at DESC
-		 LIMIT 100`,
+		 ORDER BY day DESC`,
 		table,
 	)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch logs", "details": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rollups", "details": err.Error()})
 		return
 	}
+	for i := range rollups {
+		rollups[i].DayString = rollups[i].Day.Format("2006-01-02")
+	}
 
-	c.JSON(http.StatusOK, logs)
+	c.JSON(http.StatusOK, rollups)
+}
+
+// RunEntry is a refresh_logs row with its stage-by-stage detail and retries
+type RunEntry struct {
+	LogEntry
+	Details *json.RawMessage `db:"details" json:"details"`             // etl.RunDetail; null for runs that failed before fetching
+	RetryOf *int             `db:"retry_of" json:"retry_of,omitempty"` // the failed run this one retries
+	Retries []int            `db:"-" json:"retries"`                   // runs retrying this one, oldest first
+}
+
+// GET /runs/:id
+// One refresh run for post-mortem debugging: its refresh_logs entry plus
+// the time and rows in and out of each pipeline stage, the requests made
+// to the sources, and warnings. The id is the refresh_logs id; failed
+// runs can be retried with POST /runs/:id/retry.
+func (h *RefreshLogsHandler) GetRun(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
+		return
+	}
+
+	var run RunEntry
+	err = h.DB.Get(&run, `
+		SELECT id, table_name, status, message, error_code, rows_inserted, sources, details, retry_of, created_at
+		FROM refresh_logs
+		WHERE id = $1`, id)
+	if err == nil && !currentWorkspace(c).Owns(run.TableName) {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch run", "details": err.Error()})
+		return
+	}
+	run.Retries = []int{}
+	if err := h.DB.Select(&run.Retries, `SELECT id FROM refresh_logs WHERE retry_of = $1 ORDER BY id`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch retries", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, run)
 }
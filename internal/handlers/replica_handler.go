@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alkha0306/godataflow/internal/replica"
+	"github.com/alkha0306/godataflow/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// ReplicaHandler manages subscriptions to tables on other godataflow
+// instances. A replica is read-only locally (ingest and config updates are
+// refused) until unsubscribed.
+type ReplicaHandler struct {
+	Syncer     *replica.Syncer
+	Replicator *scheduler.Replicator
+}
+
+func NewReplicaHandler(syncer *replica.Syncer, replicator *scheduler.Replicator) *ReplicaHandler {
+	return &ReplicaHandler{Syncer: syncer, Replicator: replicator}
+}
+
+// SubscribeRequest is the payload for POST /replicas
+type SubscribeRequest struct {
+	SourceURL    string  `json:"source_url" binding:"required"`   // remote API base, e.g. https://eu.example.com/v1
+	SourceTable  string  `json:"source_table" binding:"required"` // table on the remote instance
+	TableName    string  `json:"table_name"`                      // local name; defaults to source_table
+	APIKey       *string `json:"api_key"`                         // sent to the remote as X-API-Key
+	SyncInterval int     `json:"sync_interval"`                   // seconds; defaults to 300
+	Live         bool    `json:"live"`                            // also sync on the remote's job.succeeded / rows.ingested events
+}
+
+// GET /replicas
+func (h *ReplicaHandler) ListReplicas(c *gin.Context) {
+	replicas, err := h.Syncer.List()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to list replicas", err))
+		return
+	}
+	c.JSON(http.StatusOK, replicas)
+}
+
+// GET /replicas/:name
+func (h *ReplicaHandler) GetReplica(c *gin.Context) {
+	r, err := h.Syncer.Get(c.Param("name"))
+	if err != nil {
+		writeError(c, replicaError(err, "failed to load replica"))
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// POST /replicas
+// Creates the local table from the remote's columns and starts copying
+// its rows in the background
+func (h *ReplicaHandler) Subscribe(c *gin.Context) {
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+
+	r, err := h.Syncer.Subscribe(replica.Replica{
+		Table:        req.TableName,
+		SourceURL:    req.SourceURL,
+		SourceTable:  req.SourceTable,
+		APIKey:       req.APIKey,
+		SyncInterval: req.SyncInterval,
+		Live:         req.Live,
+	})
+	if err != nil {
+		writeError(c, replicaError(err, "failed to subscribe"))
+		return
+	}
+	if !h.Replicator.Trigger(r.Table) {
+		go h.Syncer.SyncTable(r.Table)
+	}
+	c.JSON(http.StatusCreated, r)
+}
+
+// POST /replicas/:name/sync
+// Syncs now and waits for the result
+func (h *ReplicaHandler) SyncReplica(c *gin.Context) {
+	res, err := h.Syncer.SyncTable(c.Param("name"))
+	if err != nil {
+		writeError(c, replicaError(err, "sync failed"))
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// DELETE /replicas/:name
+// Stops syncing; the local copy stays as a regular, writable table
+func (h *ReplicaHandler) Unsubscribe(c *gin.Context) {
+	if err := h.Syncer.Unsubscribe(c.Param("name")); err != nil {
+		writeError(c, replicaError(err, "failed to unsubscribe"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "replica unsubscribed", "table": c.Param("name")})
+}
+
+// replicaError maps replica package errors to responses
+func replicaError(err error, msg string) error {
+	switch {
+	case errors.Is(err, replica.ErrNotFound):
+		return requestError(http.StatusNotFound, "replica not found", err)
+	case errors.Is(err, replica.ErrInvalid):
+		return requestError(http.StatusBadRequest, "invalid replica", err)
+	case errors.Is(err, replica.ErrExists):
+		return requestError(http.StatusConflict, "table already exists", err)
+	case errors.Is(err, replica.ErrBusy):
+		return requestError(http.StatusConflict, "sync already in progress", nil)
+	case errors.Is(err, replica.ErrRemote):
+		return requestError(http.StatusBadGateway, msg, err)
+	}
+	return requestError(http.StatusInternalServerError, msg, err)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alkha0306/godataflow/internal/querybuilder"
+	"github.com/alkha0306/godataflow/internal/rollup"
+	"github.com/gin-gonic/gin"
+)
+
+type RollupHandler struct {
+	Maintainer *rollup.Maintainer
+}
+
+func NewRollupHandler(maintainer *rollup.Maintainer) *RollupHandler {
+	return &RollupHandler{Maintainer: maintainer}
+}
+
+// CreateRollupRequest is the payload for POST /tables/:name/rollups
+type CreateRollupRequest struct {
+	Name       string                   `json:"name" binding:"required"`        // rollup table, created next to the table
+	TimeColumn string                   `json:"time_column" binding:"required"` // timestamp column to bucket by
+	Bucket     string                   `json:"bucket" binding:"required"`      // minute, hour or day
+	GroupBy    []string                 `json:"group_by"`                       // extra columns kept next to the bucket
+	Aggregates []querybuilder.Aggregate `json:"aggregates" binding:"required"`  // e.g. {"func": "avg", "column": "value"}
+	Enabled    *bool                    `json:"enabled"`                        // defaults to true
+}
+
+// GET /tables/:name/rollups
+func (h *RollupHandler) ListRollups(c *gin.Context) {
+	rollups, err := h.Maintainer.List(c.Param("name"))
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to list rollups", err))
+		return
+	}
+	c.JSON(http.StatusOK, rollups)
+}
+
+// POST /tables/:name/rollups
+// Creates the rollup table and fills it from the rows already loaded; it
+// is then brought up to date after every refresh that loaded new data
+func (h *RollupHandler) CreateRollup(c *gin.Context) {
+	var req CreateRollupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	r, err := h.Maintainer.Create(c.Param("name"), req.Name, rollup.Rollup{
+		TimeColumn: req.TimeColumn,
+		Bucket:     req.Bucket,
+		GroupBy:    req.GroupBy,
+		Aggregates: req.Aggregates,
+		Enabled:    enabled,
+	})
+	if err != nil {
+		writeError(c, rollupError(err, "failed to create rollup"))
+		return
+	}
+
+	res := h.Maintainer.Run(r, true)
+	if r, err = h.Maintainer.Get(r.Table, r.ID); err != nil {
+		writeError(c, rollupError(err, "failed to load rollup"))
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"rollup": r, "run": res})
+}
+
+// DELETE /tables/:name/rollups/:id
+// Drops the rollup table as well
+func (h *RollupHandler) DeleteRollup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid rollup id", nil))
+		return
+	}
+	if err := h.Maintainer.Delete(c.Param("name"), id); err != nil {
+		writeError(c, rollupError(err, "failed to delete rollup"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "rollup deleted"})
+}
+
+// POST /tables/:name/rollups/:id/run
+// Brings the rollup up to date now, even if it is disabled; ?rebuild=true
+// recomputes every bucket, picking up rows loaded behind the watermark
+func (h *RollupHandler) RunRollup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid rollup id", nil))
+		return
+	}
+	r, err := h.Maintainer.Get(c.Param("name"), id)
+	if err != nil {
+		writeError(c, rollupError(err, "failed to load rollup"))
+		return
+	}
+
+	res := h.Maintainer.Run(r, c.Query("rebuild") == "true")
+	switch {
+	case res.Skipped:
+		writeError(c, requestError(http.StatusConflict, "rollup is already running", nil))
+	case res.Error != "":
+		writeError(c, requestError(http.StatusInternalServerError, "rollup failed", errors.New(res.Error)))
+	default:
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// rollupError maps rollup package errors to responses
+func rollupError(err error, msg string) error {
+	switch {
+	case errors.Is(err, rollup.ErrNotFound):
+		return requestError(http.StatusNotFound, "not found", err)
+	case errors.Is(err, rollup.ErrInvalid):
+		return requestError(http.StatusBadRequest, "invalid rollup", err)
+	}
+	return requestError(http.StatusInternalServerError, msg, err)
+}
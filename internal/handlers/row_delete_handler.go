@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteRowsRequest is the expected payload for DELETE /tables/:name/rows
+type DeleteRowsRequest struct {
+	// Where selects the rows as in UpdateRowsRequest; it is required, so
+	// a table cannot be emptied by accident
+	Where map[string]interface{} `json:"where"`
+
+	// DryRun counts the matching rows without deleting them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// DELETE /tables/:name/rows
+// Deletes the rows matching a structured filter, e.g. a bad batch with
+// {"where": {"_batch_id": "…"}}. With dry_run only the count is returned.
+// Tables in soft delete mode keep the rows, stamped with _deleted_at.
+func (h *DataIngestHandler) DeleteRows(c *gin.Context) {
+	tableName := c.Param("name")
+	if err := h.CheckTable(tableName); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var req DeleteRowsRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		return
+	}
+
+	n, err := h.DeleteRowsIn(tableName, req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	msg := "rows deleted"
+	if req.DryRun {
+		msg = "dry run: no rows deleted"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    msg,
+		"table_name": tableName,
+		"row_count":  n,
+		"dry_run":    req.DryRun,
+	})
+}
+
+// DeleteRowsIn deletes (or with DryRun counts) the rows of a table
+// already passed through CheckTable that match req.Where. In soft delete
+// mode the rows not deleted yet are stamped with _deleted_at instead.
+func (h *DataIngestHandler) DeleteRowsIn(tableName string, req DeleteRowsRequest) (int64, error) {
+	if len(req.Where) == 0 {
+		return 0, requestError(http.StatusBadRequest, "where is required", fmt.Errorf("give at least one condition"))
+	}
+
+	cols, err := db.TableColumns(h.DB, tableName)
+	if err != nil {
+		log.Printf("column lookup error: table=%s err=%v", tableName, err)
+		return 0, requestError(http.StatusInternalServerError, "failed to load table columns", nil)
+	}
+	types := make(map[string]string, len(cols))
+	for _, col := range cols {
+		types[col.ColumnName] = col.DataType
+	}
+
+	var args []interface{}
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conds, err := rowConditions(req.Where, types, bind)
+	if err != nil {
+		return 0, requestError(http.StatusBadRequest, "invalid where", err)
+	}
+	soft, err := etl.SoftDeletes(h.DB, tableName)
+	if err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to read soft delete mode", err)
+	}
+	if soft {
+		conds = append(conds, fmt.Sprintf(`"%s" IS NULL`, etl.DeletedAtColumn))
+	}
+	where := strings.Join(conds, " AND ")
+
+	if req.DryRun {
+		var n int64
+		if err := h.DB.Get(&n, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", db.QuoteTable(tableName), where), args...); err != nil {
+			log.Printf("count error: table=%s err=%v", tableName, err)
+			return 0, requestError(http.StatusInternalServerError, "failed to count rows", err)
+		}
+		return n, nil
+	}
+
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s", db.QuoteTable(tableName), where)
+	if soft {
+		stmt = fmt.Sprintf(`UPDATE %s SET "%s" = CURRENT_TIMESTAMP WHERE %s`, db.QuoteTable(tableName), etl.DeletedAtColumn, where)
+	}
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to start transaction", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(stmt, args...)
+	if err != nil {
+		log.Printf("delete error: table=%s err=%v", tableName, err)
+		return 0, requestError(http.StatusInternalServerError, "failed to delete rows", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to delete rows", err)
+	}
+	if err := h.CDC.RecordDelete(tx, tableName, "api", req.Where, int(n)); err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to queue change capture", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to commit delete", err)
+	}
+	h.publishDelete(tableName, req.Where, n, soft)
+	return n, nil
+}
+
+// publishDelete announces committed deletes on the event broker, wakes
+// the change capture relay for them and takes them off the table's row
+// quota (soft deletes stay on it until they are purged)
+func (h *DataIngestHandler) publishDelete(tableName string, where map[string]interface{}, n int64, soft bool) {
+	if n == 0 {
+		return
+	}
+	h.CDC.Notify()
+	if !soft {
+		h.Quotas.Removed(tableName, int(n))
+	}
+	h.Events.Publish(events.Event{Type: events.RowsDeleted, Table: tableName, Data: map[string]interface{}{
+		"row_count": n,
+		"where":     where,
+	}})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /tables/:name/rows/:pk
+// Returns the row whose primary key is :pk, for record-detail views.
+// Tables with a composite primary key are read through /query instead.
+// A soft-deleted row is a 404 unless include_deleted=true.
+func (h *QueryHandler) GetRow(c *gin.Context) {
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return
+	}
+	row, err := h.Row(c.Param("name"), c.Param("pk"), includeDeleted)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"table": c.Param("name"),
+		"data":  row,
+	})
+}
+
+// Row reads the row of table whose single-column primary key equals pk,
+// unless it is soft-deleted and includeDeleted is false
+func (h *QueryHandler) Row(table, pk string, includeDeleted bool) (map[string]interface{}, error) {
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return nil, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+
+	reader := h.Reads.Reader()
+	cols, err := db.TableColumns(reader, table)
+	if err != nil {
+		return nil, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	if len(cols) == 0 {
+		return nil, requestError(http.StatusNotFound, "table not found", nil)
+	}
+	key, err := db.PrimaryKey(reader, table)
+	if err != nil {
+		log.Printf("primary key lookup error: table=%s err=%v", table, err)
+		return nil, requestError(http.StatusInternalServerError, "failed to load primary key", nil)
+	}
+	switch len(key) {
+	case 1:
+	case 0:
+		return nil, requestError(http.StatusBadRequest, "table has no primary key", nil)
+	default:
+		return nil, requestError(http.StatusBadRequest, "composite primary key",
+			fmt.Errorf("%s is keyed by (%s); use GET /query", table, strings.Join(key, ", ")))
+	}
+
+	// Bind integer keys as integers: not every driver converts text params
+	var arg interface{} = pk
+	for _, col := range cols {
+		if col.ColumnName == key[0] && isIntegerType(strings.ToLower(col.DataType)) {
+			n, err := strconv.ParseInt(pk, 10, 64)
+			if err != nil {
+				return nil, requestError(http.StatusBadRequest, "invalid primary key",
+					fmt.Errorf("%s is an integer column", key[0]))
+			}
+			arg = n
+		}
+	}
+
+	query := fmt.Sprintf(`SELECT * FROM %s WHERE %s = $1`, t.Quoted(), db.QuoteIdent(key[0]))
+	if !includeDeleted {
+		live, err := liveRows(reader, table)
+		if err != nil {
+			return nil, err
+		}
+		if live != "" {
+			query += " AND " + live
+		}
+	}
+	rows, err := reader.Queryx(query, arg)
+	if err != nil {
+		log.Printf("row lookup error: table=%s err=%v", table, err)
+		return nil, requestError(http.StatusInternalServerError, "failed to read row", nil)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			log.Printf("row lookup error: table=%s err=%v", table, err)
+			return nil, requestError(http.StatusInternalServerError, "failed to read row", nil)
+		}
+		return nil, requestError(http.StatusNotFound, "row not found", nil)
+	}
+	row := make(map[string]interface{})
+	if err := rows.MapScan(row); err != nil {
+		log.Printf("scan error: %v", err)
+		return nil, requestError(http.StatusInternalServerError, "failed to read row", nil)
+	}
+	return row, nil
+}
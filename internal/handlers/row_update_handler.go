@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateRowsRequest is the expected payload for PATCH /tables/:name/rows.
+// Exactly one of Key and Where selects the rows.
+type UpdateRowsRequest struct {
+	// Key holds a value for every primary key column and selects one row
+	Key map[string]interface{} `json:"key,omitempty"`
+
+	// Where maps columns to a value (equality; null = IS NULL) or to
+	// comparisons as in GraphQL: {"eq", "neq", "gt", "gte", "lt", "lte",
+	// "like", "in", "is_null"}. All conditions must hold.
+	Where map[string]interface{} `json:"where,omitempty"`
+
+	// Set maps columns to their new values
+	Set map[string]interface{} `json:"set"`
+
+	// IncludeDeleted also updates soft-deleted rows; they are left alone
+	// by default, and a key naming one is a 404
+	IncludeDeleted bool `json:"include_deleted,omitempty"`
+}
+
+// rowFilterOps are the comparisons accepted in a where filter
+var rowFilterOps = map[string]string{
+	"eq": "=", "neq": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=", "like": "LIKE",
+}
+
+// PATCH /tables/:name/rows
+// Sets columns of the rows matching a primary key or a structured filter.
+// Values are bound as parameters and checked against the column types;
+// the managed provenance columns cannot be set.
+func (h *DataIngestHandler) UpdateRows(c *gin.Context) {
+	tableName := c.Param("name")
+	if err := h.CheckTable(tableName); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var req UpdateRowsRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+		return
+	}
+
+	n, err := h.UpdateRowsIn(tableName, req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "rows updated",
+		"table_name": tableName,
+		"row_count":  n,
+	})
+}
+
+// UpdateRowsIn runs an update on a table already passed through
+// CheckTable and returns the number of rows changed. A key that matches
+// no row is a 404; a filter that matches none updates nothing.
+func (h *DataIngestHandler) UpdateRowsIn(tableName string, req UpdateRowsRequest) (int64, error) {
+	if len(req.Set) == 0 {
+		return 0, requestError(http.StatusBadRequest, "set is required", nil)
+	}
+	if (len(req.Key) == 0) == (len(req.Where) == 0) {
+		return 0, requestError(http.StatusBadRequest, "give either key or where", nil)
+	}
+
+	cols, err := db.TableColumns(h.DB, tableName)
+	if err != nil {
+		log.Printf("column lookup error: table=%s err=%v", tableName, err)
+		return 0, requestError(http.StatusInternalServerError, "failed to load table columns", nil)
+	}
+	types := make(map[string]string, len(cols))
+	for _, col := range cols {
+		types[col.ColumnName] = col.DataType
+	}
+
+	where := req.Where
+	if len(req.Key) > 0 {
+		if err := h.checkKey(tableName, req.Key); err != nil {
+			return 0, err
+		}
+		where = req.Key
+	}
+
+	var args []interface{}
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	allowed, err := etl.LoadAllowedValues(h.DB, tableName)
+	if err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to load allowed values", err)
+	}
+
+	assignments := make([]string, 0, len(req.Set))
+	values := make(map[string]interface{}, len(req.Set))
+	for _, col := range sortedKeys(req.Set) {
+		typ, ok := types[col]
+		if !ok {
+			return 0, requestError(http.StatusBadRequest, "invalid set", fmt.Errorf("unknown column %q", col))
+		}
+		if db.IsProvenanceColumn(col) {
+			return 0, requestError(http.StatusBadRequest, "invalid set", fmt.Errorf("%s is managed by godataflow", col))
+		}
+		v, err := columnValue(col, typ, req.Set[col])
+		if err != nil {
+			return 0, requestError(http.StatusBadRequest, "invalid set", err)
+		}
+		values[col] = v
+		assignments = append(assignments, fmt.Sprintf("%s = %s", db.QuoteIdent(col), bind(v)))
+	}
+	if col, err := allowed.Violation(values); err != nil {
+		return 0, requestError(http.StatusBadRequest, "value not allowed", fmt.Errorf("column %s: %w", col, err))
+	}
+
+	conds, err := rowConditions(where, types, bind)
+	if err != nil {
+		return 0, requestError(http.StatusBadRequest, "invalid where", err)
+	}
+	if !req.IncludeDeleted {
+		live, err := liveRows(h.DB, tableName)
+		if err != nil {
+			return 0, err
+		}
+		if live != "" {
+			conds = append(conds, live)
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", db.QuoteTable(tableName),
+		strings.Join(assignments, ", "), strings.Join(conds, " AND "))
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to start transaction", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		log.Printf("update error: table=%s err=%v", tableName, err)
+		return 0, requestError(http.StatusInternalServerError, "failed to update rows", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to update rows", err)
+	}
+	if n == 0 && len(req.Key) > 0 {
+		return 0, requestError(http.StatusNotFound, "row not found", nil)
+	}
+	if err := h.CDC.RecordUpdate(tx, tableName, "api", req.Set, where, int(n)); err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to queue change capture", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to commit update", err)
+	}
+	h.publishUpdate(tableName, req.Set, where, n)
+	return n, nil
+}
+
+// checkKey verifies key names exactly the table's primary key columns
+func (h *DataIngestHandler) checkKey(tableName string, key map[string]interface{}) error {
+	pk, err := db.PrimaryKey(h.DB, tableName)
+	if err != nil {
+		log.Printf("primary key lookup error: table=%s err=%v", tableName, err)
+		return requestError(http.StatusInternalServerError, "failed to load primary key", nil)
+	}
+	if len(pk) == 0 {
+		return requestError(http.StatusBadRequest, "table has no primary key", fmt.Errorf("select the rows with where"))
+	}
+	if len(key) != len(pk) {
+		return requestError(http.StatusBadRequest, "invalid key", fmt.Errorf("key needs exactly the primary key columns %s", strings.Join(pk, ", ")))
+	}
+	for _, col := range pk {
+		v, ok := key[col]
+		if !ok {
+			return requestError(http.StatusBadRequest, "invalid key", fmt.Errorf("key needs exactly the primary key columns %s", strings.Join(pk, ", ")))
+		}
+		if v == nil {
+			return requestError(http.StatusBadRequest, "invalid key", fmt.Errorf("%s cannot be null", col))
+		}
+	}
+	return nil
+}
+
+// rowConditions turns a where filter into SQL conditions. Column names
+// are checked against the table and quoted, and values go through bind,
+// so nothing from the request is spliced into the SQL.
+func rowConditions(where map[string]interface{}, types map[string]string, bind func(interface{}) string) ([]string, error) {
+	conds := []string{}
+	for _, col := range sortedKeys(where) {
+		typ, ok := types[col]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", col)
+		}
+		cmp, ok := where[col].(map[string]interface{})
+		if !ok {
+			cmp = map[string]interface{}{"eq": where[col]}
+		}
+		if len(cmp) == 0 {
+			return nil, fmt.Errorf("%s: no comparison given", col)
+		}
+		for _, op := range sortedKeys(cmp) {
+			v := cmp[op]
+			switch op {
+			case "is_null":
+				isNull, ok := v.(bool)
+				if !ok {
+					return nil, fmt.Errorf("%s: is_null takes true or false", col)
+				}
+				if isNull {
+					conds = append(conds, db.QuoteIdent(col)+" IS NULL")
+				} else {
+					conds = append(conds, db.QuoteIdent(col)+" IS NOT NULL")
+				}
+			case "in":
+				vals, ok := v.([]interface{})
+				if !ok || len(vals) == 0 {
+					return nil, fmt.Errorf("%s: in takes a non-empty array", col)
+				}
+				holders := make([]string, len(vals))
+				for i, iv := range vals {
+					iv, err := columnValue(col, typ, iv)
+					if err != nil {
+						return nil, err
+					}
+					holders[i] = bind(iv)
+				}
+				conds = append(conds, fmt.Sprintf("%s IN (%s)", db.QuoteIdent(col), strings.Join(holders, ", ")))
+			default:
+				sqlOp, ok := rowFilterOps[op]
+				if !ok {
+					return nil, fmt.Errorf("%s: unknown comparison %q", col, op)
+				}
+				if v == nil {
+					if op != "eq" {
+						return nil, fmt.Errorf("%s: %s cannot compare with null; use is_null", col, op)
+					}
+					conds = append(conds, db.QuoteIdent(col)+" IS NULL")
+					continue
+				}
+				v, err := columnValue(col, typ, v)
+				if err != nil {
+					return nil, err
+				}
+				conds = append(conds, fmt.Sprintf("%s %s %s", db.QuoteIdent(col), sqlOp, bind(v)))
+			}
+		}
+	}
+	return conds, nil
+}
+
+// columnValue checks v suits column col of type typ (as the catalog
+// names it) and converts it to a driver value; see convertValue
+func columnValue(col, typ string, v interface{}) (interface{}, error) {
+	out, err := convertValue(typ, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", col, err)
+	}
+	return out, nil
+}
+
+// convertValue checks v, decoded with json.Decoder.UseNumber, suits a
+// column of type typ and converts it to a driver value. JSON columns take
+// any value and store its encoding, array columns a list of values for
+// their element type; other columns take scalars only.
+func convertValue(typ string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	typ = strings.ToLower(typ)
+	if strings.Contains(typ, "json") {
+		raw, _ := json.Marshal(v)
+		return string(raw), nil
+	}
+	if db.IsArrayType(typ) {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("expected an array")
+		}
+		elems := make([]interface{}, len(list))
+		for i, elem := range list {
+			out, err := convertValue(db.ArrayElementType(typ), elem)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elems[i] = out
+		}
+		return db.Array(elems), nil
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil, errors.New("expected a single value, got an object or array")
+	case json.Number:
+		switch {
+		case strings.Contains(typ, "bool"):
+			return nil, fmt.Errorf("expected true or false, got %s", v)
+		case isIntegerType(typ):
+			n, err := v.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("expected an integer, got %s", v)
+			}
+			return n, nil
+		}
+		return v.String(), nil // exact, for numeric columns too
+	case bool:
+		if isIntegerType(typ) || isNumericType(typ) {
+			return nil, fmt.Errorf("expected a number, got %t", v)
+		}
+		return v, nil
+	case string:
+		switch {
+		case strings.Contains(typ, "bool"):
+			return nil, fmt.Errorf("expected true or false, got %q", v)
+		case isIntegerType(typ) || isNumericType(typ):
+			return nil, fmt.Errorf("expected a number, got %q", v)
+		}
+		return v, nil
+	}
+	return v, nil
+}
+
+// isIntegerType reports whether a catalog type holds integers
+func isIntegerType(typ string) bool {
+	return strings.Contains(typ, "int") && !strings.Contains(typ, "interval") || strings.Contains(typ, "serial")
+}
+
+// isNumericType reports whether a catalog type holds other numbers
+func isNumericType(typ string) bool {
+	for _, t := range []string{"numeric", "decimal", "real", "double", "float"} {
+		if strings.Contains(typ, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// publishUpdate announces committed updates on the event broker and
+// wakes the change capture relay for them
+func (h *DataIngestHandler) publishUpdate(tableName string, set, where map[string]interface{}, n int64) {
+	if n == 0 {
+		return
+	}
+	h.CDC.Notify()
+	h.Events.Publish(events.Event{Type: events.RowsUpdated, Table: tableName, Data: map[string]interface{}{
+		"row_count": n,
+		"set":       set,
+		"where":     where,
+	}})
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultSampleRows = 100
+	maxSampleRows     = 1000
+
+	// Postgres tables estimated at more than this many rows are sampled
+	// with TABLESAMPLE instead of sorting every row randomly
+	tableSampleMinRows = 100000
+)
+
+// Sampling methods
+const (
+	SampleRandom = "random" // uniformly random rows
+	SampleFirst  = "first"  // the first rows the database returns; cheapest
+)
+
+// GET /tables/:name/sample?n=100&method=random
+// Soft-deleted rows are left out unless include_deleted=true.
+func (h *QueryHandler) SampleTable(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", strconv.Itoa(defaultSampleRows)))
+	if err != nil || n <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "n must be a positive integer"})
+		return
+	}
+	if n > maxSampleRows {
+		n = maxSampleRows
+	}
+	method := c.DefaultQuery("method", SampleRandom)
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.Sample(c.Param("name"), n, method, includeDeleted)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"table":  c.Param("name"),
+		"method": method,
+		"count":  len(rows),
+		"data":   rows,
+	})
+}
+
+// Sample returns up to n rows of table picked by method. Random samples of
+// large Postgres tables read a TABLESAMPLE SYSTEM slice sized from the
+// planner's row estimate, falling back to a full random sort when the
+// slice comes up short. Soft-deleted rows are left out unless includeDeleted.
+func (h *QueryHandler) Sample(table string, n int, method string, includeDeleted bool) ([]map[string]interface{}, error) {
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return nil, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	if method != SampleRandom && method != SampleFirst {
+		return nil, requestError(http.StatusBadRequest, "invalid method",
+			fmt.Errorf("method must be %s or %s", SampleRandom, SampleFirst))
+	}
+
+	reader := h.Reads.Reader()
+	cols, err := db.TableColumns(reader, table)
+	if err != nil {
+		return nil, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	if len(cols) == 0 {
+		return nil, requestError(http.StatusNotFound, "table not found", nil)
+	}
+
+	where := ""
+	if !includeDeleted {
+		live, err := liveRows(reader, table)
+		if err != nil {
+			return nil, err
+		}
+		if live != "" {
+			where = " WHERE " + live
+		}
+	}
+
+	if method == SampleFirst {
+		return sampleRows(reader, fmt.Sprintf(`SELECT * FROM %s%s LIMIT %d`, t.Quoted(), where, n))
+	}
+
+	if db.DialectOf(reader) == db.Postgres {
+		var estimate float64
+		if err := reader.Get(&estimate, `SELECT reltuples FROM pg_class WHERE oid = $1::regclass`, t.String()); err != nil {
+			log.Printf("sample: row estimate for %s failed: %v", table, err)
+		} else if estimate > tableSampleMinRows {
+			// oversample 4x so clustering in the sampled pages still leaves n rows
+			pct := math.Min(100, float64(n)*4/estimate*100)
+			rows, err := sampleRows(reader, fmt.Sprintf(
+				`SELECT * FROM %s TABLESAMPLE SYSTEM (%f)%s ORDER BY random() LIMIT %d`, t.Quoted(), pct, where, n))
+			if err != nil || len(rows) == n {
+				return rows, err
+			}
+		}
+	}
+	return sampleRows(reader, fmt.Sprintf(`SELECT * FROM %s%s ORDER BY RANDOM() LIMIT %d`, t.Quoted(), where, n))
+}
+
+func sampleRows(reader *sqlx.DB, query string) ([]map[string]interface{}, error) {
+	rows, err := reader.Queryx(query)
+	if err != nil {
+		log.Printf("sample error: %v", err)
+		return nil, requestError(http.StatusInternalServerError, "failed to sample table", nil)
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			log.Printf("scan error: %v", err)
+			continue
+		}
+		results = append(results, row)
+	}
+	return results, nil
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/alkha0306/godataflow/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// SchedulerHandler pauses and resumes scheduled refreshes
+type SchedulerHandler struct {
+	Scheduler *scheduler.JobManager
+}
+
+func NewSchedulerHandler(sched *scheduler.JobManager) *SchedulerHandler {
+	return &SchedulerHandler{Scheduler: sched}
+}
+
+// POST /scheduler/pause
+// Maintenance mode: stops launching scheduled refreshes on every table
+// while runs already going finish; in_flight in the response drops to 0
+// once they have. Optional body {"reason": "..."}. Queued runs wait;
+// manual refreshes that are not queued, ingests and imports still run.
+// Pausing twice keeps the first pause.
+func (h *SchedulerHandler) Pause(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	changed := h.Scheduler.Pause(req.Reason)
+	c.JSON(http.StatusOK, gin.H{"changed": changed, "scheduler": h.Scheduler.Status()})
+}
+
+// POST /scheduler/resume
+// Ends maintenance mode; each table refreshes again on its next tick
+func (h *SchedulerHandler) Resume(c *gin.Context) {
+	changed := h.Scheduler.Resume()
+	c.JSON(http.StatusOK, gin.H{"changed": changed, "scheduler": h.Scheduler.Status()})
+}
+
+// GET /scheduler/queue
+// Jobs waiting for a worker or running, with the ones running first
+func (h *SchedulerHandler) Queue(c *gin.Context) {
+	jobs, err := h.Scheduler.Queue().List()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to list queued jobs", err))
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GET /scheduler
+// Whether scheduled refreshes are paused, and how many are in flight
+func (h *SchedulerHandler) Status(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Scheduler.Status())
+}
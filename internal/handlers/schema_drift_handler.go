@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/gin-gonic/gin"
+)
+
+type SchemaDriftHandler struct {
+	ETL *etl.ETLProcessor
+}
+
+func NewSchemaDriftHandler(etlProc *etl.ETLProcessor) *SchemaDriftHandler {
+	return &SchemaDriftHandler{ETL: etlProc}
+}
+
+// GET /tables/:name/schema-changes
+// Returns the source schema observed on the last refresh and the drift
+// recorded between refreshes, newest first. Optional query param: limit
+func (h *SchemaDriftHandler) Changes(c *gin.Context) {
+	table := c.Param("name")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	schema, err := h.ETL.LoadSourceSchema(table)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load source schema", "details": err.Error()})
+		return
+	}
+
+	changes, err := h.ETL.SchemaChanges(table, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load schema changes", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"table": table, "source_schema": schema, "changes": changes})
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/querylog"
+	"github.com/alkha0306/godataflow/internal/share"
+	"github.com/alkha0306/godataflow/internal/workspace"
+	"github.com/gin-gonic/gin"
+)
+
+// ShareHandler hands out signed links to saved query results and serves
+// them to anyone holding one, outside API key auth
+type ShareHandler struct {
+	Queries    *QueryTemplateHandler
+	Workspaces *workspace.Registry
+	Signer     *share.Signer
+	TTL        time.Duration // default link lifetime
+	MaxTTL     time.Duration
+	MaxRows    int // rows a link returns at most
+
+	// Proxies are the trusted reverse proxies; X-Forwarded-Proto is only
+	// believed from them
+	Proxies []netip.Prefix
+}
+
+func NewShareHandler(queries *QueryTemplateHandler, workspaces *workspace.Registry, signer *share.Signer, ttl, maxTTL time.Duration, maxRows int, trustedProxies []string) *ShareHandler {
+	return &ShareHandler{Queries: queries, Workspaces: workspaces, Signer: signer, TTL: ttl, MaxTTL: maxTTL, MaxRows: maxRows, Proxies: parsePrefixes(trustedProxies)}
+}
+
+// ShareRequest optionally sets how long the link works, e.g. "72h"
+type ShareRequest struct {
+	TTL string `json:"ttl"`
+}
+
+// POST /queries/:id/share
+func (h *ShareHandler) ShareQuery(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid query id", nil))
+		return
+	}
+	var req ShareRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+			return
+		}
+	}
+	ttl := h.TTL
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(c, requestError(http.StatusBadRequest, "ttl must be a positive duration, e.g. 72h", nil))
+			return
+		}
+		if ttl > h.MaxTTL {
+			writeError(c, requestError(http.StatusBadRequest, "ttl exceeds sharing.max_ttl ("+h.MaxTTL.String()+")", nil))
+			return
+		}
+	}
+
+	ws := currentWorkspace(c)
+	var exists int
+	err = h.Queries.DB.Get(&exists, "SELECT COUNT(*) FROM saved_queries WHERE id = $1 AND "+workspaceCond(ws, 2),
+		append([]interface{}{id}, workspaceArgs(ws)...)...)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to look up query", err))
+		return
+	}
+	if exists == 0 {
+		writeError(c, requestError(http.StatusNotFound, "query not found", nil))
+		return
+	}
+
+	link := share.Link{QueryID: id, ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second)}
+	if ws != nil {
+		link.Workspace = ws.Name
+	}
+	token, err := h.Signer.Sign(link)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to sign link", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"query_id":   id,
+		"token":      token,
+		"url":        h.baseURL(c) + "/shared/" + token,
+		"expires_at": link.ExpiresAt,
+	})
+}
+
+// GET /shared/:token
+// Read-only: the token only grants running the one query it was issued for,
+// in a read-only transaction. At most MaxRows rows are returned; "truncated"
+// tells when the query had more.
+func (h *ShareHandler) OpenShared(c *gin.Context) {
+	token := c.Param("token")
+	link, err := h.Signer.Verify(token)
+	switch {
+	case errors.Is(err, share.ErrExpired):
+		writeError(c, requestError(http.StatusGone, "share link expired", nil))
+		return
+	case err != nil:
+		writeError(c, requestError(http.StatusNotFound, "share link not found", nil))
+		return
+	}
+	if wait, err := h.Signer.Allow(token); err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(c, requestError(http.StatusTooManyRequests, "rate limit exceeded", err))
+		return
+	}
+
+	var ws *workspace.Workspace
+	if link.Workspace != "" {
+		if ws, err = h.Workspaces.Get(link.Workspace); err != nil {
+			// the workspace is gone, and its queries with it
+			writeError(c, requestError(http.StatusNotFound, "query not found", nil))
+			return
+		}
+	}
+	started := time.Now()
+	results, sqlText, err := h.Queries.run(c.Request.Context(), ws, link.QueryID, h.MaxRows+1)
+	if sqlText != "" {
+		entry := querylog.Entry{Kind: querylog.KindShared, Caller: "share:" + fingerprint(token), QueryID: &link.QueryID, Statement: sqlText}
+		if ws != nil {
+			entry.Workspace = &ws.Name
+		}
+		auditQuery(c, h.Queries.Log, entry, started, len(results), err)
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	truncated := len(results) > h.MaxRows
+	if truncated {
+		results = results[:h.MaxRows]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         link.QueryID,
+		"result":     results,
+		"truncated":  truncated,
+		"expires_at": link.ExpiresAt,
+	})
+}
+
+// baseURL is the scheme and host the caller reached the server at.
+// X-Forwarded-Proto counts only when a trusted proxy sent the request.
+func (h *ShareHandler) baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); (proto == "http" || proto == "https") && h.fromProxy(c) {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// fromProxy reports whether the request's peer is a trusted proxy
+func (h *ShareHandler) fromProxy(c *gin.Context) bool {
+	addr, err := netip.ParseAddr(c.RemoteIP())
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range h.Proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefixes reads IPs and CIDRs, as config validation has checked
+// them; an IP becomes a single-address prefix
+func parsePrefixes(list []string) []netip.Prefix {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if addr, err := netip.ParseAddr(s); err == nil {
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else if p, err := netip.ParsePrefix(s); err == nil {
+			out = append(out, p.Masked())
+		}
+	}
+	return out
+}
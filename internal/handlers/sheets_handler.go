@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/sheets"
+	"github.com/alkha0306/godataflow/internal/workspace"
+	"github.com/gin-gonic/gin"
+)
+
+// SheetsHandler writes saved query results and table extracts to Google Sheets
+type SheetsHandler struct {
+	Reads  *db.ReadRouter
+	Sheets *sheets.Client // nil when sheets export is not configured
+}
+
+func NewSheetsHandler(reads *db.ReadRouter, client *sheets.Client) *SheetsHandler {
+	return &SheetsHandler{Reads: reads, Sheets: client}
+}
+
+// SheetsExportRequest is the payload for the Google Sheets export endpoints
+type SheetsExportRequest struct {
+	SpreadsheetID string `json:"spreadsheet_id" binding:"required"` // from the sheet's URL
+	Sheet         string `json:"sheet"`                             // tab name; defaults to the query or table name
+	Filter        string `json:"filter"`                            // table export only, as in /query
+	Limit         int    `json:"limit"`                             // table export only; 0 = sheets.max_rows
+}
+
+// POST /queries/:id/sheets
+// Runs a saved query and replaces the contents of the sheet with its results
+func (h *SheetsHandler) ExportSavedQuery(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid query id", nil))
+		return
+	}
+	var req SheetsExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+
+	reader := h.Reads.Reader()
+	ws := currentWorkspace(c)
+	var saved struct {
+		Name    string `db:"name"`
+		SQLText string `db:"sql_text"`
+	}
+	err = reader.Get(&saved, "SELECT name, sql_text FROM saved_queries WHERE id = $1 AND "+workspaceCond(ws, 2),
+		append([]interface{}{id}, workspaceArgs(ws)...)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(c, requestError(http.StatusNotFound, "query not found", nil))
+		return
+	}
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to load query", err))
+		return
+	}
+	if req.Sheet == "" {
+		req.Sheet = saved.Name
+	}
+
+	rows, err := ws.Query(c.Request.Context(), reader, saved.SQLText)
+	if err != nil {
+		log.Printf("execution error: %v", err)
+		writeError(c, requestError(http.StatusInternalServerError, "failed to run query", nil))
+		return
+	}
+	h.write(c, req, rows)
+}
+
+// POST /tables/:name/export/sheets
+// Replaces the contents of the sheet with the table's rows, optionally
+// filtered and limited like GET /query
+func (h *SheetsHandler) ExportTable(c *gin.Context) {
+	table := c.Param("name")
+	var req SheetsExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid table name", err))
+		return
+	}
+	if req.Limit < 0 {
+		writeError(c, requestError(http.StatusBadRequest, "limit must be a non-negative integer", nil))
+		return
+	}
+	if req.Sheet == "" {
+		req.Sheet = table
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s", t.Quoted())
+	if req.Filter != "" {
+		query += fmt.Sprintf(" WHERE %s", req.Filter)
+	}
+	if req.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", req.Limit)
+	}
+	rows, err := currentWorkspace(c).Query(c.Request.Context(), h.Reads.Reader(), query)
+	if err != nil {
+		log.Printf("query error: %v", err)
+		writeError(c, requestError(http.StatusInternalServerError, "failed to execute query", nil))
+		return
+	}
+	h.write(c, req, rows)
+}
+
+// write reads rows (closing them) and sends them to the sheet
+func (h *SheetsHandler) write(c *gin.Context, req SheetsExportRequest, rows *workspace.Rows) {
+	if h.Sheets == nil {
+		rows.Close()
+		writeError(c, requestError(http.StatusServiceUnavailable, "google sheets export is not configured", sheets.ErrNotConfigured))
+		return
+	}
+
+	header, values, err := sheetValues(rows, h.Sheets.MaxRows)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to read results", err))
+		return
+	}
+	res, err := h.Sheets.Write(c.Request.Context(), req.SpreadsheetID, req.Sheet, header, values)
+	switch {
+	case errors.Is(err, sheets.ErrInvalid):
+		writeError(c, requestError(http.StatusBadRequest, "invalid sheets export", err))
+	case err != nil:
+		writeError(c, requestError(http.StatusBadGateway, "google sheets export failed", err))
+	default:
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// sheetValues reads the column names and cell values of rows. Reading
+// stops one row past max (when set) so the client can report the overflow
+// without buffering the whole result.
+func sheetValues(rows *workspace.Rows, max int) ([]string, [][]interface{}, error) {
+	defer rows.Close()
+	header, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	values := [][]interface{}{}
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, v := range row {
+			switch t := v.(type) {
+			case nil:
+				row[i] = ""
+			case []byte:
+				row[i] = string(t)
+			case time.Time:
+				row[i] = t.UTC().Format(time.RFC3339)
+			}
+		}
+		values = append(values, row)
+		if max > 0 && len(values) > max {
+			break
+		}
+	}
+	return header, values, rows.Err()
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/sink"
+	"github.com/gin-gonic/gin"
+)
+
+type SinkHandler struct {
+	Exporter *sink.Exporter
+}
+
+func NewSinkHandler(exporter *sink.Exporter) *SinkHandler {
+	return &SinkHandler{Exporter: exporter}
+}
+
+// CreateSinkRequest is the payload for POST /tables/:name/sinks
+type CreateSinkRequest struct {
+	URL          string `json:"url" binding:"required"` // s3://bucket/prefix, gs://bucket/prefix or file:///dir
+	Format       string `json:"format"`                 // csv (default), ndjson, parquet or arrow
+	CursorColumn string `json:"cursor_column"`          // defaults to _ingested_at on provenance tables
+	Enabled      *bool  `json:"enabled"`                // defaults to true
+}
+
+// GET /tables/:name/sinks
+func (h *SinkHandler) ListSinks(c *gin.Context) {
+	sinks, err := h.Exporter.List(c.Param("name"))
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to list sinks", err))
+		return
+	}
+	c.JSON(http.StatusOK, sinks)
+}
+
+// POST /tables/:name/sinks
+// Adds an export sink; it runs after every successful refresh that loaded
+// new data, starting with all rows currently in the table
+func (h *SinkHandler) CreateSink(c *gin.Context) {
+	var req CreateSinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	// file sinks write to the server's disk, which workspaces share
+	if currentWorkspace(c) != nil && strings.HasPrefix(strings.ToLower(req.URL), "file:") {
+		writeError(c, requestError(http.StatusForbidden, "file:// sinks are not available to workspace API keys", nil))
+		return
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	s, err := h.Exporter.Create(c.Param("name"), sink.Sink{
+		URL:          req.URL,
+		Format:       req.Format,
+		CursorColumn: req.CursorColumn,
+		Enabled:      enabled,
+	})
+	if err != nil {
+		writeError(c, sinkError(err, "failed to create sink"))
+		return
+	}
+	c.JSON(http.StatusCreated, s)
+}
+
+// DELETE /tables/:name/sinks/:id
+// Objects already exported are left in place
+func (h *SinkHandler) DeleteSink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid sink id", nil))
+		return
+	}
+	if err := h.Exporter.Delete(c.Param("name"), id); err != nil {
+		writeError(c, sinkError(err, "failed to delete sink"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "sink deleted"})
+}
+
+// POST /tables/:name/sinks/:id/run
+// Exports the rows past the sink's cursor now, even if the sink is disabled
+func (h *SinkHandler) RunSink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid sink id", nil))
+		return
+	}
+	s, err := h.Exporter.Get(c.Param("name"), id)
+	if err != nil {
+		writeError(c, sinkError(err, "failed to load sink"))
+		return
+	}
+
+	res := h.Exporter.Run(s)
+	switch {
+	case res.Skipped:
+		writeError(c, requestError(http.StatusConflict, "sink is already running", nil))
+	case res.Error != "":
+		writeError(c, requestError(http.StatusBadGateway, "export failed", errors.New(res.Error)))
+	default:
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// sinkError maps sink package errors to responses
+func sinkError(err error, msg string) error {
+	switch {
+	case errors.Is(err, sink.ErrNotFound):
+		return requestError(http.StatusNotFound, "not found", err)
+	case errors.Is(err, sink.ErrInvalid):
+		return requestError(http.StatusBadRequest, "invalid sink", err)
+	}
+	return requestError(http.StatusInternalServerError, msg, err)
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/quota"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// SnapshotHandler manages point-in-time copies of tables. A snapshot is a
+// registered table with snapshot_of pointing at its source; it is read-only
+// (ingest and config updates are refused) until dropped.
+type SnapshotHandler struct {
+	DB     *sqlx.DB
+	Events *events.Broker
+	Quotas *quota.Enforcer // snapshots count as tables; nil = no quotas
+}
+
+func NewSnapshotHandler(db *sqlx.DB, broker *events.Broker, quotas *quota.Enforcer) *SnapshotHandler {
+	return &SnapshotHandler{DB: db, Events: broker, Quotas: quotas}
+}
+
+// Snapshot is a snapshot's entry in GET /tables/:name/snapshots
+type Snapshot struct {
+	TableName  string    `db:"table_name" json:"table_name"`
+	SnapshotOf string    `db:"snapshot_of" json:"snapshot_of"`
+	SnapshotAt time.Time `db:"snapshot_at" json:"snapshot_at"`
+}
+
+// CreateSnapshotRequest is the optional payload for POST /tables/:name/snapshot
+type CreateSnapshotRequest struct {
+	Name string `json:"name,omitempty"` // defaults to <table>_snap_<UTC timestamp>, in the table's schema
+}
+
+// POST /tables/:name/snapshot
+func (h *SnapshotHandler) CreateSnapshot(c *gin.Context) {
+	var req CreateSnapshotRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "details": err.Error()})
+			return
+		}
+	}
+	if req.Name != "" {
+		var err error
+		if req.Name, err = currentWorkspace(c).Qualify(req.Name); err != nil {
+			writeError(c, workspaceError(err, "invalid snapshot name"))
+			return
+		}
+	}
+	snap, err := h.Create(c.Param("name"), req.Name)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, snap)
+}
+
+// Create copies table into a new snapshot table and registers it
+func (h *SnapshotHandler) Create(table, name string) (Snapshot, error) {
+	src, err := db.ParseTableName(table)
+	if err != nil {
+		return Snapshot{}, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	var meta struct {
+		TableType  string  `db:"table_type"`
+		SnapshotOf *string `db:"snapshot_of"`
+	}
+	err = h.DB.Get(&meta, `SELECT table_type, snapshot_of FROM table_metadata WHERE table_name = $1`, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Snapshot{}, requestError(http.StatusNotFound, "table not found", nil)
+	}
+	if err != nil {
+		return Snapshot{}, requestError(http.StatusInternalServerError, "failed to load table", err)
+	}
+	if meta.SnapshotOf != nil {
+		return Snapshot{}, requestError(http.StatusConflict, "cannot snapshot a snapshot", nil)
+	}
+
+	now := time.Now().UTC()
+	dst := db.TableName{Schema: src.Schema, Name: fmt.Sprintf("%s_snap_%s", src.Name, now.Format("20060102150405"))}
+	if name != "" {
+		if dst, err = db.ParseTableName(name); err != nil {
+			return Snapshot{}, requestError(http.StatusBadRequest, "invalid snapshot name", err)
+		}
+		if dst.Schema == "" {
+			dst.Schema = src.Schema
+		}
+	}
+	cols, err := db.TableColumns(h.DB, dst.String())
+	if err != nil {
+		return Snapshot{}, requestError(http.StatusBadRequest, "invalid snapshot name", err)
+	}
+	if len(cols) > 0 {
+		return Snapshot{}, requestError(http.StatusConflict, "table already exists", fmt.Errorf("%s", dst))
+	}
+	if err := h.Quotas.CheckCreate(h.DB, dst.String()); err != nil {
+		return Snapshot{}, quotaError(err, "failed to check quota")
+	}
+	if cols, err = db.TableColumns(h.DB, table); err != nil {
+		return Snapshot{}, requestError(http.StatusInternalServerError, "failed to load table columns", err)
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return Snapshot{}, requestError(http.StatusInternalServerError, "failed to create snapshot", err)
+	}
+	defer tx.Rollback()
+
+	if err := copyTable(tx, db.DialectOf(h.DB), src, dst, cols); err != nil {
+		log.Printf("snapshot error: table=%s err=%v", table, err)
+		return Snapshot{}, requestError(http.StatusInternalServerError, "failed to create snapshot", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO table_metadata (table_name, table_type, snapshot_of, snapshot_at)
+		VALUES ($1, $2, $3, $4)`, dst.String(), meta.TableType, table, now)
+	if err != nil {
+		return Snapshot{}, requestError(http.StatusInternalServerError, "failed to register snapshot", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Snapshot{}, requestError(http.StatusInternalServerError, "failed to create snapshot", err)
+	}
+
+	h.Events.Publish(events.Event{Type: events.TableCreated, Table: dst.String(), Message: "snapshot of " + table})
+	return Snapshot{TableName: dst.String(), SnapshotOf: table, SnapshotAt: now}, nil
+}
+
+// copyTable creates dst as a copy of src. Postgres keeps the exact column
+// types with CREATE TABLE AS; SQLite would reduce them to affinities, so
+// there the columns are declared from src first.
+func copyTable(tx *sqlx.Tx, dialect db.Dialect, src, dst db.TableName, cols []db.Column) error {
+	if dialect != db.SQLite {
+		_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s AS SELECT * FROM %s`, dst.Quoted(), src.Quoted()))
+		return err
+	}
+	defs := make([]string, len(cols))
+	for i, c := range cols {
+		defs[i] = fmt.Sprintf(`"%s" %s`, c.ColumnName, c.DataType)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s (%s)`, dst.Quoted(), strings.Join(defs, ", "))); err != nil {
+		return err
+	}
+	_, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s`, dst.Quoted(), src.Quoted()))
+	return err
+}
+
+// GET /tables/:name/snapshots
+// Lists the table's snapshots, newest first
+func (h *SnapshotHandler) ListSnapshots(c *gin.Context) {
+	table := c.Param("name")
+	var exists bool
+	if err := h.DB.Get(&exists, `SELECT EXISTS (SELECT 1 FROM table_metadata WHERE table_name = $1)`, table); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load table", "details": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "table not found"})
+		return
+	}
+
+	snaps := []Snapshot{}
+	err := h.DB.Select(&snaps, `
+		SELECT table_name, snapshot_of, snapshot_at FROM table_metadata
+		WHERE snapshot_of = $1
+		ORDER BY snapshot_at DESC, id DESC`, table)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list snapshots", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"table": table, "snapshots": snaps})
+}
+
+// POST /tables/:name/snapshots/:snapshot/restore
+// Replaces the table's rows with the snapshot's, in one transaction.
+// Columns added to the table since the snapshot are left NULL.
+func (h *SnapshotHandler) RestoreSnapshot(c *gin.Context) {
+	table, snapshot := c.Param("name"), c.Param("snapshot")
+	dst, src, err := h.lookup(table, snapshot)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	tableCols, err := db.TableColumns(h.DB, table)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to load table columns", err))
+		return
+	}
+	snapCols, err := db.TableColumns(h.DB, snapshot)
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to load snapshot columns", err))
+		return
+	}
+	inSnapshot := map[string]bool{}
+	for _, col := range snapCols {
+		inSnapshot[col.ColumnName] = true
+	}
+	common := []string{}
+	for _, col := range tableCols {
+		if inSnapshot[col.ColumnName] {
+			common = append(common, `"`+col.ColumnName+`"`)
+		}
+	}
+	if len(common) == 0 {
+		writeError(c, requestError(http.StatusConflict, "snapshot shares no columns with the table", nil))
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to restore snapshot", err))
+		return
+	}
+	defer tx.Rollback()
+
+	deleted, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s`, dst.Quoted()))
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to restore snapshot", err))
+		return
+	}
+	colList := strings.Join(common, ", ")
+	inserted, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, dst.Quoted(), colList, colList, src.Quoted()))
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to restore snapshot", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to restore snapshot", err))
+		return
+	}
+
+	removed, _ := deleted.RowsAffected()
+	restored, _ := inserted.RowsAffected()
+	log.Printf("[snapshot] restored %s from %s (%d rows replaced by %d)", table, snapshot, removed, restored)
+	c.JSON(http.StatusOK, gin.H{
+		"table":         table,
+		"snapshot":      snapshot,
+		"deleted_rows":  removed,
+		"restored_rows": restored,
+	})
+}
+
+// DELETE /tables/:name/snapshots/:snapshot
+func (h *SnapshotHandler) DropSnapshot(c *gin.Context) {
+	table, snapshot := c.Param("name"), c.Param("snapshot")
+	_, src, err := h.lookup(table, snapshot)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to drop snapshot", err))
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, src.Quoted())); err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to drop snapshot", err))
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM table_metadata WHERE table_name = $1`, snapshot); err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to drop snapshot", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to drop snapshot", err))
+		return
+	}
+
+	h.Events.Publish(events.Event{Type: events.TableDeleted, Table: snapshot})
+	c.JSON(http.StatusOK, gin.H{"message": "snapshot dropped", "table": table, "snapshot": snapshot})
+}
+
+// lookup validates that snapshot is a snapshot of table
+func (h *SnapshotHandler) lookup(table, snapshot string) (db.TableName, db.TableName, error) {
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return t, t, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	s, err := db.ParseTableName(snapshot)
+	if err != nil {
+		return t, s, requestError(http.StatusBadRequest, "invalid snapshot name", err)
+	}
+	var of *string
+	err = h.DB.Get(&of, `SELECT snapshot_of FROM table_metadata WHERE table_name = $1`, snapshot)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (of == nil || *of != table)) {
+		return t, s, requestError(http.StatusNotFound, "snapshot not found",
+			fmt.Errorf("%s is not a snapshot of %s", snapshot, table))
+	}
+	if err != nil {
+		return t, s, requestError(http.StatusInternalServerError, "failed to load snapshot", err)
+	}
+	return t, s, nil
+}
+
+// checkWritable refuses writes to snapshot and replica tables
+func checkWritable(q sqlx.Queryer, table string) error {
+	var of *string
+	err := sqlx.Get(q, &of, `SELECT snapshot_of FROM table_metadata WHERE table_name = $1`, table)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return requestError(http.StatusInternalServerError, "failed to check metadata", err)
+	}
+	if of != nil {
+		return requestError(http.StatusConflict, "snapshots are read-only",
+			fmt.Errorf("%s is a snapshot of %s", table, *of))
+	}
+	var source struct {
+		URL   string `db:"source_url"`
+		Table string `db:"source_table"`
+	}
+	err = sqlx.Get(q, &source, `SELECT source_url, source_table FROM table_replicas WHERE table_name = $1`, table)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return requestError(http.StatusInternalServerError, "failed to check metadata", err)
+	}
+	if err == nil {
+		return requestError(http.StatusConflict, "replicas are read-only",
+			fmt.Errorf("%s replicates %s from %s; unsubscribe with DELETE /replicas/%s first", table, source.Table, source.URL, table))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/ingeststats"
+	"github.com/alkha0306/godataflow/internal/scheduler"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type StatsHandler struct {
+	DB        *sqlx.DB
+	Scheduler *scheduler.JobManager
+	Ingests   *ingeststats.Recorder // rows written through the ingest API
+}
+
+func NewStatsHandler(db *sqlx.DB, sched *scheduler.JobManager, ingests *ingeststats.Recorder) *StatsHandler {
+	return &StatsHandler{DB: db, Scheduler: sched, Ingests: ingests}
+}
+
+// RecentError is a trimmed refresh_logs entry for the summary view
+type RecentError struct {
+	TableName string    `db:"table_name" json:"table_name"`
+	Message   string    `db:"message" json:"message"`
+	ErrorCode *string   `db:"error_code" json:"error_code,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// GET /stats/summary
+// Single call a status page can render: counts, failing tables, recent errors and DB size.
+func (h *StatsHandler) Summary(c *gin.Context) {
+	var totalTables int
+	if err := h.DB.Get(&totalTables, `SELECT COUNT(*) FROM table_metadata`); err != nil {
+		log.Printf("stats: count tables error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count tables"})
+		return
+	}
+
+	// rows inserted by refreshes and through the ingest API (/ingest,
+	// /upsert, ingest jobs, gRPC) since midnight (server time)
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var rowsToday int64
+	if err := h.DB.Get(&rowsToday,
+		`SELECT COALESCE(SUM(rows_inserted), 0) FROM refresh_logs WHERE status IN ('OK', 'WARN') AND created_at >= $1`,
+		midnight,
+	); err != nil {
+		log.Printf("stats: rows today error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count ingested rows"})
+		return
+	}
+	ingested, err := h.Ingests.Rows(midnight)
+	if err != nil {
+		log.Printf("stats: ingested rows today error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count ingested rows"})
+		return
+	}
+	rowsToday += ingested
+
+	failingTables := []string{}
+	if err := h.DB.Select(&failingTables,
+		`SELECT table_name FROM table_metadata WHERE status = 'ERROR' ORDER BY table_name ASC`,
+	); err != nil {
+		log.Printf("stats: failing tables error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load failing tables"})
+		return
+	}
+
+	// tables whose last refresh loaded an anomalous number of rows
+	warningTables := []string{}
+	if err := h.DB.Select(&warningTables,
+		`SELECT table_name FROM table_metadata WHERE status = 'WARN' ORDER BY table_name ASC`,
+	); err != nil {
+		log.Printf("stats: warning tables error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load warning tables"})
+		return
+	}
+
+	recentErrors := []RecentError{}
+	if err := h.DB.Select(&recentErrors,
+		`SELECT table_name, COALESCE(message, '') AS message, error_code, created_at
+		 FROM refresh_logs
+		 WHERE status = 'ERROR'
+		 ORDER BY created_at DESC
+		 LIMIT 10`,
+	); err != nil {
+		log.Printf("stats: recent errors error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load recent errors"})
+		return
+	}
+
+	sizeQuery := `SELECT pg_database_size(current_database())`
+	if db.DialectOf(h.DB) == db.SQLite {
+		sizeQuery = `SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`
+	}
+	var dbSize int64
+	if err := h.DB.Get(&dbSize, sizeQuery); err != nil {
+		log.Printf("stats: db size error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read database size"})
+		return
+	}
+
+	activeJobs := 0
+	if h.Scheduler != nil {
+		activeJobs = h.Scheduler.ActiveJobs()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total_tables":        totalTables,
+		"rows_ingested_today": rowsToday,
+		"active_jobs":         activeJobs,
+		"failing_tables":      failingTables,
+		"warning_tables":      warningTables,
+		"recent_errors":       recentErrors,
+		"db_size_bytes":       dbSize,
+		"db_size":             prettyBytes(dbSize),
+	})
+}
+
+// prettyBytes formats a byte count like pg_size_pretty (e.g. "12 MB")
+func prettyBytes(n int64) string {
+	const unit = 1024
+	if n < 10*unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	units := []string{"kB", "MB", "GB", "TB"}
+	v := float64(n) / unit
+	i := 0
+	for v >= 10*unit && i < len(units)-1 {
+		v /= unit
+		i++
+	}
+	return fmt.Sprintf("%.0f %s", v, units[i])
+}
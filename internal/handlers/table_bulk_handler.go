@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-yaml"
+)
+
+// maxManifestBytes bounds a POST /tables/bulk body
+const maxManifestBytes = 4 << 20
+
+// TableSpec is one table in a bulk manifest: the POST /tables fields plus
+// optional refresh settings from PUT /tables/:name/config
+type TableSpec struct {
+	CreateTableRequest
+	DataSourceURL   *string         `json:"data_source_url,omitempty"`
+	MappingJSON     json.RawMessage `json:"mapping_json,omitempty"`
+	WatermarkColumn *string         `json:"watermark_column,omitempty"`
+}
+
+// BulkTableResult reports what happened to one spec of a bulk request
+type BulkTableResult struct {
+	TableName string         `json:"table_name"`
+	Status    string         `json:"status"` // "created" or "exists"
+	Table     *TableMetadata `json:"table,omitempty"`
+}
+
+// POST /tables/bulk
+// Body is a JSON or YAML (Content-Type application/yaml) manifest: either a
+// list of table specs or {"tables": [...]}. All new tables are created in one
+// transaction; tables that are already registered are left alone and reported
+// as "exists", so the same manifest can be applied repeatedly.
+func (h *TableHandler) CreateTablesBulk(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxManifestBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body", "details": err.Error()})
+		return
+	}
+	if len(body) > maxManifestBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "manifest too large", "details": fmt.Sprintf("limit is %d bytes", maxManifestBytes)})
+		return
+	}
+
+	specs, err := parseManifest(c.GetHeader("Content-Type"), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid manifest", "details": err.Error()})
+		return
+	}
+	ws := currentWorkspace(c)
+	for i := range specs {
+		if specs[i].TableName, err = ws.Qualify(specs[i].TableName); err != nil {
+			writeError(c, workspaceError(err, "invalid table name"))
+			return
+		}
+	}
+
+	results, err := h.CreateBulk(specs)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	created := 0
+	for _, r := range results {
+		if r.Status == "created" {
+			created++
+		}
+	}
+	status := http.StatusOK
+	if created > 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{
+		"created":  created,
+		"existing": len(results) - created,
+		"tables":   results,
+	})
+}
+
+// parseManifest decodes a bulk body; YAML is converted to JSON first so both
+// formats share the JSON field names
+func parseManifest(contentType string, body []byte) ([]TableSpec, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		converted, err := yaml.YAMLToJSON(body)
+		if err != nil {
+			return nil, err
+		}
+		body = converted
+	}
+
+	var specs []TableSpec
+	if err := json.Unmarshal(body, &specs); err != nil {
+		var wrapped struct {
+			Tables []TableSpec `json:"tables"`
+		}
+		if err2 := json.Unmarshal(body, &wrapped); err2 != nil {
+			return nil, err
+		}
+		specs = wrapped.Tables
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("manifest defines no tables")
+	}
+	return specs, nil
+}
+
+// CreateBulk creates every spec whose table isn't registered yet, all in one
+// transaction: if any table fails, none are created
+func (h *TableHandler) CreateBulk(specs []TableSpec) ([]BulkTableResult, error) {
+	seen := make(map[string]bool, len(specs))
+	for i, s := range specs {
+		if s.TableName == "" || s.TableType == "" {
+			return nil, requestError(http.StatusBadRequest, fmt.Sprintf("table %d: table_name and table_type are required", i+1), nil)
+		}
+		if seen[s.TableName] {
+			return nil, requestError(http.StatusBadRequest, fmt.Sprintf("table '%s' appears more than once", s.TableName), nil)
+		}
+		seen[s.TableName] = true
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]BulkTableResult, 0, len(specs))
+	for _, s := range specs {
+		var exists bool
+		if err := tx.Get(&exists, `SELECT EXISTS (SELECT 1 FROM table_metadata WHERE table_name = $1)`, s.TableName); err != nil {
+			return nil, requestError(http.StatusInternalServerError, "failed to check metadata", err)
+		}
+		if exists {
+			results = append(results, BulkTableResult{TableName: s.TableName, Status: "exists"})
+			continue
+		}
+
+		meta, err := h.create(tx, s.CreateTableRequest)
+		if err != nil {
+			if re, ok := err.(*RequestError); ok {
+				re.Message = fmt.Sprintf("%s: %s", s.TableName, re.Message)
+			}
+			return nil, err
+		}
+
+		if s.DataSourceURL != nil || s.MappingJSON != nil || s.WatermarkColumn != nil {
+			meta.DataSourceURL = s.DataSourceURL
+			meta.WatermarkColumn = s.WatermarkColumn
+			if s.MappingJSON != nil {
+				meta.MappingJSON = &s.MappingJSON
+			}
+			_, err := tx.Exec(`
+				UPDATE table_metadata
+				SET data_source_url = $1, mapping_json = $2, watermark_column = $3
+				WHERE table_name = $4`,
+				s.DataSourceURL, s.MappingJSON, s.WatermarkColumn, meta.TableName)
+			if err != nil {
+				return nil, requestError(http.StatusInternalServerError, fmt.Sprintf("%s: failed to save config", s.TableName), err)
+			}
+		}
+		results = append(results, BulkTableResult{TableName: meta.TableName, Status: "created", Table: &meta})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to commit tables", err)
+	}
+
+	for _, r := range results {
+		if r.Status == "created" {
+			h.Events.Publish(events.Event{Type: events.TableCreated, Table: r.TableName})
+			h.queueFirstRefresh(r.TableName)
+		}
+	}
+	return results, nil
+}
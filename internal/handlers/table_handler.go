@@ -1,56 +1,156 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/geo"
+	"github.com/alkha0306/godataflow/internal/quality"
+	"github.com/alkha0306/godataflow/internal/quota"
+	"github.com/alkha0306/godataflow/internal/scheduler"
+	"github.com/alkha0306/godataflow/internal/workspace"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
 type TableHandler struct {
-	DB *sqlx.DB
+	DB     *sqlx.DB
+	Events *events.Broker
+	Quotas *quota.Enforcer  // nil = no quotas
+	Queue  *scheduler.Queue // nil = the scheduler is off
 }
 
 // TableMetadata represents a record in table_metadata
 type TableMetadata struct {
-	ID                 int              `db:"id" json:"id"`
-	TableName          string           `db:"table_name" json:"table_name"`
-	TableType          string           `db:"table_type" json:"table_type"`
-	RefreshInterval    *int             `db:"refresh_interval" json:"refresh_interval,omitempty"`
-	DataSourceURL      *string          `db:"data_source_url" json:"data_source_url,omitempty"`
-	LastRefreshSuccess *time.Time       `db:"last_refresh_success" json:"last_refresh_success,omitempty"`
-	LastRefreshError   *string          `db:"last_refresh_error" json:"last_refresh_error,omitempty"`
-	Status             string           `db:"status" json:"status"`
-	MappingJSON        *json.RawMessage `db:"mapping_json" json:"mapping_json,omitempty"`
-	CreatedAt          time.Time        `db:"created_at" json:"created_at"`
-	UpdatedAt          time.Time        `db:"updated_at" json:"updated_at"`
+	ID                  int              `db:"id" json:"id"`
+	TableName           string           `db:"table_name" json:"table_name"`
+	TableType           string           `db:"table_type" json:"table_type"`
+	RefreshInterval     *int             `db:"refresh_interval" json:"refresh_interval,omitempty"`
+	DataSourceURL       *string          `db:"data_source_url" json:"data_source_url,omitempty"`
+	DataSources         *json.RawMessage `db:"data_sources" json:"data_sources,omitempty"`
+	Pagination          *json.RawMessage `db:"pagination" json:"pagination,omitempty"`
+	Request             *json.RawMessage `db:"request" json:"request,omitempty"`
+	RecordsPath         *string          `db:"records_path" json:"records_path,omitempty"`
+	LastRefreshSuccess  *time.Time       `db:"last_refresh_success" json:"last_refresh_success,omitempty"`
+	LastRefreshError    *string          `db:"last_refresh_error" json:"last_refresh_error,omitempty"`
+	Status              string           `db:"status" json:"status"`
+	MappingJSON         *json.RawMessage `db:"mapping_json" json:"mapping_json,omitempty"`
+	WatermarkColumn     *string          `db:"watermark_column" json:"watermark_column,omitempty"`
+	WatermarkValue      *string          `db:"watermark_value" json:"watermark_value,omitempty"`
+	SourceETag          *string          `db:"source_etag" json:"source_etag,omitempty"`
+	SourceLastModified  *string          `db:"source_last_modified" json:"source_last_modified,omitempty"`
+	SourceChecksum      *string          `db:"source_checksum" json:"source_checksum,omitempty"`
+	QualityChecks       *json.RawMessage `db:"quality_checks" json:"quality_checks,omitempty"`
+	Expectations        *json.RawMessage `db:"expectations" json:"expectations,omitempty"`
+	SourceSchema        *json.RawMessage `db:"source_schema" json:"source_schema,omitempty"`
+	ReconcileWindow     *int             `db:"reconcile_window" json:"reconcile_window,omitempty"`
+	ReconcileCountURL   *string          `db:"reconcile_count_url" json:"reconcile_count_url,omitempty"`
+	ReconcileColumn     *string          `db:"reconcile_column" json:"reconcile_column,omitempty"`
+	SnapshotOf          *string          `db:"snapshot_of" json:"snapshot_of,omitempty"`
+	SnapshotAt          *time.Time       `db:"snapshot_at" json:"snapshot_at,omitempty"`
+	MaxRows             *int64           `db:"max_rows" json:"max_rows,omitempty"`
+	IngestPerMinute     *int             `db:"ingest_per_minute" json:"ingest_per_minute,omitempty"`
+	LoadMode            string           `db:"load_mode" json:"load_mode"`
+	MergeKey            *string          `db:"merge_key" json:"merge_key,omitempty"`
+	MergeDeletes        string           `db:"merge_deletes" json:"merge_deletes"`
+	InsertMode          string           `db:"insert_mode" json:"insert_mode"`
+	FailureThreshold    *int             `db:"failure_threshold" json:"failure_threshold,omitempty"`
+	FailureAction       string           `db:"failure_action" json:"failure_action"`
+	FailureBackoff      *int             `db:"failure_backoff" json:"failure_backoff,omitempty"`
+	ConsecutiveFailures int              `db:"consecutive_failures" json:"consecutive_failures"`
+	RefreshPausedAt     *time.Time       `db:"refresh_paused_at" json:"refresh_paused_at,omitempty"`
+	AllowedValues       *json.RawMessage `db:"allowed_values" json:"allowed_values,omitempty"`
+	ManagedKey          *string          `db:"managed_key" json:"managed_key,omitempty"`
+	ManagedKeyType      *string          `db:"managed_key_type" json:"managed_key_type,omitempty"`
+	SoftDelete          bool             `db:"soft_delete" json:"soft_delete"`
+	SoftDeleteGrace     *int             `db:"soft_delete_grace" json:"soft_delete_grace,omitempty"`
+	ConfigVersion       int              `db:"config_version" json:"config_version"`
+	CreatedAt           time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt           time.Time        `db:"updated_at" json:"updated_at"`
 }
 
-func NewTableHandler(db *sqlx.DB) *TableHandler {
-	return &TableHandler{DB: db}
+func NewTableHandler(db *sqlx.DB, broker *events.Broker, quotas *quota.Enforcer, queue *scheduler.Queue) *TableHandler {
+	return &TableHandler{DB: db, Events: broker, Quotas: quotas, Queue: queue}
 }
 
-// ListTables handles GET /tables
+// ListTables handles GET /tables; workspace keys see their workspace's tables
 func (h *TableHandler) ListTables(c *gin.Context) {
-	var tables []TableMetadata
-	err := h.DB.Select(&tables, "SELECT * FROM table_metadata ORDER BY id ASC")
+	tables, err := h.List()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tables"})
+		writeError(c, err)
 		return
 	}
+	if ws := currentWorkspace(c); ws != nil {
+		owned := []TableMetadata{}
+		for _, t := range tables {
+			if ws.Owns(t.TableName) {
+				owned = append(owned, t)
+			}
+		}
+		tables = owned
+	}
 	c.JSON(http.StatusOK, tables)
 }
 
+// List returns all registered tables ordered by id
+func (h *TableHandler) List() ([]TableMetadata, error) {
+	var tables []TableMetadata
+	if err := h.DB.Select(&tables, "SELECT * FROM table_metadata ORDER BY id ASC"); err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to fetch tables", nil)
+	}
+	return tables, nil
+}
+
+// GetTable handles GET /tables/:name; the ETag header is the version of
+// the table's configuration, for If-Match on PUT /tables/:name/config
+func (h *TableHandler) GetTable(c *gin.Context) {
+	var meta TableMetadata
+	err := h.DB.Get(&meta, "SELECT * FROM table_metadata WHERE table_name = $1", c.Param("name"))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(c, requestError(http.StatusNotFound, "table not found", nil))
+		return
+	}
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to fetch table", nil))
+		return
+	}
+	c.Header("ETag", tableETag(meta.ConfigVersion))
+	c.JSON(http.StatusOK, meta)
+}
+
 // CreateTableRequest is the expected payload for POST /tables
 type CreateTableRequest struct {
-	TableName       string            `json:"table_name" binding:"required"`
+	TableName       string            `json:"table_name" binding:"required"` // "name" or "schema.name" (Postgres)
 	TableType       string            `json:"table_type" binding:"required"`
 	RefreshInterval *int              `json:"refresh_interval,omitempty"`
 	Columns         map[string]string `json:"columns" binding:"required"` // key=name, value=type (e.g. "id":"SERIAL PRIMARY KEY", "value":"FLOAT")
+
+	// Provenance adds the managed _ingested_at, _source and _batch_id columns,
+	// filled in on every refresh and ingest
+	Provenance bool `json:"provenance,omitempty"`
+
+	// AllowedValues lists the only values some columns may hold, e.g.
+	// {"status": ["ok", "failed"]}; other values are rejected on ingest
+	AllowedValues etl.AllowedValues `json:"allowed_values,omitempty"`
+
+	// ManagedKey adds a primary key column (default "id") of type uuid or
+	// ulid, generated for every row loaded without one; payloads may omit it
+	ManagedKey *db.ManagedKey `json:"managed_key,omitempty"`
+
+	// SoftDelete adds the managed _deleted_at column: row deletes stamp it
+	// instead of removing rows, which are purged soft_delete_grace seconds
+	// later (default 30 days; 0 keeps them)
+	SoftDelete      bool `json:"soft_delete,omitempty"`
+	SoftDeleteGrace *int `json:"soft_delete_grace,omitempty"`
 }
 
 // CreateTable handles POST /tables
@@ -60,96 +160,337 @@ func (h *TableHandler) CreateTable(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
 		return
 	}
+	var err error
+	if req.TableName, err = currentWorkspace(c).Qualify(req.TableName); err != nil {
+		writeError(c, workspaceError(err, "invalid table name"))
+		return
+	}
 
-	// Basic validation on columns
-	if len(req.Columns) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one column required"})
+	meta, err := h.Create(req)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
+	// Return the new record
+	c.JSON(http.StatusCreated, meta)
+}
+
+// Create creates the table and registers it in table_metadata
+func (h *TableHandler) Create(req CreateTableRequest) (TableMetadata, error) {
+	meta, err := h.create(h.DB, req)
+	if err != nil {
+		return meta, err
+	}
+	h.Events.Publish(events.Event{Type: events.TableCreated, Table: meta.TableName})
+	return meta, nil
+}
+
+// create runs the DDL and metadata insert for Create on q (the DB or a transaction)
+func (h *TableHandler) create(q sqlx.Ext, req CreateTableRequest) (TableMetadata, error) {
+	var meta TableMetadata
+	table, err := db.ParseTableName(req.TableName)
+	if err == nil {
+		err = db.CheckSchemaSupport(h.DB, table)
+	}
+	if err != nil {
+		return meta, requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+
+	// Basic validation on columns: names and types go into the DDL as written
+	if len(req.Columns) == 0 {
+		return meta, requestError(http.StatusBadRequest, "at least one column required", nil)
+	}
+	for name, colType := range req.Columns {
+		if !db.ValidIdentifier(name) {
+			return meta, requestError(http.StatusBadRequest, "invalid column",
+				fmt.Errorf("column name %q contains invalid characters (allowed: A-Z a-z 0-9 _)", name))
+		}
+		if err := db.CheckColumnDef(colType); err != nil {
+			return meta, requestError(http.StatusBadRequest, "invalid column", fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if err := h.Quotas.CheckCreate(q, table.String()); err != nil {
+		return meta, quotaError(err, "failed to check quota")
+	}
+
+	colTypes := make(map[string]string, len(req.Columns))
+	for name, colType := range req.Columns {
+		colTypes[name] = strings.ToLower(colType)
+	}
+	if err := req.AllowedValues.Check(colTypes); err != nil {
+		return meta, requestError(http.StatusBadRequest, "invalid allowed_values", err)
+	}
+	var allowed interface{}
+	if len(req.AllowedValues) > 0 {
+		raw, _ := json.Marshal(req.AllowedValues)
+		allowed = raw
+	}
+
+	var keyColumn, keyType interface{}
+	if k := req.ManagedKey; k != nil {
+		if k.Column == "" {
+			k.Column = "id"
+		}
+		if err := k.Check(); err != nil {
+			return meta, requestError(http.StatusBadRequest, "invalid managed_key", err)
+		}
+		if _, ok := req.Columns[k.Column]; ok {
+			return meta, requestError(http.StatusBadRequest, "invalid managed_key",
+				fmt.Errorf("%s is declared in columns too", k.Column))
+		}
+		for name, colType := range req.Columns {
+			if strings.Contains(strings.ToUpper(colType), "PRIMARY KEY") {
+				return meta, requestError(http.StatusBadRequest, "invalid managed_key",
+					fmt.Errorf("column %s is already the primary key", name))
+			}
+		}
+		keyColumn, keyType = k.Column, k.Type
+	}
+
+	var grace interface{}
+	if req.SoftDelete {
+		if _, ok := req.Columns[etl.DeletedAtColumn]; ok {
+			return meta, requestError(http.StatusBadRequest, "invalid column",
+				fmt.Errorf("%s is managed by soft_delete", etl.DeletedAtColumn))
+		}
+		if grace, err = softDeleteGrace(req.SoftDeleteGrace); err != nil {
+			return meta, err
+		}
+	}
+
+	// SQLite has no array types
+	for _, colType := range req.Columns {
+		if db.IsArrayType(colType) && db.DialectOf(h.DB) != db.Postgres {
+			return meta, requestError(http.StatusBadRequest, "invalid column",
+				fmt.Errorf("%s columns need Postgres", colType))
+		}
+	}
+
+	// geometry and geography columns need the PostGIS extension
+	for _, colType := range req.Columns {
+		if !geo.IsSpatialType(colType) {
+			continue
+		}
+		if db.DialectOf(h.DB) != db.Postgres {
+			return meta, requestError(http.StatusBadRequest, "invalid column",
+				fmt.Errorf("%s columns need Postgres with PostGIS", colType))
+		}
+		if _, err := q.Exec(`CREATE EXTENSION IF NOT EXISTS postgis;`); err != nil {
+			return meta, requestError(http.StatusInternalServerError, "failed to enable PostGIS", err)
+		}
+		break
+	}
+
+	// Tables in a non-default schema get the schema created on first use
+	if table.Schema != "" {
+		if _, err := q.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s;`, db.QuoteIdent(table.Schema))); err != nil {
+			return meta, requestError(http.StatusInternalServerError, "failed to create schema", err)
+		}
+	}
+
 	columnDefs := []string{}
 	for name, colType := range req.Columns {
-		columnDefs = append(columnDefs, fmt.Sprintf("%s %s", name, colType))
+		if db.IsProvenanceColumn(name) {
+			return meta, requestError(http.StatusBadRequest, "invalid column",
+				fmt.Errorf("%s is a managed provenance column; set provenance: true instead", name))
+		}
+		columnDefs = append(columnDefs, fmt.Sprintf("%s %s", db.QuoteIdent(name), colType))
+	}
+	if req.ManagedKey != nil {
+		columnDefs = append([]string{req.ManagedKey.ColumnDef(db.DialectOf(h.DB))}, columnDefs...)
 	}
-	createStmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (%s);`, req.TableName, strings.Join(columnDefs, ", "))
+	if req.Provenance {
+		columnDefs = append(columnDefs, db.ProvenanceColumnDefs...)
+	}
+	if req.SoftDelete {
+		columnDefs = append(columnDefs, fmt.Sprintf(`"%s" TIMESTAMP`, etl.DeletedAtColumn))
+	}
+	createStmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (%s);`, table.Quoted(), strings.Join(columnDefs, ", "))
 
 	// Execute table creation
-	if _, err := h.DB.Exec(createStmt); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create table", "details": err.Error()})
-		return
+	if _, err := q.Exec(createStmt); err != nil {
+		return meta, requestError(http.StatusInternalServerError, "failed to create table", err)
 	}
 
 	// Insert into table_metadata
 	insert_query := `
-		INSERT INTO table_metadata (table_name, table_type, refresh_interval)
-		VALUES ($1, $2, $3)
-		RETURNING id, table_name, table_type, refresh_interval, created_at, updated_at
+		INSERT INTO table_metadata (table_name, table_type, refresh_interval, allowed_values, managed_key, managed_key_type, soft_delete, soft_delete_grace)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, table_name, table_type, refresh_interval, allowed_values, managed_key, managed_key_type, soft_delete, soft_delete_grace, config_version, created_at, updated_at
 	`
-	var meta TableMetadata
-	err := h.DB.QueryRowx(insert_query, req.TableName, req.TableType, req.RefreshInterval).StructScan(&meta)
+	err = q.QueryRowx(insert_query, table.String(), req.TableType, req.RefreshInterval, allowed, keyColumn, keyType,
+		req.SoftDelete, grace).StructScan(&meta)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create table"})
-		return
+		return meta, requestError(http.StatusInternalServerError, "failed to create table", nil)
 	}
-
-	// Return the new record
-	c.JSON(http.StatusCreated, meta)
+	return meta, nil
 }
 
 // DeleteTable handles tables/:name it grabs table name from url params drops the actual table and deletes metadata
 func (h *TableHandler) DeleteTable(c *gin.Context) {
 	tableName := c.Param("name")
-	if tableName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "table name required"})
+	if err := h.Delete(tableName); err != nil {
+		writeError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "table deleted", "table": tableName})
+}
+
+// Delete drops the table and removes its metadata
+func (h *TableHandler) Delete(tableName string) error {
+	if tableName == "" {
+		return requestError(http.StatusBadRequest, "table name required", nil)
+	}
+	table, err := db.ParseTableName(tableName)
+	if err != nil {
+		return requestError(http.StatusBadRequest, "invalid table name", err)
+	}
 
 	// Drop the table itself
-	dropStmt := fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, tableName)
+	dropStmt := fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, table.Quoted())
 	if _, err := h.DB.Exec(dropStmt); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to drop table", "details": err.Error()})
-		return
+		return requestError(http.StatusInternalServerError, "failed to drop table", err)
 	}
 
 	// Remove from metadata
 	if _, err := h.DB.Exec(`DELETE FROM table_metadata WHERE table_name = $1;`, tableName); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove metadata", "details": err.Error()})
-		return
+		return requestError(http.StatusInternalServerError, "failed to remove metadata", err)
+	}
+	// export sinks would otherwise carry a stale cursor over to a recreated table
+	if _, err := h.DB.Exec(`DELETE FROM table_sinks WHERE table_name = $1`, tableName); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to remove export sinks", err)
+	}
+	// rollup tables are derived from this one and go with it
+	var rollupTables []string
+	if err := h.DB.Select(&rollupTables, `SELECT rollup_table FROM table_rollups WHERE table_name = $1`, tableName); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to load rollups", err)
+	}
+	for _, name := range rollupTables {
+		if t, err := db.ParseTableName(name); err == nil {
+			if _, err := h.DB.Exec(`DROP TABLE IF EXISTS ` + t.Quoted()); err != nil {
+				return requestError(http.StatusInternalServerError, "failed to drop rollup table", err)
+			}
+		}
+	}
+	if _, err := h.DB.Exec(`DELETE FROM table_rollups WHERE table_name = $1`, tableName); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to remove rollups", err)
+	}
+	if _, err := h.DB.Exec(`DELETE FROM job_queue WHERE table_name = $1`, tableName); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to remove queued runs", err)
+	}
+	if _, err := h.DB.Exec(`DELETE FROM table_notifications WHERE table_name = $1`, tableName); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to remove notification routes", err)
+	}
+	if _, err := h.DB.Exec(`DELETE FROM table_replicas WHERE table_name = $1`, tableName); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to remove replica subscription", err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "table deleted", "table": tableName})
+	h.Events.Publish(events.Event{Type: events.TableDeleted, Table: tableName})
+	return nil
 }
 
 // GET /tables/:name/columns
 func (h *TableHandler) GetTableColumns(c *gin.Context) {
-	tableName := c.Param("name")
-
-	query := `
-		SELECT column_name, data_type
-		FROM information_schema.columns
-		WHERE table_name = $1
-		ORDER BY ordinal_position;
-	`
-
-	var cols []struct {
-		ColumnName string `db:"column_name" json:"column_name"`
-		DataType   string `db:"data_type" json:"data_type"`
-	}
-
-	if err := h.DB.Select(&cols, query, tableName); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch columns"})
+	cols, err := h.Columns(c.Param("name"))
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, cols)
 }
 
+// Columns lists the columns of a table in declaration order
+func (h *TableHandler) Columns(tableName string) ([]db.Column, error) {
+	cols, err := db.TableColumns(h.DB, tableName)
+	if err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to fetch columns", nil)
+	}
+	return cols, nil
+}
+
 type UpdateTableConfigRequest struct {
 	RefreshInterval *int            `json:"refresh_interval"` // nullable
 	DataSourceURL   *string         `json:"data_source_url"`  //nullable
 	MappingJSON     json.RawMessage `json:"mapping_json"`
+
+	// Several sources (e.g. one per region) loaded in each refresh instead
+	// of data_source_url, which is set to the first; [] removes them
+	DataSources *[]etl.Source `json:"data_sources"`
+
+	// How the source pages its records; an object without a type removes it
+	Pagination *etl.Pagination `json:"pagination"`
+
+	// Method, body template and content type for sources that need more
+	// than a GET; an empty object removes it
+	Request *etl.SourceRequest `json:"request"`
+
+	// Where the records are in wrapped payloads, e.g. $.results; "" reads
+	// the top-level array or object again
+	RecordsPath *string `json:"records_path"`
+
+	// Incremental loads: "" turns incremental mode off. Changing the column
+	// (or reset_watermark) clears the stored watermark so the next run starts over.
+	WatermarkColumn *string `json:"watermark_column"`
+	ResetWatermark  bool    `json:"reset_watermark"`
+
+	// Data quality checks run after each refresh; [] removes them
+	QualityChecks json.RawMessage `json:"quality_checks"`
+
+	// Expectations use the quality check format; a refresh that leaves one
+	// failing is logged as ERROR instead of OK. [] removes them
+	Expectations json.RawMessage `json:"expectations"`
+
+	// Source reconciliation: window in seconds (0 turns it off), optional
+	// count URL and timestamp column. Omitted fields are left unchanged.
+	ReconcileWindow   *int    `json:"reconcile_window"`
+	ReconcileCountURL *string `json:"reconcile_count_url"`
+	ReconcileColumn   *string `json:"reconcile_column"`
+
+	// How refreshes load the table: append, replace to swap the table's
+	// contents for each pull, or merge to replace rows by merge_key
+	LoadMode *string `json:"load_mode"`
+
+	// Comma-separated key columns for merge loads; "" clears it
+	MergeKey *string `json:"merge_key"`
+
+	// What merge loads do with rows whose key is missing from the pull:
+	// off, mark (stamp _deleted_at, added to the table if needed) or delete
+	MergeDeletes *string `json:"merge_deletes"`
+
+	// What refreshes do with rows that fail: chunked commits chunks as
+	// they load and stops at the first failure, atomic loads all or
+	// nothing, batch skips failing chunks and row skips failing rows
+	InsertMode *string `json:"insert_mode"`
+
+	// Failure escalation: after failure_threshold failed refreshes in a
+	// row (0 = never) the scheduler applies failure_action: retry, backoff
+	// to failure_backoff seconds, pause, or page. reset_failures clears
+	// the failure count and lifts an auto-pause.
+	FailureThreshold *int    `json:"failure_threshold"`
+	FailureAction    *string `json:"failure_action"`
+	FailureBackoff   *int    `json:"failure_backoff"`
+	ResetFailures    bool    `json:"reset_failures"`
+
+	// Values some columns are restricted to, replacing the stored lists;
+	// {} removes them
+	AllowedValues json.RawMessage `json:"allowed_values"`
+
+	// Soft delete mode (adding _deleted_at if needed) and the seconds
+	// soft-deleted rows are kept before the purge (0 keeps them). Turning
+	// it on without a grace period keeps rows for 30 days.
+	SoftDelete      *bool `json:"soft_delete"`
+	SoftDeleteGrace *int  `json:"soft_delete_grace"`
+
+	// The table's updated_at as last read; the update fails with 409 if
+	// it has changed since. An If-Match header with the table's ETag does
+	// the same without being affected by refreshes.
+	UpdatedAt *time.Time `json:"updated_at"`
 }
 
 // PUT /tables/:name/config
+// With If-Match or updated_at the update only applies to the version of
+// the table the caller read; the response's ETag is the new version.
 func (h *TableHandler) UpdateTableConfig(c *gin.Context) {
 	table := c.Param("name")
 
@@ -159,16 +500,88 @@ func (h *TableHandler) UpdateTableConfig(c *gin.Context) {
 		return
 	}
 
+	if err := checkWritable(h.DB, table); err != nil {
+		writeError(c, err)
+		return
+	}
+	version, err := checkTableVersion(h.DB, table, tablePrecondition{IfMatch: c.GetHeader("If-Match"), UpdatedAt: req.UpdatedAt})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
 	updates := []string{}
 	args := []interface{}{}
 	idx := 1
 
-	// Update URL (set or clear)
+	// Update URL (set or clear); data_sources replace it
+	if req.DataSources != nil {
+		if err := etl.CheckSources(*req.DataSources); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid data_sources", err))
+			return
+		}
+		var sources interface{}
+		if len(*req.DataSources) > 0 {
+			raw, _ := json.Marshal(*req.DataSources)
+			sources = raw
+			req.DataSourceURL = &(*req.DataSources)[0].URL
+		}
+		updates = append(updates, fmt.Sprintf("data_sources = $%d", idx))
+		args = append(args, sources)
+		idx++
+	}
 
 	updates = append(updates, fmt.Sprintf("data_source_url = $%d", idx))
 	args = append(args, req.DataSourceURL)
 	idx++
 
+	// Update pagination if provided
+	if req.Pagination != nil {
+		var paging interface{}
+		if req.Pagination.Type != "" {
+			if err := req.Pagination.Check(); err != nil {
+				writeError(c, requestError(http.StatusBadRequest, "invalid pagination", err))
+				return
+			}
+			raw, _ := json.Marshal(req.Pagination)
+			paging = raw
+		}
+		updates = append(updates, fmt.Sprintf("pagination = $%d", idx))
+		args = append(args, paging)
+		idx++
+	}
+
+	// Update the source request if provided
+	if req.Request != nil {
+		var request interface{}
+		if *req.Request != (etl.SourceRequest{}) {
+			if err := req.Request.Check(); err != nil {
+				writeError(c, requestError(http.StatusBadRequest, "invalid request", err))
+				return
+			}
+			raw, _ := json.Marshal(req.Request)
+			request = raw
+		}
+		updates = append(updates, fmt.Sprintf("request = $%d", idx))
+		args = append(args, request)
+		idx++
+	}
+
+	// Update the records path if provided
+	if req.RecordsPath != nil {
+		if err := etl.CheckRecordsPath(*req.RecordsPath); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid records_path", err))
+			return
+		}
+		var path interface{}
+		if *req.RecordsPath != "" {
+			path = *req.RecordsPath
+		}
+		updates = append(updates, fmt.Sprintf("records_path = $%d", idx))
+		args = append(args, path)
+		idx++
+	}
+
 	// Update refresh interval (set or null)
 
 	updates = append(updates, fmt.Sprintf("refresh_interval = $%d", idx))
@@ -182,20 +595,252 @@ func (h *TableHandler) UpdateTableConfig(c *gin.Context) {
 		idx++
 	}
 
+	// Update watermark column if provided
+	if req.WatermarkColumn != nil {
+		var col interface{}
+		if *req.WatermarkColumn != "" {
+			col = *req.WatermarkColumn
+		}
+		updates = append(updates, fmt.Sprintf("watermark_column = $%d", idx))
+		args = append(args, col)
+		idx++
+		if !req.ResetWatermark {
+			updates = append(updates, fmt.Sprintf(
+				"watermark_value = CASE WHEN watermark_column IS NOT DISTINCT FROM $%d THEN watermark_value END", idx))
+			args = append(args, col)
+			idx++
+		}
+	}
+	if req.ResetWatermark {
+		updates = append(updates, "watermark_value = NULL")
+	}
+
+	// Refreshes skip payloads they have already loaded (by checksum, ETag
+	// or Last-Modified); once what is fetched or how it is mapped changes,
+	// the next one must load in full
+	sourceChanged := req.DataSources != nil || req.Pagination != nil || req.Request != nil ||
+		req.RecordsPath != nil || req.MappingJSON != nil || req.WatermarkColumn != nil || req.ResetWatermark
+	sourceState := []string{"source_checksum", "source_etag", "source_last_modified"}
+	if sourceChanged {
+		for _, col := range sourceState {
+			updates = append(updates, col+" = NULL")
+		}
+	} else {
+		// data_source_url is written every time; only a new one counts
+		for _, col := range sourceState {
+			updates = append(updates, fmt.Sprintf("%s = CASE WHEN data_source_url IS NOT DISTINCT FROM $%d THEN %s END", col, idx, col))
+		}
+		args = append(args, req.DataSourceURL)
+		idx++
+	}
+
+	// Update quality checks if provided
+	ws := currentWorkspace(c)
+	if req.QualityChecks != nil {
+		if _, err := quality.ParseChecks(req.QualityChecks); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid quality_checks", "details": err.Error()})
+			return
+		}
+		var err error
+		if req.QualityChecks, err = scopeChecks(ws, req.QualityChecks); err != nil {
+			writeError(c, workspaceError(err, "invalid quality_checks"))
+			return
+		}
+		updates = append(updates, fmt.Sprintf("quality_checks = $%d", idx))
+		args = append(args, req.QualityChecks)
+		idx++
+	}
+
+	// Update expectations if provided
+	if req.Expectations != nil {
+		if _, err := quality.ParseChecks(req.Expectations); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expectations", "details": err.Error()})
+			return
+		}
+		var err error
+		if req.Expectations, err = scopeChecks(ws, req.Expectations); err != nil {
+			writeError(c, workspaceError(err, "invalid expectations"))
+			return
+		}
+		updates = append(updates, fmt.Sprintf("expectations = $%d", idx))
+		args = append(args, req.Expectations)
+		idx++
+	}
+
+	// Update reconciliation settings if provided ("" / 0 clear them)
+	if req.ReconcileWindow != nil {
+		if *req.ReconcileWindow < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reconcile_window cannot be negative"})
+			return
+		}
+		var window interface{}
+		if *req.ReconcileWindow > 0 {
+			window = *req.ReconcileWindow
+		}
+		updates = append(updates, fmt.Sprintf("reconcile_window = $%d", idx))
+		args = append(args, window)
+		idx++
+	}
+	for col, val := range map[string]*string{"reconcile_count_url": req.ReconcileCountURL, "reconcile_column": req.ReconcileColumn} {
+		if val == nil {
+			continue
+		}
+		var v interface{}
+		if *val != "" {
+			v = *val
+		}
+		updates = append(updates, fmt.Sprintf("%s = $%d", col, idx))
+		args = append(args, v)
+		idx++
+	}
+
+	// Update load mode and merge key if provided
+	if req.LoadMode != nil || req.MergeKey != nil {
+		if err := h.checkLoadStrategy(table, req.LoadMode, req.MergeKey); err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+	if req.LoadMode != nil {
+		updates = append(updates, fmt.Sprintf("load_mode = $%d", idx))
+		args = append(args, *req.LoadMode)
+		idx++
+	}
+	if req.MergeDeletes != nil {
+		if !etl.ValidMergeDeletes(*req.MergeDeletes) {
+			writeError(c, requestError(http.StatusBadRequest, "invalid merge_deletes", errors.New("must be off, mark or delete")))
+			return
+		}
+		if *req.MergeDeletes == etl.DeletesMark {
+			if err := h.addDeletedAt(table); err != nil {
+				writeError(c, err)
+				return
+			}
+		}
+		updates = append(updates, fmt.Sprintf("merge_deletes = $%d", idx))
+		args = append(args, *req.MergeDeletes)
+		idx++
+	}
+	if req.InsertMode != nil {
+		if !etl.ValidInsertMode(*req.InsertMode) {
+			writeError(c, requestError(http.StatusBadRequest, "invalid insert_mode", errors.New("must be chunked, atomic, batch or row")))
+			return
+		}
+		updates = append(updates, fmt.Sprintf("insert_mode = $%d", idx))
+		args = append(args, *req.InsertMode)
+		idx++
+	}
+	if req.MergeKey != nil {
+		var key interface{}
+		if k := etl.ParseMergeKey(*req.MergeKey); len(k) > 0 {
+			key = strings.Join(k, ",")
+		}
+		updates = append(updates, fmt.Sprintf("merge_key = $%d", idx))
+		args = append(args, key)
+		idx++
+	}
+
+	// Update the failure escalation policy if provided (0 clears the numbers)
+	if req.FailureThreshold != nil || req.FailureAction != nil || req.FailureBackoff != nil {
+		if err := h.checkFailurePolicy(table, req.FailureThreshold, req.FailureAction, req.FailureBackoff); err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+	for col, val := range map[string]*int{"failure_threshold": req.FailureThreshold, "failure_backoff": req.FailureBackoff} {
+		if val == nil {
+			continue
+		}
+		var v interface{}
+		if *val > 0 {
+			v = *val
+		}
+		updates = append(updates, fmt.Sprintf("%s = $%d", col, idx))
+		args = append(args, v)
+		idx++
+	}
+	if req.FailureAction != nil {
+		updates = append(updates, fmt.Sprintf("failure_action = $%d", idx))
+		args = append(args, *req.FailureAction)
+		idx++
+	}
+	if req.ResetFailures {
+		updates = append(updates, "consecutive_failures = 0", "refresh_paused_at = NULL")
+	}
+
+	// Update allowed values if provided
+	if req.AllowedValues != nil {
+		allowed, err := h.checkAllowedValues(table, req.AllowedValues)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		updates = append(updates, fmt.Sprintf("allowed_values = $%d", idx))
+		args = append(args, allowed)
+		idx++
+	}
+
+	// Update soft delete mode if provided; turning it on sets the default
+	// grace period unless one is given
+	setGrace := req.SoftDeleteGrace != nil
+	if req.SoftDelete != nil {
+		if *req.SoftDelete {
+			on, err := etl.SoftDeletes(h.DB, table)
+			if err != nil {
+				writeError(c, requestError(http.StatusInternalServerError, "failed to read soft delete mode", err))
+				return
+			}
+			if err := h.addDeletedAt(table); err != nil {
+				writeError(c, err)
+				return
+			}
+			setGrace = setGrace || !on
+		}
+		updates = append(updates, fmt.Sprintf("soft_delete = $%d", idx))
+		args = append(args, *req.SoftDelete)
+		idx++
+	}
+	if setGrace {
+		grace, err := softDeleteGrace(req.SoftDeleteGrace)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		updates = append(updates, fmt.Sprintf("soft_delete_grace = $%d", idx))
+		args = append(args, grace)
+		idx++
+	}
+
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields provided"})
 		return
 	}
 
 	args = append(args, table)
+	where := fmt.Sprintf("table_name = $%d", idx)
+	if version != 0 {
+		args = append(args, version)
+		where += fmt.Sprintf(" AND config_version = $%d", idx+1)
+	}
 
 	query := fmt.Sprintf(`
         UPDATE table_metadata
-        SET %s, updated_at = NOW()
-        WHERE table_name = $%d
-    `, strings.Join(updates, ", "), idx)
-
-	if _, err := h.DB.Exec(query, args...); err != nil {
+        SET %s, config_version = config_version + 1, updated_at = CURRENT_TIMESTAMP
+        WHERE %s
+        RETURNING config_version
+    `, strings.Join(updates, ", "), where)
+
+	var next int
+	err = h.DB.QueryRowx(query, args...).Scan(&next)
+	if errors.Is(err, sql.ErrNoRows) {
+		if version != 0 {
+			writeError(c, staleTable(errors.New("it was changed by another update")))
+		} else {
+			writeError(c, requestError(http.StatusNotFound, "table not found", nil))
+		}
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed to update metadata",
 			"details": err.Error(),
@@ -203,8 +848,175 @@ func (h *TableHandler) UpdateTableConfig(c *gin.Context) {
 		return
 	}
 
+	h.queueFirstRefresh(table)
+	c.Header("ETag", tableETag(next))
 	c.JSON(http.StatusOK, gin.H{
 		"message": "config updated",
 		"table":   table,
 	})
 }
+
+// queueFirstRefresh runs a time_series table's first refresh through the
+// scheduler's queue now that it may have a source, instead of after the
+// next scheduler poll and a full interval
+func (h *TableHandler) queueFirstRefresh(table string) {
+	if h.Queue == nil {
+		return
+	}
+	if _, err := h.Queue.EnqueueFirst(table); err != nil {
+		log.Printf("can't queue first refresh of %s: %v", table, err)
+	}
+}
+
+// checkAllowedValues validates allowed values against the table's columns
+// and returns what to store: their JSON, or nil when there are none
+func (h *TableHandler) checkAllowedValues(table string, raw json.RawMessage) (interface{}, error) {
+	allowed, err := etl.ParseAllowedValues(raw)
+	if err != nil {
+		return nil, requestError(http.StatusBadRequest, "invalid allowed_values", err)
+	}
+	cols, err := db.TableColumns(h.DB, table)
+	if err != nil {
+		return nil, requestError(http.StatusInternalServerError, "failed to fetch columns", err)
+	}
+	colTypes := make(map[string]string, len(cols))
+	for _, col := range cols {
+		colTypes[col.ColumnName] = col.DataType
+	}
+	if err := allowed.Check(colTypes); err != nil {
+		return nil, requestError(http.StatusBadRequest, "invalid allowed_values", err)
+	}
+	if len(allowed) == 0 {
+		return nil, nil
+	}
+	out, _ := json.Marshal(allowed)
+	return out, nil
+}
+
+// checkFailurePolicy validates a failure policy change merged over the
+// stored policy; 0 clears failure_threshold or failure_backoff
+func (h *TableHandler) checkFailurePolicy(table string, threshold *int, action *string, backoff *int) error {
+	for name, v := range map[string]*int{"failure_threshold": threshold, "failure_backoff": backoff} {
+		if v != nil && *v < 0 {
+			return requestError(http.StatusBadRequest, "invalid "+name, errors.New("cannot be negative"))
+		}
+	}
+	var p etl.FailurePolicy
+	if err := h.DB.Get(&p, `SELECT failure_threshold, failure_action, failure_backoff, consecutive_failures FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to load table config", err)
+	}
+	if threshold != nil {
+		p.Threshold = nil
+		if *threshold > 0 {
+			p.Threshold = threshold
+		}
+	}
+	if action != nil {
+		p.Action = *action
+	}
+	if backoff != nil {
+		p.Backoff = nil
+		if *backoff > 0 {
+			p.Backoff = backoff
+		}
+	}
+	if err := p.Check(); err != nil {
+		return requestError(http.StatusBadRequest, "invalid failure policy", err)
+	}
+	return nil
+}
+
+// checkLoadStrategy validates a load mode and merge key change against the
+// stored ones: merge needs a key whose columns are all in the table.
+func (h *TableHandler) checkLoadStrategy(table string, mode, key *string) error {
+	if mode != nil && !etl.ValidLoadMode(*mode) {
+		return requestError(http.StatusBadRequest, "invalid load_mode", errors.New("must be append, replace or merge"))
+	}
+	var stored struct {
+		Mode string  `db:"load_mode"`
+		Key  *string `db:"merge_key"`
+	}
+	if err := h.DB.Get(&stored, `SELECT load_mode, merge_key FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to load table config", err)
+	}
+	if mode == nil {
+		mode = &stored.Mode
+	}
+	if key == nil {
+		key = stored.Key
+	}
+	if *mode != etl.LoadMerge {
+		return nil
+	}
+	var k []string
+	if key != nil {
+		k = etl.ParseMergeKey(*key)
+	}
+	cols, err := db.TableColumns(h.DB, table)
+	if err != nil {
+		return requestError(http.StatusInternalServerError, "failed to read table columns", err)
+	}
+	if err := etl.CheckMergeKey(k, cols); err != nil {
+		return requestError(http.StatusBadRequest, "invalid merge_key", err)
+	}
+	return nil
+}
+
+// softDeleteGrace is the soft_delete_grace to store for a requested grace
+// period: the default when omitted, NULL (rows are kept) for 0
+func softDeleteGrace(seconds *int) (interface{}, error) {
+	if seconds == nil {
+		return int(etl.DefaultSoftDeleteGrace / time.Second), nil
+	}
+	if *seconds < 0 {
+		return nil, requestError(http.StatusBadRequest, "soft_delete_grace cannot be negative", nil)
+	}
+	if *seconds == 0 {
+		return nil, nil
+	}
+	return *seconds, nil
+}
+
+// addDeletedAt adds the column merge_deletes=mark and soft deletes stamp,
+// unless table has it
+func (h *TableHandler) addDeletedAt(table string) error {
+	cols, err := db.TableColumns(h.DB, table)
+	if err != nil {
+		return requestError(http.StatusInternalServerError, "failed to read table columns", err)
+	}
+	for _, col := range cols {
+		if col.ColumnName == etl.DeletedAtColumn {
+			return nil
+		}
+	}
+	name, err := db.ParseTableName(table)
+	if err != nil {
+		return requestError(http.StatusBadRequest, "invalid table name", err)
+	}
+	if _, err := h.DB.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" TIMESTAMP`, name.Quoted(), etl.DeletedAtColumn)); err != nil {
+		return requestError(http.StatusInternalServerError, "failed to add "+etl.DeletedAtColumn, err)
+	}
+	return nil
+}
+
+// scopeChecks resolves the ref_table of references checks into ws, so a
+// workspace's checks cannot probe another workspace's tables. The default
+// workspace gets raw back unchanged.
+func scopeChecks(ws *workspace.Workspace, raw json.RawMessage) (json.RawMessage, error) {
+	if ws == nil {
+		return raw, nil
+	}
+	checks, err := quality.ParseChecks(raw)
+	if err != nil || checks == nil {
+		return raw, err
+	}
+	for i := range checks {
+		if checks[i].RefTable == "" {
+			continue
+		}
+		if checks[i].RefTable, err = ws.Qualify(checks[i].RefTable); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(checks)
+}
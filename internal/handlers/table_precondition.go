@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// tablePrecondition is what a caller last saw of a table's metadata
+// before changing its configuration: the ETag sent in If-Match and/or
+// the updated_at it read. A write with neither applies unconditionally.
+type tablePrecondition struct {
+	IfMatch   string
+	UpdatedAt *time.Time
+}
+
+// tableETag is the entity tag of a table's configuration version
+func tableETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// etagMatches reports whether an If-Match header lists etag (or is "*").
+// Weak tags compare by their opaque part.
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTableVersion returns the config_version a write to table applies
+// to, or a 409 when the table changed since the caller read it. It
+// returns 0 when p is empty; writes then apply to any version.
+func checkTableVersion(q sqlx.Queryer, table string, p tablePrecondition) (int, error) {
+	if p.IfMatch == "" && p.UpdatedAt == nil {
+		return 0, nil
+	}
+	var cur struct {
+		Version   int       `db:"config_version"`
+		UpdatedAt time.Time `db:"updated_at"`
+	}
+	err := sqlx.Get(q, &cur, `SELECT config_version, updated_at FROM table_metadata WHERE table_name = $1`, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, requestError(http.StatusNotFound, "table not found", nil)
+	}
+	if err != nil {
+		return 0, requestError(http.StatusInternalServerError, "failed to check metadata", err)
+	}
+	if p.IfMatch != "" && !etagMatches(p.IfMatch, tableETag(cur.Version)) {
+		return 0, staleTable(fmt.Errorf("its ETag is now %s, not %s", tableETag(cur.Version), p.IfMatch))
+	}
+	if p.UpdatedAt != nil && !p.UpdatedAt.Equal(cur.UpdatedAt) {
+		return 0, staleTable(fmt.Errorf("its updated_at is now %s", cur.UpdatedAt.UTC().Format(time.RFC3339Nano)))
+	}
+	return cur.Version, nil
+}
+
+// staleTable is the 409 for a configuration write based on an old read
+func staleTable(err error) error {
+	return requestError(http.StatusConflict, "table changed since it was read; fetch it again and retry", err)
+}
@@ -0,0 +1,181 @@
+// GoDataFlow admin UI: a thin client over the /v1 API. The API key is kept
+// in localStorage and sent as X-API-Key; the server does the rest.
+(function () {
+  "use strict";
+
+  var keyInput = document.getElementById("api-key");
+  keyInput.value = localStorage.getItem("godataflow.apiKey") || "";
+
+  document.getElementById("auth").addEventListener("submit", function (e) {
+    e.preventDefault();
+    localStorage.setItem("godataflow.apiKey", keyInput.value);
+    show();
+  });
+
+  function api(path) {
+    var headers = {};
+    var key = localStorage.getItem("godataflow.apiKey");
+    if (key) headers["X-API-Key"] = key;
+    return fetch("/v1" + path, { headers: headers }).then(function (resp) {
+      return resp.json().catch(function () { return {}; }).then(function (body) {
+        if (!resp.ok) throw new Error(body.error || resp.status + " " + resp.statusText);
+        return body;
+      });
+    });
+  }
+
+  function fail(err) {
+    var el = document.getElementById("error");
+    el.textContent = err.message;
+    el.hidden = false;
+  }
+
+  function el(tag, text) {
+    var e = document.createElement(tag);
+    if (text !== undefined && text !== null) e.textContent = text;
+    return e;
+  }
+
+  function cell(v) {
+    if (v === null || v === undefined) return "";
+    return typeof v === "object" ? JSON.stringify(v) : String(v);
+  }
+
+  // grid renders rows (objects) as a table of the given columns, or of
+  // every key found when none are given
+  function grid(rows, columns, decorate) {
+    if (!rows || rows.length === 0) return el("p", "No rows.");
+    if (!columns) {
+      columns = [];
+      rows.forEach(function (r) {
+        Object.keys(r).forEach(function (k) { if (columns.indexOf(k) < 0) columns.push(k); });
+      });
+    }
+    var t = el("table");
+    var head = t.appendChild(el("tr"));
+    columns.forEach(function (c) { head.appendChild(el("th", c)); });
+    rows.forEach(function (r) {
+      var tr = t.appendChild(el("tr"));
+      columns.forEach(function (c) {
+        var td = tr.appendChild(el("td", cell(r[c])));
+        if (decorate) decorate(td, c, r);
+      });
+    });
+    return t;
+  }
+
+  function fill(id, node) {
+    var target = document.getElementById(id);
+    target.textContent = "";
+    target.appendChild(node);
+  }
+
+  function link(text, onclick) {
+    var b = el("button", text);
+    b.className = "link";
+    b.addEventListener("click", onclick);
+    return b;
+  }
+
+  // --- tables ---
+
+  function loadTables() {
+    api("/tables").then(function (tables) {
+      fill("tables-list", grid(tables,
+        ["table_name", "table_type", "status", "refresh_interval", "last_refresh_success", "last_refresh_error"],
+        function (td, col, row) {
+          if (col === "table_name") {
+            td.textContent = "";
+            td.appendChild(link(row.table_name, function () { loadTable(row.table_name); }));
+          }
+          if (col === "last_refresh_error" && row.last_refresh_error) td.className = "error";
+        }));
+    }).catch(fail);
+  }
+
+  function loadTable(name) {
+    var detail = el("div");
+    detail.appendChild(el("h3", name));
+    fill("table-detail", detail);
+    var q = encodeURIComponent(name);
+    api("/tables/" + q + "/columns").then(function (cols) {
+      detail.appendChild(el("h4", "Columns"));
+      detail.appendChild(grid(cols));
+      return api("/tables/" + q + "/sample?n=20");
+    }).then(function (sample) {
+      detail.appendChild(el("h4", "Sample"));
+      detail.appendChild(grid(sample.data));
+    }).catch(fail);
+  }
+
+  // --- source preview ---
+
+  document.getElementById("preview-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var url = document.getElementById("preview-url").value;
+    api("/preview_source?url=" + encodeURIComponent(url)).then(function (body) {
+      document.getElementById("preview-result").textContent = JSON.stringify(body.preview, null, 2);
+    }).catch(fail);
+  });
+
+  // --- refresh logs ---
+
+  document.getElementById("logs-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    loadLogs();
+  });
+
+  function loadLogs() {
+    var table = document.getElementById("logs-table").value.trim();
+    var status = document.getElementById("logs-status").value;
+    var path = table ? "/refresh_logs/" + encodeURIComponent(table) : "/refresh_logs";
+    path += "?limit=100" + (status ? "&status=" + encodeURIComponent(status) : "");
+    api(path).then(function (logs) {
+      fill("logs-list", grid(logs,
+        ["id", "table_name", "status", "rows_inserted", "error_code", "message", "created_at"],
+        function (td, col, row) {
+          if (col === "status" && row.status === "ERROR") td.className = "error";
+        }));
+    }).catch(fail);
+  }
+
+  // --- saved queries ---
+
+  function loadQueries() {
+    api("/queries").then(function (queries) {
+      fill("queries-list", grid(queries, ["id", "name", "description", "sql_text", "run"],
+        function (td, col, row) {
+          if (col === "run") td.appendChild(link("Run", function () { runQuery(row.id); }));
+        }));
+    }).catch(fail);
+  }
+
+  function runQuery(id) {
+    api("/queries/run/" + id).then(function (body) {
+      var out = el("div");
+      out.appendChild(el("h3", "Query " + id + " (" + body.result.length + " rows)"));
+      out.appendChild(grid(body.result));
+      fill("query-result", out);
+    }).catch(fail);
+  }
+
+  // --- navigation ---
+
+  var loaders = { tables: loadTables, preview: null, logs: loadLogs, queries: loadQueries };
+
+  function show() {
+    var page = (location.hash || "#tables").slice(1);
+    if (!(page in loaders)) page = "tables";
+    document.getElementById("error").hidden = true;
+    Object.keys(loaders).forEach(function (p) {
+      document.getElementById(p).hidden = p !== page;
+    });
+    document.querySelectorAll("header nav a").forEach(function (a) {
+      a.className = a.getAttribute("href") === "#" + page ? "active" : "";
+    });
+    if (loaders[page]) loaders[page]();
+  }
+
+  window.addEventListener("hashchange", show);
+  show();
+})();
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminUI is the admin single-page app served under /ui. It is plain
+// HTML/JS calling the /v1 API, so it needs no build step; the page asks
+// for the API key and sends it with every request.
+//
+//go:embed ui
+var adminUI embed.FS
+
+// UIHandler serves the embedded admin UI
+type UIHandler struct {
+	files http.Handler
+}
+
+// NewUIHandler serves the ui directory of the embedded assets
+func NewUIHandler() *UIHandler {
+	sub, _ := fs.Sub(adminUI, "ui") // the directory is embedded, so this can't fail
+	return &UIHandler{files: http.StripPrefix("/ui", http.FileServer(http.FS(sub)))}
+}
+
+// GET /ui/*path
+func (h *UIHandler) Serve(c *gin.Context) {
+	h.files.ServeHTTP(c.Writer, c.Request)
+}
+
+// GET /ui
+func (h *UIHandler) Redirect(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, "/ui/")
+}
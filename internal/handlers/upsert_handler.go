@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// UpsertRequest is the expected payload for POST /upsert/:name
+type UpsertRequest struct {
+	// Key names the conflict columns; they need a primary key or unique
+	// index. Empty uses the table's primary key.
+	Key []string `json:"key,omitempty"`
+
+	// Rows are the current-state records; the keys of the first name the
+	// columns. A later row with the same key replaces an earlier one.
+	Rows []map[string]interface{} `json:"rows"`
+}
+
+// POST /upsert/:name
+// Inserts rows, updating the existing row instead when one has the same
+// key (INSERT … ON CONFLICT DO UPDATE), so producers can push the current
+// state of records repeatedly without creating duplicates.
+func (h *DataIngestHandler) Upsert(c *gin.Context) {
+	tableName := c.Param("name")
+	if err := h.CheckTable(tableName); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := h.Quotas.AllowIngest(tableName); err != nil {
+		rateLimited(c, err)
+		return
+	}
+
+	body, ok := h.readBody(c)
+	if !ok {
+		return
+	}
+	var req UpsertRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON", "details": err.Error()})
+		return
+	}
+
+	key, n, err := h.UpsertRows(tableName, req)
+	if err != nil {
+		if re, ok := err.(*RequestError); ok && re.Status == http.StatusRequestEntityTooLarge {
+			h.tooLarge(c, re.Details)
+			return
+		}
+		writeError(c, err)
+		return
+	}
+	h.Stats.Record(tableName, n, int64(len(body)))
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "rows upserted",
+		"table_name": tableName,
+		"row_count":  n,
+		"key":        key,
+	})
+}
+
+// UpsertRows writes req.Rows into a table already passed through
+// CheckTable and returns the conflict key used and the number of rows
+// written. Rows are deduplicated by key and written in one transaction,
+// in statements sized to the driver's bind parameter limit. Rows with a new
+// key count toward the table's row quota.
+func (h *DataIngestHandler) UpsertRows(tableName string, req UpsertRequest) ([]string, int, error) {
+	if len(req.Rows) == 0 {
+		return nil, 0, requestError(http.StatusBadRequest, "no data provided", nil)
+	}
+	if max := h.Limits.MaxRows; max > 0 && len(req.Rows) > max {
+		return nil, 0, requestError(http.StatusRequestEntityTooLarge, "payload too large",
+			fmt.Errorf("payload has %d records, limit is %d", len(req.Rows), max))
+	}
+	// Every row may be new, so the quota is checked as for an insert
+	if err := h.Quotas.CheckRows(tableName, len(req.Rows)); err != nil {
+		return nil, 0, quotaError(err, "failed to check quota")
+	}
+
+	tableCols, err := db.TableColumns(h.DB, tableName)
+	if err != nil {
+		log.Printf("column lookup error: table=%s err=%v", tableName, err)
+		return nil, 0, requestError(http.StatusInternalServerError, "failed to load table columns", nil)
+	}
+	known := make(map[string]bool, len(tableCols))
+	for _, col := range tableCols {
+		known[col.ColumnName] = true
+	}
+
+	key := req.Key
+	if len(key) == 0 {
+		if key, err = db.PrimaryKey(h.DB, tableName); err != nil {
+			log.Printf("primary key lookup error: table=%s err=%v", tableName, err)
+			return nil, 0, requestError(http.StatusInternalServerError, "failed to load primary key", nil)
+		}
+		if len(key) == 0 {
+			return nil, 0, requestError(http.StatusBadRequest, "key is required", fmt.Errorf("%s has no primary key", tableName))
+		}
+	}
+	for _, col := range key {
+		if !known[col] {
+			return nil, 0, requestError(http.StatusBadRequest, "invalid key", fmt.Errorf("unknown column %q", col))
+		}
+	}
+
+	// Rows without a managed key are new rows: they get a generated key
+	managed, err := db.LoadManagedKey(h.DB, tableName)
+	if err != nil {
+		return nil, 0, requestError(http.StatusInternalServerError, "failed to load managed key", err)
+	}
+	if managed != nil && len(key) == 1 && key[0] == managed.Column {
+		for _, row := range req.Rows {
+			managed.Fill(row)
+		}
+	}
+
+	if db.HasProvenance(tableCols) {
+		db.NewProvenance("upsert").Stamp(req.Rows)
+	}
+	cols := make([]string, 0, len(req.Rows[0]))
+	for col := range req.Rows[0] {
+		if !known[col] {
+			return nil, 0, requestError(http.StatusBadRequest, "invalid rows", fmt.Errorf("unknown column %q", col))
+		}
+		cols = append(cols, col)
+	}
+	if err := h.checkAllowed(tableName, req.Rows); err != nil {
+		return nil, 0, err
+	}
+	rows, err := dedupeByKey(req.Rows, key)
+	if err != nil {
+		return nil, 0, requestError(http.StatusBadRequest, "invalid rows", err)
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, 0, requestError(http.StatusInternalServerError, "failed to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	inserted := len(rows)
+	batch := max(db.MaxBindParams(h.DB)/len(cols), 1)
+	for start := 0; start < len(rows); start += batch {
+		chunk := rows[start:min(start+batch, len(rows))]
+		existing, err := countExisting(tx, tableName, key, chunk)
+		if err != nil {
+			return nil, 0, requestError(http.StatusInternalServerError, "failed to upsert data", err)
+		}
+		inserted -= existing
+		query, args := upsertStatement(tableName, cols, key, chunk)
+		if _, err := tx.Exec(query, args...); err != nil {
+			log.Printf("upsert error: table=%s err=%v", tableName, err)
+			if isNoConflictTarget(err) {
+				return nil, 0, requestError(http.StatusBadRequest, "invalid key",
+					fmt.Errorf("(%s) needs a primary key or unique index on %s", strings.Join(key, ", "), tableName))
+			}
+			return nil, 0, requestError(http.StatusInternalServerError, "failed to upsert data", err)
+		}
+	}
+	if err := h.CDC.RecordUpsert(tx, tableName, "upsert", rows); err != nil {
+		return nil, 0, requestError(http.StatusInternalServerError, "failed to queue change capture", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, 0, requestError(http.StatusInternalServerError, "failed to commit upsert", err)
+	}
+
+	h.CDC.Notify()
+	h.Quotas.Added(tableName, inserted)
+	data := map[string]interface{}{"row_count": len(rows), "upsert": true, "key": key}
+	if len(rows) <= maxEventRows {
+		data["rows"] = rows
+	}
+	h.Events.Publish(events.Event{Type: events.RowsIngested, Table: tableName, Data: data})
+	return key, len(rows), nil
+}
+
+// dedupeByKey keeps the last row for each key, in first-seen order; a
+// statement may not update the same row twice
+func dedupeByKey(rows []map[string]interface{}, key []string) ([]map[string]interface{}, error) {
+	index := make(map[string]int, len(rows))
+	out := make([]map[string]interface{}, 0, len(rows))
+	for i, row := range rows {
+		values := make([]interface{}, len(key))
+		for j, col := range key {
+			if row[col] == nil {
+				return nil, fmt.Errorf("row %d: key column %s is missing or null", i+1, col)
+			}
+			values[j] = row[col]
+		}
+		id, _ := json.Marshal(values)
+		if at, ok := index[string(id)]; ok {
+			out[at] = row
+			continue
+		}
+		index[string(id)] = len(out)
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+// countExisting returns how many of rows already have a row with the same
+// key, so the rest are the ones an upsert inserts
+func countExisting(tx *sqlx.Tx, tableName string, key []string, rows []map[string]interface{}) (int, error) {
+	args := make([]interface{}, 0, len(rows)*len(key))
+	matches := make([]string, len(rows))
+	for i, row := range rows {
+		conds := make([]string, len(key))
+		for j, col := range key {
+			args = append(args, row[col])
+			conds[j] = fmt.Sprintf("%s = $%d", db.QuoteIdent(col), len(args))
+		}
+		matches[i] = "(" + strings.Join(conds, " AND ") + ")"
+	}
+	var n int
+	err := tx.Get(&n, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", db.QuoteTable(tableName), strings.Join(matches, " OR ")), args...)
+	return n, err
+}
+
+// upsertStatement builds INSERT … ON CONFLICT (key) DO UPDATE for rows,
+// setting every non-key column from the incoming row
+func upsertStatement(tableName string, cols, key []string, rows []map[string]interface{}) (string, []interface{}) {
+	isKey := make(map[string]bool, len(key))
+	for _, col := range key {
+		isKey[col] = true
+	}
+
+	insert, args := insertStatement(tableName, cols, rows)
+	sets := []string{}
+	for _, col := range cols {
+		if !isKey[col] {
+			q := db.QuoteIdent(col)
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", q, q))
+		}
+	}
+	action := "DO NOTHING"
+	if len(sets) > 0 {
+		action = "DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+	return fmt.Sprintf("%s ON CONFLICT (%s) %s", insert, quoteColumns(key), action), args
+}
+
+// isNoConflictTarget reports whether err says the conflict columns have
+// no matching unique constraint (Postgres 42P10, or SQLite's message)
+func isNoConflictTarget(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "42P10") ||
+		strings.Contains(msg, "no unique or exclusion constraint") ||
+		strings.Contains(msg, "does not match any PRIMARY KEY or UNIQUE constraint")
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SupportedAPIVersions lists the REST API versions this build serves, oldest first
+var SupportedAPIVersions = []string{"1"}
+
+// acceptVersionRE matches a versioned media type, e.g. application/vnd.godataflow.v1+json
+var acceptVersionRE = regexp.MustCompile(`application/vnd\.godataflow\.v(\d+)\+json`)
+
+// APIVersion pins a route group to one API version. Responses carry
+// API-Version and API-Supported-Versions headers; a request asking for another
+// version (API-Version header, or Accept: application/vnd.godataflow.v<N>+json)
+// gets 406 instead of a response shaped for the wrong version.
+func APIVersion(version string) gin.HandlerFunc {
+	supported := strings.Join(SupportedAPIVersions, ", ")
+	return func(c *gin.Context) {
+		c.Header("API-Version", version)
+		c.Header("API-Supported-Versions", supported)
+
+		requested := strings.TrimPrefix(strings.TrimSpace(c.GetHeader("API-Version")), "v")
+		if requested == "" {
+			if m := acceptVersionRE.FindStringSubmatch(c.GetHeader("Accept")); m != nil {
+				requested = m[1]
+			}
+		}
+		if requested != "" && requested != version {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{
+				"error":     "unsupported API version for this route",
+				"details":   "requested v" + requested + ", " + c.Request.URL.Path + " serves v" + version,
+				"supported": SupportedAPIVersions,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// LegacyRoute marks unprefixed routes kept for integrations that predate
+// versioning: they behave exactly like the successor under prefix (e.g. /v1)
+// and advertise it with Deprecation and Link headers.
+func LegacyRoute(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+prefix+c.Request.URL.Path+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/workspace"
+	"github.com/gin-gonic/gin"
+)
+
+// workspaceKey is the gin context key APIKeyAuth stores a workspace key's workspace under
+const workspaceKey = "workspace"
+
+// keyScopeKey is the gin context key APIKeyAuth stores a workspace key's scope under
+const keyScopeKey = "key_scope"
+
+// currentWorkspace is the workspace the request acts in; nil is the default workspace
+func currentWorkspace(c *gin.Context) *workspace.Workspace {
+	if v, ok := c.Get(workspaceKey); ok {
+		return v.(*workspace.Workspace)
+	}
+	return nil
+}
+
+// workspaceRoutes are the routes a full-scope workspace key may call
+// (method and path without the /v1 prefix). Everything else spans
+// workspaces (events, GraphQL, replicas, admin) and stays with the
+// default workspace.
+var workspaceRoutes = map[string]bool{
+	"GET /tables":                                    true,
+	"POST /tables":                                   true,
+	"POST /tables/bulk":                              true,
+	"GET /tables/:name":                              true,
+	"DELETE /tables/:name":                           true,
+	"GET /tables/:name/columns":                      true,
+	"GET /tables/:name/columns/:col/stats":           true,
+	"PUT /tables/:name/config":                       true,
+	"POST /ingest/:table_name":                       true,
+	"POST /ingest/:table_name/validate":              true,
+	"POST /ingest/:table_name/jobs":                  true,
+	"GET /ingest/jobs":                               true,
+	"GET /ingest/jobs/:id":                           true,
+	"GET /tables/:name/ingest_stats":                 true,
+	"POST /upsert/:name":                             true,
+	"PATCH /tables/:name/rows":                       true,
+	"DELETE /tables/:name/rows":                      true,
+	"GET /query":                                     true,
+	"GET /transform":                                 true,
+	"GET /tables/:name/sample":                       true,
+	"GET /tables/:name/fields":                       true,
+	"GET /tables/:name/rows/:pk":                     true,
+	"GET /tables/:name/export":                       true,
+	"POST /tables/:name/export/sheets":               true,
+	"POST /tables/:name/snapshot":                    true,
+	"GET /tables/:name/snapshots":                    true,
+	"POST /tables/:name/snapshots/:snapshot/restore": true,
+	"DELETE /tables/:name/snapshots/:snapshot":       true,
+	"POST /tables/:name/import":                      true,
+	"GET /tables/:name/imports":                      true,
+	"GET /tables/:name/imports/:id":                  true,
+	"GET /queries":                                   true,
+	"POST /queries":                                  true,
+	"GET /queries/run/:id":                           true,
+	"POST /queries/:id/sheets":                       true,
+	"POST /refresh/:table":                           true,
+	"GET /refresh_logs/:table":                       true,
+	"GET /refresh_logs/:table/daily":                 true,
+	"GET /runs/:id":                                  true,
+	"POST /runs/:id/retry":                           true,
+	"GET /tables/:name/quality":                      true,
+	"GET /tables/:name/schema-changes":               true,
+	"GET /tables/:name/reconciliation":               true,
+	"POST /tables/:name/reconcile":                   true,
+	"GET /tables/:name/sinks":                        true,
+	"POST /tables/:name/sinks":                       true,
+	"DELETE /tables/:name/sinks/:id":                 true,
+	"POST /tables/:name/sinks/:id/run":               true,
+	"GET /preview_source":                            true,
+	"POST /transform/preview":                        true,
+	"GET /ws/tables/:name":                           true,
+	"GET /usage":                                     true,
+	"GET /keys":                                      true,
+	"POST /keys":                                     true,
+	"DELETE /keys/:id":                               true,
+}
+
+// scopedRoutes are the subsets of workspaceRoutes that narrower keys may call
+var scopedRoutes = map[string]map[string]bool{
+	// Ingest keys write payloads they choose: every write route here must
+	// refuse record keys that aren't columns of the table (checkColumns,
+	// checkRecord, UpsertRows) and quote the identifiers it writes
+	workspace.ScopeIngest: {
+		"POST /ingest/:table_name":          true,
+		"POST /ingest/:table_name/validate": true,
+		"POST /ingest/:table_name/jobs":     true,
+		"GET /ingest/jobs":                  true,
+		"GET /ingest/jobs/:id":              true,
+		"POST /upsert/:name":                true,
+		"GET /tables":                       true,
+		"GET /tables/:name":                 true,
+		"GET /tables/:name/columns":         true,
+		"GET /usage":                        true,
+	},
+	workspace.ScopeQuery: {
+		"GET /tables":                          true,
+		"GET /tables/:name":                    true,
+		"GET /tables/:name/columns":            true,
+		"GET /tables/:name/columns/:col/stats": true,
+		"GET /query":                           true,
+		"GET /transform":                       true,
+		"GET /tables/:name/sample":             true,
+		"GET /tables/:name/fields":             true,
+		"GET /tables/:name/rows/:pk":           true,
+		"GET /tables/:name/export":             true,
+		"GET /tables/:name/snapshots":          true,
+		"GET /queries":                         true,
+		"GET /queries/run/:id":                 true,
+		"GET /refresh_logs/:table":             true,
+		"GET /refresh_logs/:table/daily":       true,
+		"GET /runs/:id":                        true,
+		"GET /tables/:name/quality":            true,
+		"GET /tables/:name/schema-changes":     true,
+		"GET /tables/:name/reconciliation":     true,
+		"GET /tables/:name/ingest_stats":       true,
+		"GET /ws/tables/:name":                 true,
+		"GET /usage":                           true,
+	},
+}
+
+// tableParams are the path and query parameters that name a table
+var tableParams = []string{"name", "table", "table_name", "snapshot"}
+
+// WorkspaceScope confines requests made with a workspace key: only
+// workspaceRoutes (or, for ingest and query keys, their scopedRoutes) are
+// served, and table names in the path or the table
+// query parameter are resolved into the workspace's schema, so handlers
+// see the qualified name ("sales" becomes "ws_acme.sales").
+func WorkspaceScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ws := currentWorkspace(c)
+		if ws == nil || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		route := c.Request.Method + " " + strings.TrimPrefix(c.FullPath(), "/v1")
+		if !workspaceRoutes[route] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available to workspace API keys", "details": route})
+			return
+		}
+		if scope := c.GetString(keyScopeKey); scope != workspace.ScopeFull && !scopedRoutes[scope][route] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available to " + scope + " API keys", "details": route})
+			return
+		}
+
+		for i, p := range c.Params {
+			for _, name := range tableParams {
+				if p.Key != name {
+					continue
+				}
+				qualified, err := ws.Qualify(p.Value)
+				if err != nil {
+					writeError(c, workspaceError(err, "invalid table name"))
+					c.Abort()
+					return
+				}
+				c.Params[i].Value = qualified
+			}
+		}
+		if table := c.Request.URL.Query().Get("table"); table != "" {
+			qualified, err := ws.Qualify(table)
+			if err != nil {
+				writeError(c, workspaceError(err, "invalid table name"))
+				c.Abort()
+				return
+			}
+			q := c.Request.URL.Query()
+			q.Set("table", qualified)
+			c.Request.URL.RawQuery = q.Encode()
+		}
+		c.Next()
+	}
+}
+
+// ScopeAllows reports whether a workspace key of scope may call route
+// (method and path without the /v1 prefix), as WorkspaceScope checks it.
+// The gRPC API checks each method against the REST route it mirrors.
+func ScopeAllows(scope, route string) bool {
+	return workspaceRoutes[route] && (scope == workspace.ScopeFull || scopedRoutes[scope][route])
+}
+
+// QualifyTable resolves table into ws's schema as WorkspaceScope does,
+// for callers outside gin (the gRPC API)
+func QualifyTable(ws *workspace.Workspace, table string) (string, error) {
+	qualified, err := ws.Qualify(table)
+	if err != nil {
+		return "", workspaceError(err, "invalid table name")
+	}
+	return qualified, nil
+}
+
+// WorkspaceHandler manages workspaces; only default-workspace keys reach it
+type WorkspaceHandler struct {
+	Registry *workspace.Registry
+	AuthOn   bool // auth.api_keys is set; without it nothing keeps requests out of workspaces
+}
+
+func NewWorkspaceHandler(registry *workspace.Registry, authOn bool) *WorkspaceHandler {
+	return &WorkspaceHandler{Registry: registry, AuthOn: authOn}
+}
+
+// CreateWorkspaceRequest is the payload for POST /workspaces
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" binding:"required"` // lowercase letters, digits, _; the schema is ws_<name>
+}
+
+// GET /workspaces
+func (h *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	list, err := h.Registry.List()
+	if err != nil {
+		writeError(c, requestError(http.StatusInternalServerError, "failed to list workspaces", err))
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// POST /workspaces
+// Creates the workspace's schema and role and returns its first API key,
+// which is not shown again
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	var req CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+		return
+	}
+	if !h.AuthOn {
+		writeError(c, requestError(http.StatusConflict, "workspaces need auth.api_keys",
+			errors.New("without API keys every request can read every workspace")))
+		return
+	}
+	ws, key, err := h.Registry.Create(req.Name)
+	if err != nil {
+		writeError(c, workspaceError(err, "failed to create workspace"))
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"workspace": ws, "api_key": key})
+}
+
+// GET /workspaces/:name
+func (h *WorkspaceHandler) GetWorkspace(c *gin.Context) {
+	ws, err := h.Registry.Get(c.Param("name"))
+	if err != nil {
+		writeError(c, workspaceError(err, "failed to load workspace"))
+		return
+	}
+	c.JSON(http.StatusOK, ws)
+}
+
+// DELETE /workspaces/:name
+// Drops the workspace's schema, role, keys and saved queries; its tables
+// must be deleted first
+func (h *WorkspaceHandler) DeleteWorkspace(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.Registry.Delete(name); err != nil {
+		writeError(c, workspaceError(err, "failed to delete workspace"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "workspace deleted", "workspace": name})
+}
+
+// GET /workspaces/:name/keys
+func (h *WorkspaceHandler) ListKeys(c *gin.Context) {
+	h.listKeys(c, c.Param("name"))
+}
+
+// POST /workspaces/:name/keys
+// The optional body sets the key's label, scope and expiry
+func (h *WorkspaceHandler) IssueKey(c *gin.Context) {
+	h.issueKey(c, c.Param("name"))
+}
+
+// DELETE /workspaces/:name/keys/:id
+func (h *WorkspaceHandler) RevokeKey(c *gin.Context) {
+	h.revokeKey(c, c.Param("name"))
+}
+
+// GET /keys
+// The calling workspace key's own workspace
+func (h *WorkspaceHandler) ListOwnKeys(c *gin.Context) {
+	if name, ok := ownWorkspace(c); ok {
+		h.listKeys(c, name)
+	}
+}
+
+// POST /keys
+// Issues a key in the calling workspace key's workspace, typically a
+// narrower one to hand to a producer or dashboard
+func (h *WorkspaceHandler) IssueOwnKey(c *gin.Context) {
+	if name, ok := ownWorkspace(c); ok {
+		h.issueKey(c, name)
+	}
+}
+
+// DELETE /keys/:id
+func (h *WorkspaceHandler) RevokeOwnKey(c *gin.Context) {
+	if name, ok := ownWorkspace(c); ok {
+		h.revokeKey(c, name)
+	}
+}
+
+// ownWorkspace is the name of the caller's workspace; default-workspace
+// keys are told to use /workspaces/:name/keys
+func ownWorkspace(c *gin.Context) (string, bool) {
+	ws := currentWorkspace(c)
+	if ws == nil {
+		writeError(c, requestError(http.StatusBadRequest, "not a workspace API key",
+			errors.New("manage a workspace's keys at /workspaces/:name/keys")))
+		return "", false
+	}
+	return ws.Name, true
+}
+
+func (h *WorkspaceHandler) listKeys(c *gin.Context, name string) {
+	keys, err := h.Registry.Keys(name)
+	if err != nil {
+		writeError(c, workspaceError(err, "failed to list keys"))
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (h *WorkspaceHandler) issueKey(c *gin.Context, name string) {
+	var opts workspace.KeyOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			writeError(c, requestError(http.StatusBadRequest, "invalid request body", err))
+			return
+		}
+	}
+	k, key, err := h.Registry.IssueKey(name, opts)
+	if err != nil {
+		writeError(c, workspaceError(err, "failed to issue key"))
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"key": k, "api_key": key})
+}
+
+func (h *WorkspaceHandler) revokeKey(c *gin.Context, name string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, requestError(http.StatusBadRequest, "invalid key id", nil))
+		return
+	}
+	if err := h.Registry.RevokeKey(name, id); err != nil {
+		writeError(c, workspaceError(err, "failed to revoke key"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "key revoked", "id": id})
+}
+
+// workspaceError maps workspace errors to HTTP statuses
+func workspaceError(err error, msg string) error {
+	switch {
+	case errors.Is(err, workspace.ErrNotFound):
+		return requestError(http.StatusNotFound, "not found", err)
+	case errors.Is(err, workspace.ErrInvalid):
+		return requestError(http.StatusBadRequest, "invalid workspace request", err)
+	case errors.Is(err, workspace.ErrForeign):
+		return requestError(http.StatusForbidden, "forbidden", err)
+	case errors.Is(err, workspace.ErrExists), errors.Is(err, workspace.ErrNotEmpty):
+		return requestError(http.StatusConflict, "conflict", err)
+	case errors.Is(err, workspace.ErrUnsupported):
+		return requestError(http.StatusNotImplemented, "not supported", err)
+	}
+	return requestError(http.StatusInternalServerError, msg, err)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = wsPingInterval + 10*time.Second
+)
+
+// TableSocketHandler pushes a table's data changes to WebSocket clients
+type TableSocketHandler struct {
+	Broker   *events.Broker
+	Ingests  *DataIngestHandler // used to check the table is registered
+	upgrader websocket.Upgrader
+}
+
+func NewTableSocketHandler(broker *events.Broker, ingests *DataIngestHandler) *TableSocketHandler {
+	return &TableSocketHandler{
+		Broker:  broker,
+		Ingests: ingests,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 4096,
+		},
+	}
+}
+
+// GET /ws/tables/:name
+// Sends a JSON event whenever rows land in the table: "rows.ingested" after
+// POST /ingest (with the rows for small batches), "rows.updated" and
+// "rows.deleted" after PATCH and DELETE /tables/:name/rows, and
+// "job.succeeded" after a refresh that inserted rows. Pings keep idle connections alive.
+func (h *TableSocketHandler) Subscribe(c *gin.Context) {
+	if h.Broker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "event stream not available"})
+		return
+	}
+	table := c.Param("name")
+	if err := h.Ingests.CheckTable(table); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // the upgrader has already answered
+	}
+	defer conn.Close()
+
+	sub := h.Broker.Subscribe()
+	defer h.Broker.Unsubscribe(sub)
+
+	// Clients only send control frames; reading them handles pongs and closes
+	closed := make(chan struct{})
+	conn.SetReadLimit(4096)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if ev.Table != table || !dataChanged(ev) {
+				continue
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// dataChanged reports whether ev means rows were written to its table
+func dataChanged(ev events.Event) bool {
+	switch ev.Type {
+	case events.RowsIngested, events.RowsUpdated, events.RowsDeleted:
+		return true
+	case events.JobSucceeded:
+		n, _ := ev.Data["inserted_rows"].(int)
+		return n > 0
+	}
+	return false
+}
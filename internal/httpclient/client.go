@@ -0,0 +1,52 @@
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Options configures the shared outbound HTTP client
+type Options struct {
+	ConnectTimeout        time.Duration // TCP dial and TLS handshake
+	ResponseHeaderTimeout time.Duration // wait for response headers after the request is sent
+	IdleConnTimeout       time.Duration // how long idle keep-alive connections are kept
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	ProxyURL              string // empty = HTTP_PROXY/HTTPS_PROXY/NO_PROXY from the environment
+}
+
+// New builds an http.Client with keep-alive pooling tuned by opts.
+// It sets no overall Timeout: callers bound each request with a context,
+// since a large ETL download and a quick preview need different limits.
+func New(opts Options) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		u, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,537 @@
+// Package importer bulk-loads files into tables: CSV and NDJSON exports
+// (GET /tables/:name/export) and backup archives (GET /admin/backup).
+// Files arrive as uploads or references to a URL or a file under the
+// configured import directory. Each import runs in the background and
+// reports its progress while it loads.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/backup"
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/jmoiron/sqlx"
+)
+
+// Import formats
+const (
+	CSV     = "csv"
+	NDJSON  = "ndjson"
+	Archive = "archive" // gzipped tarball from GET /admin/backup
+)
+
+// Job statuses
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Finished jobs kept for GET /tables/:name/imports
+const maxJobs = 100
+
+// Rows loaded per chunk (each chunk is one COPY on Postgres)
+const defaultChunkSize = 5000
+
+var (
+	// ErrInvalid wraps every problem with the request or the file's layout
+	ErrInvalid = errors.New("invalid import")
+	// ErrNoTable is returned when a CSV or NDJSON import targets a missing table
+	ErrNoTable = errors.New("table not found")
+	// ErrNotFound is returned for an unknown import id
+	ErrNotFound = errors.New("import not found")
+	// ErrFetch is returned when a referenced URL cannot be downloaded
+	ErrFetch = errors.New("fetch failed")
+)
+
+// Job is an import and its progress
+type Job struct {
+	ID           string     `json:"id"`
+	Table        string     `json:"table"`
+	Format       string     `json:"format"`
+	Source       string     `json:"source"`
+	Status       string     `json:"status"`
+	TableCreated bool       `json:"table_created"`         // recreated from the archive's schema
+	Rows         int64      `json:"rows"`                  // loaded so far
+	BytesRead    int64      `json:"bytes_read"`            // of the file, as received
+	TotalBytes   *int64     `json:"total_bytes,omitempty"` // unknown for streamed references
+	Error        string     `json:"error,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// Source is an opened import file
+type Source struct {
+	Body   io.ReadCloser
+	Size   int64  // -1 when unknown
+	Name   string // file name or URL, for the job and format detection
+	Format string // empty = detect
+}
+
+// Importer validates and runs imports
+type Importer struct {
+	DB     *sqlx.DB
+	ETL    *etl.ETLProcessor
+	Events *events.Broker
+	Client *http.Client
+	Dir    string // file:// references must be under it; empty disables them
+
+	mu   sync.Mutex
+	jobs []*Job
+}
+
+func NewImporter(db *sqlx.DB, etlProc *etl.ETLProcessor, broker *events.Broker, client *http.Client, dir string) *Importer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Importer{DB: db, ETL: etlProc, Events: broker, Client: client, Dir: dir}
+}
+
+// Open resolves a file reference: an http(s) URL or a file:// path under Dir
+func (im *Importer) Open(ctx context.Context, ref string) (Source, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return Source{}, fmt.Errorf("%w: url: %v", ErrInvalid, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+		if err != nil {
+			return Source{}, fmt.Errorf("%w: url: %v", ErrInvalid, err)
+		}
+		resp, err := im.Client.Do(req)
+		if err != nil {
+			return Source{}, fmt.Errorf("%w: %s: %v", ErrFetch, ref, err)
+		}
+		if resp.StatusCode/100 != 2 {
+			resp.Body.Close()
+			return Source{}, fmt.Errorf("%w: %s: %s", ErrFetch, ref, resp.Status)
+		}
+		return Source{Body: resp.Body, Size: resp.ContentLength, Name: u.Path}, nil
+	case "file":
+		if im.Dir == "" {
+			return Source{}, fmt.Errorf("%w: file:// references are disabled (set ingest.import_dir)", ErrInvalid)
+		}
+		dir, err := filepath.Abs(im.Dir)
+		if err != nil {
+			return Source{}, err
+		}
+		path := filepath.Clean(u.Path)
+		if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return Source{}, fmt.Errorf("%w: %s is outside the import directory", ErrInvalid, path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return Source{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return Source{}, err
+		}
+		return Source{Body: f, Size: info.Size(), Name: path}, nil
+	}
+	return Source{}, fmt.Errorf("%w: url must use http, https or file", ErrInvalid)
+}
+
+// Start validates src against table and loads it in the background.
+// Archives recreate a missing table from their schema (registered with
+// tableType); CSV and NDJSON need the table to exist. Start takes ownership
+// of src.Body.
+func (im *Importer) Start(table, tableType string, src Source) (*Job, error) {
+	ok := false
+	defer func() {
+		if !ok {
+			src.Body.Close()
+		}
+	}()
+
+	t, err := db.ParseTableName(table)
+	if err == nil {
+		err = db.CheckSchemaSupport(im.DB, t)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: table name: %v", ErrInvalid, err)
+	}
+
+	job := &Job{ID: newID(), Table: table, Source: src.Name, Status: StatusRunning, StartedAt: time.Now().UTC()}
+	if src.Size >= 0 {
+		size := src.Size
+		job.TotalBytes = &size
+	}
+	counter := &countingReader{r: src.Body, job: job, mu: &im.mu}
+	br := bufio.NewReaderSize(counter, 64<<10)
+
+	job.Format = src.Format
+	if job.Format == "" {
+		job.Format = detect(src.Name, br)
+	}
+
+	var next rowReader
+	switch job.Format {
+	case Archive:
+		next, job.TableCreated, err = im.openArchive(t, tableType, br)
+	case CSV, NDJSON:
+		next, err = im.openFlat(table, job.Format, br)
+	default:
+		err = fmt.Errorf("%w: format must be csv, ndjson or archive, got %q", ErrInvalid, job.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	im.mu.Lock()
+	im.jobs = append(im.jobs, job)
+	if len(im.jobs) > maxJobs {
+		im.jobs = im.jobs[len(im.jobs)-maxJobs:]
+	}
+	im.mu.Unlock()
+
+	ok = true
+	go im.run(job, src.Body, next)
+	return im.snapshot(job), nil
+}
+
+// Jobs returns table's imports, newest first
+func (im *Importer) Jobs(table string) []Job {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	jobs := []Job{}
+	for i := len(im.jobs) - 1; i >= 0; i-- {
+		if im.jobs[i].Table == table {
+			jobs = append(jobs, *im.jobs[i])
+		}
+	}
+	return jobs
+}
+
+// Job returns one of table's imports
+func (im *Importer) Job(table, id string) (Job, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	for _, j := range im.jobs {
+		if j.ID == id && j.Table == table {
+			return *j, nil
+		}
+	}
+	return Job{}, fmt.Errorf("%s: %w", id, ErrNotFound)
+}
+
+func (im *Importer) snapshot(job *Job) *Job {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	j := *job
+	return &j
+}
+
+// rowReader returns the next row, or io.EOF
+type rowReader func() (map[string]interface{}, error)
+
+// run loads every row in chunks, publishing progress after each one
+func (im *Importer) run(job *Job, body io.Closer, next rowReader) {
+	defer body.Close()
+
+	chunkSize := im.ETL.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	chunk := make([]map[string]interface{}, 0, chunkSize)
+	load := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		rows, err := im.ETL.ValidatePayload(job.Table, chunk)
+		if err != nil {
+			return err
+		}
+		if err := im.ETL.Quotas.CheckRows(job.Table, len(rows)); err != nil {
+			return err
+		}
+		n, err := im.ETL.BulkLoad(job.Table, rows, im.ETL.Capture(job.Table, "import", rows))
+		im.ETL.Quotas.Added(job.Table, n)
+		im.mu.Lock()
+		job.Rows += int64(n)
+		im.mu.Unlock()
+		chunk = chunk[:0]
+		if err != nil {
+			return err
+		}
+		im.ETL.CDC.Notify()
+		im.publish(job)
+		return nil
+	}
+
+	var err error
+	for {
+		var row map[string]interface{}
+		if row, err = next(); err != nil {
+			break
+		}
+		if chunk = append(chunk, row); len(chunk) == chunkSize {
+			if err = load(); err != nil {
+				break
+			}
+		}
+	}
+	if err == io.EOF {
+		err = load()
+	}
+
+	now := time.Now().UTC()
+	im.mu.Lock()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusSucceeded
+	}
+	rows := job.Rows
+	im.mu.Unlock()
+
+	if err != nil {
+		msg := fmt.Sprintf("Import failed after %d rows: %v", rows, err)
+		im.ETL.WriteRefreshLogError(job.Table, msg, err)
+	} else {
+		im.ETL.WriteRefreshLogRows(job.Table, "OK", fmt.Sprintf("Imported %d rows from %s", rows, job.Source), int(rows))
+	}
+	im.publish(job)
+}
+
+func (im *Importer) publish(job *Job) {
+	j := im.snapshot(job)
+	data := map[string]interface{}{"import_id": j.ID, "status": j.Status, "rows": j.Rows, "bytes_read": j.BytesRead}
+	if j.TotalBytes != nil {
+		data["total_bytes"] = *j.TotalBytes
+	}
+	if j.Error != "" {
+		data["error"] = j.Error
+	}
+	im.Events.Publish(events.Event{Type: events.ImportProgress, Table: j.Table, Data: data})
+}
+
+// openFlat checks a CSV header or the first NDJSON record against the
+// table's columns and returns a reader over the rows
+func (im *Importer) openFlat(table, format string, br *bufio.Reader) (rowReader, error) {
+	cols, err := db.TableColumns(im.DB, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%w: %s (CSV and NDJSON imports load into an existing table)", ErrNoTable, table)
+	}
+	known := map[string]bool{}
+	for _, c := range cols {
+		known[c.ColumnName] = true
+	}
+
+	if format == CSV {
+		cr := csv.NewReader(br)
+		cr.ReuseRecord = true
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("%w: csv header: %v", ErrInvalid, err)
+		}
+		header = append([]string(nil), header...)
+		if err := checkColumns(header, known); err != nil {
+			return nil, err
+		}
+		return func() (map[string]interface{}, error) {
+			rec, err := cr.Read()
+			if err != nil {
+				return nil, err
+			}
+			row := make(map[string]interface{}, len(header))
+			for i, name := range header {
+				if i < len(rec) && rec[i] != "" { // exports write NULL as an empty cell
+					row[name] = rec[i]
+				} else {
+					row[name] = nil
+				}
+			}
+			return row, nil
+		}, nil
+	}
+
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	var first map[string]interface{}
+	if err := dec.Decode(&first); err != nil {
+		return nil, fmt.Errorf("%w: first record: %v", ErrInvalid, err)
+	}
+	keys := make([]string, 0, len(first))
+	for k := range first {
+		keys = append(keys, k)
+	}
+	if err := checkColumns(keys, known); err != nil {
+		return nil, err
+	}
+	return func() (map[string]interface{}, error) {
+		if first != nil {
+			row := first
+			first = nil
+			return row, nil
+		}
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("%w: %v", ErrInvalid, err)
+			}
+			return nil, err
+		}
+		return row, nil
+	}, nil
+}
+
+// openArchive positions an archive at table's data, creating and
+// registering the table from the archived schema when it does not exist
+func (im *Importer) openArchive(t db.TableName, tableType string, br *bufio.Reader) (rowReader, bool, error) {
+	entry, r, err := backup.OpenTable(br, t.String())
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	cols, err := db.TableColumns(im.DB, t.String())
+	if err != nil {
+		return nil, false, err
+	}
+	created := false
+	if len(cols) == 0 {
+		if err := im.createTable(t, tableType, entry.Columns); err != nil {
+			return nil, false, err
+		}
+		created = true
+	} else {
+		known := map[string]bool{}
+		for _, c := range cols {
+			known[c.ColumnName] = true
+		}
+		names := make([]string, len(entry.Columns))
+		for i, c := range entry.Columns {
+			names[i] = c.ColumnName
+		}
+		if err := checkColumns(names, known); err != nil {
+			return nil, false, err
+		}
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return func() (map[string]interface{}, error) {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("%w: %v", ErrInvalid, err)
+			}
+			return nil, err
+		}
+		return row, nil
+	}, created, nil
+}
+
+func (im *Importer) createTable(t db.TableName, tableType string, cols []db.Column) error {
+	var registered int
+	if err := im.DB.Get(&registered, `SELECT COUNT(*) FROM table_metadata WHERE table_name = $1`, t.String()); err != nil {
+		return err
+	}
+	if registered > 0 {
+		return fmt.Errorf("%w: %s is registered but its table is missing", ErrInvalid, t)
+	}
+	if err := im.ETL.Quotas.CheckCreate(im.DB, t.String()); err != nil {
+		return err
+	}
+
+	tx, err := im.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := backup.CreateTable(tx, backup.TableEntry{Name: t.String(), Columns: cols}); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO table_metadata (table_name, table_type) VALUES ($1, $2)`, t.String(), tableType); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	im.Events.Publish(events.Event{Type: events.TableCreated, Table: t.String(), Message: "created by import"})
+	return nil
+}
+
+// checkColumns rejects file columns the table does not have
+func checkColumns(names []string, known map[string]bool) error {
+	var unknown []string
+	for _, n := range names {
+		if !known[n] {
+			unknown = append(unknown, n)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: columns not in the table: %s", ErrInvalid, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// detect picks the format from the file name, then from its first bytes
+func detect(name string, br *bufio.Reader) string {
+	switch lower := strings.ToLower(name); {
+	case strings.HasSuffix(lower, ".csv"):
+		return CSV
+	case strings.HasSuffix(lower, ".ndjson"), strings.HasSuffix(lower, ".jsonl"):
+		return NDJSON
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return Archive
+	}
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return Archive
+	case bytes.HasPrefix(head, []byte("PAR1")):
+		return "parquet"
+	case len(bytes.TrimSpace(head)) > 0 && bytes.TrimSpace(head)[0] == '{':
+		return NDJSON
+	}
+	return CSV
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// countingReader tracks bytes read into the job's progress
+type countingReader struct {
+	r   io.Reader
+	job *Job
+	mu  *sync.Mutex
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.mu.Lock()
+	c.job.BytesRead += int64(n)
+	c.mu.Unlock()
+	return n, err
+}
@@ -0,0 +1,195 @@
+// Package ingeststats counts the rows and payload bytes written through
+// the ingest API (POST /ingest, /upsert, ingest jobs and the gRPC stream)
+// per table in hourly buckets, for capacity planning and billing. Counts
+// are gathered in memory and flushed to ingest_stats every interval.
+package ingeststats
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Bucket is one table's ingest volume in one UTC hour
+type Bucket struct {
+	Hour  time.Time `db:"hour" json:"hour"`
+	Rows  int64     `db:"row_count" json:"rows"`
+	Bytes int64     `db:"byte_count" json:"bytes"`
+}
+
+type bucketKey struct {
+	table string
+	hour  time.Time
+}
+
+// Recorder counts ingests. A nil Recorder records nothing.
+type Recorder struct {
+	DB       *sqlx.DB
+	Interval time.Duration
+
+	mu      sync.Mutex
+	pending map[bucketKey]*Bucket
+}
+
+func NewRecorder(database *sqlx.DB, interval time.Duration) *Recorder {
+	return &Recorder{DB: database, Interval: interval, pending: map[bucketKey]*Bucket{}}
+}
+
+// Start flushes counts every Interval until ctx is done, then once more
+func (r *Recorder) Start(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	for {
+		select {
+		case <-time.After(r.Interval):
+		case <-ctx.Done():
+			if err := r.Flush(); err != nil {
+				log.Printf("ingest stats flush failed: %v", err)
+			}
+			return
+		}
+		if err := r.Flush(); err != nil {
+			log.Printf("ingest stats flush failed: %v", err)
+		}
+	}
+}
+
+// Record adds rows and payload bytes written to table now
+func (r *Recorder) Record(table string, rows int, bytes int64) {
+	if r == nil || (rows == 0 && bytes == 0) {
+		return
+	}
+	key := bucketKey{table, time.Now().UTC().Truncate(time.Hour)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.pending[key]
+	if !ok {
+		b = &Bucket{Hour: key.hour}
+		r.pending[key] = b
+	}
+	b.Rows += int64(rows)
+	b.Bytes += bytes
+}
+
+// Flush adds the pending counts to ingest_stats. Counts that fail to
+// write are kept for the next flush.
+func (r *Recorder) Flush() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[bucketKey]*Bucket{}
+	r.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := r.write(pending)
+	if err != nil {
+		r.mu.Lock()
+		for key, b := range pending {
+			if cur, ok := r.pending[key]; ok {
+				cur.Rows += b.Rows
+				cur.Bytes += b.Bytes
+			} else {
+				r.pending[key] = b
+			}
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *Recorder) write(pending map[bucketKey]*Bucket) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for key, b := range pending {
+		_, err := tx.Exec(`
+			INSERT INTO ingest_stats (table_name, hour, row_count, byte_count)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (table_name, hour) DO UPDATE SET
+			    row_count = ingest_stats.row_count + excluded.row_count,
+			    byte_count = ingest_stats.byte_count + excluded.byte_count`,
+			key.table, key.hour, b.Rows, b.Bytes)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Hourly returns table's buckets with since <= hour < until, oldest
+// first, including counts not flushed yet. Hours without ingests are
+// left out.
+func (r *Recorder) Hourly(table string, since, until time.Time) ([]Bucket, error) {
+	buckets := []Bucket{}
+	err := r.DB.Select(&buckets, `
+		SELECT hour, row_count, byte_count FROM ingest_stats
+		WHERE table_name = $1 AND hour >= $2 AND hour < $3
+		ORDER BY hour`,
+		table, since.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	merged := false
+	for key, b := range r.pending {
+		if key.table != table || key.hour.Before(since) || !key.hour.Before(until) {
+			continue
+		}
+		found := false
+		for i := range buckets {
+			if buckets[i].Hour.Equal(key.hour) {
+				buckets[i].Rows += b.Rows
+				buckets[i].Bytes += b.Bytes
+				found = true
+				break
+			}
+		}
+		if !found {
+			buckets = append(buckets, *b)
+			merged = true
+		}
+	}
+	if merged {
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].Hour.Before(buckets[j].Hour) })
+	}
+	for i := range buckets {
+		buckets[i].Hour = buckets[i].Hour.UTC()
+	}
+	return buckets, nil
+}
+
+// Rows sums the rows ingested into any table from since on, including
+// counts not flushed yet. Buckets are whole UTC hours, so the count
+// starts at the hour holding since.
+func (r *Recorder) Rows(since time.Time) (int64, error) {
+	if r == nil {
+		return 0, nil
+	}
+	from := since.UTC().Truncate(time.Hour)
+	var rows int64
+	if err := r.DB.Get(&rows, `SELECT COALESCE(SUM(row_count), 0) FROM ingest_stats WHERE hour >= $1`, from); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, b := range r.pending {
+		if !key.hour.Before(from) {
+			rows += b.Rows
+		}
+	}
+	return rows, nil
+}
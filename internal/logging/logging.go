@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Setup installs the process-wide slog handler with the given level and format.
+// Existing log.Printf calls are written through the same handler at INFO
+// level but are never dropped by the level: they include errors and the
+// log.Fatalf messages of a failed startup, so "warn" or "error" only
+// silences slog calls below it.
+func Setup(level, format string) {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+
+	var handler slog.Handler
+	if strings.ToLower(format) == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	// SetDefault points the log package at the level-filtered logger;
+	// replace that with a writer that hands records to the handler directly
+	log.SetOutput(bridge{handler})
+	log.SetFlags(0) // slog adds its own timestamp
+}
+
+// bridge writes log package output to a slog handler without consulting
+// its level
+type bridge struct {
+	handler slog.Handler
+}
+
+func (b bridge) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, msg, 0)
+	if err := b.handler.Handle(context.Background(), r); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
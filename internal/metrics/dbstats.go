@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"database/sql"
+)
+
+// DBStatsCollector exposes sql.DB pool statistics, labelled by pool name
+func DBStatsCollector(name string, db *sql.DB) Collector {
+	return CollectorFunc(func() []Sample {
+		st := db.Stats()
+		labels := map[string]string{"pool": name}
+		gauge := func(metric, help string, v float64) Sample {
+			return Sample{Name: metric, Help: help, Type: TypeGauge, Labels: labels, Value: v}
+		}
+		counter := func(metric, help string, v float64) Sample {
+			return Sample{Name: metric, Help: help, Type: TypeCounter, Labels: labels, Value: v}
+		}
+		return []Sample{
+			gauge("godataflow_db_max_open_connections", "Maximum number of open connections to the database.", float64(st.MaxOpenConnections)),
+			gauge("godataflow_db_open_connections", "Established connections, both in use and idle.", float64(st.OpenConnections)),
+			gauge("godataflow_db_in_use_connections", "Connections currently in use.", float64(st.InUse)),
+			gauge("godataflow_db_idle_connections", "Idle connections.", float64(st.Idle)),
+			counter("godataflow_db_wait_count_total", "Connections waited for because the pool was exhausted.", float64(st.WaitCount)),
+			counter("godataflow_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", st.WaitDuration.Seconds()),
+			counter("godataflow_db_max_idle_closed_total", "Connections closed due to max idle connections.", float64(st.MaxIdleClosed)),
+			counter("godataflow_db_max_idle_time_closed_total", "Connections closed due to max idle time.", float64(st.MaxIdleTimeClosed)),
+			counter("godataflow_db_max_lifetime_closed_total", "Connections closed due to max connection lifetime.", float64(st.MaxLifetimeClosed)),
+		}
+	})
+}
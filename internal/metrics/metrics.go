@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metric types as used in the Prometheus exposition format
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// Sample is one metric value with its labels
+type Sample struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector produces samples at scrape time (e.g. DB pool stats)
+type Collector interface {
+	Collect() []Sample
+}
+
+// CollectorFunc adapts a function to the Collector interface
+type CollectorFunc func() []Sample
+
+func (f CollectorFunc) Collect() []Sample { return f() }
+
+// Registry holds counters, gauges and collectors
+type Registry struct {
+	mu         sync.Mutex
+	vecs       []*Vec
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the process-wide registry served on /metrics
+var Default = NewRegistry()
+
+// Vec is a counter or gauge partitioned by label values
+type Vec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func (r *Registry) newVec(name, help, typ string, labelNames []string) *Vec {
+	v := &Vec{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		values:     map[string]float64{},
+		labels:     map[string][]string{},
+	}
+	r.mu.Lock()
+	r.vecs = append(r.vecs, v)
+	r.mu.Unlock()
+	return v
+}
+
+// NewCounter registers a monotonically increasing metric
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Vec {
+	return r.newVec(name, help, TypeCounter, labelNames)
+}
+
+// NewGauge registers a metric that can go up and down
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Vec {
+	return r.newVec(name, help, TypeGauge, labelNames)
+}
+
+// Register adds a scrape-time collector
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// Add increments the series identified by labelValues
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	v.values[key] += delta
+	v.labels[key] = labelValues
+	v.mu.Unlock()
+}
+
+// Inc adds 1
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Set overwrites the series value (gauges)
+func (v *Vec) Set(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	v.values[key] = value
+	v.labels[key] = labelValues
+	v.mu.Unlock()
+}
+
+func (v *Vec) samples() []Sample {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	out := make([]Sample, 0, len(v.values))
+	for key, val := range v.values {
+		labels := map[string]string{}
+		for i, name := range v.labelNames {
+			if i < len(v.labels[key]) {
+				labels[name] = v.labels[key][i]
+			}
+		}
+		out = append(out, Sample{Name: v.name, Help: v.help, Type: v.typ, Labels: labels, Value: val})
+	}
+	return out
+}
+
+// Gather returns every current sample, grouped by metric name
+func (r *Registry) Gather() []Sample {
+	r.mu.Lock()
+	vecs := append([]*Vec(nil), r.vecs...)
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	all := []Sample{}
+	for _, v := range vecs {
+		all = append(all, v.samples()...)
+	}
+	for _, c := range collectors {
+		all = append(all, c.Collect()...)
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return labelString(all[i].Labels) < labelString(all[j].Labels)
+	})
+	return all
+}
+
+// WritePrometheus renders all samples in the Prometheus text format
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	last := ""
+	for _, s := range r.Gather() {
+		if s.Name != last {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.Name, s.Help, s.Name, s.Type); err != nil {
+				return err
+			}
+			last = s.Name
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %g\n", s.Name, labelString(s.Labels), s.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func labelString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatsD line flavors
+const (
+	FlavorStatsD    = "statsd"    // labels folded into the metric name
+	FlavorDogStatsD = "dogstatsd" // labels sent as tags
+)
+
+// maxPacketBytes keeps datagrams under a typical MTU
+const maxPacketBytes = 1432
+
+// StatsDConfig selects the agent and how samples are named
+type StatsDConfig struct {
+	Address  string        // host:port of the agent (UDP)
+	Prefix   string        // prepended to every metric name, e.g. "godataflow."
+	Flavor   string        // statsd or dogstatsd (default)
+	Tags     []string      // extra DogStatsD tags, e.g. env:prod
+	Interval time.Duration // how often the registry is pushed
+}
+
+// -----------------------------------------------------
+// StatsDPusher sends the registry's samples to a StatsD or DogStatsD agent
+// every interval, alongside the Prometheus /metrics endpoint. Gauges are
+// sent as they are; counters as the increase since the previous push.
+// -----------------------------------------------------
+type StatsDPusher struct {
+	registry *Registry
+	cfg      StatsDConfig
+	last     map[string]float64 // counter values at the previous push
+}
+
+// NewStatsDPusher pushes registry as configured by cfg
+func NewStatsDPusher(registry *Registry, cfg StatsDConfig) *StatsDPusher {
+	if cfg.Flavor == "" {
+		cfg.Flavor = FlavorDogStatsD
+	}
+	return &StatsDPusher{registry: registry, cfg: cfg, last: map[string]float64{}}
+}
+
+// Start pushes every interval until ctx is done; a lost push is logged
+// and the next one catches counters up
+func (p *StatsDPusher) Start(ctx context.Context) {
+	conn, err := net.Dial("udp", p.cfg.Address)
+	if err != nil {
+		log.Printf("[metrics] statsd disabled: %v", err)
+		return
+	}
+	defer conn.Close()
+	log.Printf("[metrics] Pushing metrics to %s every %s (%s)", p.cfg.Address, p.cfg.Interval, p.cfg.Flavor)
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, packet := range p.packets(p.lines()) {
+				if _, err := conn.Write(packet); err != nil {
+					log.Printf("[metrics] statsd push failed: %v", err)
+					break
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// lines renders the current samples as StatsD lines
+func (p *StatsDPusher) lines() []string {
+	samples := p.registry.Gather()
+	lines := make([]string, 0, len(samples))
+	for _, s := range samples {
+		value, kind := s.Value, "g"
+		if s.Type == TypeCounter {
+			key := s.Name + labelString(s.Labels)
+			prev, seen := p.last[key]
+			p.last[key] = s.Value
+			if !seen || s.Value < prev {
+				// first push, or the source restarted: only a baseline
+				continue
+			}
+			value, kind = s.Value-prev, "c"
+		}
+		lines = append(lines, fmt.Sprintf("%s:%g|%s%s", p.name(s), value, kind, p.tags(s)))
+	}
+	return lines
+}
+
+// name is the prefixed metric name; plain StatsD has no tags, so label
+// values become name segments in label order
+func (p *StatsDPusher) name(s Sample) string {
+	name := p.cfg.Prefix + s.Name
+	if p.cfg.Flavor == FlavorDogStatsD {
+		return name
+	}
+	for _, k := range sortedKeys(s.Labels) {
+		name += "." + sanitize(s.Labels[k])
+	}
+	return name
+}
+
+// tags renders labels and the configured tags as a DogStatsD tag suffix
+func (p *StatsDPusher) tags(s Sample) string {
+	if p.cfg.Flavor != FlavorDogStatsD {
+		return ""
+	}
+	tags := append([]string(nil), p.cfg.Tags...)
+	for _, k := range sortedKeys(s.Labels) {
+		tags = append(tags, k+":"+sanitize(s.Labels[k]))
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// packets joins lines into newline-separated datagrams of at most maxPacketBytes
+func (p *StatsDPusher) packets(lines []string) [][]byte {
+	var out [][]byte
+	var buf []byte
+	for _, line := range lines {
+		if len(buf) > 0 && len(buf)+1+len(line) > maxPacketBytes {
+			out = append(out, buf)
+			buf = nil
+		}
+		if len(buf) > 0 {
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, line...)
+	}
+	if len(buf) > 0 {
+		out = append(out, buf)
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sanitize replaces the characters StatsD lines reserve
+func sanitize(v string) string {
+	return strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "@", "_", "\n", "_", " ", "_").Replace(v)
+}
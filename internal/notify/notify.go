@@ -0,0 +1,268 @@
+// Package notify routes pipeline events to each table's notification
+// targets. A route names a target (a webhook URL, or log to only write a
+// log line) and the lowest severity it receives, so a finance table can
+// page on its first failed refresh while an experimental one only logs
+// escalations. Events of tables without routes still reach SSE and
+// WebSocket subscribers; they are just not delivered anywhere else.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/jmoiron/sqlx"
+)
+
+// Severities, lowest first
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityError: 2, SeverityCritical: 3}
+
+// eventSeverity is how severe each routed event type is; other events
+// (starts, row changes, import progress) are never routed
+var eventSeverity = map[string]string{
+	events.JobSucceeded:      SeverityInfo,
+	events.SinkExported:      SeverityInfo,
+	events.VolumeAnomaly:     SeverityWarning,
+	events.SchemaDrift:       SeverityWarning,
+	events.QualityFailed:     SeverityWarning,
+	events.ReconcileMismatch: SeverityWarning,
+	events.SinkFailed:        SeverityWarning,
+	events.RollupFailed:      SeverityWarning,
+	events.JobFailed:         SeverityError,
+	events.JobEscalated:      SeverityCritical,
+}
+
+// TargetLog routes events to the server log instead of a webhook
+const TargetLog = "log"
+
+// Route sends a table's events of at least MinSeverity to Target (a
+// table_notifications row)
+type Route struct {
+	ID          int        `db:"id" json:"id"`
+	Table       string     `db:"table_name" json:"table"`
+	Target      string     `db:"target" json:"target"`
+	MinSeverity string     `db:"min_severity" json:"min_severity"`
+	Enabled     bool       `db:"enabled" json:"enabled"`
+	LastSentAt  *time.Time `db:"last_sent_at" json:"last_sent_at"`
+	LastError   *string    `db:"last_error" json:"last_error"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Notification is the JSON body POSTed to webhook targets
+type Notification struct {
+	Severity string `json:"severity"`
+	events.Event
+}
+
+var (
+	// ErrNotFound is returned for an unknown route or table
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid wraps every problem with a route definition
+	ErrInvalid = errors.New("invalid notification route")
+)
+
+// Router stores notification routes and delivers events to them
+type Router struct {
+	DB      *sqlx.DB
+	Events  *events.Broker
+	client  *http.Client
+	timeout time.Duration
+}
+
+// NewRouter delivers to webhooks with client, bounding each request by timeout
+func NewRouter(db *sqlx.DB, broker *events.Broker, client *http.Client, timeout time.Duration) *Router {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Router{DB: db, Events: broker, client: client, timeout: timeout}
+}
+
+// List returns table's routes, oldest first
+func (r *Router) List(table string) ([]Route, error) {
+	routes := []Route{}
+	err := r.DB.Select(&routes, `SELECT * FROM table_notifications WHERE table_name = $1 ORDER BY id`, table)
+	return routes, err
+}
+
+// Get returns one of table's routes
+func (r *Router) Get(table string, id int) (Route, error) {
+	var rt Route
+	err := r.DB.Get(&rt, `SELECT * FROM table_notifications WHERE id = $1 AND table_name = $2`, id, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rt, fmt.Errorf("route %d: %w", id, ErrNotFound)
+	}
+	return rt, err
+}
+
+// Create validates and stores a new route for table; the minimum
+// severity defaults to error, i.e. failed refreshes and escalations
+func (r *Router) Create(table string, rt Route) (Route, error) {
+	var registered int
+	if err := r.DB.Get(&registered, `SELECT COUNT(*) FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return rt, err
+	}
+	if registered == 0 {
+		return rt, fmt.Errorf("table %s: %w", table, ErrNotFound)
+	}
+
+	if err := CheckTarget(rt.Target); err != nil {
+		return rt, fmt.Errorf("%w: target: %v", ErrInvalid, err)
+	}
+	if rt.MinSeverity == "" {
+		rt.MinSeverity = SeverityError
+	}
+	if _, ok := severityRank[rt.MinSeverity]; !ok {
+		return rt, fmt.Errorf("%w: min_severity must be info, warning, error or critical", ErrInvalid)
+	}
+
+	var id int
+	err := r.DB.Get(&id, `
+		INSERT INTO table_notifications (table_name, target, min_severity, enabled)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, table, rt.Target, rt.MinSeverity, rt.Enabled)
+	if err != nil {
+		return rt, err
+	}
+	return r.Get(table, id)
+}
+
+// Delete removes one of table's routes
+func (r *Router) Delete(table string, id int) error {
+	res, err := r.DB.Exec(`DELETE FROM table_notifications WHERE id = $1 AND table_name = $2`, id, table)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("route %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// CheckTarget accepts log or an http(s) webhook URL
+func CheckTarget(target string) error {
+	if target == TargetLog {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New(`must be "log" or an http(s) webhook URL`)
+	}
+	return nil
+}
+
+// Start delivers the events published on the broker until ctx is done
+func (r *Router) Start(ctx context.Context) {
+	if r == nil || r.Events == nil {
+		return
+	}
+	ch := r.Events.Subscribe()
+	defer r.Events.Unsubscribe(ch)
+
+	for {
+		select {
+		case ev := <-ch:
+			if _, routed := eventSeverity[ev.Type]; routed && ev.Table != "" {
+				// a slow webhook must not make the broker drop later events
+				go r.Route(ev)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Route delivers ev to every enabled route of its table whose minimum
+// severity it reaches. Failures are recorded on the route, never retried.
+func (r *Router) Route(ev events.Event) {
+	severity, ok := eventSeverity[ev.Type]
+	if !ok {
+		return
+	}
+	var routes []Route
+	if err := r.DB.Select(&routes, `SELECT * FROM table_notifications WHERE table_name = $1 AND enabled = TRUE ORDER BY id`, ev.Table); err != nil {
+		log.Printf("[notify] can't load routes for %s: %v", ev.Table, err)
+		return
+	}
+	n := Notification{Severity: severity, Event: ev}
+	for _, rt := range routes {
+		if severityRank[severity] < severityRank[rt.MinSeverity] {
+			continue
+		}
+		r.record(rt, r.deliver(rt, n))
+	}
+}
+
+// Test sends rt a sample notification, whatever its minimum severity,
+// recording the outcome like a real delivery
+func (r *Router) Test(rt Route) error {
+	n := Notification{Severity: rt.MinSeverity, Event: events.Event{
+		Type: "notification.test", Table: rt.Table, Message: "test notification", Time: time.Now(),
+	}}
+	return r.record(rt, r.deliver(rt, n))
+}
+
+// record stores the outcome of a delivery to rt and returns err
+func (r *Router) record(rt Route, err error) error {
+	if err != nil {
+		log.Printf("[notify] %s route %d failed: %v", rt.Table, rt.ID, err)
+		r.DB.Exec(`UPDATE table_notifications SET last_error = $1 WHERE id = $2`, err.Error(), rt.ID)
+		return err
+	}
+	r.DB.Exec(`UPDATE table_notifications SET last_sent_at = $1, last_error = NULL WHERE id = $2`, time.Now().UTC(), rt.ID)
+	return nil
+}
+
+// deliver logs n or POSTs it to rt's webhook
+func (r *Router) deliver(rt Route, n Notification) error {
+	if rt.Target == TargetLog {
+		log.Printf("[notify] %s %s %s: %s", strings.ToUpper(n.Severity), n.Table, n.Type, n.Message)
+		return nil
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rt.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
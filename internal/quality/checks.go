@@ -0,0 +1,141 @@
+// Package quality runs per-table data quality checks (null rates,
+// uniqueness, row count swings, freshness) and stores their results.
+// Expectations use the same rules but form a contract: a refresh that
+// leaves one failing is not marked OK.
+package quality
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// Check types
+const (
+	NullPct       = "null_pct"        // share of NULLs in Column must stay at or below MaxPct (default 0)
+	Unique        = "unique"          // Column has no duplicate non-null values
+	RowCountDelta = "row_count_delta" // row count moved at most MaxPct (default 50) since the last run, and is at least MinRows
+	Freshness     = "freshness"       // newest Column timestamp is at most MaxAge old
+	NotEmpty      = "not_empty"       // the table has at least one row
+	Monotonic     = "monotonic"       // Column never goes backwards between loads (see evaluate)
+	Range         = "range"           // every non-null Column value lies within [Min, Max]
+	References    = "references"      // every non-null Column value exists in RefTable.RefColumn
+)
+
+// Result statuses
+const (
+	StatusPass  = "PASS"
+	StatusFail  = "FAIL"
+	StatusError = "ERROR" // the check could not be evaluated (missing column, SQL error)
+)
+
+// Check is one configured rule, stored in table_metadata.quality_checks
+type Check struct {
+	Name    string   `json:"name,omitempty"` // defaults to "type(column)"
+	Type    string   `json:"type"`
+	Column  string   `json:"column,omitempty"`
+	MaxPct  *float64 `json:"max_pct,omitempty"`
+	MinRows *int64   `json:"min_rows,omitempty"`
+	MaxAge  string   `json:"max_age,omitempty"` // Go duration, e.g. "2h"
+
+	Min       *float64 `json:"min,omitempty"` // range bounds; either may be omitted
+	Max       *float64 `json:"max,omitempty"`
+	RefTable  string   `json:"ref_table,omitempty"` // references target
+	RefColumn string   `json:"ref_column,omitempty"`
+}
+
+// Key names the check in results; row_count_delta uses it to find its baseline
+func (c Check) Key() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if c.Column == "" {
+		return c.Type
+	}
+	return c.Type + "(" + c.Column + ")"
+}
+
+// ParseChecks decodes and validates a quality_checks JSON list.
+// Empty input (or JSON null) means no checks.
+func ParseChecks(raw []byte) ([]Check, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var checks []Check
+	if err := json.Unmarshal(raw, &checks); err != nil {
+		return nil, fmt.Errorf("quality_checks must be a list of checks: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i, c := range checks {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("check %d: %w", i+1, err)
+		}
+		if seen[c.Key()] {
+			return nil, fmt.Errorf("check %d: duplicate check %q (set a distinct name)", i+1, c.Key())
+		}
+		seen[c.Key()] = true
+	}
+	return checks, nil
+}
+
+func (c Check) validate() error {
+	switch c.Type {
+	case NullPct, Unique, Freshness, Monotonic, Range, References:
+		if c.Column == "" {
+			return fmt.Errorf("%s needs a column", c.Type)
+		}
+	case RowCountDelta, NotEmpty:
+	default:
+		return fmt.Errorf("unknown type %q (expected %s, %s, %s, %s, %s, %s, %s or %s)",
+			c.Type, NullPct, Unique, RowCountDelta, Freshness, NotEmpty, Monotonic, Range, References)
+	}
+	if c.Type == Range {
+		if c.Min == nil && c.Max == nil {
+			return fmt.Errorf("range needs min, max or both")
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			return fmt.Errorf("range min %v is above max %v", *c.Min, *c.Max)
+		}
+	}
+	if c.Type == References {
+		if c.RefTable == "" || c.RefColumn == "" {
+			return fmt.Errorf("references needs ref_table and ref_column")
+		}
+		if _, err := db.ParseTableName(c.RefTable); err != nil {
+			return fmt.Errorf("ref_table: %w", err)
+		}
+	}
+	if c.MaxPct != nil && *c.MaxPct < 0 {
+		return fmt.Errorf("max_pct cannot be negative")
+	}
+	if c.Type == Freshness {
+		if c.MaxAge == "" {
+			return fmt.Errorf("freshness needs max_age")
+		}
+		if d, err := time.ParseDuration(c.MaxAge); err != nil || d <= 0 {
+			return fmt.Errorf("max_age %q must be a positive duration like 2h", c.MaxAge)
+		}
+	}
+	return nil
+}
+
+// bounds formats a range check's limits
+func (c Check) bounds() string {
+	switch {
+	case c.Min == nil:
+		return fmt.Sprintf("(-inf, %v]", *c.Max)
+	case c.Max == nil:
+		return fmt.Sprintf("[%v, +inf)", *c.Min)
+	}
+	return fmt.Sprintf("[%v, %v]", *c.Min, *c.Max)
+}
+
+func (c Check) maxPct(def float64) float64 {
+	if c.MaxPct == nil {
+		return def
+	}
+	return *c.MaxPct
+}
@@ -0,0 +1,164 @@
+package quality
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alkha0306/godataflow/internal/db"
+)
+
+// maxLookupValues bounds the values looked up per query by unique and
+// references checks on a payload
+const maxLookupValues = 500
+
+// RowViolation is a payload row breaking a row-level check or expectation
+type RowViolation struct {
+	Index       int    `json:"index"` // position in the rows given to CheckRows
+	Check       string `json:"check"`
+	Column      string `json:"column,omitempty"`
+	Message     string `json:"message"`
+	Expectation bool   `json:"expectation"`
+}
+
+// CheckRows evaluates table's checks and expectations against rows that
+// are not loaded yet. Only rules that can judge a single row apply: range,
+// null_pct with max_pct 0, unique (within rows and against the table) and
+// references. The others are returned in skipped as "name: reason", as
+// are rules that could not be evaluated.
+func (r *Runner) CheckRows(table string, rows []map[string]interface{}) (violations []RowViolation, skipped []string, err error) {
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	checks, err := r.LoadChecks(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	expectations, err := r.LoadExpectations(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	violations = []RowViolation{}
+	for i, list := range [][]Check{checks, expectations} {
+		for _, c := range list {
+			found, err := r.checkRows(t, c, rows)
+			if err != nil {
+				skipped = append(skipped, c.Key()+": "+err.Error())
+				continue
+			}
+			for _, v := range found {
+				v.Check, v.Column, v.Expectation = c.Key(), c.Column, i == 1
+				violations = append(violations, v)
+			}
+		}
+	}
+	return violations, skipped, nil
+}
+
+// checkRows returns the rows breaking c, with Index and Message set
+func (r *Runner) checkRows(t db.TableName, c Check, rows []map[string]interface{}) ([]RowViolation, error) {
+	var found []RowViolation
+	flag := func(i int, format string, args ...interface{}) {
+		found = append(found, RowViolation{Index: i, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch c.Type {
+	case Range:
+		for i, row := range rows {
+			v := row[c.Column]
+			if v == nil {
+				continue
+			}
+			n, err := asNumber(v)
+			if err != nil {
+				flag(i, "%v is not a number", v)
+				continue
+			}
+			if (c.Min != nil && n < *c.Min) || (c.Max != nil && n > *c.Max) {
+				flag(i, "%v outside %s", v, c.bounds())
+			}
+		}
+	case NullPct:
+		if c.maxPct(0) > 0 {
+			return nil, fmt.Errorf("a null share is only known for the whole table")
+		}
+		for i, row := range rows {
+			if row[c.Column] == nil {
+				flag(i, "null")
+			}
+		}
+	case Unique:
+		seen := map[string]bool{}
+		for i, row := range rows {
+			if v := row[c.Column]; v != nil {
+				key := fmt.Sprint(v)
+				if seen[key] {
+					flag(i, "%v repeats an earlier row's value", v)
+					continue
+				}
+				seen[key] = true
+			}
+		}
+		existing, err := r.existing(t.String(), c.Column, distinct(rows, c.Column))
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			if v := row[c.Column]; v != nil && existing[fmt.Sprint(v)] {
+				flag(i, "%v already in the table", v)
+			}
+		}
+	case References:
+		present, err := r.existing(c.RefTable, c.RefColumn, distinct(rows, c.Column))
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			if v := row[c.Column]; v != nil && !present[fmt.Sprint(v)] {
+				flag(i, "%v not in %s.%s", v, c.RefTable, c.RefColumn)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s is only evaluated against the loaded table", c.Type)
+	}
+	return found, nil
+}
+
+// distinct returns the distinct non-null values of column in rows
+func distinct(rows []map[string]interface{}, column string) []interface{} {
+	values := []interface{}{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		if v := row[column]; v != nil && !seen[fmt.Sprint(v)] {
+			seen[fmt.Sprint(v)] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// existing returns which of values are stored in table.column, keyed by
+// fmt.Sprint
+func (r *Runner) existing(table, column string, values []interface{}) (map[string]bool, error) {
+	found := map[string]bool{}
+	for start := 0; start < len(values); start += maxLookupValues {
+		batch := values[start:min(start+maxLookupValues, len(values))]
+		holders := make([]string, len(batch))
+		for i := range batch {
+			holders[i] = fmt.Sprintf("$%d", i+1)
+		}
+		var stored []interface{}
+		query := fmt.Sprintf(`SELECT DISTINCT %s FROM %s WHERE %s IN (%s)`, column, db.QuoteTable(table), column, strings.Join(holders, ", "))
+		if err := r.DB.Select(&stored, query, batch...); err != nil {
+			return nil, err
+		}
+		for _, v := range stored {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			found[fmt.Sprint(v)] = true
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,464 @@
+package quality
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/jmoiron/sqlx"
+)
+
+// Result is the outcome of one check in one run (a quality_results row)
+type Result struct {
+	Check     string    `db:"check_name" json:"check"`
+	Type      string    `db:"check_type" json:"type"`
+	Column    *string   `db:"column_name" json:"column,omitempty"`
+	Status    string    `db:"status" json:"status"`
+	Observed  *float64  `db:"observed" json:"observed,omitempty"`
+	Message   string    `db:"message" json:"message"`
+	CheckedAt time.Time `db:"checked_at" json:"checked_at"`
+
+	// Expectation marks results of the table's contract rather than its checks
+	Expectation bool `db:"expectation" json:"expectation"`
+}
+
+// Summary folds a run into one status: FAIL beats ERROR beats PASS.
+// An empty run has no status.
+func Summary(results []Result) string {
+	status := ""
+	for _, r := range results {
+		switch {
+		case r.Status == StatusFail:
+			return StatusFail
+		case r.Status == StatusError:
+			status = StatusError
+		case status == "":
+			status = StatusPass
+		}
+	}
+	return status
+}
+
+// Runner evaluates a table's checks and records the results
+type Runner struct {
+	DB     *sqlx.DB
+	Events *events.Broker
+}
+
+func NewRunner(db *sqlx.DB, broker *events.Broker) *Runner {
+	return &Runner{DB: db, Events: broker}
+}
+
+// Outcome is what AfterRefresh found
+type Outcome struct {
+	Status     string   // summary of all results; "" when the table has no checks
+	Violations []string // expectations that failed or could not be evaluated, as "name: message"
+}
+
+// Blocked reports whether the refresh broke the table's contract
+func (o Outcome) Blocked() bool {
+	return len(o.Violations) > 0
+}
+
+// AfterRefresh runs table's checks and expectations once a refresh has
+// loaded new data and publishes quality.failed when one fails. An
+// expectation that cannot be evaluated counts as violated. Safe to call
+// on a nil Runner.
+func (r *Runner) AfterRefresh(table string) Outcome {
+	if r == nil {
+		return Outcome{}
+	}
+	results, err := r.Run(table)
+	if err != nil {
+		log.Printf("[quality] %s checks failed to run: %v", table, err)
+		out := Outcome{Status: StatusError}
+		if expectations, _ := r.LoadExpectations(table); len(expectations) > 0 {
+			out.Violations = []string{"expectations could not be evaluated: " + err.Error()}
+		}
+		return out
+	}
+
+	out := Outcome{Status: Summary(results)}
+	failed := []string{}
+	for _, res := range results {
+		if res.Expectation && res.Status != StatusPass {
+			out.Violations = append(out.Violations, res.Check+": "+res.Message)
+		}
+		if res.Status == StatusFail {
+			failed = append(failed, res.Check+": "+res.Message)
+		}
+	}
+	if len(failed) == 0 {
+		return out
+	}
+
+	msg := strings.Join(failed, "; ")
+	log.Printf("[quality] %s failed checks → %s", table, msg)
+	r.Events.Publish(events.Event{
+		Type:    events.QualityFailed,
+		Table:   table,
+		Message: msg,
+		Data:    map[string]interface{}{"failed": len(failed), "checks": len(results)},
+	})
+	return out
+}
+
+// LoadChecks returns the checks configured for table
+func (r *Runner) LoadChecks(table string) ([]Check, error) {
+	return r.load(table, "quality_checks")
+}
+
+// LoadExpectations returns the expectation contract of table
+func (r *Runner) LoadExpectations(table string) ([]Check, error) {
+	return r.load(table, "expectations")
+}
+
+func (r *Runner) load(table, column string) ([]Check, error) {
+	var raw []byte
+	err := r.DB.Get(&raw, `SELECT `+column+` FROM table_metadata WHERE table_name = $1`, table)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChecks(raw)
+}
+
+// Run evaluates every configured check and expectation against table and
+// stores the results. A table with neither returns no results.
+func (r *Runner) Run(table string) ([]Result, error) {
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return nil, fmt.Errorf("invalid table name: %w", err)
+	}
+	checks, err := r.LoadChecks(table)
+	if err != nil {
+		return nil, err
+	}
+	expectations, err := r.LoadExpectations(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(checks) == 0 && len(expectations) == 0 {
+		return nil, nil
+	}
+
+	cols, err := db.TableColumns(r.DB, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	known := map[string]bool{}
+	for _, c := range cols {
+		known[c.ColumnName] = true
+	}
+
+	now := time.Now().UTC()
+	results := make([]Result, 0, len(checks)+len(expectations))
+	evaluate := func(c Check, expectation bool) {
+		res := Result{Check: c.Key(), Type: c.Type, CheckedAt: now, Expectation: expectation}
+		if c.Column != "" {
+			col := c.Column
+			res.Column = &col
+		}
+		if c.Column != "" && !known[c.Column] {
+			res.Status, res.Message = StatusError, fmt.Sprintf("column %s does not exist", c.Column)
+		} else if err := r.evaluate(t, c, known, now, &res); err != nil {
+			res.Status, res.Message = StatusError, err.Error()
+		}
+		results = append(results, res)
+	}
+	for _, c := range checks {
+		evaluate(c, false)
+	}
+	for _, c := range expectations {
+		evaluate(c, true)
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return results, err
+	}
+	defer tx.Rollback()
+	for _, res := range results {
+		_, err := tx.Exec(`
+			INSERT INTO quality_results (table_name, check_name, check_type, column_name, status, observed, message, checked_at, expectation)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			table, res.Check, res.Type, res.Column, res.Status, res.Observed, res.Message, res.CheckedAt, res.Expectation)
+		if err != nil {
+			return results, fmt.Errorf("failed to store results: %w", err)
+		}
+	}
+	return results, tx.Commit()
+}
+
+// Latest returns the results of the most recent run for table
+func (r *Runner) Latest(table string) ([]Result, error) {
+	results := []Result{}
+	err := r.DB.Select(&results, `
+		SELECT check_name, check_type, column_name, status, observed, message, checked_at, expectation
+		FROM quality_results
+		WHERE table_name = $1
+		AND checked_at = (SELECT MAX(checked_at) FROM quality_results WHERE table_name = $1)
+		ORDER BY id`, table)
+	return results, err
+}
+
+// evaluate runs one check, filling in res.Status, Observed and Message.
+// known holds the table's column names.
+func (r *Runner) evaluate(t db.TableName, c Check, known map[string]bool, now time.Time, res *Result) error {
+	col := `"` + c.Column + `"`
+	switch c.Type {
+	case NullPct:
+		var total, nonNull int64
+		if err := r.DB.QueryRowx(fmt.Sprintf(`SELECT COUNT(*), COUNT(%s) FROM %s`, col, t.Quoted())).Scan(&total, &nonNull); err != nil {
+			return err
+		}
+		pct := 0.0
+		if total > 0 {
+			pct = float64(total-nonNull) / float64(total) * 100
+		}
+		limit := c.maxPct(0)
+		res.Observed = &pct
+		res.Status = passIf(pct <= limit)
+		res.Message = fmt.Sprintf("%.2f%% nulls (max %.2f%%)", pct, limit)
+
+	case Unique:
+		var nonNull, distinct int64
+		if err := r.DB.QueryRowx(fmt.Sprintf(`SELECT COUNT(%[1]s), COUNT(DISTINCT %[1]s) FROM %[2]s`, col, t.Quoted())).Scan(&nonNull, &distinct); err != nil {
+			return err
+		}
+		dups := float64(nonNull - distinct)
+		res.Observed = &dups
+		res.Status = passIf(dups == 0)
+		res.Message = fmt.Sprintf("%d duplicate values", nonNull-distinct)
+
+	case RowCountDelta:
+		var count int64
+		if err := r.DB.Get(&count, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, t.Quoted())); err != nil {
+			return err
+		}
+		observed := float64(count)
+		res.Observed = &observed
+
+		if c.MinRows != nil && count < *c.MinRows {
+			res.Status = StatusFail
+			res.Message = fmt.Sprintf("%d rows, below the minimum of %d", count, *c.MinRows)
+			return nil
+		}
+		prev, err := r.previous(t, c, res.Expectation)
+		if errors.Is(err, sql.ErrNoRows) {
+			res.Status, res.Message = StatusPass, fmt.Sprintf("%d rows (first run, baseline recorded)", count)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		limit := c.maxPct(50)
+		delta := 0.0
+		switch {
+		case prev > 0:
+			delta = math.Abs(observed-prev) / prev * 100
+		case observed > 0:
+			delta = math.Inf(1)
+		}
+		res.Status = passIf(delta <= limit)
+		res.Message = fmt.Sprintf("%d rows, %.2f%% change from %d (max %.2f%%)", count, delta, int64(prev), limit)
+
+	case Freshness:
+		maxAge, _ := time.ParseDuration(c.MaxAge) // checked by ParseChecks
+		var newest interface{}
+		if err := r.DB.QueryRowx(fmt.Sprintf(`SELECT MAX(%s) FROM %s`, col, t.Quoted())).Scan(&newest); err != nil {
+			return err
+		}
+		if newest == nil {
+			res.Status, res.Message = StatusFail, "no rows with a timestamp"
+			return nil
+		}
+		ts, err := asTime(newest)
+		if err != nil {
+			return err
+		}
+		age := now.Sub(ts)
+		secs := age.Seconds()
+		res.Observed = &secs
+		res.Status = passIf(age <= maxAge)
+		res.Message = fmt.Sprintf("newest row is %s old (max %s)", age.Round(time.Second), maxAge)
+
+	case NotEmpty:
+		var count int64
+		if err := r.DB.Get(&count, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, t.Quoted())); err != nil {
+			return err
+		}
+		observed := float64(count)
+		res.Observed = &observed
+		res.Status = passIf(count > 0)
+		res.Message = fmt.Sprintf("%d rows", count)
+
+	case Monotonic:
+		return r.monotonic(t, c, col, known, res)
+
+	case Range:
+		conds, args := []string{}, []interface{}{}
+		if c.Min != nil {
+			args = append(args, *c.Min)
+			conds = append(conds, fmt.Sprintf("%s < $%d", col, len(args)))
+		}
+		if c.Max != nil {
+			args = append(args, *c.Max)
+			conds = append(conds, fmt.Sprintf("%s > $%d", col, len(args)))
+		}
+		var outside int64
+		if err := r.DB.Get(&outside, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, t.Quoted(), strings.Join(conds, " OR ")), args...); err != nil {
+			return err
+		}
+		observed := float64(outside)
+		res.Observed = &observed
+		res.Status = passIf(outside == 0)
+		res.Message = fmt.Sprintf("%d values outside %s", outside, c.bounds())
+
+	case References:
+		ref, _ := db.ParseTableName(c.RefTable) // checked by ParseChecks
+		refCols, err := db.TableColumns(r.DB, c.RefTable)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, rc := range refCols {
+			found = found || rc.ColumnName == c.RefColumn
+		}
+		if !found {
+			return fmt.Errorf("column %s does not exist in %s", c.RefColumn, c.RefTable)
+		}
+		var orphans int64
+		err = r.DB.Get(&orphans, fmt.Sprintf(`
+			SELECT COUNT(*) FROM %s AS src
+			WHERE src.%s IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM %s AS ref WHERE ref."%s" = src.%s)`, t.Quoted(), col, ref.Quoted(), c.RefColumn, col))
+		if err != nil {
+			return err
+		}
+		observed := float64(orphans)
+		res.Observed = &observed
+		res.Status = passIf(orphans == 0)
+		res.Message = fmt.Sprintf("%d values missing from %s.%s", orphans, c.RefTable, c.RefColumn)
+	}
+	return nil
+}
+
+// monotonic checks that Column never goes backwards. Tables with
+// provenance columns compare the latest load with everything loaded
+// before it: no new row may be older than the newest earlier one. Other
+// tables only check that the column's maximum did not drop since the
+// previous run.
+func (r *Runner) monotonic(t db.TableName, c Check, col string, known map[string]bool, res *Result) error {
+	if known[db.IngestedAtColumn] {
+		var behind int64
+		err := r.DB.Get(&behind, fmt.Sprintf(`
+			SELECT COUNT(*) FROM %[1]s
+			WHERE %[2]s = (SELECT MAX(%[2]s) FROM %[1]s)
+			AND %[3]s < (SELECT MAX(%[3]s) FROM %[1]s WHERE %[2]s < (SELECT MAX(%[2]s) FROM %[1]s))`,
+			t.Quoted(), db.IngestedAtColumn, col))
+		if err != nil {
+			return err
+		}
+		observed := float64(behind)
+		res.Observed = &observed
+		res.Status = passIf(behind == 0)
+		res.Message = fmt.Sprintf("%d rows in the latest load are older than earlier loads", behind)
+		return nil
+	}
+
+	var newest interface{}
+	if err := r.DB.QueryRowx(fmt.Sprintf(`SELECT MAX(%s) FROM %s`, col, t.Quoted())).Scan(&newest); err != nil {
+		return err
+	}
+	if newest == nil {
+		res.Status, res.Message = StatusPass, "no values yet"
+		return nil
+	}
+	value, err := asNumber(newest)
+	if err != nil {
+		return err
+	}
+	res.Observed = &value
+
+	prev, err := r.previous(t, c, res.Expectation)
+	if errors.Is(err, sql.ErrNoRows) {
+		res.Status, res.Message = StatusPass, "first run, maximum recorded"
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Status = passIf(value >= prev)
+	res.Message = fmt.Sprintf("maximum moved from %v to %v", prev, value)
+	return nil
+}
+
+// previous returns the last observed value recorded for c
+func (r *Runner) previous(t db.TableName, c Check, expectation bool) (float64, error) {
+	var prev float64
+	err := r.DB.Get(&prev, `
+		SELECT observed FROM quality_results
+		WHERE table_name = $1 AND check_name = $2 AND expectation = $3 AND observed IS NOT NULL
+		ORDER BY checked_at DESC, id DESC LIMIT 1`, t.String(), c.Key(), expectation)
+	return prev, err
+}
+
+func passIf(ok bool) string {
+	if ok {
+		return StatusPass
+	}
+	return StatusFail
+}
+
+// asNumber converts a MAX() value to a number: numeric columns as they are,
+// timestamps as Unix seconds
+func asNumber(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case []byte:
+		return asNumber(string(n))
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return f, nil
+		}
+	}
+	ts, err := asTime(v)
+	if err != nil {
+		return 0, err
+	}
+	return float64(ts.UnixNano()) / 1e9, nil
+}
+
+// asTime converts a MAX(timestamp) value as returned by either driver
+func asTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case []byte:
+		return asTime(string(t))
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02"} {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+				return parsed, nil
+			}
+		}
+		if secs, err := strconv.ParseFloat(t, 64); err == nil {
+			return time.Unix(int64(secs), 0), nil
+		}
+	case int64:
+		return time.Unix(t, 0), nil
+	case float64:
+		return time.Unix(int64(t), 0), nil
+	}
+	return time.Time{}, fmt.Errorf("column value %v is not a timestamp", v)
+}
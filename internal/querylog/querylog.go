@@ -0,0 +1,144 @@
+// Package querylog records the queries run through the API (GET /query,
+// /transform, saved query runs and shared links) in query_logs: who ran
+// what, how long it took and how many rows it returned, for usage
+// analysis and security review of data access.
+package querylog
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of logged queries
+const (
+	KindQuery      = "query"       // GET /query
+	KindTransform  = "transform"   // GET /transform
+	KindSavedQuery = "saved_query" // GET /queries/run/:id
+	KindShared     = "shared"      // GET /shared/:token
+)
+
+// maxStatementBytes bounds the SQL kept per entry
+const maxStatementBytes = 16 << 10
+
+// Entry is one query_logs row
+type Entry struct {
+	ID         int       `db:"id" json:"id"`
+	Kind       string    `db:"kind" json:"kind"`
+	Caller     string    `db:"caller" json:"caller"`
+	Workspace  *string   `db:"workspace" json:"workspace,omitempty"`
+	ClientIP   *string   `db:"client_ip" json:"client_ip,omitempty"`
+	TableName  *string   `db:"table_name" json:"table_name,omitempty"`
+	QueryID    *int      `db:"query_id" json:"query_id,omitempty"`
+	Statement  string    `db:"statement" json:"statement"`
+	DurationMs int64     `db:"duration_ms" json:"duration_ms"`
+	RowCount   *int      `db:"row_count" json:"row_count,omitempty"`
+	Error      *string   `db:"error" json:"error,omitempty"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// Recorder writes entries to query_logs. A nil Recorder records nothing.
+type Recorder struct {
+	DB *sqlx.DB
+}
+
+func NewRecorder(database *sqlx.DB) *Recorder {
+	return &Recorder{DB: database}
+}
+
+// Record stores e, a query started at started that returned rows rows or
+// failed with err. Failures are logged, never returned, so the audit log
+// cannot fail a query.
+func (r *Recorder) Record(e Entry, started time.Time, rows int, err error) {
+	if r == nil {
+		return
+	}
+	e.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		msg := err.Error()
+		e.Error = &msg
+	} else {
+		e.RowCount = &rows
+	}
+	e.Statement = strings.TrimSpace(e.Statement)
+	if len(e.Statement) > maxStatementBytes {
+		e.Statement = strings.ToValidUTF8(e.Statement[:maxStatementBytes], "") + "…"
+	}
+	_, dbErr := r.DB.Exec(`
+		INSERT INTO query_logs (kind, caller, workspace, client_ip, table_name, query_id, statement, duration_ms, row_count, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, e.Kind, e.Caller, e.Workspace, e.ClientIP, e.TableName, e.QueryID, e.Statement, e.DurationMs, e.RowCount, e.Error)
+	if dbErr != nil {
+		log.Printf("[querylog] failed to record %s query by %s: %v", e.Kind, e.Caller, dbErr)
+	}
+}
+
+// Filter selects entries for List. Zero fields match everything.
+type Filter struct {
+	Kind       string
+	Caller     string
+	Workspace  string
+	Table      string
+	ErrorsOnly bool
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int
+	Offset     int
+}
+
+// List returns the entries matching f, newest first, and how many match in all
+func (r *Recorder) List(f Filter) ([]Entry, int, error) {
+	conds := []string{}
+	args := []interface{}{}
+	addCond := func(expr string, val interface{}) {
+		args = append(args, val)
+		conds = append(conds, fmt.Sprintf(expr, len(args)))
+	}
+	for expr, val := range map[string]string{
+		"kind = $%d":       f.Kind,
+		"caller = $%d":     f.Caller,
+		"workspace = $%d":  f.Workspace,
+		"table_name = $%d": f.Table,
+	} {
+		if val != "" {
+			addCond(expr, val)
+		}
+	}
+	if f.ErrorsOnly {
+		conds = append(conds, "error IS NOT NULL")
+	}
+	if f.Since != nil {
+		addCond("created_at >= $%d", *f.Since)
+	}
+	if f.Until != nil {
+		addCond("created_at < $%d", *f.Until)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := r.DB.Get(&total, `SELECT COUNT(*) FROM query_logs `+where, args...); err != nil {
+		return nil, 0, err
+	}
+	entries := []Entry{}
+	err := r.DB.Select(&entries, fmt.Sprintf(`
+		SELECT * FROM query_logs
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT %d OFFSET %d`, where, f.Limit, f.Offset), args...)
+	return entries, total, err
+}
+
+// Cleanup deletes the entries recorded before cutoff
+func (r *Recorder) Cleanup(cutoff time.Time) (int64, error) {
+	res, err := r.DB.Exec(`DELETE FROM query_logs WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,590 @@
+// Package quota keeps one workspace from starving the others. Each
+// workspace (the default one included) has limits on its table count,
+// rows per table, ingest requests per minute and storage; tables can
+// override the row and ingest limits. Row counts and sizes come from the
+// catalog, re-read every usage interval and advanced in memory as rows
+// are written, so they are close but not exact. Ingest rates are counted
+// per server instance.
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/workspace"
+	"github.com/jmoiron/sqlx"
+)
+
+// rateWindow is the fixed window ingest requests are counted in
+const rateWindow = time.Minute
+
+var (
+	// ErrExceeded is returned when a write would go past a table, row or storage limit
+	ErrExceeded = errors.New("quota exceeded")
+	// ErrRateLimited is returned (wrapped in a *RateError) when ingest requests come too fast
+	ErrRateLimited = errors.New("ingest rate limit exceeded")
+	// ErrInvalid wraps bad quota overrides
+	ErrInvalid = errors.New("invalid quota")
+	// ErrNotFound is returned when overriding the quota of an unknown table or workspace
+	ErrNotFound = errors.New("not found")
+	// ErrStale is returned when a conditional override finds the table's
+	// configuration changed since the caller read it
+	ErrStale = errors.New("table changed since it was read")
+)
+
+// Limits are a workspace's quotas; 0 = unlimited
+type Limits struct {
+	MaxTables       int   `json:"max_tables"`
+	MaxRowsPerTable int64 `json:"max_rows_per_table"`
+	IngestPerMinute int   `json:"ingest_per_minute"`
+	MaxStorageBytes int64 `json:"max_storage_bytes"`
+}
+
+// Override replaces some of a workspace's limits; nil fields use the
+// configured default
+type Override struct {
+	MaxTables       *int   `db:"max_tables" json:"max_tables"`
+	MaxRowsPerTable *int64 `db:"max_rows_per_table" json:"max_rows_per_table"`
+	IngestPerMinute *int   `db:"ingest_per_minute" json:"ingest_per_minute"`
+	MaxStorageBytes *int64 `db:"max_storage_bytes" json:"max_storage_bytes"`
+}
+
+// TableOverride replaces a table's limits; nil fields use its workspace's
+type TableOverride struct {
+	MaxRows         *int64 `db:"max_rows" json:"max_rows"`
+	IngestPerMinute *int   `db:"ingest_per_minute" json:"ingest_per_minute"`
+}
+
+// RateError reports an ingest rate limit and when the window resets
+type RateError struct {
+	Scope      string // "table <name>" or "workspace <name>"
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *RateError) Error() string {
+	return fmt.Sprintf("%s allows %d ingest requests per minute", e.Scope, e.Limit)
+}
+
+func (e *RateError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// Usage is a workspace's consumption next to its limits, for GET /usage
+type Usage struct {
+	Workspace    string       `json:"workspace"` // "" = default workspace
+	Limits       Limits       `json:"limits"`
+	Tables       int          `json:"tables"`
+	StorageBytes *int64       `json:"storage_bytes,omitempty"` // unknown on SQLite
+	IngestRate   int          `json:"ingest_requests_this_minute"`
+	TableUsage   []TableUsage `json:"table_usage"`
+	MeasuredAt   *time.Time   `json:"measured_at,omitempty"` // last catalog read
+}
+
+// TableUsage is one table's consumption and effective limits
+type TableUsage struct {
+	Table           string `json:"table"`
+	Rows            int64  `json:"rows"`
+	StorageBytes    *int64 `json:"storage_bytes,omitempty"`
+	MaxRows         int64  `json:"max_rows"`
+	IngestPerMinute int    `json:"ingest_per_minute"`
+	IngestRate      int    `json:"ingest_requests_this_minute"`
+}
+
+// Enforcer checks writes against the quotas. A nil *Enforcer allows everything.
+type Enforcer struct {
+	DB       *sqlx.DB
+	Defaults Limits
+	Interval time.Duration // how often usage is re-read
+
+	mu         sync.Mutex
+	tables     map[string]*tableState
+	workspaces map[string]workspaceState // by schema; "" is the default workspace
+	windows    map[string]*window        // ingest counts by "table:<name>" or "ws:<schema>"
+	measuredAt *time.Time
+}
+
+type tableState struct {
+	rows     int64
+	bytes    *int64
+	override TableOverride
+}
+
+type workspaceState struct {
+	name   string
+	limits Limits
+}
+
+// rateCheck is one ingest limit AllowIngest applies
+type rateCheck struct {
+	key, label string
+	limit      int
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func NewEnforcer(database *sqlx.DB, defaults Limits, interval time.Duration) *Enforcer {
+	return &Enforcer{
+		DB:         database,
+		Defaults:   defaults,
+		Interval:   interval,
+		tables:     map[string]*tableState{},
+		workspaces: map[string]workspaceState{"": {limits: defaults}},
+		windows:    map[string]*window{},
+	}
+}
+
+// Start reads usage now and every Interval until ctx is done
+func (e *Enforcer) Start(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	for {
+		if err := e.Refresh(); err != nil {
+			log.Printf("quota usage refresh failed: %v", err)
+		}
+		select {
+		case <-time.After(e.Interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Refresh re-reads overrides, row counts and sizes. Row counts are the
+// planner's estimates on Postgres and exact counts on SQLite.
+func (e *Enforcer) Refresh() error {
+	if e == nil {
+		return nil
+	}
+	var wsRows []struct {
+		Name   string `db:"name"`
+		Schema string `db:"schema_name"`
+		Override
+	}
+	err := e.DB.Select(&wsRows, `
+		SELECT name, schema_name, max_tables, max_rows_per_table, ingest_per_minute, max_storage_bytes
+		FROM workspaces`)
+	if err != nil {
+		return fmt.Errorf("load workspace quotas: %w", err)
+	}
+	var tableRows []struct {
+		Table string `db:"table_name"`
+		TableOverride
+	}
+	if err := e.DB.Select(&tableRows, `SELECT table_name, max_rows, ingest_per_minute FROM table_metadata`); err != nil {
+		return fmt.Errorf("load table quotas: %w", err)
+	}
+
+	workspaces := map[string]workspaceState{"": {limits: e.Defaults}}
+	for _, w := range wsRows {
+		workspaces[w.Schema] = workspaceState{name: w.Name, limits: e.Defaults.With(w.Override)}
+	}
+	tables := make(map[string]*tableState, len(tableRows))
+	for _, t := range tableRows {
+		tables[t.Table] = &tableState{override: t.TableOverride}
+	}
+	if err := e.measure(tables); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	e.mu.Lock()
+	e.workspaces = workspaces
+	e.tables = tables
+	e.measuredAt = &now
+	e.mu.Unlock()
+	return nil
+}
+
+// measure fills in the rows and sizes of tables
+func (e *Enforcer) measure(tables map[string]*tableState) error {
+	if db.DialectOf(e.DB) == db.SQLite {
+		for name, t := range tables {
+			parsed, err := db.ParseTableName(name)
+			if err != nil {
+				continue
+			}
+			if err := e.DB.Get(&t.rows, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, parsed.Quoted())); err != nil {
+				log.Printf("quota: count rows of %s: %v", name, err)
+			}
+		}
+		return nil
+	}
+
+	var stats []struct {
+		Schema string `db:"schemaname"`
+		Name   string `db:"relname"`
+		Rows   int64  `db:"n_live_tup"`
+		Bytes  int64  `db:"bytes"`
+	}
+	err := e.DB.Select(&stats, `
+		SELECT schemaname, relname, n_live_tup, pg_total_relation_size(relid) AS bytes
+		FROM pg_stat_user_tables`)
+	if err != nil {
+		return fmt.Errorf("read table statistics: %w", err)
+	}
+	byName := make(map[string]int, len(stats))
+	for i, s := range stats {
+		byName[s.Schema+"."+s.Name] = i
+	}
+	for name, t := range tables {
+		parsed, err := db.ParseTableName(name)
+		if err != nil {
+			continue
+		}
+		if i, ok := byName[parsed.SchemaOrDefault()+"."+parsed.Name]; ok {
+			bytes := stats[i].Bytes
+			t.rows, t.bytes = stats[i].Rows, &bytes
+		}
+	}
+	return nil
+}
+
+// With returns l with the set fields of o applied
+func (l Limits) With(o Override) Limits {
+	if o.MaxTables != nil {
+		l.MaxTables = *o.MaxTables
+	}
+	if o.MaxRowsPerTable != nil {
+		l.MaxRowsPerTable = *o.MaxRowsPerTable
+	}
+	if o.IngestPerMinute != nil {
+		l.IngestPerMinute = *o.IngestPerMinute
+	}
+	if o.MaxStorageBytes != nil {
+		l.MaxStorageBytes = *o.MaxStorageBytes
+	}
+	return l
+}
+
+// scope is the schema of the workspace owning table; "" is the default workspace
+func (e *Enforcer) scope(table string) string {
+	parsed, err := db.ParseTableName(table)
+	if err != nil || !strings.HasPrefix(parsed.Schema, workspace.SchemaPrefix) {
+		return ""
+	}
+	if _, ok := e.workspaces[parsed.Schema]; !ok {
+		return ""
+	}
+	return parsed.Schema
+}
+
+// label names a scope in error messages
+func (e *Enforcer) label(scope string) string {
+	if scope == "" {
+		return "the default workspace"
+	}
+	return "workspace " + e.workspaces[scope].name
+}
+
+// AllowIngest counts one ingest request against table and its workspace.
+// It returns a *RateError when either is over its per-minute limit.
+func (e *Enforcer) AllowIngest(table string) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	scope := e.scope(table)
+	checks := []rateCheck{{"ws:" + scope, e.label(scope), e.workspaces[scope].limits.IngestPerMinute}}
+	if t, ok := e.tables[table]; ok && t.override.IngestPerMinute != nil {
+		checks = append(checks, rateCheck{"table:" + table, "table " + table, *t.override.IngestPerMinute})
+	}
+
+	// refuse before counting, so a rejected request uses up nothing
+	for _, c := range checks {
+		if c.limit <= 0 {
+			continue
+		}
+		if w := e.window(c.key, now); w.count >= c.limit {
+			return &RateError{Scope: c.label, Limit: c.limit, RetryAfter: w.start.Add(rateWindow).Sub(now)}
+		}
+	}
+	for _, c := range checks {
+		e.window(c.key, now).count++
+	}
+	return nil
+}
+
+// window returns the current counting window for key; call with mu held
+func (e *Enforcer) window(key string, now time.Time) *window {
+	w, ok := e.windows[key]
+	if !ok || now.Sub(w.start) >= rateWindow {
+		w = &window{start: now.Truncate(rateWindow)}
+		e.windows[key] = w
+	}
+	return w
+}
+
+// rate is the requests counted in key's current window; call with mu held
+func (e *Enforcer) rate(key string, now time.Time) int {
+	if w, ok := e.windows[key]; ok && now.Sub(w.start) < rateWindow {
+		return w.count
+	}
+	return 0
+}
+
+// CheckRows returns ErrExceeded if adding n rows to table would pass its
+// row limit, or its workspace is already at its storage limit
+func (e *Enforcer) CheckRows(table string, n int) error {
+	return e.checkRows(table, n, false)
+}
+
+// CheckReplace is CheckRows for a load that replaces all of table's rows
+// with n new ones
+func (e *Enforcer) CheckReplace(table string, n int) error {
+	return e.checkRows(table, n, true)
+}
+
+func (e *Enforcer) checkRows(table string, n int, replace bool) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	scope := e.scope(table)
+	limits := e.workspaces[scope].limits
+	var rows int64
+	max := limits.MaxRowsPerTable
+	if t, ok := e.tables[table]; ok {
+		if !replace {
+			rows = t.rows
+		}
+		if t.override.MaxRows != nil {
+			max = *t.override.MaxRows
+		}
+	}
+	if max > 0 && replace && int64(n) > max {
+		return fmt.Errorf("%w: %d rows would pass the limit of %d for table %s", ErrExceeded, n, max, table)
+	}
+	if max > 0 && rows+int64(n) > max {
+		return fmt.Errorf("%w: table %s holds about %d rows; %d more would pass its limit of %d", ErrExceeded, table, rows, n, max)
+	}
+	return e.checkStorage(scope)
+}
+
+// CheckCreate returns ErrExceeded if the workspace that would own table
+// has no room for another table. It counts tables on q, so it sees tables
+// created by an open transaction.
+func (e *Enforcer) CheckCreate(q sqlx.Queryer, table string) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	scope := e.scope(table)
+	limits := e.workspaces[scope].limits
+	label := e.label(scope)
+	err := e.checkStorage(scope)
+	e.mu.Unlock()
+	if err != nil || limits.MaxTables <= 0 {
+		return err
+	}
+
+	var names []string
+	if err := sqlx.Select(q, &names, `SELECT table_name FROM table_metadata`); err != nil {
+		return fmt.Errorf("count tables: %w", err)
+	}
+	count := 0
+	e.mu.Lock()
+	for _, name := range names {
+		if e.scope(name) == scope {
+			count++
+		}
+	}
+	e.mu.Unlock()
+	if count >= limits.MaxTables {
+		return fmt.Errorf("%w: %s has %d of %d tables", ErrExceeded, label, count, limits.MaxTables)
+	}
+	return nil
+}
+
+// checkStorage reports a workspace at its storage limit; call with mu held
+func (e *Enforcer) checkStorage(scope string) error {
+	max := e.workspaces[scope].limits.MaxStorageBytes
+	if max <= 0 {
+		return nil
+	}
+	used, known := e.storage(scope)
+	if known && used >= max {
+		return fmt.Errorf("%w: %s uses %d of %d bytes", ErrExceeded, e.label(scope), used, max)
+	}
+	return nil
+}
+
+// storage sums the measured size of a workspace's tables; call with mu held
+func (e *Enforcer) storage(scope string) (int64, bool) {
+	var used int64
+	known := false
+	for name, t := range e.tables {
+		if t.bytes != nil && e.scope(name) == scope {
+			used += *t.bytes
+			known = true
+		}
+	}
+	return used, known
+}
+
+// Added records n rows committed to table
+func (e *Enforcer) Added(table string, n int) {
+	if e == nil || n <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.tables[table]
+	if !ok {
+		t = &tableState{}
+		e.tables[table] = t
+	}
+	t.rows += int64(n)
+}
+
+// Removed records n rows deleted from table
+func (e *Enforcer) Removed(table string, n int) {
+	if e == nil || n <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if t, ok := e.tables[table]; ok {
+		t.rows = max(t.rows-int64(n), 0)
+	}
+}
+
+// Replaced records that a load replaced table's rows with n new ones
+func (e *Enforcer) Replaced(table string, n int) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.tables[table]
+	if !ok {
+		t = &tableState{}
+		e.tables[table] = t
+	}
+	t.rows = int64(n)
+}
+
+// Usage reports the workspace whose schema is scope ("" = default workspace)
+func (e *Enforcer) Usage(scope string) Usage {
+	if e == nil {
+		return Usage{TableUsage: []TableUsage{}}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	ws := e.workspaces[scope]
+	u := Usage{
+		Workspace:  ws.name,
+		Limits:     ws.limits,
+		IngestRate: e.rate("ws:"+scope, now),
+		TableUsage: []TableUsage{},
+		MeasuredAt: e.measuredAt,
+	}
+	if used, known := e.storage(scope); known {
+		u.StorageBytes = &used
+	}
+	for name, t := range e.tables {
+		if e.scope(name) != scope {
+			continue
+		}
+		tu := TableUsage{
+			Table:        name,
+			Rows:         t.rows,
+			StorageBytes: t.bytes,
+			MaxRows:      ws.limits.MaxRowsPerTable,
+			IngestRate:   e.rate("table:"+name, now),
+		}
+		if t.override.MaxRows != nil {
+			tu.MaxRows = *t.override.MaxRows
+		}
+		if t.override.IngestPerMinute != nil {
+			tu.IngestPerMinute = *t.override.IngestPerMinute
+		}
+		u.TableUsage = append(u.TableUsage, tu)
+	}
+	u.Tables = len(u.TableUsage)
+	sort.Slice(u.TableUsage, func(i, j int) bool { return u.TableUsage[i].Table < u.TableUsage[j].Table })
+	return u
+}
+
+// SetWorkspace stores a workspace's overrides and re-reads usage
+func (e *Enforcer) SetWorkspace(id int, o Override) error {
+	for _, v := range []int64{intOr(o.MaxTables), int64Or(o.MaxRowsPerTable), intOr(o.IngestPerMinute), int64Or(o.MaxStorageBytes)} {
+		if v < 0 {
+			return fmt.Errorf("%w: limits cannot be negative (0 = unlimited)", ErrInvalid)
+		}
+	}
+	res, err := e.DB.Exec(`
+		UPDATE workspaces SET max_tables = $1, max_rows_per_table = $2, ingest_per_minute = $3, max_storage_bytes = $4
+		WHERE id = $5`, o.MaxTables, o.MaxRowsPerTable, o.IngestPerMinute, o.MaxStorageBytes, id)
+	return e.applied(res, err, "workspace")
+}
+
+// SetTable stores a table's overrides, re-reads usage and returns the
+// table's new config_version. A nonzero version makes the write apply
+// only to that version (ErrStale when the table has moved on).
+func (e *Enforcer) SetTable(table string, o TableOverride, version int) (int, error) {
+	if int64Or(o.MaxRows) < 0 || intOr(o.IngestPerMinute) < 0 {
+		return 0, fmt.Errorf("%w: limits cannot be negative (0 = unlimited)", ErrInvalid)
+	}
+	query := `UPDATE table_metadata SET max_rows = $1, ingest_per_minute = $2, config_version = config_version + 1 WHERE table_name = $3`
+	args := []interface{}{o.MaxRows, o.IngestPerMinute, table}
+	if version != 0 {
+		query += ` AND config_version = $4`
+		args = append(args, version)
+	}
+	var next int
+	err := e.DB.QueryRowx(query+` RETURNING config_version`, args...).Scan(&next)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && version != 0:
+		return 0, fmt.Errorf("%w: table %s", ErrStale, table)
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, fmt.Errorf("%w: table %s", ErrNotFound, table)
+	case err != nil:
+		return 0, fmt.Errorf("store quota: %w", err)
+	}
+	return next, e.Refresh()
+}
+
+// applied finishes SetWorkspace
+func (e *Enforcer) applied(res interface{ RowsAffected() (int64, error) }, err error, what string) error {
+	if err != nil {
+		return fmt.Errorf("store quota: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, what)
+	}
+	return e.Refresh()
+}
+
+func intOr(p *int) int64 {
+	if p == nil {
+		return 0
+	}
+	return int64(*p)
+}
+
+func int64Or(p *int64) int64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
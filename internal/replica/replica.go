@@ -0,0 +1,534 @@
+// Package replica keeps local read-only copies of tables served by another
+// godataflow instance. Rows are pulled through the remote's export API
+// (GET /tables/:name/export as NDJSON); tables with provenance columns are
+// copied incrementally by _ingested_at, others are replaced in full on
+// every sync. The remote's event stream can trigger syncs as soon as new
+// rows land there.
+package replica
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultSyncInterval applies when a subscription does not set one
+const DefaultSyncInterval = 300
+
+// Rows decoded from the remote and loaded per chunk
+const syncChunkSize = 1000
+
+// Replica is a subscription to a remote table (a table_replicas row)
+type Replica struct {
+	ID           int        `db:"id" json:"id"`
+	Table        string     `db:"table_name" json:"table_name"`
+	SourceURL    string     `db:"source_url" json:"source_url"`
+	SourceTable  string     `db:"source_table" json:"source_table"`
+	APIKey       *string    `db:"api_key" json:"-"`
+	SyncInterval int        `db:"sync_interval" json:"sync_interval"`
+	Live         bool       `db:"live" json:"live"`
+	CursorValue  *string    `db:"cursor_value" json:"cursor_value"`
+	LastSyncAt   *time.Time `db:"last_sync_at" json:"last_sync_at"`
+	LastError    *string    `db:"last_error" json:"last_error"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Result summarizes one sync
+type Result struct {
+	Table       string `json:"table_name"`
+	Rows        int    `json:"rows"`
+	Incremental bool   `json:"incremental"`
+}
+
+var (
+	// ErrNotFound is returned for a table that is not a replica
+	ErrNotFound = errors.New("replica not found")
+	// ErrExists is returned when the local table name is taken
+	ErrExists = errors.New("table already exists")
+	// ErrBusy is returned while another sync of the same replica runs
+	ErrBusy = errors.New("sync already in progress")
+	// ErrInvalid wraps every problem with a subscription request
+	ErrInvalid = errors.New("invalid replica")
+	// ErrRemote wraps failures talking to the source instance
+	ErrRemote = errors.New("source instance request failed")
+)
+
+// Syncer subscribes to remote tables and copies their rows
+type Syncer struct {
+	DB      *sqlx.DB
+	ETL     *etl.ETLProcessor
+	Events  *events.Broker
+	Client  *http.Client
+	Timeout time.Duration // per sync; 0 = no limit
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewSyncer(db *sqlx.DB, etlProc *etl.ETLProcessor, broker *events.Broker, client *http.Client, timeout time.Duration) *Syncer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Syncer{DB: db, ETL: etlProc, Events: broker, Client: client, Timeout: timeout, running: map[string]bool{}}
+}
+
+// List returns every replica, oldest first
+func (s *Syncer) List() ([]Replica, error) {
+	replicas := []Replica{}
+	err := s.DB.Select(&replicas, `SELECT * FROM table_replicas ORDER BY id`)
+	return replicas, err
+}
+
+// Get returns the replica stored as table
+func (s *Syncer) Get(table string) (Replica, error) {
+	var r Replica
+	err := s.DB.Get(&r, `SELECT * FROM table_replicas WHERE table_name = $1`, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, fmt.Errorf("%s: %w", table, ErrNotFound)
+	}
+	return r, err
+}
+
+// Subscribe creates the local table with the remote table's columns and
+// registers it as a replica. The local name defaults to the remote one.
+// Rows arrive with the first sync.
+func (s *Syncer) Subscribe(r Replica) (Replica, error) {
+	r.SourceURL = strings.TrimRight(r.SourceURL, "/")
+	if u, err := url.Parse(r.SourceURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return r, fmt.Errorf("%w: source_url must be the remote API base, e.g. https://eu.example.com/v1", ErrInvalid)
+	}
+	if _, err := db.ParseTableName(r.SourceTable); err != nil {
+		return r, fmt.Errorf("%w: source_table: %v", ErrInvalid, err)
+	}
+	if r.Table == "" {
+		r.Table = r.SourceTable
+	}
+	local, err := db.ParseTableName(r.Table)
+	if err == nil {
+		err = db.CheckSchemaSupport(s.DB, local)
+	}
+	if err != nil {
+		return r, fmt.Errorf("%w: table_name: %v", ErrInvalid, err)
+	}
+	if r.SyncInterval == 0 {
+		r.SyncInterval = DefaultSyncInterval
+	}
+	if r.SyncInterval < 1 {
+		return r, fmt.Errorf("%w: sync_interval must be a positive number of seconds", ErrInvalid)
+	}
+
+	existing, err := db.TableColumns(s.DB, r.Table)
+	if err != nil {
+		return r, err
+	}
+	var registered int
+	if err := s.DB.Get(&registered, `SELECT COUNT(*) FROM table_metadata WHERE table_name = $1`, r.Table); err != nil {
+		return r, err
+	}
+	if len(existing) > 0 || registered > 0 {
+		return r, fmt.Errorf("%w: %s", ErrExists, r.Table)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cols, err := s.remoteColumns(ctx, r)
+	if err != nil {
+		return r, err
+	}
+	tableType, err := s.remoteTableType(ctx, r)
+	if err != nil {
+		return r, err
+	}
+
+	dialect := db.DialectOf(s.DB)
+	defs := make([]string, len(cols))
+	for i, c := range cols {
+		if strings.ContainsRune(c.ColumnName, '"') {
+			return r, fmt.Errorf("%w: remote column name %q", ErrRemote, c.ColumnName)
+		}
+		defs[i] = fmt.Sprintf(`"%s" %s`, c.ColumnName, localType(c.DataType, dialect))
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return r, err
+	}
+	defer tx.Rollback()
+	if local.Schema != "" {
+		if _, err := tx.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, local.Schema)); err != nil {
+			return r, err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s (%s)`, local.Quoted(), strings.Join(defs, ", "))); err != nil {
+		return r, err
+	}
+	if _, err := tx.Exec(`INSERT INTO table_metadata (table_name, table_type) VALUES ($1, $2)`, r.Table, tableType); err != nil {
+		return r, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO table_replicas (table_name, source_url, source_table, api_key, sync_interval, live)
+		VALUES ($1, $2, $3, $4, $5, $6)`, r.Table, r.SourceURL, r.SourceTable, r.APIKey, r.SyncInterval, r.Live)
+	if err != nil {
+		return r, err
+	}
+	if err := tx.Commit(); err != nil {
+		return r, err
+	}
+
+	s.Events.Publish(events.Event{Type: events.TableCreated, Table: r.Table,
+		Message: fmt.Sprintf("replica of %s on %s", r.SourceTable, r.SourceURL)})
+	return s.Get(r.Table)
+}
+
+// Unsubscribe stops replicating table; the local copy stays as a regular table
+func (s *Syncer) Unsubscribe(table string) error {
+	res, err := s.DB.Exec(`DELETE FROM table_replicas WHERE table_name = $1`, table)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%s: %w", table, ErrNotFound)
+	}
+	return nil
+}
+
+// SyncTable reloads the replica stored as table and syncs it
+func (s *Syncer) SyncTable(table string) (Result, error) {
+	r, err := s.Get(table)
+	if err != nil {
+		return Result{Table: table}, err
+	}
+	return s.Sync(r)
+}
+
+// Sync copies the remote rows added since the last sync (or all of them)
+// and records the outcome like a refresh: refresh_logs, the table status
+// and job events
+func (s *Syncer) Sync(r Replica) (Result, error) {
+	s.mu.Lock()
+	if s.running[r.Table] {
+		s.mu.Unlock()
+		return Result{Table: r.Table}, ErrBusy
+	}
+	s.running[r.Table] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, r.Table)
+		s.mu.Unlock()
+	}()
+
+	s.Events.Publish(events.Event{Type: events.JobStarted, Table: r.Table})
+	res, cursor, err := s.sync(r)
+	if err != nil {
+		msg := "Replication failed: " + err.Error()
+		s.DB.Exec(`UPDATE table_replicas SET last_error = $1 WHERE id = $2`, err.Error(), r.ID)
+		s.ETL.WriteRefreshLogError(r.Table, msg, err)
+		s.ETL.UpdateMetadataStatus(r.Table, "ERROR", &msg)
+		s.Events.Publish(events.Event{Type: events.JobFailed, Table: r.Table, Message: msg})
+		return res, err
+	}
+
+	if cursor == nil {
+		cursor = r.CursorValue
+	}
+	_, err = s.DB.Exec(`UPDATE table_replicas SET cursor_value = $1, last_sync_at = $2, last_error = NULL WHERE id = $3`,
+		cursor, time.Now().UTC(), r.ID)
+	if err != nil {
+		return res, err
+	}
+	msg := fmt.Sprintf("Replicated %d rows from %s on %s", res.Rows, r.SourceTable, r.SourceURL)
+	s.ETL.WriteRefreshLogRows(r.Table, "OK", msg, res.Rows)
+	s.ETL.UpdateMetadataStatus(r.Table, "OK", nil)
+	s.Events.Publish(events.Event{Type: events.JobSucceeded, Table: r.Table, Message: msg,
+		Data: map[string]interface{}{"inserted_rows": res.Rows, "incremental": res.Incremental}})
+	return res, nil
+}
+
+// sync stages the remote rows in a scratch table, then swaps them in with
+// one transaction so readers never see a partial copy. Incremental syncs
+// replace the rows from the cursor's second on: the remote filters with
+// since (inclusive) and loaded timestamps keep whole seconds, so that
+// range is exactly what the remote sends again.
+func (s *Syncer) sync(r Replica) (Result, *string, error) {
+	res := Result{Table: r.Table}
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	local, err := db.ParseTableName(r.Table)
+	if err != nil {
+		return res, nil, err
+	}
+	remoteCols, err := s.remoteColumns(ctx, r)
+	if err != nil {
+		return res, nil, err
+	}
+	localCols, err := s.addColumns(local, remoteCols)
+	if err != nil {
+		return res, nil, err
+	}
+
+	query := url.Values{"format": {"ndjson"}}
+	var since *string
+	res.Incremental = db.HasProvenance(remoteCols) && db.HasProvenance(localCols)
+	if res.Incremental && r.CursorValue != nil {
+		if ts, err := time.Parse(time.RFC3339Nano, *r.CursorValue); err == nil {
+			v := ts.UTC().Truncate(time.Second).Format(time.RFC3339)
+			since = &v
+			query.Set("since", v)
+			query.Set("time_column", db.IngestedAtColumn)
+		}
+	}
+
+	staging := db.TableName{Schema: local.Schema, Name: local.Name + "__replica_sync"}
+	defs := make([]string, len(localCols))
+	names := make([]string, len(localCols))
+	for i, c := range localCols {
+		defs[i] = fmt.Sprintf(`"%s" %s`, c.ColumnName, c.DataType)
+		names[i] = `"` + c.ColumnName + `"`
+	}
+	if _, err := s.DB.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, staging.Quoted())); err != nil {
+		return res, nil, err
+	}
+	if _, err := s.DB.Exec(fmt.Sprintf(`CREATE TABLE %s (%s)`, staging.Quoted(), strings.Join(defs, ", "))); err != nil {
+		return res, nil, fmt.Errorf("create staging table: %w", err)
+	}
+	defer s.DB.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, staging.Quoted()))
+
+	resp, err := s.get(ctx, r, "/tables/"+url.PathEscape(r.SourceTable)+"/export", query)
+	if err != nil {
+		return res, nil, err
+	}
+	defer resp.Body.Close()
+
+	var high time.Time
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	dec.UseNumber()
+	chunk := make([]map[string]interface{}, 0, syncChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		rows, err := s.ETL.ValidatePayload(r.Table, chunk)
+		if err != nil {
+			return err
+		}
+		n, err := s.ETL.InsertRows(staging.String(), rows, nil)
+		res.Rows += n
+		chunk = chunk[:0]
+		return err
+	}
+	for {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return res, nil, fmt.Errorf("%w: decode export: %v", ErrRemote, err)
+		}
+		if raw, ok := row[db.IngestedAtColumn].(string); ok {
+			if ts, err := time.Parse(time.RFC3339Nano, raw); err == nil && ts.After(high) {
+				high = ts
+			}
+		}
+		if chunk = append(chunk, row); len(chunk) == syncChunkSize {
+			if err := flush(); err != nil {
+				return res, nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return res, nil, err
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return res, nil, err
+	}
+	defer tx.Rollback()
+	if since != nil {
+		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE "%s" >= $1`, local.Quoted(), db.IngestedAtColumn), *since)
+	} else {
+		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s`, local.Quoted()))
+	}
+	if err != nil {
+		return res, nil, err
+	}
+	cols := strings.Join(names, ", ")
+	if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, local.Quoted(), cols, cols, staging.Quoted())); err != nil {
+		return res, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return res, nil, err
+	}
+
+	if !res.Incremental || high.IsZero() {
+		return res, nil, nil
+	}
+	cursor := high.UTC().Format(time.RFC3339Nano)
+	return res, &cursor, nil
+}
+
+// addColumns adds columns the remote table gained since the last sync and
+// returns the local columns
+func (s *Syncer) addColumns(local db.TableName, remote []db.Column) ([]db.Column, error) {
+	cols, err := db.TableColumns(s.DB, local.String())
+	if err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	for _, c := range cols {
+		have[c.ColumnName] = true
+	}
+	dialect := db.DialectOf(s.DB)
+	added := false
+	for _, c := range remote {
+		if have[c.ColumnName] || strings.ContainsRune(c.ColumnName, '"') {
+			continue
+		}
+		stmt := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s`, local.Quoted(), c.ColumnName, localType(c.DataType, dialect))
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("add column %s: %w", c.ColumnName, err)
+		}
+		added = true
+	}
+	if !added {
+		return cols, nil
+	}
+	return db.TableColumns(s.DB, local.String())
+}
+
+// Watch follows the remote's event stream for r's source table and calls
+// fn whenever rows land there. It returns when the stream ends or ctx is done.
+func (s *Syncer) Watch(ctx context.Context, r Replica, fn func()) error {
+	resp, err := s.get(ctx, r, "/events", url.Values{"table": {r.SourceTable}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		name, ok := strings.CutPrefix(scanner.Text(), "event:")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case events.JobSucceeded, events.RowsIngested:
+			fn()
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%w: event stream: %v", ErrRemote, err)
+	}
+	return nil
+}
+
+// remoteColumns lists the source table's columns
+func (s *Syncer) remoteColumns(ctx context.Context, r Replica) ([]db.Column, error) {
+	resp, err := s.get(ctx, r, "/tables/"+url.PathEscape(r.SourceTable)+"/columns", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var cols []db.Column
+	if err := json.NewDecoder(resp.Body).Decode(&cols); err != nil {
+		return nil, fmt.Errorf("%w: decode columns: %v", ErrRemote, err)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%w: table %s not found on %s", ErrRemote, r.SourceTable, r.SourceURL)
+	}
+	return cols, nil
+}
+
+// remoteTableType looks the source table up in the remote catalog
+func (s *Syncer) remoteTableType(ctx context.Context, r Replica) (string, error) {
+	resp, err := s.get(ctx, r, "/tables", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tables []struct {
+		TableName string `json:"table_name"`
+		TableType string `json:"table_type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tables); err != nil {
+		return "", fmt.Errorf("%w: decode tables: %v", ErrRemote, err)
+	}
+	for _, t := range tables {
+		if t.TableName == r.SourceTable {
+			return t.TableType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: table %s is not registered on %s", ErrRemote, r.SourceTable, r.SourceURL)
+}
+
+// get calls the remote API; non-2xx responses become errors
+func (s *Syncer) get(ctx context.Context, r Replica, path string, query url.Values) (*http.Response, error) {
+	target := r.SourceURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRemote, err)
+	}
+	if r.APIKey != nil && *r.APIKey != "" {
+		req.Header.Set("X-API-Key", *r.APIKey)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRemote, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: GET %s returned %s: %s", ErrRemote, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// localType maps a remote column type onto one the local dialect accepts;
+// the two instances need not use the same database
+func localType(remote string, dialect db.Dialect) string {
+	t := strings.ToLower(remote)
+	switch {
+	case strings.Contains(t, "timestamp") || t == "datetime":
+		return "TIMESTAMP"
+	case t == "date":
+		return "DATE"
+	case strings.Contains(t, "bool"):
+		return "BOOLEAN"
+	case strings.Contains(t, "bigint") || strings.Contains(t, "int8"):
+		return "BIGINT"
+	case strings.Contains(t, "int"):
+		return "INTEGER"
+	case strings.Contains(t, "double") || strings.Contains(t, "real") || strings.Contains(t, "float"):
+		if dialect == db.SQLite {
+			return "REAL"
+		}
+		return "DOUBLE PRECISION"
+	case strings.Contains(t, "numeric") || strings.Contains(t, "decimal"):
+		return "NUMERIC"
+	case strings.Contains(t, "json"):
+		return "JSONB"
+	}
+	return "TEXT"
+}
@@ -0,0 +1,483 @@
+// Package rollup maintains continuous aggregates of time-series tables. A
+// rollup buckets a table's rows by a time column (minute, hour or day),
+// optionally by more columns, and stores aggregates of each bucket in a
+// table of its own, so dashboards read a few rows per bucket instead of
+// the raw data. After each refresh only the buckets at or past the
+// watermark (the latest bucket computed) are recomputed; rows arriving
+// for older buckets are picked up by a rebuild.
+package rollup
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/querybuilder"
+	"github.com/jmoiron/sqlx"
+)
+
+// Bucket widths
+const (
+	BucketMinute = "minute"
+	BucketHour   = "hour"
+	BucketDay    = "day"
+)
+
+// BucketColumn holds the start of each bucket in rollup tables
+const BucketColumn = "bucket"
+
+// sqliteBucketFormats truncate timestamps with strftime on SQLite
+var sqliteBucketFormats = map[string]string{
+	BucketMinute: "%Y-%m-%d %H:%M:00",
+	BucketHour:   "%Y-%m-%d %H:00:00",
+	BucketDay:    "%Y-%m-%d 00:00:00",
+}
+
+var identifierRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Columns is a JSON list of column names
+type Columns []string
+
+// Aggregates is a JSON list of aggregates
+type Aggregates []querybuilder.Aggregate
+
+// Rollup is a continuous aggregate of a table (a table_rollups row)
+type Rollup struct {
+	ID          int        `db:"id" json:"id"`
+	Table       string     `db:"table_name" json:"table"`
+	RollupTable string     `db:"rollup_table" json:"rollup_table"`
+	TimeColumn  string     `db:"time_column" json:"time_column"`
+	Bucket      string     `db:"bucket" json:"bucket"`
+	GroupBy     Columns    `db:"group_by" json:"group_by"`
+	Aggregates  Aggregates `db:"aggregates" json:"aggregates"`
+	Watermark   *string    `db:"watermark" json:"watermark"`
+	Enabled     bool       `db:"enabled" json:"enabled"`
+	LastRunAt   *time.Time `db:"last_run_at" json:"last_run_at"`
+	LastError   *string    `db:"last_error" json:"last_error"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Result is the outcome of one rollup run
+type Result struct {
+	RollupID    int     `json:"rollup_id"`
+	Table       string  `json:"table"`
+	RollupTable string  `json:"rollup_table"`
+	Buckets     int64   `json:"buckets"` // rows (re)written to the rollup table
+	Watermark   *string `json:"watermark,omitempty"`
+	Skipped     bool    `json:"skipped,omitempty"` // another run of the rollup was in progress
+	Error       string  `json:"error,omitempty"`
+}
+
+var (
+	// ErrNotFound is returned for an unknown rollup or table
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid wraps every problem with a rollup definition
+	ErrInvalid = errors.New("invalid rollup")
+)
+
+// Maintainer manages table rollups and keeps them up to date
+type Maintainer struct {
+	DB     *sqlx.DB
+	Events *events.Broker
+
+	mu      sync.Mutex
+	running map[int]bool
+}
+
+func NewMaintainer(db *sqlx.DB, broker *events.Broker) *Maintainer {
+	return &Maintainer{DB: db, Events: broker, running: map[int]bool{}}
+}
+
+// List returns table's rollups, oldest first
+func (m *Maintainer) List(table string) ([]Rollup, error) {
+	rollups := []Rollup{}
+	err := m.DB.Select(&rollups, `SELECT * FROM table_rollups WHERE table_name = $1 ORDER BY id`, table)
+	return rollups, err
+}
+
+// Get returns one of table's rollups
+func (m *Maintainer) Get(table string, id int) (Rollup, error) {
+	var r Rollup
+	err := m.DB.Get(&r, `SELECT * FROM table_rollups WHERE id = $1 AND table_name = $2`, id, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, fmt.Errorf("rollup %d: %w", id, ErrNotFound)
+	}
+	return r, err
+}
+
+// Create validates r, creates its rollup table named name next to table
+// and stores it. Aggregates are named func_column unless they set as.
+func (m *Maintainer) Create(table, name string, r Rollup) (Rollup, error) {
+	var registered int
+	if err := m.DB.Get(&registered, `SELECT COUNT(*) FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return r, err
+	}
+	if registered == 0 {
+		return r, fmt.Errorf("table %s: %w", table, ErrNotFound)
+	}
+	r.Table = table
+
+	source, err := db.ParseTableName(table)
+	if err != nil {
+		return r, err
+	}
+	if !identifierRE.MatchString(name) {
+		return r, fmt.Errorf("%w: name must be a valid identifier", ErrInvalid)
+	}
+	target := db.TableName{Schema: source.Schema, Name: name}
+	r.RollupTable = target.String()
+	existing, err := db.TableColumns(m.DB, r.RollupTable)
+	if err != nil {
+		return r, err
+	}
+	if len(existing) > 0 {
+		return r, fmt.Errorf("%w: table %s already exists", ErrInvalid, r.RollupTable)
+	}
+
+	if err := m.check(&r); err != nil {
+		return r, err
+	}
+
+	// an empty result of the rollup query gives the table its column types
+	query, err := m.selectSQL(r)
+	if err != nil {
+		return r, err
+	}
+	if _, err := m.DB.Exec(fmt.Sprintf(`CREATE TABLE %s AS %s LIMIT 0`, target.Quoted(), query)); err != nil {
+		return r, fmt.Errorf("can't create rollup table: %w", err)
+	}
+	index := quoteName(name + "_" + BucketColumn + "_idx") // created in the table's schema
+	if _, err := m.DB.Exec(fmt.Sprintf(`CREATE INDEX %s ON %s ("%s")`, index, target.Quoted(), BucketColumn)); err != nil {
+		m.drop(r.RollupTable)
+		return r, fmt.Errorf("can't index rollup table: %w", err)
+	}
+
+	var id int
+	err = m.DB.Get(&id, `
+		INSERT INTO table_rollups (table_name, rollup_table, time_column, bucket, group_by, aggregates, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`, r.Table, r.RollupTable, r.TimeColumn, r.Bucket, r.GroupBy, r.Aggregates, r.Enabled)
+	if err != nil {
+		m.drop(r.RollupTable)
+		return r, err
+	}
+	return m.Get(table, id)
+}
+
+// check validates r against its table's columns and names its aggregates
+func (m *Maintainer) check(r *Rollup) error {
+	if _, ok := sqliteBucketFormats[r.Bucket]; !ok {
+		return fmt.Errorf("%w: bucket must be minute, hour or day", ErrInvalid)
+	}
+	cols, err := db.TableColumns(m.DB, r.Table)
+	if err != nil {
+		return err
+	}
+	types := map[string]string{}
+	for _, c := range cols {
+		types[c.ColumnName] = strings.ToLower(c.DataType)
+	}
+
+	typ, ok := types[r.TimeColumn]
+	if !ok {
+		return fmt.Errorf("%w: time_column must name one of the table's columns", ErrInvalid)
+	}
+	if !strings.Contains(typ, "timestamp") && !strings.Contains(typ, "datetime") && typ != "date" {
+		return fmt.Errorf("%w: time_column %s is %s, not a timestamp", ErrInvalid, r.TimeColumn, typ)
+	}
+
+	names := map[string]bool{BucketColumn: true}
+	for _, col := range r.GroupBy {
+		if _, ok := types[col]; !ok {
+			return fmt.Errorf("%w: group_by column %q is not one of the table's columns", ErrInvalid, col)
+		}
+		if names[col] {
+			return fmt.Errorf("%w: column %q appears twice in the rollup", ErrInvalid, col)
+		}
+		names[col] = true
+	}
+
+	if len(r.Aggregates) == 0 {
+		return fmt.Errorf("%w: at least one aggregate is required", ErrInvalid)
+	}
+	for i, a := range r.Aggregates {
+		if a.Column != "" {
+			if _, ok := types[a.Column]; !ok {
+				return fmt.Errorf("%w: aggregates[%d]: column %q is not one of the table's columns", ErrInvalid, i, a.Column)
+			}
+		}
+		if a.As == "" {
+			a.As = strings.ToLower(a.Func)
+			if a.Column != "" {
+				a.As += "_" + a.Column
+			}
+		}
+		if _, err := a.SQL(); err != nil {
+			return fmt.Errorf("%w: aggregates[%d]: %v", ErrInvalid, i, err)
+		}
+		if names[a.As] {
+			return fmt.Errorf("%w: column %q appears twice in the rollup", ErrInvalid, a.As)
+		}
+		names[a.As] = true
+		r.Aggregates[i] = a
+	}
+	return nil
+}
+
+// Delete removes one of table's rollups and drops its rollup table
+func (m *Maintainer) Delete(table string, id int) error {
+	r, err := m.Get(table, id)
+	if err != nil {
+		return err
+	}
+	if err := m.drop(r.RollupTable); err != nil {
+		return err
+	}
+	_, err = m.DB.Exec(`DELETE FROM table_rollups WHERE id = $1`, id)
+	return err
+}
+
+func (m *Maintainer) drop(table string) error {
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.Exec(`DROP TABLE IF EXISTS ` + t.Quoted())
+	return err
+}
+
+// AfterRefresh brings table's enabled rollups up to date in turn. Failures
+// are recorded on the rollup and published; they never fail the refresh.
+func (m *Maintainer) AfterRefresh(table string) []Result {
+	if m == nil {
+		return nil
+	}
+	var rollups []Rollup
+	if err := m.DB.Select(&rollups, `SELECT * FROM table_rollups WHERE table_name = $1 AND enabled = TRUE ORDER BY id`, table); err != nil {
+		log.Printf("[rollup] can't load rollups for %s: %v", table, err)
+		return nil
+	}
+	results := make([]Result, 0, len(rollups))
+	for _, r := range rollups {
+		results = append(results, m.Run(r, false))
+	}
+	return results
+}
+
+// -----------------------------------------------------
+// Run recomputes the buckets of r at or past its watermark, or every
+// bucket when rebuild is set. Runs of the same rollup never overlap: a
+// second caller gets a skipped result.
+// -----------------------------------------------------
+func (m *Maintainer) Run(r Rollup, rebuild bool) Result {
+	res := Result{RollupID: r.ID, Table: r.Table, RollupTable: r.RollupTable}
+
+	m.mu.Lock()
+	if m.running[r.ID] {
+		m.mu.Unlock()
+		res.Skipped = true
+		return res
+	}
+	m.running[r.ID] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, r.ID)
+		m.mu.Unlock()
+	}()
+
+	if rebuild {
+		r.Watermark = nil
+	}
+	watermark, err := m.update(r, &res.Buckets)
+	now := time.Now().UTC()
+	if err != nil {
+		res.Error = err.Error()
+		log.Printf("[rollup] %s rollup %s failed: %v", r.Table, r.RollupTable, err)
+		m.DB.Exec(`UPDATE table_rollups SET last_error = $1, last_run_at = $2 WHERE id = $3`, res.Error, now, r.ID)
+		m.Events.Publish(events.Event{Type: events.RollupFailed, Table: r.Table, Message: res.Error,
+			Data: map[string]interface{}{"rollup_id": r.ID, "rollup_table": r.RollupTable}})
+		return res
+	}
+	res.Watermark = watermark
+	if _, err := m.DB.Exec(`UPDATE table_rollups SET watermark = $1, last_run_at = $2, last_error = NULL WHERE id = $3`,
+		watermark, now, r.ID); err != nil {
+		// the buckets are written; the next run recomputes them again
+		log.Printf("[rollup] %s rollup %s: can't advance watermark: %v", r.Table, r.RollupTable, err)
+	}
+	return res
+}
+
+// update replaces the buckets at or past r's watermark in one transaction
+// and returns the new watermark
+func (m *Maintainer) update(r Rollup, buckets *int64) (*string, error) {
+	query, err := m.selectSQL(r)
+	if err != nil {
+		return nil, err
+	}
+	target, err := db.ParseTableName(r.RollupTable)
+	if err != nil {
+		return nil, err
+	}
+	columns := []string{quoteName(BucketColumn)}
+	for _, col := range r.GroupBy {
+		columns = append(columns, quoteName(col))
+	}
+	for _, a := range r.Aggregates {
+		columns = append(columns, quoteName(a.As))
+	}
+
+	del := `DELETE FROM ` + target.Quoted()
+	var args []interface{}
+	if r.Watermark != nil {
+		del += fmt.Sprintf(` WHERE "%s" >= $1`, BucketColumn)
+		args = append(args, m.watermarkArg(*r.Watermark))
+	}
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) %s`, target.Quoted(), strings.Join(columns, ", "), query)
+
+	tx, err := m.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(del, args...); err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(insert, args...)
+	if err != nil {
+		return nil, err
+	}
+	*buckets, _ = result.RowsAffected()
+
+	var latest interface{}
+	if err := tx.QueryRow(fmt.Sprintf(`SELECT MAX("%s") FROM %s`, BucketColumn, target.Quoted())).Scan(&latest); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return watermarkText(latest), nil
+}
+
+// selectSQL is the query computing r's buckets; with a watermark it reads
+// only the rows from the watermark on, taking it as parameter $1
+func (m *Maintainer) selectSQL(r Rollup) (string, error) {
+	source, err := db.ParseTableName(r.Table)
+	if err != nil {
+		return "", err
+	}
+	timeCol := quoteName(r.TimeColumn)
+	bucket := m.bucketExpr(r.Bucket, timeCol)
+
+	selects := []string{bucket + " AS " + quoteName(BucketColumn)}
+	groups := []string{bucket}
+	for _, col := range r.GroupBy {
+		selects = append(selects, quoteName(col))
+		groups = append(groups, quoteName(col))
+	}
+	for _, a := range r.Aggregates {
+		q, err := a.SQL()
+		if err != nil {
+			return "", err
+		}
+		selects = append(selects, q)
+	}
+
+	where := timeCol + " IS NOT NULL"
+	if r.Watermark != nil {
+		if db.DialectOf(m.DB) == db.SQLite {
+			// stored timestamps vary in format; compare truncated ones
+			where += " AND " + bucket + " >= $1"
+		} else {
+			where += " AND " + timeCol + " >= $1"
+		}
+	}
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE %s GROUP BY %s`,
+		strings.Join(selects, ", "), source.Quoted(), where, strings.Join(groups, ", ")), nil
+}
+
+// bucketExpr truncates col to the start of its bucket
+func (m *Maintainer) bucketExpr(bucket, col string) string {
+	if db.DialectOf(m.DB) == db.SQLite {
+		return fmt.Sprintf("strftime('%s', %s)", sqliteBucketFormats[bucket], col)
+	}
+	return fmt.Sprintf("date_trunc('%s', %s)", bucket, col)
+}
+
+// watermarkArg turns a stored watermark back into a bucket value: a time
+// on Postgres, the strftime text on SQLite
+func (m *Maintainer) watermarkArg(w string) interface{} {
+	if db.DialectOf(m.DB) != db.SQLite {
+		if ts, err := time.Parse(time.RFC3339Nano, w); err == nil {
+			return ts
+		}
+	}
+	return w
+}
+
+// watermarkText is how a bucket value is stored as watermark; nil when
+// the rollup is empty
+func watermarkText(v interface{}) *string {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		s = t.Format(time.RFC3339Nano)
+	case []byte:
+		s = string(t)
+	default:
+		s = fmt.Sprint(v)
+	}
+	return &s
+}
+
+func quoteName(name string) string {
+	return `"` + name + `"`
+}
+
+// Scan decodes a JSON list column
+func (c *Columns) Scan(src interface{}) error {
+	return scanJSON(src, c)
+}
+
+// Value encodes the list as JSON text
+func (c Columns) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(c)
+	return string(raw), err
+}
+
+// Scan decodes a JSON list column
+func (a *Aggregates) Scan(src interface{}) error {
+	return scanJSON(src, a)
+}
+
+// Value encodes the list as JSON text
+func (a Aggregates) Value() (driver.Value, error) {
+	raw, err := json.Marshal(a)
+	return string(raw), err
+}
+
+func scanJSON(src, dst interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	}
+	return fmt.Errorf("can't decode %T as JSON", src)
+}
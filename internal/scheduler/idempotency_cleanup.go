@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// -----------------------------------------------------
+// IdempotencyCleanup periodically deletes ingest
+// Idempotency-Key records older than the replay window
+// -----------------------------------------------------
+type IdempotencyCleanup struct {
+	db       *sqlx.DB
+	ttl      time.Duration
+	interval time.Duration
+}
+
+func NewIdempotencyCleanup(db *sqlx.DB, ttl time.Duration) *IdempotencyCleanup {
+	return &IdempotencyCleanup{db: db, ttl: ttl, interval: time.Hour}
+}
+
+// Start runs cleanup once at boot, then every interval
+func (ic *IdempotencyCleanup) Start(ctx context.Context) {
+	if ic.ttl <= 0 {
+		return // keys are kept forever
+	}
+
+	ic.runOnce()
+
+	ticker := time.NewTicker(ic.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ic.runOnce()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ic *IdempotencyCleanup) runOnce() {
+	cutoff := time.Now().UTC().Add(-ic.ttl)
+	res, err := ic.db.Exec(`DELETE FROM ingest_idempotency_keys WHERE created_at < $1`, cutoff)
+	if err != nil {
+		log.Printf("[retention] idempotency key cleanup failed: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[retention] removed %d expired idempotency keys", n)
+	}
+}
@@ -2,12 +2,19 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alkha0306/godataflow/internal/db"
 	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/quality"
+	"github.com/alkha0306/godataflow/internal/rollup"
+	"github.com/alkha0306/godataflow/internal/sink"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -15,13 +22,25 @@ import (
 // JobManager orchestrates ETL jobs for time-series tables
 // -----------------------------------------------------
 type JobManager struct {
-	db         *sqlx.DB
-	etl        *etl.ETLProcessor
-	wg         sync.WaitGroup
-	cancel     context.CancelFunc
-	started    bool
-	jobMap     map[string]*jobEntry
-	jobMapLock sync.Mutex
+	db           *sqlx.DB
+	etl          *etl.ETLProcessor
+	events       *events.Broker
+	quality      *quality.Runner    // nil = no data quality checks
+	sinks        *sink.Exporter     // nil = no export sinks
+	rollups      *rollup.Maintainer // nil = no continuous aggregates
+	health       *db.Monitor        // nil = assume the database is always up
+	pollInterval time.Duration
+	queue        *Queue
+	slots        chan struct{} // bounds concurrent ETL runs
+	wg           sync.WaitGroup
+	cancel       context.CancelFunc
+	started      atomic.Bool
+	jobMap       map[string]*jobEntry
+	jobMapLock   sync.Mutex
+
+	pauseLock sync.Mutex
+	pause     *PauseState // nil while runs are launched
+	inFlight  atomic.Int64
 }
 
 type jobEntry struct {
@@ -32,31 +51,74 @@ type jobEntry struct {
 // -----------------------------------------------------
 // Constructor
 // -----------------------------------------------------
-func NewJobManager(db *sqlx.DB) *JobManager {
+// Options tunes the scheduler loop
+type Options struct {
+	PollInterval time.Duration
+	Concurrency  int
+	Health       *db.Monitor        // runs are skipped while the database is degraded
+	Quality      *quality.Runner    // data quality checks run after each successful refresh
+	Sinks        *sink.Exporter     // export sinks run after each successful refresh
+	Rollups      *rollup.Maintainer // rollups are brought up to date after each successful refresh
+}
+
+func NewJobManager(db *sqlx.DB, etlProc *etl.ETLProcessor, broker *events.Broker, opts Options) *JobManager {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 30 * time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
 	return &JobManager{
-		db:     db,
-		etl:    etl.NewETLProcessor(db),
-		jobMap: make(map[string]*jobEntry),
+		db:           db,
+		etl:          etlProc,
+		events:       broker,
+		health:       opts.Health,
+		quality:      opts.Quality,
+		sinks:        opts.Sinks,
+		rollups:      opts.Rollups,
+		pollInterval: opts.PollInterval,
+		queue:        NewQueue(db),
+		slots:        make(chan struct{}, opts.Concurrency),
+		jobMap:       make(map[string]*jobEntry),
 	}
 }
 
+// Queue is where refresh runs wait for a worker
+func (jm *JobManager) Queue() *Queue {
+	return jm.queue
+}
+
 // -----------------------------------------------------
 // Start: Scheduler Loop
-// Checks metadata periodically and launches/updates jobs
+// Checks metadata periodically and launches/updates jobs, which enqueue
+// a run each tick; the dispatcher runs queued jobs in the free slots
 // -----------------------------------------------------
 func (jm *JobManager) Start(ctx context.Context) {
-	if jm.started {
+	if !jm.started.CompareAndSwap(false, true) {
 		log.Println("[scheduler] JobManager already running")
 		return
 	}
-	jm.started = true
+	defer jm.started.Store(false) // so a later leadership term can start it again
 
 	ctx, cancel := context.WithCancel(ctx)
 	jm.cancel = cancel
 
 	log.Println("[scheduler] Starting auto-refresh scheduler...")
 
-	ticker := time.NewTicker(30 * time.Second)
+	// Jobs locked by the previous process (or leader) run again
+	dropped, err := jm.queue.reclaim()
+	if err != nil {
+		log.Printf("[scheduler] failed to reclaim queued jobs: %v", err)
+	}
+	for _, job := range dropped {
+		msg := fmt.Sprintf("%s run dropped from the queue after %d interrupted attempts", job.Kind, job.Attempts)
+		log.Printf("[scheduler] %s: %s", job.Table, msg)
+		jm.etl.WriteRefreshLogError(job.Table, msg, nil)
+	}
+	jm.wg.Add(1)
+	go jm.dispatch(ctx)
+
+	ticker := time.NewTicker(jm.pollInterval)
 	defer ticker.Stop()
 
 	for {
@@ -75,18 +137,29 @@ func (jm *JobManager) Start(ctx context.Context) {
 // checkJobs: Detects new, changed, or removed table jobs
 // -----------------------------------------------------
 func (jm *JobManager) checkJobs(parentCtx context.Context) {
+	if !jm.health.Healthy() {
+		// keep existing jobs; the monitor logs the outage
+		return
+	}
+
 	var tables []struct {
 		TableName       string  `db:"table_name"`
 		RefreshInterval int     `db:"refresh_interval"`
 		DataSourceURL   *string `db:"data_source_url"`
 	}
 
+	// Tables backing off after repeated failures refresh every failure_backoff;
+	// auto-paused ones get no job
 	err := jm.db.Select(&tables, `
-		SELECT table_name, refresh_interval, data_source_url
+		SELECT table_name, data_source_url,
+			CASE WHEN failure_action = 'backoff' AND consecutive_failures >= failure_threshold
+				THEN COALESCE(failure_backoff, refresh_interval)
+				ELSE refresh_interval END AS refresh_interval
 		FROM table_metadata
 		WHERE table_type = 'time_series'
 		AND refresh_interval IS NOT NULL
-		AND data_source_url IS NOT NULL;
+		AND data_source_url IS NOT NULL
+		AND refresh_paused_at IS NULL;
 	`)
 	if err != nil {
 		log.Printf("[scheduler] Error loading tables: %v", err)
@@ -102,9 +175,12 @@ func (jm *JobManager) checkJobs(parentCtx context.Context) {
 		currentTables[t.TableName] = true
 		entry, running := jm.jobMap[t.TableName]
 
-		// Start new job
+		// Start new job; a table that never ran refreshes right away
 		if !running {
 			jm.startJob(parentCtx, t.TableName, t.RefreshInterval)
+			if _, err := jm.queue.EnqueueFirst(t.TableName); err != nil {
+				log.Printf("[scheduler] Can't queue first %s refresh: %v", t.TableName, err)
+			}
 			continue
 		}
 
@@ -150,7 +226,7 @@ func (jm *JobManager) startJob(parentCtx context.Context, tableName string, inte
 		for {
 			select {
 			case <-ticker.C:
-				jm.runETL(tableName)
+				jm.enqueueTick(tableName)
 			case <-jobCtx.Done():
 				log.Printf("[scheduler] Stopped job for %s", tableName)
 				return
@@ -160,63 +236,310 @@ func (jm *JobManager) startJob(parentCtx context.Context, tableName string, inte
 }
 
 // -----------------------------------------------------
-// runETL: Full ETL cycle for a single table
+// enqueueTick: queues a scheduled refresh of table
 // -----------------------------------------------------
-func (jm *JobManager) runETL(table string) {
-	var meta struct {
-		DataSourceURL string `db:"data_source_url"`
+func (jm *JobManager) enqueueTick(table string) {
+	if !jm.health.Healthy() {
+		log.Printf("[scheduler] Skipping %s refresh: database unavailable", table)
+		return
+	}
+	if jm.paused() {
+		log.Printf("[scheduler] Skipping %s refresh: scheduler paused", table)
+		return
 	}
+	if _, err := jm.queue.enqueueTick(table); err != nil {
+		log.Printf("[scheduler] Can't queue %s refresh: %v", table, err)
+	}
+}
 
-	err := jm.db.Get(&meta,
-		`SELECT data_source_url FROM table_metadata WHERE table_name = $1`,
-		table,
-	)
+// -----------------------------------------------------
+// dispatch: waits for a free concurrency slot, claims the next due job
+// and runs it, until ctx is done. Nothing is claimed while the database
+// is degraded or the scheduler is paused, so queued jobs wait.
+// -----------------------------------------------------
+func (jm *JobManager) dispatch(ctx context.Context) {
+	defer jm.wg.Done()
+
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case jm.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		if job := jm.claim(); job != nil {
+			jm.wg.Add(1)
+			go func() {
+				defer jm.wg.Done()
+				defer func() { <-jm.slots }()
+				jm.runQueued(*job)
+			}()
+			continue
+		}
+		<-jm.slots
+
+		select {
+		case <-ticker.C:
+		case <-jm.queue.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// claim takes the next due job; nil when there is none or none may run
+func (jm *JobManager) claim() *QueuedJob {
+	if !jm.health.Healthy() || jm.paused() {
+		return nil
+	}
+	job, err := jm.queue.claim()
 	if err != nil {
-		log.Printf("[scheduler] Can't load metadata for %s: %v", table, err)
-		return
+		log.Printf("[scheduler] failed to claim a queued job: %v", err)
+		return nil
+	}
+	return job
+}
+
+// runQueued runs a claimed job and removes it from the queue
+func (jm *JobManager) runQueued(job QueuedJob) {
+	jm.inFlight.Add(1)
+	defer jm.inFlight.Add(-1)
+
+	switch job.Kind {
+	case KindRetry:
+		var sources []etl.Source
+		if job.Params != nil {
+			json.Unmarshal(*job.Params, &sources)
+		}
+		retryOf := 0
+		if job.RetryOf != nil {
+			retryOf = *job.RetryOf
+		}
+		jm.events.Publish(events.Event{Type: events.JobStarted, Table: job.Table, Message: fmt.Sprintf("retry of run %d", retryOf)})
+		jm.refresh(job.Table, sources, retryOf)
+	default:
+		jm.runETL(job.Table)
+	}
+
+	if err := jm.queue.done(job.ID); err != nil {
+		log.Printf("[scheduler] failed to remove queued job %d: %v", job.ID, err)
+	}
+}
+
+// PauseState is why and since when the scheduler is paused
+type PauseState struct {
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// SchedulerStatus reports whether scheduled refreshes are launched
+type SchedulerStatus struct {
+	Active   bool        `json:"active"` // the scheduler runs on this instance: it is enabled and this instance leads
+	Paused   bool        `json:"paused"`
+	Pause    *PauseState `json:"pause,omitempty"`
+	Jobs     int         `json:"jobs"`      // tables with a refresh job
+	InFlight int         `json:"in_flight"` // queued runs going on this instance
+	Queued   int         `json:"queued"`    // jobs waiting for or held by a worker, on any instance
+}
+
+// -----------------------------------------------------
+// Pause: stop launching scheduled refreshes on all tables, e.g. for a
+// database maintenance window. Runs already going finish; jobs keep
+// ticking but skip their runs until Resume, and queued runs wait.
+// Manual refreshes that are not queued are not affected. The pause lasts
+// until Resume or a restart of this instance; with several instances,
+// pause each, as leadership can move. Returns false when already paused.
+// -----------------------------------------------------
+func (jm *JobManager) Pause(reason string) bool {
+	jm.pauseLock.Lock()
+	defer jm.pauseLock.Unlock()
+	if jm.pause != nil {
+		return false
+	}
+	jm.pause = &PauseState{Since: time.Now().UTC(), Reason: reason}
+	log.Printf("[scheduler] Paused: %s", reason)
+	return true
+}
+
+// -----------------------------------------------------
+// Resume: launch scheduled refreshes again; each table runs on its next
+// tick. Returns false when not paused.
+// -----------------------------------------------------
+func (jm *JobManager) Resume() bool {
+	jm.pauseLock.Lock()
+	defer jm.pauseLock.Unlock()
+	if jm.pause == nil {
+		return false
 	}
+	log.Printf("[scheduler] Resumed after %s", time.Since(jm.pause.Since).Round(time.Second))
+	jm.pause = nil
+	return true
+}
+
+func (jm *JobManager) paused() bool {
+	jm.pauseLock.Lock()
+	defer jm.pauseLock.Unlock()
+	return jm.pause != nil
+}
 
-	// 1. Fetch
-	rows, err := jm.etl.FetchData(meta.DataSourceURL)
+// -----------------------------------------------------
+// Status: pause state, jobs and refreshes in flight
+// -----------------------------------------------------
+func (jm *JobManager) Status() SchedulerStatus {
+	jm.pauseLock.Lock()
+	st := SchedulerStatus{Active: jm.started.Load(), Paused: jm.pause != nil, InFlight: int(jm.inFlight.Load())}
+	if jm.pause != nil {
+		pause := *jm.pause
+		st.Pause = &pause
+	}
+	jm.pauseLock.Unlock()
+	jm.jobMapLock.Lock()
+	st.Jobs = len(jm.jobMap)
+	jm.jobMapLock.Unlock()
+	st.Queued, _ = jm.queue.Len()
+	return st
+}
+
+// -----------------------------------------------------
+// runETL: Full ETL cycle for a single table
+// -----------------------------------------------------
+func (jm *JobManager) runETL(table string) {
+	sources, err := jm.etl.LoadSources(table)
 	if err != nil {
-		jm.handleETLError(table, "Fetch failed", err)
+		log.Printf("[scheduler] Can't load metadata for %s: %v", table, err)
 		return
 	}
 
-	// 2. Transform
-	rows = jm.etl.TransformPayload(rows)
+	jm.events.Publish(events.Event{Type: events.JobStarted, Table: table})
+	jm.refresh(table, sources, 0)
+}
 
-	// 3. Validate
-	validRows, err := jm.etl.ValidatePayload(table, rows)
+// -----------------------------------------------------
+// refresh: loads table from sources and records the run, as a retry of
+// run retryOf unless it is 0
+// -----------------------------------------------------
+func (jm *JobManager) refresh(table string, sources []etl.Source, retryOf int) {
+	// Fetch → transform → validate → insert, streamed in chunks
+	result, err := jm.etl.RefreshSources(table, sources)
+	result.RetryOf = retryOf
 	if err != nil {
-		jm.handleETLError(table, "Validation failed", err)
+		jm.handleETLError(table, err, result)
 		return
 	}
 
-	// 4. Insert
-	count, err := jm.etl.InsertRows(table, validRows)
-	if err != nil {
-		jm.handleETLError(table, "Insert failed", err)
+	if drift := result.DriftMessage(); drift != "" {
+		jm.events.Publish(events.Event{Type: events.SchemaDrift, Table: table, Message: drift,
+			Data: map[string]interface{}{"changes": result.SchemaChanges}})
+	}
+
+	// Quality checks and expectations; a broken expectation fails the run
+	if outcome := jm.quality.AfterRefresh(table); outcome.Blocked() {
+		err := etl.ExpectationError(result.Inserted, outcome.Violations)
+		result.Inserted = 0 // already in the expectation message
+		jm.handleETLError(table, err, result)
 		return
 	}
 
-	// 5. Success
-	successMsg := fmt.Sprintf("Inserted %d rows", count)
-	jm.etl.WriteRefreshLog(table, "OK", successMsg)
-	jm.etl.UpdateMetadataStatus(table, "OK", nil)
+	// Success (or nothing new upstream); WARN when the volume is anomalous
+	status, successMsg, warning := jm.etl.SuccessStatus(table, result)
+	jm.etl.WriteRefreshLogRun(table, status, successMsg, result, nil)
+	jm.etl.UpdateMetadataStatus(table, status, nil)
+	jm.events.Publish(events.Event{
+		Type:    events.JobSucceeded,
+		Table:   table,
+		Message: successMsg,
+		Data:    map[string]interface{}{"inserted_rows": result.Inserted, "unchanged": result.Unchanged},
+	})
+	if warning != "" {
+		jm.events.Publish(events.Event{Type: events.VolumeAnomaly, Table: table, Message: warning,
+			Data: map[string]interface{}{"inserted_rows": result.Inserted}})
+	}
+
+	// Push the new rows to the table's export sinks; failures are recorded per sink
+	if !result.Unchanged {
+		jm.sinks.AfterRefresh(table)
+		jm.rollups.AfterRefresh(table)
+	}
 
-	log.Printf("[scheduler] %s refresh OK → %s", table, successMsg)
+	log.Printf("[scheduler] %s refresh %s → %s", table, status, successMsg)
 }
 
 // -----------------------------------------------------
 // handleETLError: Helper to log + metadata update
 // -----------------------------------------------------
-func (jm *JobManager) handleETLError(table, prefix string, err error) {
-	msg := fmt.Sprintf("%s: %v", prefix, err)
+func (jm *JobManager) handleETLError(table string, err error, result etl.RefreshResult) {
+	msg := err.Error()
+	if result.Inserted > 0 {
+		msg = fmt.Sprintf("%s (%d rows inserted before the failure)", msg, result.Inserted)
+	}
 	log.Printf("[scheduler] %s → %s", table, msg)
 
-	jm.etl.WriteRefreshLog(table, "ERROR", msg)
+	jm.etl.WriteRefreshLogRun(table, "ERROR", msg, result, err)
 	jm.etl.UpdateMetadataStatus(table, "ERROR", &msg)
+	jm.events.Publish(events.Event{
+		Type:    events.JobFailed,
+		Table:   table,
+		Message: msg,
+		Data:    map[string]interface{}{"error_code": etl.ErrorCode(err)},
+	})
+	jm.escalate(table, msg)
+}
+
+// -----------------------------------------------------
+// escalate: applies table's failure policy once its failure streak
+// reaches the threshold. backoff takes effect at the next poll, when the
+// job restarts on failure_backoff; pause stops the job now. Every action
+// but retry publishes job.escalated on reaching the threshold, and page
+// publishes it again each further threshold failures.
+// -----------------------------------------------------
+func (jm *JobManager) escalate(table, msg string) {
+	policy, err := jm.etl.LoadFailurePolicy(table)
+	if err != nil {
+		log.Printf("[scheduler] %s: %v", table, err)
+		return
+	}
+	if !policy.Escalated() || policy.Action == etl.FailureRetry {
+		return
+	}
+	threshold := *policy.Threshold
+	if policy.Failures != threshold && (policy.Action != etl.FailurePage || policy.Failures%threshold != 0) {
+		return
+	}
+
+	switch policy.Action {
+	case etl.FailureBackoff:
+		log.Printf("[scheduler] %s failed %d times in a row: backing off until a refresh succeeds", table, policy.Failures)
+	case etl.FailurePause:
+		if err := jm.etl.PauseRefreshes(table); err != nil {
+			log.Printf("[scheduler] %s: failed to pause refreshes: %v", table, err)
+			return
+		}
+		log.Printf("[scheduler] %s failed %d times in a row: pausing scheduled refreshes", table, policy.Failures)
+		jm.stopJob(table)
+	case etl.FailurePage:
+		log.Printf("[scheduler] %s failed %d times in a row: paging", table, policy.Failures)
+	}
+	jm.events.Publish(events.Event{
+		Type:    events.JobEscalated,
+		Table:   table,
+		Message: msg,
+		Data:    map[string]interface{}{"action": policy.Action, "consecutive_failures": policy.Failures},
+	})
+}
+
+// -----------------------------------------------------
+// stopJob: cancels table's refresh job, if it has one
+// -----------------------------------------------------
+func (jm *JobManager) stopJob(table string) {
+	jm.jobMapLock.Lock()
+	defer jm.jobMapLock.Unlock()
+	if entry, ok := jm.jobMap[table]; ok {
+		entry.cancel()
+		delete(jm.jobMap, table)
+	}
 }
 
 // -----------------------------------------------------
@@ -224,13 +547,24 @@ func (jm *JobManager) handleETLError(table, prefix string, err error) {
 // -----------------------------------------------------
 func (jm *JobManager) stopAllJobs() {
 	log.Println("[scheduler] Stopping all running jobs...")
-	for _, entry := range jm.jobMap {
+	jm.jobMapLock.Lock()
+	for tableName, entry := range jm.jobMap {
 		entry.cancel()
+		delete(jm.jobMap, tableName)
 	}
+	jm.jobMapLock.Unlock()
 	jm.wg.Wait()
 	log.Println("[scheduler] All jobs stopped.")
 }
 
+// -----------------------------------------------------
+// ActiveJobs: Number of refreshes running on this instance, scheduled,
+// queued or started by hand
+// -----------------------------------------------------
+func (jm *JobManager) ActiveJobs() int {
+	return jm.etl.Running()
+}
+
 // -----------------------------------------------------
 // Stop: External shutdown
 // -----------------------------------------------------
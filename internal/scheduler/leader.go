@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql/driver"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// leaderLockKey identifies the Postgres advisory lock held by the scheduler leader
+const leaderLockKey int64 = 0x6764664c // "gdfL"
+
+// -----------------------------------------------------
+// Elector picks one of the instances sharing a database to run the
+// scheduled jobs, while every instance serves HTTP. Leadership is a
+// session-level Postgres advisory lock held on a dedicated connection:
+// followers try to take it every lease, and the leader confirms its
+// connection every lease. A leader that dies or loses the database frees
+// the lock with its session, so a follower takes over within about one
+// lease. Runs the old leader had in flight still finish, so they may
+// overlap the new leader's first ones.
+// -----------------------------------------------------
+type Elector struct {
+	db      *sqlx.DB
+	lease   time.Duration
+	leading atomic.Bool
+}
+
+// NewElector elects over database; a lease of 0 turns election off and
+// this instance always leads, as it does on SQLite (one instance per file)
+func NewElector(database *sqlx.DB, lease time.Duration) *Elector {
+	return &Elector{db: database, lease: lease}
+}
+
+// Leading reports whether this instance currently leads
+func (e *Elector) Leading() bool {
+	return e.leading.Load()
+}
+
+// -----------------------------------------------------
+// Run: calls lead each time this instance becomes leader, cancelling its
+// context (and waiting for it to return) when leadership is lost, until
+// ctx is done
+// -----------------------------------------------------
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	if e.lease <= 0 || db.DialectOf(e.db) != db.Postgres {
+		e.leading.Store(true)
+		lead(ctx)
+		e.leading.Store(false)
+		return
+	}
+
+	for {
+		if conn := e.acquire(ctx); conn != nil {
+			e.hold(ctx, conn, lead)
+		}
+		select {
+		case <-time.After(e.lease):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// acquire takes the leader lock on a connection of its own; nil when
+// another instance holds it or the database is unreachable
+func (e *Elector) acquire(ctx context.Context) *sqlx.Conn {
+	conn, err := e.db.Connx(ctx)
+	if err != nil {
+		return nil // the health monitor logs outages
+	}
+	var got bool
+	if err := conn.GetContext(ctx, &got, `SELECT pg_try_advisory_lock($1)`, leaderLockKey); err != nil || !got {
+		if err != nil {
+			log.Printf("[leader] failed to try the leader lock: %v", err)
+		}
+		conn.Close()
+		return nil
+	}
+	return conn
+}
+
+// hold runs lead while the connection holding the lock stays alive
+func (e *Elector) hold(ctx context.Context, conn *sqlx.Conn, lead func(ctx context.Context)) {
+	defer conn.Close()
+	log.Println("[leader] This instance is now the scheduler leader")
+	e.leading.Store(true)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(e.lease)
+	defer ticker.Stop()
+	for held := true; held; {
+		select {
+		case <-ticker.C:
+			renewCtx, renewCancel := context.WithTimeout(ctx, e.lease)
+			_, err := conn.ExecContext(renewCtx, `SELECT 1`)
+			renewCancel()
+			if err != nil && ctx.Err() == nil {
+				log.Printf("[leader] Lost scheduler leadership: %v", err)
+				held = false
+			}
+		case <-ctx.Done():
+			held = false
+		}
+	}
+
+	cancel()
+	<-done
+	e.leading.Store(false)
+	if ctx.Err() != nil {
+		// shutting down: hand over right away rather than when the session ends
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, leaderLockKey); err != nil {
+			log.Printf("[leader] failed to release the leader lock: %v", err)
+		}
+		return
+	}
+	// A failed renew doesn't mean the session is gone (a slow round trip
+	// times out too). Back in the pool a live session would keep the lock
+	// and shut every instance out of leading, so close the connection.
+	_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+}
@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// -----------------------------------------------------
+// LogRetention periodically trims refresh_logs, quality_results and
+// reconciliation_results, optionally rolling expired logs up into
+// refresh_log_rollups first
+// -----------------------------------------------------
+type LogRetention struct {
+	db            *sqlx.DB
+	retentionDays int
+	rollup        bool
+	interval      time.Duration
+}
+
+// -----------------------------------------------------
+// Constructor
+// -----------------------------------------------------
+func NewLogRetention(db *sqlx.DB, retentionDays int, rollup bool) *LogRetention {
+	return &LogRetention{
+		db:            db,
+		retentionDays: retentionDays,
+		rollup:        rollup,
+		interval:      time.Hour,
+	}
+}
+
+// -----------------------------------------------------
+// Start: runs cleanup once at boot, then every interval
+// -----------------------------------------------------
+func (lr *LogRetention) Start(ctx context.Context) {
+	if lr.retentionDays <= 0 {
+		log.Println("[retention] refresh log retention disabled")
+		return
+	}
+
+	log.Printf("[retention] Keeping refresh logs for %d days (rollup=%v)", lr.retentionDays, lr.rollup)
+
+	lr.runOnce()
+
+	ticker := time.NewTicker(lr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			lr.runOnce()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (lr *LogRetention) runOnce() {
+	deleted, err := lr.Cleanup(time.Now())
+	if err != nil {
+		log.Printf("[retention] cleanup failed: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("[retention] removed %d expired refresh logs", deleted)
+	}
+}
+
+// -----------------------------------------------------
+// Cleanup: deletes logs older than the retention window.
+// The cutoff is aligned to midnight so whole days get rolled up.
+// -----------------------------------------------------
+func (lr *LogRetention) Cleanup(now time.Time) (int64, error) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	cutoff := day.AddDate(0, 0, -lr.retentionDays)
+
+	tx, err := lr.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if lr.rollup {
+		dayExpr := "CAST(created_at AS DATE)"
+		if db.DialectOf(lr.db) == db.SQLite {
+			dayExpr = "date(created_at)"
+		}
+		_, err := tx.Exec(fmt.Sprintf(`
+			INSERT INTO refresh_log_rollups (day, table_name, runs, successes, failures, total_rows)
+			SELECT %[1]s,
+			       table_name,
+			       COUNT(*),
+			       SUM(CASE WHEN status IN ('OK', 'WARN') THEN 1 ELSE 0 END),
+			       SUM(CASE WHEN status = 'ERROR' THEN 1 ELSE 0 END),
+			       COALESCE(SUM(rows_inserted), 0)
+			FROM refresh_logs
+			WHERE created_at < $1
+			GROUP BY %[1]s, table_name
+			ON CONFLICT (day, table_name) DO UPDATE SET
+			    runs = refresh_log_rollups.runs + excluded.runs,
+			    successes = refresh_log_rollups.successes + excluded.successes,
+			    failures = refresh_log_rollups.failures + excluded.failures,
+			    total_rows = refresh_log_rollups.total_rows + excluded.total_rows
+		`, dayExpr), cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("rollup failed: %w", err)
+		}
+	}
+
+	res, err := tx.Exec(`DELETE FROM refresh_logs WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete failed: %w", err)
+	}
+	deleted, _ := res.RowsAffected()
+
+	// Quality check and reconciliation results follow the same retention window
+	if _, err := tx.Exec(`DELETE FROM quality_results WHERE checked_at < $1`, cutoff); err != nil {
+		return 0, fmt.Errorf("quality results delete failed: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM reconciliation_results WHERE checked_at < $1`, cutoff); err != nil {
+		return 0, fmt.Errorf("reconciliation results delete failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("tx commit failed: %w", err)
+	}
+	return deleted, nil
+}
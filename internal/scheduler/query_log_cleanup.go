@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/querylog"
+)
+
+// -----------------------------------------------------
+// QueryLogCleanup periodically deletes query audit log
+// entries older than the retention period
+// -----------------------------------------------------
+type QueryLogCleanup struct {
+	log       *querylog.Recorder
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewQueryLogCleanup(queryLog *querylog.Recorder, retention time.Duration) *QueryLogCleanup {
+	return &QueryLogCleanup{log: queryLog, retention: retention, interval: time.Hour}
+}
+
+// Start runs cleanup once at boot, then every interval
+func (qc *QueryLogCleanup) Start(ctx context.Context) {
+	if qc.retention <= 0 {
+		return // entries are kept forever
+	}
+
+	qc.runOnce()
+
+	ticker := time.NewTicker(qc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			qc.runOnce()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (qc *QueryLogCleanup) runOnce() {
+	n, err := qc.log.Cleanup(time.Now().UTC().Add(-qc.retention))
+	if err != nil {
+		log.Printf("[retention] query log cleanup failed: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("[retention] removed %d expired query log entries", n)
+	}
+}
@@ -0,0 +1,202 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of queued jobs
+const (
+	KindScheduled = "scheduled" // a refresh interval tick
+	KindManual    = "manual"    // POST /refresh/:table?queue=true
+	KindRetry     = "retry"     // POST /runs/:id/retry?queue=true
+)
+
+// maxAttempts bounds how often a job is claimed: one that was interrupted
+// this many times (e.g. it keeps crashing the server) is dropped
+const maxAttempts = 3
+
+// queuePollInterval is how often idle workers look for jobs enqueued by
+// other instances; jobs enqueued here wake them at once
+const queuePollInterval = time.Second
+
+// QueuedJob is a job_queue row
+type QueuedJob struct {
+	ID          int              `db:"id" json:"id"`
+	Table       string           `db:"table_name" json:"table"`
+	Kind        string           `db:"kind" json:"kind"`
+	Params      *json.RawMessage `db:"params" json:"sources,omitempty"`
+	RetryOf     *int             `db:"retry_of" json:"retry_of,omitempty"`
+	ScheduledAt time.Time        `db:"scheduled_at" json:"scheduled_at"`
+	LockedBy    *string          `db:"locked_by" json:"locked_by,omitempty"`
+	LockedAt    *time.Time       `db:"locked_at" json:"locked_at,omitempty"`
+	Attempts    int              `db:"attempts" json:"attempts"`
+	CreatedAt   time.Time        `db:"created_at" json:"created_at"`
+}
+
+// -----------------------------------------------------
+// Queue persists refresh jobs in job_queue so that ticks, queued manual
+// refreshes and queued retries survive restarts. Workers claim a job by
+// locking it; a finished job is deleted, its outcome being in refresh_logs.
+// -----------------------------------------------------
+type Queue struct {
+	db       *sqlx.DB
+	instance string // locked_by of the jobs claimed here
+	wake     chan struct{}
+}
+
+// NewQueue opens the queue stored in database
+func NewQueue(database *sqlx.DB) *Queue {
+	host, _ := os.Hostname()
+	return &Queue{
+		db:       database,
+		instance: fmt.Sprintf("%s:%d", host, os.Getpid()),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds a job for table: retries carry the sources to fetch and
+// the run they retry
+func (q *Queue) Enqueue(table, kind string, sources []etl.Source, retryOf int) (QueuedJob, error) {
+	var params, retry interface{}
+	if len(sources) > 0 {
+		raw, err := json.Marshal(sources)
+		if err != nil {
+			return QueuedJob{}, err
+		}
+		params = raw
+	}
+	if retryOf > 0 {
+		retry = retryOf
+	}
+	var job QueuedJob
+	err := q.db.Get(&job, `
+		INSERT INTO job_queue (table_name, kind, params, retry_of)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *`, table, kind, params, retry)
+	if err != nil {
+		return job, err
+	}
+	q.signal()
+	return job, nil
+}
+
+// enqueueTick adds a scheduled refresh of table unless one is already
+// waiting or running, so a slow table never piles up ticks
+func (q *Queue) enqueueTick(table string) (bool, error) {
+	res, err := q.db.Exec(`
+		INSERT INTO job_queue (table_name, kind)
+		SELECT $1, $2
+		WHERE NOT EXISTS (SELECT 1 FROM job_queue WHERE table_name = $3 AND kind = $4)`,
+		table, KindScheduled, table, KindScheduled)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		q.signal()
+	}
+	return n > 0, nil
+}
+
+// EnqueueFirst queues the first refresh of a time_series table as soon as
+// it has a source and an interval, rather than a full interval later. It
+// does nothing for tables that have run before, are paused by their
+// failure policy, or already have a scheduled refresh queued.
+func (q *Queue) EnqueueFirst(table string) (bool, error) {
+	res, err := q.db.Exec(`
+		INSERT INTO job_queue (table_name, kind)
+		SELECT table_name, $1 FROM table_metadata
+		WHERE table_name = $2
+		AND table_type = 'time_series'
+		AND refresh_interval IS NOT NULL
+		AND data_source_url IS NOT NULL
+		AND last_refresh_success IS NULL AND last_refresh_error IS NULL
+		AND refresh_paused_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM job_queue WHERE table_name = $3 AND kind = $4)`,
+		KindScheduled, table, table, KindScheduled)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		q.signal()
+	}
+	return n > 0, nil
+}
+
+// signal wakes an idle worker
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default: // already signalled
+	}
+}
+
+// List returns the queued and running jobs, next first
+func (q *Queue) List() ([]QueuedJob, error) {
+	jobs := []QueuedJob{}
+	err := q.db.Select(&jobs, `SELECT * FROM job_queue ORDER BY locked_by IS NULL, scheduled_at, id`)
+	return jobs, err
+}
+
+// Len counts the queued and running jobs
+func (q *Queue) Len() (int, error) {
+	var n int
+	err := q.db.Get(&n, `SELECT COUNT(*) FROM job_queue`)
+	return n, err
+}
+
+// claim locks the next due job for this instance; nil when none is due.
+// Postgres skips rows another transaction is claiming.
+func (q *Queue) claim() (*QueuedJob, error) {
+	skipLocked := ""
+	if db.DialectOf(q.db) == db.Postgres {
+		skipLocked = "FOR UPDATE SKIP LOCKED"
+	}
+	var jobs []QueuedJob
+	err := q.db.Select(&jobs, fmt.Sprintf(`
+		UPDATE job_queue SET locked_by = $1, locked_at = CURRENT_TIMESTAMP, attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM job_queue
+			WHERE locked_by IS NULL AND scheduled_at <= CURRENT_TIMESTAMP
+			ORDER BY scheduled_at, id
+			LIMIT 1 %s
+		)
+		RETURNING *`, skipLocked), q.instance)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// done removes a finished job
+func (q *Queue) done(id int) error {
+	_, err := q.db.Exec(`DELETE FROM job_queue WHERE id = $1`, id)
+	return err
+}
+
+// -----------------------------------------------------
+// reclaim: releases the jobs locked by workers that are gone, i.e. by an
+// earlier process or a former leader, so they run again. Jobs interrupted
+// maxAttempts times are deleted and returned instead.
+// -----------------------------------------------------
+func (q *Queue) reclaim() ([]QueuedJob, error) {
+	var dropped []QueuedJob
+	if err := q.db.Select(&dropped, `SELECT * FROM job_queue WHERE locked_by IS NOT NULL AND attempts >= $1`, maxAttempts); err != nil {
+		return nil, err
+	}
+	for _, job := range dropped {
+		if err := q.done(job.ID); err != nil {
+			return nil, err
+		}
+	}
+	_, err := q.db.Exec(`UPDATE job_queue SET locked_by = NULL, locked_at = NULL WHERE locked_by IS NOT NULL`)
+	return dropped, err
+}
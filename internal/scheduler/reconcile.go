@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/jmoiron/sqlx"
+)
+
+// -----------------------------------------------------
+// Reconciler periodically compares source record counts
+// with the rows loaded for every table that has a
+// reconcile_window, flagging discrepancies
+// -----------------------------------------------------
+type Reconciler struct {
+	db           *sqlx.DB
+	etl          *etl.ETLProcessor
+	events       *events.Broker
+	tolerancePct float64
+	interval     time.Duration
+}
+
+func NewReconciler(db *sqlx.DB, etlProc *etl.ETLProcessor, broker *events.Broker, interval time.Duration, tolerancePct float64) *Reconciler {
+	return &Reconciler{db: db, etl: etlProc, events: broker, tolerancePct: tolerancePct, interval: interval}
+}
+
+// Start reconciles every configured table each interval
+func (rc *Reconciler) Start(ctx context.Context) {
+	if rc.interval <= 0 {
+		log.Println("[reconcile] source reconciliation disabled")
+		return
+	}
+
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rc.runOnce()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (rc *Reconciler) runOnce() {
+	var tables []string
+	err := rc.db.Select(&tables, `SELECT table_name FROM table_metadata WHERE reconcile_window > 0 AND last_refresh_success IS NOT NULL ORDER BY table_name`)
+	if err != nil {
+		log.Printf("[reconcile] failed to list tables: %v", err)
+		return
+	}
+	for _, table := range tables {
+		if _, err := rc.Reconcile(table); err != nil {
+			log.Printf("[reconcile] %s: %v", table, err)
+		}
+	}
+}
+
+// Reconcile runs one reconciliation for table and publishes
+// reconcile.mismatch when the counts disagree
+func (rc *Reconciler) Reconcile(table string) (etl.Reconciliation, error) {
+	r, err := rc.etl.Reconcile(table, rc.tolerancePct)
+	if err != nil {
+		return r, err
+	}
+	switch r.Status {
+	case etl.ReconcileMismatch:
+		log.Printf("[reconcile] %s mismatch → %s", table, r.Message)
+		rc.events.Publish(events.Event{
+			Type:    events.ReconcileMismatch,
+			Table:   table,
+			Message: r.Message,
+			Data: map[string]interface{}{
+				"window_start": r.WindowStart,
+				"window_end":   r.WindowEnd,
+				"source_count": r.SourceCount,
+				"loaded_count": r.LoadedCount,
+			},
+		})
+	case etl.ReconcileError:
+		log.Printf("[reconcile] %s could not be reconciled: %s", table, r.Message)
+	}
+	return r, nil
+}
@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/replica"
+)
+
+// Delay before reconnecting to a remote event stream that dropped
+const watchRetryDelay = 10 * time.Second
+
+// -----------------------------------------------------
+// Replicator keeps replica tables in sync with their
+// source instance: one job per replica syncing every
+// sync_interval, plus a watcher on the remote's event
+// stream for live replicas
+// -----------------------------------------------------
+type Replicator struct {
+	syncer       *replica.Syncer
+	health       *db.Monitor
+	pollInterval time.Duration
+	jobs         map[string]*replicaJob
+	jobsLock     sync.Mutex
+}
+
+type replicaJob struct {
+	cancel  context.CancelFunc
+	replica replica.Replica // subscription settings the job was started with
+	trigger chan struct{}
+}
+
+func NewReplicator(syncer *replica.Syncer, health *db.Monitor, pollInterval time.Duration) *Replicator {
+	if pollInterval <= 0 {
+		pollInterval = 30 * time.Second
+	}
+	return &Replicator{syncer: syncer, health: health, pollInterval: pollInterval, jobs: map[string]*replicaJob{}}
+}
+
+// Start re-reads the subscriptions every poll interval, starting and
+// stopping jobs as replicas are added, changed or removed
+func (rp *Replicator) Start(ctx context.Context) {
+	rp.checkReplicas(ctx)
+
+	ticker := time.NewTicker(rp.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rp.checkReplicas(ctx)
+		case <-ctx.Done():
+			rp.jobsLock.Lock()
+			for table, job := range rp.jobs {
+				job.cancel()
+				delete(rp.jobs, table)
+			}
+			rp.jobsLock.Unlock()
+			return
+		}
+	}
+}
+
+// Trigger asks table's job to sync now; false when no job is running for it
+func (rp *Replicator) Trigger(table string) bool {
+	rp.jobsLock.Lock()
+	defer rp.jobsLock.Unlock()
+	job, ok := rp.jobs[table]
+	if !ok {
+		return false
+	}
+	select {
+	case job.trigger <- struct{}{}:
+	default: // a sync is already pending
+	}
+	return true
+}
+
+func (rp *Replicator) checkReplicas(ctx context.Context) {
+	if !rp.health.Healthy() {
+		return
+	}
+	replicas, err := rp.syncer.List()
+	if err != nil {
+		log.Printf("[replica] Error loading replicas: %v", err)
+		return
+	}
+
+	rp.jobsLock.Lock()
+	defer rp.jobsLock.Unlock()
+
+	current := map[string]bool{}
+	for _, r := range replicas {
+		current[r.Table] = true
+		job, running := rp.jobs[r.Table]
+		if running && sameSubscription(job.replica, r) {
+			continue
+		}
+		if running {
+			job.cancel()
+		}
+		rp.startJob(ctx, r)
+	}
+
+	for table, job := range rp.jobs {
+		if !current[table] {
+			log.Printf("[replica] %s unsubscribed: stopping sync", table)
+			job.cancel()
+			delete(rp.jobs, table)
+		}
+	}
+}
+
+// sameSubscription reports whether a running job still matches r
+func sameSubscription(a, b replica.Replica) bool {
+	keyA, keyB := "", ""
+	if a.APIKey != nil {
+		keyA = *a.APIKey
+	}
+	if b.APIKey != nil {
+		keyB = *b.APIKey
+	}
+	return a.ID == b.ID && a.SourceURL == b.SourceURL && a.SourceTable == b.SourceTable &&
+		a.SyncInterval == b.SyncInterval && a.Live == b.Live && keyA == keyB
+}
+
+// startJob syncs r right away, then every sync_interval and whenever the
+// watcher reports new rows on the source
+func (rp *Replicator) startJob(parentCtx context.Context, r replica.Replica) {
+	ctx, cancel := context.WithCancel(parentCtx)
+	job := &replicaJob{cancel: cancel, replica: r, trigger: make(chan struct{}, 1)}
+	rp.jobs[r.Table] = job
+	job.trigger <- struct{}{}
+
+	if r.Live {
+		go rp.watch(ctx, r, job.trigger)
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(r.SyncInterval) * time.Second)
+		defer ticker.Stop()
+
+		log.Printf("[replica] Started sync for %s from %s (every %d sec, live=%t)", r.Table, r.SourceURL, r.SyncInterval, r.Live)
+		for {
+			select {
+			case <-ticker.C:
+			case <-job.trigger:
+			case <-ctx.Done():
+				return
+			}
+			if !rp.health.Healthy() {
+				log.Printf("[replica] Skipping %s sync: database unavailable", r.Table)
+				continue
+			}
+			// reload for the current cursor
+			res, err := rp.syncer.SyncTable(r.Table)
+			switch {
+			case errors.Is(err, replica.ErrBusy), errors.Is(err, replica.ErrNotFound):
+			case err != nil:
+				log.Printf("[replica] %s sync failed: %v", r.Table, err)
+			default:
+				log.Printf("[replica] %s synced %d rows", r.Table, res.Rows)
+			}
+		}
+	}()
+}
+
+// watch follows the remote's event stream, reconnecting until ctx is done
+func (rp *Replicator) watch(ctx context.Context, r replica.Replica, trigger chan struct{}) {
+	for {
+		err := rp.syncer.Watch(ctx, r, func() {
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("[replica] %s event stream: %v", r.Table, err)
+		}
+		select {
+		case <-time.After(watchRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/etl"
+	"github.com/jmoiron/sqlx"
+)
+
+// -----------------------------------------------------
+// SoftDeletePurge periodically deletes the rows of soft
+// delete tables stamped longer ago than their grace period
+// -----------------------------------------------------
+type SoftDeletePurge struct {
+	db       *sqlx.DB
+	interval time.Duration
+}
+
+func NewSoftDeletePurge(db *sqlx.DB) *SoftDeletePurge {
+	return &SoftDeletePurge{db: db, interval: time.Hour}
+}
+
+// Start runs the purge once at boot, then every interval
+func (sp *SoftDeletePurge) Start(ctx context.Context) {
+	sp.runOnce()
+
+	ticker := time.NewTicker(sp.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sp.runOnce()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (sp *SoftDeletePurge) runOnce() {
+	var tables []struct {
+		Name  string `db:"table_name"`
+		Grace int    `db:"soft_delete_grace"`
+	}
+	err := sp.db.Select(&tables, `
+		SELECT table_name, soft_delete_grace FROM table_metadata
+		WHERE soft_delete AND soft_delete_grace IS NOT NULL
+	`)
+	if err != nil {
+		log.Printf("[retention] soft delete purge failed: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, t := range tables {
+		n, err := sp.Purge(t.Name, now.Add(-time.Duration(t.Grace)*time.Second))
+		if err != nil {
+			log.Printf("[retention] soft delete purge failed: table=%s err=%v", t.Name, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("[retention] purged %d soft-deleted rows from %s", n, t.Name)
+		}
+	}
+}
+
+// Purge deletes the rows of table soft-deleted before cutoff
+func (sp *SoftDeletePurge) Purge(table string, cutoff time.Time) (int64, error) {
+	name, err := db.ParseTableName(table)
+	if err != nil {
+		return 0, err
+	}
+	res, err := sp.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE "%s" < $1`, name.Quoted(), etl.DeletedAtColumn), cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,135 @@
+// Package share signs the tokens of shareable saved query links. A token
+// carries the query, its workspace and an expiry, signed with HMAC-SHA256,
+// so links need no storage: they stop working when they expire or when
+// the secret changes. Opens are rate limited per link on each instance.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalid is returned for tokens that are malformed or not signed with the secret
+	ErrInvalid = errors.New("invalid share token")
+	// ErrExpired is returned for tokens past their expiry
+	ErrExpired = errors.New("share link expired")
+	// ErrRateLimited is returned when a link was opened too often this minute
+	ErrRateLimited = errors.New("share link rate limit exceeded")
+)
+
+// rateWindow is the fixed window opens are counted in
+const rateWindow = time.Minute
+
+// Link is what a token grants: reading the results of one saved query
+type Link struct {
+	QueryID   int       `json:"q"`
+	Workspace string    `json:"w,omitempty"` // "" = default workspace
+	ExpiresAt time.Time `json:"e"`
+}
+
+// Signer issues and verifies tokens
+type Signer struct {
+	secret []byte
+	rate   int
+
+	mu      sync.Mutex
+	windows map[string]*window // by token signature
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// NewSigner signs with secret, or with a random key when it is empty, and
+// lets each link be opened ratePerMinute times a minute
+func NewSigner(secret string, ratePerMinute int) (*Signer, error) {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &Signer{secret: key, rate: ratePerMinute, windows: map[string]*window{}}, nil
+}
+
+// Sign returns the token for l
+func (s *Signer) Sign(l Link) (string, error) {
+	payload, err := json.Marshal(l)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.mac(payload)), nil
+}
+
+// Verify returns the link token grants if it is signed and unexpired
+func (s *Signer) Verify(token string) (Link, error) {
+	var l Link
+	enc := base64.RawURLEncoding
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return l, ErrInvalid
+	}
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil {
+		return l, ErrInvalid
+	}
+	sig, err := enc.DecodeString(sigPart)
+	if err != nil || !hmac.Equal(sig, s.mac(payload)) {
+		return l, ErrInvalid
+	}
+	if err := json.Unmarshal(payload, &l); err != nil {
+		return l, ErrInvalid
+	}
+	if time.Now().After(l.ExpiresAt) {
+		return l, fmt.Errorf("%w at %s", ErrExpired, l.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return l, nil
+}
+
+// Allow counts one open of token, returning ErrRateLimited and the wait
+// until the window resets once the link is over its rate
+func (s *Signer) Allow(token string) (time.Duration, error) {
+	_, key, _ := strings.Cut(token, ".")
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.windows[key]
+	if w == nil || now.Sub(w.start) >= rateWindow {
+		s.prune(now)
+		w = &window{start: now}
+		s.windows[key] = w
+	}
+	if w.count >= s.rate {
+		return w.start.Add(rateWindow).Sub(now), ErrRateLimited
+	}
+	w.count++
+	return 0, nil
+}
+
+// prune drops windows that have ended; call with mu held
+func (s *Signer) prune(now time.Time) {
+	for k, w := range s.windows {
+		if now.Sub(w.start) >= rateWindow {
+			delete(s.windows, k)
+		}
+	}
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write(payload)
+	return m.Sum(nil)
+}
@@ -0,0 +1,323 @@
+// Package sheets writes query results into Google Sheets through the Sheets
+// API v4, authenticated as a service account. The target spreadsheet must
+// be shared with the service account's client_email.
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEndpoint is the Sheets API
+const DefaultEndpoint = "https://sheets.googleapis.com"
+
+const scope = "https://www.googleapis.com/auth/spreadsheets"
+
+// Rows sent per values.update request
+const writeChunkRows = 10000
+
+var (
+	// ErrNotConfigured is returned when no service account is configured
+	ErrNotConfigured = errors.New("google sheets export is not configured (set sheets.credentials_file)")
+	// ErrInvalid wraps bad destinations and oversized results
+	ErrInvalid = errors.New("invalid sheets export")
+	// ErrRemote wraps failures reported by Google
+	ErrRemote = errors.New("google sheets request failed")
+)
+
+// ServiceAccount is the JSON key file of a Google service account
+type ServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// LoadServiceAccount reads and validates a service account key file
+func LoadServiceAccount(path string) (*ServiceAccount, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sa ServiceAccount
+	if err := json.Unmarshal(raw, &sa); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, fmt.Errorf("%s: not a service account key (client_email and private_key are required)", path)
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("%s: private_key is not PEM", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: private_key: %w", path, err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: private_key is not an RSA key", path)
+	}
+	sa.key = rsaKey
+	return &sa, nil
+}
+
+// Client writes to spreadsheets. A nil *Client reports ErrNotConfigured.
+type Client struct {
+	HTTP     *http.Client
+	Endpoint string
+	Account  *ServiceAccount
+	MaxRows  int // 0 = unlimited
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClient returns nil when account is nil
+func NewClient(account *ServiceAccount, httpClient *http.Client, endpoint string, maxRows int) *Client {
+	if account == nil {
+		return nil
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &Client{HTTP: httpClient, Endpoint: strings.TrimRight(endpoint, "/"), Account: account, MaxRows: maxRows}
+}
+
+// Result describes a finished write
+type Result struct {
+	SpreadsheetID string `json:"spreadsheet_id"`
+	Sheet         string `json:"sheet"`
+	Rows          int    `json:"rows"` // data rows, not counting the header
+	Columns       int    `json:"columns"`
+	SheetCreated  bool   `json:"sheet_created"`
+	URL           string `json:"url"`
+}
+
+// Write replaces the contents of sheet (a tab of the spreadsheet, created
+// if missing) with a header row and rows
+func (c *Client) Write(ctx context.Context, spreadsheetID, sheet string, header []string, rows [][]interface{}) (Result, error) {
+	if c == nil {
+		return Result{}, ErrNotConfigured
+	}
+	if spreadsheetID == "" || strings.ContainsAny(spreadsheetID, "/?#") {
+		return Result{}, fmt.Errorf("%w: spreadsheet_id must be the id from the sheet's URL", ErrInvalid)
+	}
+	if sheet == "" {
+		return Result{}, fmt.Errorf("%w: sheet name is required", ErrInvalid)
+	}
+	if c.MaxRows > 0 && len(rows) > c.MaxRows {
+		return Result{}, fmt.Errorf("%w: %d rows exceed the limit of %d (sheets.max_rows)", ErrInvalid, len(rows), c.MaxRows)
+	}
+
+	res := Result{
+		SpreadsheetID: spreadsheetID,
+		Sheet:         sheet,
+		Rows:          len(rows),
+		Columns:       len(header),
+		URL:           "https://docs.google.com/spreadsheets/d/" + spreadsheetID,
+	}
+	created, err := c.ensureSheet(ctx, spreadsheetID, sheet)
+	if err != nil {
+		return res, err
+	}
+	res.SheetCreated = created
+
+	// quoted so names with spaces or punctuation parse as one range
+	tab := "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+	base := c.Endpoint + "/v4/spreadsheets/" + url.PathEscape(spreadsheetID) + "/values/"
+	if err := c.call(ctx, http.MethodPost, base+url.PathEscape(tab)+":clear", struct{}{}, nil); err != nil {
+		return res, err
+	}
+
+	headerRow := make([]interface{}, len(header))
+	for i, h := range header {
+		headerRow[i] = h
+	}
+	values := append([][]interface{}{headerRow}, rows...)
+	for start := 0; start < len(values); start += writeChunkRows {
+		end := min(start+writeChunkRows, len(values))
+		rng := fmt.Sprintf("%s!A%d", tab, start+1)
+		body := map[string]interface{}{"range": rng, "majorDimension": "ROWS", "values": values[start:end]}
+		if err := c.call(ctx, http.MethodPut, base+url.PathEscape(rng)+"?valueInputOption=RAW", body, nil); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// ensureSheet adds the tab when the spreadsheet does not have it
+func (c *Client) ensureSheet(ctx context.Context, spreadsheetID, sheet string) (bool, error) {
+	var meta struct {
+		Sheets []struct {
+			Properties struct {
+				Title string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	base := c.Endpoint + "/v4/spreadsheets/" + url.PathEscape(spreadsheetID)
+	if err := c.call(ctx, http.MethodGet, base+"?fields=sheets.properties.title", nil, &meta); err != nil {
+		return false, err
+	}
+	for _, s := range meta.Sheets {
+		if s.Properties.Title == sheet {
+			return false, nil
+		}
+	}
+	add := map[string]interface{}{"requests": []interface{}{
+		map[string]interface{}{"addSheet": map[string]interface{}{"properties": map[string]string{"title": sheet}}},
+	}}
+	return true, c.call(ctx, http.MethodPost, base+":batchUpdate", add, nil)
+}
+
+// call sends an authenticated JSON request, decoding the response into out
+func (c *Client) call(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRemote, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%w: %s", ErrRemote, googleError(resp))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// googleError extracts the message from a Google API error response
+func googleError(resp *http.Response) string {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Description string `json:"error_description"` // OAuth token endpoint
+	}
+	if json.Unmarshal(raw, &e) == nil {
+		if e.Error.Message != "" {
+			return fmt.Sprintf("%s: %s", resp.Status, e.Error.Message)
+		}
+		if e.Description != "" {
+			return fmt.Sprintf("%s: %s", resp.Status, e.Description)
+		}
+	}
+	return resp.Status
+}
+
+// accessToken returns a cached OAuth token, exchanging a freshly signed
+// JWT assertion for a new one shortly before it expires
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	assertion, err := c.Account.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: token: %v", ErrRemote, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%w: token: %s", ErrRemote, googleError(resp))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("%w: token: malformed response", ErrRemote)
+	}
+	c.token = tok.AccessToken
+	c.expires = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// assertion signs the RS256 JWT that the token endpoint exchanges for an
+// access token
+func (sa *ServiceAccount) assertion(now time.Time) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if sa.PrivateKeyID != "" {
+		header["kid"] = sa.PrivateKeyID
+	}
+	claims := map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": scope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	enc := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signing := enc(header) + "." + enc(claims)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(nil, sa.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
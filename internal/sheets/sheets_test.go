@@ -0,0 +1,211 @@
+package sheets
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAccount writes a service account key file for a fresh RSA key and
+// loads it back
+func testAccount(t *testing.T, tokenURI string) (*ServiceAccount, *rsa.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "export@project.iam.gserviceaccount.com",
+		"private_key_id": "kid-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURI,
+	})
+	path := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := LoadServiceAccount(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sa, &key.PublicKey
+}
+
+// verifyJWT checks an RS256 JWT per RFC 7515/7518 and returns its header
+// and claims
+func verifyJWT(t *testing.T, jwt string, pub *rsa.PublicKey) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("jwt has %d parts", len(parts))
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	var header, claims map[string]interface{}
+	for i, dst := range []*map[string]interface{}{&header, &claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("segment %d: %v", i, err)
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			t.Fatalf("segment %d: %v", i, err)
+		}
+	}
+	return header, claims
+}
+
+func TestAssertion(t *testing.T) {
+	sa, pub := testAccount(t, "https://oauth2.example.test/token")
+	now := time.Unix(1700000000, 0)
+	jwt, err := sa.assertion(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, claims := verifyJWT(t, jwt, pub)
+	if header["alg"] != "RS256" || header["typ"] != "JWT" || header["kid"] != "kid-1" {
+		t.Errorf("header %v", header)
+	}
+	want := map[string]interface{}{
+		"iss":   "export@project.iam.gserviceaccount.com",
+		"scope": scope,
+		"aud":   "https://oauth2.example.test/token",
+		"iat":   float64(1700000000),
+		"exp":   float64(1700003600),
+	}
+	if len(claims) != len(want) {
+		t.Errorf("claims %v, want %v", claims, want)
+	}
+	for k, v := range want {
+		if claims[k] != v {
+			t.Errorf("claim %s = %v, want %v", k, claims[k], v)
+		}
+	}
+}
+
+func TestLoadServiceAccountRejects(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"missing-key": `{"client_email":"a@b"}`,
+		"not-pem":     `{"client_email":"a@b","private_key":"nope"}`,
+		"not-json":    `{`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadServiceAccount(path); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+		pub   *rsa.PublicKey
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+				http.Error(w, `{"error_description":"bad grant"}`, http.StatusBadRequest)
+				return
+			}
+			verifyJWT(t, r.PostForm.Get("assertion"), pub)
+			calls = append(calls, "token")
+			io.WriteString(w, `{"access_token":"tok","expires_in":3600}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, `{"error":{"message":"unauthenticated"}}`, http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, r.Method+" "+r.URL.EscapedPath()+"?"+r.URL.RawQuery+" "+string(body))
+		if r.Method == http.MethodGet {
+			io.WriteString(w, `{"sheets":[{"properties":{"title":"Sheet1"}}]}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	var sa *ServiceAccount
+	sa, pub = testAccount(t, srv.URL+"/token")
+	c := NewClient(sa, srv.Client(), srv.URL, 0)
+	res, err := c.Write(context.Background(), "sid", "Q1 data", []string{"id", "name"},
+		[][]interface{}{{1, "a"}, {2, nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.SheetCreated || res.Rows != 2 || res.Columns != 2 {
+		t.Errorf("result %+v", res)
+	}
+
+	tab := url.PathEscape("'Q1 data'")
+	want := []string{
+		"token",
+		"GET /v4/spreadsheets/sid?fields=sheets.properties.title ",
+		`POST /v4/spreadsheets/sid:batchUpdate? {"requests":[{"addSheet":{"properties":{"title":"Q1 data"}}}]}`,
+		"POST /v4/spreadsheets/sid/values/" + tab + ":clear? {}",
+		"PUT /v4/spreadsheets/sid/values/" + url.PathEscape("'Q1 data'!A1") + `?valueInputOption=RAW {"majorDimension":"ROWS","range":"'Q1 data'!A1","values":[["id","name"],[1,"a"],[2,null]]}`,
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the token is cached for the next write
+	calls = nil
+	if _, err := c.Write(context.Background(), "sid", "Sheet1", []string{"id"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) == 0 || calls[0] == "token" {
+		t.Errorf("token fetched again: %v", calls)
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	var nilClient *Client
+	if _, err := nilClient.Write(context.Background(), "sid", "s", nil, nil); err != ErrNotConfigured {
+		t.Errorf("nil client: %v", err)
+	}
+	c := &Client{Account: &ServiceAccount{}, MaxRows: 1}
+	for _, tc := range []struct{ id, sheet string }{{"", "s"}, {"a/b", "s"}, {"sid", ""}} {
+		if _, err := c.Write(context.Background(), tc.id, tc.sheet, nil, nil); err == nil {
+			t.Errorf("Write(%q, %q) accepted", tc.id, tc.sheet)
+		}
+	}
+	if _, err := c.Write(context.Background(), "sid", "s", nil, make([][]interface{}, 2)); err == nil {
+		t.Error("rows over max_rows accepted")
+	}
+}
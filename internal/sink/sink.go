@@ -0,0 +1,390 @@
+// Package sink exports tables to object storage after each refresh. A sink
+// names a destination (s3://, gs:// or file://), a file format and a cursor
+// column; every run writes the rows past the cursor as one new object and
+// advances the cursor, so each row is exported once.
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/alkha0306/godataflow/internal/events"
+	"github.com/alkha0306/godataflow/internal/export"
+	"github.com/jmoiron/sqlx"
+)
+
+// Sink is an export destination for a table (a table_sinks row)
+type Sink struct {
+	ID           int        `db:"id" json:"id"`
+	Table        string     `db:"table_name" json:"table"`
+	URL          string     `db:"url" json:"url"`
+	Format       string     `db:"format" json:"format"`
+	CursorColumn string     `db:"cursor_column" json:"cursor_column"`
+	CursorValue  *string    `db:"cursor_value" json:"cursor_value"`
+	Enabled      bool       `db:"enabled" json:"enabled"`
+	LastExportAt *time.Time `db:"last_export_at" json:"last_export_at"`
+	LastObject   *string    `db:"last_object" json:"last_object"`
+	LastError    *string    `db:"last_error" json:"last_error"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Result is the outcome of one sink run
+type Result struct {
+	SinkID  int    `json:"sink_id"`
+	Table   string `json:"table"`
+	Rows    int64  `json:"rows"`
+	Object  string `json:"object,omitempty"`  // empty when there was nothing new
+	Skipped bool   `json:"skipped,omitempty"` // another run of the sink was in progress
+	Error   string `json:"error,omitempty"`
+}
+
+var (
+	// ErrNotFound is returned for an unknown sink or table
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid wraps every problem with a sink definition
+	ErrInvalid = errors.New("invalid sink")
+)
+
+// Config holds the object storage credentials and upload limits
+type Config struct {
+	Client  *http.Client
+	S3      Credentials
+	GCS     Credentials
+	Timeout time.Duration // per upload; 0 = no limit
+}
+
+// Exporter manages table sinks and runs them
+type Exporter struct {
+	DB     *sqlx.DB
+	Events *events.Broker
+	cfg    Config
+
+	mu      sync.Mutex
+	running map[int]bool
+}
+
+func NewExporter(db *sqlx.DB, broker *events.Broker, cfg Config) *Exporter {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.GCS.Endpoint == "" {
+		cfg.GCS.Endpoint = DefaultGCSEndpoint
+	}
+	if cfg.GCS.Region == "" {
+		cfg.GCS.Region = "auto"
+	}
+	return &Exporter{DB: db, Events: broker, cfg: cfg, running: map[int]bool{}}
+}
+
+// List returns table's sinks, oldest first
+func (e *Exporter) List(table string) ([]Sink, error) {
+	sinks := []Sink{}
+	err := e.DB.Select(&sinks, `SELECT * FROM table_sinks WHERE table_name = $1 ORDER BY id`, table)
+	return sinks, err
+}
+
+// Get returns one of table's sinks
+func (e *Exporter) Get(table string, id int) (Sink, error) {
+	var s Sink
+	err := e.DB.Get(&s, `SELECT * FROM table_sinks WHERE id = $1 AND table_name = $2`, id, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, fmt.Errorf("sink %d: %w", id, ErrNotFound)
+	}
+	return s, err
+}
+
+// Create validates and stores a new sink for table. Format defaults to
+// csv and the cursor column to _ingested_at on provenance tables.
+func (e *Exporter) Create(table string, s Sink) (Sink, error) {
+	var registered int
+	if err := e.DB.Get(&registered, `SELECT COUNT(*) FROM table_metadata WHERE table_name = $1`, table); err != nil {
+		return s, err
+	}
+	if registered == 0 {
+		return s, fmt.Errorf("table %s: %w", table, ErrNotFound)
+	}
+
+	loc, err := ParseLocation(s.URL)
+	if err != nil {
+		return s, fmt.Errorf("%w: url: %v", ErrInvalid, err)
+	}
+	if _, err := e.store(loc); err != nil {
+		return s, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if s.Format == "" {
+		s.Format = export.CSV
+	}
+	if !export.Supported(s.Format) {
+		return s, fmt.Errorf("%w: format must be one of %s", ErrInvalid, strings.Join(export.Formats, ", "))
+	}
+
+	cols, err := db.TableColumns(e.DB, table)
+	if err != nil {
+		return s, err
+	}
+	if s.CursorColumn == "" && db.HasProvenance(cols) {
+		s.CursorColumn = db.IngestedAtColumn
+	}
+	if _, ok := columnType(cols, s.CursorColumn); !ok {
+		return s, fmt.Errorf("%w: cursor_column must name one of the table's columns", ErrInvalid)
+	}
+
+	var id int
+	err = e.DB.Get(&id, `
+		INSERT INTO table_sinks (table_name, url, format, cursor_column, enabled)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, table, s.URL, s.Format, s.CursorColumn, s.Enabled)
+	if err != nil {
+		return s, err
+	}
+	return e.Get(table, id)
+}
+
+// Delete removes one of table's sinks; exported objects are kept
+func (e *Exporter) Delete(table string, id int) error {
+	res, err := e.DB.Exec(`DELETE FROM table_sinks WHERE id = $1 AND table_name = $2`, id, table)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("sink %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// AfterRefresh runs table's enabled sinks in turn. Failures are recorded
+// on the sink and published; they never fail the refresh.
+func (e *Exporter) AfterRefresh(table string) []Result {
+	if e == nil {
+		return nil
+	}
+	var sinks []Sink
+	if err := e.DB.Select(&sinks, `SELECT * FROM table_sinks WHERE table_name = $1 AND enabled = TRUE ORDER BY id`, table); err != nil {
+		log.Printf("[sink] can't load sinks for %s: %v", table, err)
+		return nil
+	}
+	results := make([]Result, 0, len(sinks))
+	for _, s := range sinks {
+		results = append(results, e.Run(s))
+	}
+	return results
+}
+
+// Run exports the rows of s's table past its cursor. Runs of the same sink
+// never overlap: a second caller gets a skipped result.
+func (e *Exporter) Run(s Sink) Result {
+	res := Result{SinkID: s.ID, Table: s.Table}
+
+	e.mu.Lock()
+	if e.running[s.ID] {
+		e.mu.Unlock()
+		res.Skipped = true
+		return res
+	}
+	e.running[s.ID] = true
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.running, s.ID)
+		e.mu.Unlock()
+	}()
+
+	object, cursor, err := e.export(s, &res.Rows)
+	now := time.Now().UTC()
+	if err != nil {
+		res.Error = err.Error()
+		log.Printf("[sink] %s sink %d failed: %v", s.Table, s.ID, err)
+		e.DB.Exec(`UPDATE table_sinks SET last_error = $1 WHERE id = $2`, res.Error, s.ID)
+		e.Events.Publish(events.Event{Type: events.SinkFailed, Table: s.Table, Message: res.Error,
+			Data: map[string]interface{}{"sink_id": s.ID, "url": s.URL}})
+		return res
+	}
+	if object == "" {
+		return res
+	}
+
+	res.Object = object
+	if _, err := e.DB.Exec(`
+		UPDATE table_sinks SET cursor_value = $1, last_export_at = $2, last_object = $3, last_error = NULL
+		WHERE id = $4`, cursor, now, object, s.ID); err != nil {
+		// the object is written; the next run exports its rows again
+		log.Printf("[sink] %s sink %d: can't advance cursor: %v", s.Table, s.ID, err)
+	}
+	e.Events.Publish(events.Event{Type: events.SinkExported, Table: s.Table,
+		Message: fmt.Sprintf("exported %d rows to %s", res.Rows, object),
+		Data:    map[string]interface{}{"sink_id": s.ID, "rows": res.Rows, "object": object}})
+	log.Printf("[sink] %s sink %d → %s (%d rows)", s.Table, s.ID, object, res.Rows)
+	return res
+}
+
+// export spools the new rows to a temporary file and uploads it. It
+// returns the object's URL and the new cursor, or an empty object when
+// there was nothing to export.
+func (e *Exporter) export(s Sink, rows *int64) (string, string, error) {
+	loc, err := ParseLocation(s.URL)
+	if err != nil {
+		return "", "", err
+	}
+	store, err := e.store(loc)
+	if err != nil {
+		return "", "", err
+	}
+	t, err := db.ParseTableName(s.Table)
+	if err != nil {
+		return "", "", err
+	}
+	cols, err := db.TableColumns(e.DB, s.Table)
+	if err != nil {
+		return "", "", err
+	}
+	cursorType, ok := columnType(cols, s.CursorColumn)
+	if !ok {
+		return "", "", fmt.Errorf("cursor column %q no longer exists", s.CursorColumn)
+	}
+
+	// rows without a cursor value can never be placed after it, so they are skipped
+	query := fmt.Sprintf(`SELECT * FROM %s WHERE "%s" IS NOT NULL`, t.Quoted(), s.CursorColumn)
+	var args []interface{}
+	if s.CursorValue != nil {
+		query += fmt.Sprintf(` AND "%s" > $1`, s.CursorColumn)
+		args = append(args, cursorArg(*s.CursorValue, cursorType))
+	}
+	query += fmt.Sprintf(` ORDER BY "%s"`, s.CursorColumn)
+
+	f, err := os.CreateTemp("", "godataflow-sink-*."+s.Format)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	cursor, err := spool(e.DB, query, args, f, s.Format, cols, s.CursorColumn, rows)
+	if err != nil || *rows == 0 {
+		return "", "", err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+
+	ctx := context.Background()
+	if e.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.cfg.Timeout)
+		defer cancel()
+	}
+	key := loc.ObjectKey(s.Table, s.Format, time.Now())
+	if err := store.Put(ctx, key, f, size, export.ContentType(s.Format)); err != nil {
+		return "", "", err
+	}
+	return loc.URL(key), cursor, nil
+}
+
+// spool writes the rows of query to f and returns the last cursor value.
+// The rows are fully read before returning: SQLite has a single connection.
+func spool(database *sqlx.DB, query string, args []interface{}, f *os.File, format string, cols []db.Column, cursorColumn string, n *int64) (string, error) {
+	rows, err := database.Queryx(query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	w, err := export.NewWriter(format, f, cols)
+	if err != nil {
+		return "", err
+	}
+	var cursor string
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return "", err
+		}
+		cursor = cursorText(row[cursorColumn])
+		if err := w.Write(row); err != nil {
+			return "", err
+		}
+		*n++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return cursor, w.Close()
+}
+
+// store returns the Store for loc, checking its credentials are configured
+func (e *Exporter) store(loc Location) (Store, error) {
+	switch loc.Scheme {
+	case SchemeS3:
+		if !e.cfg.S3.configured() || e.cfg.S3.Region == "" {
+			return nil, errors.New("s3 sinks need sinks.s3_region and S3 access keys configured")
+		}
+		return s3Store{client: e.cfg.Client, bucket: loc.Bucket, creds: e.cfg.S3}, nil
+	case SchemeGCS:
+		if !e.cfg.GCS.configured() {
+			return nil, errors.New("gs sinks need GCS HMAC keys configured")
+		}
+		return s3Store{client: e.cfg.Client, bucket: loc.Bucket, creds: e.cfg.GCS}, nil
+	}
+	return fileStore{dir: loc.Prefix}, nil
+}
+
+// cursorText renders a scanned cursor value for cursor_value
+func cursorText(v interface{}) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(t)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// cursorArg turns a stored cursor back into a value comparable with a
+// column of type typ; anything unrecognized compares as text
+func cursorArg(v, typ string) interface{} {
+	typ = strings.ToLower(typ)
+	switch {
+	case strings.Contains(typ, "timestamp") || strings.Contains(typ, "datetime") || typ == "date":
+		if ts, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return ts.UTC()
+		}
+	case strings.Contains(typ, "int"):
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	case strings.Contains(typ, "numeric") || strings.Contains(typ, "real") ||
+		strings.Contains(typ, "double") || strings.Contains(typ, "float"):
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+func columnType(cols []db.Column, name string) (string, bool) {
+	for _, c := range cols {
+		if c.ColumnName == name {
+			return c.DataType, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,271 @@
+package sink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sink URL schemes
+const (
+	SchemeS3   = "s3"
+	SchemeGCS  = "gs"
+	SchemeFile = "file"
+)
+
+// DefaultGCSEndpoint is the Cloud Storage XML API, which accepts S3-style
+// requests signed with HMAC keys
+const DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+// Store writes finished export files
+type Store interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+}
+
+// Credentials authenticate S3-compatible uploads. Endpoint is empty for
+// AWS itself (virtual-hosted bucket URLs); any other endpoint, such as
+// MinIO or the GCS XML API, is addressed path-style.
+type Credentials struct {
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func (c Credentials) configured() bool {
+	return c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+// Location is a parsed sink URL: the store it names and the key prefix
+// objects are written under
+type Location struct {
+	Scheme string
+	Bucket string // s3 and gs only
+	Prefix string // directory for file://
+}
+
+// ParseLocation validates a sink URL
+func ParseLocation(raw string) (Location, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Location{}, err
+	}
+	switch u.Scheme {
+	case SchemeS3, SchemeGCS:
+		if u.Host == "" {
+			return Location{}, fmt.Errorf("%s:// URLs need a bucket, e.g. %s://bucket/prefix", u.Scheme, u.Scheme)
+		}
+		return Location{Scheme: u.Scheme, Bucket: u.Host, Prefix: strings.Trim(u.Path, "/")}, nil
+	case SchemeFile:
+		if u.Host != "" || !filepath.IsAbs(u.Path) {
+			return Location{}, errors.New("file:// URLs need an absolute path, e.g. file:///var/exports")
+		}
+		return Location{Scheme: u.Scheme, Prefix: filepath.Clean(u.Path)}, nil
+	}
+	return Location{}, fmt.Errorf("unsupported scheme %q (want s3, gs or file)", u.Scheme)
+}
+
+// ObjectKey is where a table's export taken at t is written
+func (l Location) ObjectKey(table, ext string, t time.Time) string {
+	name := table + "/" + t.UTC().Format("20060102T150405.000000000Z") + "." + ext
+	if l.Scheme == SchemeFile || l.Prefix == "" {
+		return name
+	}
+	return l.Prefix + "/" + name
+}
+
+// URL renders key as a URL in the same store, for last_object
+func (l Location) URL(key string) string {
+	if l.Scheme == SchemeFile {
+		return "file://" + filepath.Join(l.Prefix, filepath.FromSlash(key))
+	}
+	return l.Scheme + "://" + l.Bucket + "/" + key
+}
+
+// -----------------------------------------------------
+// Local directory store (file://)
+// -----------------------------------------------------
+type fileStore struct {
+	dir string
+}
+
+// Put writes to a temporary name and renames, so readers never see a partial file
+func (s fileStore) Put(_ context.Context, key string, body io.ReadSeeker, _ int64, _ string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// -----------------------------------------------------
+// S3-compatible object store (s3://, gs://), signed with AWS SigV4
+// -----------------------------------------------------
+type s3Store struct {
+	client *http.Client
+	bucket string
+	creds  Credentials
+}
+
+func (s s3Store) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	payloadHash := hex.EncodeToString(h.Sum(nil))
+
+	target, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	// send the path exactly as it is signed
+	target.RawPath = uriEncode(target.Path, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("upload to %s returned %s: %s", target.Host, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// objectURL addresses key virtual-hosted on AWS and path-style elsewhere
+func (s s3Store) objectURL(key string) (*url.URL, error) {
+	if s.creds.Endpoint == "" {
+		return &url.URL{
+			Scheme: "https",
+			Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", s.bucket, s.creds.Region),
+			Path:   "/" + key,
+		}, nil
+	}
+	u, err := url.Parse(strings.TrimRight(s.creds.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.Path += "/" + s.bucket + "/" + key
+	return u, nil
+}
+
+// sign adds the SigV4 headers for a single-chunk request
+func (s s3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if s.creds.SessionToken != "" {
+		headers["x-amz-security-token"] = s.creds.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+		if name != "host" {
+			req.Header.Set(name, headers[name])
+		}
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.creds.Region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.creds.SecretAccessKey), day)
+	key = hmacSHA256(key, s.creds.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// canonicalQuery sorts and encodes query parameters as SigV4 expects;
+// valueless parameters such as ?lifecycle sign as "lifecycle="
+func canonicalQuery(q url.Values) string {
+	pairs := make([]string, 0, len(q))
+	for name, values := range q {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(name, false)+"="+uriEncode(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes s the way SigV4 expects: everything but
+// unreserved characters, and slashes too unless keepSlash
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
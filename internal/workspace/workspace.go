@@ -0,0 +1,419 @@
+// Package workspace lets one deployment serve several teams. A workspace
+// owns a Postgres schema (ws_<name>) holding its tables, a NOLOGIN role
+// that SQL written by its members runs as, and API keys that act only
+// within it. Requests without a workspace key use the default workspace:
+// every schema, as before workspaces existed.
+package workspace
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alkha0306/godataflow/internal/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// SchemaPrefix is prepended to a workspace's name to form its schema
+const SchemaPrefix = "ws_"
+
+// KeyPrefix starts every workspace API key, so the auth middleware only
+// looks up keys that can be workspace keys
+const KeyPrefix = "gdfws_"
+
+// Key scopes narrow what a workspace key may do
+const (
+	ScopeFull   = "full"   // everything workspace keys may do, including managing keys
+	ScopeIngest = "ingest" // write rows into the workspace's tables
+	ScopeQuery  = "query"  // read tables and run saved queries
+)
+
+// lastUsedPrecision is how stale a key's last_used_at may get before a
+// request updates it, so busy keys don't write on every request
+const lastUsedPrecision = time.Minute
+
+var nameRE = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+var (
+	// ErrInvalid wraps bad workspace names and table references
+	ErrInvalid = errors.New("invalid workspace request")
+	// ErrNotFound is returned for unknown workspaces, keys and tables
+	ErrNotFound = errors.New("workspace not found")
+	// ErrExists is returned when creating a workspace that already exists
+	ErrExists = errors.New("workspace already exists")
+	// ErrNotEmpty is returned when deleting a workspace that still has tables
+	ErrNotEmpty = errors.New("workspace still has tables")
+	// ErrForeign is returned when a workspace request names a table in another schema
+	ErrForeign = errors.New("table belongs to another workspace")
+	// ErrExpired is returned when authenticating with a key past its expiry
+	ErrExpired = errors.New("API key expired")
+	// ErrUnsupported is returned on SQLite, which has no schemas or roles
+	ErrUnsupported = errors.New("workspaces need Postgres")
+)
+
+// Workspace is one tenant. A nil *Workspace is the default workspace.
+type Workspace struct {
+	ID        int       `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Schema    string    `db:"schema_name" json:"schema"`
+	Role      string    `db:"role_name" json:"-"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Key is an issued API key; the key itself is only returned when issued
+type Key struct {
+	ID         int        `db:"id" json:"id"`
+	Prefix     string     `db:"key_prefix" json:"prefix"`
+	Label      string     `db:"label" json:"label,omitempty"`
+	Scope      string     `db:"scope" json:"scope"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
+
+// KeyOptions describe a key to issue
+type KeyOptions struct {
+	Label     string     `json:"label"`      // tells keys apart, e.g. the producer using it
+	Scope     string     `json:"scope"`      // full (default), ingest or query
+	ExpiresAt *time.Time `json:"expires_at"` // nil = never
+}
+
+// check validates o and fills in the default scope
+func (o *KeyOptions) check() error {
+	switch o.Scope {
+	case "":
+		o.Scope = ScopeFull
+	case ScopeFull, ScopeIngest, ScopeQuery:
+	default:
+		return fmt.Errorf("%w: scope must be full, ingest or query, got %q", ErrInvalid, o.Scope)
+	}
+	if o.ExpiresAt != nil && !o.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at is in the past", ErrInvalid)
+	}
+	if len(o.Label) > 100 {
+		return fmt.Errorf("%w: label is longer than 100 characters", ErrInvalid)
+	}
+	return nil
+}
+
+// Qualify resolves a table reference made within the workspace: bare
+// names land in its schema, and other schemas are refused. The default
+// workspace returns table unchanged.
+func (w *Workspace) Qualify(table string) (string, error) {
+	if w == nil {
+		return table, nil
+	}
+	t, err := db.ParseTableName(table)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if t.Schema == "" {
+		t.Schema = w.Schema
+	}
+	if t.Schema != w.Schema {
+		return "", fmt.Errorf("%w: %s", ErrForeign, table)
+	}
+	return t.String(), nil
+}
+
+// Owns reports whether a registered table name is in the workspace; the
+// default workspace owns everything
+func (w *Workspace) Owns(table string) bool {
+	return w == nil || strings.HasPrefix(table, w.Schema+".")
+}
+
+// Rows are the results of Query; Close also ends its transaction
+type Rows struct {
+	*sqlx.Rows
+	tx *sqlx.Tx
+}
+
+// Close closes the rows and rolls back the read-only transaction
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if r.tx != nil {
+		r.tx.Rollback()
+	}
+	return err
+}
+
+// Query runs SQL written by a workspace member (filters, saved queries)
+// in a read-only transaction as the workspace's role, with its schema
+// first on the search path, so it can only read the workspace's own
+// tables. The default workspace keeps its role and search path but is
+// read-only all the same.
+func (w *Workspace) Query(ctx context.Context, conn *sqlx.DB, query string, args ...interface{}) (*Rows, error) {
+	tx, err := conn.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if w != nil {
+		for _, stmt := range []string{
+			fmt.Sprintf(`SET LOCAL ROLE "%s"`, w.Role),
+			fmt.Sprintf(`SET LOCAL search_path TO "%s"`, w.Schema),
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+	}
+	// a prepared statement holds exactly one command, so the query cannot
+	// RESET ROLE and carry on in a second one
+	stmt, err := tx.PreparexContext(ctx, query)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	rows, err := stmt.QueryxContext(ctx, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &Rows{Rows: rows, tx: tx}, nil
+}
+
+// Registry creates workspaces and resolves their API keys
+type Registry struct {
+	DB *sqlx.DB
+}
+
+func NewRegistry(database *sqlx.DB) *Registry {
+	return &Registry{DB: database}
+}
+
+// List returns every workspace ordered by name
+func (r *Registry) List() ([]Workspace, error) {
+	list := []Workspace{}
+	err := r.DB.Select(&list, `SELECT id, name, schema_name, role_name, created_at FROM workspaces ORDER BY name`)
+	return list, err
+}
+
+// Get returns the named workspace
+func (r *Registry) Get(name string) (*Workspace, error) {
+	var w Workspace
+	err := r.DB.Get(&w, `SELECT id, name, schema_name, role_name, created_at FROM workspaces WHERE name = $1`, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Create sets up a workspace's schema and role and issues its first API
+// key. The database user needs CREATEROLE.
+func (r *Registry) Create(name string) (*Workspace, string, error) {
+	if !nameRE.MatchString(name) {
+		return nil, "", fmt.Errorf("%w: name must be 1-32 lowercase letters, digits or underscores, starting with a letter", ErrInvalid)
+	}
+	if db.DialectOf(r.DB) != db.Postgres {
+		return nil, "", ErrUnsupported
+	}
+	if _, err := r.Get(name); err == nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrExists, name)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, "", err
+	}
+
+	// roles are shared by every database of the cluster; the suffix keeps
+	// two deployments' workspaces of the same name apart
+	var database string
+	if err := r.DB.Get(&database, `SELECT current_database()`); err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256([]byte(database))
+	w := &Workspace{Name: name, Schema: SchemaPrefix + name}
+	w.Role = w.Schema + "_" + hex.EncodeToString(sum[:4])
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		fmt.Sprintf(`CREATE SCHEMA "%s"`, w.Schema),
+		fmt.Sprintf(`CREATE ROLE "%s" NOLOGIN`, w.Role),
+		// membership lets the server SET ROLE to it
+		fmt.Sprintf(`GRANT "%s" TO CURRENT_USER`, w.Role),
+		fmt.Sprintf(`GRANT USAGE ON SCHEMA "%s" TO "%s"`, w.Schema, w.Role),
+		// tables the server creates in the schema later are readable by the role
+		fmt.Sprintf(`ALTER DEFAULT PRIVILEGES IN SCHEMA "%s" GRANT SELECT ON TABLES TO "%s"`, w.Schema, w.Role),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return nil, "", fmt.Errorf("create workspace %s: %w", name, err)
+		}
+	}
+	err = tx.QueryRowx(`INSERT INTO workspaces (name, schema_name, role_name) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		w.Name, w.Schema, w.Role).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	key, _, err := issueKey(tx, w.ID, KeyOptions{Scope: ScopeFull})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+	return w, key, nil
+}
+
+// Delete drops an empty workspace with its schema, role, keys and saved
+// queries. Tables must be deleted first so their metadata goes with them.
+func (r *Registry) Delete(name string) error {
+	w, err := r.Get(name)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	if err := r.DB.Select(&tables, `SELECT table_name FROM table_metadata`); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if w.Owns(t) {
+			return fmt.Errorf("%w: delete %s first", ErrNotEmpty, t)
+		}
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		`DELETE FROM saved_queries WHERE workspace_id = $1`,
+		`DELETE FROM workspace_api_keys WHERE workspace_id = $1`,
+		`DELETE FROM workspaces WHERE id = $1`,
+	} {
+		if _, err := tx.Exec(stmt, w.ID); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range []string{
+		fmt.Sprintf(`DROP SCHEMA IF EXISTS "%s" CASCADE`, w.Schema),
+		fmt.Sprintf(`DROP OWNED BY "%s"`, w.Role),
+		fmt.Sprintf(`DROP ROLE IF EXISTS "%s"`, w.Role),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("delete workspace %s: %w", name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Keys lists a workspace's API keys, oldest first
+func (r *Registry) Keys(name string) ([]Key, error) {
+	w, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	keys := []Key{}
+	err = r.DB.Select(&keys, `
+		SELECT id, key_prefix, label, scope, expires_at, last_used_at, created_at
+		FROM workspace_api_keys WHERE workspace_id = $1 ORDER BY id`, w.ID)
+	return keys, err
+}
+
+// IssueKey adds an API key to a workspace, returning it in full once
+func (r *Registry) IssueKey(name string, opts KeyOptions) (Key, string, error) {
+	if err := opts.check(); err != nil {
+		return Key{}, "", err
+	}
+	w, err := r.Get(name)
+	if err != nil {
+		return Key{}, "", err
+	}
+	key, k, err := issueKey(r.DB, w.ID, opts)
+	return k, key, err
+}
+
+// RevokeKey deletes one of a workspace's API keys
+func (r *Registry) RevokeKey(name string, id int) error {
+	w, err := r.Get(name)
+	if err != nil {
+		return err
+	}
+	res, err := r.DB.Exec(`DELETE FROM workspace_api_keys WHERE id = $1 AND workspace_id = $2`, id, w.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: no key %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+// Authenticate returns the workspace an API key belongs to and the key's
+// details, and records that the key was used
+func (r *Registry) Authenticate(key string) (*Workspace, Key, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return nil, Key{}, ErrNotFound
+	}
+	var row struct {
+		Workspace
+		KeyID      int        `db:"key_id"`
+		Scope      string     `db:"scope"`
+		ExpiresAt  *time.Time `db:"expires_at"`
+		LastUsedAt *time.Time `db:"last_used_at"`
+	}
+	err := r.DB.Get(&row, `
+		SELECT w.id, w.name, w.schema_name, w.role_name, w.created_at,
+		       k.id AS key_id, k.scope, k.expires_at, k.last_used_at
+		FROM workspace_api_keys k JOIN workspaces w ON w.id = k.workspace_id
+		WHERE k.key_hash = $1`, hashKey(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, Key{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Key{}, err
+	}
+
+	now := time.Now().UTC()
+	if row.ExpiresAt != nil && !now.Before(*row.ExpiresAt) {
+		return nil, Key{}, ErrExpired
+	}
+	if row.LastUsedAt == nil || now.Sub(*row.LastUsedAt) >= lastUsedPrecision {
+		if _, err := r.DB.Exec(`UPDATE workspace_api_keys SET last_used_at = $1 WHERE id = $2`, now, row.KeyID); err != nil {
+			return nil, Key{}, err
+		}
+		row.LastUsedAt = &now
+	}
+	w := row.Workspace
+	return &w, Key{ID: row.KeyID, Scope: row.Scope, ExpiresAt: row.ExpiresAt, LastUsedAt: row.LastUsedAt}, nil
+}
+
+// issueKey generates a key for workspace id and stores its hash on q
+func issueKey(q sqlx.Queryer, id int, opts KeyOptions) (string, Key, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", Key{}, err
+	}
+	key := KeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	k := Key{Prefix: key[:len(KeyPrefix)+6], Label: opts.Label, Scope: opts.Scope, ExpiresAt: opts.ExpiresAt}
+	if k.ExpiresAt != nil {
+		utc := k.ExpiresAt.UTC()
+		k.ExpiresAt = &utc
+	}
+	err := q.QueryRowx(`
+		INSERT INTO workspace_api_keys (workspace_id, key_hash, key_prefix, label, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		id, hashKey(key), k.Prefix, k.Label, k.Scope, k.ExpiresAt).Scan(&k.ID, &k.CreatedAt)
+	return key, k, err
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
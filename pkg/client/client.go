@@ -0,0 +1,188 @@
+// Package client is a Go SDK for the GoDataFlow REST API. It wraps the /v1
+// routes with typed methods, sends the API key, retries transient failures
+// and pages through query results.
+//
+//	c := client.New("http://localhost:8080", client.Options{APIKey: key})
+//	rows, err := c.QueryAll(ctx, client.QueryOptions{Table: "sales"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures a Client; zero values use the defaults below
+type Options struct {
+	APIKey     string        // sent as "Authorization: Bearer <key>"
+	HTTPClient *http.Client  // default: http.Client with a 1 minute timeout
+	MaxRetries int           // extra attempts after a transient failure (default 3, -1 disables)
+	RetryWait  time.Duration // first backoff, doubled per attempt (default 500ms)
+	UserAgent  string
+}
+
+// Client calls one GoDataFlow server. It is safe for concurrent use.
+type Client struct {
+	base       string
+	apiKey     string
+	http       *http.Client
+	maxRetries int
+	retryWait  time.Duration
+	userAgent  string
+}
+
+// New returns a Client for the server at baseURL (e.g. "http://localhost:8080")
+func New(baseURL string, opts Options) *Client {
+	c := &Client{
+		base:       strings.TrimRight(baseURL, "/") + "/v1",
+		apiKey:     opts.APIKey,
+		http:       opts.HTTPClient,
+		maxRetries: opts.MaxRetries,
+		retryWait:  opts.RetryWait,
+		userAgent:  opts.UserAgent,
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: time.Minute}
+	}
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = 3
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+	if c.retryWait <= 0 {
+		c.retryWait = 500 * time.Millisecond
+	}
+	if c.userAgent == "" {
+		c.userAgent = "godataflow-go-client"
+	}
+	return c
+}
+
+// APIError is a non-2xx answer from the server, carrying its "error" and
+// "details" fields
+type APIError struct {
+	StatusCode int
+	Message    string
+	Details    string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	return fmt.Sprintf("godataflow: %d %s", e.StatusCode, msg)
+}
+
+// retryable reports whether a response status is worth another attempt.
+// POSTs are only retried on 429, where the server refused before doing work.
+func retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	if method == http.MethodPost {
+		return false
+	}
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// do sends a JSON request and decodes a 2xx response into out (if non-nil),
+// retrying transient failures with exponential backoff
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("godataflow: encode request: %w", err)
+		}
+	}
+
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", c.userAgent)
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+
+		resp, err := c.http.Do(req)
+		var apiErr *APIError
+		if err == nil {
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				defer resp.Body.Close()
+				if out == nil {
+					return nil
+				}
+				dec := json.NewDecoder(resp.Body)
+				dec.UseNumber()
+				if err := dec.Decode(out); err != nil {
+					return fmt.Errorf("godataflow: decode response: %w", err)
+				}
+				return nil
+			}
+			apiErr = readAPIError(resp)
+			if retry := resp.Header.Get("Retry-After"); retry != "" {
+				if secs, perr := strconv.Atoi(retry); perr == nil && secs > 0 {
+					wait = time.Duration(secs) * time.Second
+				}
+			}
+			err = apiErr
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Network errors are retried for idempotent methods only
+		retry := apiErr == nil && method != http.MethodPost
+		if apiErr != nil {
+			retry = retryable(method, apiErr.StatusCode)
+		}
+		if !retry || attempt >= c.maxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+// readAPIError drains and closes resp, decoding the API's error body if present
+func readAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	e := &APIError{StatusCode: resp.StatusCode}
+	var body struct {
+		Error   string `json:"error"`
+		Details string `json:"details"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(raw, &body) == nil {
+		e.Message, e.Details = body.Error, body.Details
+	}
+	return e
+}
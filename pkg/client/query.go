@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Row is one result row keyed by column name. Numbers decode as json.Number.
+type Row = map[string]interface{}
+
+// IngestResult is the answer of POST /ingest/:table_name
+type IngestResult struct {
+	Message   string   `json:"message"`
+	TableName string   `json:"table_name"`
+	RowCount  int      `json:"row_count"`
+	Columns   []string `json:"columns"`
+	BatchID   string   `json:"batch_id,omitempty"`
+}
+
+// Ingest inserts rows into a registered table in one batch. Every row must
+// have the same keys as the first.
+func (c *Client) Ingest(ctx context.Context, table string, rows []Row) (*IngestResult, error) {
+	var r IngestResult
+	if err := c.do(ctx, http.MethodPost, "/ingest/"+url.PathEscape(table), nil, rows, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// QueryOptions selects rows for Query and its pagination helpers
+type QueryOptions struct {
+	Table  string
+	Filter string // SQL condition, e.g. "region='Asia'"
+	Limit  int    // rows per request (default 100)
+	Offset int
+}
+
+// Query fetches one page of rows from GET /query
+func (c *Client) Query(ctx context.Context, opts QueryOptions) ([]Row, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 100
+	}
+	q := url.Values{
+		"table":  {opts.Table},
+		"limit":  {strconv.Itoa(opts.Limit)},
+		"offset": {strconv.Itoa(opts.Offset)},
+	}
+	if opts.Filter != "" {
+		q.Set("filter", opts.Filter)
+	}
+	var page struct {
+		Data []Row `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/query", q, nil, &page); err != nil {
+		return nil, err
+	}
+	return page.Data, nil
+}
+
+// QueryPages calls fn with successive pages of opts.Limit rows, starting at
+// opts.Offset, until a short page arrives or fn returns an error
+func (c *Client) QueryPages(ctx context.Context, opts QueryOptions, fn func([]Row) error) error {
+	if opts.Limit <= 0 {
+		opts.Limit = 100
+	}
+	for {
+		rows, err := c.Query(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := fn(rows); err != nil {
+				return err
+			}
+		}
+		if len(rows) < opts.Limit {
+			return nil
+		}
+		opts.Offset += len(rows)
+	}
+}
+
+// QueryAll collects every matching row, paging opts.Limit rows at a time
+func (c *Client) QueryAll(ctx context.Context, opts QueryOptions) ([]Row, error) {
+	all := []Row{}
+	err := c.QueryPages(ctx, opts, func(rows []Row) error {
+		all = append(all, rows...)
+		return nil
+	})
+	return all, err
+}
+
+// SavedQuery is a stored SQL query
+type SavedQuery struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	SQLText     string `json:"sql_text"`
+	Description string `json:"description,omitempty"`
+}
+
+// ListSavedQueries returns every saved query
+func (c *Client) ListSavedQueries(ctx context.Context) ([]SavedQuery, error) {
+	var queries []SavedQuery
+	err := c.do(ctx, http.MethodGet, "/queries", nil, nil, &queries)
+	return queries, err
+}
+
+// CreateSavedQuery stores a query; ID is ignored and the saved copy returned
+func (c *Client) CreateSavedQuery(ctx context.Context, q SavedQuery) (*SavedQuery, error) {
+	body := map[string]string{"name": q.Name, "sql_text": q.SQLText, "description": q.Description}
+	var saved SavedQuery
+	if err := c.do(ctx, http.MethodPost, "/queries", nil, body, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// RunSavedQuery executes a saved query and returns its rows
+func (c *Client) RunSavedQuery(ctx context.Context, id int) ([]Row, error) {
+	var resp struct {
+		Result []Row `json:"result"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/queries/run/"+strconv.Itoa(id), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
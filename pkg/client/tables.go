@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Table is a registered table as returned by GET /tables
+type Table struct {
+	ID                 int             `json:"id"`
+	TableName          string          `json:"table_name"`
+	TableType          string          `json:"table_type"`
+	RefreshInterval    *int            `json:"refresh_interval,omitempty"`
+	DataSourceURL      *string         `json:"data_source_url,omitempty"`
+	LastRefreshSuccess *time.Time      `json:"last_refresh_success,omitempty"`
+	LastRefreshError   *string         `json:"last_refresh_error,omitempty"`
+	Status             string          `json:"status"`
+	MappingJSON        json.RawMessage `json:"mapping_json,omitempty"`
+	WatermarkColumn    *string         `json:"watermark_column,omitempty"`
+	WatermarkValue     *string         `json:"watermark_value,omitempty"`
+	ConfigVersion      int             `json:"config_version"` // served as the ETag of GET /tables/:name
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+// CreateTableRequest is the body of POST /tables
+type CreateTableRequest struct {
+	TableName       string            `json:"table_name"` // "name" or "schema.name" (Postgres)
+	TableType       string            `json:"table_type"`
+	RefreshInterval *int              `json:"refresh_interval,omitempty"` // seconds
+	Columns         map[string]string `json:"columns"`                    // name -> SQL type
+	Provenance      bool              `json:"provenance,omitempty"`       // add _ingested_at, _source and _batch_id
+}
+
+// TableConfig is the body of PUT /tables/:name/config. RefreshInterval and
+// DataSourceURL are always written, so send the current values to keep them.
+// Set UpdatedAt to the table's UpdatedAt as read to fail with a 409 APIError
+// instead of overwriting someone else's change.
+type TableConfig struct {
+	RefreshInterval *int            `json:"refresh_interval"`
+	DataSourceURL   *string         `json:"data_source_url"`
+	MappingJSON     json.RawMessage `json:"mapping_json,omitempty"`
+	WatermarkColumn *string         `json:"watermark_column,omitempty"`
+	ResetWatermark  bool            `json:"reset_watermark,omitempty"`
+	UpdatedAt       *time.Time      `json:"updated_at,omitempty"`
+}
+
+// Column describes one column of a table
+type Column struct {
+	ColumnName string `json:"column_name"`
+	DataType   string `json:"data_type"`
+}
+
+// ListTables returns every registered table
+func (c *Client) ListTables(ctx context.Context) ([]Table, error) {
+	var tables []Table
+	err := c.do(ctx, http.MethodGet, "/tables", nil, nil, &tables)
+	return tables, err
+}
+
+// CreateTable creates and registers a table
+func (c *Client) CreateTable(ctx context.Context, req CreateTableRequest) (*Table, error) {
+	var t Table
+	if err := c.do(ctx, http.MethodPost, "/tables", nil, req, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteTable drops a table and its metadata
+func (c *Client) DeleteTable(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/tables/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// TableColumns lists a table's columns
+func (c *Client) TableColumns(ctx context.Context, name string) ([]Column, error) {
+	var cols []Column
+	err := c.do(ctx, http.MethodGet, "/tables/"+url.PathEscape(name)+"/columns", nil, nil, &cols)
+	return cols, err
+}
+
+// UpdateTableConfig sets a table's refresh interval, source and mapping
+func (c *Client) UpdateTableConfig(ctx context.Context, name string, cfg TableConfig) error {
+	return c.do(ctx, http.MethodPut, "/tables/"+url.PathEscape(name)+"/config", nil, cfg, nil)
+}
+
+// RefreshResult is the answer of POST /refresh/:table
+type RefreshResult struct {
+	Table        string `json:"table"`
+	Status       string `json:"status"`
+	InsertedRows int    `json:"inserted_rows"`
+	Unchanged    bool   `json:"unchanged"`
+	Message      string `json:"message"`
+	BatchID      string `json:"batch_id,omitempty"`
+	Rejected     int    `json:"rejected,omitempty"` // rows skipped by insert modes batch and row
+}
+
+// Refresh runs a table's ETL refresh now and waits for it to finish
+func (c *Client) Refresh(ctx context.Context, table string) (*RefreshResult, error) {
+	var r RefreshResult
+	if err := c.do(ctx, http.MethodPost, "/refresh/"+url.PathEscape(table), nil, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}